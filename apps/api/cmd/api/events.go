@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+const eventsUsage = `Usage: api events <command>
+
+Commands:
+  replay <type> <id> [sequence]   Print an aggregate's state rebuilt from its
+                                  events, as of sequence (default latest).
+                                  type is organization, project, node or file.
+`
+
+var aggregateTypes = map[string]bool{
+	services.AggregateOrganization: true,
+	services.AggregateProject:      true,
+	services.AggregateNode:         true,
+	services.AggregateFile:         true,
+}
+
+// runEvents runs `api events` with the API's database settings and returns
+// the exit code. It needs only DATABASE_URL (or the DB_* settings).
+func runEvents(args []string) int {
+	if len(args) < 3 || args[0] != "replay" || !aggregateTypes[args[1]] {
+		fmt.Fprint(os.Stderr, eventsUsage)
+		return 2
+	}
+	aggregateID, err := uuid.Parse(args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid ID: %s\n", args[2])
+		return 2
+	}
+	sequence := 0
+	if len(args) > 3 {
+		if sequence, err = strconv.Atoi(args[3]); err != nil || sequence < 1 {
+			fmt.Fprintf(os.Stderr, "Invalid sequence: %s\n", args[3])
+			return 2
+		}
+	}
+
+	if os.Getenv("GO_ENV") != "production" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found")
+		}
+	}
+
+	logger, err := initLogger()
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	cfg, err := config.LoadWorker()
+	if err != nil {
+		logger.Error("Failed to load configuration", zap.Error(err))
+		return 1
+	}
+
+	db, err := database.NewConnection(cfg.DatabaseURL, database.PoolOptionsFrom(cfg))
+	if err != nil {
+		logger.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	state, err := services.NewEventStore(db, nil, logger).Replay(ctx, args[1], aggregateID, sequence)
+	if errors.Is(err, services.ErrNotFound) {
+		fmt.Fprintf(os.Stderr, "No events recorded for %s %s\n", args[1], aggregateID)
+		return 1
+	}
+	if err != nil {
+		logger.Error("Replay failed", zap.Error(err))
+		return 1
+	}
+	out, _ := json.MarshalIndent(state, "", "  ")
+	fmt.Println(string(out))
+	return 0
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"net"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/handlers"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+// serveWorkerGRPC starts the gRPC worker API on its own port, or returns nil
+// when GRPC_PORT isn't set
+func serveWorkerGRPC(cfg *config.Config, worker *handlers.WorkerGRPC, logger *zap.Logger) *grpc.Server {
+	if cfg.GRPCPort == "" {
+		return nil
+	}
+	lis, err := net.Listen("tcp", ":"+cfg.GRPCPort)
+	if err != nil {
+		logger.Fatal("Failed to listen for gRPC", zap.String("port", cfg.GRPCPort), zap.Error(err))
+	}
+
+	server := handlers.NewWorkerGRPCServer(cfg.InternalServiceToken, worker, logger)
+	go func() {
+		logger.Info("Starting gRPC server", zap.String("port", cfg.GRPCPort))
+		if err := server.Serve(lis); err != nil {
+			logger.Fatal("gRPC server failed", zap.Error(err))
+		}
+	}()
+	return server
+}
+
+// stopWorkerGRPC lets calls in flight finish until ctx is done, then closes
+// any still open. Trace streams can stay open for a whole execution.
+func stopWorkerGRPC(ctx context.Context, server *grpc.Server) {
+	if server == nil {
+		return
+	}
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		server.Stop()
+	}
+}
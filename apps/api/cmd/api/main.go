@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
@@ -9,21 +10,42 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/authz"
 	"github.com/glassbox/api/internal/config"
 	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/devworker"
+	"github.com/glassbox/api/internal/events"
 	"github.com/glassbox/api/internal/handlers"
+	"github.com/glassbox/api/internal/mail"
 	"github.com/glassbox/api/internal/middleware"
+	"github.com/glassbox/api/internal/models"
 	"github.com/glassbox/api/internal/queue"
 	"github.com/glassbox/api/internal/services"
 	"github.com/glassbox/api/internal/storage"
+	"github.com/glassbox/api/internal/telemetry"
 	"github.com/glassbox/api/internal/websocket"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/joho/godotenv"
 	"go.uber.org/zap"
 )
 
 func main() {
+	// `api migrate ...` manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+	// `api events replay ...` rebuilds an aggregate from its events and exits
+	if len(os.Args) > 1 && os.Args[1] == "events" {
+		os.Exit(runEvents(os.Args[2:]))
+	}
+	// `api openapi` writes the OpenAPI document and exits
+	if len(os.Args) > 1 && os.Args[1] == "openapi" {
+		os.Exit(runOpenAPI(os.Args[2:]))
+	}
+
 	// Load .env file in development
 	if os.Getenv("GO_ENV") != "production" {
 		if err := godotenv.Load(); err != nil {
@@ -44,15 +66,29 @@ func main() {
 		logger.Fatal("Failed to load configuration", zap.Error(err))
 	}
 
+	// Initialize tracing
+	shutdownTracing, err := telemetry.Setup(context.Background(), cfg)
+	if err != nil {
+		logger.Fatal("Failed to initialize tracing", zap.Error(err))
+	}
+
 	// Initialize database connection
-	db, err := database.NewConnection(cfg.DatabaseURL)
+	db, err := database.NewConnection(cfg.DatabaseURL, database.PoolOptionsFrom(cfg))
 	if err != nil {
 		logger.Fatal("Failed to connect to database", zap.Error(err))
 	}
 	defer db.Close()
 
-	// Run database migrations (idempotent - safe to run on every startup)
-	if err := database.RunMigrations(db, logger); err != nil {
+	// Lists, search and traces read from replicas when configured
+	if len(cfg.DatabaseReplicaURLs) > 0 {
+		if err := db.ConnectReplicas(cfg.DatabaseReplicaURLs, cfg.DatabaseReplicaMaxLag, logger); err != nil {
+			logger.Fatal("Failed to connect to read replicas", zap.Error(err))
+		}
+	}
+
+	// Apply pending migrations, or with AUTO_MIGRATE=false check there are
+	// none
+	if err := database.RunMigrations(db, cfg.AutoMigrate, logger); err != nil {
 		logger.Fatal("Failed to run database migrations", zap.Error(err))
 	}
 
@@ -69,22 +105,139 @@ func main() {
 		logger.Fatal("Failed to initialize S3 client", zap.Error(err))
 	}
 
-	// Initialize SQS client
-	sqsClient, err := queue.NewSQSClient(cfg, logger)
+	// Initialize the job queue
+	jobQueue, err := queue.New(cfg, redis, logger)
 	if err != nil {
-		logger.Fatal("Failed to initialize SQS client", zap.Error(err))
+		logger.Fatal("Failed to initialize job queue", zap.Error(err))
+	}
+	// Delays beyond what the backend supports are held in Redis
+	scheduler := queue.NewScheduler(jobQueue, redis, logger)
+	outbox := queue.NewOutbox(db, scheduler, logger)
+	dispatcher := queue.NewDispatcher(scheduler, outbox, logger)
+	quarantine := queue.NewQuarantine(db, outbox, logger)
+
+	// Domain events for downstream subscribers (disabled without a topic)
+	publisher, err := events.New(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize event publisher", zap.Error(err))
 	}
 
 	// Initialize services
-	svc := services.NewServices(db, redis, s3Client, sqsClient, cfg, logger)
+	svc := services.NewServices(db, redis, s3Client, dispatcher, cfg, logger)
+	svc.Nodes.SetEventPublisher(publisher)
+
+	// WebSocket channels are authorized like the REST API: reading the
+	// project or node, from an address the org's IP allowlist accepts.
+	// Roles and resource orgs are cached in Redis by authz.
+	wsIPAllowed := func(ctx context.Context, orgID uuid.UUID, clientIP string) error {
+		allowed, err := svc.IPAllowlist.IsIPAllowed(ctx, orgID, clientIP)
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			return websocket.ErrUnauthorized
+		}
+		return nil
+	}
+	wsChannelAuthorizer := func(ctx context.Context, userID, clientIP string, ch *websocket.Channel) (uuid.UUID, error) {
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			return uuid.Nil, websocket.ErrUnauthorized
+		}
+		access, ok := wsChannelAccess[ch.Kind()]
+		if !ok {
+			return uuid.Nil, websocket.ErrUnauthorized
+		}
+		decision, err := svc.Authz.Authorize(ctx, uid, access.action, authz.Resource{Type: access.resource, ID: ch.ID})
+		if errors.Is(err, authz.ErrNotFound) || errors.Is(err, authz.ErrForbidden) {
+			return uuid.Nil, websocket.ErrUnauthorized
+		}
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if err := wsIPAllowed(ctx, decision.OrgID, clientIP); err != nil {
+			return uuid.Nil, err
+		}
+		return decision.OrgID, nil
+	}
 
-	// Initialize handlers
-	h := handlers.NewHandlers(svc, logger)
+	// Collaborative editing needs the same access as updating the node over
+	// REST, but not the node lock: concurrent CRDT edits merge
+	wsDocumentAuthorizer := func(ctx context.Context, userID, clientIP string, nodeID uuid.UUID) error {
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			return websocket.ErrUnauthorized
+		}
+		decision, err := svc.Authz.Authorize(ctx, uid, authz.NodeUpdate, authz.Resource{Type: authz.ResourceNode, ID: nodeID})
+		if errors.Is(err, authz.ErrNotFound) || errors.Is(err, authz.ErrForbidden) {
+			return websocket.ErrUnauthorized
+		}
+		if err != nil {
+			return err
+		}
+		return wsIPAllowed(ctx, decision.OrgID, clientIP)
+	}
 
 	// Initialize WebSocket hub
-	wsHub := websocket.NewHub(redis, logger)
+	wsHub := websocket.NewHub(redis, wsChannelAuthorizer, logger)
+	wsHub.SetDocumentStore(svc.Documents, wsDocumentAuthorizer)
+	wsHub.SetProjectOrgResolver(func(ctx context.Context, projectID uuid.UUID) (uuid.UUID, error) {
+		return svc.Authz.OrgFor(ctx, authz.Resource{Type: authz.ResourceProject, ID: projectID})
+	})
+	wsHub.SetConnectionLimits(websocket.ConnectionLimits{
+		PerUser:         cfg.WSMaxConnsPerUser,
+		PerOrg:          cfg.WSMaxConnsPerOrg,
+		IdleTimeout:     cfg.WSIdleTimeout,
+		SessionLifetime: cfg.WSSessionLifetime,
+	})
+	svc.Notifications.SetPusher(func(n *models.Notification, unreadCount int) {
+		wsHub.PushNotification(n.UserID, wsNotificationPayload(n), unreadCount)
+	})
+	if cfg.SMTPHost != "" {
+		mailer, err := mail.NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.MailFrom)
+		if err != nil {
+			logger.Fatal("Invalid mail configuration", zap.Error(err))
+		}
+		svc.Notifications.SetMailer(mailer.Send)
+		svc.Invitations.SetMailer(mailer.Send)
+		svc.Digests.SetMailer(mailer.Send)
+	}
+	svc.Files.SetStatusNotifier(func(f *models.File) {
+		wsHub.BroadcastFileProcessing(websocket.FileProcessingPayload{
+			FileID:   f.ID,
+			OrgID:    f.OrgID,
+			Filename: f.Filename,
+			Status:   f.ProcessingStatus,
+		})
+	})
 	go wsHub.Run()
 
+	// Publish jobs written to the outbox. In development the workers can run
+	// in process too; jobs go through the same queue the API dispatches to.
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	go outbox.Run(jobsCtx)
+	go scheduler.Run(jobsCtx)
+	go publisher.Run(jobsCtx)
+	go db.MonitorReplicas(jobsCtx, logger)
+	go svc.Listener.Run(jobsCtx)
+	go svc.Purge.Run(jobsCtx)
+	go svc.Digests.Run(jobsCtx)
+	go svc.Notifications.RunDeferred(jobsCtx)
+	go svc.TracePartitions.Run(jobsCtx)
+	if cfg.InProcessWorkers {
+		go devworker.New(jobQueue, db, s3Client, wsHub, svc.Notifications, logger).Run(jobsCtx)
+	}
+
+	// Initialize handlers
+	h := handlers.NewHandlers(svc, wsHub, jobQueue, quarantine, publisher, logger)
+	h.Metrics = handlers.NewMetricsHandler(logger, db, svc.Purge, svc.TracePartitions)
+	h.Health.AddCheck("database", db.Pool.Ping)
+	h.Health.AddDegradableCheck("redis", redis.Ping,
+		"Node locks fall back to the database, sign-in lockouts are off, live updates don't reach clients on other instances, and signed internal requests are refused")
+	h.Health.AddDegradableCheck("s3", s3Client.HeadBucket, "File uploads and downloads fail")
+	h.Health.SetMigrationStatus(svc.Admin.MigrationStatus)
+	h.Health.SetReplicaStatus(db.ReplicaStatus)
+
 	// Create WebSocket token validator using auth service
 	wsTokenValidator := func(ctx context.Context, token string) (*websocket.WSTokenData, error) {
 		data, err := svc.Auth.ValidateWSToken(ctx, token)
@@ -98,11 +251,33 @@ func main() {
 		}, nil
 	}
 
+	// WebSocket origins: ALLOWED_ORIGINS plus any custom origins configured by
+	// the user's orgs
+	wsOriginChecker := func(ctx context.Context, userID, origin string) bool {
+		if cfg.IsOriginAllowed(origin) {
+			return true
+		}
+		uid, err := uuid.Parse(userID)
+		if err != nil {
+			return false
+		}
+		allowed, err := svc.Orgs.AllowsOriginForUser(ctx, uid, origin)
+		if err != nil {
+			logger.Warn("Failed to check org WebSocket origins", zap.Error(err))
+			return false
+		}
+		return allowed
+	}
+
 	// Initialize WebSocket handler
-	wsHandler := websocket.NewHandler(wsHub, redis, wsTokenValidator, logger)
+	wsHandler := websocket.NewHandler(wsHub, redis, wsTokenValidator, wsOriginChecker, logger)
+	wsHandler.SetCompression(websocket.CompressionOptions{
+		Level:    cfg.WSCompressionLevel,
+		MinBytes: cfg.WSCompressionMinBytes,
+	})
 
 	// Setup router
-	router := setupRouter(cfg, h, wsHandler, logger)
+	router := setupRouter(cfg, h, svc, redis, wsHandler, logger)
 
 	// Create server
 	srv := &http.Server{
@@ -120,6 +295,7 @@ func main() {
 			logger.Fatal("Server failed", zap.Error(err))
 		}
 	}()
+	grpcServer := serveWorkerGRPC(cfg, h.WorkerGRPC, logger)
 
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
@@ -127,8 +303,14 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
-
-	// Stop WebSocket hub
+	h.Health.Drain()
+	stopJobs()
+
+	// Move WebSocket clients to other instances before stopping the hub;
+	// srv.Shutdown doesn't wait for hijacked connections
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.WSDrainTimeout)
+	wsHub.Drain(drainCtx)
+	cancelDrain()
 	wsHub.Stop()
 
 	// Graceful shutdown with timeout
@@ -138,10 +320,59 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		logger.Fatal("Server forced to shutdown", zap.Error(err))
 	}
+	stopWorkerGRPC(ctx, grpcServer)
+
+	// Flush buffered audit entries
+	svc.Audit.Stop()
+
+	// Flush any buffered spans
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("Failed to flush traces", zap.Error(err))
+	}
 
 	logger.Info("Server exited")
 }
 
+// wsChannelAccess maps each WebSocket channel kind to the permission needed
+// to subscribe to it
+var wsChannelAccess = map[string]struct {
+	resource authz.ResourceType
+	action   authz.Action
+}{
+	websocket.ChannelOrg:       {authz.ResourceOrg, authz.OrgRead},
+	websocket.ChannelProject:   {authz.ResourceProject, authz.ProjectRead},
+	websocket.ChannelNode:      {authz.ResourceNode, authz.NodeRead},
+	websocket.ChannelExecution: {authz.ResourceExecution, authz.ExecutionRead},
+	// Every project in the org, authorized once on subscribe
+	websocket.ChannelOrgProjects: {authz.ResourceOrg, authz.ProjectRead},
+	// Processing updates for the org's files
+	websocket.ChannelOrgFiles: {authz.ResourceOrg, authz.FileRead},
+}
+
+// wsNotificationPayload converts a stored notification for WebSocket delivery
+func wsNotificationPayload(n *models.Notification) websocket.NotificationPayload {
+	payload := websocket.NotificationPayload{
+		ID:               n.ID,
+		NotificationType: n.Type,
+		Title:            n.Title,
+		CreatedAt:        n.CreatedAt,
+		Read:             n.ReadAt != nil,
+		Count:            n.Count,
+	}
+	if n.Body != nil {
+		payload.Message = *n.Body
+	}
+	if n.ResourceType != nil && n.ResourceID != nil {
+		switch authz.ResourceType(*n.ResourceType) {
+		case authz.ResourceProject:
+			payload.ProjectID = n.ResourceID
+		case authz.ResourceNode:
+			payload.NodeID = n.ResourceID
+		}
+	}
+	return payload
+}
+
 func initLogger() (*zap.Logger, error) {
 	if os.Getenv("GO_ENV") == "production" {
 		return zap.NewProduction()
@@ -149,147 +380,374 @@ func initLogger() (*zap.Logger, error) {
 	return zap.NewDevelopment()
 }
 
-func setupRouter(cfg *config.Config, h *handlers.Handlers, wsHandler *websocket.Handler, logger *zap.Logger) *gin.Engine {
+func setupRouter(cfg *config.Config, h *handlers.Handlers, svc *services.Services, redis *database.Redis, wsHandler *websocket.Handler, logger *zap.Logger) *gin.Engine {
 	if cfg.Environment == "production" {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
 	r := gin.New()
 
+	// Only trust X-Forwarded-For from known proxies so client IPs can't be spoofed
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		logger.Fatal("Invalid trusted proxy configuration", zap.Error(err))
+	}
+
 	// Global middleware
-	r.Use(gin.Recovery())
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Internal server error")
+	}))
+	r.Use(middleware.Tracing())
 	r.Use(middleware.Logger(logger))
-	r.Use(middleware.CORS(cfg.AllowedOrigins))
+	r.Use(middleware.CORS(cfg))
 	r.Use(middleware.RequestID())
-
-	// Health check (no auth required)
-	r.GET("/health", h.Health.Check)
+	r.Use(middleware.Compress(cfg.CompressionMinBytes))
+
+	// Read-only mode: mutating requests get 503 while operators run migrations.
+	// WS tokens stay available so clients can keep receiving live updates,
+	// admins can turn it off again, and workers can still report on the jobs
+	// they're running. Search and GraphQL (which has no mutations) are reads
+	// sent as POST.
+	r.Use(middleware.Maintenance(svc.Maintenance,
+		"/api/v1/auth/ws-token", "/api/v2/auth/ws-token",
+		"/api/v1/admin/maintenance", "/api/v2/admin/maintenance",
+		"/api/v1/graphql", "/api/v2/graphql",
+		"/api/v1/orgs/:orgId/search", "/api/v2/orgs/:orgId/search",
+		"/api/v1/orgs/:orgId/search/semantic", "/api/v2/orgs/:orgId/search/semantic",
+		"/internal/*",
+	))
+
+	// Unknown routes get the standard error body too
+	r.NoRoute(func(c *gin.Context) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Route not found")
+	})
+
+	// Health checks (no auth required). Liveness only needs the process;
+	// readiness checks the dependencies. /health is the readiness check,
+	// kept for existing load balancer configs. Info adds the build, schema
+	// version and what's degraded, for clients and incident triage.
+	r.GET("/health/live", h.Health.Live)
+	r.GET("/health/ready", h.Health.Ready)
+	r.GET("/health", h.Health.Ready)
+	r.GET("/health/info", h.Health.Info)
+
+	// Prometheus metrics, scraped with the internal service token
+	r.GET("/metrics", middleware.InternalAuth(cfg, redis, logger), h.Metrics.Serve)
 
 	// WebSocket endpoint (auth via token query param)
 	r.GET("/ws", wsHandler.ServeWS)
 
-	// API v1 routes
+	// Internal API for workers (service token or HMAC-signed requests; never
+	// user tokens). Unversioned: workers and the API deploy together.
+	internal := r.Group("/internal")
+	internal.Use(middleware.InternalAuth(cfg, redis, logger))
+	{
+		internal.POST("/executions/:executionId/events", h.Internal.ExecutionEvent)
+		internal.POST("/executions/:executionId/progress", h.Internal.ExecutionProgress)
+		internal.POST("/files/:fileId/events", h.Internal.FileEvent)
+		internal.POST("/users/:userId/messages", h.Internal.UserMessage)
+	}
+
+	// API v1 routes. Once API_V1_DEPRECATED_AT or API_V1_SUNSET is set, every
+	// v1 response carries Deprecation/Sunset headers pointing at v2.
 	v1 := r.Group("/api/v1")
+	v1.Use(middleware.APIVersion("v1"))
+	if cfg.APIV1DeprecatedAt != nil || cfg.APIV1Sunset != nil {
+		v1.Use(middleware.Deprecated(cfg.APIV1DeprecatedAt, cfg.APIV1Sunset, "/api/v2"))
+	}
+	registerAPIRoutes(v1, cfg, h, svc)
+
+	// The OpenAPI document for v1, generated from handlers.APIRoutes, and an
+	// explorer for it in development
+	v1.GET("/openapi.json", h.OpenAPI.Spec)
+	if cfg.IsDevelopment() {
+		v1.GET("/docs", h.OpenAPI.SwaggerUI)
+	}
+
+	// API v2 routes. Handlers are shared with v1; v2's differences are applied
+	// by the shims in handlers/versioning.go.
+	v2 := r.Group("/api/v2")
+	v2.Use(middleware.APIVersion("v2"))
+	v2.Use(middleware.TransformResponse(handlers.V2Response))
+	registerAPIRoutes(v2, cfg, h, svc)
+
+	return r
+}
+
+// registerAPIRoutes registers the REST API on a versioned route group
+func registerAPIRoutes(api *gin.RouterGroup, cfg *config.Config, h *handlers.Handlers, svc *services.Services) {
+	// Auth routes
+	auth := api.Group("/auth")
 	{
-		// Auth routes
-		auth := v1.Group("/auth")
+		// Endpoints that issue tokens from credentials are guarded against
+		// brute force, per IP and per identity
+		guard := middleware.AuthGuard(svc.AuthGuard, "email")
+
+		// Dev token endpoint (no auth required - for local development only)
+		if cfg.IsDevelopment() {
+			auth.POST("/dev-token", guard, h.Auth.GenerateDevToken)
+		}
+		auth.POST("/ws-token", middleware.Auth(cfg), middleware.ActiveAccount(svc.Authz), h.Auth.GetWSToken)
+	}
+
+	// Protected routes. Routes on a specific resource declare the action
+	// they perform; authorize() checks it against the caller's org role.
+	authorize := func(action authz.Action) gin.HandlerFunc {
+		return middleware.Authorize(svc.Authz, action)
+	}
+
+	// Org API keys are accepted alongside bearer tokens. authorize()
+	// confines them to their org and scopes; routes without it that act on
+	// the user's own account or across orgs refuse them with userOnly.
+	userOnly := middleware.RejectAPIKeys()
+
+	protected := api.Group("")
+	protected.Use(middleware.AuthWithAPIKeys(cfg, svc.APIKeys))
+	protected.Use(middleware.ActiveAccount(svc.Authz))
+	protected.Use(middleware.RateLimit(cfg))
+	protected.Use(middleware.Audit(svc.Audit))
+	protected.Use(middleware.IPAllowlist(svc.IPAllowlist))
+	{
+		// Organizations
+		orgs := protected.Group("/orgs")
+		{
+			orgs.GET("", userOnly, h.Orgs.List)
+			orgs.POST("", userOnly, h.Orgs.Create)
+			orgs.GET("/:orgId", authorize(authz.OrgRead), h.Orgs.Get)
+			orgs.PATCH("/:orgId", authorize(authz.OrgUpdate), h.Orgs.Update)
+			orgs.DELETE("/:orgId", authorize(authz.OrgDelete), h.Orgs.Delete)
+			orgs.GET("/:orgId/permissions/me", userOnly, h.Permissions.Me)
+			orgs.GET("/:orgId/users/search", authorize(authz.OrgRead), h.Orgs.SearchMembers)
+
+			// Members. Admins manage everyone but owners, and can't grant
+			// owner; the org always keeps an active owner.
+			orgs.GET("/:orgId/members", authorize(authz.OrgRead), h.Members.List)
+			orgs.POST("/:orgId/members", authorize(authz.OrgMembers), h.Members.Invite)
+			orgs.PATCH("/:orgId/members/:userId", authorize(authz.OrgMembers), h.Members.UpdateRole)
+			orgs.DELETE("/:orgId/members/:userId", authorize(authz.OrgMembers), h.Members.Remove)
+
+			// Invitations, for people who may not have an account yet.
+			// Invitees accept them under /invitations.
+			orgs.GET("/:orgId/invitations", authorize(authz.OrgMembers), h.Invitations.List)
+			orgs.POST("/:orgId/invitations", authorize(authz.OrgMembers), h.Invitations.Create)
+			orgs.DELETE("/:orgId/invitations/:invitationId", authorize(authz.OrgMembers), h.Invitations.Revoke)
+
+			// API keys, for automations. Only people manage them; a key
+			// can't mint another.
+			orgs.GET("/:orgId/api-keys", userOnly, authorize(authz.OrgAdmin), h.APIKeys.List)
+			orgs.POST("/:orgId/api-keys", userOnly, authorize(authz.OrgAdmin), h.APIKeys.Create)
+			orgs.DELETE("/:orgId/api-keys/:keyId", userOnly, authorize(authz.OrgAdmin), h.APIKeys.Revoke)
+
+			// Projects under org
+			orgs.GET("/:orgId/projects", authorize(authz.ProjectRead), h.Projects.List)
+			orgs.POST("/:orgId/projects", authorize(authz.ProjectCreate), h.Projects.Create)
+
+			// Files under org
+			orgs.POST("/:orgId/files/upload", authorize(authz.FileUpload), h.Files.GetUploadURL)
+
+			// Search under org
+			orgs.POST("/:orgId/search", authorize(authz.Search), h.Search.Search)
+			orgs.POST("/:orgId/search/semantic", authorize(authz.Search), h.Search.SemanticSearch)
+
+			// Audit log: API requests and, with settings.rowAudit, row changes
+			orgs.GET("/:orgId/audit-log", authorize(authz.OrgAdmin), h.Audit.ListForOrg)
+			orgs.GET("/:orgId/audit-log/changes", authorize(authz.OrgAdmin), h.Audit.ListChangesForOrg)
+
+			// IP allowlist
+			orgs.GET("/:orgId/ip-allowlist", authorize(authz.OrgAdmin), h.IPAllowlist.List)
+			orgs.POST("/:orgId/ip-allowlist", authorize(authz.OrgAdmin), h.IPAllowlist.Add)
+			orgs.DELETE("/:orgId/ip-allowlist/:entryId", authorize(authz.OrgAdmin), h.IPAllowlist.Remove)
+			orgs.GET("/:orgId/webhooks", authorize(authz.OrgAdmin), h.Webhooks.List)
+			orgs.POST("/:orgId/webhooks", authorize(authz.OrgAdmin), h.Webhooks.Create)
+			orgs.DELETE("/:orgId/webhooks/:webhookId", authorize(authz.OrgAdmin), h.Webhooks.Delete)
+			orgs.POST("/:orgId/webhooks/:webhookId/test", authorize(authz.OrgAdmin), h.Webhooks.Test)
+
+			// Org template library. Members maintain it; admins delete and
+			// publish to the public catalog.
+			orgs.GET("/:orgId/templates", authorize(authz.TemplateRead), h.Templates.ListForOrg)
+			orgs.GET("/:orgId/templates/outdated-instances", authorize(authz.TemplateRead), h.Templates.ListOutdatedInstances)
+			orgs.POST("/:orgId/templates", authorize(authz.TemplateWrite), h.Templates.Create)
+			orgs.POST("/:orgId/templates/import", authorize(authz.TemplateWrite), h.Templates.Import)
+			orgs.PATCH("/:orgId/templates/:templateId", authorize(authz.TemplateWrite), h.Templates.Update)
+			orgs.DELETE("/:orgId/templates/:templateId", authorize(authz.TemplateDelete), h.Templates.Delete)
+
+			// Domain events
+			orgs.GET("/:orgId/events", authorize(authz.OrgAdmin), h.Events.List(services.AggregateOrganization, "orgId"))
+			orgs.GET("/:orgId/events/state", authorize(authz.OrgAdmin), h.Events.State(services.AggregateOrganization, "orgId"))
+		}
+
+		// Projects
+		projects := protected.Group("/projects")
+		{
+			projects.GET("/:projectId", authorize(authz.ProjectRead), h.Projects.Get)
+			projects.PATCH("/:projectId", authorize(authz.ProjectUpdate), h.Projects.Update)
+			projects.DELETE("/:projectId", authorize(authz.ProjectDelete), h.Projects.Delete)
+			projects.GET("/:projectId/permissions/me", userOnly, h.Permissions.Me)
+			projects.GET("/:projectId/events", authorize(authz.ProjectRead), h.Events.List(services.AggregateProject, "projectId"))
+			projects.GET("/:projectId/events/state", authorize(authz.ProjectRead), h.Events.State(services.AggregateProject, "projectId"))
+
+			// Nodes under project
+			projects.GET("/:projectId/nodes", authorize(authz.NodeRead), h.Nodes.List)
+			projects.POST("/:projectId/nodes", authorize(authz.NodeCreate), h.Nodes.Create)
+		}
+
+		// Nodes
+		nodes := protected.Group("/nodes")
+		{
+			nodes.GET("/:nodeId", authorize(authz.NodeRead), h.Nodes.Get)
+			nodes.PATCH("/:nodeId", authorize(authz.NodeUpdate), h.Nodes.Update)
+			nodes.DELETE("/:nodeId", authorize(authz.NodeDelete), h.Nodes.Delete)
+			nodes.GET("/:nodeId/permissions/me", userOnly, h.Permissions.Me)
+
+			// Node versions
+			nodes.GET("/:nodeId/versions", authorize(authz.NodeRead), h.Nodes.ListVersions)
+			nodes.GET("/:nodeId/versions/:version", authorize(authz.NodeRead), h.Nodes.GetVersion)
+			nodes.POST("/:nodeId/rollback/:version", authorize(authz.NodeUpdate), h.Nodes.Rollback)
+
+			// Domain events
+			nodes.GET("/:nodeId/events", authorize(authz.NodeRead), h.Events.List(services.AggregateNode, "nodeId"))
+			nodes.GET("/:nodeId/events/state", authorize(authz.NodeRead), h.Events.State(services.AggregateNode, "nodeId"))
+
+			// Node inputs/outputs
+			nodes.POST("/:nodeId/inputs", authorize(authz.NodeUpdate), h.Nodes.AddInput)
+			nodes.DELETE("/:nodeId/inputs/:inputId", authorize(authz.NodeUpdate), h.Nodes.RemoveInput)
+			nodes.POST("/:nodeId/outputs", authorize(authz.NodeUpdate), h.Nodes.AddOutput)
+			nodes.DELETE("/:nodeId/outputs/:outputId", authorize(authz.NodeUpdate), h.Nodes.RemoveOutput)
+
+			// Node children and dependencies
+			nodes.GET("/:nodeId/children", authorize(authz.NodeRead), h.Nodes.ListChildren)
+			nodes.GET("/:nodeId/dependencies", authorize(authz.NodeRead), h.Nodes.ListDependencies)
+
+			// Download the subtree as a template file
+			nodes.GET("/:nodeId/template-export", authorize(authz.NodeRead), h.Templates.ExportNode)
+
+			// Collaborator presence
+			nodes.GET("/:nodeId/presence", authorize(authz.NodeRead), h.Presence.Node)
+
+			// Node locking
+			nodes.POST("/:nodeId/lock", authorize(authz.NodeLock), h.Nodes.AcquireLock)
+			nodes.DELETE("/:nodeId/lock", authorize(authz.NodeLock), h.Nodes.ReleaseLock)
+
+			// Node context (for RAG)
+			nodes.GET("/:nodeId/context", authorize(authz.NodeRead), h.Search.GetNodeContext)
+
+			// Agent execution
+			nodes.POST("/:nodeId/execute", authorize(authz.ExecutionStart), h.Executions.Start)
+			nodes.GET("/:nodeId/execution", authorize(authz.ExecutionRead), h.Executions.GetCurrent)
+			nodes.GET("/:nodeId/agent-config", authorize(authz.NodeRead), h.Executions.EffectiveConfig)
+			nodes.POST("/:nodeId/execution/pause", authorize(authz.ExecutionControl), h.Executions.Pause)
+			nodes.POST("/:nodeId/execution/resume", authorize(authz.ExecutionControl), h.Executions.Resume)
+			nodes.POST("/:nodeId/execution/cancel", authorize(authz.ExecutionControl), h.Executions.Cancel)
+		}
+
+		// Executions
+		executions := protected.Group("/executions")
+		{
+			executions.GET("/:executionId", authorize(authz.ExecutionRead), h.Executions.Get)
+			executions.GET("/:executionId/trace", authorize(authz.ExecutionRead), h.Executions.GetTrace)
+			executions.POST("/:executionId/input", authorize(authz.ExecutionControl), h.Executions.ProvideInput)
+			executions.GET("/:executionId/permissions/me", userOnly, h.Permissions.Me)
+		}
+
+		// Files
+		files := protected.Group("/files")
+		{
+			files.POST("/:fileId/confirm", authorize(authz.FileUpload), h.Files.ConfirmUpload)
+			files.GET("/:fileId", authorize(authz.FileRead), h.Files.Get)
+			files.DELETE("/:fileId", authorize(authz.FileDelete), h.Files.Delete)
+			files.GET("/:fileId/permissions/me", userOnly, h.Permissions.Me)
+			files.GET("/:fileId/events", authorize(authz.FileRead), h.Events.List(services.AggregateFile, "fileId"))
+			files.GET("/:fileId/events/state", authorize(authz.FileRead), h.Events.State(services.AggregateFile, "fileId"))
+		}
+
+		// Templates: the public catalog. Apply checks node:create on the
+		// project in the body; system templates are managed under /admin.
+		templates := protected.Group("/templates")
+		templates.Use(userOnly)
 		{
-			// Dev token endpoint (no auth required - for local development only)
-			if cfg.IsDevelopment() {
-				auth.POST("/dev-token", h.Auth.GenerateDevToken)
-			}
-			auth.POST("/ws-token", middleware.Auth(cfg), h.Auth.GetWSToken)
+			templates.GET("", h.Templates.ListPublic)
+			templates.GET("/categories", h.Templates.ListCategories)
+			templates.GET("/:templateId", h.Templates.Get)
+			templates.GET("/:templateId/versions", h.Templates.ListVersions)
+			templates.GET("/:templateId/versions/:version", h.Templates.GetVersion)
+			templates.GET("/:templateId/export", h.Templates.Export)
+			templates.GET("/:templateId/preview", h.Templates.Preview)
+			templates.POST("/:templateId/apply", h.Templates.Apply)
+			templates.PUT("/:templateId/rating", h.Templates.Rate)
+			templates.DELETE("/:templateId/rating", h.Templates.RemoveRating)
 		}
 
-		// Protected routes
-		protected := v1.Group("")
-		protected.Use(middleware.Auth(cfg))
-		protected.Use(middleware.RateLimit(cfg))
+		// User
+		user := protected.Group("/users")
+		user.Use(userOnly)
 		{
-			// Organizations
-			orgs := protected.Group("/orgs")
-			{
-				orgs.GET("", h.Orgs.List)
-				orgs.POST("", h.Orgs.Create)
-				orgs.GET("/:orgId", h.Orgs.Get)
-				orgs.PATCH("/:orgId", h.Orgs.Update)
-				orgs.DELETE("/:orgId", h.Orgs.Delete)
-
-				// Projects under org
-				orgs.GET("/:orgId/projects", h.Projects.List)
-				orgs.POST("/:orgId/projects", h.Projects.Create)
-
-				// Files under org
-				orgs.POST("/:orgId/files/upload", h.Files.GetUploadURL)
-
-				// Search under org
-				orgs.POST("/:orgId/search", h.Search.Search)
-				orgs.POST("/:orgId/search/semantic", h.Search.SemanticSearch)
-			}
-
-			// Projects
-			projects := protected.Group("/projects")
-			{
-				projects.GET("/:projectId", h.Projects.Get)
-				projects.PATCH("/:projectId", h.Projects.Update)
-				projects.DELETE("/:projectId", h.Projects.Delete)
-
-				// Nodes under project
-				projects.GET("/:projectId/nodes", h.Nodes.List)
-				projects.POST("/:projectId/nodes", h.Nodes.Create)
-			}
-
-			// Nodes
-			nodes := protected.Group("/nodes")
-			{
-				nodes.GET("/:nodeId", h.Nodes.Get)
-				nodes.PATCH("/:nodeId", h.Nodes.Update)
-				nodes.DELETE("/:nodeId", h.Nodes.Delete)
-
-				// Node versions
-				nodes.GET("/:nodeId/versions", h.Nodes.ListVersions)
-				nodes.GET("/:nodeId/versions/:version", h.Nodes.GetVersion)
-				nodes.POST("/:nodeId/rollback/:version", h.Nodes.Rollback)
-
-				// Node inputs/outputs
-				nodes.POST("/:nodeId/inputs", h.Nodes.AddInput)
-				nodes.DELETE("/:nodeId/inputs/:inputId", h.Nodes.RemoveInput)
-				nodes.POST("/:nodeId/outputs", h.Nodes.AddOutput)
-				nodes.DELETE("/:nodeId/outputs/:outputId", h.Nodes.RemoveOutput)
-
-				// Node children and dependencies
-				nodes.GET("/:nodeId/children", h.Nodes.ListChildren)
-				nodes.GET("/:nodeId/dependencies", h.Nodes.ListDependencies)
-
-				// Node locking
-				nodes.POST("/:nodeId/lock", h.Nodes.AcquireLock)
-				nodes.DELETE("/:nodeId/lock", h.Nodes.ReleaseLock)
-
-				// Node context (for RAG)
-				nodes.GET("/:nodeId/context", h.Search.GetNodeContext)
-
-				// Agent execution
-				nodes.POST("/:nodeId/execute", h.Executions.Start)
-				nodes.GET("/:nodeId/execution", h.Executions.GetCurrent)
-				nodes.POST("/:nodeId/execution/pause", h.Executions.Pause)
-				nodes.POST("/:nodeId/execution/resume", h.Executions.Resume)
-				nodes.POST("/:nodeId/execution/cancel", h.Executions.Cancel)
-			}
-
-			// Executions
-			executions := protected.Group("/executions")
-			{
-				executions.GET("/:executionId", h.Executions.Get)
-				executions.GET("/:executionId/trace", h.Executions.GetTrace)
-				executions.POST("/:executionId/input", h.Executions.ProvideInput)
-			}
-
-			// Files
-			files := protected.Group("/files")
-			{
-				files.POST("/:fileId/confirm", h.Files.ConfirmUpload)
-				files.GET("/:fileId", h.Files.Get)
-				files.DELETE("/:fileId", h.Files.Delete)
-			}
-
-			// Templates
-			templates := protected.Group("/templates")
-			{
-				templates.GET("", h.Templates.ListPublic)
-				templates.GET("/:templateId", h.Templates.Get)
-				templates.POST("/:templateId/apply", h.Templates.Apply)
-			}
-
-			// User
-			user := protected.Group("/users")
-			{
-				user.GET("/me", h.Users.GetMe)
-				user.PATCH("/me", h.Users.UpdateMe)
-				user.GET("/me/notifications", h.Users.ListNotifications)
-				user.POST("/me/notifications/:notificationId/read", h.Users.MarkNotificationRead)
-			}
+			user.GET("/me", h.Users.GetMe)
+			user.PATCH("/me", h.Users.UpdateMe)
+			user.POST("/me/delete", h.Users.DeleteMe)
+			user.GET("/me/activity", h.Users.ListActivity)
+			user.GET("/me/mentions", h.Users.ListMentions)
+			user.GET("/me/onboarding", h.Onboarding.Get)
+			user.PATCH("/me/onboarding", h.Onboarding.Update)
+			user.GET("/me/notifications", h.Users.ListNotifications)
+			user.GET("/me/notifications/unread-count", h.Users.UnreadNotificationCount)
+			user.POST("/me/notifications/read-all", h.Users.MarkAllNotificationsRead)
+			user.GET("/me/notifications/digest/preview", h.Users.PreviewDigest)
+			user.POST("/me/notifications/:notificationId/read", h.Users.MarkNotificationRead)
+			user.GET("/me/webhooks", h.Webhooks.List)
+			user.POST("/me/webhooks", h.Webhooks.Create)
+			user.DELETE("/me/webhooks/:webhookId", h.Webhooks.Delete)
+			user.POST("/me/webhooks/:webhookId/test", h.Webhooks.Test)
+			user.GET("/me/push/public-key", h.Push.PublicKey)
+			user.GET("/me/push/subscriptions", h.Push.ListSubscriptions)
+			user.POST("/me/push/subscriptions", h.Push.Subscribe)
+			user.DELETE("/me/push/subscriptions/:subscriptionId", h.Push.Unsubscribe)
 		}
+
+		// Accepting an invitation. The token is the credential: the invitee
+		// isn't a member of its org yet.
+		protected.POST("/invitations/accept", userOnly, h.Invitations.Accept)
+
+		// GraphQL reads of the project graph. With no route params to
+		// authorize, the resolvers check org access and IP allowlists for
+		// each object they return.
+		protected.POST("/graphql", userOnly, h.GraphQL.Query)
+		protected.GET("/graphql/schema", userOnly, h.GraphQL.Schema)
 	}
 
-	return r
+	// Platform admin (cross-org support and ops). Gated by the platform admin
+	// flag rather than org roles, and exempt from org IP allowlists.
+	admin := api.Group("/admin")
+	admin.Use(middleware.Auth(cfg))
+	admin.Use(middleware.ActiveAccount(svc.Authz))
+	admin.Use(middleware.RateLimit(cfg))
+	admin.Use(middleware.Audit(svc.Audit))
+	admin.Use(middleware.RequirePlatformAdmin(svc.Authz))
+	{
+		admin.GET("/orgs", h.Admin.ListOrgs)
+		admin.GET("/users", h.Admin.LookupUsers)
+		admin.GET("/users/:userId", h.Admin.GetUser)
+		admin.POST("/users/:userId/deactivate", h.Admin.DeactivateUser)
+		admin.POST("/users/:userId/reactivate", h.Admin.ReactivateUser)
+		admin.POST("/users/:userId/messages", h.Admin.SendUserMessage)
+		admin.GET("/executions", h.Admin.ListExecutions)
+		admin.GET("/executions/:executionId", h.Admin.GetExecution)
+		admin.POST("/templates", h.Templates.Create)
+		admin.PATCH("/templates/:templateId", h.Templates.Update)
+		admin.DELETE("/templates/:templateId", h.Templates.Delete)
+		admin.PUT("/templates/:templateId/featured", h.Templates.SetFeatured)
+		admin.GET("/feature-flags", h.Admin.ListFeatureFlags)
+		admin.PUT("/feature-flags/:flagKey", h.Admin.SetFeatureFlag)
+		admin.GET("/websocket", h.Admin.WebSocketStats)
+		admin.GET("/migrations", h.Admin.MigrationStatus)
+		admin.GET("/maintenance", h.Admin.MaintenanceStatus)
+		admin.PUT("/maintenance", h.Admin.EnableMaintenance)
+		admin.DELETE("/maintenance", h.Admin.DisableMaintenance)
+		admin.GET("/queues/:queue/dead-letters", h.Queues.ListDeadLetters)
+		admin.GET("/queues/:queue/dead-letters/:messageId", h.Queues.GetDeadLetter)
+		admin.POST("/queues/:queue/dead-letters/redrive", h.Queues.RedriveDeadLetters)
+		admin.POST("/queues/:queue/dead-letters/discard", h.Queues.DiscardDeadLetters)
+		admin.GET("/queues/:queue/quarantine", h.Queues.ListQuarantine)
+		admin.GET("/queues/:queue/quarantine/:jobId", h.Queues.GetQuarantinedJob)
+		admin.POST("/queues/:queue/quarantine/:jobId/release", h.Queues.ReleaseQuarantinedJob)
+		admin.DELETE("/queues/:queue/quarantine/:jobId", h.Queues.DiscardQuarantinedJob)
+	}
 }
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = `Usage: api migrate <command>
+
+Commands:
+  up          Apply all pending migrations
+  down [n]    Revert the last n migrations (default 1)
+  force <v>   Record v as the current version without running migrations
+  status      Print the current version and pending migrations
+`
+
+// runMigrate runs `api migrate` with the API's database settings and
+// returns the exit code. It needs only DATABASE_URL (or the DB_* settings).
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if os.Getenv("GO_ENV") != "production" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found")
+		}
+	}
+
+	logger, err := initLogger()
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	cfg, err := config.LoadWorker()
+	if err != nil {
+		logger.Error("Failed to load configuration", zap.Error(err))
+		return 1
+	}
+
+	db, err := database.NewConnection(cfg.DatabaseURL, database.PoolOptionsFrom(cfg))
+	if err != nil {
+		logger.Error("Failed to connect to database", zap.Error(err))
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db, logger)
+	if err != nil {
+		logger.Error("Failed to load migrations", zap.Error(err))
+		return 1
+	}
+
+	// Migrations run in transactions, so interrupting one rolls it back
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "Invalid number of migrations: %s\n", args[1])
+				return 2
+			}
+		}
+		err = migrator.Down(ctx, steps)
+	case "force":
+		if len(args) < 2 {
+			fmt.Fprint(os.Stderr, migrateUsage)
+			return 2
+		}
+		version, parseErr := strconv.ParseUint(args[1], 10, 32)
+		if parseErr != nil {
+			fmt.Fprintf(os.Stderr, "Invalid version: %s\n", args[1])
+			return 2
+		}
+		err = migrator.Force(ctx, uint(version))
+	case "status":
+		var status *database.MigrationStatus
+		if status, err = migrator.Status(ctx); err == nil {
+			out, _ := json.MarshalIndent(status, "", "  ")
+			fmt.Println(string(out))
+		}
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	if err != nil {
+		logger.Error("Migration command failed", zap.String("command", args[0]), zap.Error(err))
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/handlers"
+	"github.com/glassbox/api/internal/services"
+)
+
+const openapiUsage = `Usage: api openapi [-o file] [-check]
+
+Writes the API's OpenAPI document, to stdout or to file. Fails when the
+routes documented in handlers.APIRoutes differ from those registered.
+
+  -o file   Write the document to file instead of stdout
+  -check    Fail when file is not up to date instead of writing it
+`
+
+// runOpenAPI runs `api openapi` and returns the exit code. It needs no
+// configuration or dependencies.
+func runOpenAPI(args []string) int {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	out := fs.String("o", "", "")
+	check := fs.Bool("check", false, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() > 0 || (*check && *out == "") {
+		fmt.Fprint(os.Stderr, openapiUsage)
+		return 2
+	}
+
+	if problems := undocumentedRoutes(); len(problems) > 0 {
+		fmt.Fprintln(os.Stderr, "handlers.APIRoutes is out of sync with registerAPIRoutes:")
+		for _, p := range problems {
+			fmt.Fprintln(os.Stderr, "  "+p)
+		}
+		return 1
+	}
+
+	spec, err := json.MarshalIndent(handlers.OpenAPIDocument(), "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build OpenAPI document: %v\n", err)
+		return 1
+	}
+	spec = append(spec, '\n')
+
+	switch {
+	case *out == "":
+		os.Stdout.Write(spec)
+	case *check:
+		current, err := os.ReadFile(*out)
+		if err != nil || !bytes.Equal(current, spec) {
+			fmt.Fprintf(os.Stderr, "%s is out of date; run `make openapi`\n", *out)
+			return 1
+		}
+	default:
+		if err := os.WriteFile(*out, spec, 0o644); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write %s: %v\n", *out, err)
+			return 1
+		}
+	}
+	return 0
+}
+
+// undocumentedRoutes registers the API as the server does, with
+// development-only routes included, and lists the routes that are missing
+// from handlers.APIRoutes or documented but not served
+func undocumentedRoutes() []string {
+	gin.SetMode(gin.ReleaseMode)
+	r := gin.New()
+	cfg := &config.Config{Environment: "development"}
+	registerAPIRoutes(r.Group(handlers.OpenAPIServer), cfg, &handlers.Handlers{}, &services.Services{})
+
+	served := map[string]bool{}
+	for _, route := range r.Routes() {
+		served[route.Method+" "+strings.TrimPrefix(route.Path, handlers.OpenAPIServer)] = true
+	}
+	documented := map[string]bool{}
+	var problems []string
+	for _, route := range handlers.APIRoutes {
+		key := route.Method + " " + route.Path
+		switch {
+		case documented[key]:
+			problems = append(problems, "documented twice: "+key)
+		case !served[key]:
+			problems = append(problems, "documented but not served: "+key)
+		}
+		documented[key] = true
+	}
+	for _, route := range r.Routes() {
+		key := route.Method + " " + strings.TrimPrefix(route.Path, handlers.OpenAPIServer)
+		if !documented[key] {
+			problems = append(problems, "not documented: "+key)
+		}
+	}
+	return problems
+}
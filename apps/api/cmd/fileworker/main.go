@@ -0,0 +1,196 @@
+// Command fileworker consumes the file processing queue: it extracts the
+// text of plain text, JSON, XML and Word uploads, embeds it with OpenAI when
+// OPENAI_API_KEY is set, and reports status through the internal API. PDFs
+// and images complete without text; deployments that need them run the
+// Python file processor instead.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/embeddings"
+	"github.com/glassbox/api/internal/fileprocessor"
+	"github.com/glassbox/api/internal/internalapi"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/queue"
+	"github.com/glassbox/api/internal/storage"
+
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+// Jobs stay hidden this long while a worker processes them, matching the
+// Python worker
+const visibilityTimeout = 5 * time.Minute
+
+func main() {
+	// Load .env file in development
+	if os.Getenv("GO_ENV") != "production" {
+		if err := godotenv.Load(); err != nil {
+			log.Println("No .env file found")
+		}
+	}
+
+	logger, err := initLogger()
+	if err != nil {
+		log.Fatalf("Failed to initialize logger: %v", err)
+	}
+	defer logger.Sync()
+
+	cfg, err := config.LoadWorker()
+	if err != nil {
+		logger.Fatal("Failed to load configuration", zap.Error(err))
+	}
+	if cfg.QueueBackend == queue.BackendMemory {
+		logger.Fatal("QUEUE_BACKEND=memory only works in the API process; use IN_PROCESS_WORKERS instead")
+	}
+
+	// Migrations are the API's job
+	db, err := database.NewConnection(cfg.DatabaseURL, database.PoolOptionsFrom(cfg))
+	if err != nil {
+		logger.Fatal("Failed to connect to database", zap.Error(err))
+	}
+	defer db.Close()
+
+	var redis *database.Redis
+	if cfg.QueueBackend == queue.BackendRedis {
+		redis, err = database.NewRedisClient(cfg.RedisURL)
+		if err != nil {
+			logger.Fatal("Failed to connect to Redis", zap.Error(err))
+		}
+		defer redis.Close()
+	}
+
+	s3Client, err := storage.NewS3Client(cfg, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize S3 client", zap.Error(err))
+	}
+
+	jobQueue, err := queue.New(cfg, redis, logger)
+	if err != nil {
+		logger.Fatal("Failed to initialize job queue", zap.Error(err))
+	}
+
+	var embedder fileprocessor.Embedder
+	if cfg.OpenAIAPIKey != "" {
+		embedder = embeddings.NewOpenAI(cfg.OpenAIAPIKey, cfg.EmbeddingModel)
+	} else {
+		logger.Warn("OPENAI_API_KEY is not set; files won't get embeddings")
+	}
+
+	api := internalapi.New(cfg)
+	if !api.Enabled() {
+		logger.Warn("Neither INTERNAL_HMAC_SECRET nor INTERNAL_SERVICE_TOKEN is set; clients won't see live file status")
+	}
+
+	processor := fileprocessor.New(db, s3Client, embedder, apiNotifier{api: api, logger: logger}, logger)
+	quarantine := queue.NewQuarantine(db, nil, logger)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("Starting file worker",
+		zap.String("queueBackend", cfg.QueueBackend),
+		zap.Int("concurrency", cfg.FileWorkerConcurrency),
+	)
+	var wg sync.WaitGroup
+	for range max(cfg.FileWorkerConcurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			consume(ctx, jobQueue, processor, quarantine, logger)
+		}()
+	}
+	wg.Wait()
+	logger.Info("File worker stopped")
+}
+
+// consume processes one job at a time until ctx is cancelled. Jobs are
+// acknowledged only when processed, so failures are retried after the
+// visibility timeout and dead-lettered after queue.MaxReceives attempts.
+// Jobs that can't be decoded are quarantined instead.
+func consume(ctx context.Context, q queue.Queue, processor *fileprocessor.Processor, quarantine *queue.Quarantine, logger *zap.Logger) {
+	for ctx.Err() == nil {
+		deliveries, err := q.Receive(ctx, queue.FileJobs, queue.ReceiveOptions{
+			Max:               1,
+			Wait:              20 * time.Second,
+			VisibilityTimeout: visibilityTimeout,
+		})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("Failed to receive jobs", zap.Error(err))
+			time.Sleep(5 * time.Second)
+			continue
+		}
+
+		for _, d := range deliveries {
+			job, unknown, err := queue.DecodeFileProcessingJob(d.Body)
+			if len(unknown) > 0 {
+				logger.Warn("Job has unknown fields", zap.Strings("fields", unknown))
+			}
+			switch {
+			case errors.Is(err, queue.ErrUnsupportedSchemaVersion):
+				logger.Warn("Leaving job for a newer worker", zap.Error(err))
+				continue
+			case err != nil:
+				// Retrying can't fix a malformed job. If it can't be
+				// quarantined either, it's retried and dead-lettered.
+				if qErr := quarantine.Add(context.WithoutCancel(ctx), queue.FileJobs, d, queue.QuarantineSourceConsumer, err); qErr != nil {
+					logger.Error("Failed to quarantine invalid job", zap.String("messageId", d.ID), zap.Error(qErr))
+					continue
+				}
+			default:
+				// Finish the job even during shutdown; an unfinished one is
+				// retried anyway
+				if err := processor.Process(context.WithoutCancel(ctx), job.FileID); err != nil {
+					logger.Error("File job failed",
+						zap.String("fileId", job.FileID.String()),
+						zap.Int("receiveCount", d.ReceiveCount),
+						zap.Error(err),
+					)
+					continue
+				}
+			}
+			if err := q.Ack(context.WithoutCancel(ctx), queue.FileJobs, d); err != nil {
+				logger.Warn("Failed to acknowledge job", zap.Error(err))
+			}
+		}
+	}
+}
+
+// apiNotifier reports file status through the internal API, which relays it
+// to the org's WebSocket clients
+type apiNotifier struct {
+	api    *internalapi.Client
+	logger *zap.Logger
+}
+
+func (n apiNotifier) NotifyFile(ctx context.Context, file *models.File, status, errMsg string) {
+	err := n.api.PostFileEvent(ctx, file.ID, internalapi.FileEvent{
+		OrgID:    file.OrgID,
+		Filename: file.Filename,
+		Status:   status,
+		Error:    errMsg,
+	})
+	if err != nil {
+		n.logger.Warn("Failed to notify API of file event", zap.String("fileId", file.ID.String()), zap.Error(err))
+	}
+}
+
+func initLogger() (*zap.Logger, error) {
+	if os.Getenv("GO_ENV") == "production" {
+		return zap.NewProduction()
+	}
+	return zap.NewDevelopment()
+}
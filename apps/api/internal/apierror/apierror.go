@@ -0,0 +1,108 @@
+// Package apierror defines the JSON body every endpoint returns on failure:
+//
+//	{"code": "not_found", "message": "Node not found", "details": {...}, "requestId": "..."}
+//
+// code is stable and machine-readable so clients can branch on it; message is
+// for humans and may change. details is optional and code-specific.
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code is a machine-readable error code
+type Code string
+
+const (
+	// Generic codes, one per status
+	CodeBadRequest   Code = "bad_request"
+	CodeUnauthorized Code = "unauthorized"
+	CodeForbidden    Code = "forbidden"
+	CodeNotFound     Code = "not_found"
+	CodeConflict     Code = "conflict"
+	CodeRateLimited  Code = "rate_limited"
+	CodeInternal     Code = "internal_error"
+	CodeUnavailable  Code = "service_unavailable"
+
+	// Specific codes
+	CodeValidationFailed    Code = "validation_failed"     // details.fields lists each invalid field
+	CodeInvalidToken        Code = "invalid_token"         // token expired or malformed; re-authenticate
+	CodeInvalidSignature    Code = "invalid_signature"     // signed internal request is malformed, stale or replayed
+	CodeTooManyAttempts     Code = "too_many_attempts"     // auth attempts locked out; details.retryAfter seconds
+	CodeAlreadyExists       Code = "already_exists"        // unique resource already present
+	CodeResourceLocked      Code = "resource_locked"       // node is locked by another user
+	CodeExecutionInProgress Code = "execution_in_progress" // node already has an active execution
+	CodeInvalidState        Code = "invalid_state"         // operation not allowed in the resource's current state
+	CodeIPNotAllowed        Code = "ip_not_allowed"        // blocked by the org's IP allowlist
+	CodeAllowlistLockout    Code = "allowlist_lockout"     // change would block the caller's own IP
+	CodeOriginNotAllowed    Code = "origin_not_allowed"    // WebSocket Origin not permitted
+	CodeMaintenance         Code = "maintenance"           // API is read-only; retry later
+	CodeNotConfigured       Code = "not_configured"        // feature needs server configuration
+	CodeVersionConflict     Code = "version_conflict"      // resource changed since the If-Match ETag; re-read and retry
+	CodeAccountDisabled     Code = "account_disabled"      // user is deactivated or deleted
+	CodeSoleOwner           Code = "sole_owner"            // change would leave an org without an owner; on account deletion details.orgs lists them
+)
+
+// Error is the error response body
+type Error struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	Details   gin.H  `json:"details,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+// Respond writes an error response
+func Respond(c *gin.Context, status int, code Code, message string) {
+	c.JSON(status, newError(c, code, message, nil))
+}
+
+// RespondWithDetails writes an error response with code-specific details
+func RespondWithDetails(c *gin.Context, status int, code Code, message string, details gin.H) {
+	c.JSON(status, newError(c, code, message, details))
+}
+
+// Abort writes an error response and stops the handler chain (for middleware)
+func Abort(c *gin.Context, status int, code Code, message string) {
+	c.AbortWithStatusJSON(status, newError(c, code, message, nil))
+}
+
+// AbortWithDetails is Abort with code-specific details
+func AbortWithDetails(c *gin.Context, status int, code Code, message string, details gin.H) {
+	c.AbortWithStatusJSON(status, newError(c, code, message, details))
+}
+
+// CodeForStatus returns the generic code for an HTTP status
+func CodeForStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound, http.StatusMethodNotAllowed:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		if status >= 500 {
+			return CodeInternal
+		}
+		return CodeBadRequest
+	}
+}
+
+func newError(c *gin.Context, code Code, message string, details gin.H) Error {
+	return Error{
+		Code:      code,
+		Message:   message,
+		Details:   details,
+		RequestID: c.GetString("request_id"), // set by middleware.RequestID
+	}
+}
@@ -0,0 +1,293 @@
+// Package authz is the single place that decides what a user may do.
+//
+// Permissions are granted by the user's role in the org that owns a resource.
+// Handlers never compare role strings themselves; routes declare the action
+// they perform and the Authorize middleware asks Can().
+package authz
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/cache"
+	"github.com/glassbox/api/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNotFound means the resource does not exist or the user is not a member
+	// of its org. The two are deliberately indistinguishable to callers.
+	ErrNotFound = errors.New("resource not found")
+
+	// ErrForbidden means the user is a member but their role lacks the permission
+	ErrForbidden = errors.New("permission denied")
+)
+
+const (
+	// Roles and platform admin flags are dropped from the cache as soon as
+	// they change; the TTL only covers a missed notification
+	roleCacheTTL        = 5 * time.Minute
+	resourceCachePrefix = "authz:resource_org:"
+	resourceCacheTTL    = 1 * time.Hour
+
+	// Soft-deleted nodes must stop resolving, so they aren't cached for long
+	nodeResourceCacheTTL = 60 * time.Second
+)
+
+// Authorizer answers permission questions. Org roles, platform admin flags
+// and account states are cached in memory and invalidated by
+// database.Listener; resource→org lookups are cached in Redis.
+type Authorizer struct {
+	db     *database.DB
+	redis  *database.Redis
+	logger *zap.Logger
+
+	// Roles by org and user; "" for non-members, so repeated probes don't
+	// hit Postgres
+	roles          *cache.Local[membership, Role]
+	platformAdmins *cache.Local[uuid.UUID, bool]
+	accounts       *cache.Local[uuid.UUID, Account]
+}
+
+type membership struct {
+	orgID, userID uuid.UUID
+}
+
+// New creates an Authorizer and subscribes its caches to listener
+func New(db *database.DB, redis *database.Redis, listener *database.Listener, logger *zap.Logger) *Authorizer {
+	a := &Authorizer{
+		db:             db,
+		redis:          redis,
+		logger:         logger,
+		roles:          cache.NewLocal[membership, Role](roleCacheTTL, listener.Connected),
+		platformAdmins: cache.NewLocal[uuid.UUID, bool](roleCacheTTL, listener.Connected),
+		accounts:       cache.NewLocal[uuid.UUID, Account](roleCacheTTL, listener.Connected),
+	}
+	listener.Subscribe(a)
+	return a
+}
+
+// Decision is the outcome of an authorization check, including the context
+// that was resolved along the way
+type Decision struct {
+	OrgID   uuid.UUID
+	Role    Role
+	Allowed bool
+}
+
+// Can reports whether the user may perform action on resource.
+// Returns ErrNotFound when the resource does not exist or the user is not a
+// member of its org.
+func (a *Authorizer) Can(ctx context.Context, userID uuid.UUID, action Action, res Resource) (bool, error) {
+	decision, err := a.Check(ctx, userID, action, res)
+	if err != nil {
+		return false, err
+	}
+	return decision.Allowed, nil
+}
+
+// Authorize is Can that returns ErrForbidden instead of false
+func (a *Authorizer) Authorize(ctx context.Context, userID uuid.UUID, action Action, res Resource) (*Decision, error) {
+	decision, err := a.Check(ctx, userID, action, res)
+	if err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		return decision, ErrForbidden
+	}
+	return decision, nil
+}
+
+// Check resolves the resource's org and the user's role in it and evaluates action
+func (a *Authorizer) Check(ctx context.Context, userID uuid.UUID, action Action, res Resource) (*Decision, error) {
+	orgID, err := a.OrgFor(ctx, res)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := a.RoleIn(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decision{OrgID: orgID, Role: role, Allowed: role.Can(action)}, nil
+}
+
+// Grant is the set of actions a user holds on a resource
+type Grant struct {
+	OrgID   uuid.UUID
+	Role    Role
+	Actions []Action
+}
+
+// Permissions returns every action the user may perform on resource.
+// Returns ErrNotFound when the resource does not exist or the user is not a
+// member of its org.
+func (a *Authorizer) Permissions(ctx context.Context, userID uuid.UUID, res Resource) (*Grant, error) {
+	orgID, err := a.OrgFor(ctx, res)
+	if err != nil {
+		return nil, err
+	}
+
+	role, err := a.RoleIn(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Grant{OrgID: orgID, Role: role, Actions: role.PermissionsOn(res.Type)}, nil
+}
+
+// RoleIn returns the user's role in an org, or ErrNotFound if they are not a
+// member. Deactivated and deleted users are members of nothing.
+func (a *Authorizer) RoleIn(ctx context.Context, orgID, userID uuid.UUID) (Role, error) {
+	account, err := a.Account(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	if !account.Active {
+		return "", ErrNotFound
+	}
+
+	role, err := a.roles.Load(membership{orgID, userID}, func() (Role, error) {
+		var role string
+		err := a.db.Pool.QueryRow(ctx, `
+			SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2
+		`, orgID, userID).Scan(&role)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", nil
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get role: %w", err)
+		}
+		return Role(role), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if role == "" {
+		return "", ErrNotFound
+	}
+	return role, nil
+}
+
+// InvalidateRole drops the cached role after membership changes. Other
+// instances drop theirs when notified of the change.
+func (a *Authorizer) InvalidateRole(orgID, userID uuid.UUID) {
+	a.roles.Delete(membership{orgID, userID})
+}
+
+// IsPlatformAdmin reports whether the user administers the platform itself.
+// This is a separate path from org roles: it gates the /admin routes and
+// grants nothing inside orgs.
+func (a *Authorizer) IsPlatformAdmin(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return a.platformAdmins.Load(userID, func() (bool, error) {
+		var isAdmin bool
+		err := a.db.Pool.QueryRow(ctx, `
+			SELECT is_platform_admin FROM users WHERE id = $1
+		`, userID).Scan(&isAdmin)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return false, fmt.Errorf("failed to check platform admin: %w", err)
+		}
+		return isAdmin, nil
+	})
+}
+
+// Account is the state of a user's account that decides whether their
+// tokens are accepted
+type Account struct {
+	// False once the user is deactivated or deleted
+	Active bool
+	// Tokens issued before this are rejected; zero if none were revoked
+	TokensRevokedAt time.Time
+}
+
+// Account returns the user's account state. Users without a row yet (they
+// are created on first sign-in) are active.
+func (a *Authorizer) Account(ctx context.Context, userID uuid.UUID) (Account, error) {
+	return a.accounts.Load(userID, func() (Account, error) {
+		var inactive bool
+		var revokedAt *time.Time
+		err := a.db.Pool.QueryRow(ctx, `
+			SELECT deactivated_at IS NOT NULL OR deleted_at IS NOT NULL, tokens_revoked_at
+			FROM users WHERE id = $1
+		`, userID).Scan(&inactive, &revokedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Account{Active: true}, nil
+		}
+		if err != nil {
+			return Account{}, fmt.Errorf("failed to get account: %w", err)
+		}
+		account := Account{Active: !inactive}
+		if revokedAt != nil {
+			account.TokensRevokedAt = *revokedAt
+		}
+		return account, nil
+	})
+}
+
+// InvalidateAccount drops the cached account state after it changes. Other
+// instances drop theirs when notified of the change.
+func (a *Authorizer) InvalidateAccount(userID uuid.UUID) {
+	a.accounts.Delete(userID)
+	a.platformAdmins.Delete(userID)
+}
+
+// Invalidate drops the cached role, platform admin flag or account state
+// read from a changed row
+func (a *Authorizer) Invalidate(change database.RowChange) {
+	switch change.Table {
+	case "org_members":
+		a.roles.Delete(membership{change.OrgID, change.UserID})
+	case "users":
+		a.platformAdmins.Delete(change.UserID)
+		a.accounts.Delete(change.UserID)
+	}
+}
+
+// InvalidateAll drops every cached role, platform admin flag and account
+// state
+func (a *Authorizer) InvalidateAll() {
+	a.roles.Clear()
+	a.platformAdmins.Clear()
+	a.accounts.Clear()
+}
+
+// OrgFor returns the org that owns a resource. Resources never move between
+// orgs, so lookups are cached.
+func (a *Authorizer) OrgFor(ctx context.Context, res Resource) (uuid.UUID, error) {
+	if res.Type == ResourceOrg {
+		return res.ID, nil
+	}
+
+	query, ok := orgQueries[res.Type]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("unknown resource type %q", res.Type)
+	}
+
+	key := resourceCachePrefix + string(res.Type) + ":" + res.ID.String()
+	if cached, err := a.redis.Client.Get(ctx, key).Result(); err == nil {
+		if orgID, err := uuid.Parse(cached); err == nil {
+			return orgID, nil
+		}
+	}
+
+	var orgID uuid.UUID
+	err := a.db.Pool.QueryRow(ctx, query, res.ID).Scan(&orgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to resolve org for %s: %w", res.Type, err)
+	}
+
+	ttl := resourceCacheTTL
+	if res.Type == ResourceNode {
+		ttl = nodeResourceCacheTTL
+	}
+	a.redis.Client.Set(ctx, key, orgID.String(), ttl)
+	return orgID, nil
+}
@@ -0,0 +1,192 @@
+package authz
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Action is something a user can do to a resource
+type Action string
+
+const (
+	OrgRead    Action = "org:read"
+	OrgUpdate  Action = "org:update"
+	OrgDelete  Action = "org:delete"
+	OrgAdmin   Action = "org:admin" // audit log, IP allowlist and other org-wide settings
+	OrgMembers Action = "org:manage_members"
+
+	ProjectRead   Action = "project:read"
+	ProjectCreate Action = "project:create"
+	ProjectUpdate Action = "project:update"
+	ProjectDelete Action = "project:delete"
+
+	NodeRead   Action = "node:read"
+	NodeCreate Action = "node:create"
+	NodeUpdate Action = "node:update"
+	NodeDelete Action = "node:delete"
+	NodeLock   Action = "node:lock"
+
+	ExecutionRead    Action = "execution:read"
+	ExecutionStart   Action = "execution:start"
+	ExecutionControl Action = "execution:control" // pause, resume, cancel, provide input
+
+	FileRead   Action = "file:read"
+	FileUpload Action = "file:upload"
+	FileDelete Action = "file:delete"
+
+	TemplateRead    Action = "template:read"
+	TemplateWrite   Action = "template:write" // create and update the org's templates
+	TemplateDelete  Action = "template:delete"
+	TemplatePublish Action = "template:publish" // add an org template to the public catalog
+
+	Search Action = "search"
+)
+
+// Role is a user's role within an org (org_members.role)
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleMember Role = "member"
+	RoleGuest  Role = "guest"
+)
+
+var guestActions = []Action{
+	OrgRead, ProjectRead, NodeRead, ExecutionRead, FileRead, TemplateRead, Search,
+}
+
+var memberActions = append([]Action{
+	ProjectCreate, ProjectUpdate,
+	NodeCreate, NodeUpdate, NodeDelete, NodeLock,
+	ExecutionStart, ExecutionControl,
+	FileUpload, FileDelete,
+	TemplateWrite,
+}, guestActions...)
+
+var adminActions = append([]Action{
+	OrgUpdate, OrgAdmin, OrgMembers,
+	ProjectDelete,
+	TemplateDelete, TemplatePublish,
+}, memberActions...)
+
+var ownerActions = append([]Action{
+	OrgDelete,
+}, adminActions...)
+
+// rolePermissions is the single source of truth for what each role may do
+var rolePermissions = map[Role]map[Action]bool{
+	RoleOwner:  actionSet(ownerActions),
+	RoleAdmin:  actionSet(adminActions),
+	RoleMember: actionSet(memberActions),
+	RoleGuest:  actionSet(guestActions),
+}
+
+// Can reports whether the role grants action
+func (r Role) Can(action Action) bool {
+	return rolePermissions[r][action]
+}
+
+// Permissions returns every action the role grants, sorted
+func (r Role) Permissions() []Action {
+	actions := make([]Action, 0, len(rolePermissions[r]))
+	for action := range rolePermissions[r] {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+	return actions
+}
+
+// PermissionsOn returns the actions the role grants that apply to a resource
+// of type t or anything nested under it, sorted
+func (r Role) PermissionsOn(t ResourceType) []Action {
+	prefixes, ok := resourceScopes[t]
+	if !ok {
+		return r.Permissions()
+	}
+	actions := []Action{}
+	for _, action := range r.Permissions() {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(string(action), prefix) {
+				actions = append(actions, action)
+				break
+			}
+		}
+	}
+	return actions
+}
+
+func actionSet(actions []Action) map[Action]bool {
+	set := make(map[Action]bool, len(actions))
+	for _, a := range actions {
+		set[a] = true
+	}
+	return set
+}
+
+// ResourceType identifies the kind of resource being accessed
+type ResourceType string
+
+const (
+	ResourceOrg       ResourceType = "org"
+	ResourceProject   ResourceType = "project"
+	ResourceNode      ResourceType = "node"
+	ResourceFile      ResourceType = "file"
+	ResourceExecution ResourceType = "execution"
+)
+
+// orgQueries look up the owning org of each non-org resource type.
+// Executions have no org_id of their own and resolve through their node.
+var orgQueries = map[ResourceType]string{
+	ResourceProject:   `SELECT org_id FROM projects WHERE id = $1`,
+	ResourceNode:      `SELECT org_id FROM nodes WHERE id = $1 AND deleted_at IS NULL`,
+	ResourceFile:      `SELECT org_id FROM files WHERE id = $1`,
+	ResourceExecution: `SELECT n.org_id FROM agent_executions e JOIN nodes n ON n.id = e.node_id WHERE e.id = $1`,
+}
+
+// resourceScopes lists the action prefixes that apply to each resource type.
+// Org permissions are unscoped: everything applies at the org level.
+var resourceScopes = map[ResourceType][]string{
+	ResourceProject:   {"project:", "node:", "execution:", "file:", "search"},
+	ResourceNode:      {"node:", "execution:"},
+	ResourceFile:      {"file:"},
+	ResourceExecution: {"execution:"},
+}
+
+// Resource identifies a specific resource
+type Resource struct {
+	Type ResourceType
+	ID   uuid.UUID
+}
+
+// routeParams maps route params to resource types, most specific first
+var routeParams = []struct {
+	param string
+	typ   ResourceType
+}{
+	{"executionId", ResourceExecution},
+	{"fileId", ResourceFile},
+	{"nodeId", ResourceNode},
+	{"projectId", ResourceProject},
+	{"orgId", ResourceOrg},
+}
+
+// ResourceFromParams picks the most specific resource identified by route
+// params (e.g. {"nodeId": "..."}). ok is false when no param identifies a
+// resource; err is set when one does but is not a valid UUID.
+func ResourceFromParams(params map[string]string) (res Resource, ok bool, err error) {
+	for _, rp := range routeParams {
+		raw, present := params[rp.param]
+		if !present {
+			continue
+		}
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			return Resource{}, true, err
+		}
+		return Resource{Type: rp.typ, ID: id}, true, nil
+	}
+	return Resource{}, false, nil
+}
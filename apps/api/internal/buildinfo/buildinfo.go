@@ -0,0 +1,54 @@
+// Package buildinfo describes the running build. Release builds set the
+// variables below with -ldflags "-X"; otherwise the commit and time come from
+// the VCS stamp Go embeds when building from a checkout.
+package buildinfo
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// Set at build time, e.g.
+//
+//	go build -ldflags "-X github.com/glassbox/api/internal/buildinfo.Version=1.4.0 \
+//	  -X github.com/glassbox/api/internal/buildinfo.Commit=$(git rev-parse HEAD)"
+var (
+	Version   = "dev"
+	Commit    = ""
+	BuildTime = "" // RFC 3339
+)
+
+// Info is the running build
+type Info struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	BuildTime string `json:"buildTime,omitempty"`
+	// Modified is set when the build had uncommitted changes
+	Modified  bool   `json:"modified,omitempty"`
+	GoVersion string `json:"goVersion"`
+}
+
+var get = sync.OnceValue(func() Info {
+	info := Info{Version: Version, Commit: Commit, BuildTime: BuildTime, GoVersion: runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok && info.Commit == "" {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				info.Commit = s.Value
+			case "vcs.time":
+				if info.BuildTime == "" {
+					info.BuildTime = s.Value
+				}
+			case "vcs.modified":
+				info.Modified = s.Value == "true"
+			}
+		}
+	}
+	return info
+})
+
+// Get returns the running build's info
+func Get() Info {
+	return get()
+}
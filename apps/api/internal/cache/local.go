@@ -0,0 +1,110 @@
+// Package cache holds per-instance caches of rows that change rarely but
+// are read on every request, such as org roles. Entries are dropped when
+// Postgres reports the rows changed (see database.Listener), so instances
+// don't serve stale values; the TTL only bounds how long a missed
+// notification can go unnoticed.
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// Most entries a cache holds. When it's full, expired entries are swept,
+// and if that isn't enough the cache is emptied.
+const maxEntries = 50000
+
+// Local is a TTL cache in this process's memory. While live returns false
+// (the notifications that keep it fresh aren't being received) it stores
+// nothing, so every read goes to the database.
+type Local[K comparable, V any] struct {
+	ttl  time.Duration
+	live func() bool
+
+	mu      sync.Mutex
+	entries map[K]entry[V]
+	// Incremented by every invalidation, so a value read before one isn't
+	// cached after it
+	generation uint64
+}
+
+type entry[V any] struct {
+	value   V
+	expires time.Time
+}
+
+// NewLocal creates a cache whose entries live for ttl
+func NewLocal[K comparable, V any](ttl time.Duration, live func() bool) *Local[K, V] {
+	return &Local[K, V]{ttl: ttl, live: live, entries: make(map[K]entry[V])}
+}
+
+// Load returns the cached value for key, or calls load and caches what it
+// returns. Errors aren't cached, and neither is a value the cache was
+// invalidated while loading, since it may predate the change.
+func (c *Local[K, V]) Load(key K, load func() (V, error)) (V, error) {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	generation := c.generation
+	c.mu.Unlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.value, nil
+	}
+
+	value, err := load()
+	if err != nil || !c.live() {
+		return value, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation {
+		return value, nil
+	}
+	if len(c.entries) >= maxEntries {
+		c.sweep()
+	}
+	c.entries[key] = entry[V]{value: value, expires: time.Now().Add(c.ttl)}
+	return value, nil
+}
+
+// Delete drops a cached value
+func (c *Local[K, V]) Delete(key K) {
+	c.mu.Lock()
+	delete(c.entries, key)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// DeleteFunc drops the cached values whose keys match
+func (c *Local[K, V]) DeleteFunc(match func(K) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.entries {
+		if match(key) {
+			delete(c.entries, key)
+		}
+	}
+	c.generation++
+}
+
+// Clear drops every cached value
+func (c *Local[K, V]) Clear() {
+	c.mu.Lock()
+	clear(c.entries)
+	c.generation++
+	c.mu.Unlock()
+}
+
+// sweep drops expired entries, or all of them if that isn't enough. The
+// caller holds mu.
+func (c *Local[K, V]) sweep() {
+	now := time.Now()
+	for key, e := range c.entries {
+		if now.After(e.expires) {
+			delete(c.entries, key)
+		}
+	}
+	if len(c.entries) >= maxEntries {
+		clear(c.entries)
+	}
+}
@@ -0,0 +1,142 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT_ALGORITHM values
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+)
+
+// ErrJWTSigningKeyMissing means this instance can verify tokens but not issue them
+var ErrJWTSigningKeyMissing = errors.New("no JWT signing key configured")
+
+// JWTLeeway tolerates small clock differences between issuer and verifier
+const JWTLeeway = 30 * time.Second
+
+// loadJWT reads the JWT settings. RS256 keys are PEM, given inline or as a
+// file path (JWT_PRIVATE_KEY / JWT_PRIVATE_KEY_FILE, and likewise for the
+// public key). The public key is derived from the private key when only the
+// latter is set.
+func (c *Config) loadJWT() error {
+	c.JWTSecret = getEnv("JWT_SECRET", "dev-secret-change-in-production")
+	c.JWTAlgorithm = getEnv("JWT_ALGORITHM", JWTAlgorithmHS256)
+	c.JWTIssuer = getEnv("JWT_ISSUER", "glassbox-dev")
+	c.JWTAudience = getEnv("JWT_AUDIENCE", "glassbox-api")
+	c.JWTTokenLifetime = time.Duration(getEnvInt("JWT_TOKEN_LIFETIME_MINUTES", 24*60)) * time.Minute
+	c.JWTAcceptHS256 = getEnv("JWT_ACCEPT_HS256", "false") == "true"
+
+	privatePEM, err := getEnvPEM("JWT_PRIVATE_KEY")
+	if err != nil {
+		return err
+	}
+	if privatePEM != nil {
+		if c.JWTPrivateKey, err = jwt.ParseRSAPrivateKeyFromPEM(privatePEM); err != nil {
+			return fmt.Errorf("invalid JWT_PRIVATE_KEY: %w", err)
+		}
+		c.JWTPublicKey = &c.JWTPrivateKey.PublicKey
+	}
+
+	publicPEM, err := getEnvPEM("JWT_PUBLIC_KEY")
+	if err != nil {
+		return err
+	}
+	if publicPEM != nil {
+		if c.JWTPublicKey, err = jwt.ParseRSAPublicKeyFromPEM(publicPEM); err != nil {
+			return fmt.Errorf("invalid JWT_PUBLIC_KEY: %w", err)
+		}
+		if c.JWTPrivateKey != nil && !c.JWTPrivateKey.PublicKey.Equal(c.JWTPublicKey) {
+			return fmt.Errorf("JWT_PUBLIC_KEY does not match JWT_PRIVATE_KEY")
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) validateJWT() error {
+	if c.JWTIssuer == "" || c.JWTAudience == "" {
+		return fmt.Errorf("JWT_ISSUER and JWT_AUDIENCE are required")
+	}
+	if c.JWTTokenLifetime <= 0 {
+		return fmt.Errorf("JWT_TOKEN_LIFETIME_MINUTES must be positive")
+	}
+
+	switch c.JWTAlgorithm {
+	case JWTAlgorithmHS256:
+		if c.JWTSecret == "" {
+			return fmt.Errorf("JWT_SECRET is required for HS256")
+		}
+	case JWTAlgorithmRS256:
+		if c.JWTPublicKey == nil {
+			return fmt.Errorf("JWT_PUBLIC_KEY or JWT_PRIVATE_KEY is required for RS256")
+		}
+		if c.JWTAcceptHS256 && c.JWTSecret == "" {
+			return fmt.Errorf("JWT_SECRET is required when JWT_ACCEPT_HS256 is set")
+		}
+	default:
+		return fmt.Errorf("unsupported JWT_ALGORITHM %q (use HS256 or RS256)", c.JWTAlgorithm)
+	}
+	return nil
+}
+
+// JWTSigningKey returns the method and key for issuing tokens.
+// Returns ErrJWTSigningKeyMissing on RS256 instances that only hold the public key.
+func (c *Config) JWTSigningKey() (jwt.SigningMethod, any, error) {
+	if c.JWTAlgorithm == JWTAlgorithmRS256 {
+		if c.JWTPrivateKey == nil {
+			return nil, nil, ErrJWTSigningKeyMissing
+		}
+		return jwt.SigningMethodRS256, c.JWTPrivateKey, nil
+	}
+	return jwt.SigningMethodHS256, []byte(c.JWTSecret), nil
+}
+
+// JWTValidMethods lists the algorithms tokens may be signed with. While
+// migrating from HS256 to RS256, JWT_ACCEPT_HS256 keeps already-issued HS256
+// tokens valid until they expire.
+func (c *Config) JWTValidMethods() []string {
+	if c.JWTAlgorithm == JWTAlgorithmRS256 && c.JWTAcceptHS256 {
+		return []string{JWTAlgorithmRS256, JWTAlgorithmHS256}
+	}
+	return []string{c.JWTAlgorithm}
+}
+
+// JWTKeyFunc returns the verification key for a token's algorithm. Callers
+// must also restrict the parser to JWTValidMethods so an RS256 public key can
+// never be used as an HMAC secret.
+func (c *Config) JWTKeyFunc(token *jwt.Token) (any, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA:
+		if c.JWTPublicKey == nil {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return c.JWTPublicKey, nil
+	case *jwt.SigningMethodHMAC:
+		return []byte(c.JWTSecret), nil
+	default:
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+}
+
+// getEnvPEM reads PEM from key, or from the file named by key_FILE; nil when neither is set
+func getEnvPEM(key string) ([]byte, error) {
+	if value := os.Getenv(key); value != "" {
+		return []byte(value), nil
+	}
+	path := os.Getenv(key + "_FILE")
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s_FILE: %w", key, err)
+	}
+	return data, nil
+}
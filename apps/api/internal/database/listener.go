@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+// Channel the cache invalidation triggers notify (migration 017)
+const cacheInvalidationChannel = "cache_invalidation"
+
+const (
+	// How long the listener waits for a notification before checking its
+	// connection is still alive
+	listenerPingInterval = 30 * time.Second
+
+	// Backoff between attempts to reconnect the listener
+	listenerInitialBackoff = time.Second
+	listenerMaxBackoff     = 30 * time.Second
+)
+
+// RowChange says a row that instances cache was inserted, updated or
+// deleted. OrgID and UserID are uuid.Nil when the table has no such column.
+type RowChange struct {
+	Table  string    `json:"table"`
+	OrgID  uuid.UUID `json:"orgId"`
+	UserID uuid.UUID `json:"userId"`
+}
+
+// Invalidator is a cache kept fresh by a Listener
+type Invalidator interface {
+	// Invalidate drops whatever was read from the changed row
+	Invalidate(change RowChange)
+
+	// InvalidateAll drops everything, because changes may have been missed
+	InvalidateAll()
+}
+
+// Listener passes the row changes Postgres notifies on
+// cacheInvalidationChannel to the caches of this instance. It holds one
+// connection outside the pool. While it isn't connected, Connected is false
+// and caches should store nothing.
+type Listener struct {
+	db     *DB
+	logger *zap.Logger
+
+	connected atomic.Bool
+
+	mu           sync.Mutex
+	invalidators []Invalidator
+}
+
+// NewListener creates a listener; Run starts it
+func NewListener(db *DB, logger *zap.Logger) *Listener {
+	return &Listener{db: db, logger: logger}
+}
+
+// Subscribe passes changes to inv. Call it before Run.
+func (l *Listener) Subscribe(inv Invalidator) {
+	l.mu.Lock()
+	l.invalidators = append(l.invalidators, inv)
+	l.mu.Unlock()
+}
+
+// Connected reports whether changes are being received
+func (l *Listener) Connected() bool {
+	return l.connected.Load()
+}
+
+// Run listens until ctx is cancelled, reconnecting with backoff when the
+// connection is lost. Caches are cleared whenever it connects or
+// disconnects, since changes made in between weren't received.
+func (l *Listener) Run(ctx context.Context) {
+	backoff := listenerInitialBackoff
+	for {
+		err := l.listen(ctx)
+		if l.connected.Swap(false) {
+			l.invalidateAll()
+			backoff = listenerInitialBackoff
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		l.logger.Warn("Cache invalidation listener disconnected; caches disabled until it reconnects",
+			zap.Duration("retryIn", backoff), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, listenerMaxBackoff)
+	}
+}
+
+// listen receives notifications on a new connection until it fails
+func (l *Listener) listen(ctx context.Context) error {
+	pooled, err := l.db.Pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection is taken out of the pool, as it's left listening
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+cacheInvalidationChannel); err != nil {
+		return err
+	}
+	l.connected.Store(true)
+	l.invalidateAll()
+	l.logger.Info("Cache invalidation listener connected")
+
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, listenerPingInterval)
+		notification, err := conn.WaitForNotification(waitCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			// The connection stays usable after a wait times out
+			if err := conn.Ping(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		l.dispatch(notification)
+	}
+}
+
+func (l *Listener) dispatch(notification *pgconn.Notification) {
+	var change RowChange
+	if err := json.Unmarshal([]byte(notification.Payload), &change); err != nil {
+		l.logger.Warn("Invalid cache invalidation payload", zap.String("payload", notification.Payload), zap.Error(err))
+		l.invalidateAll()
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, inv := range l.invalidators {
+		inv.Invalidate(change)
+	}
+}
+
+func (l *Listener) invalidateAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, inv := range l.invalidators {
+		inv.InvalidateAll()
+	}
+}
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/glassbox/api/internal/telemetry"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// WriteMetrics reports the state of each connection pool, labelled
+// pool="primary" or pool="replica-N", and whether each replica is serving
+// reads. A rising wait count or acquire time means requests are queueing
+// for connections.
+func (db *DB) WriteMetrics(w *telemetry.MetricsWriter) {
+	type pool struct {
+		labels map[string]string
+		stat   *pgxpool.Stat
+	}
+	pools := []pool{{map[string]string{"pool": "primary"}, db.Pool.Stat()}}
+	var healthy []telemetry.Sample
+	for i, r := range db.replicas {
+		labels := map[string]string{"pool": fmt.Sprintf("replica-%d", i+1)}
+		pools = append(pools, pool{labels, r.pool.Stat()})
+		healthy = append(healthy, telemetry.Sample{Labels: labels, Value: boolValue(r.healthy.Load())})
+	}
+
+	samples := func(value func(*pgxpool.Stat) float64) []telemetry.Sample {
+		out := make([]telemetry.Sample, len(pools))
+		for i, p := range pools {
+			out[i] = telemetry.Sample{Labels: p.labels, Value: value(p.stat)}
+		}
+		return out
+	}
+	gauge := func(name, help string, value func(*pgxpool.Stat) float64) {
+		w.Gauge(name, help, samples(value)...)
+	}
+	counter := func(name, help string, value func(*pgxpool.Stat) float64) {
+		w.Counter(name, help, samples(value)...)
+	}
+
+	gauge("glassbox_db_pool_max_conns", "Maximum size of the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.MaxConns()) })
+	gauge("glassbox_db_pool_total_conns", "Connections in the pool, including those being opened.",
+		func(s *pgxpool.Stat) float64 { return float64(s.TotalConns()) })
+	gauge("glassbox_db_pool_acquired_conns", "Connections in use.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquiredConns()) })
+	gauge("glassbox_db_pool_idle_conns", "Idle connections.",
+		func(s *pgxpool.Stat) float64 { return float64(s.IdleConns()) })
+	gauge("glassbox_db_pool_constructing_conns", "Connections being opened.",
+		func(s *pgxpool.Stat) float64 { return float64(s.ConstructingConns()) })
+	counter("glassbox_db_pool_acquires_total", "Connections acquired from the pool.",
+		func(s *pgxpool.Stat) float64 { return float64(s.AcquireCount()) })
+	counter("glassbox_db_pool_acquire_seconds_total", "Time spent acquiring connections.",
+		func(s *pgxpool.Stat) float64 { return s.AcquireDuration().Seconds() })
+	counter("glassbox_db_pool_acquire_waits_total", "Acquires that had to wait because no connection was idle.",
+		func(s *pgxpool.Stat) float64 { return float64(s.EmptyAcquireCount()) })
+	counter("glassbox_db_pool_acquires_canceled_total", "Acquires canceled before a connection was available.",
+		func(s *pgxpool.Stat) float64 { return float64(s.CanceledAcquireCount()) })
+	counter("glassbox_db_pool_new_conns_total", "Connections opened.",
+		func(s *pgxpool.Stat) float64 { return float64(s.NewConnsCount()) })
+	w.Counter("glassbox_db_tx_retries_total", "Transactions retried after a serialization failure or deadlock.",
+		telemetry.Sample{Value: float64(db.txRetries.Load())})
+	w.Gauge("glassbox_db_replica_healthy", "Whether the replica is serving reads (1) or lagging or unreachable (0).", healthy...)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -2,30 +2,364 @@ package database
 
 import (
 	"context"
-	_ "embed"
+	"embed"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"go.uber.org/zap"
 )
 
-//go:embed schema.sql
-var schemaSQL string
+// Migrations are versioned files in migrations/, named like golang-migrate's:
+// NNN_name.up.sql applies a change and NNN_name.down.sql reverts it. The
+// current version is the single row of schema_migrations (version, dirty),
+// in golang-migrate's format, so either tool can manage the database.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
 
-// RunMigrations executes the database schema migration
-// This is idempotent - safe to run multiple times due to IF NOT EXISTS clauses
-func RunMigrations(db *DB, logger *zap.Logger) error {
-	logger.Info("Running database migrations...")
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
+// Advisory lock held while migrating, so API instances starting together
+// don't apply the same migration twice
+const migrationLockID = 4_727_118_356
+
+// How long migrations may take when the API runs them at startup
+const startupMigrationTimeout = 5 * time.Minute
+
+var (
+	// ErrDirtySchema is returned when a migration applied outside a
+	// transaction (e.g. by golang-migrate) failed partway. Fix the schema by
+	// hand, then record the version it's at with `api migrate force`.
+	ErrDirtySchema = errors.New("database schema is dirty")
+
+	// ErrUnversionedSchema is returned for a database that has tables but no
+	// recorded version, e.g. one created from schema files with psql. Record
+	// the version it's at with `api migrate force`.
+	ErrUnversionedSchema = errors.New("database has a schema but no recorded migration version")
+
+	// ErrPendingMigrations is returned at startup when AUTO_MIGRATE is off
+	// and the database is behind the binary
+	ErrPendingMigrations = errors.New("database has pending migrations")
+)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version uint   `json:"version"`
+	Name    string `json:"name"`
+	up      string
+	down    string
+}
+
+// MigrationStatus is the database's schema version compared to the
+// migrations built into the binary
+type MigrationStatus struct {
+	Version uint        `json:"version"` // 0 = no migrations applied
+	Dirty   bool        `json:"dirty"`
+	Latest  uint        `json:"latest"`
+	Pending []Migration `json:"pending"`
+}
+
+// Migrator applies and reverts the embedded migrations
+type Migrator struct {
+	db         *DB
+	migrations []Migration
+	logger     *zap.Logger
+}
+
+// NewMigrator loads the embedded migrations. Versions must be sequential
+// from 1 and every migration needs both an up and a down file.
+func NewMigrator(db *DB, logger *zap.Logger) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations, logger: logger}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := map[uint]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file name %q", entry.Name())
+		}
+		version, err := strconv.ParseUint(match[1], 10, 32)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("invalid migration version in %q", entry.Name())
+		}
+		body, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+
+		m := byVersion[uint(version)]
+		if m == nil {
+			m = &Migration{Version: uint(version), Name: match[2]}
+			byVersion[uint(version)] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, m.Name, match[2])
+		}
+		// 1_init.up.sql and 001_init.up.sql are the same migration
+		file := &m.up
+		if match[3] == "down" {
+			file = &m.down
+		}
+		if *file != "" {
+			return nil, fmt.Errorf("migration %d has two %s files", version, match[3])
+		}
+		*file = string(body)
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return int(a.Version) - int(b.Version) })
+	for i, m := range migrations {
+		if m.Version != uint(i+1) {
+			return nil, fmt.Errorf("migration versions must be sequential: expected %d, found %d", i+1, m.Version)
+		}
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// Latest returns the version of the newest embedded migration
+func (m *Migrator) Latest() uint {
+	return uint(len(m.migrations))
+}
+
+// Status reports the database's version and the migrations it's missing
+func (m *Migrator) Status(ctx context.Context) (*MigrationStatus, error) {
+	version, dirty, err := readVersion(ctx, m.db.Pool)
+	if err != nil {
+		return nil, err
+	}
+	status := &MigrationStatus{Version: version, Dirty: dirty, Latest: m.Latest(), Pending: []Migration{}}
+	if version < m.Latest() {
+		status.Pending = m.migrations[version:]
+	}
+	return status, nil
+}
+
+// Up applies every pending migration in order. Each runs in a transaction
+// together with the version update, so a failed migration leaves the
+// database at the previous version.
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			var hasSchema bool
+			if err := conn.QueryRow(ctx, `SELECT to_regclass('organizations') IS NOT NULL`).Scan(&hasSchema); err != nil {
+				return fmt.Errorf("failed to inspect schema: %w", err)
+			}
+			if hasSchema {
+				return ErrUnversionedSchema
+			}
+		}
+		if version > m.Latest() {
+			// A newer binary migrated the database; this one can still run
+			// if the migrations are backward compatible, as they should be
+			m.logger.Warn("Database is ahead of this binary's migrations",
+				zap.Uint("version", version), zap.Uint("latest", m.Latest()))
+			return nil
+		}
+
+		for _, migration := range m.migrations[version:] {
+			start := time.Now()
+			if err := m.apply(ctx, conn, migration.up, migration.Version); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			m.logger.Info("Applied migration",
+				zap.Uint("version", migration.Version),
+				zap.String("name", migration.Name),
+				zap.Duration("duration", time.Since(start)),
+			)
+		}
+		return nil
+	})
+}
+
+// Down reverts the last steps migrations, newest first
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		version, err := m.currentVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if version > m.Latest() {
+			return fmt.Errorf("database is at version %d, newer than this binary's %d; revert with the binary that applied it", version, m.Latest())
+		}
+
+		for ; steps > 0 && version > 0; steps-- {
+			migration := m.migrations[version-1]
+			if err := m.apply(ctx, conn, migration.down, version-1); err != nil {
+				return fmt.Errorf("reverting migration %d_%s failed: %w", migration.Version, migration.Name, err)
+			}
+			m.logger.Info("Reverted migration", zap.Uint("version", migration.Version), zap.String("name", migration.Name))
+			version--
+		}
+		return nil
+	})
+}
+
+// Force records version as the database's current version without running
+// any migration, and clears the dirty flag. It's for adopting an existing
+// database or recovering from a failed migration that was fixed by hand.
+func (m *Migrator) Force(ctx context.Context, version uint) error {
+	if version > m.Latest() {
+		return fmt.Errorf("version %d is newer than the latest migration, %d", version, m.Latest())
+	}
+	return m.withLock(ctx, func(conn *pgxpool.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			return setVersion(ctx, tx, version)
+		})
+	})
+}
 
-	// Execute the schema SQL
-	_, err := db.Pool.Exec(ctx, schemaSQL)
+// withLock runs fn on one connection holding the migration advisory lock
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *pgxpool.Conn) error) error {
+	conn, err := m.db.Pool.Acquire(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to execute migrations: %w", err)
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Waiting for the lock and running migrations can both take longer than
+	// DB_STATEMENT_TIMEOUT_MS. RESET restores the pool's setting before the
+	// connection goes back.
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return fmt.Errorf("failed to disable statement timeout: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `RESET statement_timeout`)
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return fmt.Errorf("failed to acquire migration lock: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	if _, err := conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT NOT NULL PRIMARY KEY,
+			dirty BOOLEAN NOT NULL
+		)
+	`); err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	return fn(conn)
+}
+
+// currentVersion returns the recorded version, failing if it's dirty
+func (m *Migrator) currentVersion(ctx context.Context, conn *pgxpool.Conn) (uint, error) {
+	version, dirty, err := readVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("%w at version %d", ErrDirtySchema, version)
+	}
+	return version, nil
+}
+
+// apply runs one migration file and records the resulting version
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, sql string, version uint) error {
+	return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+		// Without arguments pgx uses the simple protocol, which runs every
+		// statement in the file
+		if _, err := tx.Exec(ctx, sql); err != nil {
+			return err
+		}
+		return setVersion(ctx, tx, version)
+	})
+}
+
+type querier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+func readVersion(ctx context.Context, q querier) (uint, bool, error) {
+	// The table doesn't exist until the first migration runs
+	var exists bool
+	if err := q.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if !exists {
+		return 0, false, nil
 	}
 
-	logger.Info("Database migrations completed successfully")
+	var version int64
+	var dirty bool
+	err := q.QueryRow(ctx, `SELECT version, dirty FROM schema_migrations LIMIT 1`).Scan(&version, &dirty)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return uint(version), dirty, nil
+}
+
+func setVersion(ctx context.Context, tx pgx.Tx, version uint) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM schema_migrations`); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+	if version == 0 {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)`, version); err != nil {
+		return fmt.Errorf("failed to record schema version: %w", err)
+	}
+	return nil
+}
+
+// RunMigrations brings the schema up to date at API startup. With
+// autoMigrate off it only checks that nothing is pending, leaving
+// migrations to `api migrate up` (e.g. a deploy step).
+func RunMigrations(db *DB, autoMigrate bool, logger *zap.Logger) error {
+	migrator, err := NewMigrator(db, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), startupMigrationTimeout)
+	defer cancel()
+
+	if !autoMigrate {
+		status, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		if status.Dirty {
+			return fmt.Errorf("%w at version %d", ErrDirtySchema, status.Version)
+		}
+		if len(status.Pending) > 0 {
+			return fmt.Errorf("%w: at version %d of %d; run `api migrate up`", ErrPendingMigrations, status.Version, status.Latest)
+		}
+		return nil
+	}
+
+	logger.Info("Running database migrations...")
+	if err := migrator.Up(ctx); err != nil {
+		return err
+	}
+	logger.Info("Database migrations completed successfully", zap.Uint("latest", migrator.Latest()))
 	return nil
 }
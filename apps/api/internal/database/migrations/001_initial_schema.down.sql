@@ -0,0 +1,24 @@
+-- Migration: Initial Schema (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS notifications;
+DROP TABLE IF EXISTS audit_log;
+DROP TABLE IF EXISTS templates;
+DROP TABLE IF EXISTS agent_trace_events;
+DROP TABLE IF EXISTS agent_executions;
+DROP TABLE IF EXISTS node_dependencies;
+DROP TABLE IF EXISTS node_outputs;
+DROP TABLE IF EXISTS node_inputs;
+DROP TABLE IF EXISTS node_versions;
+DROP TABLE IF EXISTS nodes;
+DROP TABLE IF EXISTS files;
+DROP TABLE IF EXISTS project_members;
+DROP TABLE IF EXISTS projects;
+DROP TABLE IF EXISTS org_members;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS organizations;
+
+DROP FUNCTION IF EXISTS increment_node_version();
+DROP FUNCTION IF EXISTS update_updated_at();
+
+-- Extensions are left installed: other schemas may use them
@@ -0,0 +1,5 @@
+-- Migration: Request audit log (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS request_audit_log;
+DROP FUNCTION IF EXISTS reject_audit_log_modification();
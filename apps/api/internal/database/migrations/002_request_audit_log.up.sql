@@ -0,0 +1,43 @@
+-- Migration: Request audit log
+-- Created: 2026-10-16
+
+-- =====================================================
+-- REQUEST AUDIT LOG
+-- =====================================================
+-- Append-only record of every authenticated API request, written
+-- asynchronously by the audit middleware
+CREATE TABLE IF NOT EXISTS request_audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL,
+    org_id UUID, -- resolved from route params; NULL for non-org routes (e.g. /users/me)
+
+    method VARCHAR(10) NOT NULL,
+    route VARCHAR(255) NOT NULL, -- route template, e.g. '/api/v1/nodes/:nodeId'
+    path TEXT NOT NULL,
+    resource_ids JSONB DEFAULT '{}', -- route params, e.g. {"nodeId": "..."}
+
+    status INTEGER NOT NULL,
+    latency_ms BIGINT NOT NULL,
+
+    request_id VARCHAR(100),
+    ip_address INET,
+    user_agent TEXT,
+
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_request_audit_log_org_time ON request_audit_log(org_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_request_audit_log_user_time ON request_audit_log(user_id, created_at DESC);
+
+-- Reject updates and deletes so the log stays append-only
+CREATE OR REPLACE FUNCTION reject_audit_log_modification()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'request_audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS request_audit_log_append_only ON request_audit_log;
+CREATE TRIGGER request_audit_log_append_only
+    BEFORE UPDATE OR DELETE ON request_audit_log
+    FOR EACH ROW EXECUTE FUNCTION reject_audit_log_modification();
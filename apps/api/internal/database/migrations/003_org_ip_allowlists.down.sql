@@ -0,0 +1,4 @@
+-- Migration: Org IP allowlists (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS org_ip_allowlists;
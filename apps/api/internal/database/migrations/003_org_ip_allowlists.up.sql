@@ -0,0 +1,20 @@
+-- Migration: Org IP allowlists
+-- Created: 2026-10-16
+
+-- =====================================================
+-- ORG IP ALLOWLISTS
+-- =====================================================
+-- When an org has entries, requests touching its resources must come from
+-- one of these ranges. No entries = unrestricted.
+CREATE TABLE IF NOT EXISTS org_ip_allowlists (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    cidr CIDR NOT NULL,
+    description TEXT,
+    created_by UUID REFERENCES users(id),
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE(org_id, cidr)
+);
+
+CREATE INDEX IF NOT EXISTS idx_org_ip_allowlists_org ON org_ip_allowlists(org_id);
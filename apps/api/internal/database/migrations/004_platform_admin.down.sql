@@ -0,0 +1,5 @@
+-- Migration: Platform admins and feature flags (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS feature_flags;
+ALTER TABLE users DROP COLUMN IF EXISTS is_platform_admin;
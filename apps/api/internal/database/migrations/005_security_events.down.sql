@@ -0,0 +1,4 @@
+-- Migration: Security events (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS security_events;
@@ -0,0 +1,18 @@
+-- Migration: Security events
+-- Created: 2026-10-16
+
+-- =====================================================
+-- SECURITY EVENTS
+-- =====================================================
+-- Security-relevant events that are not tied to an org or an authenticated
+-- user, e.g. auth lockouts
+CREATE TABLE IF NOT EXISTS security_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    event_type VARCHAR(100) NOT NULL, -- 'auth.lockout', ...
+    ip_address INET,
+    identity TEXT, -- email or other identifier the attempt was made for
+    details JSONB DEFAULT '{}',
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_security_events_type_time ON security_events(event_type, created_at DESC);
@@ -0,0 +1,4 @@
+-- Migration: Collaborative node documents (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS node_document_updates;
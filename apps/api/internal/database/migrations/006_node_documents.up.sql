@@ -0,0 +1,22 @@
+-- Migration: Collaborative node documents
+-- Created: 2026-10-16
+
+-- =====================================================
+-- NODE DOCUMENT UPDATES
+-- =====================================================
+-- Log of CRDT (Yjs/Automerge) updates for collaboratively edited node fields.
+-- Updates are opaque to the server; clients merge them. A snapshot row holds
+-- the merged state of the updates up to covers_through, which are then
+-- deleted.
+CREATE TABLE IF NOT EXISTS node_document_updates (
+    id BIGSERIAL PRIMARY KEY,
+    node_id UUID NOT NULL REFERENCES nodes(id) ON DELETE CASCADE,
+    field VARCHAR(50) NOT NULL, -- 'description', 'content'
+    update_data BYTEA NOT NULL,
+    is_snapshot BOOLEAN NOT NULL DEFAULT FALSE,
+    covers_through BIGINT, -- snapshots only: last update id merged in
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_document_updates_doc ON node_document_updates(node_id, field, id);
@@ -0,0 +1,22 @@
+-- Migration: Job outbox
+-- Created: 2026-10-16
+
+-- =====================================================
+-- JOB OUTBOX
+-- =====================================================
+-- Worker jobs written in the same transaction as the change that causes them
+-- (e.g. creating an execution). The API's relay publishes unsent rows to the
+-- job queue and marks them sent; sent rows are deleted after a day.
+CREATE TABLE IF NOT EXISTS job_outbox (
+    id BIGSERIAL PRIMARY KEY,
+    queue VARCHAR(50) NOT NULL, -- 'agent', 'file'
+    body BYTEA NOT NULL,
+    attributes JSONB DEFAULT '{}',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    sent_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_outbox_unsent ON job_outbox(id) WHERE sent_at IS NULL;
+CREATE INDEX IF NOT EXISTS idx_job_outbox_sent ON job_outbox(sent_at) WHERE sent_at IS NOT NULL;
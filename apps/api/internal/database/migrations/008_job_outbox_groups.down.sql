@@ -0,0 +1,4 @@
+-- Migration: Job outbox message groups (down)
+-- Created: 2026-10-16
+
+ALTER TABLE job_outbox DROP COLUMN IF EXISTS group_id;
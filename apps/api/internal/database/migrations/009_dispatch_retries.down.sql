@@ -0,0 +1,5 @@
+-- Migration: Dispatch retries (down)
+-- Created: 2026-10-16
+
+ALTER TABLE agent_executions DROP COLUMN IF EXISTS dispatch_attempts;
+ALTER TABLE job_outbox DROP COLUMN IF EXISTS next_attempt_at;
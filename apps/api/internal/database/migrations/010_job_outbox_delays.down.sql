@@ -0,0 +1,4 @@
+-- Migration: Delayed outbox jobs (down)
+-- Created: 2026-10-16
+
+ALTER TABLE job_outbox DROP COLUMN IF EXISTS deliver_at;
@@ -0,0 +1,4 @@
+-- Migration: Agent execution priority (down)
+-- Created: 2026-10-16
+
+ALTER TABLE agent_executions DROP COLUMN IF EXISTS priority;
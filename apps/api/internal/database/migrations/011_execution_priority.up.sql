@@ -0,0 +1,5 @@
+-- Migration: Agent execution priority
+-- Created: 2026-10-16
+
+-- Agent execution priority: interactive or batch, which picks the agent queue
+ALTER TABLE agent_executions ADD COLUMN IF NOT EXISTS priority VARCHAR(20) NOT NULL DEFAULT 'interactive';
@@ -0,0 +1,4 @@
+-- Migration: Job quarantine (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS job_quarantine;
@@ -0,0 +1,18 @@
+-- Migration: Job quarantine
+-- Created: 2026-10-16
+
+-- Jobs set aside for admin review instead of retried forever: outbox jobs
+-- that keep failing to publish and jobs workers could not decode
+CREATE TABLE IF NOT EXISTS job_quarantine (
+    id BIGSERIAL PRIMARY KEY,
+    queue VARCHAR(50) NOT NULL,
+    body BYTEA NOT NULL,
+    attributes JSONB DEFAULT '{}',
+    group_id VARCHAR(128),
+    source VARCHAR(20) NOT NULL, -- 'outbox', 'consumer'
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_quarantine_queue ON job_quarantine(queue, id);
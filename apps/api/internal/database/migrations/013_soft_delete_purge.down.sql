@@ -0,0 +1,8 @@
+-- Migration: Soft-delete purge (down)
+-- Created: 2026-10-16
+
+ALTER TABLE audit_log DROP CONSTRAINT audit_log_agent_execution_id_fkey;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_agent_execution_id_fkey
+    FOREIGN KEY (agent_execution_id) REFERENCES agent_executions(id);
+
+DROP INDEX IF EXISTS idx_nodes_deleted;
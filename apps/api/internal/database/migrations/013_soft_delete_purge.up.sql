@@ -0,0 +1,11 @@
+-- Migration: Soft-delete purge
+-- Created: 2026-10-16
+
+-- The purge job finds soft-deleted nodes by deletion time
+CREATE INDEX idx_nodes_deleted ON nodes(deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- Purging a node deletes its executions; audit entries outlive them and
+-- keep resource_id
+ALTER TABLE audit_log DROP CONSTRAINT audit_log_agent_execution_id_fkey;
+ALTER TABLE audit_log ADD CONSTRAINT audit_log_agent_execution_id_fkey
+    FOREIGN KEY (agent_execution_id) REFERENCES agent_executions(id) ON DELETE SET NULL;
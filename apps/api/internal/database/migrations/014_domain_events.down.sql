@@ -0,0 +1,10 @@
+-- Migration: Domain event store (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS aggregate_snapshots;
+DROP TABLE IF EXISTS event_streams;
+DROP TRIGGER IF EXISTS domain_events_append_only ON domain_events;
+DROP FUNCTION IF EXISTS reject_domain_event_update();
+DROP TABLE IF EXISTS domain_events;
+
+ALTER TABLE organizations DROP CONSTRAINT IF EXISTS organizations_event_sourcing_level_check;
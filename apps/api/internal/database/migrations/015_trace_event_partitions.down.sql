@@ -0,0 +1,45 @@
+-- Migration: Partition trace events by month (down)
+-- Created: 2026-10-16
+
+ALTER TABLE agent_trace_events RENAME TO agent_trace_events_partitioned;
+ALTER TABLE agent_trace_events_partitioned RENAME CONSTRAINT agent_trace_events_pkey TO agent_trace_events_partitioned_pkey;
+DROP INDEX idx_trace_events_execution;
+DROP INDEX idx_trace_events_type;
+ALTER SEQUENCE agent_trace_events_sequence_number_seq OWNED BY NONE;
+
+CREATE TABLE agent_trace_events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    execution_id UUID NOT NULL REFERENCES agent_executions(id) ON DELETE CASCADE,
+
+    -- Event info
+    event_type VARCHAR(50) NOT NULL, -- 'llm_call', 'tool_call', 'decision', 'human_input_requested', 'human_input_received', 'error', 'checkpoint'
+    event_data JSONB NOT NULL,
+
+    -- Timing
+    timestamp TIMESTAMPTZ DEFAULT NOW(),
+    duration_ms INTEGER,
+
+    -- For LLM calls
+    model VARCHAR(100),
+    tokens_in INTEGER,
+    tokens_out INTEGER,
+
+    -- Sequence number for ordering
+    sequence_number INTEGER NOT NULL DEFAULT nextval('agent_trace_events_sequence_number_seq')
+);
+
+ALTER SEQUENCE agent_trace_events_sequence_number_seq OWNED BY agent_trace_events.sequence_number;
+
+INSERT INTO agent_trace_events (id, execution_id, event_type, event_data, timestamp, duration_ms,
+                                model, tokens_in, tokens_out, sequence_number)
+SELECT id, execution_id, event_type, event_data, timestamp, duration_ms,
+       model, tokens_in, tokens_out, sequence_number
+FROM agent_trace_events_partitioned;
+
+DROP TABLE agent_trace_events_partitioned;
+DROP FUNCTION IF EXISTS create_trace_event_partition(DATE);
+
+CREATE INDEX idx_trace_events_execution ON agent_trace_events(execution_id, sequence_number);
+CREATE INDEX idx_trace_events_type ON agent_trace_events(execution_id, event_type);
+
+ALTER TABLE agent_trace_events ENABLE ROW LEVEL SECURITY;
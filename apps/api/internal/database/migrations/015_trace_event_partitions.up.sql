@@ -0,0 +1,84 @@
+-- Migration: Partition trace events by month
+-- Created: 2026-10-16
+
+-- agent_trace_events becomes a table partitioned by timestamp, one
+-- partition per calendar month (UTC). The API creates partitions ahead of
+-- time and drops those past TRACE_RETENTION_DAYS, which is much cheaper than
+-- deleting rows. The partition key is part of the primary key, so timestamp
+-- is now required.
+ALTER TABLE agent_trace_events RENAME TO agent_trace_events_unpartitioned;
+ALTER TABLE agent_trace_events_unpartitioned RENAME CONSTRAINT agent_trace_events_pkey TO agent_trace_events_unpartitioned_pkey;
+DROP INDEX idx_trace_events_execution;
+DROP INDEX idx_trace_events_type;
+ALTER SEQUENCE agent_trace_events_sequence_number_seq OWNED BY NONE;
+
+CREATE TABLE agent_trace_events (
+    id UUID NOT NULL DEFAULT gen_random_uuid(),
+    execution_id UUID NOT NULL REFERENCES agent_executions(id) ON DELETE CASCADE,
+
+    -- Event info
+    event_type VARCHAR(50) NOT NULL, -- 'llm_call', 'tool_call', 'decision', 'human_input_requested', 'human_input_received', 'error', 'checkpoint'
+    event_data JSONB NOT NULL,
+
+    -- Timing
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    duration_ms INTEGER,
+
+    -- For LLM calls
+    model VARCHAR(100),
+    tokens_in INTEGER,
+    tokens_out INTEGER,
+
+    -- Sequence number for ordering
+    sequence_number INTEGER NOT NULL DEFAULT nextval('agent_trace_events_sequence_number_seq'),
+
+    PRIMARY KEY (id, timestamp)
+) PARTITION BY RANGE (timestamp);
+
+ALTER SEQUENCE agent_trace_events_sequence_number_seq OWNED BY agent_trace_events.sequence_number;
+
+CREATE INDEX idx_trace_events_execution ON agent_trace_events(execution_id, sequence_number);
+CREATE INDEX idx_trace_events_type ON agent_trace_events(execution_id, event_type);
+
+ALTER TABLE agent_trace_events ENABLE ROW LEVEL SECURITY;
+
+-- Creates the partition for the month containing month, named
+-- agent_trace_events_pYYYY_MM. Returns false if it already exists.
+CREATE FUNCTION create_trace_event_partition(month DATE) RETURNS BOOLEAN AS $$
+DECLARE
+    start_at DATE := date_trunc('month', month)::DATE;
+    partition_name TEXT := 'agent_trace_events_p' || to_char(start_at, 'YYYY_MM');
+BEGIN
+    IF to_regclass(partition_name) IS NOT NULL THEN
+        RETURN false;
+    END IF;
+    EXECUTE format(
+        'CREATE TABLE %I PARTITION OF agent_trace_events FOR VALUES FROM (%L) TO (%L)',
+        partition_name,
+        start_at::TIMESTAMP AT TIME ZONE 'UTC',
+        (start_at + INTERVAL '1 month')::TIMESTAMP AT TIME ZONE 'UTC'
+    );
+    RETURN true;
+END;
+$$ LANGUAGE plpgsql;
+
+-- Partitions for the existing events, and for this month and the next three
+SELECT create_trace_event_partition(m::DATE)
+FROM (
+    SELECT DISTINCT date_trunc('month', COALESCE(timestamp, NOW()) AT TIME ZONE 'UTC') AS m
+    FROM agent_trace_events_unpartitioned
+    UNION
+    SELECT generate_series(
+        date_trunc('month', NOW() AT TIME ZONE 'UTC'),
+        date_trunc('month', NOW() AT TIME ZONE 'UTC') + INTERVAL '3 months',
+        INTERVAL '1 month'
+    )
+) months;
+
+INSERT INTO agent_trace_events (id, execution_id, event_type, event_data, timestamp, duration_ms,
+                                model, tokens_in, tokens_out, sequence_number)
+SELECT id, execution_id, event_type, event_data, COALESCE(timestamp, NOW()), duration_ms,
+       model, tokens_in, tokens_out, sequence_number
+FROM agent_trace_events_unpartitioned;
+
+DROP TABLE agent_trace_events_unpartitioned;
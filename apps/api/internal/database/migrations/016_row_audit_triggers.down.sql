@@ -0,0 +1,7 @@
+-- Migration: Row audit triggers (down)
+-- Created: 2026-10-16
+
+DROP TRIGGER IF EXISTS agent_executions_row_audit ON agent_executions;
+DROP TRIGGER IF EXISTS files_row_audit ON files;
+DROP TRIGGER IF EXISTS nodes_row_audit ON nodes;
+DROP FUNCTION IF EXISTS audit_row_change();
@@ -0,0 +1,8 @@
+-- Migration: Cache invalidation notifications (down)
+-- Created: 2026-10-16
+
+DROP TRIGGER IF EXISTS users_cache_invalidation ON users;
+DROP TRIGGER IF EXISTS org_ip_allowlists_cache_invalidation ON org_ip_allowlists;
+DROP TRIGGER IF EXISTS organizations_cache_invalidation ON organizations;
+DROP TRIGGER IF EXISTS org_members_cache_invalidation ON org_members;
+DROP FUNCTION IF EXISTS notify_cache_invalidation();
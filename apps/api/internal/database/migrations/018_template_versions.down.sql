@@ -0,0 +1,8 @@
+-- Migration: Template versions (down)
+-- Created: 2026-10-16
+
+DROP INDEX IF EXISTS idx_nodes_template;
+ALTER TABLE projects DROP COLUMN IF EXISTS template_version, DROP COLUMN IF EXISTS template_id;
+ALTER TABLE nodes DROP COLUMN IF EXISTS template_version, DROP COLUMN IF EXISTS template_id;
+DROP TABLE IF EXISTS template_versions;
+ALTER TABLE templates DROP COLUMN IF EXISTS version;
@@ -0,0 +1,4 @@
+-- Migration: Node agent config (down)
+-- Created: 2026-10-16
+
+ALTER TABLE nodes DROP COLUMN IF EXISTS agent_config;
@@ -0,0 +1,7 @@
+-- Migration: Node agent config
+-- Created: 2026-10-16
+
+-- Agent settings for a node, such as the system prompt of the template it
+-- was created from with the template's variables filled in. NULL means the
+-- node uses the project and org defaults.
+ALTER TABLE nodes ADD COLUMN agent_config JSONB;
@@ -0,0 +1,18 @@
+-- Migration: Template marketplace (down)
+-- Created: 2026-10-16
+
+DROP INDEX IF EXISTS idx_templates_rating;
+DROP INDEX IF EXISTS idx_templates_popular;
+DROP INDEX IF EXISTS idx_templates_categories;
+DROP TABLE IF EXISTS template_ratings;
+DROP TRIGGER IF EXISTS update_templates_updated_at ON templates;
+CREATE TRIGGER update_templates_updated_at
+    BEFORE UPDATE ON templates
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at();
+ALTER TABLE templates
+    DROP COLUMN IF EXISTS rating_score,
+    DROP COLUMN IF EXISTS rating_total,
+    DROP COLUMN IF EXISTS rating_count,
+    DROP COLUMN IF EXISTS usage_count,
+    DROP COLUMN IF EXISTS is_featured,
+    DROP COLUMN IF EXISTS categories;
@@ -0,0 +1,8 @@
+-- Migration: Execution agent config
+-- Created: 2026-10-16
+
+-- The agent config an execution runs with, resolved from its override, the
+-- node, template, project and org when it starts. Resumes reuse it, so a
+-- paused execution isn't changed by later edits to those layers. NULL for
+-- executions started before this migration, which resolve it on resume.
+ALTER TABLE agent_executions ADD COLUMN agent_config JSONB;
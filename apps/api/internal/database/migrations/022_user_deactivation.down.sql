@@ -0,0 +1,13 @@
+-- Migration: User deactivation and account deletion (down)
+-- Created: 2026-10-16
+
+DROP TRIGGER IF EXISTS users_cache_invalidation ON users;
+CREATE TRIGGER users_cache_invalidation
+    AFTER UPDATE OF is_platform_admin ON users
+    FOR EACH ROW
+    WHEN (OLD.is_platform_admin IS DISTINCT FROM NEW.is_platform_admin)
+    EXECUTE FUNCTION notify_cache_invalidation();
+
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_revoked_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE users DROP COLUMN IF EXISTS deactivated_at;
@@ -0,0 +1,6 @@
+-- Migration: Notification pipeline (down)
+-- Created: 2026-10-16
+
+ALTER TABLE agent_executions DROP COLUMN IF EXISTS started_by;
+DROP INDEX IF EXISTS idx_notifications_coalesce;
+ALTER TABLE notifications DROP COLUMN IF EXISTS count;
@@ -0,0 +1,15 @@
+-- Migration: Notification pipeline
+-- Created: 2026-10-16
+
+-- Rapid repeats of a notification (the same type about the same resource,
+-- while unread) update one row instead of adding another; count is how
+-- many events it stands for.
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS count INTEGER NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_notifications_coalesce
+    ON notifications(user_id, type, resource_id) WHERE read_at IS NULL;
+
+-- Who to notify when an execution finishes or needs input. NULL for
+-- executions started before this migration, which notify the node's
+-- supervisor or author instead.
+ALTER TABLE agent_executions ADD COLUMN IF NOT EXISTS started_by UUID REFERENCES users(id) ON DELETE SET NULL;
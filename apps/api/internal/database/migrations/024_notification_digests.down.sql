@@ -0,0 +1,4 @@
+-- Migration: Notification digests (down)
+-- Created: 2026-10-16
+
+ALTER TABLE users DROP COLUMN IF EXISTS last_digest_at;
@@ -0,0 +1,4 @@
+-- Migration: Notification webhooks (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS notification_webhooks;
@@ -0,0 +1,27 @@
+-- Migration: Notification webhooks
+-- Created: 2026-10-16
+
+-- Webhook URLs that receive execution notifications, registered by a user
+-- for their own notifications or by an org admin for the whole org
+CREATE TABLE IF NOT EXISTS notification_webhooks (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    -- Signs deliveries; shown once, when the webhook is created
+    secret TEXT NOT NULL,
+    events TEXT[] NOT NULL,
+    description TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_delivery_at TIMESTAMPTZ,
+    last_status INTEGER,
+    last_error TEXT,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    -- Set after too many consecutive failures; a successful test clears it
+    disabled_at TIMESTAMPTZ,
+    CHECK ((org_id IS NULL) <> (user_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS idx_notification_webhooks_org ON notification_webhooks(org_id) WHERE org_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_notification_webhooks_user ON notification_webhooks(user_id) WHERE user_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Migration: Web Push subscriptions (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS push_subscriptions;
@@ -0,0 +1,5 @@
+-- Migration: User onboarding (down)
+-- Created: 2026-10-16
+
+ALTER TABLE users DROP COLUMN IF EXISTS onboarding_dismissed_at;
+DROP TABLE IF EXISTS user_onboarding_steps;
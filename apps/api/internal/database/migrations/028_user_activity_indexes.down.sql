@@ -0,0 +1,6 @@
+-- Migration: User activity indexes (down)
+-- Created: 2026-10-16
+
+DROP INDEX IF EXISTS idx_files_uploaded_by;
+DROP INDEX IF EXISTS idx_agent_executions_started_by;
+DROP INDEX IF EXISTS idx_node_versions_changed_by;
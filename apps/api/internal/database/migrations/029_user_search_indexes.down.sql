@@ -0,0 +1,5 @@
+-- Migration: User search indexes (down)
+-- Created: 2026-10-16
+
+DROP INDEX IF EXISTS idx_users_name_prefix;
+DROP INDEX IF EXISTS idx_users_email_prefix;
@@ -0,0 +1,4 @@
+-- Migration: Mentions (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS mentions;
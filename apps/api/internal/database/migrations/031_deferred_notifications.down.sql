@@ -0,0 +1,4 @@
+-- Migration: Deferred notifications (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS deferred_notifications;
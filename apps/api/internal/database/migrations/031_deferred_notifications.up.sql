@@ -0,0 +1,26 @@
+-- Migration: Deferred notifications
+-- Created: 2026-10-16
+
+-- Email and push deliveries held back by the user's quiet hours. They are
+-- sent once deliver_at passes. A repeat about the same resource replaces the
+-- held one rather than queueing another.
+CREATE TABLE IF NOT EXISTS deferred_notifications (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- The in-app notification, when one was stored
+    notification_id UUID REFERENCES notifications(id) ON DELETE SET NULL,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    type VARCHAR(50) NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    body TEXT,
+    resource_type VARCHAR(50),
+    resource_id UUID,
+    email BOOLEAN NOT NULL DEFAULT FALSE,
+    push BOOLEAN NOT NULL DEFAULT FALSE,
+    deliver_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_deferred_notifications_due ON deferred_notifications(deliver_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_deferred_notifications_resource
+    ON deferred_notifications(user_id, type, resource_id) WHERE resource_id IS NOT NULL;
@@ -0,0 +1,4 @@
+-- Migration: Org invitations (down)
+-- Created: 2026-10-16
+
+DROP TABLE IF EXISTS org_invitations;
@@ -0,0 +1,5 @@
+-- Migration: API keys (down)
+-- Created: 2026-10-16
+
+ALTER TABLE request_audit_log DROP COLUMN IF EXISTS api_key_id;
+DROP TABLE IF EXISTS api_keys;
@@ -0,0 +1,31 @@
+-- Migration: API keys
+-- Created: 2026-10-16
+
+-- Org-scoped keys for automations that can't sign in. A key acts as the
+-- user who created it, limited to its org and its scopes (authz actions).
+-- Only the key's SHA-256 is stored; prefix is its first characters, shown
+-- so keys can be told apart.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL,
+    created_by UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_org ON api_keys(org_id, created_at DESC);
+
+-- API instances cache keys by hash; revoking one must reach them all.
+-- Unknown keys aren't cached, so inserts needn't notify.
+CREATE TRIGGER api_keys_cache_invalidation
+    AFTER UPDATE OF revoked_at OR DELETE ON api_keys
+    FOR EACH ROW EXECUTE FUNCTION notify_cache_invalidation();
+
+-- The key a request was made with, if any
+ALTER TABLE request_audit_log ADD COLUMN IF NOT EXISTS api_key_id UUID;
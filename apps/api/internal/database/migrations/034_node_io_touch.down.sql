@@ -0,0 +1,6 @@
+-- Migration: Bump node updated_at on input and output changes (down)
+-- Created: 2026-10-16
+
+DROP TRIGGER IF EXISTS node_outputs_touch_node ON node_outputs;
+DROP TRIGGER IF EXISTS node_inputs_touch_node ON node_inputs;
+DROP FUNCTION IF EXISTS touch_parent_node();
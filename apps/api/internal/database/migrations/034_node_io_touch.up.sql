@@ -0,0 +1,25 @@
+-- Migration: Bump node updated_at on input and output changes
+-- Created: 2026-10-16
+
+-- A node's representation includes its inputs and outputs, and its ETag is
+-- derived from updated_at. Touch the node whenever one of them changes so
+-- cached copies are revalidated, including outputs written by workers.
+-- The version and row audit triggers ignore an updated_at-only change.
+CREATE FUNCTION touch_parent_node() RETURNS TRIGGER AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE nodes SET updated_at = NOW() WHERE id = OLD.node_id;
+    ELSE
+        UPDATE nodes SET updated_at = NOW() WHERE id = NEW.node_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER node_inputs_touch_node
+    AFTER INSERT OR UPDATE OR DELETE ON node_inputs
+    FOR EACH ROW EXECUTE FUNCTION touch_parent_node();
+
+CREATE TRIGGER node_outputs_touch_node
+    AFTER INSERT OR UPDATE OR DELETE ON node_outputs
+    FOR EACH ROW EXECUTE FUNCTION touch_parent_node();
@@ -0,0 +1,226 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func migrationFS(names ...string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for _, name := range names {
+		fsys["migrations/"+name] = &fstest.MapFile{Data: []byte("-- " + name)}
+	}
+	return fsys
+}
+
+func TestLoadMigrations(t *testing.T) {
+	// Listed out of order; 10 sorts after 9 by number, not by name
+	var names []string
+	for v := 10; v >= 1; v-- {
+		names = append(names, fmt.Sprintf("%03d_step_%d.down.sql", v, v), fmt.Sprintf("%d_step_%d.up.sql", v, v))
+	}
+	migrations, err := loadMigrations(migrationFS(names...), "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) != 10 {
+		t.Fatalf("got %d migrations, want 10", len(migrations))
+	}
+	for i, m := range migrations {
+		if m.Version != uint(i+1) || m.Name != fmt.Sprintf("step_%d", i+1) {
+			t.Fatalf("migrations[%d] = %d_%s", i, m.Version, m.Name)
+		}
+		if m.up != fmt.Sprintf("-- %d_step_%d.up.sql", i+1, i+1) || m.down != fmt.Sprintf("-- %03d_step_%d.down.sql", i+1, i+1) {
+			t.Fatalf("migration %d has up %q, down %q", m.Version, m.up, m.down)
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		files []string
+		want  string
+	}{
+		{"missing down", []string{"001_a.up.sql", "001_a.down.sql", "002_b.up.sql"}, "needs both an up and a down file"},
+		{"missing up", []string{"001_a.down.sql"}, "needs both an up and a down file"},
+		{"gap", []string{"001_a.up.sql", "001_a.down.sql", "003_c.up.sql", "003_c.down.sql"}, "expected 2, found 3"},
+		{"not from 1", []string{"002_b.up.sql", "002_b.down.sql"}, "expected 1, found 2"},
+		{"duplicate number", []string{"001_a.up.sql", "001_a.down.sql", "001_b.up.sql", "001_b.down.sql"}, "has two names"},
+		{"duplicate file", []string{"1_a.up.sql", "001_a.up.sql", "001_a.down.sql"}, "has two up files"},
+		{"version 0", []string{"000_a.up.sql", "000_a.down.sql"}, "invalid migration version"},
+		{"bad name", []string{"001_a.up.sql", "001_a.down.sql", "README.md"}, "unexpected migration file name"},
+	} {
+		if _, err := loadMigrations(migrationFS(tc.files...), "migrations"); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: err = %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
+
+// The embedded migrations must load, or the API can't start
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+}
+
+// testMigrator connects to TEST_DATABASE_URL with a new, empty schema first
+// on the search path, and migrates it with files instead of the embedded
+// migrations. The test is skipped without a database.
+func testMigrator(t *testing.T, files fstest.MapFS) (*Migrator, *DB) {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	admin, err := NewConnection(dbURL, PoolOptions{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	schema := "migrations_test_" + strings.ReplaceAll(uuid.NewString(), "-", "")
+	if _, err := admin.Pool.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		admin.Pool.Exec(context.Background(), `DROP SCHEMA `+schema+` CASCADE`)
+		admin.Close()
+	})
+
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("parse TEST_DATABASE_URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	db, err := NewConnection(u.String(), PoolOptions{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(db.Close)
+
+	migrations, err := loadMigrations(files, "migrations")
+	if err != nil {
+		t.Fatalf("loadMigrations: %v", err)
+	}
+	return &Migrator{db: db, migrations: migrations, logger: zap.NewNop()}, db
+}
+
+func sqlFS(files map[string]string) fstest.MapFS {
+	fsys := fstest.MapFS{}
+	for name, sql := range files {
+		fsys["migrations/"+name] = &fstest.MapFile{Data: []byte(sql)}
+	}
+	return fsys
+}
+
+func TestMigratorUpAndDown(t *testing.T) {
+	m, db := testMigrator(t, sqlFS(map[string]string{
+		"001_a.up.sql":   `CREATE TABLE a (id INT); CREATE TABLE a_log (id INT);`,
+		"001_a.down.sql": `DROP TABLE a_log; DROP TABLE a;`,
+		"002_b.up.sql":   `ALTER TABLE a ADD COLUMN b TEXT;`,
+		"002_b.down.sql": `ALTER TABLE a DROP COLUMN b;`,
+		// Fails after its first statement, which must be rolled back
+		"003_c.up.sql":   `CREATE TABLE c (id INT); SELECT 1/0;`,
+		"003_c.down.sql": `DROP TABLE c;`,
+	}))
+	ctx := context.Background()
+	exists := func(table string) bool {
+		t.Helper()
+		var ok bool
+		if err := db.Pool.QueryRow(ctx, `SELECT to_regclass($1) IS NOT NULL`, table).Scan(&ok); err != nil {
+			t.Fatalf("to_regclass: %v", err)
+		}
+		return ok
+	}
+	status := func() *MigrationStatus {
+		t.Helper()
+		s, err := m.Status(ctx)
+		if err != nil {
+			t.Fatalf("status: %v", err)
+		}
+		return s
+	}
+
+	if s := status(); s.Version != 0 || s.Latest != 3 || len(s.Pending) != 3 {
+		t.Fatalf("fresh status = %+v", s)
+	}
+	err := m.Up(ctx)
+	if err == nil || !strings.Contains(err.Error(), "migration 3_c failed") {
+		t.Fatalf("up err = %v, want migration 3 to fail", err)
+	}
+	if s := status(); s.Version != 2 || s.Dirty || len(s.Pending) != 1 || s.Pending[0].Version != 3 {
+		t.Fatalf("status after failed migration = %+v, want version 2 with 3 pending", s)
+	}
+	if exists("c") {
+		t.Fatal("failed migration's table was kept")
+	}
+	if _, err := db.Pool.Exec(ctx, `SELECT b FROM a`); err != nil {
+		t.Fatalf("migration 2 not applied: %v", err)
+	}
+
+	if err := m.Down(ctx, 5); err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if s := status(); s.Version != 0 || exists("a") || exists("a_log") {
+		t.Fatalf("status after down = %+v, table a exists %v", s, exists("a"))
+	}
+
+	// Force adopts a database at a version without running anything
+	if err := m.Force(ctx, 1); err != nil {
+		t.Fatalf("force: %v", err)
+	}
+	if s := status(); s.Version != 1 || exists("a") {
+		t.Fatalf("status after force = %+v", s)
+	}
+}
+
+func TestMigratorRefusesUnversionedAndDirtySchemas(t *testing.T) {
+	m, db := testMigrator(t, sqlFS(map[string]string{
+		"001_a.up.sql":   `CREATE TABLE a (id INT);`,
+		"001_a.down.sql": `DROP TABLE a;`,
+	}))
+	ctx := context.Background()
+
+	// A schema loaded with psql has tables but no schema_migrations
+	if _, err := db.Pool.Exec(ctx, `CREATE TABLE organizations (id INT)`); err != nil {
+		t.Fatalf("create organizations: %v", err)
+	}
+	if err := m.Up(ctx); !errors.Is(err, ErrUnversionedSchema) {
+		t.Fatalf("up on unversioned schema err = %v, want ErrUnversionedSchema", err)
+	}
+	var exists bool
+	db.Pool.QueryRow(ctx, `SELECT to_regclass('a') IS NOT NULL`).Scan(&exists)
+	if exists {
+		t.Fatal("migrated an unversioned schema")
+	}
+
+	if _, err := db.Pool.Exec(ctx, `INSERT INTO schema_migrations (version, dirty) VALUES (1, true)`); err != nil {
+		t.Fatalf("mark dirty: %v", err)
+	}
+	if err := m.Up(ctx); !errors.Is(err, ErrDirtySchema) {
+		t.Fatalf("up on dirty schema err = %v, want ErrDirtySchema", err)
+	}
+	if err := m.Down(ctx, 1); !errors.Is(err, ErrDirtySchema) {
+		t.Fatalf("down on dirty schema err = %v, want ErrDirtySchema", err)
+	}
+	if err := m.Force(ctx, 1); err != nil {
+		t.Fatalf("force: %v", err)
+	}
+	if s, err := m.Status(ctx); err != nil || s.Version != 1 || s.Dirty {
+		t.Fatalf("status after force = %+v, %v", s, err)
+	}
+}
@@ -2,30 +2,92 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 	"time"
 
-	"github.com/jackc/pgx/v5"
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/telemetry"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
 )
 
 type DB struct {
 	Pool *pgxpool.Pool
+	opts PoolOptions
+
+	// Read replicas, used by Reader while their lag is within maxLag
+	replicas []*replica
+	maxLag   time.Duration
+	next     atomic.Uint64
+
+	// Transactions retried after a serialization failure or deadlock
+	txRetries atomic.Uint64
+}
+
+// replica is a read-only standby of the primary
+type replica struct {
+	pool    *pgxpool.Pool
+	healthy atomic.Bool
+	checked bool // only accessed by checkReplicas
+}
+
+// How often replica lag is checked
+const replicaCheckInterval = 5 * time.Second
+
+// PoolOptions size the connection pool of each database
+type PoolOptions struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+
+	// Postgres cancels any statement that runs longer; zero disables it
+	StatementTimeout time.Duration
+}
+
+// PoolOptionsFrom reads the pool settings from cfg
+func PoolOptionsFrom(cfg *config.Config) PoolOptions {
+	return PoolOptions{
+		MaxConns:         int32(cfg.DBMaxConns),
+		MinConns:         int32(cfg.DBMinConns),
+		MaxConnLifetime:  cfg.DBMaxConnLifetime,
+		MaxConnIdleTime:  cfg.DBMaxConnIdleTime,
+		StatementTimeout: cfg.DBStatementTimeout,
+	}
 }
 
-func NewConnection(databaseURL string) (*DB, error) {
+func NewConnection(databaseURL string, opts PoolOptions) (*DB, error) {
+	pool, err := newPool(databaseURL, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &DB{Pool: pool, opts: opts}, nil
+}
+
+func newPool(databaseURL string, opts PoolOptions) (*pgxpool.Pool, error) {
 	config, err := pgxpool.ParseConfig(databaseURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse database URL: %w", err)
 	}
 
 	// Connection pool settings
-	config.MaxConns = 25
-	config.MinConns = 5
-	config.MaxConnLifetime = 1 * time.Hour
-	config.MaxConnIdleTime = 30 * time.Minute
+	config.MaxConns = opts.MaxConns
+	config.MinConns = opts.MinConns
+	config.MaxConnLifetime = opts.MaxConnLifetime
+	config.MaxConnIdleTime = opts.MaxConnIdleTime
 	config.HealthCheckPeriod = 1 * time.Minute
 
+	// Set on every connection at startup, so runaway queries are stopped by
+	// the server even if the API never cancels them
+	config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opts.StatementTimeout.Milliseconds(), 10)
+
+	// Trace every query
+	config.ConnConfig.Tracer = telemetry.PgxTracer{}
+
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
@@ -36,42 +98,129 @@ func NewConnection(databaseURL string) (*DB, error) {
 
 	// Verify connection
 	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	return &DB{Pool: pool}, nil
+	return pool, nil
 }
 
 func (db *DB) Close() {
+	for _, r := range db.replicas {
+		r.pool.Close()
+	}
 	db.Pool.Close()
 }
 
-// SetOrgContext sets the organization context for Row Level Security
-func (db *DB) SetOrgContext(ctx context.Context, orgID string) error {
-	_, err := db.Pool.Exec(ctx, fmt.Sprintf("SET app.current_org_id = '%s'", orgID))
-	return err
+// ConnectReplicas opens a pool, sized like the primary's, for each read
+// replica. A replica serves reads once a lag check finds it within maxLag;
+// the first check runs here and MonitorReplicas repeats it.
+func (db *DB) ConnectReplicas(urls []string, maxLag time.Duration, logger *zap.Logger) error {
+	for i, url := range urls {
+		pool, err := newPool(url, db.opts)
+		if err != nil {
+			return fmt.Errorf("replica %d: %w", i+1, err)
+		}
+		db.replicas = append(db.replicas, &replica{pool: pool})
+	}
+	db.maxLag = maxLag
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	db.checkReplicas(ctx, logger)
+	return nil
 }
 
-// WithTransaction executes a function within a database transaction
-func (db *DB) WithTransaction(ctx context.Context, fn func(tx pgx.Tx) error) error {
-	tx, err := db.Pool.Begin(ctx)
-	if err != nil {
-		return fmt.Errorf("failed to begin transaction: %w", err)
+// Reader returns a pool for queries that can tolerate data up to the max
+// replica lag old: a healthy replica, chosen round-robin, or the primary
+// when there are none. Writes, and reads that must see them, use Pool.
+func (db *DB) Reader() *pgxpool.Pool {
+	n := len(db.replicas)
+	if n == 0 {
+		return db.Pool
+	}
+	start := db.next.Add(1)
+	for i := range n {
+		if r := db.replicas[(start+uint64(i))%uint64(n)]; r.healthy.Load() {
+			return r.pool
+		}
 	}
+	return db.Pool
+}
 
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback(ctx)
-			panic(p)
+// ReplicaStatus reports how many read replicas are configured and how many
+// are serving reads
+func (db *DB) ReplicaStatus() (configured, inService int) {
+	for _, r := range db.replicas {
+		if r.healthy.Load() {
+			inService++
 		}
-	}()
+	}
+	return len(db.replicas), inService
+}
 
-	if err := fn(tx); err != nil {
-		if rbErr := tx.Rollback(ctx); rbErr != nil {
-			return fmt.Errorf("tx err: %v, rb err: %v", err, rbErr)
+// MonitorReplicas checks replica lag until ctx is cancelled
+func (db *DB) MonitorReplicas(ctx context.Context, logger *zap.Logger) {
+	if len(db.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(replicaCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			checkCtx, cancel := context.WithTimeout(ctx, replicaCheckInterval)
+			db.checkReplicas(checkCtx, logger)
+			cancel()
 		}
-		return err
 	}
+}
+
+// checkReplicas marks each replica healthy if it answers and its lag is
+// within maxLag. A standby that has replayed everything it received has no
+// lag, however old its last transaction.
+func (db *DB) checkReplicas(ctx context.Context, logger *zap.Logger) {
+	for i, r := range db.replicas {
+		var lagSeconds float64
+		err := r.pool.QueryRow(ctx, `
+			SELECT CASE
+				WHEN NOT pg_is_in_recovery() THEN 0
+				WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+				ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+			END
+		`).Scan(&lagSeconds)
+		lag := time.Duration(lagSeconds * float64(time.Second))
+		healthy := err == nil && lag <= db.maxLag
 
-	return tx.Commit(ctx)
+		// Log the first check and changes
+		if was := r.healthy.Swap(healthy); was != healthy || !r.checked {
+			if healthy {
+				logger.Info("Read replica in service", zap.Int("replica", i+1), zap.Duration("lag", lag))
+			} else {
+				logger.Warn("Read replica out of service; reading from primary",
+					zap.Int("replica", i+1), zap.Duration("lag", lag), zap.Error(err))
+			}
+		}
+		r.checked = true
+	}
+}
+
+// IsQueryCanceled reports whether err means a query was stopped before it
+// finished: its context was cancelled or timed out, or Postgres cancelled it
+// (statement_timeout). pgx sends Postgres a cancel request when the context
+// is done, so the query doesn't keep running after the caller has gone.
+func IsQueryCanceled(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "57014" // query_canceled
+}
+
+// SetOrgContext sets the organization context for Row Level Security
+func (db *DB) SetOrgContext(ctx context.Context, orgID string) error {
+	_, err := db.Pool.Exec(ctx, fmt.Sprintf("SET app.current_org_id = '%s'", orgID))
+	return err
 }
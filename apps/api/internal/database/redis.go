@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/glassbox/api/internal/telemetry"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -19,6 +20,7 @@ func NewRedisClient(redisURL string) (*Redis, error) {
 	}
 
 	client := redis.NewClient(opts)
+	client.AddHook(telemetry.RedisHook{})
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -30,6 +32,11 @@ func NewRedisClient(redisURL string) (*Redis, error) {
 	return &Redis{Client: client}, nil
 }
 
+// Ping checks that Redis is reachable
+func (r *Redis) Ping(ctx context.Context) error {
+	return r.Client.Ping(ctx).Err()
+}
+
 func (r *Redis) Close() error {
 	return r.Client.Close()
 }
@@ -72,6 +79,27 @@ func (r *Redis) ReleaseLock(ctx context.Context, key string, value string) error
 	return r.Client.Eval(ctx, script, []string{key}, value).Err()
 }
 
+// holdLease sets KEYS[1] to ARGV[1] for ARGV[2] ms unless another holder
+// has it, extending it when ARGV[1] already does
+var holdLease = redis.NewScript(`
+	if redis.call("get", KEYS[1]) == ARGV[1] then
+		return redis.call("pexpire", KEYS[1], ARGV[2])
+	end
+	if redis.call("set", KEYS[1], ARGV[1], "NX", "PX", ARGV[2]) then
+		return 1
+	end
+	return 0
+`)
+
+// HoldLease makes holder the leader for key, for leader election between
+// API instances: it acquires the lease if it's free or extends it if holder
+// already has it, and reports whether holder has it. Leaders renew before
+// ttl passes; if one stops, another takes over once ttl has passed.
+func (r *Redis) HoldLease(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	held, err := holdLease.Run(ctx, r.Client, []string{key}, holder, ttl.Milliseconds()).Int()
+	return held == 1, err
+}
+
 // Session cache helpers
 func (r *Redis) SetSession(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
 	return r.Client.Set(ctx, key, value, expiration).Err()
@@ -84,3 +112,11 @@ func (r *Redis) GetSession(ctx context.Context, key string) (string, error) {
 func (r *Redis) DeleteSession(ctx context.Context, key string) error {
 	return r.Client.Del(ctx, key).Err()
 }
+
+// Replay protection helpers
+
+// ClaimNonce records a one-time nonce, returning false if it was already used
+// within ttl
+func (r *Redis) ClaimNonce(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return r.Client.SetNX(ctx, key, 1, ttl).Result()
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Attempts WithTransaction makes before returning a retryable error
+const defaultTxAttempts = 3
+
+// Backoff before retrying a transaction, doubled each attempt and jittered
+// so the transactions that collided don't collide again
+const (
+	txRetryInitialBackoff = 10 * time.Millisecond
+	txRetryMaxBackoff     = 200 * time.Millisecond
+)
+
+// TxOptions configure a transaction run by WithTransactionOptions
+type TxOptions struct {
+	// Isolation defaults to the server's, READ COMMITTED
+	Isolation pgx.TxIsoLevel
+	ReadOnly  bool
+
+	// MaxAttempts is how many times fn runs before a serialization failure
+	// or deadlock is returned to the caller. Zero means defaultTxAttempts;
+	// one disables retries.
+	MaxAttempts int
+}
+
+// WithTransaction executes a function within a database transaction at the
+// default isolation level. A transaction that deadlocks is retried; see
+// WithTransactionOptions.
+func (db *DB) WithTransaction(ctx context.Context, fn func(tx pgx.Tx) error) error {
+	return db.WithTransactionOptions(ctx, TxOptions{}, fn)
+}
+
+// WithTransactionOptions executes a function within a database transaction
+// with the given isolation level and access mode. When Postgres aborts the
+// transaction with a serialization failure or deadlock, fn is run again in
+// a new transaction after a short backoff, so fn must not have effects
+// outside tx that can't be repeated.
+func (db *DB) WithTransactionOptions(ctx context.Context, opts TxOptions, fn func(tx pgx.Tx) error) error {
+	attempts := opts.MaxAttempts
+	if attempts < 1 {
+		attempts = defaultTxAttempts
+	}
+	txOpts := pgx.TxOptions{IsoLevel: opts.Isolation}
+	if opts.ReadOnly {
+		txOpts.AccessMode = pgx.ReadOnly
+	}
+
+	backoff := txRetryInitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.runTransaction(ctx, txOpts, fn)
+		if err == nil || attempt >= attempts || !IsRetryable(err) {
+			return err
+		}
+		db.txRetries.Add(1)
+
+		delay := backoff/2 + rand.N(backoff/2+1)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+		backoff = min(backoff*2, txRetryMaxBackoff)
+	}
+}
+
+// runTransaction runs fn once in a transaction, committing if it succeeds
+func (db *DB) runTransaction(ctx context.Context, opts pgx.TxOptions, fn func(tx pgx.Tx) error) error {
+	tx, err := db.Pool.BeginTx(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback(ctx)
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(ctx); rbErr != nil {
+			return fmt.Errorf("tx err: %w, rb err: %v", err, rbErr)
+		}
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// IsRetryable reports whether err means Postgres aborted a transaction that
+// may succeed if run again: a serialization failure, which REPEATABLE READ
+// and SERIALIZABLE transactions get when they conflict, or a deadlock.
+func IsRetryable(err error) bool {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+	return pgErr.Code == "40001" || // serialization_failure
+		pgErr.Code == "40P01" // deadlock_detected
+}
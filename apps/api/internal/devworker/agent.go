@@ -0,0 +1,118 @@
+package devworker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/queue"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// stubModel is recorded as the model of the stub agent's executions
+const stubModel = "devworker-stub"
+
+// handleAgentJob runs the stub agent: the execution goes through running to
+// complete with one simulated LLM call in its trace, reporting each step
+// like the real agent worker does
+func (w *Worker) handleAgentJob(ctx context.Context, body []byte) error {
+	job, unknown, err := queue.DecodeAgentJob(body)
+	if err != nil {
+		return err
+	}
+	w.warnUnknownFields(queue.AgentQueue(job.Priority), unknown)
+
+	// Paused and cancelled executions stay as they are
+	tag, err := w.db.Pool.Exec(ctx, `
+		UPDATE agent_executions
+		SET status = 'running', model_id = $2, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1 AND status IN ('pending', 'running')
+	`, job.ExecutionID, stubModel)
+	if err != nil {
+		return fmt.Errorf("failed to start execution: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		w.logger.Info("Skipping execution that is no longer runnable", zap.String("executionId", job.ExecutionID.String()))
+		return nil
+	}
+	w.broadcaster.BroadcastExecutionUpdate(job.NodeID, job.ExecutionID, "running", 0, 0, "")
+
+	w.progress(job, "started", nil)
+	start := time.Now()
+	if !w.sleep(ctx) {
+		return ctx.Err()
+	}
+	durationMs := int(time.Since(start).Milliseconds())
+
+	eventData, _ := json.Marshal(map[string]any{
+		"model":    stubModel,
+		"response": "In-process development worker: no model was called.",
+	})
+	_, err = w.db.Pool.Exec(ctx, `
+		INSERT INTO agent_trace_events (id, execution_id, event_type, event_data, duration_ms, model, tokens_in, tokens_out)
+		VALUES ($1, $2, 'llm_call', $3, $4, $5, 0, 0)
+	`, uuid.New(), job.ExecutionID, eventData, durationMs, stubModel)
+	if err != nil {
+		return w.failExecution(ctx, job, fmt.Errorf("failed to record trace event: %w", err))
+	}
+	w.progress(job, "finished", &durationMs)
+
+	// The execution may have been cancelled while the step ran
+	var status string
+	err = w.db.Pool.QueryRow(ctx, `
+		UPDATE agent_executions
+		SET status = 'complete', completed_at = NOW()
+		WHERE id = $1 AND status = 'running'
+		RETURNING status
+	`, job.ExecutionID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to complete execution: %w", err)
+	}
+	w.broadcaster.BroadcastExecutionUpdate(job.NodeID, job.ExecutionID, status, 0, 0, "")
+	w.notify(ctx, job, status)
+
+	w.logger.Info("Stub agent completed execution", zap.String("executionId", job.ExecutionID.String()))
+	return nil
+}
+
+// progress reports the stub's LLM call starting or finishing
+func (w *Worker) progress(job queue.AgentJob, phase string, durationMs *int) {
+	w.broadcaster.BroadcastExecutionProgress(websocket.ExecutionProgressPayload{
+		ExecutionID: job.ExecutionID,
+		NodeID:      job.NodeID,
+		Step:        "llm_call",
+		Phase:       phase,
+		Iteration:   1,
+		DurationMs:  durationMs,
+	})
+}
+
+// failExecution marks the execution failed and returns cause
+func (w *Worker) failExecution(ctx context.Context, job queue.AgentJob, cause error) error {
+	_, err := w.db.Pool.Exec(ctx, `
+		UPDATE agent_executions
+		SET status = 'failed', error_message = $2, completed_at = NOW()
+		WHERE id = $1
+	`, job.ExecutionID, cause.Error())
+	if err != nil {
+		w.logger.Error("Failed to mark execution failed", zap.String("executionId", job.ExecutionID.String()), zap.Error(err))
+	}
+	w.broadcaster.BroadcastExecutionUpdate(job.NodeID, job.ExecutionID, "failed", 0, 0, cause.Error())
+	w.notify(ctx, job, "failed")
+	return cause
+}
+
+// notify tells the user who started the execution about its new status
+func (w *Worker) notify(ctx context.Context, job queue.AgentJob, status string) {
+	if err := w.notifier.ExecutionStatusChanged(ctx, job.ExecutionID, status); err != nil {
+		w.logger.Warn("Failed to notify execution status", zap.String("executionId", job.ExecutionID.String()), zap.Error(err))
+	}
+}
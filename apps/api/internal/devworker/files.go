@@ -0,0 +1,37 @@
+package devworker
+
+import (
+	"context"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/queue"
+	"github.com/glassbox/api/internal/websocket"
+)
+
+// handleFileJob extracts the text of plain text and Word uploads with the
+// file processor. Other types (PDFs, images) complete without text; the
+// file processing worker handles them. No embeddings are generated.
+func (w *Worker) handleFileJob(ctx context.Context, body []byte) error {
+	job, unknown, err := queue.DecodeFileProcessingJob(body)
+	if err != nil {
+		return err
+	}
+	w.warnUnknownFields(queue.FileJobs, unknown)
+	return w.files.Process(ctx, job.FileID)
+}
+
+// fileNotifier broadcasts file status straight to WebSocket clients, as the
+// internal API does for out-of-process workers
+type fileNotifier struct {
+	broadcaster websocket.Broadcaster
+}
+
+func (n fileNotifier) NotifyFile(ctx context.Context, file *models.File, status, errMsg string) {
+	n.broadcaster.BroadcastFileProcessing(websocket.FileProcessingPayload{
+		FileID:   file.ID,
+		OrgID:    file.OrgID,
+		Filename: file.Filename,
+		Status:   status,
+		Error:    errMsg,
+	})
+}
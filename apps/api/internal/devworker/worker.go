@@ -0,0 +1,132 @@
+// Package devworker runs the agent and file processing workers in process,
+// so the API alone is a complete local environment: no LocalStack queues and
+// no Python workers. The agent is a stub that never calls a model, and file
+// processing only extracts text the standard library can read. Development
+// only.
+package devworker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/fileprocessor"
+	"github.com/glassbox/api/internal/queue"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// ExecutionNotifier notifies users when an execution finishes, like the
+// internal API does for the real agent worker
+type ExecutionNotifier interface {
+	ExecutionStatusChanged(ctx context.Context, executionID uuid.UUID, status string) error
+}
+
+// Worker consumes the agent and file queues
+type Worker struct {
+	queue       queue.Queue
+	db          *database.DB
+	files       *fileprocessor.Processor
+	quarantine  *queue.Quarantine
+	broadcaster websocket.Broadcaster
+	notifier    ExecutionNotifier
+	logger      *zap.Logger
+
+	// Pause between the stub agent's steps so the UI shows each status
+	stepDelay time.Duration
+}
+
+// New creates an in-process worker on the queue the API dispatches to
+func New(q queue.Queue, db *database.DB, storage fileprocessor.ObjectReader, broadcaster websocket.Broadcaster, notifier ExecutionNotifier, logger *zap.Logger) *Worker {
+	logger = logger.Named("devworker")
+	return &Worker{
+		queue:       q,
+		db:          db,
+		files:       fileprocessor.New(db, storage, nil, fileNotifier{broadcaster}, logger),
+		quarantine:  queue.NewQuarantine(db, nil, logger),
+		broadcaster: broadcaster,
+		notifier:    notifier,
+		logger:      logger,
+		stepDelay:   time.Second,
+	}
+}
+
+// Run consumes the agent queues and the file queue until ctx is cancelled
+func (w *Worker) Run(ctx context.Context) {
+	w.logger.Info("Running in-process workers")
+
+	handlers := map[string]func(ctx context.Context, body []byte) error{
+		queue.AgentJobs:      w.handleAgentJob,
+		queue.AgentBatchJobs: w.handleAgentJob,
+		queue.FileJobs:       w.handleFileJob,
+	}
+	var wg sync.WaitGroup
+	for name, handle := range handlers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.consume(ctx, name, handle)
+		}()
+	}
+	wg.Wait()
+}
+
+// consume handles one message at a time. Failed jobs are acknowledged
+// anyway: handlers record failures on the job's row, and redelivering a
+// job that will fail the same way only repeats the error. Jobs that can't
+// be decoded are quarantined for review first. Jobs from a newer API are
+// the exception; they stay on the queue for an upgraded worker and end up
+// in the dead-letter queue otherwise.
+func (w *Worker) consume(ctx context.Context, name string, handle func(ctx context.Context, body []byte) error) {
+	for ctx.Err() == nil {
+		deliveries, err := w.queue.Receive(ctx, name, queue.ReceiveOptions{Max: 1, Wait: 20 * time.Second})
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			w.logger.Error("Failed to receive jobs", zap.String("queue", name), zap.Error(err))
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, d := range deliveries {
+			if err := handle(ctx, d.Body); err != nil {
+				if errors.Is(err, queue.ErrUnsupportedSchemaVersion) {
+					w.logger.Warn("Leaving job for a newer worker", zap.String("queue", name), zap.Error(err))
+					continue
+				}
+				if errors.Is(err, queue.ErrInvalidJob) {
+					if qErr := w.quarantine.Add(ctx, name, d, queue.QuarantineSourceConsumer, err); qErr != nil {
+						w.logger.Error("Failed to quarantine invalid job", zap.String("queue", name), zap.Error(qErr))
+					}
+				} else {
+					w.logger.Error("Job failed", zap.String("queue", name), zap.Error(err))
+				}
+			}
+			if err := w.queue.Ack(ctx, name, d); err != nil {
+				w.logger.Warn("Failed to acknowledge job", zap.String("queue", name), zap.Error(err))
+			}
+		}
+	}
+}
+
+// warnUnknownFields reports job fields this build doesn't know, which
+// usually means the API was upgraded first
+func (w *Worker) warnUnknownFields(name string, fields []string) {
+	if len(fields) > 0 {
+		w.logger.Warn("Job has unknown fields", zap.String("queue", name), zap.Strings("fields", fields))
+	}
+}
+
+// sleep waits for the step delay; false when ctx is cancelled first
+func (w *Worker) sleep(ctx context.Context) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(w.stepDelay):
+		return true
+	}
+}
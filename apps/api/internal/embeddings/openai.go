@@ -0,0 +1,81 @@
+// Package embeddings generates text embeddings for semantic search. Vectors
+// are stored in files.embedding (pgvector, 1536 dimensions).
+package embeddings
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	openAIEmbeddingsURL = "https://api.openai.com/v1/embeddings"
+
+	// Text beyond this is cut before embedding, like the Python worker does,
+	// to stay inside the model's token limit
+	maxInputChars = 8000
+
+	requestTimeout = 30 * time.Second
+)
+
+// OpenAI generates embeddings with the OpenAI embeddings API
+type OpenAI struct {
+	apiKey string
+	model  string
+	http   *http.Client
+}
+
+// NewOpenAI creates an OpenAI embedder for model (e.g. text-embedding-3-small)
+func NewOpenAI(apiKey, model string) *OpenAI {
+	return &OpenAI{apiKey: apiKey, model: model, http: &http.Client{Timeout: requestTimeout}}
+}
+
+// Embed returns the embedding of text
+func (o *OpenAI) Embed(ctx context.Context, text string) ([]float64, error) {
+	if utf8.RuneCountInString(text) > maxInputChars {
+		text = string([]rune(text)[:maxInputChars])
+	}
+
+	body, err := json.Marshal(map[string]any{"model": o.model, "input": text})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIEmbeddingsURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+
+	resp, err := o.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Data []struct {
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid embedding response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if result.Error != nil {
+			return nil, fmt.Errorf("embedding request failed (%s): %s", resp.Status, result.Error.Message)
+		}
+		return nil, fmt.Errorf("embedding request failed: %s", resp.Status)
+	}
+	if len(result.Data) == 0 {
+		return nil, fmt.Errorf("embedding response has no data")
+	}
+	return result.Data[0].Embedding, nil
+}
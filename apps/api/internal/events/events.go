@@ -0,0 +1,217 @@
+// Package events publishes domain events to an SNS topic, so downstream
+// systems can subscribe to changes instead of polling the API. Publishing is
+// best effort: events are buffered in memory and sent in the background, and
+// an event is lost if the topic is unreachable or the process stops first.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/telemetry"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Event types
+const (
+	NodeUpdated        = "node.updated"
+	ExecutionCompleted = "execution.completed"
+	FileProcessed      = "file.processed"
+)
+
+// SchemaVersion is the version of the event envelope and payloads. Adding a
+// field doesn't change it.
+const SchemaVersion = 1
+
+const (
+	// Events waiting to be sent; more are dropped
+	bufferSize = 1000
+
+	publishTimeout = 5 * time.Second
+
+	// How long Run keeps sending buffered events after it is stopped
+	drainTimeout = 5 * time.Second
+)
+
+// Event is the envelope published for every domain event. Data is the
+// type's payload (NodeUpdatedData, ExecutionCompletedData, FileProcessedData).
+type Event struct {
+	ID            uuid.UUID `json:"id"`
+	Type          string    `json:"type"`
+	SchemaVersion int       `json:"schemaVersion"`
+	OrgID         uuid.UUID `json:"orgId"`
+	OccurredAt    time.Time `json:"occurredAt"`
+	Data          any       `json:"data"`
+}
+
+// NodeUpdatedData is the payload of node.updated
+type NodeUpdatedData struct {
+	NodeID    uuid.UUID `json:"nodeId"`
+	ProjectID uuid.UUID `json:"projectId"`
+	Title     string    `json:"title"`
+	Status    string    `json:"status"`
+	Version   int       `json:"version"`
+	UpdatedBy uuid.UUID `json:"updatedBy"`
+}
+
+// ExecutionCompletedData is the payload of execution.completed, sent when an
+// execution finishes: Status is complete or failed
+type ExecutionCompletedData struct {
+	ExecutionID uuid.UUID `json:"executionId"`
+	NodeID      uuid.UUID `json:"nodeId"`
+	Status      string    `json:"status"`
+	TokensIn    int       `json:"tokensIn"`
+	TokensOut   int       `json:"tokensOut"`
+}
+
+// FileProcessedData is the payload of file.processed, sent when processing
+// ends: Status is processed or failed
+type FileProcessedData struct {
+	FileID   uuid.UUID `json:"fileId"`
+	Filename string    `json:"filename"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Publisher sends events to the topic set by EVENTS_SNS_TOPIC_ARN. A nil
+// Publisher, or one without a topic, discards events.
+type Publisher struct {
+	client   *sns.Client
+	topicARN string
+	events   chan Event
+	logger   *zap.Logger
+}
+
+// New creates a publisher configured for the environment. Without a topic
+// it creates no AWS client and Publish does nothing.
+func New(cfg *config.Config, logger *zap.Logger) (*Publisher, error) {
+	p := &Publisher{topicARN: cfg.EventsSNSTopicARN, logger: logger}
+	if p.topicARN == "" {
+		return p, nil
+	}
+
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(),
+		awsconfig.WithRegion(cfg.AWSRegion),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	telemetry.InstrumentAWS(&awsCfg)
+
+	// Use the LocalStack endpoint in development
+	if cfg.IsDevelopment() {
+		p.client = sns.NewFromConfig(awsCfg, func(o *sns.Options) {
+			o.BaseEndpoint = aws.String("http://localhost:4566")
+		})
+	} else {
+		p.client = sns.NewFromConfig(awsCfg)
+	}
+	p.events = make(chan Event, bufferSize)
+	return p, nil
+}
+
+// Enabled reports whether events are sent anywhere
+func (p *Publisher) Enabled() bool {
+	return p != nil && p.client != nil
+}
+
+// Publish queues an event of a type for the org. It never blocks: when the
+// buffer is full the event is dropped and logged.
+func (p *Publisher) Publish(eventType string, orgID uuid.UUID, data any) {
+	if !p.Enabled() {
+		return
+	}
+	event := Event{
+		ID:            uuid.New(),
+		Type:          eventType,
+		SchemaVersion: SchemaVersion,
+		OrgID:         orgID,
+		OccurredAt:    time.Now().UTC(),
+		Data:          data,
+	}
+	select {
+	case p.events <- event:
+	default:
+		p.logger.Warn("Dropping event: publish buffer is full", zap.String("type", eventType))
+	}
+}
+
+// Run sends queued events until ctx is cancelled, then for up to
+// drainTimeout more
+func (p *Publisher) Run(ctx context.Context) {
+	if !p.Enabled() {
+		return
+	}
+	for {
+		select {
+		case event := <-p.events:
+			// An event being sent when ctx ends is finished
+			p.send(context.WithoutCancel(ctx), event)
+		case <-ctx.Done():
+			p.drain()
+			return
+		}
+	}
+}
+
+func (p *Publisher) drain() {
+	ctx, cancel := context.WithTimeout(context.Background(), drainTimeout)
+	defer cancel()
+	for {
+		select {
+		case event := <-p.events:
+			p.send(ctx, event)
+		default:
+			return
+		}
+		if ctx.Err() != nil {
+			if n := len(p.events); n > 0 {
+				p.logger.Warn("Dropping unsent events on shutdown", zap.Int("count", n))
+			}
+			return
+		}
+	}
+}
+
+// send publishes one event. Subscribers can filter on the eventType and
+// orgId message attributes. FIFO topics get the org as message group, so
+// each org's events arrive in order.
+func (p *Publisher) send(ctx context.Context, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		p.logger.Error("Failed to marshal event", zap.String("type", event.Type), zap.Error(err))
+		return
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(p.topicARN),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"eventType": {DataType: aws.String("String"), StringValue: aws.String(event.Type)},
+			"orgId":     {DataType: aws.String("String"), StringValue: aws.String(event.OrgID.String())},
+		},
+	}
+	if strings.HasSuffix(p.topicARN, ".fifo") {
+		input.MessageGroupId = aws.String(event.OrgID.String())
+		input.MessageDeduplicationId = aws.String(event.ID.String())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, publishTimeout)
+	defer cancel()
+	if _, err := p.client.Publish(ctx, input); err != nil {
+		p.logger.Warn("Failed to publish event",
+			zap.String("type", event.Type),
+			zap.String("id", event.ID.String()),
+			zap.Error(err),
+		)
+	}
+}
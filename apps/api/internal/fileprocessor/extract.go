@@ -0,0 +1,109 @@
+package fileprocessor
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported reports whether text can be extracted from a content type:
+// plain text, JSON, XML and Word documents
+func Supported(contentType string) bool {
+	return extractor(strings.ToLower(contentType)) != nil
+}
+
+// Extract returns the text of a file, cleaned and truncated for storage
+func Extract(contentType string, data []byte) (string, error) {
+	extract := extractor(strings.ToLower(contentType))
+	if extract == nil {
+		return "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+	text, err := extract(data)
+	if err != nil {
+		return "", err
+	}
+
+	// Postgres text can't hold NUL bytes
+	text = strings.ReplaceAll(text, "\x00", "")
+	if utf8.RuneCountInString(text) > MaxExtractedChars {
+		text = string([]rune(text)[:MaxExtractedChars])
+	}
+	return text, nil
+}
+
+func extractor(contentType string) func(data []byte) (string, error) {
+	switch {
+	case strings.Contains(contentType, "word") || strings.Contains(contentType, "docx"):
+		return extractDocx
+	case strings.HasPrefix(contentType, "text/") || strings.Contains(contentType, "json") ||
+		strings.Contains(contentType, "xml"):
+		return func(data []byte) (string, error) { return decodeText(data), nil }
+	default:
+		return nil
+	}
+}
+
+// decodeText decodes UTF-8, falling back to Latin-1 for anything else
+func decodeText(data []byte) string {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	runes := make([]rune, len(data))
+	for i, b := range data {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+// extractDocx returns the paragraphs of a Word document's main body
+func extractDocx(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+	doc, err := archive.Open("word/document.xml")
+	if err != nil {
+		return "", fmt.Errorf("invalid docx file: %w", err)
+	}
+	defer doc.Close()
+
+	var text strings.Builder
+	inText := false
+	decoder := xml.NewDecoder(doc)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("invalid docx file: %w", err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				text.WriteByte('\t')
+			case "br":
+				text.WriteByte('\n')
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				text.WriteByte('\n')
+			}
+		case xml.CharData:
+			if inText {
+				text.Write(t)
+			}
+		}
+	}
+	return strings.TrimSpace(text.String()), nil
+}
@@ -0,0 +1,151 @@
+// Package fileprocessor extracts the text of uploaded files and embeds it
+// for semantic search. It handles the formats the standard library can read
+// (plain text, JSON, XML, Word); other types, such as PDFs and images, are
+// completed without text and need the Python file processing worker.
+//
+// It runs in the standalone file worker (cmd/fileworker) and, without
+// embeddings, in the API's in-process workers.
+package fileprocessor
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// Largest upload downloaded for extraction
+	MaxFileBytes = 50 << 20
+
+	// Extracted text is truncated like the Python worker does
+	MaxExtractedChars = 50000
+)
+
+// File processing statuses reported to clients
+const (
+	StatusProcessing = "processing"
+	StatusProcessed  = "processed"
+	StatusFailed     = "failed"
+)
+
+// ObjectReader reads uploaded files from storage
+type ObjectReader interface {
+	GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error)
+}
+
+// Embedder turns extracted text into a vector for files.embedding
+type Embedder interface {
+	Embed(ctx context.Context, text string) ([]float64, error)
+}
+
+// Notifier tells clients about a file's processing status. Failures are the
+// notifier's to log: the database is the source of truth.
+type Notifier interface {
+	NotifyFile(ctx context.Context, file *models.File, status, errMsg string)
+}
+
+// Processor processes uploaded files
+type Processor struct {
+	db       *database.DB
+	storage  ObjectReader
+	embedder Embedder
+	notifier Notifier
+	logger   *zap.Logger
+}
+
+// New creates a processor. embedder may be nil to skip embeddings.
+func New(db *database.DB, storage ObjectReader, embedder Embedder, notifier Notifier, logger *zap.Logger) *Processor {
+	return &Processor{db: db, storage: storage, embedder: embedder, notifier: notifier, logger: logger}
+}
+
+// Process extracts a file's text, embeds it and stores both. A failure is
+// recorded on the file, reported to clients and returned.
+func (p *Processor) Process(ctx context.Context, fileID uuid.UUID) error {
+	file := &models.File{ID: fileID}
+	err := p.db.Pool.QueryRow(ctx, `
+		UPDATE files SET processing_status = 'processing', processing_error = NULL
+		WHERE id = $1
+		RETURNING org_id, storage_key, filename, content_type
+	`, fileID).Scan(&file.OrgID, &file.StorageKey, &file.Filename, &file.ContentType)
+	if err != nil {
+		return fmt.Errorf("failed to start processing file %s: %w", fileID, err)
+	}
+	p.notifier.NotifyFile(ctx, file, StatusProcessing, "")
+
+	text, err := p.extract(ctx, file)
+	if err != nil {
+		if _, dbErr := p.db.Pool.Exec(ctx, `
+			UPDATE files SET processing_status = 'failed', processing_error = $2
+			WHERE id = $1
+		`, fileID, err.Error()); dbErr != nil {
+			p.logger.Error("Failed to mark file failed", zap.String("fileId", fileID.String()), zap.Error(dbErr))
+		}
+		p.notifier.NotifyFile(ctx, file, StatusFailed, err.Error())
+		return err
+	}
+
+	// Embedding failures don't fail the file; it just isn't searchable
+	var embedding *string
+	if text != "" && p.embedder != nil {
+		vector, err := p.embedder.Embed(ctx, text)
+		if err != nil {
+			p.logger.Error("Failed to generate embedding", zap.String("fileId", fileID.String()), zap.Error(err))
+		} else {
+			formatted := formatVector(vector)
+			embedding = &formatted
+		}
+	}
+
+	_, err = p.db.Pool.Exec(ctx, `
+		UPDATE files
+		SET processing_status = 'complete', extracted_text = $2, embedding = COALESCE($3::vector, embedding)
+		WHERE id = $1
+	`, fileID, text, embedding)
+	if err != nil {
+		return fmt.Errorf("failed to store extracted text: %w", err)
+	}
+	p.notifier.NotifyFile(ctx, file, StatusProcessed, "")
+
+	p.logger.Info("Processed file",
+		zap.String("fileId", fileID.String()),
+		zap.Int("textLength", len(text)),
+		zap.Bool("hasEmbedding", embedding != nil),
+	)
+	return nil
+}
+
+// extract returns the text of a stored file, or "" for unsupported types
+func (p *Processor) extract(ctx context.Context, file *models.File) (string, error) {
+	contentType := ""
+	if file.ContentType != nil {
+		contentType = *file.ContentType
+	}
+	if !Supported(contentType) {
+		p.logger.Warn("Unsupported content type for extraction",
+			zap.String("fileId", file.ID.String()),
+			zap.String("contentType", contentType),
+		)
+		return "", nil
+	}
+
+	data, err := p.storage.GetObject(ctx, file.StorageKey, MaxFileBytes)
+	if err != nil {
+		return "", err
+	}
+	return Extract(contentType, data)
+}
+
+// formatVector formats an embedding as a pgvector literal: [0.1,0.2,...]
+func formatVector(vector []float64) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
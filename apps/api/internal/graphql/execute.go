@@ -0,0 +1,702 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ifArgs are the arguments of @skip and @include
+var ifArgs = Args{"if": {Type: &NonNull{Of: Boolean}}}
+
+// =====================================================
+// VALIDATION
+// =====================================================
+
+type validator struct {
+	schema    *Schema
+	doc       *document
+	variables map[string]*variableDefinition
+	// Fragments spread on the current path, to catch cycles
+	spreading map[string]bool
+	errors    []*Error
+}
+
+func (v *validator) errorf(loc Location, format string, args ...any) {
+	v.errors = append(v.errors, newError(fmt.Sprintf(format, args...), loc))
+}
+
+// validate checks the operation against the schema before any of it runs
+func (s *Schema) validate(doc *document, op *operation) []*Error {
+	v := &validator{schema: s, doc: doc, variables: map[string]*variableDefinition{}, spreading: map[string]bool{}}
+	if op.kind != "query" {
+		v.errorf(op.loc, "Only queries are supported, not %ss", op.kind)
+		return v.errors
+	}
+	for _, def := range op.variables {
+		if _, dup := v.variables[def.name]; dup {
+			v.errorf(def.loc, "There can be only one variable named \"$%s\"", def.name)
+		}
+		v.variables[def.name] = def
+		t, ok := s.inputType(def.typ)
+		if !ok {
+			v.errorf(def.loc, "Variable \"$%s\" cannot be of type %q", def.name, def.typ)
+			continue
+		}
+		if def.hasDefault {
+			if _, err := coerceLiteral(t, def.defaultValue, nil); err != nil {
+				v.errorf(def.loc, "Variable \"$%s\" has an invalid default value: %s", def.name, err)
+			}
+		}
+	}
+	v.directives(op.directives)
+	v.selections(s.Query, op.selections, 1, map[string]*field{})
+	return v.errors
+}
+
+// selections validates a selection set on obj. seen holds the fields
+// already selected at this level, by response key, to catch conflicts.
+func (v *validator) selections(obj *Object, sels []selection, depth int, seen map[string]*field) {
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *field:
+			if other, ok := seen[sel.key()]; ok && other.name != sel.name {
+				v.errorf(sel.loc, "Fields %q conflict because %q and %q are different fields", sel.key(), other.name, sel.name)
+				continue
+			}
+			seen[sel.key()] = sel
+			v.field(obj, sel, depth)
+		case *fragmentSpread:
+			v.directives(sel.directives)
+			frag, ok := v.doc.fragments[sel.name]
+			switch {
+			case !ok:
+				v.errorf(sel.loc, "Unknown fragment %q", sel.name)
+			case frag.typeCondition != obj.Name:
+				v.errorf(sel.loc, "Fragment %q cannot be spread here as objects of type %q can never be of type %q", sel.name, obj.Name, frag.typeCondition)
+			case v.spreading[sel.name]:
+				v.errorf(sel.loc, "Cannot spread fragment %q within itself", sel.name)
+			default:
+				v.spreading[sel.name] = true
+				v.directives(frag.directives)
+				v.selections(obj, frag.selections, depth, seen)
+				delete(v.spreading, sel.name)
+			}
+		case *inlineFragment:
+			v.directives(sel.directives)
+			if sel.typeCondition != "" && sel.typeCondition != obj.Name {
+				v.errorf(sel.loc, "Fragment cannot be spread here as objects of type %q can never be of type %q", obj.Name, sel.typeCondition)
+				continue
+			}
+			v.selections(obj, sel.selections, depth, seen)
+		}
+	}
+}
+
+func (v *validator) field(obj *Object, f *field, depth int) {
+	v.directives(f.directives)
+	if f.name == "__typename" {
+		v.arguments(nil, f.arguments, f.loc, "field \"__typename\"")
+		if len(f.selections) > 0 {
+			v.errorf(f.loc, "Field \"__typename\" must not have a selection since type \"String!\" has no subfields")
+		}
+		return
+	}
+	def, ok := obj.Fields[f.name]
+	if !ok {
+		v.errorf(f.loc, "Cannot query field %q on type %q", f.name, obj.Name)
+		return
+	}
+	v.arguments(def.Args, f.arguments, f.loc, fmt.Sprintf("field %q", f.name))
+
+	sub, isObject := namedType(def.Type).(*Object)
+	switch {
+	case !isObject && len(f.selections) > 0:
+		v.errorf(f.loc, "Field %q must not have a selection since type %q has no subfields", f.name, def.Type)
+	case isObject && len(f.selections) == 0:
+		v.errorf(f.loc, "Field %q of type %q must have a selection of subfields", f.name, def.Type)
+	case isObject && depth >= v.schema.Limits.MaxDepth:
+		v.errorf(f.loc, "Query is nested deeper than the maximum of %d levels", v.schema.Limits.MaxDepth)
+	case isObject:
+		v.selections(sub, f.selections, depth+1, map[string]*field{})
+	}
+}
+
+func (v *validator) directives(dirs []*directive) {
+	for _, d := range dirs {
+		if d.name != "skip" && d.name != "include" {
+			v.errorf(d.loc, "Unknown directive \"@%s\"", d.name)
+			continue
+		}
+		v.arguments(ifArgs, d.arguments, d.loc, "directive \"@"+d.name+"\"")
+	}
+}
+
+// arguments checks the arguments given against defs: that each is known
+// and coerces to its type, and that required ones are there
+func (v *validator) arguments(defs Args, args []*argument, loc Location, owner string) {
+	given := map[string]bool{}
+	for _, a := range args {
+		given[a.name] = true
+		def, ok := defs[a.name]
+		if !ok {
+			v.errorf(a.loc, "Unknown argument %q on %s", a.name, owner)
+			continue
+		}
+		if !v.variablesAllowed(def.Type, a.value, a.loc) {
+			continue
+		}
+		if _, err := coerceLiteral(def.Type, a.value, nil); err != nil {
+			v.errorf(a.loc, "Argument %q on %s has an invalid value: %s", a.name, owner, err)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(defs)) {
+		def := defs[name]
+		if _, required := def.Type.(*NonNull); required && def.Default == nil && !given[name] {
+			v.errorf(loc, "Argument %q of type %q on %s is required, but it was not provided", name, def.Type, owner)
+		}
+	}
+}
+
+// variablesAllowed checks that the variables in a value are defined, with
+// types that fit where they're used
+func (v *validator) variablesAllowed(t Type, val value, loc Location) bool {
+	switch val := val.(type) {
+	case variable:
+		def, ok := v.variables[string(val)]
+		if !ok {
+			v.errorf(loc, "Variable \"$%s\" is not defined", val)
+			return false
+		}
+		_, required := t.(*NonNull)
+		nullable := !def.typ.nonNull && !(def.hasDefault && def.defaultValue != nil)
+		if strings.ReplaceAll(def.typ.String(), "!", "") != strings.ReplaceAll(t.String(), "!", "") || required && nullable {
+			v.errorf(loc, "Variable \"$%s\" of type %q used in position expecting type %q", val, def.typ, t)
+			return false
+		}
+	case []value:
+		if nn, ok := t.(*NonNull); ok {
+			t = nn.Of
+		}
+		if list, ok := t.(*List); ok {
+			t = list.Of
+		}
+		for _, item := range val {
+			if !v.variablesAllowed(t, item, loc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// inputType is the schema type of a variable definition's type
+func (s *Schema) inputType(ref *typeRef) (Type, bool) {
+	var t Type
+	if ref.elem != nil {
+		elem, ok := s.inputType(ref.elem)
+		if !ok {
+			return nil, false
+		}
+		t = &List{Of: elem}
+	} else {
+		scalar, ok := s.types[ref.name].(*Scalar)
+		if !ok {
+			return nil, false
+		}
+		t = scalar
+	}
+	if ref.nonNull {
+		t = &NonNull{Of: t}
+	}
+	return t, true
+}
+
+// =====================================================
+// INPUT COERCION
+// =====================================================
+
+// coerceVariables coerces the request's variables to the types the
+// operation defines them with. Variables neither given nor defaulted are
+// left out, so arguments they're used for take their own defaults.
+func (s *Schema) coerceVariables(op *operation, input map[string]any) (map[string]any, []*Error) {
+	vars := map[string]any{}
+	var errs []*Error
+	for _, def := range op.variables {
+		t, _ := s.inputType(def.typ)
+		raw, given := input[def.name]
+		switch {
+		case given:
+			v, err := coerceInput(t, raw)
+			if err != nil {
+				errs = append(errs, newError(fmt.Sprintf("Variable \"$%s\" got invalid value: %s", def.name, err), def.loc))
+				continue
+			}
+			vars[def.name] = v
+		case def.hasDefault:
+			vars[def.name], _ = coerceLiteral(t, def.defaultValue, vars)
+		case def.typ.nonNull:
+			errs = append(errs, newError(fmt.Sprintf("Variable \"$%s\" of required type %q was not provided", def.name, def.typ), def.loc))
+		}
+	}
+	return vars, errs
+}
+
+// coerceInput coerces a value, as decoded from JSON or already coerced, to
+// t
+func coerceInput(t Type, v any) (any, error) {
+	if nn, ok := t.(*NonNull); ok {
+		if v == nil {
+			return nil, fmt.Errorf("expected a value of type %q, found null", t)
+		}
+		return coerceInput(nn.Of, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *List:
+		items, ok := v.([]any)
+		if !ok {
+			item, err := coerceInput(t.Of, v)
+			return []any{item}, err
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			if out[i], err = coerceInput(t.Of, item); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case *Scalar:
+		return t.ParseValue(v)
+	}
+	return nil, fmt.Errorf("type %q is not an input type", t)
+}
+
+// coerceLiteral coerces a literal to t, substituting variables from vars.
+// With no vars, as when validating, variables are left unchecked.
+func coerceLiteral(t Type, val value, vars map[string]any) (any, error) {
+	if name, ok := val.(variable); ok {
+		if vars == nil {
+			return nil, nil
+		}
+		return coerceInput(t, vars[string(name)])
+	}
+	if nn, ok := t.(*NonNull); ok {
+		if val == nil {
+			return nil, fmt.Errorf("expected a value of type %q, found null", t)
+		}
+		return coerceLiteral(nn.Of, val, vars)
+	}
+	if val == nil {
+		return nil, nil
+	}
+	switch t := t.(type) {
+	case *List:
+		items, ok := val.([]value)
+		if !ok {
+			item, err := coerceLiteral(t.Of, val, vars)
+			return []any{item}, err
+		}
+		out := make([]any, len(items))
+		for i, item := range items {
+			var err error
+			if out[i], err = coerceLiteral(t.Of, item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case *Scalar:
+		return t.ParseValue(plain(val, vars))
+	}
+	return nil, fmt.Errorf("type %q is not an input type", t)
+}
+
+// plain turns list and object literals into the []any and map[string]any
+// of decoded JSON, for scalars such as JSON that take them
+func plain(val value, vars map[string]any) any {
+	switch val := val.(type) {
+	case variable:
+		return vars[string(val)]
+	case []value:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = plain(item, vars)
+		}
+		return out
+	case map[string]value:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = plain(item, vars)
+		}
+		return out
+	}
+	return val
+}
+
+// =====================================================
+// EXECUTION
+// =====================================================
+
+type executor struct {
+	ctx     context.Context
+	schema  *Schema
+	root    any
+	doc     *document
+	vars    map[string]any
+	objects int
+	errors  []*Error
+}
+
+// object is a resolved object whose selections are being executed
+type object struct {
+	source any
+	path   []any
+	out    *orderedMap
+}
+
+// result is a resolved value waiting to be completed into the response
+type result struct {
+	value any
+	path  []any
+	set   func(v any)
+}
+
+// fieldGroup is the fields selected under one response key
+type fieldGroup struct {
+	key    string
+	fields []*field
+}
+
+// executeSelectionSet executes a selection set on every object at once,
+// resolving each field with one resolver call for all of them
+func (e *executor) executeSelectionSet(typ *Object, objs []object, sels []selection) {
+	for _, g := range e.collectFields(sels, nil, map[string]bool{}) {
+		f := g.fields[0]
+		for _, obj := range objs {
+			obj.out.set(g.key, nil)
+		}
+		if f.name == "__typename" {
+			for _, obj := range objs {
+				obj.out.set(g.key, typ.Name)
+			}
+			continue
+		}
+
+		def := typ.Fields[f.name]
+		values, err := e.resolve(def, f, objs)
+		if err != nil {
+			// A batch fails together, so it's reported once
+			e.fieldError(err, f.loc, appendPath(objs[0].path, g.key))
+			continue
+		}
+		results := make([]result, len(objs))
+		for i, obj := range objs {
+			results[i] = result{value: values[i], path: appendPath(obj.path, g.key), set: func(v any) { obj.out.set(g.key, v) }}
+		}
+		e.complete(def.Type, g, results)
+	}
+}
+
+func (e *executor) resolve(def *Field, f *field, objs []object) ([]any, error) {
+	sources := make([]any, len(objs))
+	for i, obj := range objs {
+		sources[i] = obj.source
+	}
+	if def.Resolve == nil {
+		values := make([]any, len(sources))
+		for i, src := range sources {
+			values[i] = property(src, f.name)
+		}
+		return values, nil
+	}
+
+	args, err := e.arguments(def.Args, f.arguments)
+	if err != nil {
+		return nil, err
+	}
+	values, err := def.Resolve(ResolveParams{Context: e.ctx, Sources: sources, Args: args, Root: e.root, FieldName: f.name})
+	if err == nil && len(values) != len(sources) {
+		err = fmt.Errorf("field %q resolved %d values for %d objects", f.name, len(values), len(sources))
+	}
+	return values, err
+}
+
+// arguments coerces a field's arguments, filling in defaults
+func (e *executor) arguments(defs Args, args []*argument) (map[string]any, error) {
+	out := map[string]any{}
+	for name, def := range defs {
+		if def.Default != nil {
+			out[name] = def.Default
+		}
+	}
+	for _, a := range args {
+		if name, ok := a.value.(variable); ok {
+			if _, given := e.vars[string(name)]; !given {
+				continue
+			}
+		}
+		v, err := coerceLiteral(defs[a.name].Type, a.value, e.vars)
+		if err != nil {
+			return nil, fmt.Errorf("argument %q has an invalid value: %w", a.name, err)
+		}
+		out[a.name] = v
+	}
+	return out, nil
+}
+
+// complete turns resolved values into response values: scalars are
+// serialized, and the selections of objects executed, again in one batch
+// across all of them
+func (e *executor) complete(t Type, g *fieldGroup, results []result) {
+	loc := g.fields[0].loc
+	nonNull := false
+	if nn, ok := t.(*NonNull); ok {
+		t, nonNull = nn.Of, true
+	}
+	live := results[:0:0]
+	for _, r := range results {
+		if isNil(r.value) {
+			r.set(nil)
+			if nonNull {
+				e.fieldError(fmt.Errorf("cannot return null for non-nullable field %q", g.fields[0].name), loc, r.path)
+			}
+			continue
+		}
+		live = append(live, r)
+	}
+
+	switch t := t.(type) {
+	case *Scalar:
+		for _, r := range live {
+			v, err := t.Serialize(deref(r.value))
+			if err != nil {
+				r.set(nil)
+				e.fieldError(err, loc, r.path)
+				continue
+			}
+			r.set(v)
+		}
+	case *List:
+		var items []result
+		for _, r := range live {
+			rv := reflect.ValueOf(deref(r.value))
+			if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+				r.set(nil)
+				e.fieldError(fmt.Errorf("expected a list for field %q, found %T", g.fields[0].name, r.value), loc, r.path)
+				continue
+			}
+			out := make([]any, rv.Len())
+			r.set(out)
+			for i := range rv.Len() {
+				items = append(items, result{value: rv.Index(i).Interface(), path: appendPath(r.path, i), set: func(v any) { out[i] = v }})
+			}
+		}
+		e.complete(t.Of, g, items)
+	case *Object:
+		if len(live) == 0 {
+			return
+		}
+		e.objects += len(live)
+		if limit := e.schema.Limits.MaxObjects; limit > 0 && e.objects > limit {
+			for _, r := range live {
+				r.set(nil)
+			}
+			e.fieldError(fmt.Errorf("query returns more than %d objects; request fewer with first", limit), loc, live[0].path)
+			return
+		}
+		objs := make([]object, len(live))
+		for i, r := range live {
+			objs[i] = object{source: r.value, path: r.path, out: newOrderedMap()}
+			r.set(objs[i].out)
+		}
+		var sels []selection
+		for _, f := range g.fields {
+			sels = append(sels, f.selections...)
+		}
+		e.executeSelectionSet(t, objs, sels)
+	}
+}
+
+// collectFields groups a selection set's fields by response key, in the
+// order they're first selected, expanding fragments and dropping what
+// @skip and @include leave out
+func (e *executor) collectFields(sels []selection, groups []*fieldGroup, spread map[string]bool) []*fieldGroup {
+	for _, sel := range sels {
+		switch sel := sel.(type) {
+		case *field:
+			if !e.included(sel.directives) {
+				continue
+			}
+			i := slices.IndexFunc(groups, func(g *fieldGroup) bool { return g.key == sel.key() })
+			if i < 0 {
+				groups = append(groups, &fieldGroup{key: sel.key()})
+				i = len(groups) - 1
+			}
+			groups[i].fields = append(groups[i].fields, sel)
+		case *fragmentSpread:
+			if spread[sel.name] || !e.included(sel.directives) {
+				continue
+			}
+			spread[sel.name] = true
+			groups = e.collectFields(e.doc.fragments[sel.name].selections, groups, spread)
+		case *inlineFragment:
+			if e.included(sel.directives) {
+				groups = e.collectFields(sel.selections, groups, spread)
+			}
+		}
+	}
+	return groups
+}
+
+func (e *executor) included(dirs []*directive) bool {
+	for _, d := range dirs {
+		args, err := e.arguments(ifArgs, d.arguments)
+		if err != nil {
+			continue
+		}
+		cond, _ := args["if"].(bool)
+		if d.name == "skip" && cond || d.name == "include" && !cond {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *executor) fieldError(err error, loc Location, path []any) {
+	msg := err.Error()
+	if msg != "" {
+		msg = strings.ToUpper(msg[:1]) + msg[1:]
+	}
+	e.errors = append(e.errors, &Error{Message: msg, Locations: []Location{loc}, Path: path})
+}
+
+// appendPath extends a response path without sharing its backing array
+func appendPath(path []any, segment any) []any {
+	return append(slices.Clip(path), segment)
+}
+
+// isNil reports whether v is nil or a nil pointer. Nil slices are empty
+// lists, not null.
+func isNil(v any) bool {
+	rv := reflect.ValueOf(v)
+	return !rv.IsValid() || (rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface) && rv.IsNil()
+}
+
+// deref follows pointers to the value they point at
+func deref(v any) any {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer {
+		rv = rv.Elem()
+	}
+	return rv.Interface()
+}
+
+// =====================================================
+// DEFAULT RESOLUTION
+// =====================================================
+
+// jsonFieldIndexes caches, per struct type, the index of each field by
+// json name
+var jsonFieldIndexes sync.Map
+
+// property is a source's field or map entry named name: what a field
+// without a resolver returns
+func property(src any, name string) any {
+	if m, ok := src.(map[string]any); ok {
+		return m[name]
+	}
+	rv := reflect.ValueOf(src)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil
+	}
+	index, ok := jsonFields(rv.Type())[name]
+	if !ok {
+		return nil
+	}
+	f, err := rv.FieldByIndexErr(index)
+	if err != nil {
+		return nil
+	}
+	return f.Interface()
+}
+
+// jsonFields indexes a struct's fields, including promoted ones, by the
+// names encoding/json gives them
+func jsonFields(t reflect.Type) map[string][]int {
+	if cached, ok := jsonFieldIndexes.Load(t); ok {
+		return cached.(map[string][]int)
+	}
+	fields := map[string][]int{}
+	for _, f := range reflect.VisibleFields(t) {
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if !f.IsExported() || name == "-" || f.Anonymous && name == "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Index
+	}
+	jsonFieldIndexes.Store(t, fields)
+	return fields
+}
+
+// =====================================================
+// RESPONSE OBJECTS
+// =====================================================
+
+// orderedMap is a response object, encoded with its keys in the order
+// they were selected
+type orderedMap struct {
+	keys   []string
+	values map[string]any
+}
+
+func newOrderedMap() *orderedMap {
+	return &orderedMap{values: map[string]any{}}
+}
+
+func (m *orderedMap) set(key string, v any) {
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = v
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(k)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		v, err := json.Marshal(m.values[k])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
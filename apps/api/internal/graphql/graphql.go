@@ -0,0 +1,97 @@
+// Package graphql executes GraphQL queries against a schema of Go
+// resolvers. It supports the query language the API's graph endpoint needs:
+// queries with variables, aliases, fragments and @skip/@include. Mutations,
+// subscriptions, interfaces, unions and introspection aren't supported;
+// Schema.SDL describes the schema instead.
+//
+// Fields resolve breadth-first and in batches: a field selected on a list
+// of objects is resolved once for the whole list, so a resolver can load
+// related rows for all of them in one query rather than one per object.
+package graphql
+
+import (
+	"context"
+)
+
+// Request is a GraphQL request as POSTed by clients
+type Request struct {
+	Query         string         `json:"query" binding:"required"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+// Response is a GraphQL response. Data is nil when the request failed to
+// parse or validate; field errors come with the rest of the data.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+// Error is a GraphQL error, located in the query and, for field errors, in
+// the response
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string { return e.Message }
+
+// Location is a line and column in the query, both from 1
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+func newError(message string, loc Location) *Error {
+	return &Error{Message: message, Locations: []Location{loc}}
+}
+
+// Limits bound the work one query can ask for
+type Limits struct {
+	// MaxDepth is how deeply selections can nest
+	MaxDepth int
+	// MaxObjects is how many objects a response can hold; lists past it
+	// come back null with an error
+	MaxObjects int
+}
+
+// Execute runs the requested operation, resolving from root
+func (s *Schema) Execute(ctx context.Context, req Request, root any) *Response {
+	doc, err := parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}
+	}
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{err.(*Error)}}
+	}
+	if errs := s.validate(doc, op); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+	vars, errs := s.coerceVariables(op, req.Variables)
+	if len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+
+	e := &executor{ctx: ctx, schema: s, root: root, doc: doc, vars: vars}
+	data := newOrderedMap()
+	e.executeSelectionSet(s.Query, []object{{source: root, out: data}}, op.selections)
+	return &Response{Data: data, Errors: e.errors}
+}
+
+// operation picks the operation to run: the one named, or the only one
+func (d *document) operation(name string) (*operation, error) {
+	if name == "" {
+		if len(d.operations) > 1 {
+			return nil, newError("Must provide operation name if query contains multiple operations", d.operations[1].loc)
+		}
+		return d.operations[0], nil
+	}
+	for _, op := range d.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: "Unknown operation named \"" + name + "\""}
+}
@@ -0,0 +1,55 @@
+package graphql
+
+import (
+	"context"
+)
+
+// Loader loads values by key in batches and caches them for the rest of a
+// request. Resolvers of fields that point at other objects, such as a
+// node's parent, share one so that each object is fetched at most once per
+// request however many times it's referenced.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+	cache map[K]V
+}
+
+// NewLoader returns a loader that fetches uncached keys with fetch. Keys
+// fetch doesn't return are cached as missing.
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, cache: map[K]V{}}
+}
+
+// LoadMany returns the value of each key, in order, fetching those not yet
+// cached in one call. Missing values are V's zero value.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) ([]V, error) {
+	var missing []K
+	seen := map[K]bool{}
+	for _, k := range keys {
+		if _, ok := l.cache[k]; !ok && !seen[k] {
+			seen[k] = true
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) > 0 {
+		fetched, err := l.fetch(ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range missing {
+			l.cache[k] = fetched[k]
+		}
+	}
+
+	values := make([]V, len(keys))
+	for i, k := range keys {
+		values[i] = l.cache[k]
+	}
+	return values, nil
+}
+
+// Prime caches a value loaded some other way, unless the key is cached
+func (l *Loader[K, V]) Prime(key K, value V) {
+	if _, ok := l.cache[key]; !ok {
+		l.cache[key] = value
+	}
+}
@@ -0,0 +1,727 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// =====================================================
+// QUERY DOCUMENTS
+// =====================================================
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string // query, mutation or subscription
+	name       string
+	variables  []*variableDefinition
+	directives []*directive
+	selections []selection
+	loc        Location
+}
+
+type variableDefinition struct {
+	name         string
+	typ          *typeRef
+	defaultValue value
+	hasDefault   bool
+	loc          Location
+}
+
+// typeRef is a type as written in a variable definition, e.g. [ID!]!
+type typeRef struct {
+	name    string
+	elem    *typeRef // set for lists
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment
+type selection interface{ location() Location }
+
+type field struct {
+	alias      string
+	name       string
+	arguments  []*argument
+	directives []*directive
+	selections []selection
+	loc        Location
+}
+
+// key is the field's name in the response
+func (f *field) key() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	loc        Location
+}
+
+type inlineFragment struct {
+	typeCondition string // empty for the enclosing type
+	directives    []*directive
+	selections    []selection
+	loc           Location
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	loc           Location
+}
+
+func (f *field) location() Location          { return f.loc }
+func (f *fragmentSpread) location() Location { return f.loc }
+func (f *inlineFragment) location() Location { return f.loc }
+
+type argument struct {
+	name  string
+	value value
+	loc   Location
+}
+
+type directive struct {
+	name      string
+	arguments []*argument
+	loc       Location
+}
+
+// value is a literal as written in the query: nil for null, bool, int64,
+// float64, string, enumValue, variable, []value or map[string]value
+type value any
+
+type variable string
+
+type enumValue string
+
+// =====================================================
+// LEXER
+// =====================================================
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	loc   Location
+}
+
+// lex splits a query into tokens, dropping whitespace, commas and comments
+func lex(src string) ([]token, error) {
+	var tokens []token
+	line, lineStart := 1, 0
+	loc := func(pos int) Location {
+		return Location{Line: line, Column: utf8.RuneCountInString(src[lineStart:pos]) + 1}
+	}
+
+	for pos := 0; pos < len(src); {
+		c := src[pos]
+		switch {
+		case c == '\n':
+			pos++
+			line, lineStart = line+1, pos
+		case c == ' ' || c == '\t' || c == '\r' || c == ',':
+			pos++
+		case strings.HasPrefix(src[pos:], "\uFEFF"):
+			pos += len("\uFEFF")
+		case c == '#':
+			for pos < len(src) && src[pos] != '\n' {
+				pos++
+			}
+		case strings.HasPrefix(src[pos:], "..."):
+			tokens = append(tokens, token{tokPunct, "...", loc(pos)})
+			pos += 3
+		case strings.IndexByte("!$&():=@[]{}|", c) >= 0:
+			tokens = append(tokens, token{tokPunct, string(c), loc(pos)})
+			pos++
+		case c == '_' || isLetter(c):
+			start := pos
+			for pos < len(src) && (src[pos] == '_' || isLetter(src[pos]) || isDigit(src[pos])) {
+				pos++
+			}
+			tokens = append(tokens, token{tokName, src[start:pos], loc(start)})
+		case c == '-' || isDigit(c):
+			start := pos
+			kind, end, err := lexNumber(src, pos)
+			if err != nil {
+				return nil, newError(err.Error(), loc(start))
+			}
+			tokens = append(tokens, token{kind, src[start:end], loc(start)})
+			pos = end
+		case strings.HasPrefix(src[pos:], `"""`):
+			start := pos
+			end := strings.Index(src[pos+3:], `"""`)
+			for end >= 0 && src[pos+3+end-1] == '\\' {
+				next := strings.Index(src[pos+3+end+3:], `"""`)
+				if next < 0 {
+					end = -1
+					break
+				}
+				end += 3 + next
+			}
+			if end < 0 {
+				return nil, newError("Unterminated string", loc(start))
+			}
+			raw := src[pos+3 : pos+3+end]
+			tokens = append(tokens, token{tokString, blockString(raw), loc(start)})
+			line += strings.Count(raw, "\n")
+			if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+				lineStart = pos + 3 + i + 1
+			}
+			pos += 3 + end + 3
+		case c == '"':
+			start := pos
+			s, end, err := lexString(src, pos)
+			if err != nil {
+				return nil, newError(err.Error(), loc(start))
+			}
+			tokens = append(tokens, token{tokString, s, loc(start)})
+			pos = end
+		default:
+			r, _ := utf8.DecodeRuneInString(src[pos:])
+			return nil, newError(fmt.Sprintf("Unexpected character %q", r), loc(pos))
+		}
+	}
+	return append(tokens, token{tokEOF, "", loc(len(src))}), nil
+}
+
+func isLetter(c byte) bool { return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' }
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// lexNumber reads an int or float starting at pos and returns its kind and
+// end
+func lexNumber(src string, pos int) (tokenKind, int, error) {
+	digits := func() {
+		for pos < len(src) && isDigit(src[pos]) {
+			pos++
+		}
+	}
+	kind := tokInt
+	if src[pos] == '-' {
+		pos++
+	}
+	start := pos
+	digits()
+	if pos == start {
+		return 0, 0, fmt.Errorf("Invalid number")
+	}
+	if pos < len(src) && src[pos] == '.' {
+		kind = tokFloat
+		pos++
+		start = pos
+		digits()
+		if pos == start {
+			return 0, 0, fmt.Errorf("Invalid number")
+		}
+	}
+	if pos < len(src) && (src[pos] == 'e' || src[pos] == 'E') {
+		kind = tokFloat
+		pos++
+		if pos < len(src) && (src[pos] == '+' || src[pos] == '-') {
+			pos++
+		}
+		start = pos
+		digits()
+		if pos == start {
+			return 0, 0, fmt.Errorf("Invalid number")
+		}
+	}
+	if pos < len(src) && (src[pos] == '_' || src[pos] == '.' || isLetter(src[pos])) {
+		return 0, 0, fmt.Errorf("Invalid number")
+	}
+	return kind, pos, nil
+}
+
+// lexString reads a quoted string starting at pos, returning its value and
+// end
+func lexString(src string, pos int) (string, int, error) {
+	var b strings.Builder
+	for pos++; pos < len(src); pos++ {
+		c := src[pos]
+		switch c {
+		case '"':
+			return b.String(), pos + 1, nil
+		case '\n', '\r':
+			return "", 0, fmt.Errorf("Unterminated string")
+		case '\\':
+			pos++
+			if pos >= len(src) {
+				return "", 0, fmt.Errorf("Unterminated string")
+			}
+			switch src[pos] {
+			case '"', '\\', '/':
+				b.WriteByte(src[pos])
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				if pos+4 >= len(src) {
+					return "", 0, fmt.Errorf("Invalid escape sequence")
+				}
+				r, err := strconv.ParseUint(src[pos+1:pos+5], 16, 32)
+				if err != nil {
+					return "", 0, fmt.Errorf("Invalid escape sequence")
+				}
+				b.WriteRune(rune(r))
+				pos += 4
+			default:
+				return "", 0, fmt.Errorf("Invalid escape sequence")
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("Unterminated string")
+}
+
+// blockString is the value of a """block string""": escaped quotes
+// unescaped, common indentation and blank leading and trailing lines
+// removed
+func blockString(raw string) string {
+	lines := strings.Split(strings.ReplaceAll(raw, `\"""`, `"""`), "\n")
+	indent := -1
+	for _, l := range lines[1:] {
+		trimmed := strings.TrimLeft(l, " \t")
+		if trimmed != "" && (indent < 0 || len(l)-len(trimmed) < indent) {
+			indent = len(l) - len(trimmed)
+		}
+	}
+	for i := 1; i < len(lines) && indent > 0; i++ {
+		if len(lines[i]) >= indent {
+			lines[i] = lines[i][indent:]
+		}
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// =====================================================
+// PARSER
+// =====================================================
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse parses a query document
+func parse(src string) (*document, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	doc := &document{fragments: map[string]*fragment{}}
+
+	for p.peek().kind != tokEOF {
+		t := p.peek()
+		switch {
+		case t.kind == tokPunct && t.value == "{":
+			sels, err := p.selectionSet()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, &operation{kind: "query", selections: sels, loc: t.loc})
+		case t.kind == tokName && (t.value == "query" || t.value == "mutation" || t.value == "subscription"):
+			op, err := p.operation()
+			if err != nil {
+				return nil, err
+			}
+			doc.operations = append(doc.operations, op)
+		case t.kind == tokName && t.value == "fragment":
+			frag, err := p.fragment()
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := doc.fragments[frag.name]; dup {
+				return nil, newError(fmt.Sprintf("There can be only one fragment named %q", frag.name), frag.loc)
+			}
+			doc.fragments[frag.name] = frag
+		default:
+			return nil, p.unexpected(t)
+		}
+	}
+	if len(doc.operations) == 0 {
+		return nil, newError("Document contains no operations", p.peek().loc)
+	}
+	return doc, nil
+}
+
+func (p *parser) peek() token { return p.tokens[p.pos] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+// skip consumes the punctuator punct if it's next
+func (p *parser) skip(punct string) bool {
+	if t := p.peek(); t.kind == tokPunct && t.value == punct {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(punct string) (token, error) {
+	t := p.next()
+	if t.kind != tokPunct || t.value != punct {
+		return t, p.unexpected(t)
+	}
+	return t, nil
+}
+
+func (p *parser) name() (token, error) {
+	t := p.next()
+	if t.kind != tokName {
+		return t, p.unexpected(t)
+	}
+	return t, nil
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokEOF {
+		return newError("Syntax Error: Unexpected end of query", t.loc)
+	}
+	return newError(fmt.Sprintf("Syntax Error: Unexpected %q", t.value), t.loc)
+}
+
+func (p *parser) operation() (*operation, error) {
+	kind := p.next()
+	op := &operation{kind: kind.value, loc: kind.loc}
+	if p.peek().kind == tokName {
+		op.name = p.next().value
+	}
+	if p.skip("(") {
+		for !p.skip(")") {
+			def, err := p.variableDefinition()
+			if err != nil {
+				return nil, err
+			}
+			op.variables = append(op.variables, def)
+		}
+	}
+	var err error
+	if op.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if op.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return op, nil
+}
+
+func (p *parser) variableDefinition() (*variableDefinition, error) {
+	dollar, err := p.expect("$")
+	if err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	def := &variableDefinition{name: name.value, loc: dollar.loc}
+	if def.typ, err = p.typeRef(); err != nil {
+		return nil, err
+	}
+	if p.skip("=") {
+		def.hasDefault = true
+		if def.defaultValue, err = p.value(true); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := p.directives(); err != nil {
+		return nil, err
+	}
+	return def, nil
+}
+
+func (p *parser) typeRef() (*typeRef, error) {
+	t := &typeRef{}
+	if p.skip("[") {
+		elem, err := p.typeRef()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect("]"); err != nil {
+			return nil, err
+		}
+		t.elem = elem
+	} else {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		t.name = name.value
+	}
+	t.nonNull = p.skip("!")
+	return t, nil
+}
+
+func (p *parser) fragment() (*fragment, error) {
+	start := p.next()
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if name.value == "on" {
+		return nil, p.unexpected(name)
+	}
+	if on, err := p.name(); err != nil || on.value != "on" {
+		return nil, p.unexpected(on)
+	}
+	cond, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	frag := &fragment{name: name.value, typeCondition: cond.value, loc: start.loc}
+	if frag.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if frag.selections, err = p.selectionSet(); err != nil {
+		return nil, err
+	}
+	return frag, nil
+}
+
+func (p *parser) selectionSet() ([]selection, error) {
+	if _, err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var sels []selection
+	for !p.skip("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		sels = append(sels, sel)
+	}
+	if len(sels) == 0 {
+		return nil, newError("Syntax Error: Expected a field", p.tokens[p.pos-1].loc)
+	}
+	return sels, nil
+}
+
+func (p *parser) selection() (selection, error) {
+	if t := p.peek(); t.kind == tokPunct && t.value == "..." {
+		p.next()
+		if n := p.peek(); n.kind == tokName && n.value != "on" {
+			p.next()
+			dirs, err := p.directives()
+			if err != nil {
+				return nil, err
+			}
+			return &fragmentSpread{name: n.value, directives: dirs, loc: t.loc}, nil
+		}
+		inline := &inlineFragment{loc: t.loc}
+		if n := p.peek(); n.kind == tokName {
+			p.next()
+			cond, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			inline.typeCondition = cond.value
+		}
+		var err error
+		if inline.directives, err = p.directives(); err != nil {
+			return nil, err
+		}
+		if inline.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+		return inline, nil
+	}
+
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	f := &field{name: name.value, loc: name.loc}
+	if p.skip(":") {
+		actual, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		f.alias, f.name = f.name, actual.value
+	}
+	if f.arguments, err = p.arguments(false); err != nil {
+		return nil, err
+	}
+	if f.directives, err = p.directives(); err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind == tokPunct && t.value == "{" {
+		if f.selections, err = p.selectionSet(); err != nil {
+			return nil, err
+		}
+	}
+	return f, nil
+}
+
+func (p *parser) arguments(constant bool) ([]*argument, error) {
+	if !p.skip("(") {
+		return nil, nil
+	}
+	var args []*argument
+	for !p.skip(")") {
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(":"); err != nil {
+			return nil, err
+		}
+		v, err := p.value(constant)
+		if err != nil {
+			return nil, err
+		}
+		for _, other := range args {
+			if other.name == name.value {
+				return nil, newError(fmt.Sprintf("There can be only one argument named %q", name.value), name.loc)
+			}
+		}
+		args = append(args, &argument{name: name.value, value: v, loc: name.loc})
+	}
+	return args, nil
+}
+
+func (p *parser) directives() ([]*directive, error) {
+	var dirs []*directive
+	for {
+		at := p.peek()
+		if !p.skip("@") {
+			return dirs, nil
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments(false)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, &directive{name: name.value, arguments: args, loc: at.loc})
+	}
+}
+
+// value parses a literal. Constant values, such as variable defaults,
+// can't refer to variables.
+func (p *parser) value(constant bool) (value, error) {
+	t := p.next()
+	switch t.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(t.value, 10, 64)
+		if err != nil {
+			return nil, newError(fmt.Sprintf("Integer %s is out of range", t.value), t.loc)
+		}
+		return n, nil
+	case tokFloat:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, newError(fmt.Sprintf("Float %s is out of range", t.value), t.loc)
+		}
+		return f, nil
+	case tokString:
+		return t.value, nil
+	case tokName:
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		return enumValue(t.value), nil
+	case tokPunct:
+		switch t.value {
+		case "$":
+			if constant {
+				return nil, p.unexpected(t)
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, err
+			}
+			return variable(name.value), nil
+		case "[":
+			list := []value{}
+			for !p.skip("]") {
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, v)
+			}
+			return list, nil
+		case "{":
+			obj := map[string]value{}
+			for !p.skip("}") {
+				name, err := p.name()
+				if err != nil {
+					return nil, err
+				}
+				if _, err := p.expect(":"); err != nil {
+					return nil, err
+				}
+				v, err := p.value(constant)
+				if err != nil {
+					return nil, err
+				}
+				obj[name.value] = v
+			}
+			return obj, nil
+		}
+	}
+	return nil, p.unexpected(t)
+}
@@ -0,0 +1,369 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Type is a *Scalar, *Object, *List or *NonNull
+type Type interface {
+	String() string
+}
+
+// Scalar is a leaf type. Serialize turns a resolved Go value into its JSON
+// form; ParseValue coerces an argument or variable, as decoded from JSON or
+// written in the query, into the Go value resolvers receive, and must
+// accept its own results.
+type Scalar struct {
+	Name        string
+	Description string
+	Serialize   func(v any) (any, error)
+	ParseValue  func(v any) (any, error)
+}
+
+func (s *Scalar) String() string { return s.Name }
+
+// Object is an output type with fields. Fields may refer back to the
+// object, so they can be set after it is created.
+type Object struct {
+	Name        string
+	Description string
+	Fields      Fields
+}
+
+func (o *Object) String() string { return o.Name }
+
+// Fields are an object's fields by name
+type Fields map[string]*Field
+
+// Field is a field of an object. Resolve is called once per selection of
+// the field with every object it's selected on; without one, a field reads
+// the source's struct field with a matching json tag, or its map key.
+type Field struct {
+	Type        Type
+	Description string
+	Args        Args
+	Resolve     ResolveFunc
+}
+
+// Args are a field's arguments by name
+type Args map[string]*Arg
+
+// Arg is a field argument. Arguments not given take Default when it's set.
+type Arg struct {
+	Type        Type
+	Description string
+	Default     any
+}
+
+// List is a list of Of
+type List struct{ Of Type }
+
+func (l *List) String() string { return "[" + l.Of.String() + "]" }
+
+// NonNull is Of without null
+type NonNull struct{ Of Type }
+
+func (n *NonNull) String() string { return n.Of.String() + "!" }
+
+// ResolveParams are what a resolver is called with
+type ResolveParams struct {
+	Context context.Context
+	// Sources are the objects the field is resolved on; for a top-level
+	// field, the root value
+	Sources []any
+	Args    map[string]any
+	// Root is the root value passed to Execute, for per-request state such
+	// as the caller and loaders
+	Root      any
+	FieldName string
+}
+
+// ResolveFunc resolves a field on every source at once, returning one value
+// per source, in order. Resolving in batches is what avoids a query per
+// object: nodes' inputs are one query for all the nodes in a response.
+// Errors are returned to the client as they are, so shouldn't expose
+// internals.
+type ResolveFunc func(p ResolveParams) ([]any, error)
+
+// Schema is a query schema
+type Schema struct {
+	Query  *Object
+	Limits Limits
+	types  map[string]Type
+}
+
+// NewSchema returns the schema whose queries start at query
+func NewSchema(query *Object, limits Limits) *Schema {
+	s := &Schema{Query: query, Limits: limits, types: map[string]Type{}}
+	for _, scalar := range []*Scalar{ID, String, Int, Float, Boolean} {
+		s.types[scalar.Name] = scalar
+	}
+	s.index(query)
+	return s
+}
+
+// index records the named types reachable from t
+func (s *Schema) index(t Type) {
+	t = namedType(t)
+	name := t.String()
+	if _, seen := s.types[name]; seen {
+		return
+	}
+	s.types[name] = t
+	if obj, ok := t.(*Object); ok {
+		for _, f := range obj.Fields {
+			s.index(f.Type)
+			for _, arg := range f.Args {
+				s.index(arg.Type)
+			}
+		}
+	}
+}
+
+// namedType unwraps lists and non-nulls
+func namedType(t Type) Type {
+	for {
+		switch w := t.(type) {
+		case *List:
+			t = w.Of
+		case *NonNull:
+			t = w.Of
+		default:
+			return t
+		}
+	}
+}
+
+// SDL describes the schema in the GraphQL schema definition language, for
+// code generators and editors
+func (s *Schema) SDL() string {
+	var b strings.Builder
+	writeDescription := func(indent, desc string) {
+		if desc != "" {
+			b.WriteString(indent + `"""` + desc + `"""` + "\n")
+		}
+	}
+
+	names := slices.Sorted(maps.Keys(s.types))
+	for _, name := range names {
+		if scalar, ok := s.types[name].(*Scalar); ok && !builtinScalars[name] {
+			writeDescription("", scalar.Description)
+			fmt.Fprintf(&b, "scalar %s\n\n", name)
+		}
+	}
+	b.WriteString("schema {\n  query: " + s.Query.Name + "\n}\n")
+	for _, name := range names {
+		obj, ok := s.types[name].(*Object)
+		if !ok {
+			continue
+		}
+		b.WriteString("\n")
+		writeDescription("", obj.Description)
+		b.WriteString("type " + name + " {\n")
+		for _, fieldName := range slices.Sorted(maps.Keys(obj.Fields)) {
+			f := obj.Fields[fieldName]
+			writeDescription("  ", f.Description)
+			b.WriteString("  " + fieldName)
+			if len(f.Args) > 0 {
+				var args []string
+				for _, argName := range slices.Sorted(maps.Keys(f.Args)) {
+					arg := f.Args[argName]
+					a := argName + ": " + arg.Type.String()
+					if arg.Default != nil {
+						a += " = " + literal(arg.Default)
+					}
+					args = append(args, a)
+				}
+				b.WriteString("(" + strings.Join(args, ", ") + ")")
+			}
+			b.WriteString(": " + f.Type.String() + "\n")
+		}
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+// literal writes a default value as a GraphQL literal
+func literal(v any) string {
+	if s, ok := v.(string); ok {
+		return strconv.Quote(s)
+	}
+	return fmt.Sprint(v)
+}
+
+// =====================================================
+// SCALARS
+// =====================================================
+
+var builtinScalars = map[string]bool{"ID": true, "String": true, "Int": true, "Float": true, "Boolean": true}
+
+var (
+	// ID is a UUID, or any string
+	ID = &Scalar{
+		Name: "ID",
+		Serialize: func(v any) (any, error) {
+			switch v := v.(type) {
+			case uuid.UUID:
+				return v.String(), nil
+			case string:
+				return v, nil
+			}
+			return nil, fmt.Errorf("ID cannot represent %T", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			switch v := v.(type) {
+			case string:
+				return v, nil
+			case int64:
+				return strconv.FormatInt(v, 10), nil
+			}
+			return nil, fmt.Errorf("ID cannot represent %s", describe(v))
+		},
+	}
+
+	String = &Scalar{
+		Name: "String",
+		Serialize: func(v any) (any, error) {
+			if rv := reflect.ValueOf(v); rv.Kind() == reflect.String {
+				return rv.String(), nil
+			}
+			return nil, fmt.Errorf("String cannot represent %T", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			if s, ok := v.(string); ok {
+				return s, nil
+			}
+			return nil, fmt.Errorf("String cannot represent %s", describe(v))
+		},
+	}
+
+	// Int is a signed 32-bit integer. Resolvers receive an int.
+	Int = &Scalar{
+		Name: "Int",
+		Serialize: func(v any) (any, error) {
+			rv := reflect.ValueOf(v)
+			switch {
+			case rv.CanInt() && rv.Int() >= math.MinInt32 && rv.Int() <= math.MaxInt32:
+				return rv.Int(), nil
+			case rv.CanUint() && rv.Uint() <= math.MaxInt32:
+				return int64(rv.Uint()), nil
+			}
+			return nil, fmt.Errorf("Int cannot represent %v", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			var n float64
+			switch v := v.(type) {
+			case int:
+				return v, nil
+			case int64:
+				n = float64(v)
+			case float64:
+				n = v
+			default:
+				return nil, fmt.Errorf("Int cannot represent %s", describe(v))
+			}
+			if n != math.Trunc(n) || n < math.MinInt32 || n > math.MaxInt32 {
+				return nil, fmt.Errorf("Int cannot represent %v", v)
+			}
+			return int(n), nil
+		},
+	}
+
+	// Float is a double. Resolvers receive a float64.
+	Float = &Scalar{
+		Name: "Float",
+		Serialize: func(v any) (any, error) {
+			rv := reflect.ValueOf(v)
+			switch {
+			case rv.CanFloat():
+				return rv.Float(), nil
+			case rv.CanInt():
+				return float64(rv.Int()), nil
+			}
+			return nil, fmt.Errorf("Float cannot represent %T", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			switch v := v.(type) {
+			case float64:
+				return v, nil
+			case int64:
+				return float64(v), nil
+			}
+			return nil, fmt.Errorf("Float cannot represent %s", describe(v))
+		},
+	}
+
+	Boolean = &Scalar{
+		Name: "Boolean",
+		Serialize: func(v any) (any, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent %T", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			if b, ok := v.(bool); ok {
+				return b, nil
+			}
+			return nil, fmt.Errorf("Boolean cannot represent %s", describe(v))
+		},
+	}
+
+	// DateTime is an RFC 3339 timestamp
+	DateTime = &Scalar{
+		Name:        "DateTime",
+		Description: "An RFC 3339 timestamp",
+		Serialize: func(v any) (any, error) {
+			if t, ok := v.(time.Time); ok {
+				return t.UTC().Format(time.RFC3339Nano), nil
+			}
+			return nil, fmt.Errorf("DateTime cannot represent %T", v)
+		},
+		ParseValue: func(v any) (any, error) {
+			if t, ok := v.(time.Time); ok {
+				return t, nil
+			}
+			if s, ok := v.(string); ok {
+				if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+					return t, nil
+				}
+			}
+			return nil, fmt.Errorf("DateTime cannot represent %s", describe(v))
+		},
+	}
+
+	// JSON is any JSON value, returned as the API's REST endpoints return it
+	JSON = &Scalar{
+		Name:        "JSON",
+		Description: "Any JSON value",
+		Serialize:   func(v any) (any, error) { return v, nil },
+		ParseValue:  func(v any) (any, error) { return v, nil },
+	}
+)
+
+// describe names a value in a coercion error
+func describe(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	case enumValue:
+		return string(v)
+	case []any, []value:
+		return "a list"
+	case map[string]any, map[string]value:
+		return "an object"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// PLATFORM ADMIN HANDLER
+// =====================================================
+
+type AdminHandler struct {
+	svc         *services.AdminService
+	flags       *services.FeatureFlagService
+	maintenance *services.MaintenanceService
+	wsStats     websocket.StatsReader
+	broadcaster websocket.Broadcaster
+	logger      *zap.Logger
+}
+
+func NewAdminHandler(svc *services.AdminService, flags *services.FeatureFlagService, maintenance *services.MaintenanceService, wsStats websocket.StatsReader, broadcaster websocket.Broadcaster, logger *zap.Logger) *AdminHandler {
+	return &AdminHandler{svc: svc, flags: flags, maintenance: maintenance, wsStats: wsStats, broadcaster: broadcaster, logger: logger}
+}
+
+// ListOrgs lists organizations across the platform
+func (h *AdminHandler) ListOrgs(c *gin.Context) {
+	var req services.AdminListOrgsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.svc.ListOrgs(c.Request.Context(), req, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list organizations", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list organizations")
+		return
+	}
+
+	respondPage(c, "data", orgs)
+}
+
+// LookupUsers finds users by email prefix
+func (h *AdminHandler) LookupUsers(c *gin.Context) {
+	var req services.AdminUserLookupRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+
+	users, err := h.svc.LookupUsers(c.Request.Context(), req)
+	if err != nil {
+		h.logger.Error("Failed to look up users", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to look up users")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": users})
+}
+
+// GetUser returns a user with their org memberships
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.svc.GetUser(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get user", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// DeactivateUser stops a user from using the API and revokes their tokens
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	adminID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID")
+		return
+	}
+	if userID == adminID {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "You can't deactivate yourself")
+		return
+	}
+
+	user, err := h.svc.DeactivateUser(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to deactivate user", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to deactivate user")
+		return
+	}
+
+	// Their subscriptions fail the re-check now that they are inactive
+	h.broadcaster.RevalidateAccess(userID)
+	c.JSON(http.StatusOK, user)
+}
+
+// ReactivateUser lets a deactivated user use the API again
+func (h *AdminHandler) ReactivateUser(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID")
+		return
+	}
+
+	user, err := h.svc.ReactivateUser(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to reactivate user", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to reactivate user")
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// ListExecutions lists agent executions across all orgs
+func (h *AdminHandler) ListExecutions(c *gin.Context) {
+	var req services.AdminListExecutionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	executions, err := h.svc.ListExecutions(c.Request.Context(), req, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list executions", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list executions")
+		return
+	}
+
+	respondPage(c, "data", executions)
+}
+
+// GetExecution returns any execution by ID
+func (h *AdminHandler) GetExecution(c *gin.Context) {
+	executionID, err := uuid.Parse(c.Param("executionId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid execution ID")
+		return
+	}
+
+	execution, err := h.svc.GetExecution(c.Request.Context(), executionID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Execution not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get execution", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get execution")
+		return
+	}
+
+	c.JSON(http.StatusOK, execution)
+}
+
+// MigrationStatus reports the schema_migrations version against the
+// migrations built into this instance
+func (h *AdminHandler) MigrationStatus(c *gin.Context) {
+	status, err := h.svc.MigrationStatus(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to get migration status", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get migration status")
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// MaintenanceStatus reports whether the API is in read-only mode
+func (h *AdminHandler) MaintenanceStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, h.maintenance.Status(c.Request.Context()))
+}
+
+// EnableMaintenanceRequest puts the API in read-only mode. message is shown
+// to clients whose writes are rejected; it defaults to a generic notice.
+type EnableMaintenanceRequest struct {
+	Message string `json:"message" binding:"max=500"`
+}
+
+// EnableMaintenance switches every instance into read-only mode. Instances
+// pick it up within a few seconds.
+func (h *AdminHandler) EnableMaintenance(c *gin.Context) {
+	var req EnableMaintenanceRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	if err := h.maintenance.Enable(c.Request.Context(), req.Message); err != nil {
+		h.logger.Error("Failed to enable maintenance mode", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to enable maintenance mode")
+		return
+	}
+	c.JSON(http.StatusOK, h.maintenance.Status(c.Request.Context()))
+}
+
+// DisableMaintenance returns every instance to normal operation. The
+// response still shows read-only mode while MAINTENANCE_MODE forces it.
+func (h *AdminHandler) DisableMaintenance(c *gin.Context) {
+	if err := h.maintenance.Disable(c.Request.Context()); err != nil {
+		h.logger.Error("Failed to disable maintenance mode", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to disable maintenance mode")
+		return
+	}
+	c.JSON(http.StatusOK, h.maintenance.Status(c.Request.Context()))
+}
+
+// AdminMessageRequest is a message from platform staff to a user
+type AdminMessageRequest struct {
+	Title string `json:"title" binding:"required,max=200"`
+	Body  string `json:"body" binding:"max=2000"`
+	Link  string `json:"link" binding:"max=500"`
+}
+
+// SendUserMessage delivers a message to a user's open connections, e.g. to
+// warn them of maintenance or follow up on a support case. It isn't stored:
+// users who aren't connected don't see it.
+func (h *AdminHandler) SendUserMessage(c *gin.Context) {
+	adminID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req AdminMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	_, err = h.svc.GetUser(c.Request.Context(), userID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get user", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get user")
+		return
+	}
+
+	h.broadcaster.SendUserMessage(userID, websocket.UserMessagePayload{
+		Kind:   websocket.UserMessageAdmin,
+		Title:  req.Title,
+		Body:   req.Body,
+		Link:   req.Link,
+		SentBy: adminID.String(),
+	})
+	c.Status(http.StatusAccepted)
+}
+
+// ListFeatureFlags lists all feature flags
+func (h *AdminHandler) ListFeatureFlags(c *gin.Context) {
+	flags, err := h.flags.List(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to list feature flags", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list feature flags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": flags})
+}
+
+// SetFeatureFlag creates or updates a feature flag
+func (h *AdminHandler) SetFeatureFlag(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.SetFeatureFlagRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	flag, err := h.flags.Set(c.Request.Context(), c.Param("flagKey"), req, userID)
+	if errors.Is(err, services.ErrInvalidFlagKey) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Flag keys must be lowercase letters, digits, '.', '_' or '-'")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to set feature flag", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to set feature flag")
+		return
+	}
+
+	c.JSON(http.StatusOK, flag)
+}
+
+// WebSocketStats reports real-time connection statistics for every API
+// instance, or only the one serving the request with ?scope=local
+func (h *AdminHandler) WebSocketStats(c *gin.Context) {
+	if c.Query("scope") == "local" {
+		c.JSON(http.StatusOK, gin.H{"data": []*websocket.HubStats{h.wsStats.Stats()}})
+		return
+	}
+
+	stats, err := h.wsStats.ClusterStats(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to get WebSocket stats", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get WebSocket stats")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": stats})
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// API KEY HANDLER
+// =====================================================
+
+type APIKeyHandler struct {
+	svc    *services.APIKeyService
+	logger *zap.Logger
+}
+
+func NewAPIKeyHandler(svc *services.APIKeyService, logger *zap.Logger) *APIKeyHandler {
+	return &APIKeyHandler{svc: svc, logger: logger}
+}
+
+func (h *APIKeyHandler) List(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	keys, err := h.svc.List(c.Request.Context(), orgID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list API keys", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list API keys")
+		return
+	}
+
+	respondPage(c, "data", keys)
+}
+
+// Create issues a key. The response carries the key itself; it can't be
+// read back later.
+func (h *APIKeyHandler) Create(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var req services.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	key, err := h.svc.Create(c.Request.Context(), orgID, userID, req)
+	if errors.Is(err, services.ErrInvalidScope) {
+		apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeBadRequest,
+			"Scopes must be permissions such as node:read", gin.H{"scopes": authz.RoleOwner.Permissions()})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidExpiry) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "expiresAt must be in the future")
+		return
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can't give a key a scope your role doesn't have")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to create API key", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create API key")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, key)
+}
+
+func (h *APIKeyHandler) Revoke(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("keyId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid API key ID")
+		return
+	}
+
+	err = h.svc.Revoke(c.Request.Context(), orgID, keyID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "API key not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to revoke API key", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke API key")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
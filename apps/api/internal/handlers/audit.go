@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// AUDIT HANDLER
+// =====================================================
+
+type AuditHandler struct {
+	svc    *services.AuditService
+	logger *zap.Logger
+}
+
+func NewAuditHandler(svc *services.AuditService, logger *zap.Logger) *AuditHandler {
+	return &AuditHandler{svc: svc, logger: logger}
+}
+
+// ListForOrg returns the request audit log for an organization
+func (h *AuditHandler) ListForOrg(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var filters services.ListAuditLogRequest
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	if filters.UserID != nil {
+		if _, err := uuid.Parse(*filters.UserID); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID filter")
+			return
+		}
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	entries, err := h.svc.ListForOrg(c.Request.Context(), orgID, filters, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list audit log", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list audit log")
+		return
+	}
+
+	respondPage(c, "data", entries)
+}
+
+// ListChangesForOrg returns the row changes the audit triggers recorded for
+// an organization
+func (h *AuditHandler) ListChangesForOrg(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var filters services.ListChangesRequest
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	if filters.ResourceID != nil {
+		if _, err := uuid.Parse(*filters.ResourceID); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid resource ID filter")
+			return
+		}
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	changes, err := h.svc.ListChangesForOrg(c.Request.Context(), orgID, filters, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list audit changes", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list audit changes")
+		return
+	}
+
+	respondPage(c, "data", changes)
+}
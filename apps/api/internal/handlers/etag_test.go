@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/services"
+)
+
+// bindWith runs bind against a request carrying an If-Match header
+func bindWith(bind func(*gin.Context) (services.Precondition, bool), ifMatch string) (services.Precondition, bool, int) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPatch, "/", nil)
+	if ifMatch != "" {
+		c.Request.Header.Set("If-Match", ifMatch)
+	}
+	p, ok := bind(c)
+	return p, ok, w.Code
+}
+
+func TestNodeETagMatchesAcrossLocks(t *testing.T) {
+	node := &models.Node{Version: 7, UpdatedAt: time.Now()}
+	read := nodeETag(node)
+
+	// Locking moves updated_at only
+	node.UpdatedAt = node.UpdatedAt.Add(time.Second)
+	if nodeETag(node) == read {
+		t.Fatal("ETag didn't change with updated_at, so If-None-Match would serve a stale node")
+	}
+
+	for _, tag := range []string{read, "W/" + read} {
+		p, ok, _ := bindWith(bindNodeIfMatch, tag)
+		if !ok {
+			t.Fatalf("If-Match %s rejected", tag)
+		}
+		if !p.MatchesVersion(node.Version) {
+			t.Fatalf("If-Match %s doesn't match the locked node", tag)
+		}
+		if p.MatchesVersion(node.Version + 1) {
+			t.Fatalf("If-Match %s matches a later version", tag)
+		}
+	}
+}
+
+func TestBindIfMatch(t *testing.T) {
+	updatedAt := time.Now().Truncate(time.Microsecond)
+	for _, tc := range []struct {
+		name    string
+		bind    func(*gin.Context) (services.Precondition, bool)
+		ifMatch string
+		ok      bool
+	}{
+		{"absent", bindIfMatch, "", true},
+		{"any", bindNodeIfMatch, "*", true},
+		{"timestamp", bindIfMatch, versionETag(updatedAt), true},
+		{"node tag for a timestamp", bindIfMatch, `"v3.abc"`, false},
+		{"timestamp for a node", bindNodeIfMatch, versionETag(updatedAt), false},
+		{"unquoted", bindNodeIfMatch, "v3.abc", false},
+		{"list", bindIfMatch, versionETag(updatedAt) + ", " + versionETag(updatedAt), false},
+	} {
+		p, ok, code := bindWith(tc.bind, tc.ifMatch)
+		if ok != tc.ok {
+			t.Fatalf("%s: ok = %v, want %v", tc.name, ok, tc.ok)
+		}
+		if !ok && code != http.StatusBadRequest {
+			t.Fatalf("%s: status = %d, want 400", tc.name, code)
+		}
+		if tc.name == "timestamp" && (p.UpdatedAt == nil || !p.UpdatedAt.Equal(updatedAt)) {
+			t.Fatalf("%s: UpdatedAt = %v, want %v", tc.name, p.UpdatedAt, updatedAt)
+		}
+	}
+}
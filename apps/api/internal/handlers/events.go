@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// DOMAIN EVENT HANDLER
+// =====================================================
+
+type EventHandler struct {
+	svc    *services.EventStore
+	logger *zap.Logger
+}
+
+func NewEventHandler(svc *services.EventStore, logger *zap.Logger) *EventHandler {
+	return &EventHandler{svc: svc, logger: logger}
+}
+
+// ReplayRequest selects the event to rebuild an aggregate's state at
+type ReplayRequest struct {
+	Sequence int `form:"sequence" binding:"omitempty,min=1"` // latest when omitted
+}
+
+// List returns a handler for the event history of the aggregate of
+// aggregateType whose ID is in the path parameter param
+func (h *EventHandler) List(aggregateType, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		aggregateID, err := uuid.Parse(c.Param(param))
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid "+aggregateType+" ID")
+			return
+		}
+
+		page, ok := bindPage(c)
+		if !ok {
+			return
+		}
+
+		events, err := h.svc.List(c.Request.Context(), aggregateType, aggregateID, page)
+		if errors.Is(err, pagination.ErrInvalidCursor) {
+			respondInvalidCursor(c)
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to list events", zap.Error(err))
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list events")
+			return
+		}
+
+		respondPage(c, "data", events)
+	}
+}
+
+// State returns a handler that rebuilds the state of the aggregate of
+// aggregateType whose ID is in the path parameter param from its events
+func (h *EventHandler) State(aggregateType, param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		aggregateID, err := uuid.Parse(c.Param(param))
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid "+aggregateType+" ID")
+			return
+		}
+
+		var req ReplayRequest
+		if err := c.ShouldBindQuery(&req); err != nil {
+			respondBindError(c, err, "Invalid query parameters")
+			return
+		}
+
+		state, err := h.svc.Replay(c.Request.Context(), aggregateType, aggregateID, req.Sequence)
+		if errors.Is(err, services.ErrNotFound) {
+			apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No events recorded")
+			return
+		}
+		if err != nil {
+			h.logger.Error("Failed to replay events", zap.Error(err))
+			apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to replay events")
+			return
+		}
+
+		c.JSON(http.StatusOK, state)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/graphql"
+	"github.com/glassbox/api/internal/services"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// GRAPHQL HANDLER
+// =====================================================
+
+// GraphQLHandler serves projects, nodes, their inputs and outputs, and
+// executions as one graph, so a view can load everything it renders in a
+// single request instead of a chain of REST calls
+type GraphQLHandler struct {
+	graph  *services.GraphService
+	logger *zap.Logger
+}
+
+func NewGraphQLHandler(graph *services.GraphService, logger *zap.Logger) *GraphQLHandler {
+	return &GraphQLHandler{graph: graph, logger: logger}
+}
+
+// Query executes a GraphQL query. Queries that don't parse or validate get
+// 400 with only errors; field errors come with 200 and the rest of the
+// data.
+func (h *GraphQLHandler) Query(c *gin.Context) {
+	var req graphql.Request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid GraphQL request")
+		return
+	}
+
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	resp := h.graph.Execute(c.Request.Context(), userID, c.ClientIP(), req)
+	status := http.StatusOK
+	if resp.Data == nil {
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, resp)
+}
+
+// Schema returns the schema in the GraphQL schema definition language, for
+// code generators and editor tooling
+func (h *GraphQLHandler) Schema(c *gin.Context) {
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(h.graph.SDL()))
+}
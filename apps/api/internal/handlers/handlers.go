@@ -1,45 +1,102 @@
 package handlers
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/buildinfo"
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/events"
 	"github.com/glassbox/api/internal/middleware"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/queue"
 	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/websocket"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 )
 
 // Handlers contains all HTTP handlers
 type Handlers struct {
-	Health     *HealthHandler
-	Auth       *AuthHandler
-	Orgs       *OrganizationHandler
-	Projects   *ProjectHandler
-	Nodes      *NodeHandler
-	Files      *FileHandler
-	Executions *ExecutionHandler
-	Templates  *TemplateHandler
-	Users      *UserHandler
-	Search     *SearchHandler
+	Health      *HealthHandler
+	Auth        *AuthHandler
+	Orgs        *OrganizationHandler
+	Members     *OrgMembersHandler
+	Invitations *InvitationHandler
+	APIKeys     *APIKeyHandler
+	Projects    *ProjectHandler
+	Nodes       *NodeHandler
+	Files       *FileHandler
+	Executions  *ExecutionHandler
+	Templates   *TemplateHandler
+	Users       *UserHandler
+	Search      *SearchHandler
+	Audit       *AuditHandler
+	IPAllowlist *IPAllowlistHandler
+	Webhooks    *WebhookHandler
+	Push        *PushHandler
+	Onboarding  *OnboardingHandler
+	Permissions *PermissionsHandler
+	Admin       *AdminHandler
+	Queues      *QueueHandler
+	Internal    *InternalHandler
+	Presence    *PresenceHandler
+	Metrics     *MetricsHandler
+	Events      *EventHandler
+	OpenAPI     *OpenAPIHandler
+	GraphQL     *GraphQLHandler
+	WorkerGRPC  *WorkerGRPC
 }
 
 // NewHandlers creates all handlers with their dependencies
-func NewHandlers(svc *services.Services, logger *zap.Logger) *Handlers {
+func NewHandlers(svc *services.Services, realtime websocket.Realtime, jobQueue queue.Queue, quarantine *queue.Quarantine, publisher *events.Publisher, logger *zap.Logger) *Handlers {
+	deadLetters, _ := jobQueue.(queue.DeadLetters)
+	queueStats, _ := jobQueue.(queue.StatsReader)
+	internal := NewInternalHandler(realtime, publisher, svc.Authz, svc.Notifications, logger)
 	return &Handlers{
-		Health:     NewHealthHandler(),
-		Auth:       NewAuthHandler(svc.Auth, logger),
-		Orgs:       NewOrganizationHandler(svc.Orgs, logger),
-		Projects:   NewProjectHandler(svc.Projects, logger),
-		Nodes:      NewNodeHandler(svc.Nodes, logger),
-		Files:      NewFileHandler(svc.Files, logger),
-		Executions: NewExecutionHandler(svc.Executions, logger),
-		Templates:  NewTemplateHandler(svc.Templates, logger),
-		Users:      NewUserHandler(svc.Users, logger),
-		Search:     NewSearchHandler(svc.Search, logger),
+		Health:      NewHealthHandler(queueStats, logger),
+		Auth:        NewAuthHandler(svc.Auth, logger),
+		Orgs:        NewOrganizationHandler(svc.Orgs, logger),
+		Members:     NewOrgMembersHandler(svc.Members, realtime, logger),
+		Invitations: NewInvitationHandler(svc.Invitations, realtime, logger),
+		APIKeys:     NewAPIKeyHandler(svc.APIKeys, logger),
+		Projects:    NewProjectHandler(svc.Projects, logger),
+		Nodes:       NewNodeHandler(svc.Nodes, logger),
+		Files:       NewFileHandler(svc.Files, logger),
+		Executions:  NewExecutionHandler(svc.Executions, logger),
+		Templates:   NewTemplateHandler(svc.Templates, logger),
+		Users:       NewUserHandler(svc.Users, svc.Digests, realtime, logger),
+		Search:      NewSearchHandler(svc.Search, logger),
+		Audit:       NewAuditHandler(svc.Audit, logger),
+		IPAllowlist: NewIPAllowlistHandler(svc.IPAllowlist, logger),
+		Webhooks:    NewWebhookHandler(svc.Webhooks, logger),
+		Push:        NewPushHandler(svc.WebPush, logger),
+		Onboarding:  NewOnboardingHandler(svc.Onboarding, logger),
+		Permissions: NewPermissionsHandler(svc.Authz, logger),
+		Admin:       NewAdminHandler(svc.Admin, svc.Flags, svc.Maintenance, realtime, realtime, logger),
+		Queues:      NewQueueHandler(deadLetters, quarantine, logger),
+		Internal:    internal,
+		WorkerGRPC:  NewWorkerGRPC(svc.WorkerState, internal, logger),
+		Presence:    NewPresenceHandler(realtime, logger),
+		Events:      NewEventHandler(svc.Events, logger),
+		OpenAPI:     NewOpenAPIHandler(logger),
+		GraphQL:     NewGraphQLHandler(svc.Graph, logger),
 	}
 }
 
@@ -47,19 +104,299 @@ func NewHandlers(svc *services.Services, logger *zap.Logger) *Handlers {
 // HEALTH HANDLER
 // =====================================================
 
-type HealthHandler struct{}
+// Dependency checks are cached so load balancer and orchestrator probes
+// don't turn into a stream of database, S3 and SQS calls
+const (
+	healthTTL     = 10 * time.Second
+	healthTimeout = 3 * time.Second
+)
+
+// What stops working while the job queues are unreachable
+const queuesDownImpact = "Agent runs and file uploads can't be queued"
+
+// HealthCheck reports whether a dependency is reachable
+type HealthCheck func(ctx context.Context) error
+
+// HealthHandler serves the liveness and readiness probes, and the info
+// endpoint for clients and incident triage. The API is live while it can
+// serve requests at all, and ready when it can reach its dependencies: the
+// database, Redis, S3 and its job queues.
+type HealthHandler struct {
+	queues    queue.StatsReader
+	logger    *zap.Logger
+	startedAt time.Time
+
+	checks     []namedCheck
+	migrations func(ctx context.Context) (*database.MigrationStatus, error)
+	replicas   func() (configured, inService int)
+	draining   atomic.Bool
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	healthy   bool
+	report    gin.H
+	queueInfo gin.H
+
+	migrationAt time.Time
+	migration   gin.H
+}
+
+type namedCheck struct {
+	name  string
+	check HealthCheck
+	// impact describes what stops working while the dependency is down;
+	// empty for dependencies the API can't serve requests without
+	impact string
+}
+
+func NewHealthHandler(queues queue.StatsReader, logger *zap.Logger) *HealthHandler {
+	return &HealthHandler{queues: queues, logger: logger, startedAt: time.Now()}
+}
+
+// AddCheck adds a dependency the API can't serve requests without to the
+// readiness check. Not safe to call once the server is running.
+func (h *HealthHandler) AddCheck(name string, check HealthCheck) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check})
+}
+
+// AddDegradableCheck adds a dependency the API keeps serving without, minus
+// what impact describes. Readiness still fails while it's down; the info
+// endpoint reports the API as degraded rather than unhealthy.
+func (h *HealthHandler) AddDegradableCheck(name string, check HealthCheck, impact string) {
+	h.checks = append(h.checks, namedCheck{name: name, check: check, impact: impact})
+}
+
+// SetMigrationStatus sets how the info endpoint reads the schema version
+func (h *HealthHandler) SetMigrationStatus(status func(ctx context.Context) (*database.MigrationStatus, error)) {
+	h.migrations = status
+}
 
-func NewHealthHandler() *HealthHandler {
-	return &HealthHandler{}
+// SetReplicaStatus sets how the info endpoint counts read replicas in
+// service
+func (h *HealthHandler) SetReplicaStatus(status func() (configured, inService int)) {
+	h.replicas = status
 }
 
-func (h *HealthHandler) Check(c *gin.Context) {
+// Drain makes the readiness check fail from now on, so load balancers stop
+// sending requests while the server shuts down
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so an outage elsewhere doesn't get healthy instances
+// restarted.
+func (h *HealthHandler) Live(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "healthy",
 		"service": "glassbox-api",
 	})
 }
 
+// Ready reports each dependency's status and latency, with a 503 if any is
+// unreachable or the server is shutting down
+func (h *HealthHandler) Ready(c *gin.Context) {
+	if h.draining.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{
+			"status":  "draining",
+			"service": "glassbox-api",
+		})
+		return
+	}
+
+	healthy, checks, queues := h.dependencyHealth(c.Request.Context())
+
+	status, code := "healthy", http.StatusOK
+	if !healthy {
+		status, code = "unhealthy", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{
+		"status":  status,
+		"service": "glassbox-api",
+		"checks":  checks,
+		"queues":  queues,
+	})
+}
+
+// Info reports the build, uptime, schema version and each dependency's
+// health, with what's degraded while dependencies are down. It always
+// returns 200: status is healthy, degraded (serving with reduced function),
+// unhealthy (a dependency requests can't do without is down) or draining.
+func (h *HealthHandler) Info(c *gin.Context) {
+	ctx := c.Request.Context()
+	_, checks, queues := h.dependencyHealth(ctx)
+	migrations := h.migrationInfo(ctx)
+
+	type degradation struct {
+		Dependency string `json:"dependency"`
+		Impact     string `json:"impact"`
+	}
+	degraded := []degradation{}
+	unhealthy := false
+	for _, nc := range h.checks {
+		if entry, _ := checks[nc.name].(gin.H); entry["status"] == "ok" {
+			continue
+		}
+		if nc.impact == "" {
+			unhealthy = true
+			degraded = append(degraded, degradation{nc.name, "Requests that read or write data fail"})
+			continue
+		}
+		degraded = append(degraded, degradation{nc.name, nc.impact})
+	}
+	for _, name := range slices.Sorted(maps.Keys(queues)) {
+		if entry, _ := queues[name].(gin.H); entry["status"] != "ok" {
+			degraded = append(degraded, degradation{"queue:" + name, queuesDownImpact})
+		}
+	}
+	switch {
+	case migrations["dirty"] == true:
+		degraded = append(degraded, degradation{"migrations", "A migration failed part-way; the schema may not match this build"})
+	case migrations["pending"] != nil && migrations["pending"] != 0:
+		degraded = append(degraded, degradation{"migrations", "The schema is behind this build; features that need the pending migrations fail"})
+	}
+
+	resp := gin.H{
+		"service":       "glassbox-api",
+		"build":         buildinfo.Get(),
+		"startedAt":     h.startedAt.UTC(),
+		"uptimeSeconds": int64(time.Since(h.startedAt).Seconds()),
+		"migrations":    migrations,
+		"checks":        checks,
+		"queues":        queues,
+	}
+	if h.replicas != nil {
+		if configured, inService := h.replicas(); configured > 0 {
+			resp["readReplicas"] = gin.H{"configured": configured, "inService": inService}
+			if inService == 0 {
+				degraded = append(degraded, degradation{"readReplicas", "Lists, search and traces read from the primary"})
+			}
+		}
+	}
+
+	status := "healthy"
+	switch {
+	case h.draining.Load():
+		status = "draining"
+	case unhealthy:
+		status = "unhealthy"
+	case len(degraded) > 0:
+		status = "degraded"
+	}
+	resp["status"] = status
+	resp["degraded"] = degraded
+	c.JSON(http.StatusOK, resp)
+}
+
+// migrationInfo reports the database's schema version against this build's
+// migrations, cached like the dependency checks
+func (h *HealthHandler) migrationInfo(ctx context.Context) gin.H {
+	if h.migrations == nil {
+		return gin.H{"status": "unknown"}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.migrationAt) < healthTTL {
+		return h.migration
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+	status, err := h.migrations(ctx)
+	if err != nil {
+		h.logger.Error("Failed to read migration status", zap.Error(err))
+		h.migrationAt, h.migration = time.Now(), gin.H{"status": "unknown"}
+		return h.migration
+	}
+	h.migrationAt = time.Now()
+	h.migration = gin.H{
+		"version": status.Version,
+		"latest":  status.Latest,
+		"pending": len(status.Pending),
+		"dirty":   status.Dirty,
+	}
+	return h.migration
+}
+
+// dependencyHealth runs the dependency and queue checks concurrently, or
+// returns the last results if they're recent
+func (h *HealthHandler) dependencyHealth(ctx context.Context) (bool, gin.H, gin.H) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.checkedAt) < healthTTL {
+		return h.healthy, h.report, h.queueInfo
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	healthy := true
+	report := gin.H{}
+	for _, c := range h.checks {
+		wg.Add(1)
+		go func(c namedCheck) {
+			defer wg.Done()
+			start := time.Now()
+			err := c.check(ctx)
+			entry := gin.H{"status": "ok", "latencyMs": time.Since(start).Milliseconds()}
+			if err != nil {
+				// Details stay in the logs; the endpoint is public
+				h.logger.Error("Health check failed", zap.String("dependency", c.name), zap.Error(err))
+				entry["status"] = "unreachable"
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			report[c.name] = entry
+			healthy = healthy && err == nil
+		}(c)
+	}
+	var queuesHealthy bool
+	var queues gin.H
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		queuesHealthy, queues = h.queueHealth(ctx)
+	}()
+	wg.Wait()
+	healthy = healthy && queuesHealthy
+
+	h.checkedAt, h.healthy, h.report, h.queueInfo = time.Now(), healthy, report, queues
+	return healthy, report, queues
+}
+
+// queueHealth reports each job queue's depth, or that it is unreachable
+func (h *HealthHandler) queueHealth(ctx context.Context) (bool, gin.H) {
+	if h.queues == nil {
+		return true, gin.H{}
+	}
+
+	healthy := true
+	report := gin.H{}
+	for _, name := range []string{queue.AgentJobs, queue.AgentBatchJobs, queue.FileJobs} {
+		start := time.Now()
+		stats, err := h.queues.QueueStats(ctx, name)
+		if err != nil {
+			h.logger.Error("Queue health check failed", zap.String("queue", name), zap.Error(err))
+			healthy = false
+			report[name] = gin.H{"status": "unreachable", "latencyMs": time.Since(start).Milliseconds()}
+			continue
+		}
+		entry := gin.H{
+			"status":    "ok",
+			"latencyMs": time.Since(start).Milliseconds(),
+			"depth":     stats.Depth,
+			"inFlight":  stats.InFlight,
+		}
+		if stats.OldestAge != nil {
+			entry["oldestMessageAgeSeconds"] = int64(stats.OldestAge.Seconds())
+		}
+		report[name] = entry
+	}
+	return healthy, report
+}
+
 // =====================================================
 // AUTH HANDLER
 // =====================================================
@@ -83,14 +420,18 @@ type DevTokenRequest struct {
 func (h *AuthHandler) GenerateDevToken(c *gin.Context) {
 	var req DevTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	token, expiresAt, err := h.svc.GenerateDevToken(c.Request.Context(), req.UserID, req.Email)
+	if errors.Is(err, config.ErrJWTSigningKeyMissing) {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeNotConfigured, "This instance cannot issue tokens")
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to generate dev token", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -103,7 +444,7 @@ func (h *AuthHandler) GenerateDevToken(c *gin.Context) {
 func (h *AuthHandler) GetWSToken(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
@@ -116,7 +457,7 @@ func (h *AuthHandler) GetWSToken(c *gin.Context) {
 	token, expiresAt, err := h.svc.GenerateWSToken(c.Request.Context(), userID.String(), userEmail)
 	if err != nil {
 		h.logger.Error("Failed to generate WS token", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate token")
 		return
 	}
 
@@ -142,37 +483,46 @@ func NewOrganizationHandler(svc *services.OrganizationService, logger *zap.Logge
 func (h *OrganizationHandler) List(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
-	orgs, err := h.svc.ListByUser(c.Request.Context(), userID)
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	orgs, err := h.svc.ListByUser(c.Request.Context(), userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to list organizations", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list organizations"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list organizations")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": orgs})
+	respondPage(c, "data", orgs)
 }
 
 func (h *OrganizationHandler) Create(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	var req services.CreateOrgRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	org, err := h.svc.Create(c.Request.Context(), req, userID)
 	if err != nil {
 		h.logger.Error("Failed to create organization", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create organization"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create organization")
 		return
 	}
 
@@ -182,96 +532,121 @@ func (h *OrganizationHandler) Create(c *gin.Context) {
 func (h *OrganizationHandler) Get(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
 	org, err := h.svc.GetByID(c.Request.Context(), orgID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get organization", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get organization"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get organization")
 		return
 	}
 
-	c.JSON(http.StatusOK, org)
+	respondWithETag(c, versionETag(org.UpdatedAt), org)
 }
 
 func (h *OrganizationHandler) Update(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
 	var req services.UpdateOrgRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+	ifMatch, ok := bindIfMatch(c)
+	if !ok {
 		return
 	}
+	req.IfMatch = ifMatch
 
 	org, err := h.svc.Update(c.Request.Context(), orgID, userID, req)
+	if errors.Is(err, services.ErrInvalidOrigin) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Allowed origins must be http(s)://host[:port]")
+		return
+	}
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Organization not found")
 		return
 	}
-	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+	if errors.Is(err, services.ErrVersionConflict) {
+		respondVersionConflict(c, "Organization")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to update organization", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update organization"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update organization")
 		return
 	}
 
+	c.Header("ETag", versionETag(org.UpdatedAt))
 	c.JSON(http.StatusOK, org)
 }
 
 func (h *OrganizationHandler) Delete(c *gin.Context) {
-	userID, err := getUserUUID(c)
+	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
-	orgID, err := uuid.Parse(c.Param("orgId"))
+	err = h.svc.Delete(c.Request.Context(), orgID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Organization not found")
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		h.logger.Error("Failed to delete organization", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete organization")
 		return
 	}
 
-	err = h.svc.Delete(c.Request.Context(), orgID, userID)
-	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Organization not found"})
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// SearchMembers finds org members by name or email prefix, for assignee
+// pickers and @-mention autocomplete
+func (h *OrganizationHandler) SearchMembers(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
-	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+
+	var req services.SearchMembersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
 		return
 	}
+
+	members, err := h.svc.SearchMembers(c.Request.Context(), orgID, req)
 	if err != nil {
-		h.logger.Error("Failed to delete organization", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete organization"})
+		h.logger.Error("Failed to search members", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to search members")
 		return
 	}
 
-	c.JSON(http.StatusNoContent, nil)
+	c.JSON(http.StatusOK, gin.H{"data": members})
 }
 
 // =====================================================
@@ -290,57 +665,77 @@ func NewProjectHandler(svc *services.ProjectService, logger *zap.Logger) *Projec
 func (h *ProjectHandler) List(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	projects, err := h.svc.ListByOrg(c.Request.Context(), orgID, userID)
+	projects, err := h.svc.ListByOrg(c.Request.Context(), orgID, userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to list projects", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list projects"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list projects")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": projects})
+	respondPage(c, "data", projects)
 }
 
 func (h *ProjectHandler) Create(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
 	var req services.CreateProjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	project, err := h.svc.Create(c.Request.Context(), orgID, userID, req)
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+	if errors.Is(err, services.ErrUnresolvedTemplate) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Template not found or not available to this organization")
+		return
+	}
+	if errors.Is(err, services.ErrTemplateNesting) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Template sub-nodes nest too deeply or form a cycle")
+		return
+	}
+	if respondTemplateValuesError(c, err, "templateValues") {
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to create project", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create project"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create project")
 		return
 	}
 
@@ -350,88 +745,94 @@ func (h *ProjectHandler) Create(c *gin.Context) {
 func (h *ProjectHandler) Get(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	projectID, err := uuid.Parse(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid project ID")
 		return
 	}
 
 	project, err := h.svc.GetByID(c.Request.Context(), projectID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Project not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get project", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get project"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get project")
 		return
 	}
 
-	c.JSON(http.StatusOK, project)
+	respondWithETag(c, versionETag(project.UpdatedAt), project)
 }
 
 func (h *ProjectHandler) Update(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	projectID, err := uuid.Parse(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid project ID")
 		return
 	}
 
 	var req services.UpdateProjectRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+	ifMatch, ok := bindIfMatch(c)
+	if !ok {
 		return
 	}
+	req.IfMatch = ifMatch
 
 	project, err := h.svc.Update(c.Request.Context(), projectID, userID, req)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Project not found")
+		return
+	}
+	if errors.Is(err, services.ErrVersionConflict) {
+		respondVersionConflict(c, "Project")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to update project", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update project"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update project")
 		return
 	}
 
+	c.Header("ETag", versionETag(project.UpdatedAt))
 	c.JSON(http.StatusOK, project)
 }
 
 func (h *ProjectHandler) Delete(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	projectID, err := uuid.Parse(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid project ID")
 		return
 	}
 
 	err = h.svc.Delete(c.Request.Context(), projectID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Project not found"})
-		return
-	}
-	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Project not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to delete project", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete project"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete project")
 		return
 	}
 
@@ -454,63 +855,67 @@ func NewNodeHandler(svc *services.NodeService, logger *zap.Logger) *NodeHandler
 func (h *NodeHandler) List(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	projectID, err := uuid.Parse(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid project ID")
 		return
 	}
 
 	var filters services.ListNodesRequest
 	if err := c.ShouldBindQuery(&filters); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid query parameters"})
+		respondBindError(c, err, "Invalid query parameters")
 		return
 	}
 
 	nodes, err := h.svc.ListByProject(c.Request.Context(), projectID, userID, filters)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to list nodes", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list nodes"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list nodes")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": nodes})
+	respondPage(c, "data", nodes)
 }
 
 func (h *NodeHandler) Create(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	projectID, err := uuid.Parse(c.Param("projectId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid project ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid project ID")
 		return
 	}
 
 	var req services.CreateNodeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	node, err := h.svc.Create(c.Request.Context(), projectID, userID, req)
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to create node", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create node"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create node")
 		return
 	}
 
@@ -520,88 +925,98 @@ func (h *NodeHandler) Create(c *gin.Context) {
 func (h *NodeHandler) Get(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	node, err := h.svc.GetByID(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get node", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get node"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get node")
 		return
 	}
 
-	c.JSON(http.StatusOK, node)
+	respondWithETag(c, nodeETag(node), node)
 }
 
 func (h *NodeHandler) Update(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	var req services.UpdateNodeRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+	ifMatch, ok := bindNodeIfMatch(c)
+	if !ok {
 		return
 	}
+	req.IfMatch = ifMatch
 
 	node, err := h.svc.Update(c.Request.Context(), nodeID, userID, req)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if errors.Is(err, services.ErrLockConflict) {
-		c.JSON(http.StatusConflict, gin.H{"error": "Node is locked by another user"})
+		apierror.Respond(c, http.StatusConflict, apierror.CodeResourceLocked, "Node is locked by another user")
+		return
+	}
+	if errors.Is(err, services.ErrVersionConflict) {
+		respondVersionConflict(c, "Node")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to update node", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update node"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update node")
 		return
 	}
 
+	c.Header("ETag", nodeETag(node))
 	c.JSON(http.StatusOK, node)
 }
 
 func (h *NodeHandler) Delete(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	err = h.svc.Delete(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to delete node", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete node"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete node")
 		return
 	}
 
@@ -611,57 +1026,66 @@ func (h *NodeHandler) Delete(c *gin.Context) {
 func (h *NodeHandler) ListVersions(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	versions, err := h.svc.ListVersions(c.Request.Context(), nodeID, userID)
+	versions, err := h.svc.ListVersions(c.Request.Context(), nodeID, userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to list versions", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list versions"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list versions")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": versions})
+	respondPage(c, "data", versions)
 }
 
 func (h *NodeHandler) GetVersion(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	var version int
 	if _, err := fmt.Sscanf(c.Param("version"), "%d", &version); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version number"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid version number")
 		return
 	}
 
 	nodeVersion, err := h.svc.GetVersion(c.Request.Context(), nodeID, userID, version)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Version not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get version", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get version"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get version")
 		return
 	}
 
@@ -671,30 +1095,30 @@ func (h *NodeHandler) GetVersion(c *gin.Context) {
 func (h *NodeHandler) Rollback(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	var version int
 	if _, err := fmt.Sscanf(c.Param("version"), "%d", &version); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid version number"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid version number")
 		return
 	}
 
 	node, err := h.svc.Rollback(c.Request.Context(), nodeID, userID, version)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Version not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to rollback", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rollback"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to rollback")
 		return
 	}
 
@@ -704,30 +1128,30 @@ func (h *NodeHandler) Rollback(c *gin.Context) {
 func (h *NodeHandler) AddInput(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	var req services.AddInputRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	input, err := h.svc.AddInput(c.Request.Context(), nodeID, userID, req)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to add input", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add input"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add input")
 		return
 	}
 
@@ -737,30 +1161,30 @@ func (h *NodeHandler) AddInput(c *gin.Context) {
 func (h *NodeHandler) RemoveInput(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	inputID, err := uuid.Parse(c.Param("inputId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid input ID")
 		return
 	}
 
 	err = h.svc.RemoveInput(c.Request.Context(), nodeID, inputID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Input not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Input not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to remove input", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove input"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove input")
 		return
 	}
 
@@ -770,30 +1194,30 @@ func (h *NodeHandler) RemoveInput(c *gin.Context) {
 func (h *NodeHandler) AddOutput(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	var req services.AddOutputRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	output, err := h.svc.AddOutput(c.Request.Context(), nodeID, userID, req)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to add output", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add output"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add output")
 		return
 	}
 
@@ -803,30 +1227,30 @@ func (h *NodeHandler) AddOutput(c *gin.Context) {
 func (h *NodeHandler) RemoveOutput(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	outputID, err := uuid.Parse(c.Param("outputId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid output ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid output ID")
 		return
 	}
 
 	err = h.svc.RemoveOutput(c.Request.Context(), nodeID, outputID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Output not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Output not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to remove output", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove output"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove output")
 		return
 	}
 
@@ -836,78 +1260,96 @@ func (h *NodeHandler) RemoveOutput(c *gin.Context) {
 func (h *NodeHandler) ListChildren(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
-	children, err := h.svc.ListChildren(c.Request.Context(), nodeID, userID)
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	children, err := h.svc.ListChildren(c.Request.Context(), nodeID, userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to list children", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list children"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list children")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": children})
+	respondPage(c, "data", children)
 }
 
 func (h *NodeHandler) ListDependencies(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	deps, err := h.svc.ListDependencies(c.Request.Context(), nodeID, userID)
+	deps, err := h.svc.ListDependencies(c.Request.Context(), nodeID, userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to list dependencies", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list dependencies"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list dependencies")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": deps})
+	respondPage(c, "data", deps)
 }
 
 func (h *NodeHandler) AcquireLock(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	err = h.svc.AcquireLock(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrLockConflict) {
-		c.JSON(http.StatusConflict, gin.H{"error": "Node is locked by another user"})
+		apierror.Respond(c, http.StatusConflict, apierror.CodeResourceLocked, "Node is locked by another user")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to acquire lock", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to acquire lock"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to acquire lock")
 		return
 	}
 
@@ -917,24 +1359,24 @@ func (h *NodeHandler) AcquireLock(c *gin.Context) {
 func (h *NodeHandler) ReleaseLock(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	err = h.svc.ReleaseLock(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Lock not found or not owned by you"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Lock not found or not owned by you")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to release lock", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to release lock"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to release lock")
 		return
 	}
 
@@ -958,26 +1400,26 @@ func NewFileHandler(svc *services.FileService, logger *zap.Logger) *FileHandler
 func (h *FileHandler) GetUploadURL(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
 	var req services.UploadURLRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	resp, err := h.svc.GetUploadURL(c.Request.Context(), orgID, userID, req)
 	if err != nil {
 		h.logger.Error("Failed to get upload URL", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate upload URL"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to generate upload URL")
 		return
 	}
 
@@ -988,28 +1430,32 @@ func (h *FileHandler) GetUploadURL(c *gin.Context) {
 func (h *FileHandler) ConfirmUpload(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	fileID, err := uuid.Parse(c.Param("fileId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid file ID")
 		return
 	}
 
 	file, err := h.svc.ConfirmUpload(c.Request.Context(), fileID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "File not found")
+		return
+	}
+	if errors.Is(err, services.ErrVersionConflict) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeInvalidState, "File upload has already been confirmed")
 		return
 	}
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to confirm upload", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to confirm upload")
 		return
 	}
 
@@ -1020,60 +1466,64 @@ func (h *FileHandler) ConfirmUpload(c *gin.Context) {
 func (h *FileHandler) Get(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	fileID, err := uuid.Parse(c.Param("fileId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid file ID")
 		return
 	}
 
 	file, err := h.svc.GetByID(c.Request.Context(), fileID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "File not found")
 		return
 	}
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get file", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get file"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get file")
 		return
 	}
 
-	c.JSON(http.StatusOK, file)
+	// Files have no updated_at; processing status is what changes. The presigned
+	// download URL lives for an hour, so the tag also rolls over every 30 minutes
+	// to stop clients revalidating onto an expired URL.
+	window := strconv.FormatInt(time.Now().Unix()/int64((30*time.Minute).Seconds()), 10)
+	respondWithETag(c, weakETag(file.ID.String(), file.ProcessingStatus, file.CreatedAt.UTC().Format(time.RFC3339Nano), window), file)
 }
 
 // Delete deletes a file from S3 and the database
 func (h *FileHandler) Delete(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	fileID, err := uuid.Parse(c.Param("fileId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid file ID")
 		return
 	}
 
 	err = h.svc.Delete(c.Request.Context(), fileID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "File not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "File not found")
 		return
 	}
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to delete file", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete file"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete file")
 		return
 	}
 
@@ -1093,32 +1543,49 @@ func NewExecutionHandler(svc *services.ExecutionServiceFull, logger *zap.Logger)
 	return &ExecutionHandler{svc: svc, logger: logger}
 }
 
+// StartExecutionRequest is the optional body of Start. Batch executions go
+// to their own agent queue, so they never delay interactive ones. AgentConfig
+// overrides the node's for this execution only.
+type StartExecutionRequest struct {
+	Priority    string              `json:"priority" binding:"omitempty,oneof=interactive batch"`
+	AgentConfig *models.AgentConfig `json:"agentConfig"`
+}
+
 // Start starts a new agent execution for a node
 func (h *ExecutionHandler) Start(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
-	execution, err := h.svc.Start(c.Request.Context(), nodeID, userID)
+	var req StartExecutionRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	execution, err := h.svc.Start(c.Request.Context(), nodeID, userID, req.Priority, req.AgentConfig)
+	if respondTemplateStructureError(c, err, "Invalid agent config") {
+		return
+	}
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if errors.Is(err, services.ErrExecutionAlreadyActive) {
-		c.JSON(http.StatusConflict, gin.H{"error": "An execution is already running for this node"})
+		apierror.Respond(c, http.StatusConflict, apierror.CodeExecutionInProgress, "An execution is already running for this node")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to start execution", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start execution"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to start execution")
 		return
 	}
 
@@ -1129,56 +1596,79 @@ func (h *ExecutionHandler) Start(c *gin.Context) {
 func (h *ExecutionHandler) GetCurrent(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	execution, err := h.svc.GetCurrentForNode(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active execution found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No active execution found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get current execution", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get execution"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get execution")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"execution": execution})
 }
 
+// EffectiveConfig returns the agent config a new execution of a node would
+// run with, and the layer each setting comes from
+func (h *ExecutionHandler) EffectiveConfig(c *gin.Context) {
+	nodeID, err := uuid.Parse(c.Param("nodeId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
+		return
+	}
+
+	config, err := h.svc.EffectiveConfig(c.Request.Context(), nodeID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to resolve agent config", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to resolve agent config")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"agentConfig": config})
+}
+
 // Pause pauses a running execution
 func (h *ExecutionHandler) Pause(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	err = h.svc.Pause(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active execution found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No active execution found")
 		return
 	}
 	if errors.Is(err, services.ErrExecutionNotPausable) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Execution cannot be paused in its current state"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Execution cannot be paused in its current state")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to pause execution", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to pause execution"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to pause execution")
 		return
 	}
 
@@ -1189,28 +1679,28 @@ func (h *ExecutionHandler) Pause(c *gin.Context) {
 func (h *ExecutionHandler) Resume(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	err = h.svc.Resume(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No paused execution found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No paused execution found")
 		return
 	}
 	if errors.Is(err, services.ErrExecutionNotResumable) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Execution cannot be resumed in its current state"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Execution cannot be resumed in its current state")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to resume execution", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume execution"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to resume execution")
 		return
 	}
 
@@ -1221,28 +1711,28 @@ func (h *ExecutionHandler) Resume(c *gin.Context) {
 func (h *ExecutionHandler) Cancel(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	err = h.svc.Cancel(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active execution found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No active execution found")
 		return
 	}
 	if errors.Is(err, services.ErrExecutionNotCancellable) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Execution cannot be cancelled in its current state"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Execution cannot be cancelled in its current state")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to cancel execution", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel execution"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to cancel execution")
 		return
 	}
 
@@ -1253,24 +1743,24 @@ func (h *ExecutionHandler) Cancel(c *gin.Context) {
 func (h *ExecutionHandler) Get(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	executionID, err := uuid.Parse(c.Param("executionId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid execution ID")
 		return
 	}
 
 	execution, err := h.svc.GetByIDWithHumanInput(c.Request.Context(), executionID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Execution not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get execution", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get execution"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get execution")
 		return
 	}
 
@@ -1281,28 +1771,37 @@ func (h *ExecutionHandler) Get(c *gin.Context) {
 func (h *ExecutionHandler) GetTrace(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	executionID, err := uuid.Parse(c.Param("executionId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid execution ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
 		return
 	}
 
-	events, err := h.svc.GetTrace(c.Request.Context(), executionID, userID)
+	events, err := h.svc.GetTrace(c.Request.Context(), executionID, userID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Execution not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get trace", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get trace"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get trace")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"events": events})
+	respondPage(c, "events", events)
 }
 
 // ProvideInputRequest for human input
@@ -1314,164 +1813,328 @@ type ProvideInputRequest struct {
 func (h *ExecutionHandler) ProvideInput(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	executionID, err := uuid.Parse(c.Param("executionId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid execution ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid execution ID")
 		return
 	}
 
 	var req ProvideInputRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	err = h.svc.ProvideInput(c.Request.Context(), executionID, userID, req.Input)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Execution not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Execution not found")
 		return
 	}
 	if errors.Is(err, services.ErrExecutionNotAwaitingInput) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Execution is not awaiting input"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Execution is not awaiting input")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to provide input", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to provide input"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to provide input")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Input received, execution resuming"})
 }
 
-// =====================================================
-// TEMPLATE HANDLER
-// =====================================================
-
-type TemplateHandler struct {
-	svc    *services.TemplateService
-	logger *zap.Logger
-}
-
-func NewTemplateHandler(svc *services.TemplateService, logger *zap.Logger) *TemplateHandler {
-	return &TemplateHandler{svc: svc, logger: logger}
-}
-
-func (h *TemplateHandler) ListPublic(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"data": []any{}}) }
-func (h *TemplateHandler) Get(c *gin.Context)        { c.JSON(http.StatusOK, gin.H{}) }
-func (h *TemplateHandler) Apply(c *gin.Context)      { c.JSON(http.StatusCreated, gin.H{}) }
-
 // =====================================================
 // USER HANDLER
 // =====================================================
 
 type UserHandler struct {
-	svc    *services.UserService
-	logger *zap.Logger
+	svc         *services.UserService
+	digests     *services.DigestService
+	broadcaster websocket.Broadcaster
+	logger      *zap.Logger
 }
 
-func NewUserHandler(svc *services.UserService, logger *zap.Logger) *UserHandler {
-	return &UserHandler{svc: svc, logger: logger}
+func NewUserHandler(svc *services.UserService, digests *services.DigestService, broadcaster websocket.Broadcaster, logger *zap.Logger) *UserHandler {
+	return &UserHandler{svc: svc, digests: digests, broadcaster: broadcaster, logger: logger}
 }
 
 func (h *UserHandler) GetMe(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	user, err := h.svc.GetByID(c.Request.Context(), userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get user")
 		return
 	}
 
-	c.JSON(http.StatusOK, user)
+	respondWithETag(c, versionETag(user.UpdatedAt), user)
 }
 
 func (h *UserHandler) UpdateMe(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	var req services.UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
+	ifMatch, ok := bindIfMatch(c)
+	if !ok {
+		return
+	}
+	req.IfMatch = ifMatch
 
 	user, err := h.svc.Update(c.Request.Context(), userID, req)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+		return
+	}
+	if errors.Is(err, services.ErrVersionConflict) {
+		respondVersionConflict(c, "User")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to update user", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update user")
 		return
 	}
 
+	c.Header("ETag", versionETag(user.UpdatedAt))
 	c.JSON(http.StatusOK, user)
 }
 
+// DeleteMe deletes the current user's account. The optional body names a
+// member to take over their nodes.
+func (h *UserHandler) DeleteMe(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	deletion, err := h.svc.DeleteAccount(c.Request.Context(), userID, req)
+	var soleOwner *services.SoleOwnerError
+	if errors.As(err, &soleOwner) {
+		apierror.RespondWithDetails(c, http.StatusConflict, apierror.CodeSoleOwner,
+			"Make someone else an owner of these organizations, or delete them, first", gin.H{"orgs": soleOwner.Orgs})
+		return
+	}
+	if errors.Is(err, services.ErrInvalidReassignTarget) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "reassignTo must be another active member of every organization you have nodes in")
+		return
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "User not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete account", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete account")
+		return
+	}
+
+	for _, m := range deletion.Memberships {
+		h.broadcaster.RevokeMembership(m.OrgID, userID)
+		h.broadcaster.BroadcastMembershipChanged(m.OrgID, userID, "removed", m.Role, userID.String())
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"removedMemberships": len(deletion.Memberships),
+		"reassignedNodes":    deletion.ReassignedNodes,
+	})
+}
+
 func (h *UserHandler) ListNotifications(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	unreadOnly := c.Query("unread") == "true"
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
 
-	notifications, err := h.svc.ListNotifications(c.Request.Context(), userID, unreadOnly)
+	notifications, err := h.svc.ListNotifications(c.Request.Context(), userID, unreadOnly, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to list notifications", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list notifications"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list notifications")
+		return
+	}
+
+	respondPage(c, "data", notifications)
+}
+
+// ListActivity returns the user's own recent edits, executions and uploads
+// across their orgs
+func (h *UserHandler) ListActivity(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.ListActivityRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"data": notifications})
+	activity, err := h.svc.ListActivity(c.Request.Context(), userID, req)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list activity", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list activity")
+		return
+	}
+
+	respondPage(c, "data", activity)
+}
+
+// ListMentions returns the places the current user was @mentioned, newest
+// first
+func (h *UserHandler) ListMentions(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.ListMentionsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+
+	mentions, err := h.svc.ListMentions(c.Request.Context(), userID, req)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list mentions", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list mentions")
+		return
+	}
+
+	respondPage(c, "data", mentions)
 }
 
 func (h *UserHandler) MarkNotificationRead(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	notificationID, err := uuid.Parse(c.Param("notificationId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid notification ID")
 		return
 	}
 
 	err = h.svc.MarkNotificationRead(c.Request.Context(), userID, notificationID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Notification not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to mark notification read", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification read"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to mark notification read")
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"success": true})
 }
 
+// MarkAllNotificationsRead marks all of the current user's notifications as
+// read
+func (h *UserHandler) MarkAllNotificationsRead(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	marked, err := h.svc.MarkAllNotificationsRead(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to mark notifications read", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to mark notifications read")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
+
+// UnreadNotificationCount returns how many of the current user's
+// notifications are unread, for badges that don't need the list
+func (h *UserHandler) UnreadNotificationCount(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	count, err := h.svc.UnreadNotificationCount(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to count unread notifications", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to count unread notifications")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"unreadCount": count})
+}
+
+// PreviewDigest returns what the current user's next notification digest
+// would contain if it were sent now
+func (h *UserHandler) PreviewDigest(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	digest, err := h.digests.Preview(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to preview digest", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to preview digest")
+		return
+	}
+
+	c.JSON(http.StatusOK, digest)
+}
+
 // =====================================================
 // SEARCH HANDLER
 // =====================================================
@@ -1489,30 +2152,41 @@ func NewSearchHandler(svc *services.SearchService, logger *zap.Logger) *SearchHa
 func (h *SearchHandler) Search(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	orgID, err := uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
 	var req services.SearchRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
 	resp, err := h.svc.TextSearch(c.Request.Context(), orgID, userID, req)
 	if errors.Is(err, services.ErrForbidden) {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+	if errors.Is(err, services.ErrQueryTimeout) {
+		h.logger.Warn("Text search timed out", zap.String("orgId", orgID.String()), zap.Error(err))
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Search timed out; try a more specific query")
+		return
+	}
+	if c.Request.Context().Err() != nil {
+		// The client went away and the search was cancelled; nobody is
+		// waiting for a response
+		c.Abort()
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to perform text search", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to perform search"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to perform search")
 		return
 	}
 
@@ -1532,19 +2206,19 @@ type SemanticSearchAPIRequest struct {
 func (h *SearchHandler) SemanticSearch(c *gin.Context) {
 	_, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	_, err = uuid.Parse(c.Param("orgId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid organization ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
 		return
 	}
 
 	var req SemanticSearchAPIRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		respondBindError(c, err, "Invalid request body")
 		return
 	}
 
@@ -1552,35 +2226,35 @@ func (h *SearchHandler) SemanticSearch(c *gin.Context) {
 	// This would typically be done via an embedding service
 	// For now, return an error indicating embeddings are not yet configured
 	// In production, you'd call an embedding API (OpenAI, Voyage, etc.)
-	c.JSON(http.StatusServiceUnavailable, gin.H{
-		"error":   "Semantic search requires embedding generation",
-		"message": "Configure OPENAI_API_KEY or another embedding provider to use semantic search",
-		"query":   req.Query,
-	})
+	apierror.RespondWithDetails(c, http.StatusServiceUnavailable, apierror.CodeNotConfigured,
+		"Semantic search requires embedding generation", gin.H{
+			"hint":  "Configure OPENAI_API_KEY or another embedding provider to use semantic search",
+			"query": req.Query,
+		})
 }
 
 // GetNodeContext returns context information for a node (for RAG)
 func (h *SearchHandler) GetNodeContext(c *gin.Context) {
 	userID, err := getUserUUID(c)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
 		return
 	}
 
 	nodeID, err := uuid.Parse(c.Param("nodeId"))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid node ID"})
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
 		return
 	}
 
 	ctx, err := h.svc.GetNodeContext(c.Request.Context(), nodeID, userID)
 	if errors.Is(err, services.ErrNotFound) {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Node not found"})
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
 		return
 	}
 	if err != nil {
 		h.logger.Error("Failed to get node context", zap.Error(err))
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get node context"})
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get node context")
 		return
 	}
 
@@ -1599,3 +2273,117 @@ func getUserUUID(c *gin.Context) (uuid.UUID, error) {
 	}
 	return uuid.Parse(userIDStr)
 }
+
+// weakETag builds a weak validator from the parts that change whenever a resource does
+func weakETag(parts ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, ":")))
+	return `W/"` + hex.EncodeToString(sum[:8]) + `"`
+}
+
+// etagMatches reports whether an If-None-Match header matches the given ETag.
+// Weak comparison is used, as required for If-None-Match.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(candidate), "W/") == want {
+			return true
+		}
+	}
+	return false
+}
+
+// versionETag is the strong validator of a resource versioned by its
+// updated_at. Clients send it back in If-Match to guard an update.
+func versionETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixMicro(), 36) + `"`
+}
+
+// nodeETag is the strong validator of a node. If-Match on a node compares
+// only the leading version, which node updates alone bump; the updated_at
+// after it, moved also by locks, inputs and outputs, keeps If-None-Match
+// from answering 304 once any of those change.
+func nodeETag(node *models.Node) string {
+	return `"v` + strconv.Itoa(node.Version) + "." + strconv.FormatInt(node.UpdatedAt.UnixMicro(), 36) + `"`
+}
+
+// bindIfMatch reads an update's If-Match header into a precondition. An
+// absent header or * matches any version. Anything but a single ETag from
+// versionETag gets a 400 and false. The W/ that middleware.Compress adds to
+// compressed responses is accepted: the tag still names one version.
+func bindIfMatch(c *gin.Context) (services.Precondition, bool) {
+	tag, present := ifMatchTag(c)
+	if !present {
+		return services.Precondition{}, true
+	}
+	micros, err := strconv.ParseInt(tag, 36, 64)
+	if err != nil {
+		respondBadIfMatch(c)
+		return services.Precondition{}, false
+	}
+	updatedAt := time.UnixMicro(micros)
+	return services.Precondition{UpdatedAt: &updatedAt}, true
+}
+
+// bindNodeIfMatch is bindIfMatch for a node update, which takes the
+// ETags of nodeETag
+func bindNodeIfMatch(c *gin.Context) (services.Precondition, bool) {
+	tag, present := ifMatchTag(c)
+	if !present {
+		return services.Precondition{}, true
+	}
+	digits, _, _ := strings.Cut(tag, ".")
+	digits, versioned := strings.CutPrefix(digits, "v")
+	version, err := strconv.Atoi(digits)
+	if !versioned || err != nil {
+		respondBadIfMatch(c)
+		return services.Precondition{}, false
+	}
+	return services.Precondition{Version: &version}, true
+}
+
+// ifMatchTag returns the opaque tag of the If-Match header, without W/ and
+// quotes, and whether one was sent. A malformed header yields a tag no
+// ETag of this API has.
+func ifMatchTag(c *gin.Context) (string, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return "", false
+	}
+	tag, quoted := strings.CutPrefix(strings.TrimPrefix(header, "W/"), `"`)
+	tag, closed := strings.CutSuffix(tag, `"`)
+	if !quoted || !closed || strings.ContainsAny(tag, `", `) {
+		return "", true
+	}
+	return tag, true
+}
+
+// respondBadIfMatch rejects an If-Match header that isn't an ETag of this API
+func respondBadIfMatch(c *gin.Context) {
+	apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "If-Match must be a single ETag returned by this API")
+}
+
+// respondVersionConflict rejects an update whose If-Match ETag is no longer current
+func respondVersionConflict(c *gin.Context, resource string) {
+	apierror.Respond(c, http.StatusConflict, apierror.CodeVersionConflict,
+		resource+" was modified since it was read; fetch it again and retry")
+}
+
+// respondWithETag writes body as JSON with an ETag, or 304 Not Modified when the
+// client's cached copy is still current
+func respondWithETag(c *gin.Context, etag string, body any) {
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "private, no-cache")
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.JSON(http.StatusOK, body)
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/events"
+	"github.com/glassbox/api/internal/middleware"
+	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// INTERNAL HANDLER
+// =====================================================
+
+// InternalHandler serves the worker-facing internal API. Routes are
+// authenticated by middleware.InternalAuth, never by user tokens. Finished
+// executions and files are also published as domain events, and executions
+// that finish or wait on a user notify them.
+type InternalHandler struct {
+	broadcaster   websocket.Broadcaster
+	events        *events.Publisher
+	authz         *authz.Authorizer
+	notifications *services.NotificationService
+	logger        *zap.Logger
+}
+
+func NewInternalHandler(broadcaster websocket.Broadcaster, publisher *events.Publisher, az *authz.Authorizer, notifications *services.NotificationService, logger *zap.Logger) *InternalHandler {
+	return &InternalHandler{broadcaster: broadcaster, events: publisher, authz: az, notifications: notifications, logger: logger}
+}
+
+// ExecutionEventRequest is a worker's report of execution progress
+type ExecutionEventRequest struct {
+	NodeID       uuid.UUID `json:"nodeId" binding:"required"`
+	Status       string    `json:"status" binding:"required,oneof=pending running paused awaiting_input complete failed cancelled"`
+	TokensIn     int       `json:"tokensIn" binding:"min=0"`
+	TokensOut    int       `json:"tokensOut" binding:"min=0"`
+	TraceSummary string    `json:"traceSummary"`
+}
+
+// ExecutionEvent relays a worker's execution update to WebSocket subscribers
+// of the node. The worker has already persisted the change.
+func (h *InternalHandler) ExecutionEvent(c *gin.Context) {
+	executionID, err := uuid.Parse(c.Param("executionId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid execution ID")
+		return
+	}
+
+	var req ExecutionEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	h.relayExecutionStatus(c.Request.Context(), executionID, req.NodeID, req.Status, req.TokensIn, req.TokensOut, req.TraceSummary)
+
+	h.logger.Debug("Relayed execution event",
+		zap.String("executionId", executionID.String()),
+		zap.String("status", req.Status),
+		zap.String("auth", c.GetString(middleware.ContextInternalAuth)),
+	)
+	c.Status(http.StatusAccepted)
+}
+
+// relayExecutionStatus sends an execution update to WebSocket subscribers of
+// the node, publishes finished executions as domain events, and notifies
+// users of executions that finish or wait on them
+func (h *InternalHandler) relayExecutionStatus(ctx context.Context, executionID, nodeID uuid.UUID, status string, tokensIn, tokensOut int, traceSummary string) {
+	h.broadcaster.BroadcastExecutionUpdate(nodeID, executionID, status, tokensIn, tokensOut, traceSummary)
+
+	if (status == "complete" || status == "failed") && h.events.Enabled() {
+		orgID, err := h.authz.OrgFor(ctx, authz.Resource{Type: authz.ResourceNode, ID: nodeID})
+		if err != nil {
+			h.logger.Warn("Failed to resolve execution org for event", zap.String("executionId", executionID.String()), zap.Error(err))
+		} else {
+			h.events.Publish(events.ExecutionCompleted, orgID, events.ExecutionCompletedData{
+				ExecutionID: executionID,
+				NodeID:      nodeID,
+				Status:      status,
+				TokensIn:    tokensIn,
+				TokensOut:   tokensOut,
+			})
+		}
+	}
+
+	if err := h.notifications.ExecutionStatusChanged(ctx, executionID, status); err != nil {
+		h.logger.Warn("Failed to notify execution status", zap.String("executionId", executionID.String()), zap.Error(err))
+	}
+}
+
+// ExecutionProgressRequest is a worker's report of a step starting or finishing
+type ExecutionProgressRequest struct {
+	NodeID         uuid.UUID `json:"nodeId" binding:"required"`
+	Step           string    `json:"step" binding:"required,oneof=llm_call tool_call"`
+	Phase          string    `json:"phase" binding:"required,oneof=started finished"`
+	Tool           string    `json:"tool" binding:"max=100"`
+	Iteration      int       `json:"iteration" binding:"min=0"`
+	DurationMs     *int      `json:"durationMs" binding:"omitempty,min=0"`
+	TotalTokensIn  int       `json:"totalTokensIn" binding:"min=0"`
+	TotalTokensOut int       `json:"totalTokensOut" binding:"min=0"`
+}
+
+// ExecutionProgress relays step-level trace progress to subscribers of the
+// execution channel so trace views update live
+func (h *InternalHandler) ExecutionProgress(c *gin.Context) {
+	executionID, err := uuid.Parse(c.Param("executionId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid execution ID")
+		return
+	}
+
+	var req ExecutionProgressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	h.broadcaster.BroadcastExecutionProgress(websocket.ExecutionProgressPayload{
+		ExecutionID:    executionID,
+		NodeID:         req.NodeID,
+		Step:           req.Step,
+		Phase:          req.Phase,
+		Tool:           req.Tool,
+		Iteration:      req.Iteration,
+		DurationMs:     req.DurationMs,
+		TotalTokensIn:  req.TotalTokensIn,
+		TotalTokensOut: req.TotalTokensOut,
+	})
+	c.Status(http.StatusAccepted)
+}
+
+// UserMessageRequest is a worker's message for one user, e.g. an agent
+// asking the user who started an execution to approve an action
+type UserMessageRequest struct {
+	Kind  string         `json:"kind" binding:"required,oneof=approval_request mention"`
+	Title string         `json:"title" binding:"required,max=200"`
+	Body  string         `json:"body" binding:"max=2000"`
+	OrgID *uuid.UUID     `json:"orgId"`
+	Link  string         `json:"link" binding:"max=500"`
+	Data  map[string]any `json:"data"`
+}
+
+// UserMessage delivers a message to every connection of a user, whatever
+// they are subscribed to. Mentions in an org are also stored as
+// notifications; approval requests are stored when the execution pauses for
+// them.
+func (h *InternalHandler) UserMessage(c *gin.Context) {
+	userID, err := uuid.Parse(c.Param("userId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID")
+		return
+	}
+
+	var req UserMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	h.broadcaster.SendUserMessage(userID, websocket.UserMessagePayload{
+		Kind:  req.Kind,
+		Title: req.Title,
+		Body:  req.Body,
+		OrgID: req.OrgID,
+		Link:  req.Link,
+		Data:  req.Data,
+	})
+	if req.Kind == services.NotificationMention && req.OrgID != nil {
+		err := h.notifications.Message(c.Request.Context(), userID, *req.OrgID, req.Kind, req.Title, req.Body)
+		if err != nil {
+			h.logger.Warn("Failed to store mention", zap.String("userId", userID.String()), zap.Error(err))
+		}
+	}
+	c.Status(http.StatusAccepted)
+}
+
+// FileEventRequest is a file processor's report of a file's status
+type FileEventRequest struct {
+	OrgID    uuid.UUID `json:"orgId" binding:"required"`
+	Filename string    `json:"filename" binding:"max=255"`
+	Status   string    `json:"status" binding:"required,oneof=processing processed failed"`
+	Error    string    `json:"error" binding:"max=2000"`
+}
+
+// FileEvent relays file processing progress to subscribers of the org's
+// files channel. The worker has already persisted the change.
+func (h *InternalHandler) FileEvent(c *gin.Context) {
+	fileID, err := uuid.Parse(c.Param("fileId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid file ID")
+		return
+	}
+
+	var req FileEventRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	h.relayFileStatus(fileID, req.OrgID, req.Filename, req.Status, req.Error)
+	c.Status(http.StatusAccepted)
+}
+
+// relayFileStatus sends a file's processing status to subscribers of the
+// org's files channel, and publishes finished files as domain events
+func (h *InternalHandler) relayFileStatus(fileID, orgID uuid.UUID, filename, status, errMsg string) {
+	h.broadcaster.BroadcastFileProcessing(websocket.FileProcessingPayload{
+		FileID:   fileID,
+		OrgID:    orgID,
+		Filename: filename,
+		Status:   status,
+		Error:    errMsg,
+	})
+	if status != "processing" {
+		h.events.Publish(events.FileProcessed, orgID, events.FileProcessedData{
+			FileID:   fileID,
+			Filename: filename,
+			Status:   status,
+			Error:    errMsg,
+		})
+	}
+}
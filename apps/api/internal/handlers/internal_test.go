@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/glassbox/api/internal/websocket/wstest"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// postExecutionProgress serves one ExecutionProgress request against h
+func postExecutionProgress(h *InternalHandler, executionID uuid.UUID, body string) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.POST("/internal/executions/:executionId/progress", h.ExecutionProgress)
+
+	req := httptest.NewRequest(http.MethodPost, "/internal/executions/"+executionID.String()+"/progress", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestExecutionProgressBroadcasts(t *testing.T) {
+	rec := wstest.NewRecorder()
+	h := NewInternalHandler(rec, nil, nil, nil, zap.NewNop())
+	executionID, nodeID := uuid.New(), uuid.New()
+
+	w := postExecutionProgress(h, executionID,
+		`{"nodeId":"`+nodeID.String()+`","step":"tool_call","phase":"started","tool":"search","iteration":2}`)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+	calls := rec.CallsTo("BroadcastExecutionProgress")
+	if len(calls) != 1 {
+		t.Fatalf("got %d broadcasts, want 1", len(calls))
+	}
+	progress := calls[0].Args[0].(websocket.ExecutionProgressPayload)
+	if progress.ExecutionID != executionID || progress.NodeID != nodeID || progress.Tool != "search" || progress.Iteration != 2 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+}
+
+func TestExecutionProgressRejectsUnknownStep(t *testing.T) {
+	rec := wstest.NewRecorder()
+	h := NewInternalHandler(rec, nil, nil, nil, zap.NewNop())
+
+	w := postExecutionProgress(h, uuid.New(), `{"nodeId":"`+uuid.NewString()+`","step":"sleep","phase":"started"}`)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", w.Code)
+	}
+	if calls := rec.Calls(); len(calls) != 0 {
+		t.Fatalf("broadcast on a rejected request: %+v", calls)
+	}
+}
+
+func TestExecutionProgressReachesSubscribers(t *testing.T) {
+	hub := wstest.NewHub(nil)
+	defer hub.Close()
+	h := NewInternalHandler(hub, nil, nil, nil, zap.NewNop())
+	executionID := uuid.New()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	client, err := hub.Connect(ctx, uuid.NewString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Subscribe(ctx, "execution:"+executionID.String()); err != nil {
+		t.Fatal(err)
+	}
+
+	w := postExecutionProgress(h, executionID,
+		`{"nodeId":"`+uuid.NewString()+`","step":"llm_call","phase":"finished","durationMs":120}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202", w.Code)
+	}
+
+	msg, err := client.Expect(ctx, websocket.MsgTypeExecutionProgress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var progress websocket.ExecutionProgressPayload
+	if err := websocket.DecodePayload(msg, &progress); err != nil {
+		t.Fatal(err)
+	}
+	if progress.ExecutionID != executionID || progress.Step != "llm_call" || progress.DurationMs == nil || *progress.DurationMs != 120 {
+		t.Fatalf("unexpected progress %+v", progress)
+	}
+}
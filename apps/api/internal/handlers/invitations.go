@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// INVITATION HANDLER
+// =====================================================
+
+type InvitationHandler struct {
+	svc         *services.InvitationService
+	broadcaster websocket.Broadcaster
+	logger      *zap.Logger
+}
+
+func NewInvitationHandler(svc *services.InvitationService, broadcaster websocket.Broadcaster, logger *zap.Logger) *InvitationHandler {
+	return &InvitationHandler{svc: svc, broadcaster: broadcaster, logger: logger}
+}
+
+func (h *InvitationHandler) List(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	invitations, err := h.svc.List(c.Request.Context(), orgID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list invitations", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list invitations")
+		return
+	}
+
+	respondPage(c, "data", invitations)
+}
+
+// Create invites an email address. The response carries the token and
+// accept link; they can't be read back later.
+func (h *InvitationHandler) Create(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var req services.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	invitation, err := h.svc.Create(c.Request.Context(), orgID, userID, req)
+	if errors.Is(err, services.ErrAlreadyExists) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "A member already has that email address")
+		return
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can't invite with a role above your own")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to create invitation", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create invitation")
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusCreated, invitation)
+}
+
+func (h *InvitationHandler) Revoke(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	invitationID, err := uuid.Parse(c.Param("invitationId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid invitation ID")
+		return
+	}
+
+	err = h.svc.Revoke(c.Request.Context(), orgID, invitationID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Invitation not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to revoke invitation", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to revoke invitation")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Accept makes the current user a member of the org an invitation is for
+func (h *InvitationHandler) Accept(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	accepted, err := h.svc.Accept(c.Request.Context(), userID, req)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Invitation not found, already used or revoked")
+		return
+	}
+	if errors.Is(err, services.ErrInvitationExpired) {
+		apierror.Respond(c, http.StatusGone, apierror.CodeInvalidState, "Invitation has expired; ask for a new one")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to accept invitation", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to accept invitation")
+		return
+	}
+
+	if accepted.Joined {
+		h.broadcaster.BroadcastMembershipChanged(accepted.OrgID, userID, services.MembershipAdded, accepted.Role, userID.String())
+	}
+	c.JSON(http.StatusOK, accepted)
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// IP ALLOWLIST HANDLER
+// =====================================================
+
+type IPAllowlistHandler struct {
+	svc    *services.IPAllowlistService
+	logger *zap.Logger
+}
+
+func NewIPAllowlistHandler(svc *services.IPAllowlistService, logger *zap.Logger) *IPAllowlistHandler {
+	return &IPAllowlistHandler{svc: svc, logger: logger}
+}
+
+func (h *IPAllowlistHandler) List(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	entries, err := h.svc.List(c.Request.Context(), orgID)
+	if err != nil {
+		h.logger.Error("Failed to list IP allowlist", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list IP allowlist")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": entries})
+}
+
+func (h *IPAllowlistHandler) Add(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var req services.AddIPAllowlistEntryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	entry, err := h.svc.Add(c.Request.Context(), orgID, userID, c.ClientIP(), req)
+	if errors.Is(err, services.ErrInvalidCIDR) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid CIDR range")
+		return
+	}
+	if errors.Is(err, services.ErrAllowlistLockout) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAllowlistLockout, "The allowlist must include your current IP address")
+		return
+	}
+	if errors.Is(err, services.ErrAlreadyExists) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "Range is already in the allowlist")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to add IP allowlist entry", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to add IP allowlist entry")
+		return
+	}
+
+	c.JSON(http.StatusCreated, entry)
+}
+
+func (h *IPAllowlistHandler) Remove(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	entryID, err := uuid.Parse(c.Param("entryId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid entry ID")
+		return
+	}
+
+	err = h.svc.Remove(c.Request.Context(), orgID, entryID, c.ClientIP())
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Allowlist entry not found")
+		return
+	}
+	if errors.Is(err, services.ErrAllowlistLockout) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAllowlistLockout, "The allowlist must include your current IP address")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to remove IP allowlist entry", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove IP allowlist entry")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// ORG MEMBERS HANDLER
+// =====================================================
+
+type OrgMembersHandler struct {
+	svc         *services.OrgMembersService
+	broadcaster websocket.Broadcaster
+	logger      *zap.Logger
+}
+
+func NewOrgMembersHandler(svc *services.OrgMembersService, broadcaster websocket.Broadcaster, logger *zap.Logger) *OrgMembersHandler {
+	return &OrgMembersHandler{svc: svc, broadcaster: broadcaster, logger: logger}
+}
+
+func (h *OrgMembersHandler) List(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	members, err := h.svc.List(c.Request.Context(), orgID, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list members", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list members")
+		return
+	}
+
+	respondPage(c, "data", members)
+}
+
+// Invite adds an existing user to the org by email. People without an
+// account are invited through InvitationHandler.
+func (h *OrgMembersHandler) Invite(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var req services.InviteMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	member, err := h.svc.Invite(c.Request.Context(), orgID, userID, req)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "No user has that email address; send them an invitation instead")
+		return
+	}
+	if errors.Is(err, services.ErrAlreadyExists) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeAlreadyExists, "User is already a member")
+		return
+	}
+	if h.respondRoleError(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to invite member", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to invite member")
+		return
+	}
+
+	h.broadcaster.BroadcastMembershipChanged(orgID, member.UserID, services.MembershipAdded, member.Role, userID.String())
+	c.JSON(http.StatusCreated, member)
+}
+
+func (h *OrgMembersHandler) UpdateRole(c *gin.Context) {
+	actorID, orgID, memberID, ok := memberParams(c)
+	if !ok {
+		return
+	}
+
+	var req services.UpdateMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	member, err := h.svc.UpdateRole(c.Request.Context(), orgID, memberID, actorID, req)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Member not found")
+		return
+	}
+	if h.respondRoleError(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to update member role", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update member role")
+		return
+	}
+
+	// Subscriptions the new role doesn't allow are dropped
+	h.broadcaster.RevalidateAccess(memberID)
+	h.broadcaster.BroadcastMembershipChanged(orgID, memberID, services.MembershipRoleChanged, member.Role, actorID.String())
+	c.JSON(http.StatusOK, member)
+}
+
+func (h *OrgMembersHandler) Remove(c *gin.Context) {
+	actorID, orgID, memberID, ok := memberParams(c)
+	if !ok {
+		return
+	}
+
+	role, err := h.svc.Remove(c.Request.Context(), orgID, memberID, actorID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Member not found")
+		return
+	}
+	if h.respondRoleError(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to remove member", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove member")
+		return
+	}
+
+	h.broadcaster.RevokeMembership(orgID, memberID)
+	h.broadcaster.BroadcastMembershipChanged(orgID, memberID, services.MembershipRemoved, role, actorID.String())
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// respondRoleError writes the response for a change the role rules refuse,
+// reporting whether it did
+func (h *OrgMembersHandler) respondRoleError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, services.ErrForbidden):
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "You can't grant a role above your own or manage members who outrank you")
+	case errors.Is(err, services.ErrLastOwner):
+		apierror.Respond(c, http.StatusConflict, apierror.CodeSoleOwner, "Make someone else an owner first")
+	default:
+		return false
+	}
+	return true
+}
+
+// memberParams parses the caller and the :orgId and :userId params,
+// responding with an error when one is invalid
+func memberParams(c *gin.Context) (actorID, orgID, memberID uuid.UUID, ok bool) {
+	actorID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return actorID, orgID, memberID, false
+	}
+	orgID, err = uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return actorID, orgID, memberID, false
+	}
+	memberID, err = uuid.Parse(c.Param("userId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid user ID")
+		return actorID, orgID, memberID, false
+	}
+	return actorID, orgID, memberID, true
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/telemetry"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// METRICS HANDLER
+// =====================================================
+
+// MetricsHandler serves metrics for Prometheus to scrape
+type MetricsHandler struct {
+	sources []telemetry.MetricsSource
+	logger  *zap.Logger
+}
+
+func NewMetricsHandler(logger *zap.Logger, sources ...telemetry.MetricsSource) *MetricsHandler {
+	return &MetricsHandler{sources: sources, logger: logger}
+}
+
+// Serve writes every source's metrics in the Prometheus text format
+func (h *MetricsHandler) Serve(c *gin.Context) {
+	var buf bytes.Buffer
+	w := telemetry.NewMetricsWriter(&buf)
+	for _, source := range h.sources {
+		source.WriteMetrics(w)
+	}
+	if err := w.Err(); err != nil {
+		h.logger.Error("Failed to write metrics", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to write metrics")
+		return
+	}
+	c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", buf.Bytes())
+}
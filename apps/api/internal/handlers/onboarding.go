@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/services"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// ONBOARDING HANDLER
+// =====================================================
+
+type OnboardingHandler struct {
+	svc    *services.OnboardingService
+	logger *zap.Logger
+}
+
+func NewOnboardingHandler(svc *services.OnboardingService, logger *zap.Logger) *OnboardingHandler {
+	return &OnboardingHandler{svc: svc, logger: logger}
+}
+
+func (h *OnboardingHandler) Get(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	onboarding, err := h.svc.Get(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to get onboarding", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get onboarding")
+		return
+	}
+
+	c.JSON(http.StatusOK, onboarding)
+}
+
+func (h *OnboardingHandler) Update(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.UpdateOnboardingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	onboarding, err := h.svc.Update(c.Request.Context(), userID, req)
+	if err != nil {
+		h.logger.Error("Failed to update onboarding", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update onboarding")
+		return
+	}
+
+	c.JSON(http.StatusOK, onboarding)
+}
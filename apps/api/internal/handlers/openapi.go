@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/graphql"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/openapi"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/queue"
+	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/websocket"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// OPENAPI HANDLER
+// =====================================================
+
+// OpenAPIInfo describes the API in its OpenAPI document
+var OpenAPIInfo = openapi.Info{
+	Title:       "Glassbox API",
+	Description: "REST API for Glassbox organizations, projects, nodes, files, agent executions and templates.",
+	Version:     "v1",
+}
+
+// OpenAPIServer is the base path APIRoutes are served under
+const OpenAPIServer = "/api/v1"
+
+// OpenAPIDocument builds the API's OpenAPI document
+func OpenAPIDocument() *openapi.Document {
+	return openapi.Build(OpenAPIInfo, OpenAPIServer, APIRoutes)
+}
+
+type OpenAPIHandler struct {
+	once   sync.Once
+	spec   []byte
+	err    error
+	logger *zap.Logger
+}
+
+func NewOpenAPIHandler(logger *zap.Logger) *OpenAPIHandler {
+	return &OpenAPIHandler{logger: logger}
+}
+
+// Spec serves the OpenAPI document, built on first request
+func (h *OpenAPIHandler) Spec(c *gin.Context) {
+	h.once.Do(func() {
+		h.spec, h.err = json.Marshal(OpenAPIDocument())
+	})
+	if h.err != nil {
+		h.logger.Error("Failed to build OpenAPI document", zap.Error(h.err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to build API specification")
+		return
+	}
+	c.Data(http.StatusOK, "application/json", h.spec)
+}
+
+// swaggerUI renders the spec with Swagger UI from its CDN
+const swaggerUI = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Glassbox API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>
+    window.ui = SwaggerUIBundle({ url: "openapi.json", dom_id: "#swagger-ui", persistAuthorization: true });
+  </script>
+</body>
+</html>
+`
+
+// SwaggerUI serves an API explorer for the spec. Development only.
+func (h *OpenAPIHandler) SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUI))
+}
+
+// =====================================================
+// API ROUTES
+// =====================================================
+
+// pageOf is a page of items as respondPage writes it
+func pageOf[T any](key string) openapi.Object {
+	return openapi.Object{key: []T{}, "pagination": pageInfo{}}
+}
+
+// Query strings the handlers read without binding a single struct
+type (
+	listTemplatesQuery struct {
+		services.ListTemplatesRequest
+		pagination.Params
+	}
+	listChangesQuery struct {
+		services.ListChangesRequest
+		pagination.Params
+	}
+	listAuditLogQuery struct {
+		services.ListAuditLogRequest
+		pagination.Params
+	}
+	adminListOrgsQuery struct {
+		services.AdminListOrgsRequest
+		pagination.Params
+	}
+	adminListExecutionsQuery struct {
+		services.AdminListExecutionsRequest
+		pagination.Params
+	}
+	listOutdatedInstancesQuery struct {
+		services.ListOutdatedInstancesRequest
+		pagination.Params
+	}
+	listNotificationsQuery struct {
+		Unread bool `form:"unread"`
+		pagination.Params
+	}
+	templateFileQuery struct {
+		Format string `form:"format" binding:"omitempty,oneof=yaml json"`
+	}
+)
+
+var (
+	templateFileTypes = []string{"application/yaml", "application/json"}
+	templateImport    = []string{"application/yaml", "application/json", "multipart/form-data"}
+)
+
+// eventRoutes documents the event history routes of the aggregate at path
+func eventRoutes(path, tag, idPrefix, noun string) []openapi.Route {
+	return []openapi.Route{
+		{Method: http.MethodGet, Path: path + "/events", ID: "list" + idPrefix + "Events", Tag: tag, Summary: "List the domain events recorded for " + noun, Query: pagination.Params{}, Response: pageOf[services.DomainEvent]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: path + "/events/state", ID: "get" + idPrefix + "EventState", Tag: tag, Summary: "Rebuild the state of " + noun + " as of an event", Query: ReplayRequest{}, Response: services.AggregateState{}, APIKey: true},
+	}
+}
+
+// permissionsRoute documents the permissions/me route of a resource
+func permissionsRoute(path, tag, idPrefix string) openapi.Route {
+	return openapi.Route{Method: http.MethodGet, Path: path + "/permissions/me", ID: "get" + idPrefix + "Permissions", Tag: tag, Summary: "List the actions the caller may take", Response: PermissionsResponse{}}
+}
+
+// APIRoutes documents every route registerAPIRoutes serves, in the same
+// order. `api openapi` fails when the two disagree, so a route added
+// without documenting it breaks the build.
+var APIRoutes = slices.Concat(
+	[]openapi.Route{
+		// Auth
+		{Method: http.MethodPost, Path: "/auth/dev-token", ID: "generateDevToken", Tag: "Auth", Summary: "Issue a JWT for local development (development only)", Body: DevTokenRequest{}, Response: openapi.Object{"token": "", "expiresAt": time.Time{}}, Public: true},
+		{Method: http.MethodPost, Path: "/auth/ws-token", ID: "getWebSocketToken", Tag: "Auth", Summary: "Issue a short-lived WebSocket token", Response: openapi.Object{"token": "", "expiresAt": time.Time{}}},
+
+		// Organizations
+		{Method: http.MethodGet, Path: "/orgs", ID: "listOrgs", Tag: "Organizations", Summary: "List the caller's organizations", Query: pagination.Params{}, Response: pageOf[models.Organization]("data")},
+		{Method: http.MethodPost, Path: "/orgs", ID: "createOrg", Tag: "Organizations", Summary: "Create an organization", Body: services.CreateOrgRequest{}, Response: models.Organization{}, Status: http.StatusCreated},
+		{Method: http.MethodGet, Path: "/orgs/:orgId", ID: "getOrg", Tag: "Organizations", Summary: "Get an organization", Response: models.Organization{}, APIKey: true},
+		{Method: http.MethodPatch, Path: "/orgs/:orgId", ID: "updateOrg", Tag: "Organizations", Summary: "Update an organization", Body: services.UpdateOrgRequest{}, Response: models.Organization{}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId", ID: "deleteOrg", Tag: "Organizations", Summary: "Delete an organization", Status: http.StatusNoContent, APIKey: true},
+		permissionsRoute("/orgs/:orgId", "Organizations", "Org"),
+		{Method: http.MethodGet, Path: "/orgs/:orgId/users/search", ID: "searchOrgMembers", Tag: "Organizations", Summary: "Search an organization's members by name or email", Query: services.SearchMembersRequest{}, Response: openapi.Object{"data": []services.MemberMatch{}}, APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/members", ID: "listOrgMembers", Tag: "Organizations", Summary: "List an organization's members", Query: pagination.Params{}, Response: pageOf[services.OrgMember]("data"), APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/members", ID: "inviteOrgMember", Tag: "Organizations", Summary: "Add a user to an organization by email", Body: services.InviteMemberRequest{}, Response: services.OrgMember{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodPatch, Path: "/orgs/:orgId/members/:userId", ID: "updateOrgMemberRole", Tag: "Organizations", Summary: "Change a member's role", Body: services.UpdateMemberRoleRequest{}, Response: services.OrgMember{}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId/members/:userId", ID: "removeOrgMember", Tag: "Organizations", Summary: "Remove a member from an organization", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/invitations", ID: "listOrgInvitations", Tag: "Organizations", Summary: "List an organization's pending invitations", Query: pagination.Params{}, Response: pageOf[services.OrgInvitation]("data"), APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/invitations", ID: "createOrgInvitation", Tag: "Organizations", Summary: "Invite an email address to an organization", Body: services.CreateInvitationRequest{}, Response: services.CreatedInvitation{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId/invitations/:invitationId", ID: "revokeOrgInvitation", Tag: "Organizations", Summary: "Revoke a pending invitation", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/api-keys", ID: "listAPIKeys", Tag: "Organizations", Summary: "List an organization's API keys", Query: pagination.Params{}, Response: pageOf[models.APIKey]("data")},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/api-keys", ID: "createAPIKey", Tag: "Organizations", Summary: "Create an API key", Body: services.CreateAPIKeyRequest{}, Response: services.CreatedAPIKey{}, Status: http.StatusCreated},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId/api-keys/:keyId", ID: "revokeAPIKey", Tag: "Organizations", Summary: "Revoke an API key", Status: http.StatusNoContent},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/projects", ID: "listProjects", Tag: "Projects", Summary: "List an organization's projects", Query: pagination.Params{}, Response: pageOf[models.Project]("data"), APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/projects", ID: "createProject", Tag: "Projects", Summary: "Create a project", Body: services.CreateProjectRequest{}, Response: models.Project{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/files/upload", ID: "getUploadURL", Tag: "Files", Summary: "Get a presigned URL to upload a file to", Body: services.UploadURLRequest{}, Response: services.UploadURLResponse{}, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/search", ID: "search", Tag: "Search", Summary: "Full-text search across an organization", Body: services.SearchRequest{}, Response: services.SearchResponse{}, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/search/semantic", ID: "semanticSearch", Tag: "Search", Summary: "Vector similarity search (requires an embedding provider)", Body: SemanticSearchAPIRequest{}, Response: services.SearchResponse{}, APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/audit-log", ID: "listAuditLog", Tag: "Audit", Summary: "List an organization's request audit log", Query: listAuditLogQuery{}, Response: pageOf[models.RequestAuditEntry]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/audit-log/changes", ID: "listAuditChanges", Tag: "Audit", Summary: "List an organization's data changes", Query: listChangesQuery{}, Response: pageOf[models.AuditLogEntry]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/ip-allowlist", ID: "listIPAllowlist", Tag: "Organizations", Summary: "List an organization's IP allowlist", Response: openapi.Object{"data": []models.OrgIPAllowlistEntry{}}, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/ip-allowlist", ID: "addIPAllowlistEntry", Tag: "Organizations", Summary: "Add a CIDR range to an organization's IP allowlist", Body: services.AddIPAllowlistEntryRequest{}, Response: models.OrgIPAllowlistEntry{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId/ip-allowlist/:entryId", ID: "removeIPAllowlistEntry", Tag: "Organizations", Summary: "Remove an IP allowlist entry", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/webhooks", ID: "listOrgWebhooks", Tag: "Notification Webhooks", Summary: "List an organization's notification webhooks", Response: openapi.Object{"data": []models.NotificationWebhook{}}, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/webhooks", ID: "createOrgWebhook", Tag: "Notification Webhooks", Summary: "Create an organization notification webhook", Body: services.CreateWebhookRequest{}, Response: models.NotificationWebhook{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId/webhooks/:webhookId", ID: "deleteOrgWebhook", Tag: "Notification Webhooks", Summary: "Delete an organization notification webhook", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/webhooks/:webhookId/test", ID: "testOrgWebhook", Tag: "Notification Webhooks", Summary: "Send a test delivery to an organization webhook", Response: services.WebhookResult{}, APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/templates", ID: "listOrgTemplates", Tag: "Templates", Summary: "List an organization's templates", Query: listTemplatesQuery{}, Response: pageOf[models.Template]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: "/orgs/:orgId/templates/outdated-instances", ID: "listOutdatedTemplateInstances", Tag: "Templates", Summary: "List nodes created from older template versions", Query: listOutdatedInstancesQuery{}, Response: pageOf[models.OutdatedTemplateInstance]("data"), APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/templates", ID: "createOrgTemplate", Tag: "Templates", Summary: "Create a template", Body: services.CreateTemplateRequest{}, Response: models.Template{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodPost, Path: "/orgs/:orgId/templates/import", ID: "importTemplates", Tag: "Templates", Summary: "Import a YAML or JSON template file", Consumes: templateImport, Body: services.TemplateFile{}, Response: openapi.Object{"templates": []models.Template{}}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodPatch, Path: "/orgs/:orgId/templates/:templateId", ID: "updateOrgTemplate", Tag: "Templates", Summary: "Update a template", Body: services.UpdateTemplateRequest{}, Response: models.Template{}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/orgs/:orgId/templates/:templateId", ID: "deleteOrgTemplate", Tag: "Templates", Summary: "Delete a template", Status: http.StatusNoContent, APIKey: true},
+	},
+	eventRoutes("/orgs/:orgId", "Organizations", "Org", "an organization"),
+	[]openapi.Route{
+		// Projects
+		{Method: http.MethodGet, Path: "/projects/:projectId", ID: "getProject", Tag: "Projects", Summary: "Get a project", Response: models.Project{}, APIKey: true},
+		{Method: http.MethodPatch, Path: "/projects/:projectId", ID: "updateProject", Tag: "Projects", Summary: "Update a project", Body: services.UpdateProjectRequest{}, Response: models.Project{}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/projects/:projectId", ID: "deleteProject", Tag: "Projects", Summary: "Delete a project", Status: http.StatusNoContent, APIKey: true},
+		permissionsRoute("/projects/:projectId", "Projects", "Project"),
+	},
+	eventRoutes("/projects/:projectId", "Projects", "Project", "a project"),
+	[]openapi.Route{
+		{Method: http.MethodGet, Path: "/projects/:projectId/nodes", ID: "listNodes", Tag: "Nodes", Summary: "List a project's nodes", Query: services.ListNodesRequest{}, Response: pageOf[models.Node]("data"), APIKey: true},
+		{Method: http.MethodPost, Path: "/projects/:projectId/nodes", ID: "createNode", Tag: "Nodes", Summary: "Create a node", Body: services.CreateNodeRequest{}, Response: models.Node{}, Status: http.StatusCreated, APIKey: true},
+
+		// Nodes
+		{Method: http.MethodGet, Path: "/nodes/:nodeId", ID: "getNode", Tag: "Nodes", Summary: "Get a node", Response: models.Node{}, APIKey: true},
+		{Method: http.MethodPatch, Path: "/nodes/:nodeId", ID: "updateNode", Tag: "Nodes", Summary: "Update a node", Body: services.UpdateNodeRequest{}, Response: models.Node{}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/nodes/:nodeId", ID: "deleteNode", Tag: "Nodes", Summary: "Delete a node", Status: http.StatusNoContent, APIKey: true},
+		permissionsRoute("/nodes/:nodeId", "Nodes", "Node"),
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/versions", ID: "listNodeVersions", Tag: "Nodes", Summary: "List a node's versions", Query: pagination.Params{}, Response: pageOf[models.NodeVersion]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/versions/:version", ID: "getNodeVersion", Tag: "Nodes", Summary: "Get a node version", Response: models.NodeVersion{}, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/rollback/:version", ID: "rollbackNode", Tag: "Nodes", Summary: "Roll a node back to a version", Response: models.Node{}, APIKey: true},
+	},
+	eventRoutes("/nodes/:nodeId", "Nodes", "Node", "a node"),
+	[]openapi.Route{
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/inputs", ID: "addNodeInput", Tag: "Nodes", Summary: "Add an input to a node", Body: services.AddInputRequest{}, Response: models.NodeInput{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodDelete, Path: "/nodes/:nodeId/inputs/:inputId", ID: "removeNodeInput", Tag: "Nodes", Summary: "Remove a node input", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/outputs", ID: "addNodeOutput", Tag: "Nodes", Summary: "Add an output to a node", Body: services.AddOutputRequest{}, Response: models.NodeOutput{}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodDelete, Path: "/nodes/:nodeId/outputs/:outputId", ID: "removeNodeOutput", Tag: "Nodes", Summary: "Remove a node output", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/children", ID: "listNodeChildren", Tag: "Nodes", Summary: "List a node's children", Query: pagination.Params{}, Response: pageOf[models.Node]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/dependencies", ID: "listNodeDependencies", Tag: "Nodes", Summary: "List the nodes a node depends on", Query: pagination.Params{}, Response: pageOf[models.Node]("data"), APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/template-export", ID: "exportNodeAsTemplate", Tag: "Templates", Summary: "Download a node and its descendants as a template file", Query: templateFileQuery{}, Response: services.TemplateFile{}, Produces: templateFileTypes, APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/presence", ID: "getNodePresence", Tag: "Nodes", Summary: "List who is viewing or editing a node", Response: openapi.Object{"data": []*websocket.PresenceInfo{}}, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/lock", ID: "acquireNodeLock", Tag: "Nodes", Summary: "Lock a node for editing", Response: openapi.Object{"success": true, "message": ""}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/nodes/:nodeId/lock", ID: "releaseNodeLock", Tag: "Nodes", Summary: "Release a node's edit lock", Status: http.StatusNoContent, APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/context", ID: "getNodeContext", Tag: "Search", Summary: "Get a node's surrounding context for retrieval", Response: models.NodeContext{}, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/execute", ID: "startExecution", Tag: "Executions", Summary: "Start an agent execution for a node", Body: StartExecutionRequest{}, Response: openapi.Object{"execution": models.AgentExecution{}}, Status: http.StatusCreated, APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/execution", ID: "getCurrentExecution", Tag: "Executions", Summary: "Get a node's latest execution", Response: openapi.Object{"execution": services.ExecutionWithHumanInput{}}, APIKey: true},
+		{Method: http.MethodGet, Path: "/nodes/:nodeId/agent-config", ID: "getEffectiveAgentConfig", Tag: "Executions", Summary: "Get the agent config a node's executions would use", Response: openapi.Object{"agentConfig": models.EffectiveAgentConfig{}}, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/execution/pause", ID: "pauseExecution", Tag: "Executions", Summary: "Pause a node's running execution", Response: openapi.Object{"message": ""}, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/execution/resume", ID: "resumeExecution", Tag: "Executions", Summary: "Resume a node's paused execution", Response: openapi.Object{"message": ""}, APIKey: true},
+		{Method: http.MethodPost, Path: "/nodes/:nodeId/execution/cancel", ID: "cancelExecution", Tag: "Executions", Summary: "Cancel a node's execution", Response: openapi.Object{"message": ""}, APIKey: true},
+
+		// Executions
+		{Method: http.MethodGet, Path: "/executions/:executionId", ID: "getExecution", Tag: "Executions", Summary: "Get an execution", Response: openapi.Object{"execution": services.ExecutionWithHumanInput{}}, APIKey: true},
+		{Method: http.MethodGet, Path: "/executions/:executionId/trace", ID: "getExecutionTrace", Tag: "Executions", Summary: "List an execution's trace events", Query: pagination.Params{}, Response: pageOf[models.TraceEvent]("events"), APIKey: true},
+		{Method: http.MethodPost, Path: "/executions/:executionId/input", ID: "provideExecutionInput", Tag: "Executions", Summary: "Answer an execution waiting for human input", Body: ProvideInputRequest{}, Response: openapi.Object{"message": ""}, APIKey: true},
+		permissionsRoute("/executions/:executionId", "Executions", "Execution"),
+
+		// Files
+		{Method: http.MethodPost, Path: "/files/:fileId/confirm", ID: "confirmUpload", Tag: "Files", Summary: "Confirm a file has been uploaded", Response: models.File{}, APIKey: true},
+		{Method: http.MethodGet, Path: "/files/:fileId", ID: "getFile", Tag: "Files", Summary: "Get a file with a download URL", Response: services.FileWithDownloadURL{}, APIKey: true},
+		{Method: http.MethodDelete, Path: "/files/:fileId", ID: "deleteFile", Tag: "Files", Summary: "Delete a file", Status: http.StatusNoContent, APIKey: true},
+		permissionsRoute("/files/:fileId", "Files", "File"),
+	},
+	eventRoutes("/files/:fileId", "Files", "File", "a file"),
+	[]openapi.Route{
+		// Templates
+		{Method: http.MethodGet, Path: "/templates", ID: "listPublicTemplates", Tag: "Templates", Summary: "Browse the public template catalog", Query: listTemplatesQuery{}, Response: pageOf[models.Template]("data")},
+		{Method: http.MethodGet, Path: "/templates/categories", ID: "listTemplateCategories", Tag: "Templates", Summary: "List template categories", Response: openapi.Object{"categories": []models.TemplateCategory{}}},
+		{Method: http.MethodGet, Path: "/templates/:templateId", ID: "getTemplate", Tag: "Templates", Summary: "Get a template", Response: models.Template{}},
+		{Method: http.MethodGet, Path: "/templates/:templateId/versions", ID: "listTemplateVersions", Tag: "Templates", Summary: "List a template's versions", Query: pagination.Params{}, Response: pageOf[models.TemplateVersion]("data")},
+		{Method: http.MethodGet, Path: "/templates/:templateId/versions/:version", ID: "getTemplateVersion", Tag: "Templates", Summary: "Get a template version", Response: models.TemplateVersion{}},
+		{Method: http.MethodGet, Path: "/templates/:templateId/export", ID: "exportTemplate", Tag: "Templates", Summary: "Download a template as a file", Query: templateFileQuery{}, Response: services.TemplateFile{}, Produces: templateFileTypes},
+		{Method: http.MethodGet, Path: "/templates/:templateId/preview", ID: "previewTemplate", Tag: "Templates", Summary: "Preview the nodes applying a template would create", Query: PreviewTemplateRequest{}, Response: models.TemplatePreview{}},
+		{Method: http.MethodPost, Path: "/templates/:templateId/apply", ID: "applyTemplate", Tag: "Templates", Summary: "Create nodes from a template", Body: services.ApplyTemplateRequest{}, Response: openapi.Object{"nodes": []models.Node{}}, Status: http.StatusCreated},
+		{Method: http.MethodPut, Path: "/templates/:templateId/rating", ID: "rateTemplate", Tag: "Templates", Summary: "Rate a public template", Body: services.RateTemplateRequest{}, Response: models.Template{}},
+		{Method: http.MethodDelete, Path: "/templates/:templateId/rating", ID: "removeTemplateRating", Tag: "Templates", Summary: "Remove the caller's rating of a template", Response: models.Template{}},
+
+		// Users
+		{Method: http.MethodGet, Path: "/users/me", ID: "getMe", Tag: "Users", Summary: "Get the caller's profile", Response: models.User{}},
+		{Method: http.MethodPatch, Path: "/users/me", ID: "updateMe", Tag: "Users", Summary: "Update the caller's profile and preferences", Body: services.UpdateUserRequest{}, Response: models.User{}},
+		{Method: http.MethodPost, Path: "/users/me/delete", ID: "deleteMe", Tag: "Users", Summary: "Delete the caller's account", Body: services.DeleteAccountRequest{}, Response: openapi.Object{"removedMemberships": 0, "reassignedNodes": int64(0)}},
+		{Method: http.MethodGet, Path: "/users/me/activity", ID: "listMyActivity", Tag: "Users", Summary: "List the caller's recent activity", Query: services.ListActivityRequest{}, Response: pageOf[services.ActivityItem]("data")},
+		{Method: http.MethodGet, Path: "/users/me/mentions", ID: "listMyMentions", Tag: "Users", Summary: "List where the caller has been mentioned", Query: services.ListMentionsRequest{}, Response: pageOf[services.Mention]("data")},
+		{Method: http.MethodGet, Path: "/users/me/onboarding", ID: "getOnboarding", Tag: "Users", Summary: "Get the caller's onboarding checklist", Response: services.Onboarding{}},
+		{Method: http.MethodPatch, Path: "/users/me/onboarding", ID: "updateOnboarding", Tag: "Users", Summary: "Dismiss or restore the onboarding checklist", Body: services.UpdateOnboardingRequest{}, Response: services.Onboarding{}},
+		{Method: http.MethodGet, Path: "/users/me/notifications", ID: "listNotifications", Tag: "Users", Summary: "List the caller's notifications", Query: listNotificationsQuery{}, Response: pageOf[models.Notification]("data")},
+		{Method: http.MethodGet, Path: "/users/me/notifications/unread-count", ID: "getUnreadNotificationCount", Tag: "Users", Summary: "Count the caller's unread notifications", Response: openapi.Object{"unreadCount": 0}},
+		{Method: http.MethodPost, Path: "/users/me/notifications/read-all", ID: "markAllNotificationsRead", Tag: "Users", Summary: "Mark all of the caller's notifications read", Response: openapi.Object{"marked": int64(0)}},
+		{Method: http.MethodGet, Path: "/users/me/notifications/digest/preview", ID: "previewDigest", Tag: "Users", Summary: "Preview the caller's next notification digest", Response: services.Digest{}},
+		{Method: http.MethodPost, Path: "/users/me/notifications/:notificationId/read", ID: "markNotificationRead", Tag: "Users", Summary: "Mark a notification read", Response: openapi.Object{"success": true}},
+		{Method: http.MethodGet, Path: "/users/me/webhooks", ID: "listMyWebhooks", Tag: "Notification Webhooks", Summary: "List the caller's notification webhooks", Response: openapi.Object{"data": []models.NotificationWebhook{}}},
+		{Method: http.MethodPost, Path: "/users/me/webhooks", ID: "createMyWebhook", Tag: "Notification Webhooks", Summary: "Create a personal notification webhook", Body: services.CreateWebhookRequest{}, Response: models.NotificationWebhook{}, Status: http.StatusCreated},
+		{Method: http.MethodDelete, Path: "/users/me/webhooks/:webhookId", ID: "deleteMyWebhook", Tag: "Notification Webhooks", Summary: "Delete a personal notification webhook", Status: http.StatusNoContent},
+		{Method: http.MethodPost, Path: "/users/me/webhooks/:webhookId/test", ID: "testMyWebhook", Tag: "Notification Webhooks", Summary: "Send a test delivery to a personal webhook", Response: services.WebhookResult{}},
+		{Method: http.MethodGet, Path: "/users/me/push/public-key", ID: "getPushPublicKey", Tag: "Users", Summary: "Get the VAPID public key for push subscriptions", Response: openapi.Object{"publicKey": ""}},
+		{Method: http.MethodGet, Path: "/users/me/push/subscriptions", ID: "listPushSubscriptions", Tag: "Users", Summary: "List the caller's push subscriptions", Response: openapi.Object{"data": []models.PushSubscription{}}},
+		{Method: http.MethodPost, Path: "/users/me/push/subscriptions", ID: "subscribePush", Tag: "Users", Summary: "Register a browser push subscription", Body: services.SubscribePushRequest{}, Response: models.PushSubscription{}, Status: http.StatusCreated},
+		{Method: http.MethodDelete, Path: "/users/me/push/subscriptions/:subscriptionId", ID: "unsubscribePush", Tag: "Users", Summary: "Remove a push subscription", Status: http.StatusNoContent},
+
+		// Invitations
+		{Method: http.MethodPost, Path: "/invitations/accept", ID: "acceptInvitation", Tag: "Organizations", Summary: "Accept an invitation to an organization", Body: services.AcceptInvitationRequest{}, Response: services.AcceptedInvitation{}},
+
+		// GraphQL
+		{Method: http.MethodPost, Path: "/graphql", ID: "graphqlQuery", Tag: "GraphQL", Summary: "Run a GraphQL query over projects, nodes and executions", Body: graphql.Request{}, Response: graphql.Response{}},
+		{Method: http.MethodGet, Path: "/graphql/schema", ID: "getGraphQLSchema", Tag: "GraphQL", Summary: "Get the GraphQL schema in SDL", Produces: []string{"text/plain"}},
+
+		// Admin
+		{Method: http.MethodGet, Path: "/admin/orgs", ID: "adminListOrgs", Tag: "Admin", Summary: "List organizations", Query: adminListOrgsQuery{}, Response: pageOf[models.AdminOrgSummary]("data")},
+		{Method: http.MethodGet, Path: "/admin/users", ID: "adminLookupUsers", Tag: "Admin", Summary: "Look up users", Query: services.AdminUserLookupRequest{}, Response: openapi.Object{"data": []models.AdminUser{}}},
+		{Method: http.MethodGet, Path: "/admin/users/:userId", ID: "adminGetUser", Tag: "Admin", Summary: "Get a user", Response: models.AdminUser{}},
+		{Method: http.MethodPost, Path: "/admin/users/:userId/deactivate", ID: "adminDeactivateUser", Tag: "Admin", Summary: "Deactivate a user", Response: models.AdminUser{}},
+		{Method: http.MethodPost, Path: "/admin/users/:userId/reactivate", ID: "adminReactivateUser", Tag: "Admin", Summary: "Reactivate a user", Response: models.AdminUser{}},
+		{Method: http.MethodPost, Path: "/admin/users/:userId/messages", ID: "adminSendUserMessage", Tag: "Admin", Summary: "Send a message to a user's open sessions", Body: AdminMessageRequest{}, Status: http.StatusAccepted},
+		{Method: http.MethodGet, Path: "/admin/executions", ID: "adminListExecutions", Tag: "Admin", Summary: "List executions across organizations", Query: adminListExecutionsQuery{}, Response: pageOf[models.AdminExecution]("data")},
+		{Method: http.MethodGet, Path: "/admin/executions/:executionId", ID: "adminGetExecution", Tag: "Admin", Summary: "Get an execution", Response: models.AdminExecution{}},
+		{Method: http.MethodPost, Path: "/admin/templates", ID: "adminCreateTemplate", Tag: "Admin", Summary: "Create a system template", Body: services.CreateTemplateRequest{}, Response: models.Template{}, Status: http.StatusCreated},
+		{Method: http.MethodPatch, Path: "/admin/templates/:templateId", ID: "adminUpdateTemplate", Tag: "Admin", Summary: "Update a template", Body: services.UpdateTemplateRequest{}, Response: models.Template{}},
+		{Method: http.MethodDelete, Path: "/admin/templates/:templateId", ID: "adminDeleteTemplate", Tag: "Admin", Summary: "Delete a template", Status: http.StatusNoContent},
+		{Method: http.MethodPut, Path: "/admin/templates/:templateId/featured", ID: "adminSetTemplateFeatured", Tag: "Admin", Summary: "Feature or unfeature a public template", Body: SetFeaturedRequest{}, Response: models.Template{}},
+		{Method: http.MethodGet, Path: "/admin/feature-flags", ID: "adminListFeatureFlags", Tag: "Admin", Summary: "List feature flags", Response: openapi.Object{"data": []models.FeatureFlag{}}},
+		{Method: http.MethodPut, Path: "/admin/feature-flags/:flagKey", ID: "adminSetFeatureFlag", Tag: "Admin", Summary: "Create or update a feature flag", Body: services.SetFeatureFlagRequest{}, Response: models.FeatureFlag{}},
+		{Method: http.MethodGet, Path: "/admin/websocket", ID: "adminWebSocketStats", Tag: "Admin", Summary: "Get WebSocket hub statistics", Response: openapi.Object{"data": []*websocket.HubStats{}}},
+		{Method: http.MethodGet, Path: "/admin/migrations", ID: "adminMigrationStatus", Tag: "Admin", Summary: "Get the database's migration status", Response: database.MigrationStatus{}},
+		{Method: http.MethodGet, Path: "/admin/maintenance", ID: "adminMaintenanceStatus", Tag: "Admin", Summary: "Get the read-only maintenance state", Response: services.MaintenanceState{}},
+		{Method: http.MethodPut, Path: "/admin/maintenance", ID: "adminEnableMaintenance", Tag: "Admin", Summary: "Put the API in read-only mode", Body: EnableMaintenanceRequest{}, Response: services.MaintenanceState{}},
+		{Method: http.MethodDelete, Path: "/admin/maintenance", ID: "adminDisableMaintenance", Tag: "Admin", Summary: "Take the API out of read-only mode", Response: services.MaintenanceState{}},
+		{Method: http.MethodGet, Path: "/admin/queues/:queue/dead-letters", ID: "adminListDeadLetters", Tag: "Admin", Summary: "List a queue's dead letters", Query: DeadLetterListRequest{}, Response: openapi.Object{"data": []queue.DeadLetter{}}},
+		{Method: http.MethodGet, Path: "/admin/queues/:queue/dead-letters/:messageId", ID: "adminGetDeadLetter", Tag: "Admin", Summary: "Get a dead letter", Response: queue.DeadLetter{}},
+		{Method: http.MethodPost, Path: "/admin/queues/:queue/dead-letters/redrive", ID: "adminRedriveDeadLetters", Tag: "Admin", Summary: "Send dead letters back to their queue", Body: DeadLetterIDsRequest{}, Response: openapi.Object{"redriven": 0}},
+		{Method: http.MethodPost, Path: "/admin/queues/:queue/dead-letters/discard", ID: "adminDiscardDeadLetters", Tag: "Admin", Summary: "Delete dead letters", Body: DeadLetterIDsRequest{}, Response: openapi.Object{"discarded": 0}},
+		{Method: http.MethodGet, Path: "/admin/queues/:queue/quarantine", ID: "adminListQuarantine", Tag: "Admin", Summary: "List a queue's quarantined jobs", Query: DeadLetterListRequest{}, Response: openapi.Object{"data": []queue.QuarantinedJob{}}},
+		{Method: http.MethodGet, Path: "/admin/queues/:queue/quarantine/:jobId", ID: "adminGetQuarantinedJob", Tag: "Admin", Summary: "Get a quarantined job", Response: queue.QuarantinedJob{}},
+		{Method: http.MethodPost, Path: "/admin/queues/:queue/quarantine/:jobId/release", ID: "adminReleaseQuarantinedJob", Tag: "Admin", Summary: "Requeue a quarantined job", Response: openapi.Object{"released": true}},
+		{Method: http.MethodDelete, Path: "/admin/queues/:queue/quarantine/:jobId", ID: "adminDiscardQuarantinedJob", Tag: "Admin", Summary: "Delete a quarantined job", Status: http.StatusNoContent},
+	},
+)
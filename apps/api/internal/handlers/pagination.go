@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+)
+
+// =====================================================
+// PAGINATION
+// =====================================================
+
+// pageInfo is the pagination block of a list response. Pass nextCursor as
+// ?cursor= to get the next page. Total is the size of the whole list, for
+// lists that are counted.
+type pageInfo struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    bool   `json:"hasMore"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// bindPage binds ?cursor= and ?limit=, responding with a 400 when they're
+// invalid
+func bindPage(c *gin.Context) (pagination.Params, bool) {
+	var page pagination.Params
+	if err := c.ShouldBindQuery(&page); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return page, false
+	}
+	return page, true
+}
+
+// respondInvalidCursor writes a 400 for a cursor the list didn't issue
+func respondInvalidCursor(c *gin.Context) {
+	apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid cursor")
+}
+
+// respondPage writes a page of a list as {key: [...], "pagination": {...}},
+// with the total in the block and X-Total-Count when the list was counted
+func respondPage[T any](c *gin.Context, key string, page *pagination.Page[T]) {
+	info := pageInfo{NextCursor: page.NextCursor, HasMore: page.HasMore}
+	if page.Total >= 0 {
+		info.Total = &page.Total
+		c.Header("X-Total-Count", strconv.Itoa(page.Total))
+	}
+	c.JSON(http.StatusOK, gin.H{
+		key:          page.Items,
+		"pagination": info,
+	})
+}
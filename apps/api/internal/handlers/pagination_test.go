@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/middleware"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/repository"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// listNodes serves GET /projects/:projectId/nodes?query as userID, from mem
+func listNodes(mem *repository.Memory, userID, projectID uuid.UUID, query string) *httptest.ResponseRecorder {
+	h := NewNodeHandler(services.NewNodeService(nil, mem.NodeRepo(), nil, nil, nil, zap.NewNop()), zap.NewNop())
+	r := gin.New()
+	r.GET("/projects/:projectId/nodes", func(c *gin.Context) {
+		c.Set(middleware.ContextUserID, userID.String())
+	}, h.List)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/projects/"+projectID.String()+"/nodes?"+query, nil))
+	return w
+}
+
+func TestListPagination(t *testing.T) {
+	mem := repository.NewMemory()
+	orgID, projectID, userID := uuid.New(), uuid.New(), uuid.New()
+	mem.Members[orgID] = map[uuid.UUID]string{userID: "member"}
+	mem.Projects[projectID] = models.Project{ID: projectID, OrgID: orgID}
+	base := time.Now().Add(-time.Hour)
+	for i := range 3 {
+		id := uuid.New()
+		mem.Nodes[id] = models.Node{ID: id, OrgID: orgID, ProjectID: projectID, CreatedAt: base.Add(time.Duration(i) * time.Minute)}
+	}
+
+	var seen int
+	query := "limit=2"
+	for pages := 0; ; pages++ {
+		if pages == 3 {
+			t.Fatal("pagination did not end")
+		}
+		w := listNodes(mem, userID, projectID, query)
+		if w.Code != http.StatusOK {
+			t.Fatalf("status = %d: %s", w.Code, w.Body.String())
+		}
+		if got := w.Header().Get("X-Total-Count"); got != "3" {
+			t.Fatalf("X-Total-Count = %q, want 3", got)
+		}
+		var body struct {
+			Data       []models.Node `json:"data"`
+			Pagination pageInfo      `json:"pagination"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		seen += len(body.Data)
+		if !body.Pagination.HasMore {
+			break
+		}
+		query = "limit=2&cursor=" + body.Pagination.NextCursor
+	}
+	if seen != 3 {
+		t.Fatalf("listed %d nodes, want 3", seen)
+	}
+
+	for _, query := range []string{
+		"cursor=not-a-cursor",
+		"cursor=" + pagination.StringCursor("alpha", uuid.New()).Encode(),
+		"limit=-1",
+		"limit=201",
+		"limit=ten",
+	} {
+		if w := listNodes(mem, userID, projectID, query); w.Code != http.StatusBadRequest {
+			t.Errorf("?%s: status = %d, want 400: %s", query, w.Code, w.Body.String())
+		}
+	}
+	// 0, like no limit, gets the default
+	for _, query := range []string{"limit=200", "limit=0"} {
+		if w := listNodes(mem, userID, projectID, query); w.Code != http.StatusOK {
+			t.Errorf("?%s: status = %d, want 200", query, w.Code)
+		}
+	}
+}
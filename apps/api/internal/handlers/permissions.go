@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/authz"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// PERMISSIONS HANDLER
+// =====================================================
+
+type PermissionsHandler struct {
+	authz  *authz.Authorizer
+	logger *zap.Logger
+}
+
+func NewPermissionsHandler(az *authz.Authorizer, logger *zap.Logger) *PermissionsHandler {
+	return &PermissionsHandler{authz: az, logger: logger}
+}
+
+// PermissionsResponse lists what the caller may do on a resource
+type PermissionsResponse struct {
+	ResourceType authz.ResourceType `json:"resourceType"`
+	ResourceID   uuid.UUID          `json:"resourceId"`
+	OrgID        uuid.UUID          `json:"orgId"`
+	Role         authz.Role         `json:"role"`
+	Permissions  []authz.Action     `json:"permissions"`
+}
+
+// Me returns the caller's permissions on the resource named by the route
+// (org, project, node, file or execution) so clients can hide or disable
+// actions up front instead of discovering 403s
+func (h *PermissionsHandler) Me(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "User not authenticated")
+		return
+	}
+
+	params := make(map[string]string, len(c.Params))
+	for _, p := range c.Params {
+		params[p.Key] = p.Value
+	}
+	res, ok, err := authz.ResourceFromParams(params)
+	if !ok || err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid resource ID")
+		return
+	}
+
+	grant, err := h.authz.Permissions(c.Request.Context(), userID, res)
+	if errors.Is(err, authz.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get permissions", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get permissions")
+		return
+	}
+
+	c.JSON(http.StatusOK, PermissionsResponse{
+		ResourceType: res.Type,
+		ResourceID:   res.ID,
+		OrgID:        grant.OrgID,
+		Role:         grant.Role,
+		Permissions:  grant.Actions,
+	})
+}
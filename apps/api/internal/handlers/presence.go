@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// PRESENCE HANDLER
+// =====================================================
+
+// PresenceHandler serves collaborator presence over REST so pages can render
+// who is viewing a node before their WebSocket connection is up
+type PresenceHandler struct {
+	presence websocket.PresenceReader
+	logger   *zap.Logger
+}
+
+func NewPresenceHandler(presence websocket.PresenceReader, logger *zap.Logger) *PresenceHandler {
+	return &PresenceHandler{presence: presence, logger: logger}
+}
+
+// Node returns the users present on a node across all API instances
+func (h *PresenceHandler) Node(c *gin.Context) {
+	nodeID, err := uuid.Parse(c.Param("nodeId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
+		return
+	}
+
+	presence, err := h.presence.ClusterPresence(c.Request.Context(), nodeID.String())
+	if err != nil {
+		h.logger.Error("Failed to get node presence", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get node presence")
+		return
+	}
+	if presence == nil {
+		presence = []*websocket.PresenceInfo{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": presence})
+}
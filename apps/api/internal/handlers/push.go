@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// WEB PUSH HANDLER
+// =====================================================
+
+type PushHandler struct {
+	svc    *services.WebPushService
+	logger *zap.Logger
+}
+
+func NewPushHandler(svc *services.WebPushService, logger *zap.Logger) *PushHandler {
+	return &PushHandler{svc: svc, logger: logger}
+}
+
+// PublicKey returns the VAPID key the browser subscribes with
+func (h *PushHandler) PublicKey(c *gin.Context) {
+	key, err := h.svc.PublicKey()
+	if errors.Is(err, services.ErrPushNotConfigured) {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeNotConfigured, "Push notifications are not configured")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"publicKey": key})
+}
+
+func (h *PushHandler) ListSubscriptions(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	subs, err := h.svc.List(c.Request.Context(), userID)
+	if err != nil {
+		h.logger.Error("Failed to list push subscriptions", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list push subscriptions")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": subs})
+}
+
+func (h *PushHandler) Subscribe(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	var req services.SubscribePushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	sub, err := h.svc.Subscribe(c.Request.Context(), userID, c.Request.UserAgent(), req)
+	if errors.Is(err, services.ErrPushNotConfigured) {
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeNotConfigured, "Push notifications are not configured")
+		return
+	}
+	if errors.Is(err, services.ErrInvalidPushSubscription) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid push subscription")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to save push subscription", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to save push subscription")
+		return
+	}
+
+	c.JSON(http.StatusCreated, sub)
+}
+
+func (h *PushHandler) Unsubscribe(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	subscriptionID, err := uuid.Parse(c.Param("subscriptionId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid subscription ID")
+		return
+	}
+
+	err = h.svc.Unsubscribe(c.Request.Context(), userID, subscriptionID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Push subscription not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete push subscription", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete push subscription")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/queue"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// QUEUE ADMIN HANDLER
+// =====================================================
+
+// QueueHandler lets platform admins inspect and empty the job queues'
+// dead-letter queues and the job quarantine without AWS console access
+type QueueHandler struct {
+	deadLetters queue.DeadLetters
+	quarantine  *queue.Quarantine
+	logger      *zap.Logger
+}
+
+func NewQueueHandler(deadLetters queue.DeadLetters, quarantine *queue.Quarantine, logger *zap.Logger) *QueueHandler {
+	return &QueueHandler{deadLetters: deadLetters, quarantine: quarantine, logger: logger}
+}
+
+// DeadLetterListRequest pages through a dead-letter queue
+type DeadLetterListRequest struct {
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// DeadLetterIDsRequest selects dead letters to redrive or discard
+type DeadLetterIDsRequest struct {
+	IDs []string `json:"ids" binding:"required,min=1,max=100,dive,required,max=200"`
+}
+
+// queueParam validates the :queue path parameter of the dead-letter routes
+func (h *QueueHandler) queueParam(c *gin.Context) (string, bool) {
+	if h.deadLetters == nil {
+		apierror.Respond(c, http.StatusNotImplemented, apierror.CodeNotConfigured, "The queue backend has no dead-letter queues")
+		return "", false
+	}
+	return queueName(c)
+}
+
+// queueName validates the :queue path parameter
+func queueName(c *gin.Context) (string, bool) {
+	name := c.Param("queue")
+	if name != queue.AgentJobs && name != queue.AgentBatchJobs && name != queue.FileJobs {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Queue not found")
+		return "", false
+	}
+	return name, true
+}
+
+// ListDeadLetters lists messages in a queue's dead-letter queue
+func (h *QueueHandler) ListDeadLetters(c *gin.Context) {
+	name, ok := h.queueParam(c)
+	if !ok {
+		return
+	}
+
+	var req DeadLetterListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	letters, err := h.deadLetters.ListDeadLetters(c.Request.Context(), name, req.Limit)
+	if err != nil {
+		h.logger.Error("Failed to list dead letters", zap.String("queue", name), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list dead letters")
+		return
+	}
+	if letters == nil {
+		letters = []queue.DeadLetter{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": letters})
+}
+
+// GetDeadLetter returns one dead letter with its payload
+func (h *QueueHandler) GetDeadLetter(c *gin.Context) {
+	name, ok := h.queueParam(c)
+	if !ok {
+		return
+	}
+
+	letter, err := h.deadLetters.GetDeadLetter(c.Request.Context(), name, c.Param("messageId"))
+	if errors.Is(err, queue.ErrDeadLetterNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Dead letter not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get dead letter", zap.String("queue", name), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get dead letter")
+		return
+	}
+
+	c.JSON(http.StatusOK, letter)
+}
+
+// RedriveDeadLetters sends dead letters back to their queue for another try
+func (h *QueueHandler) RedriveDeadLetters(c *gin.Context) {
+	name, ok := h.queueParam(c)
+	if !ok {
+		return
+	}
+
+	var req DeadLetterIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	redriven, err := h.deadLetters.RedriveDeadLetters(c.Request.Context(), name, req.IDs)
+	if err != nil {
+		h.logger.Error("Failed to redrive dead letters", zap.String("queue", name), zap.Int("redriven", redriven), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to redrive dead letters")
+		return
+	}
+
+	h.logger.Info("Redrove dead letters", zap.String("queue", name), zap.Int("count", redriven))
+	c.JSON(http.StatusOK, gin.H{"redriven": redriven})
+}
+
+// DiscardDeadLetters deletes dead letters that shouldn't be retried
+func (h *QueueHandler) DiscardDeadLetters(c *gin.Context) {
+	name, ok := h.queueParam(c)
+	if !ok {
+		return
+	}
+
+	var req DeadLetterIDsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	discarded, err := h.deadLetters.DiscardDeadLetters(c.Request.Context(), name, req.IDs)
+	if err != nil {
+		h.logger.Error("Failed to discard dead letters", zap.String("queue", name), zap.Int("discarded", discarded), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to discard dead letters")
+		return
+	}
+
+	h.logger.Info("Discarded dead letters", zap.String("queue", name), zap.Int("count", discarded))
+	c.JSON(http.StatusOK, gin.H{"discarded": discarded})
+}
+
+// quarantinedJob loads the job named by the :queue and :jobId path
+// parameters
+func (h *QueueHandler) quarantinedJob(c *gin.Context) (*queue.QuarantinedJob, bool) {
+	name, ok := queueName(c)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.ParseInt(c.Param("jobId"), 10, 64)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid job ID")
+		return nil, false
+	}
+
+	job, err := h.quarantine.Get(c.Request.Context(), id)
+	if errors.Is(err, queue.ErrQuarantinedJobNotFound) || (err == nil && job.Queue != name) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Quarantined job not found")
+		return nil, false
+	}
+	if err != nil {
+		h.logger.Error("Failed to get quarantined job", zap.Int64("id", id), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get quarantined job")
+		return nil, false
+	}
+	return job, true
+}
+
+// ListQuarantine lists a queue's quarantined jobs, newest first
+func (h *QueueHandler) ListQuarantine(c *gin.Context) {
+	name, ok := queueName(c)
+	if !ok {
+		return
+	}
+
+	var req DeadLetterListRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 50
+	}
+
+	jobs, err := h.quarantine.List(c.Request.Context(), name, req.Limit)
+	if err != nil {
+		h.logger.Error("Failed to list quarantined jobs", zap.String("queue", name), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list quarantined jobs")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": jobs})
+}
+
+// GetQuarantinedJob returns one quarantined job with its payload and the
+// error that quarantined it
+func (h *QueueHandler) GetQuarantinedJob(c *gin.Context) {
+	job, ok := h.quarantinedJob(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// ReleaseQuarantinedJob sends a quarantined job back to its queue, for use
+// once whatever made it fail is fixed
+func (h *QueueHandler) ReleaseQuarantinedJob(c *gin.Context) {
+	job, ok := h.quarantinedJob(c)
+	if !ok {
+		return
+	}
+
+	err := h.quarantine.Release(c.Request.Context(), job.ID)
+	if errors.Is(err, queue.ErrQuarantinedJobNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Quarantined job not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to release quarantined job", zap.Int64("id", job.ID), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to release quarantined job")
+		return
+	}
+
+	h.logger.Info("Released quarantined job", zap.String("queue", job.Queue), zap.Int64("id", job.ID))
+	c.JSON(http.StatusOK, gin.H{"released": true})
+}
+
+// DiscardQuarantinedJob deletes a quarantined job that shouldn't be retried
+func (h *QueueHandler) DiscardQuarantinedJob(c *gin.Context) {
+	job, ok := h.quarantinedJob(c)
+	if !ok {
+		return
+	}
+
+	err := h.quarantine.Discard(c.Request.Context(), job.ID)
+	if errors.Is(err, queue.ErrQuarantinedJobNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Quarantined job not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to discard quarantined job", zap.Int64("id", job.ID), zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to discard quarantined job")
+		return
+	}
+
+	h.logger.Info("Discarded quarantined job", zap.String("queue", job.Queue), zap.Int64("id", job.ID))
+	c.JSON(http.StatusNoContent, nil)
+}
@@ -0,0 +1,854 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// TEMPLATE HANDLER
+// =====================================================
+
+// TemplateHandler serves the template catalog and applying templates.
+// Create, Update and Delete manage the org named by the orgId route param,
+// or system templates on routes without one.
+type TemplateHandler struct {
+	svc    *services.TemplateService
+	logger *zap.Logger
+}
+
+func NewTemplateHandler(svc *services.TemplateService, logger *zap.Logger) *TemplateHandler {
+	return &TemplateHandler{svc: svc, logger: logger}
+}
+
+func (h *TemplateHandler) ListPublic(c *gin.Context) {
+	var filters services.ListTemplatesRequest
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.svc.ListPublic(c.Request.Context(), filters, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list templates", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list templates")
+		return
+	}
+
+	respondPage(c, "data", templates)
+}
+
+func (h *TemplateHandler) ListForOrg(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var filters services.ListTemplatesRequest
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	templates, err := h.svc.ListForOrg(c.Request.Context(), orgID, filters, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list org templates", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list templates")
+		return
+	}
+
+	respondPage(c, "data", templates)
+}
+
+func (h *TemplateHandler) ListCategories(c *gin.Context) {
+	categories, err := h.svc.ListCategories(c.Request.Context())
+	if err != nil {
+		h.logger.Error("Failed to list template categories", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list template categories")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"categories": categories})
+}
+
+func (h *TemplateHandler) Get(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	template, err := h.svc.Get(c.Request.Context(), templateID, userID, c.ClientIP())
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if respondIPNotAllowed(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get template")
+		return
+	}
+
+	respondWithETag(c, versionETag(template.UpdatedAt), template)
+}
+
+func (h *TemplateHandler) ListVersions(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	versions, err := h.svc.ListVersions(c.Request.Context(), templateID, userID, c.ClientIP(), page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if respondIPNotAllowed(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list template versions", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list template versions")
+		return
+	}
+
+	respondPage(c, "data", versions)
+}
+
+func (h *TemplateHandler) GetVersion(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(c.Param("version"), "%d", &version); err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid version number")
+		return
+	}
+
+	templateVersion, err := h.svc.GetVersion(c.Request.Context(), templateID, userID, c.ClientIP(), version)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Version not found")
+		return
+	}
+	if respondIPNotAllowed(c, err) {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get template version", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to get template version")
+		return
+	}
+
+	c.JSON(http.StatusOK, templateVersion)
+}
+
+func (h *TemplateHandler) ListOutdatedInstances(c *gin.Context) {
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	var filters services.ListOutdatedInstancesRequest
+	if err := c.ShouldBindQuery(&filters); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	if filters.TemplateID != nil {
+		if _, err := uuid.Parse(*filters.TemplateID); err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID filter")
+			return
+		}
+	}
+	page, ok := bindPage(c)
+	if !ok {
+		return
+	}
+
+	instances, err := h.svc.ListOutdatedInstances(c.Request.Context(), orgID, filters, page)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		respondInvalidCursor(c)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to list outdated template instances", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list outdated template instances")
+		return
+	}
+
+	respondPage(c, "data", instances)
+}
+
+func (h *TemplateHandler) Create(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, ok := templateScope(c)
+	if !ok {
+		return
+	}
+
+	var req services.CreateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	template, err := h.svc.Create(c.Request.Context(), orgID, userID, req)
+	if respondTemplateStructureError(c, err, "Invalid template") {
+		return
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Publishing templates requires the admin or owner role")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to create template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create template")
+		return
+	}
+
+	c.Header("ETag", versionETag(template.UpdatedAt))
+	c.JSON(http.StatusCreated, template)
+}
+
+func (h *TemplateHandler) Update(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, ok := templateScope(c)
+	if !ok {
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req services.UpdateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+	ifMatch, ok := bindIfMatch(c)
+	if !ok {
+		return
+	}
+	req.IfMatch = ifMatch
+
+	template, err := h.svc.Update(c.Request.Context(), orgID, templateID, userID, req)
+	if respondTemplateStructureError(c, err, "Invalid template") {
+		return
+	}
+	if errors.Is(err, services.ErrForbidden) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Publishing templates requires the admin or owner role")
+		return
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if errors.Is(err, services.ErrVersionConflict) {
+		respondVersionConflict(c, "Template")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to update template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update template")
+		return
+	}
+
+	c.Header("ETag", versionETag(template.UpdatedAt))
+	c.JSON(http.StatusOK, template)
+}
+
+func (h *TemplateHandler) Delete(c *gin.Context) {
+	orgID, ok := templateScope(c)
+	if !ok {
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	err = h.svc.Delete(c.Request.Context(), orgID, templateID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete template")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+func (h *TemplateHandler) Apply(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req services.ApplyTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	nodes, err := h.svc.Apply(c.Request.Context(), templateID, userID, c.ClientIP(), req)
+	if errors.Is(err, services.ErrForbidden) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+	if respondIPNotAllowed(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if errors.Is(err, services.ErrInvalidParent) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Parent node is not in the project")
+		return
+	}
+	if errors.Is(err, services.ErrTemplateNesting) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Template sub-nodes nest too deeply or form a cycle")
+		return
+	}
+	if errors.Is(err, services.ErrUnresolvedTemplate) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "A sub-node's template is missing or not available to this project")
+		return
+	}
+	if respondTemplateValuesError(c, err, "values") {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to apply template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to apply template")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"nodes": nodes})
+}
+
+// PreviewTemplateRequest is Preview's query string. Variable values are
+// values[name]=value pairs, read separately.
+type PreviewTemplateRequest struct {
+	ProjectID string  `form:"projectId" binding:"required,uuid"`
+	ParentID  *string `form:"parentId" binding:"omitempty,uuid"`
+	Title     *string `form:"title" binding:"omitempty,min=1,max=500"`
+}
+
+// Preview returns what Apply would create, taking its fields from the query
+// string: projectId, parentId, title, and values[name]=value per variable
+func (h *TemplateHandler) Preview(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	var query PreviewTemplateRequest
+	if err := c.ShouldBindQuery(&query); err != nil {
+		respondBindError(c, err, "Invalid query parameters")
+		return
+	}
+	req := services.ApplyTemplateRequest{
+		ProjectID: uuid.MustParse(query.ProjectID),
+		Title:     query.Title,
+		Values:    c.QueryMap("values"),
+	}
+	if query.ParentID != nil {
+		parentID := uuid.MustParse(*query.ParentID)
+		req.ParentID = &parentID
+	}
+
+	preview, err := h.svc.Preview(c.Request.Context(), templateID, userID, c.ClientIP(), req)
+	if errors.Is(err, services.ErrForbidden) {
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeForbidden, "Access denied")
+		return
+	}
+	if respondIPNotAllowed(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if errors.Is(err, services.ErrInvalidParent) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Parent node is not in the project")
+		return
+	}
+	if errors.Is(err, services.ErrTemplateNesting) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Template sub-nodes nest too deeply or form a cycle")
+		return
+	}
+	if errors.Is(err, services.ErrUnresolvedTemplate) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "A sub-node's template is missing or not available to this project")
+		return
+	}
+	if respondTemplateValuesError(c, err, "values") {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to preview template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to preview template")
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+func (h *TemplateHandler) Rate(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req services.RateTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	template, err := h.svc.Rate(c.Request.Context(), templateID, userID, req.Rating)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found in the public catalog")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to rate template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to rate template")
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+func (h *TemplateHandler) RemoveRating(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	template, err := h.svc.RemoveRating(c.Request.Context(), templateID, userID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found in the public catalog")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to remove template rating", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to remove rating")
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// SetFeaturedRequest is SetFeatured's body
+type SetFeaturedRequest struct {
+	Featured *bool `json:"featured" binding:"required"`
+}
+
+// SetFeatured features a public template in the catalog, or stops featuring
+// it. Admin route.
+func (h *TemplateHandler) SetFeatured(c *gin.Context) {
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	var req SetFeaturedRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	template, err := h.svc.SetFeatured(c.Request.Context(), templateID, *req.Featured)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if errors.Is(err, services.ErrTemplateNotPublic) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeInvalidState, "Only public templates can be featured")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to set template featured", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to update template")
+		return
+	}
+
+	c.Header("ETag", versionETag(template.UpdatedAt))
+	c.JSON(http.StatusOK, template)
+}
+
+// Largest template file Import accepts
+const maxTemplateFileBytes = 1 << 20
+
+// Export downloads a template, with the templates its sub-nodes use, as a
+// YAML file, or JSON with ?format=json
+func (h *TemplateHandler) Export(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	templateID, err := uuid.Parse(c.Param("templateId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid template ID")
+		return
+	}
+
+	yamlFormat, ok := templateFileFormat(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.svc.Export(c.Request.Context(), templateID, userID, c.ClientIP())
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Template not found")
+		return
+	}
+	if respondIPNotAllowed(c, err) {
+		return
+	}
+	if errors.Is(err, services.ErrTemplateFileTooLarge) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Template uses too many sub-node templates to export")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to export template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export template")
+		return
+	}
+
+	h.respondTemplateFile(c, file, yamlFormat)
+}
+
+// ExportNode downloads a node and its descendants as a template file
+func (h *TemplateHandler) ExportNode(c *gin.Context) {
+	nodeID, err := uuid.Parse(c.Param("nodeId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid node ID")
+		return
+	}
+
+	yamlFormat, ok := templateFileFormat(c)
+	if !ok {
+		return
+	}
+
+	file, err := h.svc.ExportNode(c.Request.Context(), nodeID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Node not found")
+		return
+	}
+	if errors.Is(err, services.ErrTemplateFileTooLarge) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Node has too many descendants with children to export")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to export node as template", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export node")
+		return
+	}
+
+	h.respondTemplateFile(c, file, yamlFormat)
+}
+
+// Import creates the templates of an uploaded YAML or JSON template file in
+// the org. The file is the request body, or the "file" field of a
+// multipart form.
+func (h *TemplateHandler) Import(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+
+	orgID, err := uuid.Parse(c.Param("orgId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return
+	}
+
+	body := c.Request.Body
+	if c.ContentType() == "multipart/form-data" {
+		header, err := c.FormFile("file")
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Missing file")
+			return
+		}
+		upload, err := header.Open()
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Unreadable file")
+			return
+		}
+		defer upload.Close()
+		body = upload
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxTemplateFileBytes+1))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Unreadable file")
+		return
+	}
+	if len(data) > maxTemplateFileBytes {
+		apierror.Respond(c, http.StatusRequestEntityTooLarge, apierror.CodeBadRequest, "Template file is larger than 1 MiB")
+		return
+	}
+
+	file, err := services.DecodeTemplateFile(data)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	if err := binding.Validator.ValidateStruct(file); err != nil {
+		respondBindError(c, err, "Invalid template file")
+		return
+	}
+
+	templates, err := h.svc.Import(c.Request.Context(), orgID, userID, file)
+	if errors.Is(err, services.ErrInvalidTemplateFile) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, err.Error())
+		return
+	}
+	if respondTemplateStructureError(c, err, "Invalid template") {
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to import templates", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to import templates")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"templates": templates})
+}
+
+// templateFileFormat reads the format query param: true for yaml, the
+// default, false for json. Writes a 400 and returns ok false otherwise.
+func templateFileFormat(c *gin.Context) (yamlFormat, ok bool) {
+	switch c.DefaultQuery("format", "yaml") {
+	case "yaml":
+		return true, true
+	case "json":
+		return false, true
+	}
+	apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "format must be yaml or json")
+	return false, false
+}
+
+// respondTemplateFile writes file as an attachment named after its first
+// template
+func (h *TemplateHandler) respondTemplateFile(c *gin.Context, file *services.TemplateFile, yamlFormat bool) {
+	data, err := services.EncodeTemplateFile(file, yamlFormat)
+	if err != nil {
+		h.logger.Error("Failed to encode template file", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to export template")
+		return
+	}
+
+	contentType, ext := "application/json", "json"
+	if yamlFormat {
+		contentType, ext = "application/yaml", "yaml"
+	}
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": templateFileName(file.Templates[0].Name) + ".template." + ext,
+	}))
+	c.Data(http.StatusOK, contentType, data)
+}
+
+// templateFileName turns a template name into a file name: lowercase
+// letters and digits separated by dashes
+func templateFileName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		} else {
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "template"
+	}
+	return b.String()
+}
+
+// templateScope reads the org whose templates a route manages: the orgId
+// param, or nil for system templates. Writes a 400 and returns false for an
+// invalid ID.
+func templateScope(c *gin.Context) (*uuid.UUID, bool) {
+	raw, ok := c.Params.Get("orgId")
+	if !ok {
+		return nil, true
+	}
+	orgID, err := uuid.Parse(raw)
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+		return nil, false
+	}
+	return &orgID, true
+}
+
+// respondIPNotAllowed responds 403 if err is services.ErrIPNotAllowed, as
+// the IPAllowlist middleware does, and reports whether it did
+func respondIPNotAllowed(c *gin.Context, err error) bool {
+	if !errors.Is(err, services.ErrIPNotAllowed) {
+		return false
+	}
+	apierror.Respond(c, http.StatusForbidden, apierror.CodeIPNotAllowed, "Access from this IP address is not allowed for this organization")
+	return true
+}
+
+// respondTemplateValuesError writes a 400 validation_failed error listing
+// each missing or unknown value in the request's field map, and returns
+// true, if err is a *services.TemplateValuesError
+func respondTemplateValuesError(c *gin.Context, err error, field string) bool {
+	var valuesErr *services.TemplateValuesError
+	if !errors.As(err, &valuesErr) {
+		return false
+	}
+
+	fields := make([]FieldError, 0, len(valuesErr.Missing)+len(valuesErr.Unknown))
+	for _, name := range valuesErr.Missing {
+		fields = append(fields, FieldError{Field: field + "." + name, Rule: "required", Message: "is required"})
+	}
+	for _, name := range valuesErr.Unknown {
+		fields = append(fields, FieldError{Field: field + "." + name, Rule: "unknown", Message: "is not a variable of the template"})
+	}
+	apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeValidationFailed, "Invalid template values", gin.H{
+		"fields": fields,
+	})
+	return true
+}
+
+// respondTemplateStructureError writes a 400 validation_failed error listing
+// each problem found in a template or agent config, and returns true, if err
+// is a *services.TemplateStructureError
+func respondTemplateStructureError(c *gin.Context, err error, message string) bool {
+	var structureErr *services.TemplateStructureError
+	if !errors.As(err, &structureErr) {
+		return false
+	}
+
+	fields := make([]FieldError, len(structureErr.Problems))
+	for i, p := range structureErr.Problems {
+		fields[i] = FieldError{Field: p.Field, Rule: p.Rule, Message: p.Message}
+	}
+	apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeValidationFailed, message, gin.H{
+		"fields": fields,
+	})
+	return true
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/go-playground/validator/v10"
+)
+
+// =====================================================
+// VALIDATION ERRORS
+// =====================================================
+
+// FieldError describes one invalid field in a request
+type FieldError struct {
+	Field   string `json:"field,omitempty"` // empty for errors about the body as a whole
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+func init() {
+	// Report fields by their wire names (json/form tags) rather than Go names
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterTagNameFunc(func(f reflect.StructField) string {
+			for _, tag := range []string{"json", "form"} {
+				name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+				if name == "-" {
+					return ""
+				}
+				if name != "" {
+					return name
+				}
+			}
+			return f.Name
+		})
+	}
+}
+
+// respondBindError writes a 400 validation_failed error for a ShouldBind*
+// failure, listing each invalid field in details.fields
+func respondBindError(c *gin.Context, err error, message string) {
+	apierror.RespondWithDetails(c, http.StatusBadRequest, apierror.CodeValidationFailed, message, gin.H{
+		"fields": bindingErrors(err),
+	})
+}
+
+// bindingErrors translates validator, JSON decoding and form binding errors
+// into per-field errors
+func bindingErrors(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		fields := make([]FieldError, 0, len(validationErrs))
+		for _, fe := range validationErrs {
+			fields = append(fields, FieldError{
+				Field:   fieldPath(fe.Namespace()),
+				Rule:    fe.Tag(),
+				Param:   fe.Param(),
+				Message: ruleMessage(fe.Tag(), fe.Param()),
+			})
+		}
+		return fields
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Param:   typeErr.Type.String(),
+			Message: fmt.Sprintf("must be of type %s", jsonTypeName(typeErr.Type)),
+		}}
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return []FieldError{{
+			Rule:    "json",
+			Message: fmt.Sprintf("malformed JSON at offset %d", syntaxErr.Offset),
+		}}
+	}
+
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return []FieldError{{Rule: "json", Message: "malformed JSON: unexpected end of input"}}
+	}
+
+	if errors.Is(err, io.EOF) {
+		return []FieldError{{Rule: "required", Message: "request body is required"}}
+	}
+
+	return []FieldError{{Rule: "format", Message: err.Error()}}
+}
+
+// fieldPath drops the root struct name from a validator namespace
+// ("CreateOrgRequest.settings.models[0].name" -> "settings.models[0].name")
+func fieldPath(namespace string) string {
+	if _, rest, ok := strings.Cut(namespace, "."); ok {
+		return rest
+	}
+	return namespace
+}
+
+func ruleMessage(rule, param string) string {
+	switch rule {
+	case "required":
+		return "is required"
+	case "min":
+		return fmt.Sprintf("must be at least %s", param)
+	case "max":
+		return fmt.Sprintf("must be at most %s", param)
+	case "len":
+		return fmt.Sprintf("must have length %s", param)
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(param, " ", ", "))
+	case "email":
+		return "must be a valid email address"
+	case "url":
+		return "must be a valid URL"
+	case "uuid", "uuid4":
+		return "must be a valid UUID"
+	case "gt", "gte", "lt", "lte":
+		return fmt.Sprintf("must be %s %s", map[string]string{"gt": ">", "gte": ">=", "lt": "<", "lte": "<="}[rule], param)
+	default:
+		return fmt.Sprintf("failed %s validation", rule)
+	}
+}
+
+// jsonTypeName names a Go type the way a JSON client would think of it
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return t.String()
+	}
+}
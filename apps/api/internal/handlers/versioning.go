@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+
+	"github.com/gin-gonic/gin"
+)
+
+// =====================================================
+// API VERSION SHIMS
+// =====================================================
+//
+// Handlers produce the v1 wire format. Each later version adapts it here, so
+// a breaking change is one shim rather than a fork of every handler.
+
+// listPagination is the v2 pagination block of list responses: the v1 block
+// of cursor-paginated lists plus the page's item count
+type listPagination struct {
+	Count      int    `json:"count"`
+	NextCursor string `json:"nextCursor,omitempty"`
+	HasMore    *bool  `json:"hasMore,omitempty"`
+	Total      *int   `json:"total,omitempty"`
+}
+
+// V2Response adapts v1 responses to v2. List responses ({"data": [...]},
+// with or without a "pagination" block) always have one:
+// {"data": [...], "pagination": {"count": n, ...}}.
+func V2Response(c *gin.Context, status int, body []byte) []byte {
+	if status >= 300 {
+		return body
+	}
+
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return body
+	}
+	data, ok := envelope["data"]
+	if !ok {
+		return body
+	}
+	var pagination listPagination
+	if raw, paginated := envelope["pagination"]; paginated {
+		if len(envelope) != 2 || json.Unmarshal(raw, &pagination) != nil {
+			return body
+		}
+	} else if len(envelope) != 1 {
+		return body
+	}
+
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return body
+	}
+	if items == nil {
+		// v1 sometimes encodes an empty list as null; v2 always uses []
+		data = json.RawMessage("[]")
+	}
+	pagination.Count = len(items)
+
+	out, err := json.Marshal(gin.H{
+		"data":       data,
+		"pagination": pagination,
+	})
+	if err != nil {
+		return body
+	}
+	return out
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/services"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// =====================================================
+// WEBHOOK HANDLER
+// =====================================================
+
+// WebhookHandler serves notification webhooks for the current user under
+// /me/webhooks, and for an org under /orgs/:orgId/webhooks
+type WebhookHandler struct {
+	svc    *services.WebhookService
+	logger *zap.Logger
+}
+
+func NewWebhookHandler(svc *services.WebhookService, logger *zap.Logger) *WebhookHandler {
+	return &WebhookHandler{svc: svc, logger: logger}
+}
+
+// owner returns the org in the path, or else the current user
+func (h *WebhookHandler) owner(c *gin.Context) (services.WebhookOwner, bool) {
+	if param := c.Param("orgId"); param != "" {
+		orgID, err := uuid.Parse(param)
+		if err != nil {
+			apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid organization ID")
+			return services.WebhookOwner{}, false
+		}
+		return services.WebhookOwner{OrgID: &orgID}, true
+	}
+
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return services.WebhookOwner{}, false
+	}
+	return services.WebhookOwner{UserID: &userID}, true
+}
+
+func (h *WebhookHandler) List(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	webhooks, err := h.svc.List(c.Request.Context(), owner)
+	if err != nil {
+		h.logger.Error("Failed to list webhooks", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to list webhooks")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": webhooks})
+}
+
+func (h *WebhookHandler) Create(c *gin.Context) {
+	userID, err := getUserUUID(c)
+	if err != nil {
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid user ID")
+		return
+	}
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	var req services.CreateWebhookRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		respondBindError(c, err, "Invalid request body")
+		return
+	}
+
+	webhook, err := h.svc.Create(c.Request.Context(), owner, userID, req)
+	if errors.Is(err, services.ErrInvalidWebhookURL) {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Webhook URL must be an https URL on a public host")
+		return
+	}
+	if errors.Is(err, services.ErrTooManyWebhooks) {
+		apierror.Respond(c, http.StatusConflict, apierror.CodeConflict, "Webhook limit reached")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to create webhook", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to create webhook")
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) Delete(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	webhookID, err := uuid.Parse(c.Param("webhookId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	err = h.svc.Delete(c.Request.Context(), owner, webhookID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to delete webhook", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to delete webhook")
+		return
+	}
+
+	c.JSON(http.StatusNoContent, nil)
+}
+
+// Test sends a test delivery and reports the receiver's response. A failed
+// delivery is still a 200; the result says what went wrong.
+func (h *WebhookHandler) Test(c *gin.Context) {
+	owner, ok := h.owner(c)
+	if !ok {
+		return
+	}
+
+	webhookID, err := uuid.Parse(c.Param("webhookId"))
+	if err != nil {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid webhook ID")
+		return
+	}
+
+	result, err := h.svc.Test(c.Request.Context(), owner, webhookID)
+	if errors.Is(err, services.ErrNotFound) {
+		apierror.Respond(c, http.StatusNotFound, apierror.CodeNotFound, "Webhook not found")
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to test webhook", zap.Error(err))
+		apierror.Respond(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to test webhook")
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/glassbox/api/internal/services"
+	"github.com/glassbox/api/internal/workerpb"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// =====================================================
+// WORKER GRPC SERVICE
+// =====================================================
+
+const (
+	// Trace events are stored in batches of this many as a stream arrives
+	traceBatchSize = 100
+
+	// Checkpoints can be large, so messages can be bigger than gRPC's 4MB
+	// default
+	maxWorkerMessageBytes = 16 << 20
+)
+
+var executionStatuses = map[workerpb.ExecutionStatus]string{
+	workerpb.ExecutionStatus_EXECUTION_STATUS_PENDING:        "pending",
+	workerpb.ExecutionStatus_EXECUTION_STATUS_RUNNING:        "running",
+	workerpb.ExecutionStatus_EXECUTION_STATUS_PAUSED:         "paused",
+	workerpb.ExecutionStatus_EXECUTION_STATUS_AWAITING_INPUT: "awaiting_input",
+	workerpb.ExecutionStatus_EXECUTION_STATUS_COMPLETE:       "complete",
+	workerpb.ExecutionStatus_EXECUTION_STATUS_FAILED:         "failed",
+	workerpb.ExecutionStatus_EXECUTION_STATUS_CANCELLED:      "cancelled",
+}
+
+var fileStatuses = map[workerpb.FileStatus]string{
+	workerpb.FileStatus_FILE_STATUS_PROCESSING: "processing",
+	workerpb.FileStatus_FILE_STATUS_PROCESSED:  "processed",
+	workerpb.FileStatus_FILE_STATUS_FAILED:     "failed",
+}
+
+// WorkerGRPC serves the gRPC worker API defined in
+// packages/proto/glassbox/worker/v1/worker.proto. Unlike the HTTP internal
+// routes, it stores what workers report before relaying it, the same way
+// those routes do.
+type WorkerGRPC struct {
+	workerpb.UnimplementedWorkerServiceServer
+	state    *services.WorkerStateService
+	internal *InternalHandler
+	logger   *zap.Logger
+}
+
+func NewWorkerGRPC(state *services.WorkerStateService, internal *InternalHandler, logger *zap.Logger) *WorkerGRPC {
+	return &WorkerGRPC{state: state, internal: internal, logger: logger}
+}
+
+// NewWorkerGRPCServer returns a gRPC server for the worker API and the
+// standard health service. Calls other than health checks must carry the
+// internal service token as "authorization: Bearer <token>" metadata.
+func NewWorkerGRPCServer(serviceToken string, worker *WorkerGRPC, logger *zap.Logger) *grpc.Server {
+	auth := workerAuth{token: serviceToken, logger: logger}
+	server := grpc.NewServer(
+		grpc.MaxRecvMsgSize(maxWorkerMessageBytes),
+		grpc.ChainUnaryInterceptor(auth.unary),
+		grpc.ChainStreamInterceptor(auth.stream),
+	)
+	workerpb.RegisterWorkerServiceServer(server, worker)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	return server
+}
+
+func (w *WorkerGRPC) UpdateExecutionStatus(ctx context.Context, req *workerpb.UpdateExecutionStatusRequest) (*workerpb.UpdateExecutionStatusResponse, error) {
+	executionID, err := parseGRPCID(req.GetExecutionId(), "execution_id")
+	if err != nil {
+		return nil, err
+	}
+	executionStatus, ok := executionStatuses[req.GetStatus()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	nodeID, err := w.state.UpdateExecutionStatus(ctx, services.ExecutionStatusUpdate{
+		ExecutionID:  executionID,
+		Status:       executionStatus,
+		TokensIn:     int(req.GetTokensIn()),
+		TokensOut:    int(req.GetTokensOut()),
+		ErrorMessage: req.GetErrorMessage(),
+	})
+	if err != nil {
+		return nil, w.grpcError(err, "update execution status", zap.String("executionId", executionID.String()))
+	}
+
+	w.internal.relayExecutionStatus(ctx, executionID, nodeID, executionStatus, int(req.GetTokensIn()), int(req.GetTokensOut()), req.GetTraceSummary())
+	return &workerpb.UpdateExecutionStatusResponse{NodeId: nodeID.String()}, nil
+}
+
+func (w *WorkerGRPC) IngestTrace(stream workerpb.WorkerService_IngestTraceServer) error {
+	ctx := stream.Context()
+	var stored int64
+	batch := make([]services.TraceEventInput, 0, traceBatchSize)
+	flush := func() error {
+		if err := w.state.InsertTraceEvents(ctx, batch); err != nil {
+			return w.grpcError(err, "store trace events")
+		}
+		stored += int64(len(batch))
+		batch = batch[:0]
+		return nil
+	}
+
+	for n := 1; ; n++ {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if err := flush(); err != nil {
+				return err
+			}
+			return stream.SendAndClose(&workerpb.IngestTraceResponse{Stored: stored})
+		}
+		if err != nil {
+			return err
+		}
+
+		input, err := traceEventInput(event)
+		if err == nil {
+			err = input.Validate()
+		}
+		if err != nil {
+			// Keep the events before the bad one
+			if err := flush(); err != nil {
+				return err
+			}
+			return status.Errorf(codes.InvalidArgument, "event %d: %s", n, strings.TrimPrefix(err.Error(), services.ErrInvalidWorkerReport.Error()+": "))
+		}
+		batch = append(batch, input)
+		if len(batch) == traceBatchSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// traceEventInput converts a streamed trace event
+func traceEventInput(event *workerpb.TraceEvent) (services.TraceEventInput, error) {
+	executionID, err := uuid.Parse(event.GetExecutionId())
+	if err != nil {
+		return services.TraceEventInput{}, errors.New("invalid execution_id")
+	}
+	input := services.TraceEventInput{
+		ExecutionID: executionID,
+		EventType:   event.GetEventType(),
+		EventData:   event.GetEventData(),
+		Model:       event.GetModel(),
+		DurationMs:  optionalInt(event.DurationMs),
+		TokensIn:    optionalInt(event.TokensIn),
+		TokensOut:   optionalInt(event.TokensOut),
+	}
+	if event.Timestamp != nil {
+		input.Timestamp = event.Timestamp.AsTime()
+	}
+	return input, nil
+}
+
+func (w *WorkerGRPC) SaveCheckpoint(ctx context.Context, req *workerpb.SaveCheckpointRequest) (*workerpb.SaveCheckpointResponse, error) {
+	executionID, err := parseGRPCID(req.GetExecutionId(), "execution_id")
+	if err != nil {
+		return nil, err
+	}
+	err = w.state.SaveCheckpoint(ctx, executionID, req.GetCheckpoint(), int(req.GetTokensIn()), int(req.GetTokensOut()))
+	if err != nil {
+		return nil, w.grpcError(err, "save checkpoint", zap.String("executionId", executionID.String()))
+	}
+	return &workerpb.SaveCheckpointResponse{}, nil
+}
+
+func (w *WorkerGRPC) GetCheckpoint(ctx context.Context, req *workerpb.GetCheckpointRequest) (*workerpb.GetCheckpointResponse, error) {
+	executionID, err := parseGRPCID(req.GetExecutionId(), "execution_id")
+	if err != nil {
+		return nil, err
+	}
+	cp, err := w.state.GetCheckpoint(ctx, executionID)
+	if err != nil {
+		return nil, w.grpcError(err, "get checkpoint", zap.String("executionId", executionID.String()))
+	}
+
+	resp := &workerpb.GetCheckpointResponse{
+		Checkpoint: cp.Checkpoint,
+		TokensIn:   int32(cp.TokensIn),
+		TokensOut:  int32(cp.TokensOut),
+	}
+	for s, name := range executionStatuses {
+		if name == cp.Status {
+			resp.Status = s
+		}
+	}
+	return resp, nil
+}
+
+func (w *WorkerGRPC) ReportFileResult(ctx context.Context, req *workerpb.ReportFileResultRequest) (*workerpb.ReportFileResultResponse, error) {
+	fileID, err := parseGRPCID(req.GetFileId(), "file_id")
+	if err != nil {
+		return nil, err
+	}
+	fileStatus, ok := fileStatuses[req.GetStatus()]
+	if !ok {
+		return nil, status.Error(codes.InvalidArgument, "status is required")
+	}
+
+	file, err := w.state.RecordFileResult(ctx, services.FileResult{
+		FileID:        fileID,
+		Status:        fileStatus,
+		ExtractedText: req.GetExtractedText(),
+		Embedding:     req.GetEmbedding(),
+		Error:         req.GetError(),
+	})
+	if err != nil {
+		return nil, w.grpcError(err, "record file result", zap.String("fileId", fileID.String()))
+	}
+
+	w.internal.relayFileStatus(fileID, file.OrgID, file.Filename, fileStatus, req.GetError())
+	return &workerpb.ReportFileResultResponse{}, nil
+}
+
+// grpcError maps a service error to a gRPC status, logging unexpected ones
+func (w *WorkerGRPC) grpcError(err error, action string, fields ...zap.Field) error {
+	switch {
+	case errors.Is(err, services.ErrNotFound):
+		return status.Error(codes.NotFound, "not found")
+	case errors.Is(err, services.ErrInvalidWorkerReport):
+		return status.Error(codes.InvalidArgument, strings.TrimPrefix(err.Error(), services.ErrInvalidWorkerReport.Error()+": "))
+	}
+	w.logger.Error("Failed to "+action, append(fields, zap.Error(err))...)
+	return status.Error(codes.Internal, "failed to "+action)
+}
+
+func parseGRPCID(s, field string) (uuid.UUID, error) {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, status.Errorf(codes.InvalidArgument, "invalid %s", field)
+	}
+	return id, nil
+}
+
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	n := int(*v)
+	return &n
+}
+
+// workerAuth authenticates gRPC calls with the internal service token, and
+// turns panics into Internal errors as gin.Recovery does for HTTP. Request
+// signing isn't supported over gRPC: there's no canonical body to sign.
+type workerAuth struct {
+	token  string
+	logger *zap.Logger
+}
+
+func (a workerAuth) unary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+	if err := a.authenticate(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	defer a.recover(info.FullMethod, &err)
+	return handler(ctx, req)
+}
+
+func (a workerAuth) stream(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	if err := a.authenticate(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	defer a.recover(info.FullMethod, &err)
+	return handler(srv, ss)
+}
+
+func (a workerAuth) authenticate(ctx context.Context, method string) error {
+	// Load balancers and orchestrators check health without credentials
+	if strings.HasPrefix(method, "/"+healthpb.Health_ServiceDesc.ServiceName+"/") {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(value, "Bearer ")
+		if ok && subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid internal credentials")
+}
+
+func (a workerAuth) recover(method string, err *error) {
+	if r := recover(); r != nil {
+		a.logger.Error("Panic in gRPC handler", zap.String("method", method), zap.String("panic", fmt.Sprint(r)), zap.Stack("stack"))
+		*err = status.Error(codes.Internal, "internal error")
+	}
+}
@@ -0,0 +1,116 @@
+// Package internalapi is the Go client of the API's worker-facing /internal
+// routes, for workers that run outside the API process. It mirrors
+// apps/workers/shared/internal_api.py.
+package internalapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/middleware"
+	"github.com/google/uuid"
+)
+
+const requestTimeout = 5 * time.Second
+
+// Client sends signed requests to the internal API
+type Client struct {
+	baseURL      string
+	hmacSecret   string
+	serviceToken string
+	http         *http.Client
+}
+
+// New creates a client for cfg.InternalAPIURL. Requests are HMAC-signed
+// when INTERNAL_HMAC_SECRET is set and carry the service token otherwise.
+func New(cfg *config.Config) *Client {
+	return &Client{
+		baseURL:      strings.TrimSuffix(cfg.InternalAPIURL, "/"),
+		hmacSecret:   cfg.InternalHMACSecret,
+		serviceToken: cfg.InternalServiceToken,
+		http:         &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// Enabled reports whether the client has credentials; the API disables its
+// internal routes without them
+func (c *Client) Enabled() bool {
+	return c.hmacSecret != "" || c.serviceToken != ""
+}
+
+// FileEvent reports a file's processing status: processing, processed or
+// failed
+type FileEvent struct {
+	OrgID    uuid.UUID `json:"orgId"`
+	Filename string    `json:"filename"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// PostFileEvent relays a file event to the org's WebSocket clients
+func (c *Client) PostFileEvent(ctx context.Context, fileID uuid.UUID, event FileEvent) error {
+	if len(event.Error) > 2000 {
+		event.Error = event.Error[:2000]
+	}
+	return c.post(ctx, "/files/"+fileID.String()+"/events", event)
+}
+
+// post sends a JSON payload to a path relative to the internal API URL. It
+// does nothing without credentials.
+func (c *Client) post(ctx context.Context, path string, payload any) error {
+	if !c.Enabled() {
+		return nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.hmacSecret != "" {
+		if err := c.sign(req, body); err != nil {
+			return err
+		}
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.serviceToken)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("internal API returned %s for %s", resp.Status, path)
+	}
+	return nil
+}
+
+// sign adds the X-Glassbox-* signature headers; see middleware.InternalAuth
+func (c *Client) sign(req *http.Request, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+	signature := middleware.SignInternalRequest(c.hmacSecret, req.Method, req.URL.RequestURI(), timestamp, nonceHex, body)
+	req.Header.Set(middleware.HeaderInternalTimestamp, timestamp)
+	req.Header.Set(middleware.HeaderInternalNonce, nonceHex)
+	req.Header.Set(middleware.HeaderInternalSignature, hex.EncodeToString(signature))
+	return nil
+}
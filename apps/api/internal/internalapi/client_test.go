@@ -0,0 +1,92 @@
+package internalapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/middleware"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+type claimAll map[string]bool
+
+func (c claimAll) ClaimNonce(_ context.Context, key string, _ time.Duration) (bool, error) {
+	fresh := !c[key]
+	c[key] = true
+	return fresh, nil
+}
+
+// TestClientPassesInternalAuth posts a file event to a server guarded by
+// middleware.InternalAuth, signed and with the service token
+func TestClientPassesInternalAuth(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		secret   string
+		token    string
+		wantAuth string
+	}{
+		{"signed", "hmac-secret", "service-token", "hmac"},
+		{"service token", "", "service-token", "token"},
+	} {
+		server := &config.Config{
+			InternalServiceToken:     "service-token",
+			InternalHMACSecret:       "hmac-secret",
+			InternalSignatureMaxSkew: time.Minute,
+		}
+		fileID := uuid.New()
+		var got FileEvent
+		var auth string
+		r := gin.New()
+		r.POST("/internal/files/:fileId/events", middleware.InternalAuth(server, claimAll{}, zap.NewNop()), func(c *gin.Context) {
+			auth = c.GetString(middleware.ContextInternalAuth)
+			if c.Param("fileId") != fileID.String() {
+				t.Errorf("%s: fileId = %s", tc.name, c.Param("fileId"))
+			}
+			if err := json.NewDecoder(c.Request.Body).Decode(&got); err != nil {
+				t.Errorf("%s: decode: %v", tc.name, err)
+			}
+			c.Status(http.StatusAccepted)
+		})
+		srv := httptest.NewServer(r)
+
+		client := New(&config.Config{InternalAPIURL: srv.URL + "/internal/", InternalHMACSecret: tc.secret, InternalServiceToken: tc.token})
+		event := FileEvent{OrgID: uuid.New(), Filename: "report.pdf", Status: "processed"}
+		err := client.PostFileEvent(context.Background(), fileID, event)
+		srv.Close()
+		if err != nil {
+			t.Fatalf("%s: PostFileEvent: %v", tc.name, err)
+		}
+		if auth != tc.wantAuth {
+			t.Fatalf("%s: authenticated by %q, want %q", tc.name, auth, tc.wantAuth)
+		}
+		if got != event {
+			t.Fatalf("%s: server got %+v, want %+v", tc.name, got, event)
+		}
+	}
+}
+
+func TestClientReportsRejection(t *testing.T) {
+	server := &config.Config{InternalHMACSecret: "hmac-secret", InternalSignatureMaxSkew: time.Minute}
+	r := gin.New()
+	r.POST("/internal/files/:fileId/events", middleware.InternalAuth(server, claimAll{}, zap.NewNop()), func(c *gin.Context) {
+		c.Status(http.StatusAccepted)
+	})
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	client := New(&config.Config{InternalAPIURL: srv.URL + "/internal", InternalHMACSecret: "other-secret"})
+	if err := client.PostFileEvent(context.Background(), uuid.New(), FileEvent{Status: "failed"}); err == nil {
+		t.Fatal("no error for a request the API rejected")
+	}
+}
@@ -0,0 +1,64 @@
+package mail
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMessage(t *testing.T) {
+	s, err := NewSMTP("smtp.example.com", "587", "", "", "GlassBox <no-reply@glassbox.io>")
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+	date := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+
+	msg, err := s.message("ada@example.com", "Digest:\r\nBcc: eve@example.com — 3 updates", "Line one\nLine two\r\n", date)
+	if err != nil {
+		t.Fatalf("message: %v", err)
+	}
+	header, body, ok := strings.Cut(string(msg), "\r\n\r\n")
+	if !ok {
+		t.Fatalf("no blank line after the headers: %q", msg)
+	}
+	for _, want := range []string{
+		`From: "GlassBox" <no-reply@glassbox.io>`,
+		"To: <ada@example.com>",
+		"Subject: =?utf-8?q?Digest:_Bcc:_eve@example.com_=E2=80=94_3_updates?=",
+		"Date: Fri, 16 Oct 2026 09:30:00 +0000",
+	} {
+		if !strings.Contains(header, want+"\r\n") {
+			t.Errorf("headers lack %q:\n%s", want, header)
+		}
+	}
+	// The subject's line break didn't start a header
+	if strings.Contains(header, "\r\nBcc:") {
+		t.Fatalf("subject injected a header:\n%s", header)
+	}
+	if body != "Line one\r\nLine two\r\n" {
+		t.Fatalf("body = %q", body)
+	}
+}
+
+func TestMessageRejectsRecipientHeaders(t *testing.T) {
+	s, err := NewSMTP("smtp.example.com", "587", "", "", "no-reply@glassbox.io")
+	if err != nil {
+		t.Fatalf("NewSMTP: %v", err)
+	}
+	for _, to := range []string{
+		"ada@example.com\r\nBcc: eve@example.com",
+		"Ada <ada@example.com>",
+		"ada@example.com, eve@example.com",
+		"not an address",
+	} {
+		if _, err := s.message(to, "Hello", "", time.Now()); err == nil {
+			t.Errorf("message to %q: no error", to)
+		}
+	}
+}
+
+func TestNewSMTPRejectsBadSender(t *testing.T) {
+	if _, err := NewSMTP("smtp.example.com", "587", "", "", "glassbox"); err == nil {
+		t.Fatal("no error for a sender without an address")
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+)
+
+// AuditSink receives audit entries. Implementations must not block the request.
+type AuditSink interface {
+	Record(entry models.RequestAuditEntry)
+}
+
+// Audit records every authenticated request (method, route, actor, org,
+// resource IDs, status, latency) to the given sink once the handler has run.
+// Must be registered after Auth.
+func Audit(sink AuditSink) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+
+		c.Next()
+
+		userID, err := uuid.Parse(GetUserID(c))
+		if err != nil {
+			return
+		}
+
+		entry := models.RequestAuditEntry{
+			UserID:      userID,
+			Method:      c.Request.Method,
+			Route:       c.FullPath(),
+			Path:        c.Request.URL.Path,
+			ResourceIDs: make(map[string]string),
+			Status:      c.Writer.Status(),
+			LatencyMs:   time.Since(start).Milliseconds(),
+			CreatedAt:   start,
+		}
+
+		// Route params named like "nodeId" identify the resources touched
+		for _, param := range c.Params {
+			if strings.HasSuffix(param.Key, "Id") {
+				entry.ResourceIDs[param.Key] = param.Value
+			}
+		}
+		if orgID, err := uuid.Parse(c.Param("orgId")); err == nil {
+			entry.OrgID = &orgID
+		}
+		if key := GetAPIKey(c); key != nil {
+			entry.APIKeyID = &key.ID
+		}
+
+		if requestID := c.GetString("request_id"); requestID != "" {
+			entry.RequestID = &requestID
+		}
+		if ip := c.ClientIP(); ip != "" {
+			entry.IPAddress = &ip
+		}
+		if ua := c.Request.UserAgent(); ua != "" {
+			entry.UserAgent = &ua
+		}
+
+		sink.Record(entry)
+	}
+}
@@ -1,43 +1,86 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
 	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/models"
 	"github.com/golang-jwt/jwt/v5"
 )
 
 type Claims struct {
-	UserID   string `json:"user_id"`
-	Email    string `json:"email"`
+	UserID     string `json:"user_id"`
+	Email      string `json:"email"`
 	CognitoSub string `json:"sub"`
 	jwt.RegisteredClaims
 }
 
 const (
-	ContextUserID     = "user_id"
-	ContextEmail      = "email"
-	ContextCognitoSub = "cognito_sub"
+	ContextUserID        = "user_id"
+	ContextEmail         = "email"
+	ContextCognitoSub    = "cognito_sub"
+	ContextTokenIssuedAt = "token_issued_at"
+	ContextAPIKey        = "api_key"
 )
 
+// HeaderAPIKey carries an org API key, in place of Authorization
+const HeaderAPIKey = "X-API-Key"
+
+// APIKeyAuthenticator looks up the org API key a request presents,
+// returning nil for unknown, revoked and expired keys
+type APIKeyAuthenticator interface {
+	AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, error)
+}
+
+// Auth requires a valid bearer token and stores its claims in the context
 func Auth(cfg *config.Config) gin.HandlerFunc {
+	return authenticate(cfg, nil)
+}
+
+// AuthWithAPIKeys is Auth that also accepts an org API key in the
+// X-API-Key header. The request acts as the key's creator; Authorize
+// confines it to the key's org and scopes, and RejectAPIKeys guards routes
+// it mustn't reach.
+func AuthWithAPIKeys(cfg *config.Config, keys APIKeyAuthenticator) gin.HandlerFunc {
+	return authenticate(cfg, keys)
+}
+
+func authenticate(cfg *config.Config, keys APIKeyAuthenticator) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if apiKey := c.GetHeader(HeaderAPIKey); keys != nil && apiKey != "" {
+			if authHeader != "" {
+				apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Send an API key or a bearer token, not both")
+				return
+			}
+			key, err := keys.AuthenticateAPIKey(c.Request.Context(), apiKey)
+			if err != nil {
+				apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check API key")
+				return
+			}
+			if key == nil {
+				apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid API key")
+				return
+			}
+			setAPIKey(c, key)
+			c.Next()
+			return
+		}
+
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Authorization header required",
-			})
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Authorization header required")
 			return
 		}
 
 		// Extract token from "Bearer <token>"
 		parts := strings.SplitN(authHeader, " ", 2)
 		if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "Invalid authorization header format",
-			})
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid authorization header format")
 			return
 		}
 
@@ -46,37 +89,55 @@ func Auth(cfg *config.Config) gin.HandlerFunc {
 		// In production, validate against Cognito JWKS
 		// For development, we'll use a simple JWT secret
 		if cfg.IsDevelopment() {
-			claims, err := validateDevToken(tokenString, cfg.JWTSecret)
+			claims, err := validateDevToken(tokenString, cfg)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Invalid token",
-				})
+				apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token")
 				return
 			}
-			c.Set(ContextUserID, claims.UserID)
-			c.Set(ContextEmail, claims.Email)
-			c.Set(ContextCognitoSub, claims.CognitoSub)
+			setClaims(c, claims)
 		} else {
 			claims, err := validateCognitoToken(tokenString, cfg)
 			if err != nil {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-					"error": "Invalid token",
-				})
+				apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid token")
 				return
 			}
-			c.Set(ContextUserID, claims.UserID)
-			c.Set(ContextEmail, claims.Email)
-			c.Set(ContextCognitoSub, claims.CognitoSub)
+			setClaims(c, claims)
 		}
 
 		c.Next()
 	}
 }
 
-func validateDevToken(tokenString string, secret string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+// setClaims stores a validated token's claims in the context
+func setClaims(c *gin.Context, claims *Claims) {
+	c.Set(ContextUserID, claims.UserID)
+	c.Set(ContextEmail, claims.Email)
+	c.Set(ContextCognitoSub, claims.CognitoSub)
+	if claims.IssuedAt != nil {
+		c.Set(ContextTokenIssuedAt, claims.IssuedAt.Time)
+	}
+}
+
+// setAPIKey stores an authenticated API key and the user it acts as in the
+// context. The key counts as a token issued when it was created, so
+// revoking the user's tokens revokes their older keys too.
+func setAPIKey(c *gin.Context, key *models.APIKey) {
+	c.Set(ContextUserID, key.CreatedBy.String())
+	c.Set(ContextTokenIssuedAt, key.CreatedAt)
+	c.Set(ContextAPIKey, key)
+}
+
+// validateDevToken verifies a token issued by AuthService.GenerateDevToken:
+// signature (HS256 or RS256 per config), expiry, issuer and audience
+func validateDevToken(tokenString string, cfg *config.Config) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, cfg.JWTKeyFunc,
+		jwt.WithValidMethods(cfg.JWTValidMethods()),
+		jwt.WithIssuer(cfg.JWTIssuer),
+		jwt.WithAudience(cfg.JWTAudience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(config.JWTLeeway),
+	)
 
 	if err != nil {
 		return nil, err
@@ -96,7 +157,7 @@ func validateCognitoToken(tokenString string, cfg *config.Config) (*Claims, erro
 	// 3. Verify claims (iss, aud, exp, etc.)
 
 	// For now, fall back to dev validation
-	return validateDevToken(tokenString, cfg.JWTSecret)
+	return validateDevToken(tokenString, cfg)
 }
 
 // GetUserID extracts the user ID from the Gin context
@@ -115,6 +176,37 @@ func GetEmail(c *gin.Context) string {
 	return ""
 }
 
+// GetTokenIssuedAt extracts when the token was issued from the Gin context,
+// zero if it doesn't say
+func GetTokenIssuedAt(c *gin.Context) time.Time {
+	if issuedAt, exists := c.Get(ContextTokenIssuedAt); exists {
+		return issuedAt.(time.Time)
+	}
+	return time.Time{}
+}
+
+// GetAPIKey extracts the API key the request was made with from the Gin
+// context, nil for bearer tokens
+func GetAPIKey(c *gin.Context) *models.APIKey {
+	if key, exists := c.Get(ContextAPIKey); exists {
+		return key.(*models.APIKey)
+	}
+	return nil
+}
+
+// RejectAPIKeys refuses requests made with an API key, for routes that act
+// on the user's own account or outside a single org. Must be registered
+// after Auth.
+func RejectAPIKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if GetAPIKey(c) != nil {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden, "API keys can't be used for this endpoint")
+			return
+		}
+		c.Next()
+	}
+}
+
 // GetCognitoSub extracts the Cognito sub from the Gin context
 func GetCognitoSub(c *gin.Context) string {
 	if sub, exists := c.Get(ContextCognitoSub); exists {
@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+)
+
+// AuthAttemptGuard tracks login/token attempts per IP and identity
+type AuthAttemptGuard interface {
+	Allow(ctx context.Context, ip, identity string) time.Duration
+	RecordFailure(ctx context.Context, ip, identity string)
+	RecordSuccess(ctx context.Context, ip, identity string)
+}
+
+// maxIdentityBodyBytes bounds how much of the body is read to find the identity
+const maxIdentityBodyBytes = 64 << 10
+
+// AuthGuard protects login/token endpoints from brute force. Attempts are
+// limited per client IP and per identity, read from the JSON body field
+// identityField (e.g. "email"). 401 and 403 responses count as failures and
+// lead to exponential lockouts; 2xx responses reset the identity's failures.
+func AuthGuard(guard AuthAttemptGuard, identityField string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		identity := bodyField(c, identityField)
+		ctx := c.Request.Context()
+
+		if wait := guard.Allow(ctx, ip, identity); wait > 0 {
+			seconds := int(wait.Round(time.Second).Seconds())
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			apierror.AbortWithDetails(c, http.StatusTooManyRequests, apierror.CodeTooManyAttempts,
+				"Too many attempts. Please try again later.", gin.H{"retryAfter": seconds})
+			return
+		}
+
+		c.Next()
+
+		switch status := c.Writer.Status(); {
+		case status == http.StatusUnauthorized || status == http.StatusForbidden:
+			guard.RecordFailure(ctx, ip, identity)
+		case status >= 200 && status < 300:
+			guard.RecordSuccess(ctx, ip, identity)
+		}
+	}
+}
+
+// bodyField reads a top-level string field from a JSON body, leaving the
+// body intact for the handler
+func bodyField(c *gin.Context, field string) string {
+	if field == "" || c.Request.Body == nil {
+		return ""
+	}
+
+	original := c.Request.Body
+	body, err := io.ReadAll(io.LimitReader(original, maxIdentityBodyBytes))
+	c.Request.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), original), original}
+	if err != nil {
+		return ""
+	}
+
+	var fields map[string]any
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	value, _ := fields[field].(string)
+	return value
+}
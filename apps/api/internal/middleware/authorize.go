@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+)
+
+const (
+	ContextOrgID   = "org_id"
+	ContextOrgRole = "org_role"
+)
+
+// Authorize checks that the authenticated user may perform action on the
+// resource named by the route params (the most specific of executionId,
+// fileId, nodeId, projectId, orgId). Must be registered after Auth.
+//
+// Non-members get 404 so resource existence isn't leaked; members whose role
+// lacks the permission get 403. Requests made with an API key are also
+// limited to the key's org and scopes. On success the resolved org ID and
+// role are stored in the context.
+func Authorize(az *authz.Authorizer, action authz.Action) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(GetUserID(c))
+		if err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "User not authenticated")
+			return
+		}
+
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		res, ok, err := authz.ResourceFromParams(params)
+		if !ok {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Route has no resource to authorize")
+			return
+		}
+		if err != nil {
+			apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Invalid resource ID")
+			return
+		}
+
+		if key := GetAPIKey(c); key != nil && !apiKeyAllows(c, az, key, action, res) {
+			return
+		}
+
+		decision, err := az.Authorize(c.Request.Context(), userID, action, res)
+		if errors.Is(err, authz.ErrNotFound) {
+			apierror.Abort(c, http.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+			return
+		}
+		if errors.Is(err, authz.ErrForbidden) {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden, "You do not have permission to perform this action")
+			return
+		}
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check permissions")
+			return
+		}
+
+		c.Set(ContextOrgID, decision.OrgID.String())
+		c.Set(ContextOrgRole, string(decision.Role))
+		c.Next()
+	}
+}
+
+// apiKeyAllows confines a request made with an API key to the key's org
+// and scopes, responding like Authorize when it doesn't. The key's creator
+// must still hold the permission; Authorize checks that next.
+func apiKeyAllows(c *gin.Context, az *authz.Authorizer, key *models.APIKey, action authz.Action, res authz.Resource) bool {
+	orgID, err := az.OrgFor(c.Request.Context(), res)
+	if errors.Is(err, authz.ErrNotFound) || (err == nil && orgID != key.OrgID) {
+		apierror.Abort(c, http.StatusNotFound, apierror.CodeNotFound, "Resource not found")
+		return false
+	}
+	if err != nil {
+		apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check permissions")
+		return false
+	}
+	if !slices.Contains(key.Scopes, string(action)) {
+		apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden, "API key lacks the "+string(action)+" scope")
+		return false
+	}
+	return true
+}
+
+// ActiveAccount rejects requests from deactivated and deleted users, and
+// tokens issued before the user's tokens were revoked. Must be registered
+// after Auth.
+func ActiveAccount(az *authz.Authorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(GetUserID(c))
+		if err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "User not authenticated")
+			return
+		}
+
+		account, err := az.Account(c.Request.Context(), userID)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check account")
+			return
+		}
+		if !account.Active {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeAccountDisabled, "Account is deactivated")
+			return
+		}
+		if GetTokenIssuedAt(c).Before(account.TokensRevokedAt) {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Token has been revoked")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePlatformAdmin restricts a route group to platform admins. Must be
+// registered after Auth.
+func RequirePlatformAdmin(az *authz.Authorizer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, err := uuid.Parse(GetUserID(c))
+		if err != nil {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "User not authenticated")
+			return
+		}
+
+		isAdmin, err := az.IsPlatformAdmin(c.Request.Context(), userID)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to check permissions")
+			return
+		}
+		if !isAdmin {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeForbidden, "Platform admin access required")
+			return
+		}
+
+		c.Next()
+	}
+}
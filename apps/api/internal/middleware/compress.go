@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	encodingGzip   = "gzip"
+	encodingBrotli = "br"
+)
+
+// compressibleTypes lists the content types worth compressing
+var compressibleTypes = []string{
+	"application/json",
+	"application/javascript",
+	"application/xml",
+	"text/",
+}
+
+// Compress negotiates gzip/br compression via Accept-Encoding and compresses
+// responses whose body is at least minSize bytes
+func Compress(minSize int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// WebSocket upgrades hijack the connection and must not be buffered
+		if strings.EqualFold(c.GetHeader("Upgrade"), "websocket") || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" {
+			c.Next()
+			return
+		}
+
+		original := c.Writer
+		cw := &compressWriter{ResponseWriter: original, encoding: encoding, minSize: minSize}
+		c.Writer = cw
+
+		defer func() {
+			// On a panic, drop the buffered response and hand the original
+			// writer back so the recovery middleware can write its 500
+			if r := recover(); r != nil {
+				c.Writer = original
+				panic(r)
+			}
+			cw.finish()
+			c.Writer = original
+		}()
+
+		c.Next()
+	}
+}
+
+// negotiateEncoding picks the preferred supported encoding from an Accept-Encoding header.
+// Brotli wins ties because it compresses JSON noticeably better than gzip.
+func negotiateEncoding(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	best := ""
+	bestQ := 0.0
+	for _, part := range strings.Split(header, ",") {
+		name, q := parseEncodingPart(part)
+		if name != encodingBrotli && name != encodingGzip {
+			continue
+		}
+		if q > bestQ || (q == bestQ && q > 0 && name == encodingBrotli) {
+			best = name
+			bestQ = q
+		}
+	}
+
+	return best
+}
+
+// parseEncodingPart parses a single "name;q=0.8" entry
+func parseEncodingPart(part string) (string, float64) {
+	fields := strings.Split(strings.TrimSpace(part), ";")
+	name := strings.ToLower(strings.TrimSpace(fields[0]))
+	q := 1.0
+	for _, param := range fields[1:] {
+		param = strings.TrimSpace(param)
+		if strings.HasPrefix(param, "q=") {
+			if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				q = v
+			}
+		}
+	}
+	return name, q
+}
+
+// compressWriter buffers the response so the compression decision can be made
+// once the full body size and content type are known
+type compressWriter struct {
+	gin.ResponseWriter
+	encoding    string
+	minSize     int
+	buf         bytes.Buffer
+	status      int
+	passthrough bool
+	finished    bool
+}
+
+func (w *compressWriter) WriteHeader(code int) {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.status = code
+}
+
+// WriteHeaderNow is deferred until finish so headers can still be changed
+func (w *compressWriter) WriteHeaderNow() {
+	if w.passthrough {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.Write(data)
+	}
+	return w.buf.Write(data)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	if w.passthrough {
+		return w.ResponseWriter.WriteString(s)
+	}
+	return w.buf.WriteString(s)
+}
+
+func (w *compressWriter) Status() int {
+	if w.passthrough || w.status == 0 {
+		return w.ResponseWriter.Status()
+	}
+	return w.status
+}
+
+func (w *compressWriter) Size() int {
+	if w.passthrough {
+		return w.ResponseWriter.Size()
+	}
+	return w.buf.Len()
+}
+
+func (w *compressWriter) Written() bool {
+	if w.passthrough {
+		return w.ResponseWriter.Written()
+	}
+	return w.status != 0 || w.buf.Len() > 0
+}
+
+// Flush switches to uncompressed streaming; streamed responses are not buffered
+func (w *compressWriter) Flush() {
+	if !w.passthrough {
+		w.flushUncompressed()
+		w.passthrough = true
+	}
+	w.ResponseWriter.Flush()
+}
+
+// finish writes the buffered response, compressing it when worthwhile
+func (w *compressWriter) finish() {
+	if w.finished || w.passthrough {
+		return
+	}
+	w.finished = true
+
+	if !w.shouldCompress() {
+		w.flushUncompressed()
+		return
+	}
+
+	var compressed bytes.Buffer
+	var encoder io.WriteCloser
+	switch w.encoding {
+	case encodingBrotli:
+		encoder = brotli.NewWriterLevel(&compressed, brotli.DefaultCompression)
+	default:
+		encoder = gzip.NewWriter(&compressed)
+	}
+
+	if _, err := encoder.Write(w.buf.Bytes()); err != nil {
+		w.flushUncompressed()
+		return
+	}
+	if err := encoder.Close(); err != nil {
+		w.flushUncompressed()
+		return
+	}
+
+	header := w.ResponseWriter.Header()
+	header.Set("Content-Encoding", w.encoding)
+	header.Add("Vary", "Accept-Encoding")
+	header.Del("Content-Length")
+	// A strong ETag identifies the uncompressed bytes
+	if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		header.Set("ETag", "W/"+etag)
+	}
+
+	w.ResponseWriter.WriteHeader(w.statusOrDefault())
+	w.ResponseWriter.Write(compressed.Bytes())
+}
+
+// flushUncompressed writes the buffered status and body as-is
+func (w *compressWriter) flushUncompressed() {
+	if w.isCompressibleType() {
+		w.ResponseWriter.Header().Add("Vary", "Accept-Encoding")
+	}
+	w.ResponseWriter.WriteHeader(w.statusOrDefault())
+	if w.buf.Len() > 0 {
+		w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+func (w *compressWriter) shouldCompress() bool {
+	status := w.statusOrDefault()
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if w.buf.Len() < w.minSize {
+		return false
+	}
+	if w.ResponseWriter.Header().Get("Content-Encoding") != "" {
+		return false
+	}
+	return w.isCompressibleType()
+}
+
+func (w *compressWriter) isCompressibleType() bool {
+	contentType := w.ResponseWriter.Header().Get("Content-Type")
+	for _, t := range compressibleTypes {
+		if strings.HasPrefix(contentType, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *compressWriter) statusOrDefault() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestCompressGzipsLargeJSON(t *testing.T) {
+	r := gin.New()
+	r.Use(Compress(10))
+	body := strings.Repeat("a", 100)
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"data": body})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(decoded), body) {
+		t.Fatalf("decoded body = %q", decoded)
+	}
+}
+
+// A panicking handler must reach the recovery middleware before anything is
+// written, or the client gets a 200 with a partial body instead of a 500
+func TestCompressLeavesPanicsToRecovery(t *testing.T) {
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+	}))
+	r.Use(Compress(0))
+	r.GET("/", func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		c.Writer.WriteString(`{"partial":`)
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "partial") {
+		t.Fatalf("buffered body leaked into the response: %q", w.Body.String())
+	}
+}
+
+func TestCompressWeakensStrongETag(t *testing.T) {
+	r := gin.New()
+	r.Use(Compress(0))
+	r.GET("/", func(c *gin.Context) {
+		c.Header("ETag", `"v1"`)
+		c.JSON(http.StatusOK, gin.H{"data": "x"})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Accept-Encoding", "br")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if got := w.Header().Get("ETag"); got != `W/"v1"` {
+		t.Fatalf("ETag = %q, want W/\"v1\"", got)
+	}
+}
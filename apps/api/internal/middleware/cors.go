@@ -1,35 +1,39 @@
 package middleware
 
 import (
+	"net/http"
+	"strconv"
+	"strings"
+
 	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/config"
 )
 
-func CORS(allowedOrigins []string) gin.HandlerFunc {
+func CORS(cfg *config.Config) gin.HandlerFunc {
+	allowMethods := strings.Join(cfg.CORSAllowedMethods, ", ")
+	allowHeaders := strings.Join(cfg.CORSAllowedHeaders, ", ")
+	exposeHeaders := strings.Join(cfg.CORSExposedHeaders, ", ")
+	maxAge := strconv.Itoa(cfg.CORSMaxAge)
+
 	return func(c *gin.Context) {
 		origin := c.Request.Header.Get("Origin")
 
-		// Check if origin is allowed
-		allowed := false
-		for _, o := range allowedOrigins {
-			if o == "*" || o == origin {
-				allowed = true
-				break
-			}
-		}
+		// The response depends on the Origin header, so caches must key on it
+		c.Writer.Header().Add("Vary", "Origin")
 
-		if allowed {
+		if origin != "" && cfg.IsOriginAllowed(origin) {
 			c.Header("Access-Control-Allow-Origin", origin)
+			c.Header("Access-Control-Allow-Credentials", "true")
+			c.Header("Access-Control-Expose-Headers", exposeHeaders)
 		}
 
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Accept, Authorization, X-Request-ID")
-		c.Header("Access-Control-Expose-Headers", "X-Request-ID")
-		c.Header("Access-Control-Allow-Credentials", "true")
-		c.Header("Access-Control-Max-Age", "86400")
-
-		// Handle preflight requests
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
+		// Handle preflight requests. Max-Age lets browsers cache the result
+		// instead of preflighting every non-simple request.
+		if c.Request.Method == http.MethodOptions {
+			c.Header("Access-Control-Allow-Methods", allowMethods)
+			c.Header("Access-Control-Allow-Headers", allowHeaders)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
 			return
 		}
 
@@ -0,0 +1,152 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/glassbox/api/internal/config"
+	"go.uber.org/zap"
+)
+
+// Headers carried by HMAC-signed internal requests
+const (
+	HeaderInternalTimestamp = "X-Glassbox-Timestamp" // Unix seconds
+	HeaderInternalNonce     = "X-Glassbox-Nonce"     // unique per request, 16-128 chars
+	HeaderInternalSignature = "X-Glassbox-Signature" // hex HMAC-SHA256 of the canonical request
+)
+
+// ContextInternalAuth records how an internal caller authenticated ("token" or "hmac")
+const ContextInternalAuth = "internal_auth"
+
+const (
+	internalNoncePrefix  = "internal_nonce:"
+	minNonceLength       = 16
+	maxNonceLength       = 128
+	maxInternalBodyBytes = 1 << 20
+)
+
+// NonceStore remembers nonces so signed requests cannot be replayed
+type NonceStore interface {
+	ClaimNonce(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// InternalAuth authenticates the worker-facing internal API. Callers either
+// send the shared service token as a bearer token, or sign the request with
+// the HMAC secret:
+//
+//	signature = hex(HMAC-SHA256(secret, METHOD \n PATH \n TIMESTAMP \n NONCE \n hex(sha256(BODY))))
+//
+// PATH includes the raw query string. Signed requests are rejected when the
+// timestamp is further than cfg.InternalSignatureMaxSkew from server time or
+// the nonce has been seen before.
+func InternalAuth(cfg *config.Config, nonces NonceStore, logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if cfg.InternalServiceToken == "" && cfg.InternalHMACSecret == "" {
+			apierror.Abort(c, http.StatusServiceUnavailable, apierror.CodeNotConfigured, "Internal API is not configured")
+			return
+		}
+
+		if c.GetHeader(HeaderInternalSignature) != "" {
+			authenticateSigned(c, cfg, nonces, logger)
+			return
+		}
+
+		token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if !ok || cfg.InternalServiceToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(cfg.InternalServiceToken)) != 1 {
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Invalid internal credentials")
+			return
+		}
+
+		c.Set(ContextInternalAuth, "token")
+		c.Next()
+	}
+}
+
+func authenticateSigned(c *gin.Context, cfg *config.Config, nonces NonceStore, logger *zap.Logger) {
+	if cfg.InternalHMACSecret == "" {
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Request signing is not enabled")
+		return
+	}
+
+	timestamp := c.GetHeader(HeaderInternalTimestamp)
+	nonce := c.GetHeader(HeaderInternalNonce)
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid request nonce")
+		return
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid request timestamp")
+		return
+	}
+	skew := time.Since(time.Unix(unix, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > cfg.InternalSignatureMaxSkew {
+		apierror.AbortWithDetails(c, http.StatusUnauthorized, apierror.CodeInvalidSignature,
+			"Request timestamp is outside the allowed clock skew",
+			gin.H{"serverTime": time.Now().Unix(), "maxSkewSeconds": int(cfg.InternalSignatureMaxSkew.Seconds())})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxInternalBodyBytes+1))
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, apierror.CodeBadRequest, "Failed to read request body")
+		return
+	}
+	if len(body) > maxInternalBodyBytes {
+		apierror.Abort(c, http.StatusRequestEntityTooLarge, apierror.CodeBadRequest, "Request body too large")
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	provided, err := hex.DecodeString(c.GetHeader(HeaderInternalSignature))
+	expected := SignInternalRequest(cfg.InternalHMACSecret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+	if err != nil || !hmac.Equal(provided, expected) {
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Invalid request signature")
+		return
+	}
+
+	// The signature is checked first so unauthenticated callers can't burn
+	// nonces. A nonce only needs to outlive the window its timestamp is valid in.
+	fresh, err := nonces.ClaimNonce(c.Request.Context(), internalNoncePrefix+nonce, 2*cfg.InternalSignatureMaxSkew)
+	if err != nil {
+		logger.Error("Failed to record internal request nonce", zap.Error(err))
+		apierror.Abort(c, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Unable to verify request")
+		return
+	}
+	if !fresh {
+		apierror.Abort(c, http.StatusUnauthorized, apierror.CodeInvalidSignature, "Request has already been processed")
+		return
+	}
+
+	c.Set(ContextInternalAuth, "hmac")
+	c.Next()
+}
+
+// SignInternalRequest computes the HMAC of the canonical request. Go callers
+// of the internal API (cmd/fileworker) sign with it too.
+func SignInternalRequest(secret, method, path, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		strings.ToUpper(method), path, timestamp, nonce, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(canonical))
+	return mac.Sum(nil)
+}
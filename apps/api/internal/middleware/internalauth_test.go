@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/config"
+	"go.uber.org/zap"
+)
+
+// nonceSet is a NonceStore in memory
+type nonceSet struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (s *nonceSet) ClaimNonce(_ context.Context, key string, _ time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[key] {
+		return false, nil
+	}
+	s.seen[key] = true
+	return true, nil
+}
+
+// signedRequest is a request to path signed at ts with nonce
+type signedRequest struct {
+	secret, path, body, nonce string
+	ts                        time.Time
+}
+
+func (r signedRequest) build() *http.Request {
+	req := httptest.NewRequest(http.MethodPost, r.path, strings.NewReader(r.body))
+	timestamp := strconv.FormatInt(r.ts.Unix(), 10)
+	req.Header.Set(HeaderInternalTimestamp, timestamp)
+	req.Header.Set(HeaderInternalNonce, r.nonce)
+	req.Header.Set(HeaderInternalSignature, hex.EncodeToString(
+		SignInternalRequest(r.secret, http.MethodPost, r.path, timestamp, r.nonce, []byte(r.body))))
+	return req
+}
+
+func TestInternalAuth(t *testing.T) {
+	cfg := &config.Config{
+		InternalServiceToken:     "service-token",
+		InternalHMACSecret:       "hmac-secret",
+		InternalSignatureMaxSkew: 5 * time.Minute,
+	}
+	r := gin.New()
+	r.POST("/internal/files/:fileId/events", InternalAuth(cfg, &nonceSet{seen: map[string]bool{}}, zap.NewNop()), func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.String(http.StatusOK, c.GetString(ContextInternalAuth)+" "+string(body))
+	})
+	serve := func(req *http.Request) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	valid := signedRequest{
+		secret: cfg.InternalHMACSecret,
+		path:   "/internal/files/f1/events?attempt=1",
+		body:   `{"status":"processed"}`,
+		nonce:  "0123456789abcdef",
+		ts:     time.Now(),
+	}
+	withNonce := func(r signedRequest, nonce string) signedRequest {
+		r.nonce = nonce
+		return r
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  func() *http.Request
+		want int
+		body string
+	}{
+		{"valid signature", func() *http.Request { return valid.build() }, http.StatusOK, `hmac {"status":"processed"}`},
+		{"replayed nonce", func() *http.Request { return valid.build() }, http.StatusUnauthorized, ""},
+		{"tampered body", func() *http.Request {
+			req := withNonce(valid, "tampered-body-nonce").build()
+			req.Body = io.NopCloser(strings.NewReader(`{"status":"failed"}`))
+			return req
+		}, http.StatusUnauthorized, ""},
+		{"tampered query", func() *http.Request {
+			req := withNonce(valid, "tampered-query-nonce").build()
+			req.URL.RawQuery = "attempt=2"
+			return req
+		}, http.StatusUnauthorized, ""},
+		{"wrong secret", func() *http.Request {
+			r := withNonce(valid, "wrong-secret-nonce")
+			r.secret = "guess"
+			return r.build()
+		}, http.StatusUnauthorized, ""},
+		{"stale timestamp", func() *http.Request {
+			r := withNonce(valid, "stale-timestamp-nonce")
+			r.ts = time.Now().Add(-cfg.InternalSignatureMaxSkew - time.Minute)
+			return r.build()
+		}, http.StatusUnauthorized, ""},
+		{"future timestamp", func() *http.Request {
+			r := withNonce(valid, "future-timestamp-nonce")
+			r.ts = time.Now().Add(cfg.InternalSignatureMaxSkew + time.Minute)
+			return r.build()
+		}, http.StatusUnauthorized, ""},
+		{"short nonce", func() *http.Request { return withNonce(valid, "short").build() }, http.StatusUnauthorized, ""},
+		{"service token", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/internal/files/f1/events", strings.NewReader("{}"))
+			req.Header.Set("Authorization", "Bearer service-token")
+			return req
+		}, http.StatusOK, "token {}"},
+		{"wrong service token", func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/internal/files/f1/events", nil)
+			req.Header.Set("Authorization", "Bearer service-tokem")
+			return req
+		}, http.StatusUnauthorized, ""},
+		{"no credentials", func() *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/internal/files/f1/events", nil)
+		}, http.StatusUnauthorized, ""},
+	} {
+		w := serve(tc.req())
+		if w.Code != tc.want {
+			t.Errorf("%s: status = %d, want %d: %s", tc.name, w.Code, tc.want, w.Body.String())
+			continue
+		}
+		if tc.body != "" && w.Body.String() != tc.body {
+			t.Errorf("%s: body = %q, want %q", tc.name, w.Body.String(), tc.body)
+		}
+	}
+}
+
+func TestInternalAuthNonceSurvivesBadSignature(t *testing.T) {
+	cfg := &config.Config{InternalHMACSecret: "hmac-secret", InternalSignatureMaxSkew: time.Minute}
+	r := gin.New()
+	r.POST("/internal/ping", InternalAuth(cfg, &nonceSet{seen: map[string]bool{}}, zap.NewNop()), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	// A forged request doesn't use up the nonce of the genuine one
+	req := signedRequest{secret: "guess", path: "/internal/ping", nonce: "shared-nonce-value", ts: time.Now()}
+	for i, secret := range []string{"guess", cfg.InternalHMACSecret} {
+		req.secret = secret
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req.build())
+		if want := []int{http.StatusUnauthorized, http.StatusOK}[i]; w.Code != want {
+			t.Fatalf("request signed with %q: status = %d, want %d", secret, w.Code, want)
+		}
+	}
+}
+
+func TestInternalAuthNotConfigured(t *testing.T) {
+	r := gin.New()
+	r.POST("/internal/ping", InternalAuth(&config.Config{}, &nonceSet{seen: map[string]bool{}}, zap.NewNop()), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	req := httptest.NewRequest(http.MethodPost, "/internal/ping", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want 503", w.Code)
+	}
+}
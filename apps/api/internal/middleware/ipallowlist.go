@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/google/uuid"
+)
+
+// IPAllowlistChecker resolves which org a request touches and whether the
+// client IP is inside that org's allowlist
+type IPAllowlistChecker interface {
+	ResolveOrgID(ctx context.Context, params map[string]string) (*uuid.UUID, error)
+	IsIPAllowed(ctx context.Context, orgID uuid.UUID, ip string) (bool, error)
+}
+
+// IPAllowlist rejects requests touching an org's resources from outside the
+// org's configured CIDR ranges. The org is resolved from route params
+// (orgId, projectId, nodeId, fileId, executionId); routes without one pass through.
+func IPAllowlist(checker IPAllowlistChecker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		params := make(map[string]string, len(c.Params))
+		for _, p := range c.Params {
+			params[p.Key] = p.Value
+		}
+		if len(params) == 0 {
+			c.Next()
+			return
+		}
+
+		orgID, err := checker.ResolveOrgID(c.Request.Context(), params)
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify network access")
+			return
+		}
+		if orgID == nil {
+			c.Next()
+			return
+		}
+
+		allowed, err := checker.IsIPAllowed(c.Request.Context(), *orgID, c.ClientIP())
+		if err != nil {
+			apierror.Abort(c, http.StatusInternalServerError, apierror.CodeInternal, "Failed to verify network access")
+			return
+		}
+		if !allowed {
+			apierror.Abort(c, http.StatusForbidden, apierror.CodeIPNotAllowed, "Access from this IP address is not allowed for this organization")
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// allowIPs allows the IPs in it for every org and records what it was asked
+type allowIPs struct {
+	allowed map[string]bool
+	asked   string
+}
+
+func (a *allowIPs) ResolveOrgID(_ context.Context, params map[string]string) (*uuid.UUID, error) {
+	orgID, err := uuid.Parse(params["orgId"])
+	if err != nil {
+		return nil, nil
+	}
+	return &orgID, nil
+}
+
+func (a *allowIPs) IsIPAllowed(_ context.Context, _ uuid.UUID, ip string) (bool, error) {
+	a.asked = ip
+	return a.allowed[ip], nil
+}
+
+func TestIPAllowlistClientIP(t *testing.T) {
+	checker := &allowIPs{allowed: map[string]bool{"203.0.113.7": true}}
+	r := gin.New()
+	// Only the load balancer's X-Forwarded-For is believed
+	if err := r.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+		t.Fatal(err)
+	}
+	r.Use(IPAllowlist(checker))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/orgs/:orgId", ok)
+	r.GET("/me", ok)
+	orgPath := "/orgs/" + uuid.NewString()
+
+	for _, tc := range []struct {
+		name, path, remote, forwarded string
+		wantIP                        string
+		want                          int
+	}{
+		{"direct client", orgPath, "203.0.113.7:5000", "", "203.0.113.7", http.StatusOK},
+		{"direct client outside", orgPath, "198.51.100.1:5000", "", "198.51.100.1", http.StatusForbidden},
+		{"through the proxy", orgPath, "10.1.1.1:5000", "203.0.113.7", "203.0.113.7", http.StatusOK},
+		{"through the proxy, outside", orgPath, "10.1.1.1:5000", "198.51.100.1", "198.51.100.1", http.StatusForbidden},
+		// The proxy appends the client to whatever the client sent
+		{"spoofed through the proxy", orgPath, "10.1.1.1:5000", "203.0.113.7, 198.51.100.1", "198.51.100.1", http.StatusForbidden},
+		{"spoofed directly", orgPath, "198.51.100.1:5000", "203.0.113.7", "198.51.100.1", http.StatusForbidden},
+		{"no org", "/me", "198.51.100.1:5000", "", "", http.StatusOK},
+	} {
+		checker.asked = ""
+		req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+		req.RemoteAddr = tc.remote
+		if tc.forwarded != "" {
+			req.Header.Set("X-Forwarded-For", tc.forwarded)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != tc.want || checker.asked != tc.wantIP {
+			t.Errorf("%s: status %d checking %q, want %d checking %q", tc.name, w.Code, checker.asked, tc.want, tc.wantIP)
+		}
+	}
+}
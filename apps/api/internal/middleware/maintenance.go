@@ -0,0 +1,65 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
+)
+
+// MaintenanceChecker reports whether the API is currently read-only
+type MaintenanceChecker interface {
+	ReadOnly(ctx context.Context) (bool, string)
+}
+
+// Maintenance rejects mutating requests with 503 while the API is in read-only
+// mode. Reads keep working. Paths in exempt (full paths, e.g. "/api/v1/auth/ws-token")
+// are always allowed; one ending in "/*" exempts everything under it. A path
+// may also be a route pattern with params, e.g. "/api/v1/orgs/:orgId/search",
+// for reads that are POSTed.
+func Maintenance(checker MaintenanceChecker, exempt ...string) gin.HandlerFunc {
+	exemptPaths := make(map[string]bool, len(exempt))
+	var exemptPrefixes []string
+	for _, p := range exempt {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			exemptPrefixes = append(exemptPrefixes, prefix)
+			continue
+		}
+		exemptPaths[p] = true
+	}
+	exempted := func(c *gin.Context) bool {
+		path := c.Request.URL.Path
+		if exemptPaths[path] || exemptPaths[c.FullPath()] {
+			return true
+		}
+		for _, prefix := range exemptPrefixes {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if exempted(c) {
+			c.Next()
+			return
+		}
+
+		if readOnly, message := checker.ReadOnly(c.Request.Context()); readOnly {
+			c.Header("Retry-After", "60")
+			apierror.AbortWithDetails(c, http.StatusServiceUnavailable, apierror.CodeMaintenance,
+				message, gin.H{"retryAfter": 60})
+			return
+		}
+
+		c.Next()
+	}
+}
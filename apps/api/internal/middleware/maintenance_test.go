@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+type readOnly bool
+
+func (r readOnly) ReadOnly(context.Context) (bool, string) {
+	return bool(r), "down for maintenance"
+}
+
+func TestMaintenanceExemptions(t *testing.T) {
+	r := gin.New()
+	r.Use(Maintenance(readOnly(true),
+		"/api/v1/auth/ws-token",
+		"/api/v1/orgs/:orgId/search",
+		"/internal/*",
+	))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/api/v1/auth/ws-token", ok)
+	r.GET("/api/v1/orgs/:orgId", ok)
+	r.PATCH("/api/v1/orgs/:orgId", ok)
+	r.POST("/api/v1/orgs/:orgId/search", ok)
+	r.POST("/api/v1/orgs/:orgId/search/semantic", ok)
+	r.POST("/internal/executions/:executionId/progress", ok)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/v1/orgs/acme", http.StatusOK},
+		{http.MethodPatch, "/api/v1/orgs/acme", http.StatusServiceUnavailable},
+		{http.MethodPost, "/api/v1/auth/ws-token", http.StatusOK},
+		{http.MethodPost, "/api/v1/orgs/acme/search", http.StatusOK},
+		// Patterns match whole routes, not their prefixes
+		{http.MethodPost, "/api/v1/orgs/acme/search/semantic", http.StatusServiceUnavailable},
+		{http.MethodPost, "/internal/executions/1/progress", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.want {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, w.Code, tc.want)
+		}
+	}
+}
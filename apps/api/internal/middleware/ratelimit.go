@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
 	"github.com/glassbox/api/internal/config"
 	"golang.org/x/time/rate"
 )
@@ -19,19 +20,16 @@ func RateLimit(cfg *config.Config) gin.HandlerFunc {
 		// Get user ID for per-user rate limiting
 		userID := GetUserID(c)
 		if userID == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
-				"error": "User not authenticated",
-			})
+			apierror.Abort(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "User not authenticated")
 			return
 		}
 
 		// For development, use simple in-memory rate limiter
 		if cfg.IsDevelopment() {
 			if !limiter.Allow() {
-				c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
-					"error":       "Rate limit exceeded",
-					"retry_after": 60,
-				})
+				c.Header("Retry-After", "60")
+				apierror.AbortWithDetails(c, http.StatusTooManyRequests, apierror.CodeRateLimited,
+					"Rate limit exceeded", gin.H{"retryAfter": 60})
 				return
 			}
 			c.Next()
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ContextAPIVersion = "api_version"
+
+// APIVersion records which API version a route group serves, for handlers and
+// shims, and echoes it in the API-Version response header
+func APIVersion(version string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(ContextAPIVersion, version)
+		c.Header("API-Version", version)
+		c.Next()
+	}
+}
+
+// GetAPIVersion returns the API version of the current route, or "" outside
+// versioned groups
+func GetAPIVersion(c *gin.Context) string {
+	return c.GetString(ContextAPIVersion)
+}
+
+// Deprecated marks every response in a route group as deprecated
+// (Deprecation, RFC 9745) and, when sunset is set, announces the date it stops
+// working (Sunset, RFC 8594). successor is linked as the replacement version.
+func Deprecated(deprecatedAt, sunset *time.Time, successor string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if deprecatedAt != nil {
+			c.Header("Deprecation", "@"+strconv.FormatInt(deprecatedAt.Unix(), 10))
+		} else {
+			c.Header("Deprecation", "true")
+		}
+		if sunset != nil {
+			c.Header("Sunset", sunset.UTC().Format(http.TimeFormat))
+		}
+		if successor != "" {
+			c.Writer.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		c.Next()
+	}
+}
+
+// ResponseTransform rewrites a buffered JSON response body. It returns the
+// body unchanged when it has nothing to adapt.
+type ResponseTransform func(c *gin.Context, status int, body []byte) []byte
+
+// TransformResponse buffers JSON responses and passes them through transform
+// before they are written. Handlers keep producing one wire format; each API
+// version registers the shims that adapt it, so breaking changes can ship on
+// a new version without touching existing clients.
+//
+// Requests are adapted the same way with an ordinary middleware that rewrites
+// c.Request before the handler runs.
+func TransformResponse(transform ResponseTransform) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		original := c.Writer
+		tw := &transformWriter{ResponseWriter: original}
+		c.Writer = tw
+
+		defer func() {
+			c.Writer = original
+			// On a panic, drop the buffered response so the recovery
+			// middleware can write its 500
+			if r := recover(); r != nil {
+				panic(r)
+			}
+			tw.finish(c, transform)
+		}()
+
+		c.Next()
+	}
+}
+
+// transformWriter buffers the body so it can be rewritten once complete
+type transformWriter struct {
+	gin.ResponseWriter
+	buf    bytes.Buffer
+	status int
+}
+
+func (w *transformWriter) WriteHeader(code int) {
+	w.status = code
+}
+
+// WriteHeaderNow is deferred until finish so Content-Length can still change
+func (w *transformWriter) WriteHeaderNow() {}
+
+func (w *transformWriter) Write(data []byte) (int, error) {
+	return w.buf.Write(data)
+}
+
+func (w *transformWriter) WriteString(s string) (int, error) {
+	return w.buf.WriteString(s)
+}
+
+func (w *transformWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+func (w *transformWriter) Size() int {
+	return w.buf.Len()
+}
+
+func (w *transformWriter) Written() bool {
+	return w.status != 0 || w.buf.Len() > 0
+}
+
+func (w *transformWriter) finish(c *gin.Context, transform ResponseTransform) {
+	status := w.Status()
+	body := w.buf.Bytes()
+
+	if len(body) > 0 && strings.HasPrefix(w.ResponseWriter.Header().Get("Content-Type"), "application/json") {
+		body = transform(c, status, body)
+		w.ResponseWriter.Header().Del("Content-Length")
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+	if len(body) > 0 {
+		w.ResponseWriter.Write(body)
+	} else {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestTransformResponseRewritesJSON(t *testing.T) {
+	r := gin.New()
+	r.Use(TransformResponse(func(_ *gin.Context, _ int, body []byte) []byte {
+		return []byte(strings.ToUpper(string(body)))
+	}))
+	r.GET("/", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"name": "node"})
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Body.String(); got != `{"NAME":"NODE"}` {
+		t.Fatalf("body = %q", got)
+	}
+}
+
+func TestTransformResponseLeavesPanicsToRecovery(t *testing.T) {
+	r := gin.New()
+	r.Use(gin.CustomRecovery(func(c *gin.Context, _ any) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "internal"})
+	}))
+	r.Use(TransformResponse(func(_ *gin.Context, _ int, body []byte) []byte { return body }))
+	r.GET("/", func(c *gin.Context) {
+		c.Header("Content-Type", "application/json")
+		c.Writer.WriteString(`{"partial":`)
+		panic("boom")
+	})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "partial") {
+		t.Fatalf("buffered body leaked into the response: %q", w.Body.String())
+	}
+}
@@ -31,6 +31,15 @@ type OrganizationSettings struct {
 	SelfHostedEndpoint string         `json:"selfHostedEndpoint,omitempty"`
 	DefaultModel       string         `json:"defaultModel,omitempty"`
 	AgentPolicies      []AgentPolicy  `json:"agentPolicies,omitempty"`
+	// Extra browser origins (e.g. a customer's embedding domain) allowed to
+	// open WebSocket connections for the org's members
+	AllowedOrigins     []string       `json:"allowedOrigins,omitempty"`
+	// Days soft-deleted nodes are kept before they're purged; unset uses
+	// the server default (PURGE_RETENTION_DAYS)
+	DeletedRetentionDays *int         `json:"deletedRetentionDays,omitempty" binding:"omitempty,min=1,max=3650"`
+	// Record every change to the org's nodes, files and executions in the
+	// audit log with database triggers
+	RowAudit           bool           `json:"rowAudit,omitempty"`
 }
 
 type ModelConfig struct {
@@ -40,12 +49,41 @@ type ModelConfig struct {
 	APIBase     string `json:"apiBase,omitempty"`
 }
 
+// AgentPolicy controls one agent tool, named by Action (e.g.
+// "create_subnode"). Org policies apply to every execution in the org; a
+// template's can only tighten them.
 type AgentPolicy struct {
 	Action          string `json:"action"`
 	Allowed         bool   `json:"allowed"`
 	RequiresApproval bool  `json:"requiresApproval,omitempty"`
 }
 
+// OrgIPAllowlistEntry is a CIDR range allowed to access an organization's resources.
+// An org with no entries is unrestricted.
+type OrgIPAllowlistEntry struct {
+	ID          UUID      `json:"id" db:"id"`
+	OrgID       UUID      `json:"orgId" db:"org_id"`
+	CIDR        string    `json:"cidr" db:"cidr"`
+	Description *string   `json:"description,omitempty" db:"description"`
+	CreatedBy   *UUID     `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt   time.Time `json:"createdAt" db:"created_at"`
+}
+
+// APIKey is an org-scoped key for automations. Requests made with it act
+// as CreatedBy, limited to OrgID and Scopes (authz actions). The key itself
+// is only returned when it's created.
+type APIKey struct {
+	ID         UUID       `json:"id" db:"id"`
+	OrgID      UUID       `json:"orgId" db:"org_id"`
+	Name       string     `json:"name" db:"name"`
+	Prefix     string     `json:"prefix" db:"prefix"`
+	Scopes     []string   `json:"scopes" db:"scopes"`
+	CreatedBy  UUID       `json:"createdBy" db:"created_by"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+}
+
 // =====================================================
 // USERS
 // =====================================================
@@ -70,6 +108,29 @@ type NotificationPreferences struct {
 	Email bool `json:"email"`
 	InApp bool `json:"inApp"`
 	Slack bool `json:"slack,omitempty"`
+	// Low-priority notifications (node updates, membership changes) are
+	// stored without being pushed, and summarized "daily" or "weekly" at
+	// DigestHour (UTC), on DigestDay (0 is Sunday) for weekly digests
+	Digest     string `json:"digest,omitempty" binding:"omitempty,oneof=off daily weekly"`
+	DigestHour int    `json:"digestHour,omitempty" binding:"min=0,max=23"`
+	DigestDay  int    `json:"digestDay,omitempty" binding:"min=0,max=6"`
+	// Channels ("inApp", "email", "push") per notification type, overriding
+	// the switches above for that type. An empty list turns the type off.
+	Types map[string][]string `json:"types,omitempty" binding:"omitempty,max=20,dive,keys,oneof=node_updated node_assigned execution_complete execution_failed human_input_needed approval_request mention membership_changed digest,endkeys,max=3,dive,oneof=inApp email push"`
+	// Email and push of non-urgent notifications wait until quiet hours
+	// end; in-app notifications are still recorded. Windows are in
+	// TimeZone (IANA name, UTC when empty).
+	QuietHours []QuietHours `json:"quietHours,omitempty" binding:"omitempty,max=7,dive"`
+	TimeZone   string       `json:"timeZone,omitempty" binding:"omitempty,timezone"`
+}
+
+// QuietHours is a window from Start to End ("HH:MM", local time), ending the
+// next day when End isn't after Start. Days are the days it starts on (0 is
+// Sunday), every day when empty.
+type QuietHours struct {
+	Start string `json:"start" binding:"required,datetime=15:04"`
+	End   string `json:"end" binding:"required,datetime=15:04"`
+	Days  []int  `json:"days,omitempty" binding:"omitempty,max=7,dive,min=0,max=6"`
 }
 
 type OrgMember struct {
@@ -86,19 +147,25 @@ type OrgMember struct {
 // =====================================================
 
 type Project struct {
-	ID             UUID            `json:"id" db:"id"`
-	OrgID          UUID            `json:"orgId" db:"org_id"`
-	Name           string          `json:"name" db:"name"`
-	Description    *string         `json:"description,omitempty" db:"description"`
-	Settings       ProjectSettings `json:"settings" db:"settings"`
-	WorkflowStates []string        `json:"workflowStates" db:"workflow_states"`
-	CreatedAt      time.Time       `json:"createdAt" db:"created_at"`
-	UpdatedAt      time.Time       `json:"updatedAt" db:"updated_at"`
+	ID              UUID            `json:"id" db:"id"`
+	OrgID           UUID            `json:"orgId" db:"org_id"`
+	Name            string          `json:"name" db:"name"`
+	Description     *string         `json:"description,omitempty" db:"description"`
+	Settings        ProjectSettings `json:"settings" db:"settings"`
+	WorkflowStates  []string        `json:"workflowStates" db:"workflow_states"`
+	TemplateID      *UUID           `json:"templateId,omitempty" db:"template_id"`
+	TemplateVersion *int            `json:"templateVersion,omitempty" db:"template_version"`
+	CreatedAt       time.Time       `json:"createdAt" db:"created_at"`
+	UpdatedAt       time.Time       `json:"updatedAt" db:"updated_at"`
 }
 
 type ProjectSettings struct {
 	DefaultNodeStatus string `json:"defaultNodeStatus,omitempty"`
 	AutoAssignAgent   bool   `json:"autoAssignAgent,omitempty"`
+
+	// Agent defaults for the project's nodes, between the template's and
+	// the org's
+	AgentConfig *AgentConfig `json:"agentConfig,omitempty"`
 }
 
 // =====================================================
@@ -142,6 +209,9 @@ type Node struct {
 	LockedBy         *UUID           `json:"lockedBy,omitempty" db:"locked_by"`
 	LockedAt         *time.Time      `json:"lockedAt,omitempty" db:"locked_at"`
 	LockExpiresAt    *time.Time      `json:"lockExpiresAt,omitempty" db:"lock_expires_at"`
+	TemplateID       *UUID           `json:"templateId,omitempty" db:"template_id"`
+	TemplateVersion  *int            `json:"templateVersion,omitempty" db:"template_version"`
+	AgentConfig      *AgentConfig    `json:"agentConfig,omitempty" db:"agent_config"`
 	CreatedAt        time.Time       `json:"createdAt" db:"created_at"`
 	UpdatedAt        time.Time       `json:"updatedAt" db:"updated_at"`
 	DeletedAt        *time.Time      `json:"deletedAt,omitempty" db:"deleted_at"`
@@ -224,6 +294,7 @@ type AgentExecution struct {
 	ID                 UUID         `json:"id" db:"id"`
 	NodeID             UUID         `json:"nodeId" db:"node_id"`
 	Status             string       `json:"status" db:"status"`
+	Priority           string       `json:"priority,omitempty" db:"priority"`
 	LanggraphThreadID  *string      `json:"langgraphThreadId,omitempty" db:"langgraph_thread_id"`
 	TraceSummary       []TraceEvent `json:"traceSummary" db:"trace_summary"`
 	StartedAt          *time.Time   `json:"startedAt,omitempty" db:"started_at"`
@@ -261,43 +332,141 @@ type Template struct {
 	Structure   TemplateStructure `json:"structure" db:"structure"`
 	AgentConfig AgentConfig       `json:"agentConfig" db:"agent_config"`
 	IsPublic    bool              `json:"isPublic" db:"is_public"`
+	Version     int               `json:"version" db:"version"`
+	Categories  []string          `json:"categories" db:"categories"`
+	IsFeatured  bool              `json:"isFeatured" db:"is_featured"`
+	UsageCount  int               `json:"usageCount" db:"usage_count"`
+	Rating      *float64          `json:"rating,omitempty"` // average of 1-5, nil when unrated
+	RatingCount int               `json:"ratingCount" db:"rating_count"`
 	CreatedAt   time.Time         `json:"createdAt" db:"created_at"`
 	UpdatedAt   time.Time         `json:"updatedAt" db:"updated_at"`
 	CreatedBy   *UUID             `json:"createdBy,omitempty" db:"created_by"`
 }
 
+// TemplateCategory is a category of the public catalog and how many
+// templates are in it
+type TemplateCategory struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// TemplatePreview is what applying a template would create
+type TemplatePreview struct {
+	Nodes   []Node                `json:"nodes"`
+	Inputs  []NodeInput           `json:"inputs"`
+	Outputs []NodeOutput          `json:"outputs"`
+	Edges   []TemplatePreviewEdge `json:"edges"`
+}
+
+// TemplatePreviewEdge links two nodes of a preview. Type is "parent": From
+// is To's parent.
+type TemplatePreviewEdge struct {
+	From UUID   `json:"from"`
+	To   UUID   `json:"to"`
+	Type string `json:"type"`
+}
+
+// TemplateVersion is a template as it was at one version
+type TemplateVersion struct {
+	ID          UUID              `json:"id" db:"id"`
+	TemplateID  UUID              `json:"templateId" db:"template_id"`
+	Version     int               `json:"version" db:"version"`
+	Name        string            `json:"name" db:"name"`
+	Description *string           `json:"description,omitempty" db:"description"`
+	Structure   TemplateStructure `json:"structure" db:"structure"`
+	AgentConfig AgentConfig       `json:"agentConfig" db:"agent_config"`
+	CreatedBy   *UUID             `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt   time.Time         `json:"createdAt" db:"created_at"`
+}
+
+// OutdatedTemplateInstance is a node created from an older version of its
+// template than the current one
+type OutdatedTemplateInstance struct {
+	NodeID          UUID      `json:"nodeId"`
+	ProjectID       UUID      `json:"projectId"`
+	Title           string    `json:"title"`
+	TemplateID      UUID      `json:"templateId"`
+	TemplateName    string    `json:"templateName"`
+	TemplateVersion int       `json:"templateVersion"`
+	LatestVersion   int       `json:"latestVersion"`
+	CreatedAt       time.Time `json:"createdAt"`
+}
+
+// TemplateStructure is the node a template creates: its input slots,
+// expected outputs and child nodes
 type TemplateStructure struct {
-	Inputs                 []TemplateInput   `json:"inputs"`
-	Outputs                []TemplateOutput  `json:"outputs"`
-	SubNodes               []TemplateSubNode `json:"subNodes,omitempty"`
-	SuggestedWorkflowStates []string         `json:"suggestedWorkflowStates,omitempty"`
+	Inputs                 []TemplateInput   `json:"inputs" binding:"max=50,dive"`
+	Outputs                []TemplateOutput  `json:"outputs" binding:"max=50,dive"`
+	SubNodes               []TemplateSubNode `json:"subNodes,omitempty" binding:"max=50,dive"`
+	SuggestedWorkflowStates []string         `json:"suggestedWorkflowStates,omitempty" binding:"max=20,dive,min=1,max=50"`
+	Variables              []TemplateVariable `json:"variables,omitempty" binding:"max=50,dive"`
+}
+
+// TemplateVariable is a value asked for when the template is applied. Its
+// {{name}} placeholders are replaced in node titles and descriptions, input
+// and output slots, and the agent's system prompt.
+type TemplateVariable struct {
+	Name        string  `json:"name" binding:"required,max=64"`
+	Label       string  `json:"label,omitempty" binding:"max=255"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Default     *string `json:"default,omitempty"`
 }
 
 type TemplateInput struct {
-	Label       string `json:"label"`
-	Type        string `json:"type"`
+	Label       string `json:"label" binding:"required,max=255"`
+	Type        string `json:"type" binding:"required,oneof=file node_reference external_link text"`
 	Required    bool   `json:"required"`
 	Description string `json:"description,omitempty"`
+
+	// Content a text or external_link input starts with, such as
+	// "Brief for {{customer_name}}"
+	Value string `json:"value,omitempty"`
 }
 
 type TemplateOutput struct {
-	Label       string `json:"label"`
-	Type        string `json:"type"`
+	Label       string `json:"label" binding:"required,max=255"`
+	Type        string `json:"type" binding:"required,oneof=file structured_data text external_link"`
 	Description string `json:"description,omitempty"`
 }
 
+// TemplateSubNode is a child node. With TemplateID it's created from that
+// template's structure.
 type TemplateSubNode struct {
-	Title      string `json:"title"`
-	AuthorType string `json:"authorType"`
+	Title      string `json:"title" binding:"required,max=500"`
+	AuthorType string `json:"authorType" binding:"required,oneof=human agent"`
 	TemplateID *UUID  `json:"templateId,omitempty"`
 }
 
 type AgentConfig struct {
-	Model        string   `json:"model,omitempty"`
-	MaxTokens    int      `json:"maxTokens,omitempty"`
-	Temperature  float64  `json:"temperature,omitempty"`
-	SystemPrompt string   `json:"systemPrompt,omitempty"`
-	Tools        []string `json:"tools,omitempty"`
+	Model        string  `json:"model,omitempty"`
+	MaxTokens    int     `json:"maxTokens,omitempty"`
+	Temperature  float64 `json:"temperature,omitempty"`
+	SystemPrompt string  `json:"systemPrompt,omitempty"`
+
+	// Tools the agent may call, all of them when empty
+	Tools []string `json:"tools,omitempty"`
+
+	// Policies enforced on top of the org's, for nodes created from a
+	// template
+	Policies []AgentPolicy `json:"policies,omitempty" binding:"max=20"`
+}
+
+// EffectiveAgentConfig is the agent config an execution of a node runs
+// with, resolved from the execution's override, the node, the template
+// version it came from, its project and its org. Policies holds every
+// layer's.
+type EffectiveAgentConfig struct {
+	AgentConfig
+
+	// Layer each setting came from (execution, node, template, project or
+	// org), by field name. Settings no layer sets are left out.
+	Sources map[string]string `json:"sources"`
+
+	// Tools the agent is offered, and those of them needing approval, once
+	// every layer's tools and policies are applied
+	AllowedTools  []string `json:"allowedTools"`
+	ApprovalTools []string `json:"approvalTools"`
 }
 
 // =====================================================
@@ -313,10 +482,122 @@ type Notification struct {
 	Body         *string    `json:"body,omitempty" db:"body"`
 	ResourceType *string    `json:"resourceType,omitempty" db:"resource_type"`
 	ResourceID   *UUID      `json:"resourceId,omitempty" db:"resource_id"`
+	Count        int        `json:"count" db:"count"`
 	ReadAt       *time.Time `json:"readAt,omitempty" db:"read_at"`
 	CreatedAt    time.Time  `json:"createdAt" db:"created_at"`
 }
 
+// NotificationWebhook is a URL that receives execution notifications: a
+// user's own, or every one in an org. Secret is only returned on creation.
+type NotificationWebhook struct {
+	ID                  UUID       `json:"id" db:"id"`
+	OrgID               *UUID      `json:"orgId,omitempty" db:"org_id"`
+	UserID              *UUID      `json:"userId,omitempty" db:"user_id"`
+	URL                 string     `json:"url" db:"url"`
+	Secret              string     `json:"secret,omitempty" db:"secret"`
+	Events              []string   `json:"events" db:"events"`
+	Description         *string    `json:"description,omitempty" db:"description"`
+	CreatedBy           *UUID      `json:"createdBy,omitempty" db:"created_by"`
+	CreatedAt           time.Time  `json:"createdAt" db:"created_at"`
+	LastDeliveryAt      *time.Time `json:"lastDeliveryAt,omitempty" db:"last_delivery_at"`
+	LastStatus          *int       `json:"lastStatus,omitempty" db:"last_status"`
+	LastError           *string    `json:"lastError,omitempty" db:"last_error"`
+	ConsecutiveFailures int        `json:"consecutiveFailures" db:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabledAt,omitempty" db:"disabled_at"`
+}
+
+// PushSubscription is a browser's Web Push subscription. The encryption
+// keys are never returned.
+type PushSubscription struct {
+	ID         UUID       `json:"id" db:"id"`
+	UserID     UUID       `json:"userId" db:"user_id"`
+	Endpoint   string     `json:"endpoint" db:"endpoint"`
+	P256dh     string     `json:"-" db:"p256dh"`
+	Auth       string     `json:"-" db:"auth"`
+	UserAgent  *string    `json:"userAgent,omitempty" db:"user_agent"`
+	CreatedAt  time.Time  `json:"createdAt" db:"created_at"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty" db:"last_used_at"`
+}
+
+// =====================================================
+// REQUEST AUDIT
+// =====================================================
+
+// RequestAuditEntry records a single authenticated API request
+type RequestAuditEntry struct {
+	ID          UUID              `json:"id" db:"id"`
+	UserID      UUID              `json:"userId" db:"user_id"`
+	OrgID       *UUID             `json:"orgId,omitempty" db:"org_id"`
+	Method      string            `json:"method" db:"method"`
+	Route       string            `json:"route" db:"route"`
+	Path        string            `json:"path" db:"path"`
+	ResourceIDs map[string]string `json:"resourceIds" db:"resource_ids"`
+	Status      int               `json:"status" db:"status"`
+	LatencyMs   int64             `json:"latencyMs" db:"latency_ms"`
+	RequestID   *string           `json:"requestId,omitempty" db:"request_id"`
+	IPAddress   *string           `json:"ipAddress,omitempty" db:"ip_address"`
+	UserAgent   *string           `json:"userAgent,omitempty" db:"user_agent"`
+	APIKeyID    *UUID             `json:"apiKeyId,omitempty" db:"api_key_id"`
+	CreatedAt   time.Time         `json:"createdAt" db:"created_at"`
+}
+
+// AuditLogEntry is a change to a row recorded by the audit triggers.
+// Details holds the row's values before ("old") and after ("new") it.
+type AuditLogEntry struct {
+	ID           UUID           `json:"id" db:"id"`
+	OrgID        UUID           `json:"orgId" db:"org_id"`
+	Action       string         `json:"action" db:"action"`
+	ResourceType string         `json:"resourceType" db:"resource_type"`
+	ResourceID   *UUID          `json:"resourceId,omitempty" db:"resource_id"`
+	Details      map[string]any `json:"details" db:"details"`
+	CreatedAt    time.Time      `json:"createdAt" db:"created_at"`
+}
+
+// =====================================================
+// PLATFORM ADMIN
+// =====================================================
+
+// FeatureFlag gates a feature globally or for specific orgs
+type FeatureFlag struct {
+	Key           string    `json:"key" db:"key"`
+	Enabled       bool      `json:"enabled" db:"enabled"`
+	Description   *string   `json:"description,omitempty" db:"description"`
+	EnabledOrgIDs []UUID    `json:"enabledOrgIds" db:"enabled_org_ids"`
+	UpdatedBy     *UUID     `json:"updatedBy,omitempty" db:"updated_by"`
+	UpdatedAt     time.Time `json:"updatedAt" db:"updated_at"`
+}
+
+// AdminOrgSummary is an organization as seen by platform admins
+type AdminOrgSummary struct {
+	Organization
+	MemberCount  int `json:"memberCount"`
+	ProjectCount int `json:"projectCount"`
+}
+
+// AdminUser is a user with their org memberships, for platform admin lookup
+type AdminUser struct {
+	User
+	IsPlatformAdmin bool              `json:"isPlatformAdmin"`
+	DeactivatedAt   *time.Time        `json:"deactivatedAt,omitempty"`
+	DeletedAt       *time.Time        `json:"deletedAt,omitempty"`
+	Memberships     []AdminMembership `json:"memberships"`
+}
+
+// AdminMembership is one of a user's org memberships
+type AdminMembership struct {
+	OrgID   UUID   `json:"orgId"`
+	OrgName string `json:"orgName"`
+	Role    string `json:"role"`
+}
+
+// AdminExecution is an agent execution with the context needed to find it
+type AdminExecution struct {
+	AgentExecution
+	OrgID     UUID   `json:"orgId"`
+	ProjectID UUID   `json:"projectId"`
+	NodeTitle string `json:"nodeTitle"`
+}
+
 // =====================================================
 // SEARCH & RAG CONTEXT
 // =====================================================
@@ -0,0 +1,292 @@
+// Package openapi builds the API's OpenAPI 3 document from the routes
+// documented in handlers.APIRoutes. Schemas come from the request and
+// response types themselves: json tags name the properties, and binding
+// tags give required fields, enums and limits.
+package openapi
+
+import (
+	"maps"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Version is the OpenAPI version the document follows
+const Version = "3.0.3"
+
+// Route documents one API route. Path is as registered with gin, relative
+// to the API base, e.g. /orgs/:orgId. Query, Body and Response are zero
+// values of the types bound and returned; Object describes gin.H bodies.
+type Route struct {
+	Method  string
+	Path    string
+	ID      string
+	Tag     string
+	Summary string
+	// Query is a struct bound with ShouldBindQuery; its form tags name the
+	// parameters
+	Query any
+	Body  any
+	// Consumes are the body's media types, application/json when empty
+	Consumes []string
+	Response any
+	// Produces are the response's media types, application/json when
+	// empty. Responses of other types are documented as files.
+	Produces []string
+	// Status is the success status, 200 when zero. Routes answering 204
+	// have no Response.
+	Status int
+	// Public routes need no bearer token
+	Public bool
+	// APIKey routes also accept an org API key in place of a bearer token
+	APIKey bool
+}
+
+// Object is a JSON object response built with gin.H. Each value is a zero
+// value of the property's type.
+type Object map[string]any
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string                `json:"openapi"`
+	Info       Info                  `json:"info"`
+	Servers    []Server              `json:"servers,omitempty"`
+	Tags       []Tag                 `json:"tags,omitempty"`
+	Paths      map[string]PathItem   `json:"paths"`
+	Components Components            `json:"components"`
+	Security   []map[string][]string `json:"security,omitempty"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+// PathItem maps lower-case HTTP methods to operations
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary,omitempty"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+	// An empty list marks a public operation
+	Security *[]map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+}
+
+const (
+	bearerAuth = "bearerAuth"
+	apiKeyAuth = "apiKeyAuth"
+)
+
+// pathParam matches gin's :name path parameters
+var pathParam = regexp.MustCompile(`:([A-Za-z]+)`)
+
+// pathParamSchemas are the path parameters that aren't UUIDs
+var pathParamSchemas = map[string]*Schema{
+	"version":   {Type: "integer"},
+	"queue":     {Type: "string"},
+	"messageId": {Type: "string"},
+	"flagKey":   {Type: "string"},
+}
+
+// Build returns the document for routes served under server
+func Build(info Info, server string, routes []Route) *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI:  Version,
+		Info:     info,
+		Servers:  []Server{{URL: server}},
+		Paths:    map[string]PathItem{},
+		Security: []map[string][]string{{bearerAuth: {}}},
+	}
+
+	errorSchema := g.errorSchema()
+	seenTags := map[string]bool{}
+	for _, r := range routes {
+		if r.Tag != "" && !seenTags[r.Tag] {
+			seenTags[r.Tag] = true
+			doc.Tags = append(doc.Tags, Tag{Name: r.Tag})
+		}
+
+		op := &Operation{
+			OperationID: r.ID,
+			Summary:     r.Summary,
+			Parameters:  g.pathParameters(r.Path),
+			Responses: map[string]*Response{
+				"default": {Description: "Error", Content: jsonContent(errorSchema)},
+			},
+		}
+		if r.Tag != "" {
+			op.Tags = []string{r.Tag}
+		}
+		if r.Public {
+			op.Security = &[]map[string][]string{}
+		}
+		if r.APIKey {
+			op.Security = &[]map[string][]string{{bearerAuth: {}}, {apiKeyAuth: {}}}
+		}
+		if r.Query != nil {
+			op.Parameters = append(op.Parameters, g.queryParameters(reflect.TypeOf(r.Query))...)
+		}
+		if r.Body != nil {
+			op.RequestBody = &RequestBody{Required: true, Content: g.content(r.Body, r.Consumes)}
+		}
+
+		status := r.Status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		response := &Response{Description: http.StatusText(status)}
+		if r.Response != nil || len(r.Produces) > 0 {
+			response.Content = g.content(r.Response, r.Produces)
+		}
+		op.Responses[strconv.Itoa(status)] = response
+
+		path := pathParam.ReplaceAllString(r.Path, "{$1}")
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = PathItem{}
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+
+	doc.Components = Components{
+		Schemas: g.schemas,
+		SecuritySchemes: map[string]SecurityScheme{
+			bearerAuth: {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			apiKeyAuth: {Type: "apiKey", In: "header", Name: "X-API-Key"},
+		},
+	}
+	return doc
+}
+
+// content describes a body in each of its media types. Bodies that aren't
+// JSON are files.
+func (g *generator) content(body any, types []string) map[string]MediaType {
+	if len(types) == 0 {
+		types = []string{"application/json"}
+	}
+	content := map[string]MediaType{}
+	for _, t := range types {
+		switch {
+		case t == "application/json" && body != nil:
+			content[t] = MediaType{Schema: g.value(body)}
+		case t == "multipart/form-data":
+			content[t] = MediaType{Schema: &Schema{
+				Type:       "object",
+				Properties: map[string]*Schema{"file": {Type: "string", Format: "binary"}},
+				Required:   []string{"file"},
+			}}
+		default:
+			content[t] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+	}
+	return content
+}
+
+// value is the schema of a documented body: an Object or a Go value
+func (g *generator) value(v any) *Schema {
+	obj, ok := v.(Object)
+	if !ok {
+		return g.schema(reflect.TypeOf(v))
+	}
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, key := range slices.Sorted(maps.Keys(obj)) {
+		s.Properties[key] = g.value(obj[key])
+		s.Required = append(s.Required, key)
+	}
+	return s
+}
+
+func (g *generator) pathParameters(path string) []Parameter {
+	var params []Parameter
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		schema, ok := pathParamSchemas[m[1]]
+		if !ok {
+			schema = &Schema{Type: "string", Format: "uuid"}
+		}
+		params = append(params, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	return params
+}
+
+// queryParameters lists a query struct's fields by form tag, including
+// those of embedded structs such as pagination.Params
+func (g *generator) queryParameters(t reflect.Type) []Parameter {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var params []Parameter
+	for i := range t.NumField() {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("form") == "" {
+			params = append(params, g.queryParameters(f.Type)...)
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("form"), ",")
+		if name == "" || name == "-" || !f.IsExported() {
+			continue
+		}
+		schema := g.schema(f.Type)
+		rules := parseBinding(f.Tag.Get("binding"))
+		rules.apply(schema)
+		if strings.Contains(f.Tag.Get("time_format"), "15:04") {
+			schema.Format = "date-time"
+		}
+		params = append(params, Parameter{Name: name, In: "query", Required: rules.required, Schema: schema})
+	}
+	return params
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
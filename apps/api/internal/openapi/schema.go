@@ -0,0 +1,298 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"path"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/apierror"
+	"github.com/google/uuid"
+)
+
+// Schema is a JSON Schema as OpenAPI 3.0 uses it
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	uuidType        = reflect.TypeOf(uuid.UUID{})
+	rawMessageType  = reflect.TypeOf(json.RawMessage{})
+	textMarshalType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// generator turns Go types into schemas. Named structs become components,
+// referenced by name; a name already taken by a type from another package
+// is prefixed with that package's name.
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+	types   map[string]reflect.Type
+}
+
+func newGenerator() *generator {
+	return &generator{
+		schemas: map[string]*Schema{},
+		names:   map[reflect.Type]string{},
+		types:   map[string]reflect.Type{},
+	}
+}
+
+// errorSchema is the body of every error response
+func (g *generator) errorSchema() *Schema {
+	return g.schema(reflect.TypeOf(apierror.Error{}))
+}
+
+func (g *generator) schema(t reflect.Type) *Schema {
+	if t == nil {
+		return &Schema{}
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	case rawMessageType:
+		return &Schema{}
+	}
+	if t.Kind() != reflect.Struct && (t.Implements(textMarshalType) || reflect.PointerTo(t).Implements(textMarshalType)) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	}
+	return &Schema{}
+}
+
+// component registers a named struct's schema and returns its name
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+	name := typeName(t)
+	if other, taken := g.types[name]; taken && other != t {
+		pkg := path.Base(t.PkgPath())
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	g.names[t] = name
+	g.types[name] = t
+
+	// Registered before it is built, for types that refer to themselves
+	s := &Schema{}
+	g.schemas[name] = s
+	*s = *g.object(t)
+	return name
+}
+
+// typeName is a type's name, capitalized, with the element types of a
+// generic instantiation appended: Page[models.Node] is PageNode
+func typeName(t reflect.Type) string {
+	name, args, generic := strings.Cut(t.Name(), "[")
+	if generic {
+		for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), ",") {
+			name += arg[strings.LastIndexAny(arg, "./")+1:]
+		}
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+// fields adds a struct's JSON fields to s, flattening embedded structs as
+// encoding/json does
+func (g *generator) fields(t reflect.Type, s *Schema) {
+	for i := range t.NumField() {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		options := strings.Split(opts, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		ft := f.Type
+		for ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			g.fields(ft, s)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		fs := g.schema(f.Type)
+		if fs.Ref == "" {
+			if f.Type.Kind() == reflect.Pointer && !slices.Contains(options, "omitempty") {
+				fs.Nullable = true
+			}
+			if slices.Contains(options, "string") {
+				fs = &Schema{Type: "string"}
+			}
+		}
+		rules := parseBinding(f.Tag.Get("binding"))
+		rules.apply(fs)
+		s.Properties[name] = fs
+		if rules.required {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// bindingRules are the validator rules of a binding tag that a schema can
+// express
+type bindingRules struct {
+	required bool
+	enum     []string
+	min, max *float64
+	format   string
+	// Rules after dive, for a slice's items or a map's values
+	elem *bindingRules
+}
+
+func parseBinding(tag string) *bindingRules {
+	rules := &bindingRules{}
+	if tag == "" {
+		return rules
+	}
+	parts := strings.Split(tag, ",")
+	for i := 0; i < len(parts); i++ {
+		rule, param, _ := strings.Cut(parts[i], "=")
+		switch rule {
+		case "required":
+			rules.required = true
+		case "oneof":
+			rules.enum = strings.Fields(param)
+		case "min", "gte":
+			rules.min = parseFloat(param)
+		case "max", "lte":
+			rules.max = parseFloat(param)
+		case "len":
+			rules.min, rules.max = parseFloat(param), parseFloat(param)
+		case "email":
+			rules.format = "email"
+		case "url", "http_url", "uri":
+			rules.format = "uri"
+		case "uuid", "uuid4":
+			rules.format = "uuid"
+		case "dive":
+			rest := parts[i+1:]
+			// Map key rules go from keys to endkeys
+			if len(rest) > 0 && rest[0] == "keys" {
+				for len(rest) > 0 && rest[0] != "endkeys" {
+					rest = rest[1:]
+				}
+				if len(rest) > 0 {
+					rest = rest[1:]
+				}
+			}
+			rules.elem = parseBinding(strings.Join(rest, ","))
+			return rules
+		}
+	}
+	return rules
+}
+
+func parseFloat(s string) *float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// apply adds the rules to s. Referenced schemas are shared, so they are
+// left as they are.
+func (r *bindingRules) apply(s *Schema) {
+	if s.Ref != "" {
+		return
+	}
+	if r.format != "" && s.Type == "string" {
+		s.Format = r.format
+	}
+	for _, v := range r.enum {
+		switch s.Type {
+		case "integer":
+			if n, err := strconv.Atoi(v); err == nil {
+				s.Enum = append(s.Enum, n)
+			}
+		case "string":
+			s.Enum = append(s.Enum, v)
+		}
+	}
+	switch s.Type {
+	case "string":
+		s.MinLength, s.MaxLength = toInt(r.min), toInt(r.max)
+	case "integer", "number":
+		s.Minimum, s.Maximum = r.min, r.max
+	case "array":
+		s.MinItems, s.MaxItems = toInt(r.min), toInt(r.max)
+	}
+	if r.elem != nil {
+		switch {
+		case s.Items != nil:
+			r.elem.apply(s.Items)
+		case s.AdditionalProperties != nil:
+			r.elem.apply(s.AdditionalProperties)
+		}
+	}
+}
+
+func toInt(f *float64) *int {
+	if f == nil {
+		return nil
+	}
+	n := int(*f)
+	return &n
+}
@@ -0,0 +1,143 @@
+// Package pagination implements cursor (keyset) pagination for list
+// endpoints. A page is requested with ?cursor=&limit= and returns the items
+// after the cursor plus the cursor of its last item. Unlike offsets, cursors
+// stay correct while items are added or removed between requests.
+package pagination
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+// ErrInvalidCursor is returned for a cursor that wasn't issued by the list
+// it's used with
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Params are the query parameters of a list request
+type Params struct {
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=200"`
+}
+
+// PageLimit returns the requested page size, or DefaultLimit
+func (p Params) PageLimit() int {
+	if p.Limit <= 0 || p.Limit > MaxLimit {
+		return DefaultLimit
+	}
+	return p.Limit
+}
+
+// AfterTime returns the position to list after for a list sorted by a
+// timestamp; both are nil for the first page
+func (p Params) AfterTime() (*time.Time, *uuid.UUID, error) {
+	c, err := p.after()
+	if c == nil {
+		return nil, nil, err
+	}
+	t, err := time.Parse(time.RFC3339Nano, c.Key)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	return &t, &c.ID, nil
+}
+
+// AfterInt returns the position to list after for a list sorted by a
+// number; both are nil for the first page
+func (p Params) AfterInt() (*int, *uuid.UUID, error) {
+	c, err := p.after()
+	if c == nil {
+		return nil, nil, err
+	}
+	n, err := strconv.Atoi(c.Key)
+	if err != nil {
+		return nil, nil, ErrInvalidCursor
+	}
+	return &n, &c.ID, nil
+}
+
+// AfterString returns the position to list after for a list sorted by a
+// string; both are nil for the first page
+func (p Params) AfterString() (*string, *uuid.UUID, error) {
+	c, err := p.after()
+	if c == nil {
+		return nil, nil, err
+	}
+	return &c.Key, &c.ID, nil
+}
+
+func (p Params) after() (*Cursor, error) {
+	if p.Cursor == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// Cursor is the position of a page's last item: the value of the list's
+// sort key and the item's ID, which breaks ties. Clients treat its encoded
+// form as opaque.
+type Cursor struct {
+	Key string    `json:"k"`
+	ID  uuid.UUID `json:"i"`
+}
+
+// Encode returns the cursor's opaque form
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// TimeCursor returns the cursor of an item sorted by a timestamp
+func TimeCursor(t time.Time, id uuid.UUID) Cursor {
+	return Cursor{Key: t.UTC().Format(time.RFC3339Nano), ID: id}
+}
+
+// IntCursor returns the cursor of an item sorted by a number
+func IntCursor(n int, id uuid.UUID) Cursor {
+	return Cursor{Key: strconv.Itoa(n), ID: id}
+}
+
+// StringCursor returns the cursor of an item sorted by a string
+func StringCursor(s string, id uuid.UUID) Cursor {
+	return Cursor{Key: s, ID: id}
+}
+
+// Page is one page of a list
+type Page[T any] struct {
+	Items      []T
+	NextCursor string // empty on the last page
+	HasMore    bool
+	Total      int // all items in the list; -1 when not counted
+}
+
+// NewPage builds a page from up to limit+1 items fetched after the cursor:
+// an extra item means there are more pages
+func NewPage[T any](items []T, limit int, cursorOf func(T) Cursor) *Page[T] {
+	page := &Page[T]{Items: items, Total: -1}
+	if page.Items == nil {
+		page.Items = []T{}
+	}
+	if len(items) > limit {
+		page.Items = items[:limit]
+		page.HasMore = true
+		page.NextCursor = cursorOf(items[limit-1]).Encode()
+	}
+	return page
+}
@@ -0,0 +1,103 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := uuid.New()
+	at := time.Date(2026, 10, 16, 9, 30, 0, 123456000, time.FixedZone("CEST", 2*60*60))
+
+	gotTime, gotID, err := Params{Cursor: TimeCursor(at, id).Encode()}.AfterTime()
+	if err != nil || !gotTime.Equal(at) || *gotID != id {
+		t.Fatalf("AfterTime = %v, %v, %v; want %v, %v", gotTime, gotID, err, at, id)
+	}
+
+	gotInt, gotID, err := Params{Cursor: IntCursor(-42, id).Encode()}.AfterInt()
+	if err != nil || *gotInt != -42 || *gotID != id {
+		t.Fatalf("AfterInt = %v, %v, %v", gotInt, gotID, err)
+	}
+
+	// Keys survive whatever characters they hold
+	key := `Ünïcode "quoted", with/slashes+plus=`
+	gotString, gotID, err := Params{Cursor: StringCursor(key, id).Encode()}.AfterString()
+	if err != nil || *gotString != key || *gotID != id {
+		t.Fatalf("AfterString = %v, %v, %v", gotString, gotID, err)
+	}
+
+	// The first page has no position
+	gotTime, gotID, err = Params{}.AfterTime()
+	if gotTime != nil || gotID != nil || err != nil {
+		t.Fatalf("AfterTime without a cursor = %v, %v, %v", gotTime, gotID, err)
+	}
+}
+
+func TestMalformedCursors(t *testing.T) {
+	id := uuid.New()
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	for _, tc := range []struct {
+		name   string
+		cursor string
+		after  func(Params) error
+	}{
+		{"not base64", "%%%", afterTime},
+		{"padded base64", base64.URLEncoding.EncodeToString([]byte(`{"k":"1","i":"` + id.String() + `"}`)), afterInt},
+		{"not JSON", encode("cursor"), afterString},
+		{"no ID", encode(`{"k":"1"}`), afterInt},
+		{"bad ID", encode(`{"k":"1","i":"node-7"}`), afterInt},
+		{"string key for a time list", StringCursor("alpha", id).Encode(), afterTime},
+		{"time key for a number list", TimeCursor(time.Now(), id).Encode(), afterInt},
+	} {
+		if err := tc.after(Params{Cursor: tc.cursor}); err != ErrInvalidCursor {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", tc.name, err)
+		}
+	}
+}
+
+func afterTime(p Params) error   { _, _, err := p.AfterTime(); return err }
+func afterInt(p Params) error    { _, _, err := p.AfterInt(); return err }
+func afterString(p Params) error { _, _, err := p.AfterString(); return err }
+
+func TestPageLimit(t *testing.T) {
+	for _, tc := range []struct{ limit, want int }{
+		{0, DefaultLimit},
+		{-1, DefaultLimit},
+		{1, 1},
+		{MaxLimit, MaxLimit},
+		{MaxLimit + 1, DefaultLimit},
+	} {
+		if got := (Params{Limit: tc.limit}).PageLimit(); got != tc.want {
+			t.Errorf("PageLimit(%d) = %d, want %d", tc.limit, got, tc.want)
+		}
+	}
+}
+
+func TestNewPage(t *testing.T) {
+	cursorOf := func(n int) Cursor { return IntCursor(n, uuid.NewSHA1(uuid.Nil, []byte{byte(n)})) }
+
+	// limit+1 items: one more page, whose cursor is the last item shown
+	page := NewPage([]int{1, 2, 3}, 2, cursorOf)
+	if len(page.Items) != 2 || !page.HasMore || page.Total != -1 {
+		t.Fatalf("page = %+v", page)
+	}
+	n, _, err := Params{Cursor: page.NextCursor}.AfterInt()
+	if err != nil || *n != 2 {
+		t.Fatalf("next cursor points after %v (%v), want 2", n, err)
+	}
+
+	// Exactly limit items: the last page
+	page = NewPage([]int{1, 2}, 2, cursorOf)
+	if len(page.Items) != 2 || page.HasMore || page.NextCursor != "" {
+		t.Fatalf("last page = %+v", page)
+	}
+
+	// No items still encodes as a list
+	if page := NewPage[int](nil, 2, cursorOf); page.Items == nil || page.HasMore {
+		t.Fatalf("empty page = %+v", page)
+	}
+}
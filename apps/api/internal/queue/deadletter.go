@@ -0,0 +1,71 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// MaxReceives is how often a message is delivered before it is moved to
+// its queue's dead-letter queue. Matches the SQS redrive policy.
+const MaxReceives = 3
+
+// ErrDeadLetterNotFound is returned for a dead letter that doesn't exist or
+// was already redriven or discarded
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// DeadLetter is a message that failed processing MaxReceives times
+type DeadLetter struct {
+	ID           string            `json:"id"`
+	Queue        string            `json:"queue"`
+	Body         json.RawMessage   `json:"body"`
+	Attributes   map[string]string `json:"attributes,omitempty"`
+	ReceiveCount int               `json:"receiveCount"`
+	SentAt       *time.Time        `json:"sentAt,omitempty"`
+}
+
+// DeadLetters inspects and empties dead-letter queues. IDs are stable across
+// calls, so a listed message can be redriven or discarded later.
+type DeadLetters interface {
+	// ListDeadLetters returns up to max dead letters of a queue, oldest first
+	// where the backend keeps order
+	ListDeadLetters(ctx context.Context, queue string, max int) ([]DeadLetter, error)
+
+	// GetDeadLetter returns one dead letter, or ErrDeadLetterNotFound
+	GetDeadLetter(ctx context.Context, queue, id string) (*DeadLetter, error)
+
+	// RedriveDeadLetters sends dead letters back to their queue and returns
+	// how many were found
+	RedriveDeadLetters(ctx context.Context, queue string, ids []string) (int, error)
+
+	// DiscardDeadLetters deletes dead letters and returns how many were found
+	DiscardDeadLetters(ctx context.Context, queue string, ids []string) (int, error)
+}
+
+var (
+	_ DeadLetters = (*sqsQueue)(nil)
+	_ DeadLetters = (*redisQueue)(nil)
+	_ DeadLetters = (*natsQueue)(nil)
+	_ DeadLetters = (*rabbitQueue)(nil)
+	_ DeadLetters = (*MemoryQueue)(nil)
+)
+
+// deadLetterBody keeps JSON bodies as they are and quotes anything else, so
+// a malformed job can still be inspected
+func deadLetterBody(body []byte) json.RawMessage {
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
+
+// idSet indexes the IDs of a redrive or discard
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
@@ -0,0 +1,229 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Dispatcher sends jobs to the worker queues over any backend, either
+// directly (Dispatch*) or through the outbox in a transaction (Enqueue*)
+type Dispatcher struct {
+	queue  Queue
+	outbox *Outbox
+	logger *zap.Logger
+}
+
+// NewDispatcher creates a dispatcher on a queue backend and its outbox
+func NewDispatcher(q Queue, outbox *Outbox, logger *zap.Logger) *Dispatcher {
+	return &Dispatcher{queue: q, outbox: outbox, logger: logger}
+}
+
+// FileProcessingJob represents a job to process a file
+type FileProcessingJob struct {
+	// Set on dispatch; see jobs.go
+	SchemaVersion int `json:"schemaVersion"`
+
+	FileID      uuid.UUID  `json:"fileId"`
+	OrgID       uuid.UUID  `json:"orgId"`
+	StorageKey  string     `json:"storageKey"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"contentType"`
+	UploadedBy  *uuid.UUID `json:"uploadedBy,omitempty"`
+
+	// Attempt counts dispatches of the job, from 1; Retry tells the worker
+	// how to retry it. Set on dispatch when zero.
+	Attempt int          `json:"attempt,omitempty"`
+	Retry   *RetryPolicy `json:"retry,omitempty"`
+
+	// TraceContext carries the W3C trace context so the worker can continue the trace
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+}
+
+// DispatchFileProcessingJob sends a file processing job to the queue
+// Accepts any struct that marshals to the expected format (for interface compatibility)
+func (d *Dispatcher) DispatchFileProcessingJob(ctx context.Context, job any) error {
+	msg, fpJob, err := fileProcessingMessage(job)
+	if err != nil {
+		return err
+	}
+	if err := d.queue.Send(ctx, FileJobs, msg); err != nil {
+		return fmt.Errorf("failed to send file processing job: %w", err)
+	}
+
+	d.logger.Info("Dispatched file processing job",
+		zap.String("fileId", fpJob.FileID.String()),
+		zap.String("filename", fpJob.Filename),
+	)
+
+	return nil
+}
+
+// EnqueueFileProcessingJob writes a file processing job to the outbox in tx;
+// it is sent once tx commits
+func (d *Dispatcher) EnqueueFileProcessingJob(ctx context.Context, tx pgx.Tx, job any) error {
+	msg, _, err := fileProcessingMessage(job)
+	if err != nil {
+		return err
+	}
+	return d.outbox.Enqueue(ctx, tx, FileJobs, msg)
+}
+
+func fileProcessingMessage(job any) (Message, FileProcessingJob, error) {
+	// Convert to our internal type if needed
+	var fpJob FileProcessingJob
+	switch v := job.(type) {
+	case FileProcessingJob:
+		fpJob = v
+	default:
+		// Marshal and unmarshal to convert from services.FileProcessingJobMessage
+		if err := convertJob(job, &fpJob); err != nil {
+			return Message{}, fpJob, err
+		}
+	}
+	fpJob.SchemaVersion = FileJobSchemaVersion
+	setRetry(&fpJob.Attempt, &fpJob.Retry)
+	if err := fpJob.Validate(); err != nil {
+		return Message{}, fpJob, err
+	}
+
+	body, err := json.Marshal(fpJob)
+	if err != nil {
+		return Message{}, fpJob, fmt.Errorf("failed to marshal job: %w", err)
+	}
+	return Message{
+		Body:       body,
+		Attributes: map[string]string{"JobType": "file_processing"},
+		GroupID:    fpJob.FileID.String(),
+	}, fpJob, nil
+}
+
+// AgentJob represents a job for the agent worker
+type AgentJob struct {
+	// Set on dispatch; see jobs.go
+	SchemaVersion int `json:"schemaVersion"`
+
+	ExecutionID uuid.UUID      `json:"executionId"`
+	NodeID      uuid.UUID      `json:"nodeId"`
+	OrgID       uuid.UUID      `json:"orgId"`
+	OrgConfig   map[string]any `json:"orgConfig,omitempty"`
+
+	// Priority is PriorityInteractive (the default) or PriorityBatch and
+	// picks the queue; see AgentQueue
+	Priority string `json:"priority,omitempty"`
+
+	// Attempt is the execution's dispatch_attempts; Retry tells the worker
+	// how to retry it. Set on dispatch when zero.
+	Attempt int          `json:"attempt,omitempty"`
+	Retry   *RetryPolicy `json:"retry,omitempty"`
+
+	// TraceContext carries the W3C trace context so the worker can continue the trace
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+}
+
+// DispatchAgentJob sends an agent job to the queue
+// Accepts any struct that marshals to the expected format (for interface compatibility)
+func (d *Dispatcher) DispatchAgentJob(ctx context.Context, job any) error {
+	msg, agentJob, err := agentMessage(job)
+	if err != nil {
+		return err
+	}
+	if err := d.queue.Send(ctx, AgentQueue(agentJob.Priority), msg); err != nil {
+		return fmt.Errorf("failed to send agent job: %w", err)
+	}
+
+	d.logger.Info("Dispatched agent job",
+		zap.String("executionId", agentJob.ExecutionID.String()),
+		zap.String("nodeId", agentJob.NodeID.String()),
+		zap.String("priority", agentJob.Priority),
+	)
+
+	return nil
+}
+
+// EnqueueAgentJob writes an agent job to the outbox in tx; it is sent once
+// tx commits
+func (d *Dispatcher) EnqueueAgentJob(ctx context.Context, tx pgx.Tx, job any) error {
+	msg, agentJob, err := agentMessage(job)
+	if err != nil {
+		return err
+	}
+	return d.outbox.Enqueue(ctx, tx, AgentQueue(agentJob.Priority), msg)
+}
+
+func agentMessage(job any) (Message, AgentJob, error) {
+	// Convert to our internal type if needed
+	var agentJob AgentJob
+	switch v := job.(type) {
+	case AgentJob:
+		agentJob = v
+	default:
+		// Marshal and unmarshal to convert from services.AgentJobMessage
+		if err := convertJob(job, &agentJob); err != nil {
+			return Message{}, agentJob, err
+		}
+	}
+	agentJob.SchemaVersion = AgentJobSchemaVersion
+	if agentJob.Priority == "" {
+		agentJob.Priority = PriorityInteractive
+	}
+	setRetry(&agentJob.Attempt, &agentJob.Retry)
+	if err := agentJob.Validate(); err != nil {
+		return Message{}, agentJob, err
+	}
+
+	body, err := json.Marshal(agentJob)
+	if err != nil {
+		return Message{}, agentJob, fmt.Errorf("failed to marshal job: %w", err)
+	}
+	// On FIFO queues a node's executions are processed in order
+	return Message{
+		Body: body,
+		Attributes: map[string]string{
+			"JobType":                  "agent_execution",
+			"Priority":                 agentJob.Priority,
+			"VisibilityTimeoutSeconds": strconv.Itoa(int(agentVisibilityTimeout(agentJob.Priority).Seconds())),
+		},
+		GroupID: agentJob.NodeID.String(),
+	}, agentJob, nil
+}
+
+// agentVisibilityTimeout is how long a worker should hide an agent job while
+// it runs, sent to consumers as the VisibilityTimeoutSeconds attribute. Batch
+// runs are allowed longer, and a worker that receives one on a shared queue
+// extends its visibility to match.
+func agentVisibilityTimeout(priority string) time.Duration {
+	if priority == PriorityBatch {
+		return 30 * time.Minute
+	}
+	return 10 * time.Minute
+}
+
+// setRetry fills in a job's retry metadata when the caller didn't
+func setRetry(attempt *int, retry **RetryPolicy) {
+	if *attempt < 1 {
+		*attempt = 1
+	}
+	if *retry == nil {
+		policy := DefaultRetryPolicy
+		*retry = &policy
+	}
+}
+
+// convertJob copies a job through JSON into the queue's job type
+func convertJob(job, into any) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %w", err)
+	}
+	if err := json.Unmarshal(data, into); err != nil {
+		return fmt.Errorf("failed to unmarshal job: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Stats is a point-in-time view of a queue. Counts are approximate on SQS.
+type Stats struct {
+	// Messages waiting to be received
+	Depth int64
+
+	// Messages received but not yet acknowledged
+	InFlight int64
+
+	// Age of the oldest waiting message; nil when the queue is empty or the
+	// backend doesn't report it (SQS only publishes it to CloudWatch)
+	OldestAge *time.Duration
+}
+
+// StatsReader reports queue depth. Errors mean the queue is unreachable or
+// misconfigured.
+type StatsReader interface {
+	QueueStats(ctx context.Context, queue string) (Stats, error)
+}
+
+var (
+	_ StatsReader = (*sqsQueue)(nil)
+	_ StatsReader = (*redisQueue)(nil)
+	_ StatsReader = (*natsQueue)(nil)
+	_ StatsReader = (*rabbitQueue)(nil)
+	_ StatsReader = (*MemoryQueue)(nil)
+)
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Job schema versions. Bump a version when a change to the job breaks
+// consumers that don't know it: a new required field, or a field whose
+// meaning changes. Adding an optional field doesn't need a bump; consumers
+// that don't know it report it as unknown instead of dropping it silently.
+// Keep in sync with apps/workers/shared/jobs.py.
+const (
+	AgentJobSchemaVersion = 1
+	FileJobSchemaVersion  = 1
+)
+
+var (
+	// ErrInvalidJob is returned for a job missing required fields
+	ErrInvalidJob = errors.New("invalid job")
+
+	// ErrUnsupportedSchemaVersion is returned for a job newer than this
+	// build understands. Consumers leave it unacknowledged so an upgraded
+	// consumer (or the dead-letter queue) gets it.
+	ErrUnsupportedSchemaVersion = errors.New("unsupported job schema version")
+)
+
+// Validate checks an agent job has what the agent worker needs
+func (j AgentJob) Validate() error {
+	var missing []string
+	if j.ExecutionID == uuid.Nil {
+		missing = append(missing, "executionId")
+	}
+	if j.NodeID == uuid.Nil {
+		missing = append(missing, "nodeId")
+	}
+	if j.OrgID == uuid.Nil {
+		missing = append(missing, "orgId")
+	}
+	if err := missingFields("agent", missing); err != nil {
+		return err
+	}
+	switch j.Priority {
+	case "", PriorityInteractive, PriorityBatch:
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown agent job priority %q", ErrInvalidJob, j.Priority)
+	}
+}
+
+// Validate checks a file processing job has what the file worker needs
+func (j FileProcessingJob) Validate() error {
+	var missing []string
+	if j.FileID == uuid.Nil {
+		missing = append(missing, "fileId")
+	}
+	if j.OrgID == uuid.Nil {
+		missing = append(missing, "orgId")
+	}
+	if j.StorageKey == "" {
+		missing = append(missing, "storageKey")
+	}
+	return missingFields("file processing", missing)
+}
+
+func missingFields(kind string, missing []string) error {
+	if len(missing) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%w: %s job is missing %s", ErrInvalidJob, kind, strings.Join(missing, ", "))
+}
+
+// DecodeAgentJob decodes and validates an agent job. It also returns the
+// fields this build doesn't know, so consumers can log them.
+func DecodeAgentJob(body []byte) (AgentJob, []string, error) {
+	var job AgentJob
+	unknown, err := decodeJob(body, &job, &job.SchemaVersion, AgentJobSchemaVersion)
+	if err != nil {
+		return job, unknown, err
+	}
+	return job, unknown, job.Validate()
+}
+
+// DecodeFileProcessingJob decodes and validates a file processing job. It
+// also returns the fields this build doesn't know, so consumers can log them.
+func DecodeFileProcessingJob(body []byte) (FileProcessingJob, []string, error) {
+	var job FileProcessingJob
+	unknown, err := decodeJob(body, &job, &job.SchemaVersion, FileJobSchemaVersion)
+	if err != nil {
+		return job, unknown, err
+	}
+	return job, unknown, job.Validate()
+}
+
+// decodeJob decodes body into job, checking its schema version. Jobs from
+// before versioning carry none and decode as version 1.
+func decodeJob(body []byte, job any, version *int, supported int) ([]string, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	if err := json.Unmarshal(body, job); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidJob, err)
+	}
+	if *version == 0 {
+		*version = 1
+	}
+
+	known := jsonFieldNames(job)
+	var unknown []string
+	for name := range fields {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+
+	if *version > supported {
+		return unknown, fmt.Errorf("%w: %d (supported: %d)", ErrUnsupportedSchemaVersion, *version, supported)
+	}
+	return unknown, nil
+}
+
+// jsonFieldNames returns the JSON names of a struct's fields
+func jsonFieldNames(v any) map[string]bool {
+	t := reflect.TypeOf(v)
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	names := make(map[string]bool, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
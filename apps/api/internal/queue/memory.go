@@ -0,0 +1,248 @@
+package queue
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MemoryQueue keeps messages in process. Messages are lost on restart and
+// only consumers in the same process see them, so it suits local
+// development and tests, not production.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	queues   map[string]*memoryList
+	nextID   int
+	arrivals chan struct{}
+}
+
+type memoryList struct {
+	ready    []*memoryMessage
+	inFlight map[string]*memoryMessage
+
+	// Messages that expired in flight MaxReceives times
+	dead []*memoryMessage
+}
+
+type memoryMessage struct {
+	id           string
+	msg          Message
+	receiveCount int
+	visibleAt    time.Time
+	sentAt       time.Time
+}
+
+const memoryVisibilityTimeout = 5 * time.Minute
+
+// maxDelay: the in-memory backend delays messages itself, for any duration
+func (q *MemoryQueue) maxDelay(queue string) time.Duration {
+	return math.MaxInt64
+}
+
+// NewMemoryQueue creates an empty in-memory queue backend
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		queues:   make(map[string]*memoryList),
+		arrivals: make(chan struct{}, 1),
+	}
+}
+
+func (q *MemoryQueue) list(queue string) *memoryList {
+	l, ok := q.queues[queue]
+	if !ok {
+		l = &memoryList{inFlight: make(map[string]*memoryMessage)}
+		q.queues[queue] = l
+	}
+	return l
+}
+
+func (q *MemoryQueue) Send(ctx context.Context, queue string, msg Message) error {
+	q.mu.Lock()
+	q.nextID++
+	now := time.Now()
+	q.list(queue).ready = append(q.list(queue).ready, &memoryMessage{
+		id:        strconv.Itoa(q.nextID),
+		msg:       msg,
+		sentAt:    now,
+		visibleAt: now.Add(msg.Delay),
+	})
+	q.mu.Unlock()
+
+	// Wake a waiting receiver
+	select {
+	case q.arrivals <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+func (q *MemoryQueue) SendBatch(ctx context.Context, queue string, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = q.Send(ctx, queue, msg)
+	}
+	return errs
+}
+
+func (q *MemoryQueue) Receive(ctx context.Context, queue string, opts ReceiveOptions) ([]Delivery, error) {
+	visibility := opts.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = memoryVisibilityTimeout
+	}
+
+	deadline := time.Now().Add(opts.Wait)
+	for {
+		if deliveries := q.take(queue, opts.max(), visibility); len(deliveries) > 0 {
+			return deliveries, nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+		// Re-checked at least every second for expired in-flight messages
+		timer := time.NewTimer(min(wait, time.Second))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-q.arrivals:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// take moves up to max ready messages in flight, first returning any whose
+// visibility timeout ran out, or moving them to the dead letters once they
+// have been received MaxReceives times
+func (q *MemoryQueue) take(queue string, max int, visibility time.Duration) []Delivery {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l := q.list(queue)
+	now := time.Now()
+	for id, m := range l.inFlight {
+		if now.After(m.visibleAt) {
+			delete(l.inFlight, id)
+			if m.receiveCount >= MaxReceives {
+				l.dead = append(l.dead, m)
+			} else {
+				l.ready = append(l.ready, m)
+			}
+		}
+	}
+
+	var deliveries []Delivery
+	waiting := l.ready[:0]
+	for _, m := range l.ready {
+		// Delayed messages stay until their delay ends
+		if len(deliveries) == max || now.Before(m.visibleAt) {
+			waiting = append(waiting, m)
+			continue
+		}
+		m.receiveCount++
+		m.visibleAt = now.Add(visibility)
+		l.inFlight[m.id] = m
+		deliveries = append(deliveries, Delivery{
+			ID:           m.id,
+			Body:         m.msg.Body,
+			Attributes:   m.msg.Attributes,
+			ReceiveCount: m.receiveCount,
+		})
+	}
+	l.ready = waiting
+	return deliveries
+}
+
+func (q *MemoryQueue) Ack(ctx context.Context, queue string, d Delivery) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.list(queue).inFlight, d.ID)
+	return nil
+}
+
+func (q *MemoryQueue) ListDeadLetters(ctx context.Context, queue string, max int) ([]DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l := q.list(queue)
+	letters := make([]DeadLetter, 0, min(max, len(l.dead)))
+	for _, m := range l.dead[:min(max, len(l.dead))] {
+		letters = append(letters, m.deadLetter(queue))
+	}
+	return letters, nil
+}
+
+func (q *MemoryQueue) GetDeadLetter(ctx context.Context, queue, id string) (*DeadLetter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, m := range q.list(queue).dead {
+		if m.id == id {
+			letter := m.deadLetter(queue)
+			return &letter, nil
+		}
+	}
+	return nil, ErrDeadLetterNotFound
+}
+
+func (q *MemoryQueue) RedriveDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	removed := q.removeDead(queue, ids)
+	for _, m := range removed {
+		if err := q.Send(ctx, queue, m.msg); err != nil {
+			return 0, err
+		}
+	}
+	return len(removed), nil
+}
+
+func (q *MemoryQueue) DiscardDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	return len(q.removeDead(queue, ids)), nil
+}
+
+// removeDead takes the dead letters with the given IDs off the list
+func (q *MemoryQueue) removeDead(queue string, ids []string) []*memoryMessage {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	wanted := idSet(ids)
+	l := q.list(queue)
+	var removed, kept []*memoryMessage
+	for _, m := range l.dead {
+		if wanted[m.id] {
+			removed = append(removed, m)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	l.dead = kept
+	return removed
+}
+
+func (m *memoryMessage) deadLetter(queue string) DeadLetter {
+	sentAt := m.sentAt
+	return DeadLetter{
+		ID:           m.id,
+		Queue:        queue,
+		Body:         deadLetterBody(m.msg.Body),
+		Attributes:   m.msg.Attributes,
+		ReceiveCount: m.receiveCount,
+		SentAt:       &sentAt,
+	}
+}
+
+func (q *MemoryQueue) QueueStats(ctx context.Context, queue string) (Stats, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	l := q.list(queue)
+	stats := Stats{Depth: int64(len(l.ready)), InFlight: int64(len(l.inFlight))}
+	for _, m := range l.ready {
+		if age := time.Since(m.sentAt); stats.OldestAge == nil || age > *stats.OldestAge {
+			stats.OldestAge = &age
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,402 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"go.uber.org/zap"
+)
+
+// All queues share one work-queue stream, each on its own subject and read
+// by its own durable pull consumer, so every message goes to a single
+// worker and is removed once acknowledged. Messages not acknowledged within
+// the consumer's ack wait are redelivered, like SQS; after MaxReceives
+// deliveries they move to the dead-letter stream, which keeps them until
+// they are redriven, discarded or expire.
+const (
+	natsStream             = "GLASSBOX_JOBS"
+	natsSubjectPrefix      = "glassbox.jobs."
+	natsDeadLetterStream   = "GLASSBOX_DLQ"
+	natsDeadLetterPrefix   = "glassbox.dlq."
+	natsConsumerPrefix     = "glassbox-workers-"
+	natsVisibilityTimeout  = 5 * time.Minute
+	natsDeadLetterMaxAge   = 14 * 24 * time.Hour
+	natsHeaderAttributes   = "Glassbox-Attributes"
+	natsHeaderReceiveCount = "Glassbox-Receive-Count"
+	natsHeaderSentAt       = "Glassbox-Sent-At"
+)
+
+// natsQueue sends to and receives from a NATS JetStream stream
+type natsQueue struct {
+	conn   *nats.Conn
+	js     jetstream.JetStream
+	logger *zap.Logger
+
+	// Consumers by queue, and the ack wait each was last configured with
+	mu        sync.Mutex
+	consumers map[string]natsConsumer
+}
+
+type natsConsumer struct {
+	consumer jetstream.Consumer
+	ackWait  time.Duration
+}
+
+// newNATSQueue connects to NATS and creates the job and dead-letter streams
+func newNATSQueue(url string, logger *zap.Logger) (*natsQueue, error) {
+	conn, err := nats.Connect(url, nats.Name("glassbox-api"), nats.MaxReconnects(-1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	streams := []jetstream.StreamConfig{
+		{
+			Name:      natsStream,
+			Subjects:  []string{natsSubjectPrefix + ">"},
+			Retention: jetstream.WorkQueuePolicy,
+			Storage:   jetstream.FileStorage,
+		},
+		{
+			Name:     natsDeadLetterStream,
+			Subjects: []string{natsDeadLetterPrefix + ">"},
+			MaxAge:   natsDeadLetterMaxAge,
+			Storage:  jetstream.FileStorage,
+		},
+	}
+	for _, cfg := range streams {
+		if _, err := js.CreateOrUpdateStream(ctx, cfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to create stream %s: %w", cfg.Name, err)
+		}
+	}
+
+	return &natsQueue{
+		conn:      conn,
+		js:        js,
+		logger:    logger,
+		consumers: make(map[string]natsConsumer),
+	}, nil
+}
+
+func natsSubject(queue string) string {
+	return natsSubjectPrefix + queue
+}
+
+func natsDeadLetterSubject(queue string) string {
+	return natsDeadLetterPrefix + queue
+}
+
+func (q *natsQueue) Send(ctx context.Context, queue string, msg Message) error {
+	m, err := natsMessage(natsSubject(queue), msg.Body, msg.Attributes)
+	if err != nil {
+		return err
+	}
+	// JetStream drops a message whose ID it saw in the last two minutes
+	if msg.DeduplicationID != "" {
+		m.Header.Set(jetstream.MsgIDHeader, msg.DeduplicationID)
+	}
+	_, err = q.js.PublishMsg(ctx, m)
+	return err
+}
+
+// SendBatch publishes msgs one by one; JetStream has no batch publish
+func (q *natsQueue) SendBatch(ctx context.Context, queue string, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = q.Send(ctx, queue, msg)
+	}
+	return errs
+}
+
+func natsMessage(subject string, body []byte, attributes map[string]string) (*nats.Msg, error) {
+	m := nats.NewMsg(subject)
+	m.Data = body
+	if len(attributes) > 0 {
+		encoded, err := json.Marshal(attributes)
+		if err != nil {
+			return nil, err
+		}
+		m.Header.Set(natsHeaderAttributes, string(encoded))
+	}
+	return m, nil
+}
+
+func (q *natsQueue) Receive(ctx context.Context, queue string, opts ReceiveOptions) ([]Delivery, error) {
+	visibility := opts.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = natsVisibilityTimeout
+	}
+	consumer, err := q.consumer(ctx, queue, visibility)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch jetstream.MessageBatch
+	if opts.Wait > 0 {
+		fetchCtx, cancel := context.WithTimeout(ctx, opts.Wait)
+		defer cancel()
+		batch, err = consumer.Fetch(opts.max(), jetstream.FetchContext(fetchCtx))
+	} else {
+		batch, err = consumer.FetchNoWait(opts.max())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []Delivery
+	for m := range batch.Messages() {
+		meta, err := m.Metadata()
+		if err != nil {
+			q.logger.Error("Failed to read message metadata", zap.String("queue", queue), zap.Error(err))
+			continue
+		}
+		count := int(meta.NumDelivered)
+		if count > MaxReceives {
+			if err := q.deadLetter(ctx, queue, m, meta, count-1); err != nil {
+				q.logger.Error("Failed to dead-letter message", zap.String("queue", queue), zap.Uint64("seq", meta.Sequence.Stream), zap.Error(err))
+			}
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			ID:           m.Reply(),
+			Body:         m.Data(),
+			Attributes:   natsAttributes(m.Headers()),
+			ReceiveCount: count,
+		})
+	}
+	if ctx.Err() != nil {
+		return deliveries, ctx.Err()
+	}
+	if err := batch.Error(); err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, jetstream.ErrNoMessages) {
+		return deliveries, err
+	}
+	return deliveries, nil
+}
+
+// Ack acknowledges a message through its reply subject and waits for the
+// server to confirm, so an ack that didn't reach it is reported
+func (q *natsQueue) Ack(ctx context.Context, queue string, d Delivery) error {
+	_, err := q.conn.RequestWithContext(ctx, d.ID, []byte("+ACK"))
+	return err
+}
+
+// consumer returns the queue's consumer, creating it or updating its ack
+// wait when a Receive asks for a different visibility timeout
+func (q *natsQueue) consumer(ctx context.Context, queue string, ackWait time.Duration) (jetstream.Consumer, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if c, ok := q.consumers[queue]; ok && c.ackWait == ackWait {
+		return c.consumer, nil
+	}
+	consumer, err := q.js.CreateOrUpdateConsumer(ctx, natsStream, jetstream.ConsumerConfig{
+		Durable:       natsConsumerPrefix + queue,
+		FilterSubject: natsSubject(queue),
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       ackWait,
+		// Receive dead-letters messages itself after MaxReceives
+		MaxDeliver: -1,
+	})
+	if err != nil {
+		return nil, err
+	}
+	q.consumers[queue] = natsConsumer{consumer: consumer, ackWait: ackWait}
+	return consumer, nil
+}
+
+// deadLetter copies a message to the dead-letter stream, then acknowledges
+// it so the work queue drops it
+func (q *natsQueue) deadLetter(ctx context.Context, queue string, m jetstream.Msg, meta *jetstream.MsgMetadata, receiveCount int) error {
+	dead := nats.NewMsg(natsDeadLetterSubject(queue))
+	dead.Data = m.Data()
+	if attributes := m.Headers().Get(natsHeaderAttributes); attributes != "" {
+		dead.Header.Set(natsHeaderAttributes, attributes)
+	}
+	dead.Header.Set(natsHeaderReceiveCount, strconv.Itoa(receiveCount))
+	dead.Header.Set(natsHeaderSentAt, meta.Timestamp.UTC().Format(time.RFC3339Nano))
+	if _, err := q.js.PublishMsg(ctx, dead); err != nil {
+		return err
+	}
+	return m.DoubleAck(ctx)
+}
+
+func natsAttributes(header nats.Header) map[string]string {
+	var attributes map[string]string
+	if encoded := header.Get(natsHeaderAttributes); encoded != "" {
+		json.Unmarshal([]byte(encoded), &attributes)
+	}
+	return attributes
+}
+
+// Dead letters are addressed by their sequence in the dead-letter stream
+
+func (q *natsQueue) ListDeadLetters(ctx context.Context, queue string, max int) ([]DeadLetter, error) {
+	stream, err := q.js.Stream(ctx, natsDeadLetterStream)
+	if err != nil {
+		return nil, err
+	}
+	var letters []DeadLetter
+	seq := uint64(1)
+	for len(letters) < max {
+		m, err := stream.GetMsg(ctx, seq, jetstream.WithGetMsgSubject(natsDeadLetterSubject(queue)))
+		if errors.Is(err, jetstream.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, natsDeadLetter(queue, m))
+		seq = m.Sequence + 1
+	}
+	return letters, nil
+}
+
+func (q *natsQueue) GetDeadLetter(ctx context.Context, queue, id string) (*DeadLetter, error) {
+	m, err := q.deadLetterMsg(ctx, queue, id)
+	if err != nil {
+		return nil, err
+	}
+	letter := natsDeadLetter(queue, m)
+	return &letter, nil
+}
+
+func (q *natsQueue) RedriveDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	redriven := 0
+	for _, id := range ids {
+		m, err := q.deadLetterMsg(ctx, queue, id)
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			continue
+		}
+		if err != nil {
+			return redriven, err
+		}
+		if err := q.Send(ctx, queue, Message{Body: m.Data, Attributes: natsAttributes(m.Header)}); err != nil {
+			return redriven, err
+		}
+		if err := q.deleteDeadLetter(ctx, m.Sequence); err != nil {
+			return redriven, err
+		}
+		redriven++
+	}
+	return redriven, nil
+}
+
+func (q *natsQueue) DiscardDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	discarded := 0
+	for _, id := range ids {
+		m, err := q.deadLetterMsg(ctx, queue, id)
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			continue
+		}
+		if err != nil {
+			return discarded, err
+		}
+		if err := q.deleteDeadLetter(ctx, m.Sequence); err != nil {
+			return discarded, err
+		}
+		discarded++
+	}
+	return discarded, nil
+}
+
+// deadLetterMsg looks up a dead letter, checking it belongs to the queue
+func (q *natsQueue) deadLetterMsg(ctx context.Context, queue, id string) (*jetstream.RawStreamMsg, error) {
+	seq, err := strconv.ParseUint(id, 10, 64)
+	if err != nil || seq == 0 {
+		return nil, ErrDeadLetterNotFound
+	}
+	stream, err := q.js.Stream(ctx, natsDeadLetterStream)
+	if err != nil {
+		return nil, err
+	}
+	m, err := stream.GetMsg(ctx, seq)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.Subject != natsDeadLetterSubject(queue) {
+		return nil, ErrDeadLetterNotFound
+	}
+	return m, nil
+}
+
+func (q *natsQueue) deleteDeadLetter(ctx context.Context, seq uint64) error {
+	stream, err := q.js.Stream(ctx, natsDeadLetterStream)
+	if err != nil {
+		return err
+	}
+	err = stream.DeleteMsg(ctx, seq)
+	if errors.Is(err, jetstream.ErrMsgNotFound) {
+		return nil
+	}
+	return err
+}
+
+func natsDeadLetter(queue string, m *jetstream.RawStreamMsg) DeadLetter {
+	letter := DeadLetter{
+		ID:         strconv.FormatUint(m.Sequence, 10),
+		Queue:      queue,
+		Body:       deadLetterBody(m.Data),
+		Attributes: natsAttributes(m.Header),
+	}
+	letter.ReceiveCount, _ = strconv.Atoi(m.Header.Get(natsHeaderReceiveCount))
+	if sentAt, err := time.Parse(time.RFC3339Nano, m.Header.Get(natsHeaderSentAt)); err == nil {
+		letter.SentAt = &sentAt
+	}
+	return letter
+}
+
+// QueueStats reads the consumer's counts. The oldest waiting message is the
+// first on the queue's subject after the last one delivered.
+func (q *natsQueue) QueueStats(ctx context.Context, queue string) (Stats, error) {
+	// Looked up rather than created, so reading stats doesn't reset the ack
+	// wait a worker configured
+	consumer, err := q.js.Consumer(ctx, natsStream, natsConsumerPrefix+queue)
+	if errors.Is(err, jetstream.ErrConsumerNotFound) {
+		consumer, err = q.consumer(ctx, queue, natsVisibilityTimeout)
+	}
+	if err != nil {
+		return Stats{}, err
+	}
+	info, err := consumer.Info(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+	stats := Stats{
+		Depth:    int64(info.NumPending),
+		InFlight: int64(info.NumAckPending),
+	}
+	if stats.Depth == 0 {
+		return stats, nil
+	}
+
+	stream, err := q.js.Stream(ctx, natsStream)
+	if err != nil {
+		return Stats{}, err
+	}
+	next, err := stream.GetMsg(ctx, info.Delivered.Stream+1, jetstream.WithGetMsgSubject(natsSubject(queue)))
+	if err != nil && !errors.Is(err, jetstream.ErrMsgNotFound) {
+		return Stats{}, err
+	}
+	if next != nil {
+		age := time.Since(next.Time)
+		stats.OldestAge = &age
+	}
+	return stats, nil
+}
@@ -0,0 +1,240 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// How often the relay looks for unsent jobs
+	outboxPollInterval = 500 * time.Millisecond
+
+	// Most jobs published per relay transaction
+	outboxBatchSize = 50
+
+	// Sent jobs are kept this long for debugging, then deleted
+	outboxRetention = 24 * time.Hour
+
+	// Backoff between attempts to send a job the queue rejected
+	outboxInitialBackoff = time.Second
+	outboxMaxBackoff     = 5 * time.Minute
+
+	// Failures after this many attempts are logged as errors
+	outboxAlertAttempts = 10
+
+	// A job still failing after this many attempts (roughly an hour of
+	// backoff) is moved to the quarantine instead of retried forever
+	outboxQuarantineAttempts = 25
+)
+
+// Outbox makes job dispatch atomic with the database change that causes it.
+// Jobs are written to the job_outbox table in the caller's transaction, so a
+// crash can't leave an execution without its job or a job without its
+// execution; the relay then publishes them to the queue.
+type Outbox struct {
+	db     *database.DB
+	queue  Queue
+	logger *zap.Logger
+}
+
+// NewOutbox creates an outbox that relays to q
+func NewOutbox(db *database.DB, q Queue, logger *zap.Logger) *Outbox {
+	return &Outbox{db: db, queue: q, logger: logger}
+}
+
+// Enqueue writes a job in tx. It is published once tx commits.
+func (o *Outbox) Enqueue(ctx context.Context, tx pgx.Tx, queue string, msg Message) error {
+	attributes, err := json.Marshal(msg.Attributes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job attributes: %w", err)
+	}
+	// A delay counts from the enqueue, not the relay
+	_, err = tx.Exec(ctx, `
+		INSERT INTO job_outbox (queue, body, attributes, group_id, deliver_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), CASE WHEN $5::BIGINT > 0 THEN NOW() + $5::BIGINT * INTERVAL '1 millisecond' END)
+	`, queue, msg.Body, attributes, msg.GroupID, msg.Delay.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to write job to outbox: %w", err)
+	}
+	return nil
+}
+
+// Run publishes committed jobs until ctx is cancelled. Relays on several API
+// instances don't publish the same job twice: each locks the rows it sends.
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Now()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		// Drain the backlog before waiting again
+		for {
+			sent, err := o.relayBatch(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					o.logger.Error("Failed to relay outbox jobs", zap.Error(err))
+				}
+				break
+			}
+			if sent < outboxBatchSize {
+				break
+			}
+		}
+
+		if time.Since(lastCleanup) > time.Hour {
+			lastCleanup = time.Now()
+			if _, err := o.db.Pool.Exec(ctx, `
+				DELETE FROM job_outbox WHERE sent_at < $1
+			`, time.Now().Add(-outboxRetention)); err != nil {
+				o.logger.Warn("Failed to delete sent outbox jobs", zap.Error(err))
+			}
+		}
+	}
+}
+
+// relayBatch publishes up to outboxBatchSize unsent jobs, oldest first,
+// with one batch send per queue, and returns how many it sent. Jobs that
+// fail to send stay unsent and are retried with jittered exponential
+// backoff, so a queue outage doesn't turn into a retry storm when it ends.
+// Delivery is at least once: a job is sent again if the transaction marking
+// it sent fails, though FIFO queues drop the copy within their
+// deduplication window. The transaction isn't retried, since that would
+// send the batch again; the next poll picks the jobs up instead.
+func (o *Outbox) relayBatch(ctx context.Context) (int, error) {
+	sent := 0
+	err := o.db.WithTransactionOptions(ctx, database.TxOptions{MaxAttempts: 1}, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, `
+			SELECT id, queue, body, attributes, COALESCE(group_id, ''), attempts,
+			       COALESCE(GREATEST(EXTRACT(EPOCH FROM deliver_at - NOW()) * 1000, 0), 0)::BIGINT
+			FROM job_outbox
+			WHERE sent_at IS NULL AND (next_attempt_at IS NULL OR next_attempt_at <= NOW())
+			ORDER BY id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		`, outboxBatchSize)
+		if err != nil {
+			return fmt.Errorf("failed to read outbox: %w", err)
+		}
+
+		type outboxJob struct {
+			id       int64
+			queue    string
+			msg      Message
+			attempts int
+		}
+		var jobs []outboxJob
+		for rows.Next() {
+			var job outboxJob
+			var attributes []byte
+			var delayMillis int64
+			if err := rows.Scan(&job.id, &job.queue, &job.msg.Body, &attributes, &job.msg.GroupID, &job.attempts, &delayMillis); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan outbox job: %w", err)
+			}
+			if len(attributes) > 0 {
+				json.Unmarshal(attributes, &job.msg.Attributes)
+			}
+			job.msg.Delay = time.Duration(delayMillis) * time.Millisecond
+			// A job the relay sends twice is dropped by FIFO queues
+			job.msg.DeduplicationID = "outbox-" + strconv.FormatInt(job.id, 10)
+			jobs = append(jobs, job)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read outbox: %w", err)
+		}
+
+		// Each queue's jobs go out as one batch, in order
+		byQueue := make(map[string][]outboxJob)
+		var queues []string
+		for _, job := range jobs {
+			if _, ok := byQueue[job.queue]; !ok {
+				queues = append(queues, job.queue)
+			}
+			byQueue[job.queue] = append(byQueue[job.queue], job)
+		}
+
+		var sentIDs []int64
+		for _, queue := range queues {
+			batch := byQueue[queue]
+			msgs := make([]Message, len(batch))
+			for i, job := range batch {
+				msgs[i] = job.msg
+			}
+
+			for i, sendErr := range o.queue.SendBatch(ctx, queue, msgs) {
+				job := batch[i]
+				if sendErr == nil {
+					sentIDs = append(sentIDs, job.id)
+					continue
+				}
+
+				attempts := job.attempts + 1
+				if attempts >= outboxQuarantineAttempts {
+					o.logger.Error("Quarantining outbox job that keeps failing to publish",
+						zap.Int64("id", job.id),
+						zap.String("queue", job.queue),
+						zap.Int("attempts", attempts),
+						zap.Error(sendErr),
+					)
+					if _, err := tx.Exec(ctx, `
+						WITH moved AS (
+							DELETE FROM job_outbox WHERE id = $1
+							RETURNING queue, body, attributes, group_id, attempts
+						)
+						INSERT INTO job_quarantine (queue, body, attributes, group_id, source, attempts, last_error)
+						SELECT queue, body, attributes, group_id, $2, attempts + 1, $3 FROM moved
+					`, job.id, QuarantineSourceOutbox, sendErr.Error()); err != nil {
+						return fmt.Errorf("failed to quarantine outbox job: %w", err)
+					}
+					continue
+				}
+
+				retryIn := Backoff(attempts, outboxInitialBackoff, outboxMaxBackoff)
+				log := o.logger.Warn
+				if attempts >= outboxAlertAttempts {
+					log = o.logger.Error
+				}
+				log("Failed to publish outbox job",
+					zap.Int64("id", job.id),
+					zap.String("queue", job.queue),
+					zap.Int("attempts", attempts),
+					zap.Duration("retryIn", retryIn),
+					zap.Error(sendErr),
+				)
+				if _, err := tx.Exec(ctx, `
+					UPDATE job_outbox
+					SET attempts = attempts + 1, last_error = $2, next_attempt_at = $3
+					WHERE id = $1
+				`, job.id, sendErr.Error(), time.Now().Add(retryIn)); err != nil {
+					return fmt.Errorf("failed to record outbox failure: %w", err)
+				}
+			}
+		}
+
+		if len(sentIDs) > 0 {
+			if _, err := tx.Exec(ctx, `
+				UPDATE job_outbox SET sent_at = NOW(), attempts = attempts + 1
+				WHERE id = ANY($1)
+			`, sentIDs); err != nil {
+				return fmt.Errorf("failed to mark outbox jobs sent: %w", err)
+			}
+		}
+		sent = len(sentIDs)
+		return nil
+	})
+	return sent, err
+}
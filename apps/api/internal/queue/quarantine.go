@@ -0,0 +1,171 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Where a quarantined job was caught
+const (
+	// The outbox relay gave up publishing it after outboxQuarantineAttempts
+	QuarantineSourceOutbox = "outbox"
+
+	// A worker received it but couldn't decode it (ErrInvalidJob)
+	QuarantineSourceConsumer = "consumer"
+)
+
+// ErrQuarantinedJobNotFound is returned for a quarantined job that doesn't
+// exist or was already released or discarded
+var ErrQuarantinedJobNotFound = errors.New("quarantined job not found")
+
+// QuarantinedJob is a job set aside for review because retrying it can't
+// succeed: it keeps failing to publish, or workers can't decode it. Unlike
+// dead letters, these live in the job_quarantine table, so they can't be
+// lost to a queue's retention period.
+type QuarantinedJob struct {
+	ID         int64             `json:"id"`
+	Queue      string            `json:"queue"`
+	Body       json.RawMessage   `json:"body"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	GroupID    string            `json:"groupId,omitempty"`
+	Source     string            `json:"source"`
+	Attempts   int               `json:"attempts"`
+	LastError  string            `json:"lastError"`
+	CreatedAt  time.Time         `json:"createdAt"`
+}
+
+// Quarantine stores jobs that failed too often to retry blindly and lets
+// admins release them back to their queue or discard them
+type Quarantine struct {
+	db     *database.DB
+	outbox *Outbox
+	logger *zap.Logger
+}
+
+// NewQuarantine creates a quarantine that releases jobs through outbox.
+// Workers, which only add jobs, may pass a nil outbox.
+func NewQuarantine(db *database.DB, outbox *Outbox, logger *zap.Logger) *Quarantine {
+	return &Quarantine{db: db, outbox: outbox, logger: logger}
+}
+
+// Add quarantines a job a worker received
+func (q *Quarantine) Add(ctx context.Context, queue string, d Delivery, source string, cause error) error {
+	attributes, err := json.Marshal(d.Attributes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job attributes: %w", err)
+	}
+	_, err = q.db.Pool.Exec(ctx, `
+		INSERT INTO job_quarantine (queue, body, attributes, source, attempts, last_error)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, queue, d.Body, attributes, source, max(d.ReceiveCount, 1), cause.Error())
+	if err != nil {
+		return fmt.Errorf("failed to quarantine job: %w", err)
+	}
+	q.logger.Warn("Quarantined job", zap.String("queue", queue), zap.String("source", source), zap.Error(cause))
+	return nil
+}
+
+// List returns a queue's most recently quarantined jobs
+func (q *Quarantine) List(ctx context.Context, queue string, limit int) ([]QuarantinedJob, error) {
+	rows, err := q.db.Pool.Query(ctx, `
+		SELECT id, queue, body, attributes, COALESCE(group_id, ''), source, attempts,
+		       COALESCE(last_error, ''), created_at
+		FROM job_quarantine
+		WHERE queue = $1
+		ORDER BY id DESC
+		LIMIT $2
+	`, queue, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list quarantined jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []QuarantinedJob{}
+	for rows.Next() {
+		job, err := scanQuarantinedJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, rows.Err()
+}
+
+// Get returns one quarantined job
+func (q *Quarantine) Get(ctx context.Context, id int64) (*QuarantinedJob, error) {
+	row := q.db.Pool.QueryRow(ctx, `
+		SELECT id, queue, body, attributes, COALESCE(group_id, ''), source, attempts,
+		       COALESCE(last_error, ''), created_at
+		FROM job_quarantine
+		WHERE id = $1
+	`, id)
+	job, err := scanQuarantinedJob(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrQuarantinedJobNotFound
+	}
+	return job, err
+}
+
+// Release sends a quarantined job back to its queue through the outbox,
+// with its attempts reset. It should only be released once whatever made it
+// fail has been fixed.
+func (q *Quarantine) Release(ctx context.Context, id int64) error {
+	return q.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var queue, groupID string
+		var body, attributes []byte
+		err := tx.QueryRow(ctx, `
+			DELETE FROM job_quarantine WHERE id = $1
+			RETURNING queue, body, attributes, COALESCE(group_id, '')
+		`, id).Scan(&queue, &body, &attributes, &groupID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrQuarantinedJobNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to release quarantined job: %w", err)
+		}
+
+		msg := Message{Body: body, GroupID: groupID}
+		if len(attributes) > 0 {
+			json.Unmarshal(attributes, &msg.Attributes)
+		}
+		return q.outbox.Enqueue(ctx, tx, queue, msg)
+	})
+}
+
+// Discard deletes a quarantined job
+func (q *Quarantine) Discard(ctx context.Context, id int64) error {
+	tag, err := q.db.Pool.Exec(ctx, `DELETE FROM job_quarantine WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to discard quarantined job: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQuarantinedJobNotFound
+	}
+	return nil
+}
+
+func scanQuarantinedJob(row pgx.Row) (*QuarantinedJob, error) {
+	var job QuarantinedJob
+	var body, attributes []byte
+	err := row.Scan(&job.ID, &job.Queue, &body, &attributes, &job.GroupID, &job.Source,
+		&job.Attempts, &job.LastError, &job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	// Bodies that aren't JSON are shown as a string
+	job.Body = body
+	if !json.Valid(body) {
+		job.Body, _ = json.Marshal(string(body))
+	}
+	if len(attributes) > 0 {
+		json.Unmarshal(attributes, &job.Attributes)
+	}
+	return &job, nil
+}
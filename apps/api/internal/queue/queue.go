@@ -0,0 +1,129 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"go.uber.org/zap"
+)
+
+// Backends, selected with QUEUE_BACKEND
+const (
+	BackendSQS      = "sqs"
+	BackendRedis    = "redis"
+	BackendNATS     = "nats"
+	BackendRabbitMQ = "rabbitmq"
+	BackendMemory   = "memory"
+)
+
+// Logical queue names. Each backend maps them to its own queues: SQS queue
+// URLs, Redis stream keys, NATS subjects, RabbitMQ queues, in-memory lists.
+const (
+	AgentJobs      = "agent"
+	AgentBatchJobs = "agent-batch"
+	FileJobs       = "file"
+)
+
+// Agent job priorities. Interactive jobs, which someone is waiting on, go to
+// AgentJobs; batch jobs go to AgentBatchJobs so a backlog of them can't hold
+// up interactive ones.
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// AgentQueue returns the queue for agent jobs of a priority
+func AgentQueue(priority string) string {
+	if priority == PriorityBatch {
+		return AgentBatchJobs
+	}
+	return AgentJobs
+}
+
+// ErrUnknownQueue is returned for a queue name the backend has no mapping for
+var ErrUnknownQueue = errors.New("unknown queue")
+
+// Message is a message to send
+type Message struct {
+	Body       []byte
+	Attributes map[string]string
+
+	// SQS FIFO queues only: messages with the same GroupID are delivered in
+	// order, one at a time, and a message whose DeduplicationID matches one
+	// sent in the last five minutes is dropped. Without a DeduplicationID
+	// the queue's content-based deduplication applies. Other backends
+	// ignore both.
+	GroupID         string
+	DeduplicationID string
+
+	// Delay postpones the first delivery. SQS standard queues delay up to
+	// 15 minutes themselves; longer delays, and delays on backends without
+	// them, need the Scheduler.
+	Delay time.Duration
+}
+
+// Delivery is a received message. It is redelivered after the visibility
+// timeout unless acknowledged.
+type Delivery struct {
+	// Backend handle used to acknowledge the message
+	ID           string
+	Body         []byte
+	Attributes   map[string]string
+	ReceiveCount int
+}
+
+// ReceiveOptions controls a Receive call
+type ReceiveOptions struct {
+	// Most messages to return; defaults to 10
+	Max int
+
+	// How long to wait for a message when none are ready
+	Wait time.Duration
+
+	// How long received messages stay hidden before being redelivered;
+	// defaults to the backend's queue setting
+	VisibilityTimeout time.Duration
+}
+
+// Queue is a message queue backend. Self-hosted deployments can run on Redis
+// Streams, NATS JetStream or RabbitMQ instead of SQS; the in-memory backend
+// is for local development.
+type Queue interface {
+	Send(ctx context.Context, queue string, msg Message) error
+
+	// SendBatch sends several messages in as few calls as the backend
+	// allows. It returns one error per message, nil for those sent.
+	SendBatch(ctx context.Context, queue string, msgs []Message) []error
+
+	Receive(ctx context.Context, queue string, opts ReceiveOptions) ([]Delivery, error)
+	Ack(ctx context.Context, queue string, d Delivery) error
+}
+
+// New creates the queue backend selected by the config
+func New(cfg *config.Config, rdb *database.Redis, logger *zap.Logger) (Queue, error) {
+	switch cfg.QueueBackend {
+	case BackendSQS:
+		return newSQSQueue(cfg, logger)
+	case BackendRedis:
+		return newRedisQueue(rdb, logger), nil
+	case BackendNATS:
+		return newNATSQueue(cfg.NATSURL, logger)
+	case BackendRabbitMQ:
+		return newRabbitQueue(cfg.RabbitMQURL, logger)
+	case BackendMemory:
+		return NewMemoryQueue(), nil
+	default:
+		return nil, fmt.Errorf("unsupported queue backend %q", cfg.QueueBackend)
+	}
+}
+
+func (o ReceiveOptions) max() int {
+	if o.Max <= 0 {
+		return 10
+	}
+	return o.Max
+}
@@ -0,0 +1,495 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.uber.org/zap"
+)
+
+// Each queue is a durable quorum queue with its own dead-letter queue.
+// RabbitMQ has no visibility timeout, so unacknowledged deliveries are
+// returned to the queue when their timeout runs out; the quorum queue counts
+// returns and dead-letters a message once it has been delivered MaxReceives
+// times. Dead letters keep the message ID set when they were sent.
+const (
+	rabbitQueuePrefix         = "glassbox."
+	rabbitDeadLetterSuffix    = ".dlq"
+	rabbitVisibilityTimeout   = 5 * time.Minute
+	rabbitPollInterval        = 250 * time.Millisecond
+	rabbitHeaderAttribute     = "glassbox-"
+	rabbitHeaderDeliveryCount = "x-delivery-count"
+)
+
+var errRabbitDeliveryExpired = errors.New("delivery expired before it was acknowledged")
+
+// rabbitQueue sends to and receives from RabbitMQ queues
+type rabbitQueue struct {
+	url    string
+	logger *zap.Logger
+
+	// The connection and its channels are reopened after they close.
+	// Delivery tags belong to the receive channel, so IDs carry its
+	// generation and deliveries from an earlier channel can't be acked.
+	mu         sync.Mutex
+	conn       *amqp.Connection
+	publish    *amqp.Channel
+	receive    *amqp.Channel
+	generation int
+	declared   map[string]bool
+	unacked    map[string]rabbitUnacked
+}
+
+// rabbitUnacked is a delivery awaiting its ack
+type rabbitUnacked struct {
+	queue string
+	timer *time.Timer
+}
+
+// newRabbitQueue connects to RabbitMQ
+func newRabbitQueue(url string, logger *zap.Logger) (*rabbitQueue, error) {
+	q := &rabbitQueue{
+		url:      url,
+		logger:   logger,
+		declared: make(map[string]bool),
+		unacked:  make(map[string]rabbitUnacked),
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.connect(); err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+	}
+	return q, nil
+}
+
+func rabbitQueueName(queue string) string {
+	return rabbitQueuePrefix + queue
+}
+
+func rabbitDeadLetterQueue(queue string) string {
+	return rabbitQueuePrefix + queue + rabbitDeadLetterSuffix
+}
+
+// connect (re)opens the connection and channels. Callers hold q.mu.
+func (q *rabbitQueue) connect() error {
+	if q.conn == nil || q.conn.IsClosed() {
+		conn, err := amqp.Dial(q.url)
+		if err != nil {
+			return err
+		}
+		q.conn = conn
+	}
+	if q.publish == nil || q.publish.IsClosed() {
+		ch, err := q.conn.Channel()
+		if err != nil {
+			return err
+		}
+		// Publisher confirms, so Send only returns once the broker has the message
+		if err := ch.Confirm(false); err != nil {
+			ch.Close()
+			return err
+		}
+		q.publish = ch
+	}
+	if q.receive == nil || q.receive.IsClosed() {
+		ch, err := q.conn.Channel()
+		if err != nil {
+			return err
+		}
+		q.receive = ch
+		q.generation++
+		// Deliveries on the closed channel were returned to their queue
+		for id, u := range q.unacked {
+			u.timer.Stop()
+			delete(q.unacked, id)
+		}
+	}
+	return nil
+}
+
+// declare creates the queue and its dead-letter queue if needed. Callers
+// hold q.mu.
+func (q *rabbitQueue) declare(queue string) error {
+	if q.declared[queue] {
+		return nil
+	}
+	ch := q.publish
+	// Classic, so inspecting dead letters doesn't count towards a limit
+	if _, err := ch.QueueDeclare(rabbitDeadLetterQueue(queue), true, false, false, false, amqp.Table{
+		amqp.QueueTypeArg: amqp.QueueTypeClassic,
+	}); err != nil {
+		return err
+	}
+	if _, err := ch.QueueDeclare(rabbitQueueName(queue), true, false, false, false, amqp.Table{
+		amqp.QueueTypeArg: amqp.QueueTypeQuorum,
+		// Returns allowed before dead-lettering: the first delivery isn't one
+		"x-delivery-limit":          MaxReceives - 1,
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": rabbitDeadLetterQueue(queue),
+		// at-least-once dead-lettering needs publishes rejected when full
+		"x-dead-letter-strategy": "at-least-once",
+		amqp.QueueOverflowArg:    amqp.QueueOverflowRejectPublish,
+	}); err != nil {
+		return err
+	}
+	q.declared[queue] = true
+	return nil
+}
+
+// ready reconnects if needed and declares the queue, returning the
+// channels to use
+func (q *rabbitQueue) ready(queue string) (publish, receive *amqp.Channel, generation int, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if err := q.connect(); err != nil {
+		return nil, nil, 0, err
+	}
+	if err := q.declare(queue); err != nil {
+		return nil, nil, 0, err
+	}
+	return q.publish, q.receive, q.generation, nil
+}
+
+func (q *rabbitQueue) Send(ctx context.Context, queue string, msg Message) error {
+	publish, _, _, err := q.ready(queue)
+	if err != nil {
+		return err
+	}
+	return rabbitPublish(ctx, publish, rabbitQueueName(queue), rabbitPublishing(msg.Body, msg.Attributes, uuid.NewString()))
+}
+
+// SendBatch publishes msgs one by one; AMQP has no batch publish
+func (q *rabbitQueue) SendBatch(ctx context.Context, queue string, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	for i, msg := range msgs {
+		errs[i] = q.Send(ctx, queue, msg)
+	}
+	return errs
+}
+
+func rabbitPublishing(body []byte, attributes map[string]string, messageID string) amqp.Publishing {
+	headers := amqp.Table{}
+	for k, v := range attributes {
+		headers[rabbitHeaderAttribute+k] = v
+	}
+	return amqp.Publishing{
+		Headers:      headers,
+		ContentType:  "application/json",
+		DeliveryMode: amqp.Persistent,
+		MessageId:    messageID,
+		Timestamp:    time.Now(),
+		Body:         body,
+	}
+}
+
+// rabbitPublish publishes to a queue through the default exchange and waits
+// for the broker's confirm
+func rabbitPublish(ctx context.Context, ch *amqp.Channel, queue string, msg amqp.Publishing) error {
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", queue, false, false, msg)
+	if err != nil {
+		return err
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return err
+	}
+	if !acked {
+		return fmt.Errorf("RabbitMQ rejected message for %s", queue)
+	}
+	return nil
+}
+
+// Receive polls the queue until a message arrives or the wait runs out
+func (q *rabbitQueue) Receive(ctx context.Context, queue string, opts ReceiveOptions) ([]Delivery, error) {
+	visibility := opts.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = rabbitVisibilityTimeout
+	}
+
+	deadline := time.Now().Add(opts.Wait)
+	for {
+		_, ch, generation, err := q.ready(queue)
+		if err != nil {
+			return nil, err
+		}
+		var deliveries []Delivery
+		for len(deliveries) < opts.max() {
+			m, ok, err := ch.Get(rabbitQueueName(queue), false)
+			if err != nil {
+				return deliveries, err
+			}
+			if !ok {
+				break
+			}
+			deliveries = append(deliveries, q.track(queue, ch, generation, m, visibility))
+		}
+		if len(deliveries) > 0 {
+			return deliveries, nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+		timer := time.NewTimer(min(wait, rabbitPollInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// track returns a delivery to its queue unless it is acknowledged within
+// the visibility timeout
+func (q *rabbitQueue) track(queue string, ch *amqp.Channel, generation int, m amqp.Delivery, visibility time.Duration) Delivery {
+	id := fmt.Sprintf("%d:%d", generation, m.DeliveryTag)
+	tag := m.DeliveryTag
+
+	q.mu.Lock()
+	q.unacked[id] = rabbitUnacked{queue: queue, timer: time.AfterFunc(visibility, func() {
+		q.mu.Lock()
+		_, pending := q.unacked[id]
+		delete(q.unacked, id)
+		q.mu.Unlock()
+		if pending {
+			if err := ch.Nack(tag, false, true); err != nil && !ch.IsClosed() {
+				q.logger.Warn("Failed to return expired delivery", zap.String("queue", queue), zap.String("id", id), zap.Error(err))
+			}
+		}
+	})}
+	q.mu.Unlock()
+
+	return Delivery{
+		ID:           id,
+		Body:         m.Body,
+		Attributes:   rabbitAttributes(m.Headers),
+		ReceiveCount: rabbitDeliveryCount(m.Headers) + 1,
+	}
+}
+
+// Ack acknowledges a delivery on the channel it came from. Acking one the
+// broker no longer considers outstanding would close the channel, so
+// expired and stale deliveries fail here instead.
+func (q *rabbitQueue) Ack(ctx context.Context, queue string, d Delivery) error {
+	generation, tag, ok := parseRabbitDeliveryID(d.ID)
+	if !ok {
+		return fmt.Errorf("invalid delivery ID %q", d.ID)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	u, pending := q.unacked[d.ID]
+	if !pending || generation != q.generation {
+		return errRabbitDeliveryExpired
+	}
+	u.timer.Stop()
+	delete(q.unacked, d.ID)
+	return q.receive.Ack(tag, false)
+}
+
+func parseRabbitDeliveryID(id string) (int, uint64, bool) {
+	gen, tag, ok := strings.Cut(id, ":")
+	if !ok {
+		return 0, 0, false
+	}
+	generation, err := strconv.Atoi(gen)
+	if err != nil {
+		return 0, 0, false
+	}
+	deliveryTag, err := strconv.ParseUint(tag, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return generation, deliveryTag, true
+}
+
+func rabbitAttributes(headers amqp.Table) map[string]string {
+	var attributes map[string]string
+	for k, v := range headers {
+		name, ok := strings.CutPrefix(k, rabbitHeaderAttribute)
+		if !ok {
+			continue
+		}
+		if s, ok := v.(string); ok {
+			if attributes == nil {
+				attributes = make(map[string]string)
+			}
+			attributes[name] = s
+		}
+	}
+	return attributes
+}
+
+// rabbitDeliveryCount is how often a quorum queue message was returned
+func rabbitDeliveryCount(headers amqp.Table) int {
+	switch n := headers[rabbitHeaderDeliveryCount].(type) {
+	case int64:
+		return int(n)
+	case int32:
+		return int(n)
+	case int:
+		return n
+	}
+	return 0
+}
+
+// Dead letters are found by reading the dead-letter queue on a channel of
+// their own; closing it returns every message that wasn't acknowledged.
+
+// scanDeadLetters calls visit for each dead letter of a queue until it
+// returns false. Messages visit acknowledges leave the queue.
+func (q *rabbitQueue) scanDeadLetters(queue string, visit func(ch *amqp.Channel, m amqp.Delivery) (bool, error)) error {
+	q.mu.Lock()
+	if err := q.connect(); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	if err := q.declare(queue); err != nil {
+		q.mu.Unlock()
+		return err
+	}
+	conn := q.conn
+	q.mu.Unlock()
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+	for {
+		m, ok, err := ch.Get(rabbitDeadLetterQueue(queue), false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		more, err := visit(ch, m)
+		if err != nil || !more {
+			return err
+		}
+	}
+}
+
+func (q *rabbitQueue) ListDeadLetters(ctx context.Context, queue string, max int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	if max <= 0 {
+		return letters, nil
+	}
+	err := q.scanDeadLetters(queue, func(_ *amqp.Channel, m amqp.Delivery) (bool, error) {
+		letters = append(letters, rabbitDeadLetter(queue, m))
+		return len(letters) < max, nil
+	})
+	return letters, err
+}
+
+func (q *rabbitQueue) GetDeadLetter(ctx context.Context, queue, id string) (*DeadLetter, error) {
+	var letter *DeadLetter
+	err := q.scanDeadLetters(queue, func(_ *amqp.Channel, m amqp.Delivery) (bool, error) {
+		if m.MessageId != id {
+			return true, nil
+		}
+		found := rabbitDeadLetter(queue, m)
+		letter = &found
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if letter == nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	return letter, nil
+}
+
+func (q *rabbitQueue) RedriveDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	publish, _, _, err := q.ready(queue)
+	if err != nil {
+		return 0, err
+	}
+	wanted := idSet(ids)
+	redriven := 0
+	err = q.scanDeadLetters(queue, func(ch *amqp.Channel, m amqp.Delivery) (bool, error) {
+		if !wanted[m.MessageId] {
+			return true, nil
+		}
+		// Sent again rather than moved, so the delivery count starts over
+		msg := rabbitPublishing(m.Body, rabbitAttributes(m.Headers), m.MessageId)
+		if err := rabbitPublish(ctx, publish, rabbitQueueName(queue), msg); err != nil {
+			return false, err
+		}
+		if err := ch.Ack(m.DeliveryTag, false); err != nil {
+			return false, err
+		}
+		delete(wanted, m.MessageId)
+		redriven++
+		return len(wanted) > 0, nil
+	})
+	return redriven, err
+}
+
+func (q *rabbitQueue) DiscardDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	wanted := idSet(ids)
+	discarded := 0
+	err := q.scanDeadLetters(queue, func(ch *amqp.Channel, m amqp.Delivery) (bool, error) {
+		if !wanted[m.MessageId] {
+			return true, nil
+		}
+		if err := ch.Ack(m.DeliveryTag, false); err != nil {
+			return false, err
+		}
+		delete(wanted, m.MessageId)
+		discarded++
+		return len(wanted) > 0, nil
+	})
+	return discarded, err
+}
+
+func rabbitDeadLetter(queue string, m amqp.Delivery) DeadLetter {
+	letter := DeadLetter{
+		ID:           m.MessageId,
+		Queue:        queue,
+		Body:         deadLetterBody(m.Body),
+		Attributes:   rabbitAttributes(m.Headers),
+		ReceiveCount: MaxReceives,
+	}
+	if !m.Timestamp.IsZero() {
+		sentAt := m.Timestamp
+		letter.SentAt = &sentAt
+	}
+	return letter
+}
+
+// QueueStats reads the queue's ready count. RabbitMQ only reports
+// unacknowledged messages through its management API, so InFlight counts
+// this process's deliveries, and the oldest message's age isn't known.
+func (q *rabbitQueue) QueueStats(ctx context.Context, queue string) (Stats, error) {
+	publish, _, _, err := q.ready(queue)
+	if err != nil {
+		return Stats{}, err
+	}
+	info, err := publish.QueueDeclarePassive(rabbitQueueName(queue), true, false, false, false, nil)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	q.mu.Lock()
+	inFlight := 0
+	for _, u := range q.unacked {
+		if u.queue == queue {
+			inFlight++
+		}
+	}
+	q.mu.Unlock()
+
+	return Stats{Depth: int64(info.Messages), InFlight: int64(inFlight)}, nil
+}
@@ -0,0 +1,371 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Each queue is a Redis stream read by one consumer group, so every message
+// goes to a single worker. Entries carry the body and a JSON object of
+// attributes. Entries a worker read but didn't acknowledge within the
+// visibility timeout are claimed by the next Receive, like SQS redelivery;
+// after MaxReceives deliveries they move to the queue's dead-letter stream.
+const (
+	redisStreamPrefix        = "glassbox:queue:"
+	redisDeadLetterSuffix    = ":dlq"
+	redisConsumerGroup       = "glassbox-workers"
+	redisVisibilityTimeout   = 5 * time.Minute
+	redisStreamMaxLen        = 100000
+	redisFieldBody           = "body"
+	redisFieldAttributes     = "attributes"
+	redisFieldReceiveCount   = "receive_count"
+	redisFieldSourceID       = "source_id"
+	redisGroupExistsErrorMsg = "BUSYGROUP"
+)
+
+// redisQueue sends to and receives from Redis streams
+type redisQueue struct {
+	client   *redis.Client
+	consumer string
+	logger   *zap.Logger
+
+	// Streams whose consumer group is known to exist
+	groups sync.Map
+}
+
+func newRedisQueue(rdb *database.Redis, logger *zap.Logger) *redisQueue {
+	return &redisQueue{
+		client:   rdb.Client,
+		consumer: "api-" + uuid.NewString(),
+		logger:   logger,
+	}
+}
+
+func redisStream(queue string) string {
+	return redisStreamPrefix + queue
+}
+
+func redisDeadLetterStream(queue string) string {
+	return redisStreamPrefix + queue + redisDeadLetterSuffix
+}
+
+func (q *redisQueue) Send(ctx context.Context, queue string, msg Message) error {
+	return q.SendBatch(ctx, queue, []Message{msg})[0]
+}
+
+// SendBatch adds msgs to the stream in one pipeline
+func (q *redisQueue) SendBatch(ctx context.Context, queue string, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	cmds := make([]*redis.StringCmd, len(msgs))
+	pipe := q.client.Pipeline()
+	for i, msg := range msgs {
+		attributes, err := json.Marshal(msg.Attributes)
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		cmds[i] = pipe.XAdd(ctx, &redis.XAddArgs{
+			Stream: redisStream(queue),
+			MaxLen: redisStreamMaxLen,
+			Approx: true,
+			Values: map[string]any{
+				redisFieldBody:       msg.Body,
+				redisFieldAttributes: attributes,
+			},
+		})
+	}
+	// Per-command errors are read below
+	pipe.Exec(ctx)
+	for i, cmd := range cmds {
+		if cmd != nil {
+			errs[i] = cmd.Err()
+		}
+	}
+	return errs
+}
+
+func (q *redisQueue) Receive(ctx context.Context, queue string, opts ReceiveOptions) ([]Delivery, error) {
+	stream := redisStream(queue)
+	if err := q.ensureGroup(ctx, stream); err != nil {
+		return nil, err
+	}
+
+	visibility := opts.VisibilityTimeout
+	if visibility <= 0 {
+		visibility = redisVisibilityTimeout
+	}
+
+	// Redeliver entries whose consumer didn't acknowledge them in time
+	claimed, _, err := q.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+		Stream:   stream,
+		Group:    redisConsumerGroup,
+		Consumer: q.consumer,
+		MinIdle:  visibility,
+		Start:    "0-0",
+		Count:    int64(opts.max()),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(claimed) > 0 {
+		return q.deliveries(ctx, queue, claimed)
+	}
+
+	block := opts.Wait
+	if block <= 0 {
+		// Zero blocks forever in Redis
+		block = -1
+	}
+	streams, err := q.client.XReadGroup(ctx, &redis.XReadGroupArgs{
+		Group:    redisConsumerGroup,
+		Consumer: q.consumer,
+		Streams:  []string{stream, ">"},
+		Count:    int64(opts.max()),
+		Block:    block,
+	}).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []Delivery
+	for _, s := range streams {
+		for _, m := range s.Messages {
+			deliveries = append(deliveries, redisDelivery(m, 1))
+		}
+	}
+	return deliveries, nil
+}
+
+// deliveries converts claimed entries, looking up how often each was read.
+// Entries read more than MaxReceives times are dead-lettered instead.
+func (q *redisQueue) deliveries(ctx context.Context, queue string, messages []redis.XMessage) ([]Delivery, error) {
+	stream := redisStream(queue)
+	deliveries := make([]Delivery, 0, len(messages))
+	for _, m := range messages {
+		count := 1
+		pending, err := q.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: stream,
+			Group:  redisConsumerGroup,
+			Start:  m.ID,
+			End:    m.ID,
+			Count:  1,
+		}).Result()
+		if err == nil && len(pending) == 1 {
+			count = int(pending[0].RetryCount)
+		}
+		if count > MaxReceives {
+			if err := q.deadLetter(ctx, queue, m, count-1); err != nil {
+				q.logger.Error("Failed to dead-letter message", zap.String("queue", queue), zap.String("id", m.ID), zap.Error(err))
+			}
+			continue
+		}
+		deliveries = append(deliveries, redisDelivery(m, count))
+	}
+	return deliveries, nil
+}
+
+// deadLetter moves an entry to the queue's dead-letter stream
+func (q *redisQueue) deadLetter(ctx context.Context, queue string, m redis.XMessage, receiveCount int) error {
+	stream := redisStream(queue)
+	pipe := q.client.TxPipeline()
+	pipe.XAdd(ctx, &redis.XAddArgs{
+		Stream: redisDeadLetterStream(queue),
+		MaxLen: redisStreamMaxLen,
+		Approx: true,
+		Values: map[string]any{
+			redisFieldBody:         m.Values[redisFieldBody],
+			redisFieldAttributes:   m.Values[redisFieldAttributes],
+			redisFieldReceiveCount: receiveCount,
+			redisFieldSourceID:     m.ID,
+		},
+	})
+	pipe.XAck(ctx, stream, redisConsumerGroup, m.ID)
+	pipe.XDel(ctx, stream, m.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func redisDelivery(m redis.XMessage, receiveCount int) Delivery {
+	d := Delivery{ID: m.ID, ReceiveCount: receiveCount}
+	if body, ok := m.Values[redisFieldBody].(string); ok {
+		d.Body = []byte(body)
+	}
+	if attributes, ok := m.Values[redisFieldAttributes].(string); ok {
+		json.Unmarshal([]byte(attributes), &d.Attributes)
+	}
+	return d
+}
+
+func (q *redisQueue) Ack(ctx context.Context, queue string, d Delivery) error {
+	stream := redisStream(queue)
+	pipe := q.client.TxPipeline()
+	pipe.XAck(ctx, stream, redisConsumerGroup, d.ID)
+	pipe.XDel(ctx, stream, d.ID)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// ensureGroup creates the stream and its consumer group if needed
+func (q *redisQueue) ensureGroup(ctx context.Context, stream string) error {
+	if _, ok := q.groups.Load(stream); ok {
+		return nil
+	}
+	err := q.client.XGroupCreateMkStream(ctx, stream, redisConsumerGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), redisGroupExistsErrorMsg) {
+		return err
+	}
+	q.groups.Store(stream, true)
+	return nil
+}
+
+func (q *redisQueue) ListDeadLetters(ctx context.Context, queue string, max int) ([]DeadLetter, error) {
+	entries, err := q.client.XRangeN(ctx, redisDeadLetterStream(queue), "-", "+", int64(max)).Result()
+	if err != nil {
+		return nil, err
+	}
+	letters := make([]DeadLetter, 0, len(entries))
+	for _, m := range entries {
+		letters = append(letters, redisDeadLetter(queue, m))
+	}
+	return letters, nil
+}
+
+func (q *redisQueue) GetDeadLetter(ctx context.Context, queue, id string) (*DeadLetter, error) {
+	m, err := q.deadLetterEntry(ctx, queue, id)
+	if err != nil {
+		return nil, err
+	}
+	letter := redisDeadLetter(queue, *m)
+	return &letter, nil
+}
+
+func (q *redisQueue) RedriveDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	redriven := 0
+	for _, id := range ids {
+		m, err := q.deadLetterEntry(ctx, queue, id)
+		if errors.Is(err, ErrDeadLetterNotFound) {
+			continue
+		}
+		if err != nil {
+			return redriven, err
+		}
+		d := redisDelivery(*m, 0)
+		if err := q.Send(ctx, queue, Message{Body: d.Body, Attributes: d.Attributes}); err != nil {
+			return redriven, err
+		}
+		if err := q.client.XDel(ctx, redisDeadLetterStream(queue), id).Err(); err != nil {
+			return redriven, err
+		}
+		redriven++
+	}
+	return redriven, nil
+}
+
+func (q *redisQueue) DiscardDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	discarded := 0
+	for _, id := range ids {
+		n, err := q.client.XDel(ctx, redisDeadLetterStream(queue), id).Result()
+		if isInvalidStreamID(err) {
+			continue
+		}
+		if err != nil {
+			return discarded, err
+		}
+		discarded += int(n)
+	}
+	return discarded, nil
+}
+
+func (q *redisQueue) deadLetterEntry(ctx context.Context, queue, id string) (*redis.XMessage, error) {
+	entries, err := q.client.XRange(ctx, redisDeadLetterStream(queue), id, id).Result()
+	if isInvalidStreamID(err) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrDeadLetterNotFound
+	}
+	return &entries[0], nil
+}
+
+func redisDeadLetter(queue string, m redis.XMessage) DeadLetter {
+	d := redisDelivery(m, 0)
+	letter := DeadLetter{
+		ID:         m.ID,
+		Queue:      queue,
+		Body:       deadLetterBody(d.Body),
+		Attributes: d.Attributes,
+	}
+	if count, ok := m.Values[redisFieldReceiveCount].(string); ok {
+		letter.ReceiveCount, _ = strconv.Atoi(count)
+	}
+	// Stream IDs start with the entry's Unix time in milliseconds
+	if source, ok := m.Values[redisFieldSourceID].(string); ok {
+		if ms, _, ok := strings.Cut(source, "-"); ok {
+			if millis, err := strconv.ParseInt(ms, 10, 64); err == nil {
+				sentAt := time.UnixMilli(millis)
+				letter.SentAt = &sentAt
+			}
+		}
+	}
+	return letter
+}
+
+// isInvalidStreamID reports a malformed entry ID, which can't exist in the stream
+func isInvalidStreamID(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "Invalid stream ID")
+}
+
+// QueueStats counts the stream's entries: pending ones are in flight, the
+// rest wait. The oldest waiting entry's age comes from its ID.
+func (q *redisQueue) QueueStats(ctx context.Context, queue string) (Stats, error) {
+	stream := redisStream(queue)
+	if err := q.ensureGroup(ctx, stream); err != nil {
+		return Stats{}, err
+	}
+
+	length, err := q.client.XLen(ctx, stream).Result()
+	if err != nil {
+		return Stats{}, err
+	}
+	groups, err := q.client.XInfoGroups(ctx, stream).Result()
+	if err != nil {
+		return Stats{}, err
+	}
+	var stats Stats
+	lastDelivered := "0-0"
+	for _, g := range groups {
+		if g.Name == redisConsumerGroup {
+			stats.InFlight = g.Pending
+			lastDelivered = g.LastDeliveredID
+		}
+	}
+	stats.Depth = max(length-stats.InFlight, 0)
+
+	next, err := q.client.XRangeN(ctx, stream, "("+lastDelivered, "+", 1).Result()
+	if err != nil {
+		return Stats{}, err
+	}
+	if len(next) == 1 {
+		if millis, err := strconv.ParseInt(strings.SplitN(next[0].ID, "-", 2)[0], 10, 64); err == nil {
+			age := time.Since(time.UnixMilli(millis))
+			stats.OldestAge = &age
+		}
+	}
+	return stats, nil
+}
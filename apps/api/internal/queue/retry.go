@@ -0,0 +1,42 @@
+package queue
+
+import (
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy is sent with each job to tell workers how to retry it. A
+// worker that fails a job hides it for Backoff(receive count) before the
+// next delivery; after MaxAttempts deliveries it goes to the dead-letter
+// queue.
+type RetryPolicy struct {
+	MaxAttempts           int `json:"maxAttempts"`
+	InitialBackoffSeconds int `json:"initialBackoffSeconds"`
+	MaxBackoffSeconds     int `json:"maxBackoffSeconds"`
+}
+
+// DefaultRetryPolicy is attached to jobs that don't set their own
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:           MaxReceives,
+	InitialBackoffSeconds: 30,
+	MaxBackoffSeconds:     600,
+}
+
+// Backoff returns the delay before retry number attempt (1 for the first
+// retry): exponential from initial up to max, with jitter so that jobs that
+// failed together don't retry together
+func Backoff(attempt int, initial, max time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := initial
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	// Equal jitter: at least half the delay, so retries still spread out
+	half := delay / 2
+	return half + rand.N(delay-half+1)
+}
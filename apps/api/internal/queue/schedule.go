@@ -0,0 +1,223 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Messages delayed longer than the backend supports are kept in a Redis
+// sorted set scored by due time (Unix milliseconds) until the scheduler
+// sends them
+const (
+	schedulerKey          = "glassbox:queue:scheduled"
+	schedulerPollInterval = time.Second
+	schedulerBatchSize    = 100
+
+	// A claimed message is sent again if its claimer doesn't remove it in
+	// this time, so a crash between claiming and sending loses nothing
+	schedulerLease = 30 * time.Second
+)
+
+// sqsMaxDelay is the longest DelaySeconds SQS accepts
+const sqsMaxDelay = 15 * time.Minute
+
+// delayLimiter is implemented by backends that delay messages themselves,
+// up to the returned duration
+type delayLimiter interface {
+	maxDelay(queue string) time.Duration
+}
+
+// Scheduler adds delays of any length to a queue backend. Messages with a
+// Delay the backend can handle go straight to it; longer ones are held in
+// Redis and sent when due by Run. Delivery is at least once.
+type Scheduler struct {
+	Queue
+	client *redis.Client
+	logger *zap.Logger
+}
+
+// NewScheduler wraps q with the Redis-backed scheduler
+func NewScheduler(q Queue, rdb *database.Redis, logger *zap.Logger) *Scheduler {
+	return &Scheduler{Queue: q, client: rdb.Client, logger: logger}
+}
+
+// scheduledMessage is a held message. The ID keeps identical messages
+// apart in the sorted set.
+type scheduledMessage struct {
+	ID              string            `json:"id"`
+	Queue           string            `json:"queue"`
+	Body            []byte            `json:"body"`
+	Attributes      map[string]string `json:"attributes,omitempty"`
+	GroupID         string            `json:"groupId,omitempty"`
+	DeduplicationID string            `json:"deduplicationId,omitempty"`
+
+	// The sorted set member it was read from
+	member string
+}
+
+// Send sends msg, holding it in Redis first if its delay is longer than
+// the backend supports
+func (s *Scheduler) Send(ctx context.Context, queue string, msg Message) error {
+	if msg.Delay <= s.maxDelay(queue) {
+		return s.Queue.Send(ctx, queue, msg)
+	}
+	return s.schedule(ctx, queue, msg)
+}
+
+// SendBatch sends msgs as a batch, holding those with delays longer than
+// the backend supports
+func (s *Scheduler) SendBatch(ctx context.Context, queue string, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	var now []Message
+	var nowIndexes []int
+	for i, msg := range msgs {
+		if msg.Delay <= s.maxDelay(queue) {
+			now = append(now, msg)
+			nowIndexes = append(nowIndexes, i)
+			continue
+		}
+		errs[i] = s.schedule(ctx, queue, msg)
+	}
+	if len(now) > 0 {
+		for j, err := range s.Queue.SendBatch(ctx, queue, now) {
+			errs[nowIndexes[j]] = err
+		}
+	}
+	return errs
+}
+
+// schedule holds msg in Redis until its delay ends
+func (s *Scheduler) schedule(ctx context.Context, queue string, msg Message) error {
+	member, err := json.Marshal(scheduledMessage{
+		ID:              uuid.NewString(),
+		Queue:           queue,
+		Body:            msg.Body,
+		Attributes:      msg.Attributes,
+		GroupID:         msg.GroupID,
+		DeduplicationID: msg.DeduplicationID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal scheduled message: %w", err)
+	}
+	due := time.Now().Add(msg.Delay)
+	if err := s.client.ZAdd(ctx, schedulerKey, redis.Z{Score: float64(due.UnixMilli()), Member: member}).Err(); err != nil {
+		return fmt.Errorf("failed to schedule message: %w", err)
+	}
+	return nil
+}
+
+func (s *Scheduler) maxDelay(queue string) time.Duration {
+	if l, ok := s.Queue.(delayLimiter); ok {
+		return l.maxDelay(queue)
+	}
+	return 0
+}
+
+// claimDue returns due messages and pushes them back by the lease, so other
+// API instances skip them while this one sends
+var claimDue = redis.NewScript(`
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[3])
+for _, member in ipairs(due) do
+	redis.call('ZADD', KEYS[1], ARGV[2], member)
+end
+return due
+`)
+
+// Run sends held messages as they become due until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(schedulerPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		for {
+			sent, err := s.sendDue(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					s.logger.Error("Failed to send scheduled messages", zap.Error(err))
+				}
+				break
+			}
+			if sent < schedulerBatchSize {
+				break
+			}
+		}
+	}
+}
+
+// sendDue sends up to schedulerBatchSize due messages, batched per queue,
+// and returns how many it claimed. Messages that fail to send are retried
+// when their lease ends.
+func (s *Scheduler) sendDue(ctx context.Context) (int, error) {
+	now := time.Now()
+	members, err := claimDue.Run(ctx, s.client, []string{schedulerKey},
+		strconv.FormatInt(now.UnixMilli(), 10),
+		strconv.FormatInt(now.Add(schedulerLease).UnixMilli(), 10),
+		schedulerBatchSize,
+	).StringSlice()
+	if err != nil {
+		return 0, err
+	}
+
+	// Send each queue's due messages as one batch
+	batches := make(map[string][]scheduledMessage)
+	var queues []string
+	for _, member := range members {
+		m := scheduledMessage{member: member}
+		if err := json.Unmarshal([]byte(member), &m); err != nil {
+			s.logger.Error("Dropping malformed scheduled message", zap.Error(err))
+			s.client.ZRem(ctx, schedulerKey, member)
+			continue
+		}
+		if _, ok := batches[m.Queue]; !ok {
+			queues = append(queues, m.Queue)
+		}
+		batches[m.Queue] = append(batches[m.Queue], m)
+	}
+
+	for _, queue := range queues {
+		scheduled := batches[queue]
+		msgs := make([]Message, len(scheduled))
+		for i, m := range scheduled {
+			msgs[i] = Message{
+				Body:            m.Body,
+				Attributes:      m.Attributes,
+				GroupID:         m.GroupID,
+				DeduplicationID: m.DeduplicationID,
+			}
+		}
+
+		var sent []any
+		for i, err := range s.Queue.SendBatch(ctx, queue, msgs) {
+			if err != nil {
+				s.logger.Warn("Failed to send scheduled message",
+					zap.String("id", scheduled[i].ID),
+					zap.String("queue", queue),
+					zap.Error(err),
+				)
+				continue
+			}
+			sent = append(sent, scheduled[i].member)
+		}
+		if len(sent) == 0 {
+			continue
+		}
+		if err := s.client.ZRem(ctx, schedulerKey, sent...).Err(); err != nil {
+			s.logger.Warn("Failed to remove sent scheduled messages", zap.String("queue", queue), zap.Error(err))
+		}
+	}
+	return len(members), nil
+}
@@ -2,28 +2,30 @@ package queue
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"github.com/glassbox/api/internal/config"
-	"github.com/google/uuid"
+	"github.com/glassbox/api/internal/telemetry"
 	"go.uber.org/zap"
 )
 
-// SQSClient wraps the AWS SQS client with helper methods
-type SQSClient struct {
-	client           *sqs.Client
-	agentQueueURL    string
-	fileQueueURL     string
-	logger           *zap.Logger
+// sqsQueue sends to and receives from SQS queues
+type sqsQueue struct {
+	client  *sqs.Client
+	urls    map[string]string
+	dlqURLs map[string]string
+	logger  *zap.Logger
 }
 
-// NewSQSClient creates a new SQS client configured for the environment
-func NewSQSClient(cfg *config.Config, logger *zap.Logger) (*SQSClient, error) {
+// newSQSQueue creates an SQS backend configured for the environment
+func newSQSQueue(cfg *config.Config, logger *zap.Logger) (*sqsQueue, error) {
 	ctx := context.Background()
 
 	// Load AWS config
@@ -33,6 +35,7 @@ func NewSQSClient(cfg *config.Config, logger *zap.Logger) (*SQSClient, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	telemetry.InstrumentAWS(&awsCfg)
 
 	// Create SQS client with LocalStack endpoint for development
 	var client *sqs.Client
@@ -45,120 +48,421 @@ func NewSQSClient(cfg *config.Config, logger *zap.Logger) (*SQSClient, error) {
 		client = sqs.NewFromConfig(awsCfg)
 	}
 
-	return &SQSClient{
-		client:        client,
-		agentQueueURL: cfg.SQSAgentQueueURL,
-		fileQueueURL:  cfg.SQSFileQueueURL,
-		logger:        logger,
+	// Batch agent jobs share the agent queue unless they have their own
+	batchURL, batchDLQURL := cfg.SQSAgentBatchQueueURL, cfg.SQSAgentBatchDLQURL
+	if batchURL == "" {
+		batchURL, batchDLQURL = cfg.SQSAgentQueueURL, cfg.SQSAgentDLQURL
+	}
+
+	return &sqsQueue{
+		client: client,
+		urls: map[string]string{
+			AgentJobs:      cfg.SQSAgentQueueURL,
+			AgentBatchJobs: batchURL,
+			FileJobs:       cfg.SQSFileQueueURL,
+		},
+		dlqURLs: map[string]string{
+			AgentJobs:      cfg.SQSAgentDLQURL,
+			AgentBatchJobs: batchDLQURL,
+			FileJobs:       cfg.SQSFileDLQURL,
+		},
+		logger: logger,
 	}, nil
 }
 
-// FileProcessingJob represents a job to process a file
-type FileProcessingJob struct {
-	FileID      uuid.UUID  `json:"fileId"`
-	OrgID       uuid.UUID  `json:"orgId"`
-	StorageKey  string     `json:"storageKey"`
-	Filename    string     `json:"filename"`
-	ContentType string     `json:"contentType"`
-	UploadedBy  *uuid.UUID `json:"uploadedBy,omitempty"`
-}
-
-// DispatchFileProcessingJob sends a file processing job to the queue
-// Accepts any struct that marshals to the expected format (for interface compatibility)
-func (s *SQSClient) DispatchFileProcessingJob(ctx context.Context, job any) error {
-	// Convert to our internal type if needed
-	var fpJob FileProcessingJob
-	switch v := job.(type) {
-	case FileProcessingJob:
-		fpJob = v
-	default:
-		// Marshal and unmarshal to convert from services.FileProcessingJobMessage
-		data, err := json.Marshal(job)
+func (q *sqsQueue) url(queue string) (string, error) {
+	url, ok := q.urls[queue]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownQueue, queue)
+	}
+	return url, nil
+}
+
+func (q *sqsQueue) Send(ctx context.Context, queue string, msg Message) error {
+	url, err := q.url(queue)
+	if err != nil {
+		return err
+	}
+
+	entry := sqsEntry(url, "", msg)
+	_, err = q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:               aws.String(url),
+		MessageBody:            entry.MessageBody,
+		MessageAttributes:      entry.MessageAttributes,
+		MessageGroupId:         entry.MessageGroupId,
+		MessageDeduplicationId: entry.MessageDeduplicationId,
+		DelaySeconds:           entry.DelaySeconds,
+	})
+	return err
+}
+
+// SQS batch limits: entries per SendMessageBatch and their total size
+const (
+	sqsMaxBatchEntries = 10
+	sqsMaxBatchBytes   = 256 << 10
+)
+
+// SendBatch sends msgs with SendMessageBatch, splitting them into batches
+// within SQS's limits
+func (q *sqsQueue) SendBatch(ctx context.Context, queue string, msgs []Message) []error {
+	errs := make([]error, len(msgs))
+	url, err := q.url(queue)
+	if err != nil {
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	for start := 0; start < len(msgs); {
+		// Entry IDs are indexes into msgs
+		var entries []types.SendMessageBatchRequestEntry
+		size := 0
+		end := start
+		for end < len(msgs) && len(entries) < sqsMaxBatchEntries {
+			entry := sqsEntry(url, strconv.Itoa(end), msgs[end])
+			entrySize := sqsEntrySize(entry)
+			if len(entries) > 0 && size+entrySize > sqsMaxBatchBytes {
+				break
+			}
+			entries = append(entries, entry)
+			size += entrySize
+			end++
+		}
+
+		out, err := q.client.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+			QueueUrl: aws.String(url),
+			Entries:  entries,
+		})
 		if err != nil {
-			return fmt.Errorf("failed to marshal job: %w", err)
+			for i := start; i < end; i++ {
+				errs[i] = err
+			}
+		} else {
+			for _, failed := range out.Failed {
+				i, _ := strconv.Atoi(aws.ToString(failed.Id))
+				errs[i] = fmt.Errorf("%s: %s", aws.ToString(failed.Code), aws.ToString(failed.Message))
+			}
+		}
+		start = end
+	}
+	return errs
+}
+
+// sqsEntry converts a message for queue url. FIFO queues get a message group
+// and take no per-message delay.
+func sqsEntry(url, id string, msg Message) types.SendMessageBatchRequestEntry {
+	attributes := make(map[string]types.MessageAttributeValue, len(msg.Attributes))
+	for name, value := range msg.Attributes {
+		attributes[name] = types.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(value),
+		}
+	}
+
+	entry := types.SendMessageBatchRequestEntry{
+		Id:                aws.String(id),
+		MessageBody:       aws.String(string(msg.Body)),
+		MessageAttributes: attributes,
+	}
+	if isFIFO(url) {
+		group := msg.GroupID
+		if group == "" {
+			group = sqsDefaultMessageGroup
 		}
-		if err := json.Unmarshal(data, &fpJob); err != nil {
-			return fmt.Errorf("failed to unmarshal job: %w", err)
+		entry.MessageGroupId = aws.String(group)
+		if msg.DeduplicationID != "" {
+			entry.MessageDeduplicationId = aws.String(msg.DeduplicationID)
 		}
+	} else if msg.Delay > 0 {
+		entry.DelaySeconds = int32(min(msg.Delay, sqsMaxDelay).Round(time.Second) / time.Second)
+	}
+	return entry
+}
+
+// sqsEntrySize is an entry's size as SQS counts it: body plus attribute
+// names, types and values
+func sqsEntrySize(entry types.SendMessageBatchRequestEntry) int {
+	size := len(aws.ToString(entry.MessageBody))
+	for name, value := range entry.MessageAttributes {
+		size += len(name) + len(aws.ToString(value.DataType)) + len(aws.ToString(value.StringValue))
+	}
+	return size
+}
+
+// sqsDefaultMessageGroup groups FIFO messages sent without a GroupID
+const sqsDefaultMessageGroup = "default"
+
+// maxDelay is SQS's DelaySeconds limit. FIFO queues only support a
+// queue-wide delay.
+func (q *sqsQueue) maxDelay(queue string) time.Duration {
+	if isFIFO(q.urls[queue]) {
+		return 0
 	}
+	return sqsMaxDelay
+}
 
-	body, err := json.Marshal(fpJob)
+// isFIFO reports a FIFO queue, whose name must end in .fifo
+func isFIFO(url string) bool {
+	return strings.HasSuffix(url, ".fifo")
+}
+
+func (q *sqsQueue) Receive(ctx context.Context, queue string, opts ReceiveOptions) ([]Delivery, error) {
+	url, err := q.url(queue)
 	if err != nil {
-		return fmt.Errorf("failed to marshal job: %w", err)
+		return nil, err
 	}
 
-	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(s.fileQueueURL),
-		MessageBody: aws.String(string(body)),
-		MessageAttributes: map[string]types.MessageAttributeValue{
-			"JobType": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String("file_processing"),
-			},
-		},
+	input := &sqs.ReceiveMessageInput{
+		QueueUrl:                    aws.String(url),
+		MaxNumberOfMessages:         int32(min(opts.max(), 10)),
+		WaitTimeSeconds:             int32(min(opts.Wait/time.Second, 20)),
+		MessageAttributeNames:       []string{"All"},
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{types.MessageSystemAttributeNameApproximateReceiveCount},
+	}
+	if opts.VisibilityTimeout > 0 {
+		input.VisibilityTimeout = int32(opts.VisibilityTimeout / time.Second)
+	}
+
+	out, err := q.client.ReceiveMessage(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]Delivery, 0, len(out.Messages))
+	for _, m := range out.Messages {
+		d := Delivery{
+			ID:         aws.ToString(m.ReceiptHandle),
+			Body:       []byte(aws.ToString(m.Body)),
+			Attributes: make(map[string]string, len(m.MessageAttributes)),
+		}
+		for name, value := range m.MessageAttributes {
+			d.Attributes[name] = aws.ToString(value.StringValue)
+		}
+		d.ReceiveCount, _ = strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, nil
+}
+
+func (q *sqsQueue) Ack(ctx context.Context, queue string, d Delivery) error {
+	url, err := q.url(queue)
+	if err != nil {
+		return err
+	}
+	_, err = q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(url),
+		ReceiptHandle: aws.String(d.ID),
 	})
+	return err
+}
+
+// SQS can't read a message by ID, so dead letters are found by receiving
+// from the dead-letter queue. Received messages are hidden while a scan
+// runs and made visible again when it ends, unless redriven or discarded.
+const (
+	sqsDeadLetterScanReceives   = 20
+	sqsDeadLetterScanVisibility = 30 // seconds
+)
+
+func (q *sqsQueue) deadLetterURL(queue string) (string, error) {
+	url, ok := q.dlqURLs[queue]
+	if !ok || url == "" {
+		return "", fmt.Errorf("%w: %s", ErrUnknownQueue, queue)
+	}
+	return url, nil
+}
+
+// scanDeadLetters receives dead letters until done reports true or the
+// queue is exhausted. visit reports whether it deleted the message; the
+// others are released when the scan ends.
+func (q *sqsQueue) scanDeadLetters(ctx context.Context, queue string, visit func(m types.Message) (bool, error), done func() bool) error {
+	url, err := q.deadLetterURL(queue)
 	if err != nil {
-		return fmt.Errorf("failed to send file processing job: %w", err)
+		return err
 	}
 
-	s.logger.Info("Dispatched file processing job",
-		zap.String("fileId", fpJob.FileID.String()),
-		zap.String("filename", fpJob.Filename),
-	)
+	var release []types.Message
+	defer func() { q.releaseDeadLetters(ctx, url, release) }()
 
+	for i := 0; i < sqsDeadLetterScanReceives && !done(); i++ {
+		out, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(url),
+			MaxNumberOfMessages:   10,
+			WaitTimeSeconds:       1,
+			VisibilityTimeout:     sqsDeadLetterScanVisibility,
+			MessageAttributeNames: []string{"All"},
+			MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+				types.MessageSystemAttributeNameApproximateReceiveCount,
+				types.MessageSystemAttributeNameSentTimestamp,
+				types.MessageSystemAttributeNameMessageGroupId,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		if len(out.Messages) == 0 {
+			return nil
+		}
+		for _, m := range out.Messages {
+			deleted, err := visit(m)
+			if !deleted {
+				release = append(release, m)
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
 	return nil
 }
 
-// AgentJob represents a job for the agent worker
-type AgentJob struct {
-	ExecutionID uuid.UUID      `json:"executionId"`
-	NodeID      uuid.UUID      `json:"nodeId"`
-	OrgID       uuid.UUID      `json:"orgId"`
-	OrgConfig   map[string]any `json:"orgConfig,omitempty"`
-}
-
-// DispatchAgentJob sends an agent job to the queue
-// Accepts any struct that marshals to the expected format (for interface compatibility)
-func (s *SQSClient) DispatchAgentJob(ctx context.Context, job any) error {
-	// Convert to our internal type if needed
-	var agentJob AgentJob
-	switch v := job.(type) {
-	case AgentJob:
-		agentJob = v
-	default:
-		// Marshal and unmarshal to convert from services.AgentJobMessage
-		data, err := json.Marshal(job)
-		if err != nil {
-			return fmt.Errorf("failed to marshal job: %w", err)
+// releaseDeadLetters makes scanned messages visible again
+func (q *sqsQueue) releaseDeadLetters(ctx context.Context, url string, messages []types.Message) {
+	for start := 0; start < len(messages); start += 10 {
+		batch := messages[start:min(start+10, len(messages))]
+		entries := make([]types.ChangeMessageVisibilityBatchRequestEntry, len(batch))
+		for i, m := range batch {
+			entries[i] = types.ChangeMessageVisibilityBatchRequestEntry{
+				Id:                aws.String(strconv.Itoa(i)),
+				ReceiptHandle:     m.ReceiptHandle,
+				VisibilityTimeout: 0,
+			}
 		}
-		if err := json.Unmarshal(data, &agentJob); err != nil {
-			return fmt.Errorf("failed to unmarshal job: %w", err)
+		_, err := q.client.ChangeMessageVisibilityBatch(ctx, &sqs.ChangeMessageVisibilityBatchInput{
+			QueueUrl: aws.String(url),
+			Entries:  entries,
+		})
+		if err != nil {
+			q.logger.Warn("Failed to release dead letters; they reappear after the visibility timeout", zap.Error(err))
 		}
 	}
+}
 
-	body, err := json.Marshal(agentJob)
+func (q *sqsQueue) deleteDeadLetter(ctx context.Context, queue string, m types.Message) error {
+	url, err := q.deadLetterURL(queue)
 	if err != nil {
-		return fmt.Errorf("failed to marshal job: %w", err)
+		return err
 	}
-
-	_, err = s.client.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(s.agentQueueURL),
-		MessageBody: aws.String(string(body)),
-		MessageAttributes: map[string]types.MessageAttributeValue{
-			"JobType": {
-				DataType:    aws.String("String"),
-				StringValue: aws.String("agent_execution"),
-			},
-		},
+	_, err = q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(url),
+		ReceiptHandle: m.ReceiptHandle,
 	})
+	return err
+}
+
+func (q *sqsQueue) ListDeadLetters(ctx context.Context, queue string, max int) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	err := q.scanDeadLetters(ctx, queue, func(m types.Message) (bool, error) {
+		if len(letters) < max {
+			letters = append(letters, sqsDeadLetter(queue, m))
+		}
+		return false, nil
+	}, func() bool { return len(letters) >= max })
+	return letters, err
+}
+
+func (q *sqsQueue) GetDeadLetter(ctx context.Context, queue, id string) (*DeadLetter, error) {
+	var letter *DeadLetter
+	err := q.scanDeadLetters(ctx, queue, func(m types.Message) (bool, error) {
+		if aws.ToString(m.MessageId) == id {
+			l := sqsDeadLetter(queue, m)
+			letter = &l
+		}
+		return false, nil
+	}, func() bool { return letter != nil })
 	if err != nil {
-		return fmt.Errorf("failed to send agent job: %w", err)
+		return nil, err
 	}
+	if letter == nil {
+		return nil, ErrDeadLetterNotFound
+	}
+	return letter, nil
+}
 
-	s.logger.Info("Dispatched agent job",
-		zap.String("executionId", agentJob.ExecutionID.String()),
-		zap.String("nodeId", agentJob.NodeID.String()),
-	)
+func (q *sqsQueue) RedriveDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	wanted := idSet(ids)
+	redriven := 0
+	err := q.scanDeadLetters(ctx, queue, func(m types.Message) (bool, error) {
+		if !wanted[aws.ToString(m.MessageId)] {
+			return false, nil
+		}
+		// On FIFO queues the redriven copy keeps its group and must not be
+		// deduplicated against the original
+		letter := sqsDeadLetter(queue, m)
+		err := q.Send(ctx, queue, Message{
+			Body:            []byte(aws.ToString(m.Body)),
+			Attributes:      letter.Attributes,
+			GroupID:         m.Attributes[string(types.MessageSystemAttributeNameMessageGroupId)],
+			DeduplicationID: "redrive-" + letter.ID,
+		})
+		if err != nil {
+			return false, err
+		}
+		if err := q.deleteDeadLetter(ctx, queue, m); err != nil {
+			// Already sent: the copy left behind reappears after the scan
+			return false, err
+		}
+		delete(wanted, aws.ToString(m.MessageId))
+		redriven++
+		return true, nil
+	}, func() bool { return len(wanted) == 0 })
+	return redriven, err
+}
 
-	return nil
+func (q *sqsQueue) DiscardDeadLetters(ctx context.Context, queue string, ids []string) (int, error) {
+	wanted := idSet(ids)
+	discarded := 0
+	err := q.scanDeadLetters(ctx, queue, func(m types.Message) (bool, error) {
+		if !wanted[aws.ToString(m.MessageId)] {
+			return false, nil
+		}
+		if err := q.deleteDeadLetter(ctx, queue, m); err != nil {
+			return false, err
+		}
+		delete(wanted, aws.ToString(m.MessageId))
+		discarded++
+		return true, nil
+	}, func() bool { return len(wanted) == 0 })
+	return discarded, err
+}
+
+func sqsDeadLetter(queue string, m types.Message) DeadLetter {
+	letter := DeadLetter{
+		ID:         aws.ToString(m.MessageId),
+		Queue:      queue,
+		Body:       deadLetterBody([]byte(aws.ToString(m.Body))),
+		Attributes: make(map[string]string, len(m.MessageAttributes)),
+	}
+	for name, value := range m.MessageAttributes {
+		letter.Attributes[name] = aws.ToString(value.StringValue)
+	}
+	letter.ReceiveCount, _ = strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+	if millis, err := strconv.ParseInt(m.Attributes[string(types.MessageSystemAttributeNameSentTimestamp)], 10, 64); err == nil {
+		sentAt := time.UnixMilli(millis)
+		letter.SentAt = &sentAt
+	}
+	return letter
+}
+
+// QueueStats reads the queue's approximate counts. SQS doesn't report the
+// oldest message's age outside CloudWatch.
+func (q *sqsQueue) QueueStats(ctx context.Context, queue string) (Stats, error) {
+	url, err := q.url(queue)
+	if err != nil {
+		return Stats{}, err
+	}
+	out, err := q.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl: aws.String(url),
+		AttributeNames: []types.QueueAttributeName{
+			types.QueueAttributeNameApproximateNumberOfMessages,
+			types.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+		},
+	})
+	if err != nil {
+		return Stats{}, err
+	}
+	depth, _ := strconv.ParseInt(out.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)], 10, 64)
+	inFlight, _ := strconv.ParseInt(out.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessagesNotVisible)], 10, 64)
+	return Stats{Depth: depth, InFlight: inFlight}, nil
 }
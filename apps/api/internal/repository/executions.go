@@ -0,0 +1,203 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgExecutionRepo struct {
+	db *database.DB
+}
+
+// NewExecutionRepo returns the Postgres ExecutionRepo
+func NewExecutionRepo(db *database.DB) ExecutionRepo {
+	return &pgExecutionRepo{db: db}
+}
+
+func (r *pgExecutionRepo) Get(ctx context.Context, executionID, userID uuid.UUID) (*Execution, error) {
+	exec, err := scanExecution(r.db.Pool.QueryRow(ctx, `
+		SELECT e.id, e.node_id, e.status, e.priority, e.langgraph_thread_id, e.trace_summary,
+		       e.langgraph_checkpoint, e.started_at, e.completed_at, e.error_message,
+		       e.total_tokens_in, e.total_tokens_out, e.estimated_cost_usd, e.model_id, e.created_at,
+		       n.org_id
+		FROM agent_executions e
+		JOIN nodes n ON e.node_id = n.id
+		JOIN org_members om ON n.org_id = om.org_id
+		WHERE e.id = $1 AND om.user_id = $2
+	`, executionID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get execution: %w", err)
+	}
+	return exec, nil
+}
+
+func (r *pgExecutionRepo) Active(ctx context.Context, nodeID uuid.UUID) (*Execution, error) {
+	exec, err := scanExecution(r.db.Pool.QueryRow(ctx, `
+		SELECT e.id, e.node_id, e.status, e.priority, e.langgraph_thread_id, e.trace_summary,
+		       e.langgraph_checkpoint, e.started_at, e.completed_at, e.error_message,
+		       e.total_tokens_in, e.total_tokens_out, e.estimated_cost_usd, e.model_id, e.created_at,
+		       n.org_id
+		FROM agent_executions e
+		JOIN nodes n ON e.node_id = n.id
+		WHERE e.node_id = $1 AND e.status = ANY($2)
+		ORDER BY e.created_at DESC
+		LIMIT 1
+	`, nodeID, ActiveStatuses))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current execution: %w", err)
+	}
+	return exec, nil
+}
+
+func (r *pgExecutionRepo) ListByNodes(ctx context.Context, nodeIDs []uuid.UUID, limit int) ([]Execution, error) {
+	// Checkpoints can be large and nothing listing executions reads them
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT e.id, e.node_id, e.status, e.priority, e.langgraph_thread_id, e.trace_summary,
+		       NULL::JSONB, e.started_at, e.completed_at, e.error_message,
+		       e.total_tokens_in, e.total_tokens_out, e.estimated_cost_usd, e.model_id, e.created_at,
+		       n.org_id
+		FROM nodes n
+		CROSS JOIN LATERAL (
+			SELECT * FROM agent_executions
+			WHERE node_id = n.id
+			ORDER BY created_at DESC, id DESC
+			LIMIT $2
+		) e
+		WHERE n.id = ANY($1)
+	`, nodeIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list executions: %w", err)
+	}
+	defer rows.Close()
+
+	var execs []Execution
+	for rows.Next() {
+		exec, err := scanExecution(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan execution: %w", err)
+		}
+		execs = append(execs, *exec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list executions: %w", err)
+	}
+	return execs, nil
+}
+
+func (r *pgExecutionRepo) Pause(ctx context.Context, executionID uuid.UUID) (bool, error) {
+	// The worker checkpoints on its next iteration
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE agent_executions SET status = 'paused'
+		WHERE id = $1 AND status = 'running'
+	`, executionID)
+	if err != nil {
+		return false, fmt.Errorf("failed to pause execution: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (r *pgExecutionRepo) Cancel(ctx context.Context, executionID uuid.UUID) (bool, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE agent_executions SET status = 'cancelled', completed_at = NOW()
+		WHERE id = $1 AND status = ANY($2)
+	`, executionID, ActiveStatuses)
+	if err != nil {
+		return false, fmt.Errorf("failed to cancel execution: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (r *pgExecutionRepo) ListTrace(ctx context.Context, executionID uuid.UUID, since time.Time, page pagination.Params) (*pagination.Page[models.TraceEvent], error) {
+	afterSequence, _, err := page.AfterInt()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT id, execution_id, event_type, event_data, timestamp, duration_ms,
+		       model, tokens_in, tokens_out, sequence_number
+		FROM agent_trace_events
+		WHERE execution_id = $1 AND timestamp >= $4
+		  AND ($2::INT IS NULL OR sequence_number > $2)
+		ORDER BY sequence_number ASC
+		LIMIT $3
+	`, executionID, afterSequence, limit+1, since)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get trace events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.TraceEvent
+	for rows.Next() {
+		var event models.TraceEvent
+		var eventDataJSON []byte
+
+		if err := rows.Scan(
+			&event.ID, &event.ExecutionID, &event.EventType, &eventDataJSON,
+			&event.Timestamp, &event.DurationMs, &event.Model, &event.TokensIn,
+			&event.TokensOut, &event.SequenceNumber,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan trace event: %w", err)
+		}
+
+		if eventDataJSON != nil {
+			json.Unmarshal(eventDataJSON, &event.EventData)
+		}
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get trace events: %w", err)
+	}
+
+	result := pagination.NewPage(events, limit, traceCursor)
+	err = r.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM agent_trace_events WHERE execution_id = $1 AND timestamp >= $2
+	`, executionID, since).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count trace events: %w", err)
+	}
+	return result, nil
+}
+
+// scanExecution scans an execution's columns followed by its node's org_id
+func scanExecution(row pgx.Row) (*Execution, error) {
+	var exec Execution
+	var traceSummaryJSON []byte
+
+	err := row.Scan(
+		&exec.ID, &exec.NodeID, &exec.Status, &exec.Priority, &exec.LanggraphThreadID, &traceSummaryJSON,
+		&exec.Checkpoint, &exec.StartedAt, &exec.CompletedAt, &exec.ErrorMessage,
+		&exec.TotalTokensIn, &exec.TotalTokensOut, &exec.EstimatedCostUSD, &exec.ModelID, &exec.CreatedAt,
+		&exec.OrgID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if traceSummaryJSON != nil {
+		json.Unmarshal(traceSummaryJSON, &exec.TraceSummary)
+	}
+	return &exec, nil
+}
+
+// traceCursor is the cursor of a trace event. Sequence numbers are unique
+// per execution.
+func traceCursor(e models.TraceEvent) pagination.Cursor {
+	return pagination.IntCursor(e.SequenceNumber, e.ID)
+}
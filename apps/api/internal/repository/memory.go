@@ -0,0 +1,654 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// Memory is an in-memory database behind fake repos, for exercising
+// services without Postgres. Seed it through its maps before handing out
+// repos; the repos lock mu, so seed under it once they're in use.
+type Memory struct {
+	mu sync.Mutex
+
+	Orgs       map[uuid.UUID]models.Organization
+	Members    map[uuid.UUID]map[uuid.UUID]string // org ID -> user ID -> role
+	Projects   map[uuid.UUID]models.Project
+	Nodes      map[uuid.UUID]models.Node
+	Versions   map[uuid.UUID][]models.NodeVersion // by node ID
+	Inputs     map[uuid.UUID][]models.NodeInput   // by node ID
+	Outputs    map[uuid.UUID][]models.NodeOutput  // by node ID
+	Executions map[uuid.UUID]Execution
+	Trace      map[uuid.UUID][]models.TraceEvent // by execution ID
+}
+
+// NewMemory returns an empty Memory
+func NewMemory() *Memory {
+	return &Memory{
+		Orgs:       map[uuid.UUID]models.Organization{},
+		Members:    map[uuid.UUID]map[uuid.UUID]string{},
+		Projects:   map[uuid.UUID]models.Project{},
+		Nodes:      map[uuid.UUID]models.Node{},
+		Versions:   map[uuid.UUID][]models.NodeVersion{},
+		Inputs:     map[uuid.UUID][]models.NodeInput{},
+		Outputs:    map[uuid.UUID][]models.NodeOutput{},
+		Executions: map[uuid.UUID]Execution{},
+		Trace:      map[uuid.UUID][]models.TraceEvent{},
+	}
+}
+
+// Lock locks m for seeding while its repos are in use
+func (m *Memory) Lock() { m.mu.Lock() }
+
+// Unlock undoes Lock
+func (m *Memory) Unlock() { m.mu.Unlock() }
+
+// OrgRepo returns an OrgRepo backed by m
+func (m *Memory) OrgRepo() OrgRepo { return memoryOrgs{m} }
+
+// ProjectRepo returns a ProjectRepo backed by m
+func (m *Memory) ProjectRepo() ProjectRepo { return memoryProjects{m} }
+
+// NodeRepo returns a NodeRepo backed by m
+func (m *Memory) NodeRepo() NodeRepo { return memoryNodes{m} }
+
+// ExecutionRepo returns an ExecutionRepo backed by m
+func (m *Memory) ExecutionRepo() ExecutionRepo { return memoryExecutions{m} }
+
+func (m *Memory) isMember(orgID, userID uuid.UUID) bool {
+	_, ok := m.Members[orgID][userID]
+	return ok
+}
+
+// liveFor reports whether a node exists, isn't deleted and userID can
+// access it
+func (m *Memory) liveFor(nodeID, userID uuid.UUID) bool {
+	node, ok := m.Nodes[nodeID]
+	return ok && node.DeletedAt == nil && m.isMember(node.OrgID, userID)
+}
+
+// touch sets a node's updated_at to now
+func (m *Memory) touch(nodeID uuid.UUID) {
+	if node, ok := m.Nodes[nodeID]; ok {
+		node.UpdatedAt = time.Now()
+		m.Nodes[nodeID] = node
+	}
+}
+
+// memoryPage sorts items, drops those up to the cursor and returns a page.
+// compare orders items; position orders an item against the cursor, and
+// parse reads the cursor into what position compares with.
+func memoryPage[T, K any](items []T, page pagination.Params, parse func(pagination.Params) (*K, *uuid.UUID, error),
+	compare func(a, b T) int, position func(item T, key K, id uuid.UUID) int, cursorOf func(T) pagination.Cursor) (*pagination.Page[T], error) {
+	key, id, err := parse(page)
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	slices.SortFunc(items, compare)
+	var after []T
+	for _, item := range items {
+		if key != nil && position(item, *key, *id) <= 0 {
+			continue
+		}
+		after = append(after, item)
+		if len(after) > limit {
+			break
+		}
+	}
+
+	result := pagination.NewPage(after, limit, cursorOf)
+	result.Total = len(items)
+	return result, nil
+}
+
+func compareIDs(a, b uuid.UUID) int {
+	return bytes.Compare(a[:], b[:])
+}
+
+func compareNodesByCreation(a, b models.Node) int {
+	if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return compareIDs(a.ID, b.ID)
+}
+
+func nodeAfter(n models.Node, t time.Time, id uuid.UUID) int {
+	if c := n.CreatedAt.Compare(t); c != 0 {
+		return c
+	}
+	return compareIDs(n.ID, id)
+}
+
+type memoryOrgs struct{ m *Memory }
+
+func (r memoryOrgs) ListForMember(ctx context.Context, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Organization], error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var orgs []models.Organization
+	for id, org := range r.m.Orgs {
+		if r.m.isMember(id, userID) {
+			orgs = append(orgs, org)
+		}
+	}
+	return memoryPage(orgs, page, pagination.Params.AfterString,
+		func(a, b models.Organization) int {
+			if c := strings.Compare(a.Name, b.Name); c != 0 {
+				return c
+			}
+			return compareIDs(a.ID, b.ID)
+		},
+		func(o models.Organization, name string, id uuid.UUID) int {
+			if c := strings.Compare(o.Name, name); c != 0 {
+				return c
+			}
+			return compareIDs(o.ID, id)
+		},
+		orgCursor)
+}
+
+func (r memoryOrgs) GetForMember(ctx context.Context, orgID, userID uuid.UUID) (*models.Organization, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	org, ok := r.m.Orgs[orgID]
+	if !ok || !r.m.isMember(orgID, userID) {
+		return nil, ErrNotFound
+	}
+	return &org, nil
+}
+
+func (r memoryOrgs) MemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	role, ok := r.m.Members[orgID][userID]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return role, nil
+}
+
+func (r memoryOrgs) AllowsOrigin(ctx context.Context, userID uuid.UUID, origin string) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	origin = strings.TrimRight(origin, "/")
+	for id, org := range r.m.Orgs {
+		if !r.m.isMember(id, userID) {
+			continue
+		}
+		for _, allowed := range org.Settings.AllowedOrigins {
+			if strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func (r memoryOrgs) Delete(ctx context.Context, orgID uuid.UUID) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.Orgs[orgID]; !ok {
+		return ErrNotFound
+	}
+	delete(r.m.Orgs, orgID)
+	delete(r.m.Members, orgID)
+	for id, project := range r.m.Projects {
+		if project.OrgID == orgID {
+			delete(r.m.Projects, id)
+		}
+	}
+	for id, node := range r.m.Nodes {
+		if node.OrgID == orgID {
+			delete(r.m.Nodes, id)
+			delete(r.m.Versions, id)
+			delete(r.m.Inputs, id)
+			delete(r.m.Outputs, id)
+		}
+	}
+	for id, exec := range r.m.Executions {
+		if exec.OrgID == orgID {
+			delete(r.m.Executions, id)
+			delete(r.m.Trace, id)
+		}
+	}
+	return nil
+}
+
+type memoryProjects struct{ m *Memory }
+
+func (r memoryProjects) ListByOrg(ctx context.Context, orgID uuid.UUID, page pagination.Params) (*pagination.Page[models.Project], error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var projects []models.Project
+	for _, p := range r.m.Projects {
+		if p.OrgID == orgID {
+			projects = append(projects, p)
+		}
+	}
+	return memoryPage(projects, page, pagination.Params.AfterString,
+		func(a, b models.Project) int {
+			if c := strings.Compare(a.Name, b.Name); c != 0 {
+				return c
+			}
+			return compareIDs(a.ID, b.ID)
+		},
+		func(p models.Project, name string, id uuid.UUID) int {
+			if c := strings.Compare(p.Name, name); c != 0 {
+				return c
+			}
+			return compareIDs(p.ID, id)
+		},
+		projectCursor)
+}
+
+func (r memoryProjects) GetForMember(ctx context.Context, projectID, userID uuid.UUID) (*models.Project, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	p, ok := r.m.Projects[projectID]
+	if !ok || !r.m.isMember(p.OrgID, userID) {
+		return nil, ErrNotFound
+	}
+	return &p, nil
+}
+
+func (r memoryProjects) ListForMember(ctx context.Context, projectIDs []uuid.UUID, userID uuid.UUID) ([]models.Project, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var projects []models.Project
+	for id, p := range r.m.Projects {
+		if slices.Contains(projectIDs, id) && r.m.isMember(p.OrgID, userID) {
+			projects = append(projects, p)
+		}
+	}
+	return projects, nil
+}
+
+type memoryNodes struct{ m *Memory }
+
+func (r memoryNodes) ProjectOrg(ctx context.Context, projectID, userID uuid.UUID) (uuid.UUID, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	project, ok := r.m.Projects[projectID]
+	if !ok || !r.m.isMember(project.OrgID, userID) {
+		return uuid.Nil, ErrNotFound
+	}
+	return project.OrgID, nil
+}
+
+func (r memoryNodes) Visible(ctx context.Context, nodeID, userID uuid.UUID, includeDeleted bool) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	node, ok := r.m.Nodes[nodeID]
+	return ok && (includeDeleted || node.DeletedAt == nil) && r.m.isMember(node.OrgID, userID), nil
+}
+
+func (r memoryNodes) Get(ctx context.Context, nodeID, userID uuid.UUID) (*models.Node, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	node, ok := r.m.Nodes[nodeID]
+	if !ok || node.DeletedAt != nil || !r.m.isMember(node.OrgID, userID) {
+		return nil, ErrNotFound
+	}
+	node.Inputs, node.Outputs = nil, nil
+	return &node, nil
+}
+
+func (r memoryNodes) ListByProject(ctx context.Context, projectID uuid.UUID, filter NodeFilter, page pagination.Params) (*pagination.Page[models.Node], error) {
+	return r.list(page, true, func(n models.Node) bool {
+		return n.ProjectID == projectID &&
+			(filter.Status == nil || n.Status == *filter.Status) &&
+			(filter.AuthorType == nil || n.AuthorType == *filter.AuthorType) &&
+			(!filter.RootsOnly || n.ParentID == nil) &&
+			(filter.RootsOnly || filter.ParentID == nil || (n.ParentID != nil && *n.ParentID == *filter.ParentID))
+	})
+}
+
+func (r memoryNodes) ListChildren(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error) {
+	return r.list(page, false, func(n models.Node) bool {
+		return n.ParentID != nil && *n.ParentID == nodeID
+	})
+}
+
+func (r memoryNodes) ListDependencies(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error) {
+	r.m.mu.Lock()
+	sources := map[uuid.UUID]bool{}
+	for _, input := range r.m.Inputs[nodeID] {
+		if input.SourceNodeID != nil {
+			sources[*input.SourceNodeID] = true
+		}
+	}
+	r.m.mu.Unlock()
+
+	result, err := r.list(page, false, func(n models.Node) bool { return sources[n.ID] })
+	if err != nil {
+		return nil, err
+	}
+	result.Total = -1
+	return result, nil
+}
+
+// list returns a page of the live nodes that match, oldest first or newest
+// first when newestFirst
+func (r memoryNodes) list(page pagination.Params, newestFirst bool, match func(models.Node) bool) (*pagination.Page[models.Node], error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var nodes []models.Node
+	for _, node := range r.m.Nodes {
+		if node.DeletedAt == nil && match(node) {
+			node.Inputs, node.Outputs = nil, nil
+			nodes = append(nodes, node)
+		}
+	}
+	compare, position := compareNodesByCreation, nodeAfter
+	if newestFirst {
+		compare = func(a, b models.Node) int { return compareNodesByCreation(b, a) }
+		position = func(n models.Node, t time.Time, id uuid.UUID) int { return -nodeAfter(n, t, id) }
+	}
+	return memoryPage(nodes, page, pagination.Params.AfterTime, compare, position, nodeCursor)
+}
+
+func (r memoryNodes) Inputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeInput, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	inputs := slices.Clone(r.m.Inputs[nodeID])
+	slices.SortStableFunc(inputs, func(a, b models.NodeInput) int { return a.SortOrder - b.SortOrder })
+	return inputs, nil
+}
+
+func (r memoryNodes) Outputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeOutput, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	outputs := slices.Clone(r.m.Outputs[nodeID])
+	slices.SortStableFunc(outputs, func(a, b models.NodeOutput) int { return a.SortOrder - b.SortOrder })
+	return outputs, nil
+}
+
+// The node_inputs_touch_node and node_outputs_touch_node triggers bump the
+// node's updated_at on input and output changes; the fakes do the same
+
+func (r memoryNodes) AddInput(ctx context.Context, input *models.NodeInput) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	input.SortOrder = 0
+	for _, existing := range r.m.Inputs[input.NodeID] {
+		input.SortOrder = max(input.SortOrder, existing.SortOrder+1)
+	}
+	input.CreatedAt = time.Now()
+	r.m.Inputs[input.NodeID] = append(r.m.Inputs[input.NodeID], *input)
+	r.m.touch(input.NodeID)
+	return nil
+}
+
+func (r memoryNodes) RemoveInput(ctx context.Context, nodeID, inputID, userID uuid.UUID) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if !r.m.liveFor(nodeID, userID) {
+		return ErrNotFound
+	}
+	i := slices.IndexFunc(r.m.Inputs[nodeID], func(in models.NodeInput) bool { return in.ID == inputID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.m.Inputs[nodeID] = slices.Delete(r.m.Inputs[nodeID], i, i+1)
+	r.m.touch(nodeID)
+	return nil
+}
+
+func (r memoryNodes) AddOutput(ctx context.Context, output *models.NodeOutput) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	output.SortOrder = 0
+	for _, existing := range r.m.Outputs[output.NodeID] {
+		output.SortOrder = max(output.SortOrder, existing.SortOrder+1)
+	}
+	output.CreatedAt = time.Now()
+	r.m.Outputs[output.NodeID] = append(r.m.Outputs[output.NodeID], *output)
+	r.m.touch(output.NodeID)
+	return nil
+}
+
+func (r memoryNodes) RemoveOutput(ctx context.Context, nodeID, outputID, userID uuid.UUID) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if !r.m.liveFor(nodeID, userID) {
+		return ErrNotFound
+	}
+	i := slices.IndexFunc(r.m.Outputs[nodeID], func(out models.NodeOutput) bool { return out.ID == outputID })
+	if i < 0 {
+		return ErrNotFound
+	}
+	r.m.Outputs[nodeID] = slices.Delete(r.m.Outputs[nodeID], i, i+1)
+	r.m.touch(nodeID)
+	return nil
+}
+
+func (r memoryNodes) GetMany(ctx context.Context, nodeIDs []uuid.UUID) ([]models.Node, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var nodes []models.Node
+	for _, id := range nodeIDs {
+		if node, ok := r.m.Nodes[id]; ok && node.DeletedAt == nil {
+			node.Inputs, node.Outputs = nil, nil
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes, nil
+}
+
+func (r memoryNodes) ListByProjects(ctx context.Context, projectIDs []uuid.UUID, filter NodeFilter, limit int) ([]models.Node, error) {
+	var nodes []models.Node
+	for _, projectID := range projectIDs {
+		page, err := r.ListByProject(ctx, projectID, filter, pagination.Params{Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, page.Items...)
+	}
+	return nodes, nil
+}
+
+func (r memoryNodes) ListChildrenOf(ctx context.Context, nodeIDs []uuid.UUID, limit int) ([]models.Node, error) {
+	var children []models.Node
+	for _, nodeID := range nodeIDs {
+		page, err := r.ListChildren(ctx, nodeID, pagination.Params{Limit: limit})
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, page.Items...)
+	}
+	return children, nil
+}
+
+func (r memoryNodes) InputsOf(ctx context.Context, nodeIDs []uuid.UUID) ([]models.NodeInput, error) {
+	var inputs []models.NodeInput
+	for _, nodeID := range nodeIDs {
+		nodeInputs, _ := r.Inputs(ctx, nodeID)
+		inputs = append(inputs, nodeInputs...)
+	}
+	return inputs, nil
+}
+
+func (r memoryNodes) OutputsOf(ctx context.Context, nodeIDs []uuid.UUID) ([]models.NodeOutput, error) {
+	var outputs []models.NodeOutput
+	for _, nodeID := range nodeIDs {
+		nodeOutputs, _ := r.Outputs(ctx, nodeID)
+		outputs = append(outputs, nodeOutputs...)
+	}
+	return outputs, nil
+}
+
+func (r memoryNodes) ListVersions(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.NodeVersion], error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	return memoryPage(slices.Clone(r.m.Versions[nodeID]), page, pagination.Params.AfterInt,
+		func(a, b models.NodeVersion) int { return b.Version - a.Version },
+		func(v models.NodeVersion, version int, _ uuid.UUID) int { return version - v.Version },
+		versionCursor)
+}
+
+func (r memoryNodes) GetVersion(ctx context.Context, nodeID uuid.UUID, version int) (*models.NodeVersion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	for _, v := range r.m.Versions[nodeID] {
+		if v.Version == version {
+			return &v, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r memoryNodes) Lock(ctx context.Context, nodeID, userID uuid.UUID, expiresAt time.Time) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	node, ok := r.m.Nodes[nodeID]
+	now := time.Now()
+	if !ok || node.DeletedAt != nil {
+		return false, nil
+	}
+	if node.LockedBy != nil && *node.LockedBy != userID && node.LockExpiresAt != nil && !node.LockExpiresAt.Before(now) {
+		return false, nil
+	}
+	node.LockedBy, node.LockedAt, node.LockExpiresAt, node.UpdatedAt = &userID, &now, &expiresAt, now
+	r.m.Nodes[nodeID] = node
+	return true, nil
+}
+
+func (r memoryNodes) Unlock(ctx context.Context, nodeID, userID uuid.UUID) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	node, ok := r.m.Nodes[nodeID]
+	if !ok || node.LockedBy == nil || *node.LockedBy != userID {
+		return false, nil
+	}
+	node.LockedBy, node.LockedAt, node.LockExpiresAt, node.UpdatedAt = nil, nil, nil, time.Now()
+	r.m.Nodes[nodeID] = node
+	return true, nil
+}
+
+type memoryExecutions struct{ m *Memory }
+
+func (r memoryExecutions) Get(ctx context.Context, executionID, userID uuid.UUID) (*Execution, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	exec, ok := r.m.Executions[executionID]
+	if !ok || !r.m.isMember(exec.OrgID, userID) {
+		return nil, ErrNotFound
+	}
+	return &exec, nil
+}
+
+func (r memoryExecutions) Active(ctx context.Context, nodeID uuid.UUID) (*Execution, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var newest *Execution
+	for _, exec := range r.m.Executions {
+		if exec.NodeID == nodeID && slices.Contains(ActiveStatuses, exec.Status) &&
+			(newest == nil || exec.CreatedAt.After(newest.CreatedAt)) {
+			newest = &exec
+		}
+	}
+	if newest == nil {
+		return nil, ErrNotFound
+	}
+	return newest, nil
+}
+
+func (r memoryExecutions) ListByNodes(ctx context.Context, nodeIDs []uuid.UUID, limit int) ([]Execution, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var execs []Execution
+	for _, nodeID := range nodeIDs {
+		var nodeExecs []Execution
+		for _, exec := range r.m.Executions {
+			if exec.NodeID == nodeID {
+				exec.Checkpoint = nil
+				nodeExecs = append(nodeExecs, exec)
+			}
+		}
+		slices.SortFunc(nodeExecs, func(a, b Execution) int {
+			if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+				return c
+			}
+			return compareIDs(b.ID, a.ID)
+		})
+		execs = append(execs, nodeExecs[:min(limit, len(nodeExecs))]...)
+	}
+	return execs, nil
+}
+
+func (r memoryExecutions) Pause(ctx context.Context, executionID uuid.UUID) (bool, error) {
+	return r.transition(executionID, []string{"running"}, func(e *Execution) { e.Status = "paused" })
+}
+
+func (r memoryExecutions) Cancel(ctx context.Context, executionID uuid.UUID) (bool, error) {
+	return r.transition(executionID, ActiveStatuses, func(e *Execution) {
+		now := time.Now()
+		e.Status, e.CompletedAt = "cancelled", &now
+	})
+}
+
+// transition applies change to an execution in one of from, returning false
+// if it isn't in one
+func (r memoryExecutions) transition(executionID uuid.UUID, from []string, change func(*Execution)) (bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	exec, ok := r.m.Executions[executionID]
+	if !ok || !slices.Contains(from, exec.Status) {
+		return false, nil
+	}
+	change(&exec)
+	r.m.Executions[executionID] = exec
+	return true, nil
+}
+
+func (r memoryExecutions) ListTrace(ctx context.Context, executionID uuid.UUID, since time.Time, page pagination.Params) (*pagination.Page[models.TraceEvent], error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var events []models.TraceEvent
+	for _, event := range r.m.Trace[executionID] {
+		if !event.Timestamp.Before(since) {
+			events = append(events, event)
+		}
+	}
+	return memoryPage(events, page, pagination.Params.AfterInt,
+		func(a, b models.TraceEvent) int { return a.SequenceNumber - b.SequenceNumber },
+		func(e models.TraceEvent, sequence int, _ uuid.UUID) int { return e.SequenceNumber - sequence },
+		traceCursor)
+}
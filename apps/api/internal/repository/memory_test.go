@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// listing is the item IDs of a list, page by page, and the cursors that
+// led to each page after the first
+type listing struct {
+	IDs     []uuid.UUID
+	Cursors []string
+	Total   int
+}
+
+// listAll pages through a list limit items at a time
+func listAll[T any](t *testing.T, limit int, list func(pagination.Params) (*pagination.Page[T], error), id func(T) uuid.UUID) listing {
+	t.Helper()
+
+	var result listing
+	page := pagination.Params{Limit: limit}
+	for {
+		p, err := list(page)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		result.Total = p.Total
+		if len(p.Items) > limit {
+			t.Fatalf("got %d items, limit %d", len(p.Items), limit)
+		}
+		for _, item := range p.Items {
+			result.IDs = append(result.IDs, id(item))
+		}
+		if !p.HasMore {
+			return result
+		}
+		if len(result.IDs) > 1000 {
+			t.Fatal("pagination did not end")
+		}
+		result.Cursors = append(result.Cursors, p.NextCursor)
+		page.Cursor = p.NextCursor
+	}
+}
+
+func nodeID(n models.Node) uuid.UUID           { return n.ID }
+func orgID(o models.Organization) uuid.UUID    { return o.ID }
+func projectID(p models.Project) uuid.UUID     { return p.ID }
+func versionID(v models.NodeVersion) uuid.UUID { return v.ID }
+
+// sortedIDs returns n new IDs in byte order
+func sortedIDs(n int) []uuid.UUID {
+	ids := make([]uuid.UUID, n)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	slices.SortFunc(ids, compareIDs)
+	return ids
+}
+
+func TestMemoryNodesBreakTimeTiesByID(t *testing.T) {
+	m := NewMemory()
+	projectID := uuid.New()
+	at := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	// ids[0] < ids[1] < ids[2] all created at once, then one a second later
+	ids := sortedIDs(4)
+	for i, id := range ids {
+		created := at
+		if i == 3 {
+			created = at.Add(time.Second)
+		}
+		m.Nodes[id] = models.Node{ID: id, ProjectID: projectID, ParentID: &projectID, CreatedAt: created}
+	}
+
+	nodes := m.NodeRepo()
+	ctx := context.Background()
+	newest := listAll(t, 2, func(p pagination.Params) (*pagination.Page[models.Node], error) {
+		return nodes.ListByProject(ctx, projectID, NodeFilter{}, p)
+	}, nodeID)
+	if want := []uuid.UUID{ids[3], ids[2], ids[1], ids[0]}; !slices.Equal(newest.IDs, want) {
+		t.Fatalf("ListByProject = %v, want %v", newest.IDs, want)
+	}
+	if newest.Total != 4 {
+		t.Fatalf("Total = %d, want 4", newest.Total)
+	}
+
+	// Children are listed oldest first
+	oldest := listAll(t, 3, func(p pagination.Params) (*pagination.Page[models.Node], error) {
+		return nodes.ListChildren(ctx, projectID, p)
+	}, nodeID)
+	if !slices.Equal(oldest.IDs, ids) {
+		t.Fatalf("ListChildren = %v, want %v", oldest.IDs, ids)
+	}
+}
+
+func TestMemoryOrgsByNameThenID(t *testing.T) {
+	m := NewMemory()
+	userID := uuid.New()
+	ids := sortedIDs(3)
+	for i, name := range []string{"beta", "alpha", "alpha"} {
+		m.Orgs[ids[i]] = models.Organization{ID: ids[i], Name: name}
+		m.Members[ids[i]] = map[uuid.UUID]string{userID: "member"}
+	}
+	other := uuid.New()
+	m.Orgs[other] = models.Organization{ID: other, Name: "aardvark"}
+
+	orgs := m.OrgRepo()
+	got := listAll(t, 1, func(p pagination.Params) (*pagination.Page[models.Organization], error) {
+		return orgs.ListForMember(context.Background(), userID, p)
+	}, orgID)
+	if want := []uuid.UUID{ids[1], ids[2], ids[0]}; !slices.Equal(got.IDs, want) {
+		t.Fatalf("ListForMember = %v, want %v", got.IDs, want)
+	}
+}
+
+func TestMemoryProjectsByNameThenID(t *testing.T) {
+	m := NewMemory()
+	orgID, otherOrg := uuid.New(), uuid.New()
+	ids := sortedIDs(3)
+	for i, name := range []string{"beta", "alpha", "alpha"} {
+		m.Projects[ids[i]] = models.Project{ID: ids[i], OrgID: orgID, Name: name}
+	}
+	other := uuid.New()
+	m.Projects[other] = models.Project{ID: other, OrgID: otherOrg, Name: "aardvark"}
+
+	got := listAll(t, 1, func(p pagination.Params) (*pagination.Page[models.Project], error) {
+		return m.ProjectRepo().ListByOrg(context.Background(), orgID, p)
+	}, projectID)
+	if want := []uuid.UUID{ids[1], ids[2], ids[0]}; !slices.Equal(got.IDs, want) || got.Total != 3 {
+		t.Fatalf("ListByOrg = %v (total %d), want %v", got.IDs, got.Total, want)
+	}
+}
+
+func TestMemoryVersionsNewestFirst(t *testing.T) {
+	m := NewMemory()
+	nodeID := uuid.New()
+	var want []uuid.UUID
+	for version := 1; version <= 5; version++ {
+		v := models.NodeVersion{ID: uuid.New(), NodeID: nodeID, Version: version}
+		m.Versions[nodeID] = append(m.Versions[nodeID], v)
+		want = append([]uuid.UUID{v.ID}, want...)
+	}
+
+	got := listAll(t, 2, func(p pagination.Params) (*pagination.Page[models.NodeVersion], error) {
+		return m.NodeRepo().ListVersions(context.Background(), nodeID, p)
+	}, versionID)
+	if !slices.Equal(got.IDs, want) {
+		t.Fatalf("ListVersions = %v, want %v", got.IDs, want)
+	}
+}
+
+func TestMemoryRejectsForeignCursor(t *testing.T) {
+	m := NewMemory()
+	// An org cursor's key isn't a timestamp
+	cursor := pagination.StringCursor("alpha", uuid.New()).Encode()
+	_, err := m.NodeRepo().ListByProject(context.Background(), uuid.New(), NodeFilter{}, pagination.Params{Cursor: cursor})
+	if err != pagination.ErrInvalidCursor {
+		t.Fatalf("err = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -0,0 +1,545 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// nodeColumns are the columns scanNode reads
+const nodeColumns = `id, org_id, project_id, parent_id, title, description, status, author_type,
+		       author_user_id, supervisor_user_id, version, metadata, position,
+		       locked_by, locked_at, lock_expires_at, template_id, template_version,
+		       agent_config, created_at, updated_at, deleted_at`
+
+type pgNodeRepo struct {
+	db *database.DB
+}
+
+// NewNodeRepo returns the Postgres NodeRepo
+func NewNodeRepo(db *database.DB) NodeRepo {
+	return &pgNodeRepo{db: db}
+}
+
+func (r *pgNodeRepo) ProjectOrg(ctx context.Context, projectID, userID uuid.UUID) (uuid.UUID, error) {
+	var orgID uuid.UUID
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT p.org_id FROM projects p
+		JOIN org_members om ON p.org_id = om.org_id
+		WHERE p.id = $1 AND om.user_id = $2
+	`, projectID, userID).Scan(&orgID)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to verify access: %w", err)
+	}
+	return orgID, nil
+}
+
+func (r *pgNodeRepo) Visible(ctx context.Context, nodeID, userID uuid.UUID, includeDeleted bool) (bool, error) {
+	var exists bool
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM nodes n
+			JOIN org_members om ON n.org_id = om.org_id
+			WHERE n.id = $1 AND om.user_id = $2 AND ($3::BOOLEAN OR n.deleted_at IS NULL)
+		)
+	`, nodeID, userID, includeDeleted).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to verify access: %w", err)
+	}
+	return exists, nil
+}
+
+func (r *pgNodeRepo) Get(ctx context.Context, nodeID, userID uuid.UUID) (*models.Node, error) {
+	node, err := scanNode(r.db.Pool.QueryRow(ctx, `
+		SELECT n.id, n.org_id, n.project_id, n.parent_id, n.title, n.description, n.status, n.author_type,
+		       n.author_user_id, n.supervisor_user_id, n.version, n.metadata, n.position,
+		       n.locked_by, n.locked_at, n.lock_expires_at, n.template_id, n.template_version,
+		       n.agent_config, n.created_at, n.updated_at, n.deleted_at
+		FROM nodes n
+		JOIN org_members om ON n.org_id = om.org_id
+		WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
+	`, nodeID, userID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return node, err
+}
+
+func (r *pgNodeRepo) ListByProject(ctx context.Context, projectID uuid.UUID, filter NodeFilter, page pagination.Params) (*pagination.Page[models.Node], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	// Build the filters, shared by the page and the count
+	where := " WHERE project_id = $1 AND deleted_at IS NULL"
+	args := []any{projectID}
+	argIdx := 2
+
+	if filter.Status != nil {
+		where += fmt.Sprintf(" AND status = $%d", argIdx)
+		args = append(args, *filter.Status)
+		argIdx++
+	}
+	if filter.AuthorType != nil {
+		where += fmt.Sprintf(" AND author_type = $%d", argIdx)
+		args = append(args, *filter.AuthorType)
+		argIdx++
+	}
+	if filter.RootsOnly {
+		where += " AND parent_id IS NULL"
+	} else if filter.ParentID != nil {
+		where += fmt.Sprintf(" AND parent_id = $%d", argIdx)
+		args = append(args, *filter.ParentID)
+		argIdx++
+	}
+
+	var total int
+	if err := r.db.Reader().QueryRow(ctx, "SELECT COUNT(*) FROM nodes"+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count nodes: %w", err)
+	}
+
+	query := `
+		SELECT ` + nodeColumns + `
+		FROM nodes` + where
+	if afterCreated != nil {
+		query += fmt.Sprintf(" AND (created_at, id) < ($%d, $%d)", argIdx, argIdx+1)
+		args = append(args, *afterCreated, *afterID)
+		argIdx += 2
+	}
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id DESC LIMIT $%d", argIdx)
+	args = append(args, limit+1)
+
+	rows, err := r.db.Reader().Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes, err := collectNodes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+
+	result := pagination.NewPage(nodes, limit, nodeCursor)
+	result.Total = total
+	return result, nil
+}
+
+func (r *pgNodeRepo) ListChildren(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT `+nodeColumns+`
+		FROM nodes
+		WHERE parent_id = $1 AND deleted_at IS NULL
+		  AND ($2::TIMESTAMPTZ IS NULL OR (created_at, id) > ($2, $3::UUID))
+		ORDER BY created_at, id
+		LIMIT $4
+	`, nodeID, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children: %w", err)
+	}
+	children, err := collectNodes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children: %w", err)
+	}
+
+	result := pagination.NewPage(children, limit, nodeCursor)
+	err = r.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM nodes WHERE parent_id = $1 AND deleted_at IS NULL
+	`, nodeID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count children: %w", err)
+	}
+	return result, nil
+}
+
+func (r *pgNodeRepo) ListDependencies(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	// Get nodes that this node depends on via node_inputs.source_node_id
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT DISTINCT n.id, n.org_id, n.project_id, n.parent_id, n.title, n.description, n.status, n.author_type,
+		       n.author_user_id, n.supervisor_user_id, n.version, n.metadata, n.position,
+		       n.locked_by, n.locked_at, n.lock_expires_at, n.template_id, n.template_version,
+		       n.agent_config, n.created_at, n.updated_at, n.deleted_at
+		FROM nodes n
+		JOIN node_inputs ni ON n.id = ni.source_node_id
+		WHERE ni.node_id = $1 AND n.deleted_at IS NULL
+		  AND ($2::TIMESTAMPTZ IS NULL OR (n.created_at, n.id) > ($2, $3::UUID))
+		ORDER BY n.created_at, n.id
+		LIMIT $4
+	`, nodeID, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dependencies: %w", err)
+	}
+	deps, err := collectNodes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list dependencies: %w", err)
+	}
+
+	// Counting would repeat the join; dependency lists are short
+	return pagination.NewPage(deps, limit, nodeCursor), nil
+}
+
+func (r *pgNodeRepo) Inputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeInput, error) {
+	return r.InputsOf(ctx, []uuid.UUID{nodeID})
+}
+
+func (r *pgNodeRepo) Outputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeOutput, error) {
+	return r.OutputsOf(ctx, []uuid.UUID{nodeID})
+}
+
+func (r *pgNodeRepo) AddInput(ctx context.Context, input *models.NodeInput) error {
+	metadataJSON, _ := json.Marshal(input.Metadata)
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO node_inputs (id, node_id, input_type, file_id, source_node_id, source_node_version,
+		                         external_url, text_content, label, metadata, sort_order)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10,
+		        (SELECT COALESCE(MAX(sort_order), -1) + 1 FROM node_inputs WHERE node_id = $2))
+		RETURNING sort_order, created_at
+	`, input.ID, input.NodeID, input.InputType, input.FileID, input.SourceNodeID,
+		input.SourceNodeVersion, input.ExternalURL, input.TextContent, input.Label,
+		metadataJSON).Scan(&input.SortOrder, &input.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add input: %w", err)
+	}
+	return nil
+}
+
+func (r *pgNodeRepo) RemoveInput(ctx context.Context, nodeID, inputID, userID uuid.UUID) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM node_inputs ni
+		USING nodes n, org_members om
+		WHERE ni.id = $1 AND ni.node_id = $2 AND n.id = ni.node_id AND n.deleted_at IS NULL
+		  AND om.org_id = n.org_id AND om.user_id = $3
+	`, inputID, nodeID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove input: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgNodeRepo) AddOutput(ctx context.Context, output *models.NodeOutput) error {
+	metadataJSON, _ := json.Marshal(output.Metadata)
+	structuredDataJSON, _ := json.Marshal(output.StructuredData)
+	err := r.db.Pool.QueryRow(ctx, `
+		INSERT INTO node_outputs (id, node_id, output_type, file_id, structured_data, text_content,
+		                          external_url, label, metadata, sort_order)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9,
+		        (SELECT COALESCE(MAX(sort_order), -1) + 1 FROM node_outputs WHERE node_id = $2))
+		RETURNING sort_order, created_at
+	`, output.ID, output.NodeID, output.OutputType, output.FileID, structuredDataJSON,
+		output.TextContent, output.ExternalURL, output.Label, metadataJSON).Scan(&output.SortOrder, &output.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add output: %w", err)
+	}
+	return nil
+}
+
+func (r *pgNodeRepo) RemoveOutput(ctx context.Context, nodeID, outputID, userID uuid.UUID) error {
+	result, err := r.db.Pool.Exec(ctx, `
+		DELETE FROM node_outputs no
+		USING nodes n, org_members om
+		WHERE no.id = $1 AND no.node_id = $2 AND n.id = no.node_id AND n.deleted_at IS NULL
+		  AND om.org_id = n.org_id AND om.user_id = $3
+	`, outputID, nodeID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove output: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *pgNodeRepo) GetMany(ctx context.Context, nodeIDs []uuid.UUID) ([]models.Node, error) {
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT `+nodeColumns+`
+		FROM nodes
+		WHERE id = ANY($1) AND deleted_at IS NULL
+	`, nodeIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	nodes, err := collectNodes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+func (r *pgNodeRepo) ListByProjects(ctx context.Context, projectIDs []uuid.UUID, filter NodeFilter, limit int) ([]models.Node, error) {
+	// A lateral join takes each project's newest nodes from the index
+	// rather than ranking every node of every project
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT n.*
+		FROM unnest($1::UUID[]) AS p(id)
+		CROSS JOIN LATERAL (
+			SELECT `+nodeColumns+`
+			FROM nodes
+			WHERE project_id = p.id AND deleted_at IS NULL
+			  AND ($2::TEXT IS NULL OR status = $2)
+			  AND ($3::TEXT IS NULL OR author_type = $3)
+			  AND (NOT $4 OR parent_id IS NULL)
+			  AND ($4 OR $5::UUID IS NULL OR parent_id = $5)
+			ORDER BY created_at DESC, id DESC
+			LIMIT $6
+		) n
+	`, projectIDs, filter.Status, filter.AuthorType, filter.RootsOnly, filter.ParentID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	nodes, err := collectNodes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+func (r *pgNodeRepo) ListChildrenOf(ctx context.Context, nodeIDs []uuid.UUID, limit int) ([]models.Node, error) {
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT c.*
+		FROM unnest($1::UUID[]) AS p(id)
+		CROSS JOIN LATERAL (
+			SELECT `+nodeColumns+`
+			FROM nodes
+			WHERE parent_id = p.id AND deleted_at IS NULL
+			ORDER BY created_at, id
+			LIMIT $2
+		) c
+	`, nodeIDs, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children: %w", err)
+	}
+	children, err := collectNodes(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list children: %w", err)
+	}
+	return children, nil
+}
+
+func (r *pgNodeRepo) InputsOf(ctx context.Context, nodeIDs []uuid.UUID) ([]models.NodeInput, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, node_id, input_type, file_id, source_node_id, source_node_version,
+		       external_url, text_content, label, metadata, sort_order, created_at
+		FROM node_inputs
+		WHERE node_id = ANY($1)
+		ORDER BY node_id, sort_order
+	`, nodeIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get inputs: %w", err)
+	}
+	defer rows.Close()
+
+	var inputs []models.NodeInput
+	for rows.Next() {
+		var input models.NodeInput
+		var metadataJSON []byte
+		if err := rows.Scan(&input.ID, &input.NodeID, &input.InputType, &input.FileID,
+			&input.SourceNodeID, &input.SourceNodeVersion, &input.ExternalURL, &input.TextContent,
+			&input.Label, &metadataJSON, &input.SortOrder, &input.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan input: %w", err)
+		}
+		json.Unmarshal(metadataJSON, &input.Metadata)
+		inputs = append(inputs, input)
+	}
+
+	return inputs, rows.Err()
+}
+
+func (r *pgNodeRepo) OutputsOf(ctx context.Context, nodeIDs []uuid.UUID) ([]models.NodeOutput, error) {
+	rows, err := r.db.Pool.Query(ctx, `
+		SELECT id, node_id, output_type, file_id, structured_data, text_content,
+		       external_url, label, metadata, sort_order, created_at
+		FROM node_outputs
+		WHERE node_id = ANY($1)
+		ORDER BY node_id, sort_order
+	`, nodeIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outputs: %w", err)
+	}
+	defer rows.Close()
+
+	var outputs []models.NodeOutput
+	for rows.Next() {
+		var output models.NodeOutput
+		var metadataJSON, structuredDataJSON []byte
+		if err := rows.Scan(&output.ID, &output.NodeID, &output.OutputType, &output.FileID,
+			&structuredDataJSON, &output.TextContent, &output.ExternalURL, &output.Label,
+			&metadataJSON, &output.SortOrder, &output.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan output: %w", err)
+		}
+		json.Unmarshal(metadataJSON, &output.Metadata)
+		json.Unmarshal(structuredDataJSON, &output.StructuredData)
+		outputs = append(outputs, output)
+	}
+
+	return outputs, rows.Err()
+}
+
+func (r *pgNodeRepo) ListVersions(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.NodeVersion], error) {
+	afterVersion, _, err := page.AfterInt()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT id, node_id, version, snapshot, change_type, change_summary, changed_by, created_at
+		FROM node_versions
+		WHERE node_id = $1 AND ($2::INT IS NULL OR version < $2)
+		ORDER BY version DESC
+		LIMIT $3
+	`, nodeID, afterVersion, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.NodeVersion
+	for rows.Next() {
+		var v models.NodeVersion
+		var snapshotJSON []byte
+		if err := rows.Scan(&v.ID, &v.NodeID, &v.Version, &snapshotJSON, &v.ChangeType,
+			&v.ChangeSummary, &v.ChangedBy, &v.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		json.Unmarshal(snapshotJSON, &v.Snapshot)
+		versions = append(versions, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+
+	result := pagination.NewPage(versions, limit, versionCursor)
+	err = r.db.Reader().QueryRow(ctx, `SELECT COUNT(*) FROM node_versions WHERE node_id = $1`, nodeID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count versions: %w", err)
+	}
+	return result, nil
+}
+
+func (r *pgNodeRepo) GetVersion(ctx context.Context, nodeID uuid.UUID, version int) (*models.NodeVersion, error) {
+	var v models.NodeVersion
+	var snapshotJSON []byte
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT id, node_id, version, snapshot, change_type, change_summary, changed_by, created_at
+		FROM node_versions
+		WHERE node_id = $1 AND version = $2
+	`, nodeID, version).Scan(&v.ID, &v.NodeID, &v.Version, &snapshotJSON, &v.ChangeType,
+		&v.ChangeSummary, &v.ChangedBy, &v.CreatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+
+	json.Unmarshal(snapshotJSON, &v.Snapshot)
+	return &v, nil
+}
+
+func (r *pgNodeRepo) Lock(ctx context.Context, nodeID, userID uuid.UUID, expiresAt time.Time) (bool, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE nodes SET
+			locked_by = $2,
+			locked_at = NOW(),
+			lock_expires_at = $3,
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+		  AND (locked_by IS NULL OR locked_by = $2 OR lock_expires_at < NOW())
+	`, nodeID, userID, expiresAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+func (r *pgNodeRepo) Unlock(ctx context.Context, nodeID, userID uuid.UUID) (bool, error) {
+	result, err := r.db.Pool.Exec(ctx, `
+		UPDATE nodes SET
+			locked_by = NULL,
+			locked_at = NULL,
+			lock_expires_at = NULL,
+			updated_at = NOW()
+		WHERE id = $1 AND locked_by = $2
+	`, nodeID, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to release lock: %w", err)
+	}
+	return result.RowsAffected() > 0, nil
+}
+
+// scanNode scans a row of nodeColumns
+func scanNode(row pgx.Row) (*models.Node, error) {
+	var node models.Node
+	var metadataJSON, positionJSON, agentConfigJSON []byte
+
+	if err := row.Scan(
+		&node.ID, &node.OrgID, &node.ProjectID, &node.ParentID, &node.Title, &node.Description,
+		&node.Status, &node.AuthorType, &node.AuthorUserID, &node.SupervisorUserID, &node.Version,
+		&metadataJSON, &positionJSON, &node.LockedBy, &node.LockedAt, &node.LockExpiresAt,
+		&node.TemplateID, &node.TemplateVersion, &agentConfigJSON, &node.CreatedAt, &node.UpdatedAt,
+		&node.DeletedAt,
+	); err != nil {
+		return nil, fmt.Errorf("failed to scan node: %w", err)
+	}
+
+	json.Unmarshal(metadataJSON, &node.Metadata)
+	json.Unmarshal(positionJSON, &node.Position)
+	if agentConfigJSON != nil {
+		json.Unmarshal(agentConfigJSON, &node.AgentConfig)
+	}
+	return &node, nil
+}
+
+// collectNodes scans and closes rows of nodeColumns
+func collectNodes(rows pgx.Rows) ([]models.Node, error) {
+	defer rows.Close()
+
+	var nodes []models.Node
+	for rows.Next() {
+		node, err := scanNode(rows)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, *node)
+	}
+	return nodes, rows.Err()
+}
+
+// nodeCursor is the cursor of a node in a list sorted by creation time
+func nodeCursor(n models.Node) pagination.Cursor {
+	return pagination.TimeCursor(n.CreatedAt, n.ID)
+}
+
+// versionCursor is the cursor of a node version. Versions are unique per
+// node, so the ID is only there to fill the cursor.
+func versionCursor(v models.NodeVersion) pagination.Cursor {
+	return pagination.IntCursor(v.Version, v.ID)
+}
@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+type pgOrgRepo struct {
+	db *database.DB
+}
+
+// NewOrgRepo returns the Postgres OrgRepo
+func NewOrgRepo(db *database.DB) OrgRepo {
+	return &pgOrgRepo{db: db}
+}
+
+func (r *pgOrgRepo) ListForMember(ctx context.Context, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Organization], error) {
+	afterName, afterID, err := page.AfterString()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT o.id, o.name, o.slug, o.settings, o.event_sourcing_level, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN org_members om ON o.id = om.org_id
+		WHERE om.user_id = $1
+		  AND ($2::TEXT IS NULL OR (o.name, o.id) > ($2, $3::UUID))
+		ORDER BY o.name, o.id
+		LIMIT $4
+	`, userID, afterName, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []models.Organization
+	for rows.Next() {
+		var org models.Organization
+		var settingsJSON []byte
+
+		if err := rows.Scan(
+			&org.ID, &org.Name, &org.Slug, &settingsJSON,
+			&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+
+		json.Unmarshal(settingsJSON, &org.Settings)
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	result := pagination.NewPage(orgs, limit, orgCursor)
+	err = r.db.Reader().QueryRow(ctx, `SELECT COUNT(*) FROM org_members WHERE user_id = $1`, userID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count organizations: %w", err)
+	}
+	return result, nil
+}
+
+// orgCursor is the cursor of an org in a list sorted by name
+func orgCursor(o models.Organization) pagination.Cursor {
+	return pagination.StringCursor(o.Name, o.ID)
+}
+
+func (r *pgOrgRepo) GetForMember(ctx context.Context, orgID, userID uuid.UUID) (*models.Organization, error) {
+	var org models.Organization
+	var settingsJSON []byte
+
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT o.id, o.name, o.slug, o.settings, o.event_sourcing_level, o.created_at, o.updated_at
+		FROM organizations o
+		JOIN org_members om ON o.id = om.org_id
+		WHERE o.id = $1 AND om.user_id = $2
+	`, orgID, userID).Scan(
+		&org.ID, &org.Name, &org.Slug, &settingsJSON,
+		&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get organization: %w", err)
+	}
+
+	json.Unmarshal(settingsJSON, &org.Settings)
+	return &org, nil
+}
+
+func (r *pgOrgRepo) MemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error) {
+	var role string
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2
+	`, orgID, userID).Scan(&role)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get role: %w", err)
+	}
+
+	return role, nil
+}
+
+func (r *pgOrgRepo) AllowsOrigin(ctx context.Context, userID uuid.UUID, origin string) (bool, error) {
+	var allowed bool
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1
+			FROM organizations o
+			JOIN org_members om ON o.id = om.org_id
+			WHERE om.user_id = $1
+			  AND EXISTS (
+				SELECT 1 FROM jsonb_array_elements_text(COALESCE(o.settings->'allowedOrigins', '[]'::JSONB)) AS allowed(origin)
+				WHERE lower(rtrim(allowed.origin, '/')) = lower(rtrim($2, '/'))
+			  )
+		)
+	`, userID, origin).Scan(&allowed)
+	if err != nil {
+		return false, fmt.Errorf("failed to check org origins: %w", err)
+	}
+	return allowed, nil
+}
+
+func (r *pgOrgRepo) Delete(ctx context.Context, orgID uuid.UUID) error {
+	result, err := r.db.Pool.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete organization: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
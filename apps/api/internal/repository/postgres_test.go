@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// TestMemoryAgreesWithPostgres seeds the same rows into Postgres and a
+// Memory, then checks both list them in the same order, with the same
+// cursors and totals, and number inputs alike. It migrates the database at
+// TEST_DATABASE_URL and is skipped without one.
+func TestMemoryAgreesWithPostgres(t *testing.T) {
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+
+	db, err := database.NewConnection(url, database.PoolOptions{})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer db.Close()
+	migrator, err := database.NewMigrator(db, zap.NewNop())
+	if err != nil {
+		t.Fatalf("load migrations: %v", err)
+	}
+	if err := migrator.Up(ctx); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	m := NewMemory()
+	userID, projectID := uuid.New(), uuid.New()
+	exec := func(sql string, args ...any) {
+		t.Helper()
+		if _, err := db.Pool.Exec(ctx, sql, args...); err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	exec(`INSERT INTO users (id, cognito_sub, email) VALUES ($1, $2, $3)`, userID, userID.String(), "agree@example.com")
+
+	// Names that sort the same under any collation, with a tie so IDs
+	// decide. The user isn't a member of the last org.
+	var orgIDs []uuid.UUID
+	for i, name := range []string{"beta", "alpha", "alpha", "gamma"} {
+		id := uuid.New()
+		orgIDs = append(orgIDs, id)
+		exec(`INSERT INTO organizations (id, name, slug) VALUES ($1, $2, $3)`, id, name, fmt.Sprintf("agree-%s", id))
+		m.Orgs[id] = models.Organization{ID: id, Name: name}
+		if i < 3 {
+			exec(`INSERT INTO org_members (org_id, user_id, role) VALUES ($1, $2, 'member')`, id, userID)
+			m.Members[id] = map[uuid.UUID]string{userID: "member"}
+		}
+	}
+	t.Cleanup(func() {
+		db.Pool.Exec(context.Background(), `DELETE FROM organizations WHERE id = ANY($1)`, orgIDs)
+		db.Pool.Exec(context.Background(), `DELETE FROM users WHERE id = $1`, userID)
+	})
+	projectOrg := orgIDs[0]
+	exec(`INSERT INTO projects (id, org_id, name) VALUES ($1, $2, 'agree')`, projectID, projectOrg)
+	m.Projects[projectID] = models.Project{ID: projectID, OrgID: projectOrg, Name: "agree"}
+	for _, name := range []string{"beta", "alpha", "alpha"} {
+		id := uuid.New()
+		exec(`INSERT INTO projects (id, org_id, name) VALUES ($1, $2, $3)`, id, projectOrg, name)
+		m.Projects[id] = models.Project{ID: id, OrgID: projectOrg, Name: name}
+	}
+
+	// Postgres keeps microseconds. Several nodes share a creation time so
+	// IDs break the ties; the last is deleted.
+	base := time.Now().UTC().Truncate(time.Microsecond)
+	offsets := []time.Duration{0, 0, 0, time.Second, time.Second, 2 * time.Second, 0}
+	var nodeIDs []uuid.UUID
+	for i, offset := range offsets {
+		node := models.Node{
+			ID:         uuid.New(),
+			OrgID:      projectOrg,
+			ProjectID:  projectID,
+			Title:      fmt.Sprintf("node %d", i),
+			Status:     "draft",
+			AuthorType: "human",
+			CreatedAt:  base.Add(offset),
+			UpdatedAt:  base.Add(offset),
+		}
+		if i > 0 && i != 5 {
+			node.ParentID = &nodeIDs[0]
+		}
+		if i == len(offsets)-1 {
+			node.DeletedAt = &node.CreatedAt
+		}
+		exec(`
+			INSERT INTO nodes (id, org_id, project_id, parent_id, title, status, author_type, created_at, updated_at, deleted_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		`, node.ID, node.OrgID, node.ProjectID, node.ParentID, node.Title, node.Status, node.AuthorType,
+			node.CreatedAt, node.UpdatedAt, node.DeletedAt)
+		m.Nodes[node.ID] = node
+		nodeIDs = append(nodeIDs, node.ID)
+	}
+	rootID := nodeIDs[0]
+
+	pg, fake := NewNodeRepo(db), m.NodeRepo()
+
+	// Inputs referencing three nodes, one removed and one added after, so
+	// sort orders have a gap
+	for _, repo := range []NodeRepo{pg, fake} {
+		var added []uuid.UUID
+		for _, source := range nodeIDs[1:4] {
+			input := &models.NodeInput{ID: uuid.New(), NodeID: rootID, InputType: "node_reference", SourceNodeID: &source, Metadata: map[string]any{}}
+			if err := repo.AddInput(ctx, input); err != nil {
+				t.Fatalf("AddInput: %v", err)
+			}
+			added = append(added, input.ID)
+		}
+		if err := repo.RemoveInput(ctx, rootID, added[1], userID); err != nil {
+			t.Fatalf("RemoveInput: %v", err)
+		}
+		if err := repo.RemoveInput(ctx, rootID, added[1], userID); err != ErrNotFound {
+			t.Fatalf("second RemoveInput err = %v, want ErrNotFound", err)
+		}
+		input := &models.NodeInput{ID: uuid.New(), NodeID: rootID, InputType: "text", Metadata: map[string]any{}}
+		if err := repo.AddInput(ctx, input); err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+	}
+	sortOrders := func(repo NodeRepo) []int {
+		inputs, err := repo.Inputs(ctx, rootID)
+		if err != nil {
+			t.Fatalf("Inputs: %v", err)
+		}
+		var orders []int
+		for _, input := range inputs {
+			orders = append(orders, input.SortOrder)
+		}
+		return orders
+	}
+	if got, want := sortOrders(fake), sortOrders(pg); !slices.Equal(got, want) {
+		t.Fatalf("input sort orders: memory %v, postgres %v", got, want)
+	}
+
+	nodeLists := map[string]func(NodeRepo, pagination.Params) (*pagination.Page[models.Node], error){
+		"ListByProject": func(r NodeRepo, p pagination.Params) (*pagination.Page[models.Node], error) {
+			return r.ListByProject(ctx, projectID, NodeFilter{}, p)
+		},
+		"ListByProject roots": func(r NodeRepo, p pagination.Params) (*pagination.Page[models.Node], error) {
+			return r.ListByProject(ctx, projectID, NodeFilter{RootsOnly: true}, p)
+		},
+		"ListByProject parent": func(r NodeRepo, p pagination.Params) (*pagination.Page[models.Node], error) {
+			return r.ListByProject(ctx, projectID, NodeFilter{ParentID: &rootID}, p)
+		},
+		"ListChildren": func(r NodeRepo, p pagination.Params) (*pagination.Page[models.Node], error) {
+			return r.ListChildren(ctx, rootID, p)
+		},
+		"ListDependencies": func(r NodeRepo, p pagination.Params) (*pagination.Page[models.Node], error) {
+			return r.ListDependencies(ctx, rootID, p)
+		},
+	}
+	pgOrgs, fakeOrgs := NewOrgRepo(db), m.OrgRepo()
+	pgProjects, fakeProjects := NewProjectRepo(db), m.ProjectRepo()
+	projectIDOf := func(p models.Project) uuid.UUID { return p.ID }
+	for _, limit := range []int{1, 2, 3, pagination.DefaultLimit} {
+		for name, list := range nodeLists {
+			want := listAll(t, limit, func(p pagination.Params) (*pagination.Page[models.Node], error) { return list(pg, p) }, nodeID)
+			got := listAll(t, limit, func(p pagination.Params) (*pagination.Page[models.Node], error) { return list(fake, p) }, nodeID)
+			compareListings(t, fmt.Sprintf("%s limit %d", name, limit), got, want)
+		}
+
+		want := listAll(t, limit, func(p pagination.Params) (*pagination.Page[models.Organization], error) {
+			return pgOrgs.ListForMember(ctx, userID, p)
+		}, orgID)
+		got := listAll(t, limit, func(p pagination.Params) (*pagination.Page[models.Organization], error) {
+			return fakeOrgs.ListForMember(ctx, userID, p)
+		}, orgID)
+		compareListings(t, fmt.Sprintf("ListForMember limit %d", limit), got, want)
+
+		wantProjects := listAll(t, limit, func(p pagination.Params) (*pagination.Page[models.Project], error) {
+			return pgProjects.ListByOrg(ctx, projectOrg, p)
+		}, projectIDOf)
+		gotProjects := listAll(t, limit, func(p pagination.Params) (*pagination.Page[models.Project], error) {
+			return fakeProjects.ListByOrg(ctx, projectOrg, p)
+		}, projectIDOf)
+		compareListings(t, fmt.Sprintf("ListByOrg limit %d", limit), gotProjects, wantProjects)
+	}
+}
+
+// compareListings fails the test if the memory listing got differs from
+// the Postgres listing want
+func compareListings(t *testing.T, name string, got, want listing) {
+	t.Helper()
+
+	if !slices.Equal(got.IDs, want.IDs) {
+		t.Errorf("%s: memory lists %v, postgres %v", name, got.IDs, want.IDs)
+	}
+	if !slices.Equal(got.Cursors, want.Cursors) {
+		t.Errorf("%s: memory cursors %v, postgres %v", name, got.Cursors, want.Cursors)
+	}
+	if got.Total != want.Total {
+		t.Errorf("%s: memory total %d, postgres %d", name, got.Total, want.Total)
+	}
+}
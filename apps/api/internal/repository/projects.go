@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// projectColumns are the columns scanProject reads
+const projectColumns = `p.id, p.org_id, p.name, p.description, p.settings, p.workflow_states,
+		       p.template_id, p.template_version, p.created_at, p.updated_at`
+
+type pgProjectRepo struct {
+	db *database.DB
+}
+
+// NewProjectRepo returns the Postgres ProjectRepo
+func NewProjectRepo(db *database.DB) ProjectRepo {
+	return &pgProjectRepo{db: db}
+}
+
+func scanProject(row pgx.Row, p *models.Project) error {
+	var settingsJSON, workflowStatesJSON []byte
+	if err := row.Scan(
+		&p.ID, &p.OrgID, &p.Name, &p.Description, &settingsJSON,
+		&workflowStatesJSON, &p.TemplateID, &p.TemplateVersion, &p.CreatedAt, &p.UpdatedAt,
+	); err != nil {
+		return err
+	}
+	json.Unmarshal(settingsJSON, &p.Settings)
+	json.Unmarshal(workflowStatesJSON, &p.WorkflowStates)
+	return nil
+}
+
+func (r *pgProjectRepo) ListByOrg(ctx context.Context, orgID uuid.UUID, page pagination.Params) (*pagination.Page[models.Project], error) {
+	afterName, afterID, err := page.AfterString()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT `+projectColumns+`
+		FROM projects p
+		WHERE p.org_id = $1
+		  AND ($2::TEXT IS NULL OR (p.name, p.id) > ($2, $3::UUID))
+		ORDER BY p.name, p.id
+		LIMIT $4
+	`, orgID, afterName, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var p models.Project
+		if err := scanProject(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+
+	result := pagination.NewPage(projects, limit, projectCursor)
+	err = r.db.Reader().QueryRow(ctx, `SELECT COUNT(*) FROM projects WHERE org_id = $1`, orgID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count projects: %w", err)
+	}
+	return result, nil
+}
+
+// projectCursor is the cursor of a project in a list sorted by name
+func projectCursor(p models.Project) pagination.Cursor {
+	return pagination.StringCursor(p.Name, p.ID)
+}
+
+func (r *pgProjectRepo) GetForMember(ctx context.Context, projectID, userID uuid.UUID) (*models.Project, error) {
+	var p models.Project
+	err := scanProject(r.db.Pool.QueryRow(ctx, `
+		SELECT `+projectColumns+`
+		FROM projects p
+		JOIN org_members om ON p.org_id = om.org_id
+		WHERE p.id = $1 AND om.user_id = $2
+	`, projectID, userID), &p)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	return &p, nil
+}
+
+func (r *pgProjectRepo) ListForMember(ctx context.Context, projectIDs []uuid.UUID, userID uuid.UUID) ([]models.Project, error) {
+	rows, err := r.db.Reader().Query(ctx, `
+		SELECT `+projectColumns+`
+		FROM projects p
+		JOIN org_members om ON p.org_id = om.org_id
+		WHERE p.id = ANY($1) AND om.user_id = $2
+	`, projectIDs, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+	defer rows.Close()
+
+	var projects []models.Project
+	for rows.Next() {
+		var p models.Project
+		if err := scanProject(rows, &p); err != nil {
+			return nil, fmt.Errorf("failed to scan project: %w", err)
+		}
+		projects = append(projects, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get projects: %w", err)
+	}
+	return projects, nil
+}
@@ -0,0 +1,183 @@
+// Package repository holds the queries behind the org, project, node and
+// execution services. Each aggregate has an interface, a Postgres
+// implementation and an in-memory fake (see Memory), so services can be
+// exercised without a database. Repos make the writes that stand alone;
+// writes that must commit together with domain events or queued jobs stay
+// in the services' transactions.
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// ErrNotFound is returned when a row doesn't exist or isn't visible to the
+// user. services.ErrNotFound is the same error.
+var ErrNotFound = errors.New("resource not found")
+
+// ActiveStatuses are the statuses of an execution that hasn't finished
+var ActiveStatuses = []string{"pending", "running", "paused", "awaiting_input"}
+
+// OrgRepo reads organizations and their memberships
+type OrgRepo interface {
+	// ListForMember returns a page of the orgs userID belongs to, by name,
+	// with Total set
+	ListForMember(ctx context.Context, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Organization], error)
+
+	// GetForMember returns an org userID belongs to
+	GetForMember(ctx context.Context, orgID, userID uuid.UUID) (*models.Organization, error)
+
+	// MemberRole returns userID's role in the org
+	MemberRole(ctx context.Context, orgID, userID uuid.UUID) (string, error)
+
+	// AllowsOrigin reports whether any org userID belongs to lists origin in
+	// settings.allowedOrigins, ignoring case and a trailing slash
+	AllowsOrigin(ctx context.Context, userID uuid.UUID, origin string) (bool, error)
+
+	// Delete deletes an org and, by cascade, everything in it
+	Delete(ctx context.Context, orgID uuid.UUID) error
+}
+
+// ProjectRepo reads projects
+type ProjectRepo interface {
+	// ListByOrg returns a page of an org's projects, by name, with Total
+	// set. Callers check membership of the org.
+	ListByOrg(ctx context.Context, orgID uuid.UUID, page pagination.Params) (*pagination.Page[models.Project], error)
+
+	// GetForMember returns a project in an org userID belongs to
+	GetForMember(ctx context.Context, projectID, userID uuid.UUID) (*models.Project, error)
+
+	// ListForMember returns the projects among projectIDs in orgs userID
+	// belongs to, in no particular order
+	ListForMember(ctx context.Context, projectIDs []uuid.UUID, userID uuid.UUID) ([]models.Project, error)
+}
+
+// NodeFilter narrows a project's node list. Nil fields match any node.
+type NodeFilter struct {
+	Status     *string
+	AuthorType *string
+	ParentID   *uuid.UUID
+	RootsOnly  bool // only nodes without a parent
+}
+
+// NodeRepo reads nodes, their versions, inputs and outputs, and holds their
+// edit locks. Only live (not soft-deleted) nodes are returned.
+type NodeRepo interface {
+	// ProjectOrg returns the org of a project userID can access
+	ProjectOrg(ctx context.Context, projectID, userID uuid.UUID) (uuid.UUID, error)
+
+	// Visible reports whether userID can access a node. Soft-deleted nodes
+	// count only when includeDeleted is set.
+	Visible(ctx context.Context, nodeID, userID uuid.UUID, includeDeleted bool) (bool, error)
+
+	// Get returns a node userID can access, without its inputs and outputs
+	Get(ctx context.Context, nodeID, userID uuid.UUID) (*models.Node, error)
+
+	// ListByProject returns a page of a project's nodes, newest first, with
+	// Total set
+	ListByProject(ctx context.Context, projectID uuid.UUID, filter NodeFilter, page pagination.Params) (*pagination.Page[models.Node], error)
+
+	// ListChildren returns a page of a node's children, oldest first, with
+	// Total set
+	ListChildren(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error)
+
+	// ListDependencies returns a page of the nodes a node's inputs come
+	// from, oldest first. Total isn't counted.
+	ListDependencies(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error)
+
+	// Inputs returns a node's inputs in sort order
+	Inputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeInput, error)
+
+	// Outputs returns a node's outputs in sort order
+	Outputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeOutput, error)
+
+	// AddInput adds an input after the node's others, setting its
+	// SortOrder and CreatedAt. Callers check access to the node.
+	AddInput(ctx context.Context, input *models.NodeInput) error
+
+	// RemoveInput deletes an input of a live node userID can access
+	RemoveInput(ctx context.Context, nodeID, inputID, userID uuid.UUID) error
+
+	// AddOutput adds an output after the node's others, setting its
+	// SortOrder and CreatedAt. Callers check access to the node.
+	AddOutput(ctx context.Context, output *models.NodeOutput) error
+
+	// RemoveOutput deletes an output of a live node userID can access
+	RemoveOutput(ctx context.Context, nodeID, outputID, userID uuid.UUID) error
+
+	// The batch reads below serve many nodes or projects in one query, for
+	// the GraphQL resolvers. They don't check access; callers check the org
+	// of what they return.
+
+	// GetMany returns the live nodes among nodeIDs, in no particular order
+	GetMany(ctx context.Context, nodeIDs []uuid.UUID) ([]models.Node, error)
+
+	// ListByProjects returns up to limit of each project's nodes that match
+	// filter, newest first
+	ListByProjects(ctx context.Context, projectIDs []uuid.UUID, filter NodeFilter, limit int) ([]models.Node, error)
+
+	// ListChildrenOf returns up to limit of each node's children, oldest
+	// first
+	ListChildrenOf(ctx context.Context, nodeIDs []uuid.UUID, limit int) ([]models.Node, error)
+
+	// InputsOf returns the inputs of each node, in sort order
+	InputsOf(ctx context.Context, nodeIDs []uuid.UUID) ([]models.NodeInput, error)
+
+	// OutputsOf returns the outputs of each node, in sort order
+	OutputsOf(ctx context.Context, nodeIDs []uuid.UUID) ([]models.NodeOutput, error)
+
+	// ListVersions returns a page of a node's versions, newest first, with
+	// Total set
+	ListVersions(ctx context.Context, nodeID uuid.UUID, page pagination.Params) (*pagination.Page[models.NodeVersion], error)
+
+	// GetVersion returns one version of a node
+	GetVersion(ctx context.Context, nodeID uuid.UUID, version int) (*models.NodeVersion, error)
+
+	// Lock records userID's edit lock on a node until expiresAt. It returns
+	// false when another user holds an unexpired lock or the node is gone.
+	Lock(ctx context.Context, nodeID, userID uuid.UUID, expiresAt time.Time) (bool, error)
+
+	// Unlock clears userID's lock on a node, returning false if they don't
+	// hold it
+	Unlock(ctx context.Context, nodeID, userID uuid.UUID) (bool, error)
+}
+
+// Execution is an agent execution with the fields services use but don't
+// return
+type Execution struct {
+	models.AgentExecution
+	OrgID      uuid.UUID
+	Checkpoint []byte // langgraph_checkpoint as JSON, nil if none
+}
+
+// ExecutionRepo reads agent executions and their traces, and makes the
+// status changes that need no job dispatched
+type ExecutionRepo interface {
+	// Get returns an execution of a node userID can access
+	Get(ctx context.Context, executionID, userID uuid.UUID) (*Execution, error)
+
+	// Active returns a node's newest execution in ActiveStatuses
+	Active(ctx context.Context, nodeID uuid.UUID) (*Execution, error)
+
+	// ListByNodes returns up to limit of each node's executions, newest
+	// first and without checkpoints. It doesn't check access.
+	ListByNodes(ctx context.Context, nodeIDs []uuid.UUID, limit int) ([]Execution, error)
+
+	// Pause marks a running execution paused, returning false if it isn't
+	// running
+	Pause(ctx context.Context, executionID uuid.UUID) (bool, error)
+
+	// Cancel marks an active execution cancelled, returning false if it
+	// isn't active
+	Cancel(ctx context.Context, executionID uuid.UUID) (bool, error)
+
+	// ListTrace returns a page of an execution's trace events in sequence
+	// order, with Total set. Events are no older than since, the
+	// execution's creation, which bounds the partitions searched.
+	ListTrace(ctx context.Context, executionID uuid.UUID, since time.Time, page pagination.Params) (*pagination.Page[models.TraceEvent], error)
+}
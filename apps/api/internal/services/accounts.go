@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidReassignTarget means the user nodes would be reassigned to is
+// the user being deleted, isn't active, or isn't a member of every org the
+// nodes are in
+var ErrInvalidReassignTarget = errors.New("invalid reassign target")
+
+// SoleOwnerError is returned by DeleteAccount while the user is the only
+// active owner of orgs. Someone else must be made an owner, or the orgs
+// deleted, first.
+type SoleOwnerError struct {
+	Orgs []OwnedOrg
+}
+
+// OwnedOrg is an org the user is the only owner of
+type OwnedOrg struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+}
+
+func (e *SoleOwnerError) Error() string {
+	return fmt.Sprintf("user is the only owner of %d orgs", len(e.Orgs))
+}
+
+// DeleteAccountRequest contains options for deleting the current user
+type DeleteAccountRequest struct {
+	// Member who takes over the nodes the user authored or supervises.
+	// Without one they keep naming the anonymized user.
+	ReassignTo *uuid.UUID `json:"reassignTo"`
+}
+
+// RemovedMembership is an org membership removed with an account
+type RemovedMembership struct {
+	OrgID uuid.UUID
+	Role  string
+}
+
+// AccountDeletion is what deleting an account changed
+type AccountDeletion struct {
+	Memberships     []RemovedMembership
+	ReassignedNodes int64
+}
+
+// DeleteAccount deletes the user's account. The row is kept so the nodes,
+// versions and audit records naming it still resolve, but its email, name,
+// avatar and settings are replaced and its Cognito sub released, so signing
+// in again starts a new account. Tokens are revoked, org and project
+// memberships removed, node locks released and notifications deleted, all
+// in one transaction. The owners and admins of the orgs the user left are
+// notified. Returns a *SoleOwnerError while the user is the only owner of an
+// org.
+func (s *UserService) DeleteAccount(ctx context.Context, userID uuid.UUID, req DeleteAccountRequest) (*AccountDeletion, error) {
+	var deletion AccountDeletion
+	err := s.db.WithTransactionOptions(ctx, database.TxOptions{Isolation: pgx.Serializable}, func(tx pgx.Tx) error {
+		deletion = AccountDeletion{}
+
+		var deleted bool
+		err := tx.QueryRow(ctx, `
+			SELECT deleted_at IS NOT NULL FROM users WHERE id = $1 FOR UPDATE
+		`, userID).Scan(&deleted)
+		if errors.Is(err, pgx.ErrNoRows) || deleted {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		owned, err := soleOwnedOrgs(ctx, tx, userID)
+		if err != nil {
+			return err
+		}
+		if len(owned) > 0 {
+			return &SoleOwnerError{Orgs: owned}
+		}
+
+		if req.ReassignTo != nil {
+			reassigned, err := reassignNodes(ctx, tx, userID, *req.ReassignTo)
+			if err != nil {
+				return err
+			}
+			deletion.ReassignedNodes = reassigned
+		}
+
+		rows, err := tx.Query(ctx, `
+			DELETE FROM org_members WHERE user_id = $1
+			RETURNING org_id, role
+		`, userID)
+		if err != nil {
+			return fmt.Errorf("failed to remove memberships: %w", err)
+		}
+		for rows.Next() {
+			var m RemovedMembership
+			if err := rows.Scan(&m.OrgID, &m.Role); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan membership: %w", err)
+			}
+			deletion.Memberships = append(deletion.Memberships, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to remove memberships: %w", err)
+		}
+
+		for _, stmt := range []string{
+			`DELETE FROM project_members WHERE user_id = $1`,
+			`DELETE FROM deferred_notifications WHERE user_id = $1`,
+			`DELETE FROM notifications WHERE user_id = $1`,
+			`DELETE FROM mentions WHERE user_id = $1`,
+			`DELETE FROM notification_webhooks WHERE user_id = $1`,
+			`DELETE FROM push_subscriptions WHERE user_id = $1`,
+			`UPDATE nodes SET locked_by = NULL, locked_at = NULL, lock_expires_at = NULL WHERE locked_by = $1`,
+		} {
+			if _, err := tx.Exec(ctx, stmt, userID); err != nil {
+				return fmt.Errorf("failed to delete account: %w", err)
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE users SET
+				cognito_sub = 'deleted:' || id,
+				email = 'deleted-' || id || '@deleted.invalid',
+				name = NULL,
+				avatar_url = NULL,
+				settings = '{}',
+				is_platform_admin = FALSE,
+				deleted_at = NOW(),
+				tokens_revoked_at = NOW(),
+				updated_at = NOW()
+			WHERE id = $1
+		`, userID)
+		if err != nil {
+			return fmt.Errorf("failed to anonymize user: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.az.InvalidateAccount(userID)
+	s.notifications.invalidateUnread(ctx, userID)
+	for _, m := range deletion.Memberships {
+		s.az.InvalidateRole(m.OrgID, userID)
+		if err := s.notifications.MembershipChanged(ctx, m.OrgID, userID, userID, MembershipRemoved); err != nil {
+			s.logger.Warn("Failed to notify membership change", zap.Error(err), zap.String("org_id", m.OrgID.String()))
+		}
+	}
+	return &deletion, nil
+}
+
+// soleOwnedOrgs returns the orgs the user owns with no other active owner.
+// The owners' memberships are locked, so two owners can't both leave.
+func soleOwnedOrgs(ctx context.Context, tx pgx.Tx, userID uuid.UUID) ([]OwnedOrg, error) {
+	_, err := tx.Exec(ctx, `
+		SELECT 1 FROM org_members
+		WHERE role = $2 AND org_id IN (SELECT org_id FROM org_members WHERE user_id = $1 AND role = $2)
+		FOR UPDATE
+	`, userID, string(authz.RoleOwner))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock owners: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT o.id, o.name
+		FROM org_members om
+		JOIN organizations o ON o.id = om.org_id
+		WHERE om.user_id = $1 AND om.role = $2
+		  AND NOT EXISTS (
+			SELECT 1 FROM org_members other
+			JOIN users u ON u.id = other.user_id
+			WHERE other.org_id = om.org_id AND other.role = $2 AND other.user_id <> $1
+			  AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
+		  )
+		ORDER BY o.name
+	`, userID, string(authz.RoleOwner))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check org owners: %w", err)
+	}
+	defer rows.Close()
+
+	var owned []OwnedOrg
+	for rows.Next() {
+		var org OwnedOrg
+		if err := rows.Scan(&org.ID, &org.Name); err != nil {
+			return nil, fmt.Errorf("failed to scan org: %w", err)
+		}
+		owned = append(owned, org)
+	}
+	return owned, rows.Err()
+}
+
+// reassignNodes hands the live nodes the user authored or supervises to
+// target, which must be an active member of every org they are in
+func reassignNodes(ctx context.Context, tx pgx.Tx, userID, target uuid.UUID) (int64, error) {
+	if target == userID {
+		return 0, ErrInvalidReassignTarget
+	}
+
+	var invalid bool
+	err := tx.QueryRow(ctx, `
+		SELECT NOT EXISTS (
+			SELECT 1 FROM users WHERE id = $2 AND deactivated_at IS NULL AND deleted_at IS NULL
+		) OR EXISTS (
+			SELECT 1 FROM nodes n
+			WHERE (n.author_user_id = $1 OR n.supervisor_user_id = $1) AND n.deleted_at IS NULL
+			  AND NOT EXISTS (SELECT 1 FROM org_members om WHERE om.org_id = n.org_id AND om.user_id = $2)
+		)
+	`, userID, target).Scan(&invalid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to check reassign target: %w", err)
+	}
+	if invalid {
+		return 0, ErrInvalidReassignTarget
+	}
+
+	result, err := tx.Exec(ctx, `
+		UPDATE nodes SET
+			author_user_id = CASE WHEN author_user_id = $1 THEN $2 ELSE author_user_id END,
+			supervisor_user_id = CASE WHEN supervisor_user_id = $1 THEN $2 ELSE supervisor_user_id END
+		WHERE (author_user_id = $1 OR supervisor_user_id = $1) AND deleted_at IS NULL
+	`, userID, target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign nodes: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// DeactivateUser stops a user from using the API until they are
+// reactivated, and revokes their tokens. Memberships and nodes are kept.
+// Deleted users are ErrNotFound.
+func (s *AdminService) DeactivateUser(ctx context.Context, userID uuid.UUID) (*models.AdminUser, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE users SET
+			deactivated_at = COALESCE(deactivated_at, NOW()),
+			tokens_revoked_at = NOW(),
+			updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to deactivate user: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+
+	s.az.InvalidateAccount(userID)
+	return s.GetUser(ctx, userID)
+}
+
+// ReactivateUser lets a deactivated user use the API again. Tokens issued
+// before they were deactivated stay revoked. Deleted users are ErrNotFound.
+func (s *AdminService) ReactivateUser(ctx context.Context, userID uuid.UUID) (*models.AdminUser, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE users SET deactivated_at = NULL, updated_at = NOW()
+		WHERE id = $1 AND deleted_at IS NULL
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reactivate user: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return nil, ErrNotFound
+	}
+
+	s.az.InvalidateAccount(userID)
+	return s.GetUser(ctx, userID)
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+)
+
+// Activity types
+const (
+	ActivityNodeEdit   = "node_edit"
+	ActivityExecution  = "execution"
+	ActivityFileUpload = "file_upload"
+)
+
+// ActivityItem is one thing a user did. Action is the kind of node change,
+// the execution's status or the file's processing status.
+type ActivityItem struct {
+	ID        uuid.UUID  `json:"id"`
+	Type      string     `json:"type"`
+	Action    string     `json:"action"`
+	OrgID     uuid.UUID  `json:"orgId"`
+	ProjectID *uuid.UUID `json:"projectId,omitempty"`
+	NodeID    *uuid.UUID `json:"nodeId,omitempty"`
+	FileID    *uuid.UUID `json:"fileId,omitempty"`
+	Title     string     `json:"title"`
+	Summary   *string    `json:"summary,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// ListActivityRequest filters a user's activity
+type ListActivityRequest struct {
+	Type  *string    `form:"type" binding:"omitempty,oneof=node_edit execution file_upload"`
+	OrgID *string    `form:"orgId" binding:"omitempty,uuid"`
+	Since *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	pagination.Params
+}
+
+// ListActivity returns a page of the user's own node edits, executions
+// started and file uploads, newest first, across the orgs they are still a
+// member of. Deleted nodes are left out.
+func (s *UserService) ListActivity(ctx context.Context, userID uuid.UUID, req ListActivityRequest) (*pagination.Page[ActivityItem], error) {
+	afterCreated, afterID, err := req.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := req.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT id, type, action, org_id, project_id, node_id, file_id, title, summary, created_at
+		FROM (
+			SELECT v.id, 'node_edit' AS type, COALESCE(v.change_type, 'updated') AS action,
+			       n.org_id, n.project_id, n.id AS node_id, NULL::UUID AS file_id,
+			       n.title, v.change_summary AS summary, v.created_at
+			FROM node_versions v
+			JOIN nodes n ON n.id = v.node_id
+			WHERE v.changed_by = $1 AND n.deleted_at IS NULL
+			UNION ALL
+			SELECT e.id, 'execution', e.status, n.org_id, n.project_id, n.id, NULL,
+			       n.title, e.error_message, e.created_at
+			FROM agent_executions e
+			JOIN nodes n ON n.id = e.node_id
+			WHERE e.started_by = $1 AND n.deleted_at IS NULL
+			UNION ALL
+			SELECT f.id, 'file_upload', f.processing_status, f.org_id, NULL, NULL, f.id,
+			       f.filename, f.processing_error, f.created_at
+			FROM files f
+			WHERE f.uploaded_by = $1 AND f.processing_status <> 'pending'
+		) activity
+		WHERE org_id IN (SELECT org_id FROM org_members WHERE user_id = $1)
+		  AND ($2::TEXT IS NULL OR type = $2)
+		  AND ($3::UUID IS NULL OR org_id = $3)
+		  AND ($4::TIMESTAMPTZ IS NULL OR created_at >= $4)
+		  AND ($5::TIMESTAMPTZ IS NULL OR created_at < $5)
+		  AND ($6::TIMESTAMPTZ IS NULL OR (created_at, id) < ($6, $7::UUID))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $8
+	`, userID, req.Type, req.OrgID, req.Since, req.Until, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list activity: %w", err)
+	}
+	defer rows.Close()
+
+	var items []ActivityItem
+	for rows.Next() {
+		var a ActivityItem
+		if err := rows.Scan(&a.ID, &a.Type, &a.Action, &a.OrgID, &a.ProjectID, &a.NodeID, &a.FileID,
+			&a.Title, &a.Summary, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		items = append(items, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list activity: %w", err)
+	}
+
+	return pagination.NewPage(items, limit, func(a ActivityItem) pagination.Cursor {
+		return pagination.TimeCursor(a.CreatedAt, a.ID)
+	}), nil
+}
@@ -0,0 +1,281 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// AdminService answers cross-org questions for platform admins. Nothing here
+// is scoped by membership; callers must have checked the platform admin flag.
+type AdminService struct {
+	db     *database.DB
+	az     *authz.Authorizer
+	logger *zap.Logger
+}
+
+func NewAdminService(db *database.DB, az *authz.Authorizer, logger *zap.Logger) *AdminService {
+	return &AdminService{db: db, az: az, logger: logger}
+}
+
+// AdminListOrgsRequest contains filters for listing all organizations
+type AdminListOrgsRequest struct {
+	Query string `form:"q"` // matches name or slug
+}
+
+// ListOrgs returns a page of organizations across the platform with member
+// and project counts, newest first
+func (s *AdminService) ListOrgs(ctx context.Context, req AdminListOrgsRequest, page pagination.Params) (*pagination.Page[models.AdminOrgSummary], error) {
+	beforeCreated, beforeID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT o.id, o.name, o.slug, o.settings, o.event_sourcing_level, o.created_at, o.updated_at,
+		       (SELECT COUNT(*) FROM org_members om WHERE om.org_id = o.id),
+		       (SELECT COUNT(*) FROM projects p WHERE p.org_id = o.id)
+		FROM organizations o
+		WHERE ($1 = '' OR o.name ILIKE '%' || $1 || '%' OR o.slug ILIKE '%' || $1 || '%')
+		  AND ($2::TIMESTAMPTZ IS NULL OR (o.created_at, o.id) < ($2, $3::UUID))
+		ORDER BY o.created_at DESC, o.id DESC
+		LIMIT $4
+	`, req.Query, beforeCreated, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+	defer rows.Close()
+
+	var orgs []models.AdminOrgSummary
+	for rows.Next() {
+		var org models.AdminOrgSummary
+		var settingsJSON []byte
+		if err := rows.Scan(
+			&org.ID, &org.Name, &org.Slug, &settingsJSON,
+			&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
+			&org.MemberCount, &org.ProjectCount,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan organization: %w", err)
+		}
+		json.Unmarshal(settingsJSON, &org.Settings)
+		orgs = append(orgs, org)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list organizations: %w", err)
+	}
+
+	result := pagination.NewPage(orgs, limit, func(org models.AdminOrgSummary) pagination.Cursor {
+		return pagination.TimeCursor(org.CreatedAt, org.ID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM organizations o
+		WHERE $1 = '' OR o.name ILIKE '%' || $1 || '%' OR o.slug ILIKE '%' || $1 || '%'
+	`, req.Query).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count organizations: %w", err)
+	}
+	return result, nil
+}
+
+// AdminUserLookupRequest contains filters for looking up users
+type AdminUserLookupRequest struct {
+	Email string `form:"email" binding:"required"` // prefix match, case-insensitive
+	Limit int    `form:"limit"`
+}
+
+// LookupUsers finds users by email prefix, including their memberships
+func (s *AdminService) LookupUsers(ctx context.Context, req AdminUserLookupRequest) ([]models.AdminUser, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id FROM users
+		WHERE email ILIKE $1 || '%'
+		ORDER BY email
+		LIMIT $2
+	`, req.Email, adminLimit(req.Limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up users: %w", err)
+	}
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+
+	users := make([]models.AdminUser, 0, len(ids))
+	for _, id := range ids {
+		user, err := s.GetUser(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, *user)
+	}
+	return users, nil
+}
+
+// GetUser returns a user with their org memberships
+func (s *AdminService) GetUser(ctx context.Context, userID uuid.UUID) (*models.AdminUser, error) {
+	var user models.AdminUser
+	var settingsJSON []byte
+
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT id, cognito_sub, email, name, avatar_url, settings, is_platform_admin,
+			deactivated_at, deleted_at, created_at, updated_at
+		FROM users WHERE id = $1
+	`, userID).Scan(
+		&user.ID, &user.CognitoSub, &user.Email, &user.Name, &user.AvatarURL,
+		&settingsJSON, &user.IsPlatformAdmin, &user.DeactivatedAt, &user.DeletedAt,
+		&user.CreatedAt, &user.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	json.Unmarshal(settingsJSON, &user.Settings)
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT o.id, o.name, om.role
+		FROM org_members om
+		JOIN organizations o ON o.id = om.org_id
+		WHERE om.user_id = $1
+		ORDER BY o.name
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list memberships: %w", err)
+	}
+	defer rows.Close()
+
+	user.Memberships = []models.AdminMembership{}
+	for rows.Next() {
+		var m models.AdminMembership
+		if err := rows.Scan(&m.OrgID, &m.OrgName, &m.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan membership: %w", err)
+		}
+		user.Memberships = append(user.Memberships, m)
+	}
+
+	return &user, nil
+}
+
+// AdminListExecutionsRequest contains filters for inspecting executions
+type AdminListExecutionsRequest struct {
+	Status string  `form:"status"`
+	OrgID  *string `form:"orgId" binding:"omitempty,uuid"`
+}
+
+const adminExecutionColumns = `
+	e.id, e.node_id, e.status, e.langgraph_thread_id, e.trace_summary,
+	e.started_at, e.completed_at, e.error_message,
+	e.total_tokens_in, e.total_tokens_out, e.estimated_cost_usd, e.model_id, e.created_at,
+	n.org_id, n.project_id, n.title`
+
+// ListExecutions returns a page of executions across all orgs, newest
+// first. Total isn't counted.
+func (s *AdminService) ListExecutions(ctx context.Context, req AdminListExecutionsRequest, page pagination.Params) (*pagination.Page[models.AdminExecution], error) {
+	beforeCreated, beforeID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT `+adminExecutionColumns+`
+		FROM agent_executions e
+		JOIN nodes n ON n.id = e.node_id
+		WHERE ($1 = '' OR e.status = $1)
+		  AND ($2::UUID IS NULL OR n.org_id = $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR (e.created_at, e.id) < ($3, $4::UUID))
+		ORDER BY e.created_at DESC, e.id DESC
+		LIMIT $5
+	`, req.Status, req.OrgID, beforeCreated, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list executions: %w", err)
+	}
+	defer rows.Close()
+
+	var executions []models.AdminExecution
+	for rows.Next() {
+		exec, err := scanAdminExecution(rows)
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, *exec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list executions: %w", err)
+	}
+
+	return pagination.NewPage(executions, limit, func(exec models.AdminExecution) pagination.Cursor {
+		return pagination.TimeCursor(exec.CreatedAt, exec.ID)
+	}), nil
+}
+
+// GetExecution returns any execution by ID
+func (s *AdminService) GetExecution(ctx context.Context, executionID uuid.UUID) (*models.AdminExecution, error) {
+	row := s.db.Pool.QueryRow(ctx, `
+		SELECT `+adminExecutionColumns+`
+		FROM agent_executions e
+		JOIN nodes n ON n.id = e.node_id
+		WHERE e.id = $1
+	`, executionID)
+
+	exec, err := scanAdminExecution(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return exec, err
+}
+
+// MigrationStatus reports the database's schema version and the migrations
+// this binary would apply
+func (s *AdminService) MigrationStatus(ctx context.Context) (*database.MigrationStatus, error) {
+	migrator, err := database.NewMigrator(s.db, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	return migrator.Status(ctx)
+}
+
+func scanAdminExecution(row pgx.Row) (*models.AdminExecution, error) {
+	var exec models.AdminExecution
+	var traceSummaryJSON []byte
+	err := row.Scan(
+		&exec.ID, &exec.NodeID, &exec.Status, &exec.LanggraphThreadID, &traceSummaryJSON,
+		&exec.StartedAt, &exec.CompletedAt, &exec.ErrorMessage,
+		&exec.TotalTokensIn, &exec.TotalTokensOut, &exec.EstimatedCostUSD, &exec.ModelID, &exec.CreatedAt,
+		&exec.OrgID, &exec.ProjectID, &exec.NodeTitle,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan execution: %w", err)
+	}
+	if traceSummaryJSON != nil {
+		json.Unmarshal(traceSummaryJSON, &exec.TraceSummary)
+	}
+	return &exec, nil
+}
+
+func adminLimit(limit int) int {
+	if limit <= 0 || limit > 200 {
+		return 50
+	}
+	return limit
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"slices"
+
+	"github.com/glassbox/api/internal/models"
+)
+
+// agentTools are the tools the agent worker offers, in the order it offers
+// them. Tool lists and policy actions name these.
+var agentTools = []string{"create_subnode", "add_output", "request_human_input", "mark_complete"}
+
+// toolPolicy is what an execution may do with the agent's tools
+type toolPolicy struct {
+	Allowed  []string // tools the agent is offered
+	Approval []string // allowed tools whose calls wait for a human to approve them
+}
+
+// resolveToolPolicy applies the policies and tool lists of every config
+// layer, keeping the strictest: a tool is offered only if every non-empty
+// tool list includes it and no policy denies it, and needs approval if any
+// policy says so. No layer can loosen another.
+func resolveToolPolicy(policies []models.AgentPolicy, toolLists [][]string) toolPolicy {
+	policy := toolPolicy{Allowed: []string{}, Approval: []string{}}
+	for _, tool := range agentTools {
+		if slices.ContainsFunc(toolLists, func(tools []string) bool {
+			return len(tools) > 0 && !slices.Contains(tools, tool)
+		}) {
+			continue
+		}
+		allowed, approval := true, false
+		for _, p := range policies {
+			if p.Action == tool {
+				allowed = allowed && p.Allowed
+				approval = approval || p.RequiresApproval
+			}
+		}
+		if !allowed {
+			continue
+		}
+		policy.Allowed = append(policy.Allowed, tool)
+		if approval {
+			policy.Approval = append(policy.Approval, tool)
+		}
+	}
+	return policy
+}
+
+// workerConfig is the orgConfig of an agent job: the org's models and the
+// execution's effective agent config, whose tool policy the worker enforces.
+// defaultModel is the effective model, for workers that only read that.
+func workerConfig(settings models.OrganizationSettings, effective *models.EffectiveAgentConfig) map[string]any {
+	orgConfig := map[string]any{}
+	if effective.Model != "" {
+		orgConfig["defaultModel"] = effective.Model
+	}
+	if len(settings.Models) > 0 {
+		orgConfig["models"] = settings.Models
+	}
+
+	orgConfig["agentConfig"] = models.AgentConfig{
+		Model:        effective.Model,
+		MaxTokens:    effective.MaxTokens,
+		Temperature:  effective.Temperature,
+		SystemPrompt: effective.SystemPrompt,
+	}
+	orgConfig["allowedTools"] = effective.AllowedTools
+	orgConfig["approvalTools"] = effective.ApprovalTools
+	return orgConfig
+}
@@ -0,0 +1,284 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/cache"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidScope  = errors.New("invalid API key scope")
+	ErrInvalidExpiry = errors.New("API key expiry is in the past")
+)
+
+const (
+	// Every key starts with this, so leaked keys are easy to scan for
+	apiKeyPrefix = "gbx_"
+	// Characters of a key kept in the clear to tell keys apart
+	apiKeyDisplayLength = 12
+
+	// How long an authenticated key is cached. Revocations are seen at
+	// once; the TTL only covers a missed notification.
+	apiKeyCacheTTL = 5 * time.Minute
+	// last_used_at is written at most this often per key
+	apiKeyTouchInterval = time.Minute
+)
+
+// CreatedAPIKey is an API key as returned once, on creation: the key can't
+// be read back later
+type CreatedAPIKey struct {
+	models.APIKey
+	Key string `json:"key"`
+}
+
+// CreateAPIKeyRequest creates an org API key. Scopes are authz actions
+// (e.g. "node:read"); expiresAt is optional.
+type CreateAPIKeyRequest struct {
+	Name      string     `json:"name" binding:"required,max=100"`
+	Scopes    []string   `json:"scopes" binding:"required,min=1,max=50"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// APIKeyService manages org API keys and authenticates requests made with
+// them. A key acts as the user who created it, so it can never do more
+// than they can, and stops working when they leave the org or are
+// deactivated. Callers must have authorized authz.OrgAdmin for everything
+// but AuthenticateAPIKey.
+type APIKeyService struct {
+	db     *database.DB
+	authz  *authz.Authorizer
+	logger *zap.Logger
+
+	// Active keys by hash
+	keys *cache.Local[string, *models.APIKey]
+	// When each key's last_used_at was last written
+	touched sync.Map
+}
+
+// NewAPIKeyService creates the service and subscribes its cache to listener
+func NewAPIKeyService(db *database.DB, listener *database.Listener, az *authz.Authorizer, logger *zap.Logger) *APIKeyService {
+	s := &APIKeyService{
+		db:     db,
+		authz:  az,
+		logger: logger,
+		keys:   cache.NewLocal[string, *models.APIKey](apiKeyCacheTTL, listener.Connected),
+	}
+	listener.Subscribe(s)
+	return s
+}
+
+// Create issues a key for the org. Returns ErrInvalidScope for scopes that
+// aren't actions, ErrForbidden for scopes the caller's own role lacks, and
+// ErrInvalidExpiry for an expiry that has passed.
+func (s *APIKeyService) Create(ctx context.Context, orgID, actorID uuid.UUID, req CreateAPIKeyRequest) (*CreatedAPIKey, error) {
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+
+	role, err := s.authz.RoleIn(ctx, orgID, actorID)
+	if errors.Is(err, authz.ErrNotFound) {
+		return nil, ErrForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, scope := range req.Scopes {
+		action := authz.Action(scope)
+		if !authz.RoleOwner.Can(action) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidScope, scope)
+		}
+		if !role.Can(action) {
+			return nil, ErrForbidden
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	slices.Sort(scopes)
+
+	key, keyHash, err := newAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	created := CreatedAPIKey{Key: key}
+	err = s.db.Pool.QueryRow(ctx, `
+		INSERT INTO api_keys (org_id, name, prefix, key_hash, scopes, created_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, org_id, name, prefix, scopes, created_by, expires_at, last_used_at, created_at
+	`, orgID, strings.TrimSpace(req.Name), key[:apiKeyDisplayLength], keyHash, scopes, actorID, req.ExpiresAt).Scan(
+		&created.ID, &created.OrgID, &created.Name, &created.Prefix, &created.Scopes,
+		&created.CreatedBy, &created.ExpiresAt, &created.LastUsedAt, &created.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create API key: %w", err)
+	}
+	return &created, nil
+}
+
+// List returns a page of the org's unrevoked keys, newest first. Expired
+// ones are included so they can be replaced.
+func (s *APIKeyService) List(ctx context.Context, orgID uuid.UUID, page pagination.Params) (*pagination.Page[models.APIKey], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT id, org_id, name, prefix, scopes, created_by, expires_at, last_used_at, created_at
+		FROM api_keys
+		WHERE org_id = $1 AND revoked_at IS NULL
+		  AND ($2::TIMESTAMPTZ IS NULL OR (created_at, id) < ($2, $3::UUID))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $4
+	`, orgID, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.APIKey
+	for rows.Next() {
+		var k models.APIKey
+		if err := rows.Scan(&k.ID, &k.OrgID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedBy,
+			&k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list API keys: %w", err)
+	}
+
+	result := pagination.NewPage(keys, limit, func(k models.APIKey) pagination.Cursor {
+		return pagination.TimeCursor(k.CreatedAt, k.ID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM api_keys WHERE org_id = $1 AND revoked_at IS NULL
+	`, orgID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count API keys: %w", err)
+	}
+	return result, nil
+}
+
+// Revoke stops a key working, on every instance
+func (s *APIKeyService) Revoke(ctx context.Context, orgID, keyID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND org_id = $2 AND revoked_at IS NULL
+	`, keyID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	s.keys.Clear()
+	return nil
+}
+
+// AuthenticateAPIKey returns the active key matching key, or nil if there
+// isn't one (unknown, revoked or expired). Implements
+// middleware.APIKeyAuthenticator.
+func (s *APIKeyService) AuthenticateAPIKey(ctx context.Context, key string) (*models.APIKey, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) || len(key) > 100 {
+		return nil, nil
+	}
+
+	keyHash := hashAPIKey(key)
+	k, err := s.keys.Load(keyHash, func() (*models.APIKey, error) {
+		var k models.APIKey
+		err := s.db.Pool.QueryRow(ctx, `
+			SELECT id, org_id, name, prefix, scopes, created_by, expires_at, last_used_at, created_at
+			FROM api_keys
+			WHERE key_hash = $1 AND revoked_at IS NULL
+		`, keyHash).Scan(&k.ID, &k.OrgID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedBy,
+			&k.ExpiresAt, &k.LastUsedAt, &k.CreatedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrNotFound
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get API key: %w", err)
+		}
+		return &k, nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if k.ExpiresAt != nil && !time.Now().Before(*k.ExpiresAt) {
+		return nil, nil
+	}
+
+	s.touch(k.ID)
+	return k, nil
+}
+
+// touch records that a key was used, in the background and at most once
+// per apiKeyTouchInterval
+func (s *APIKeyService) touch(keyID uuid.UUID) {
+	now := time.Now()
+	if last, ok := s.touched.Load(keyID); ok && now.Sub(last.(time.Time)) < apiKeyTouchInterval {
+		return
+	}
+	s.touched.Store(keyID, now)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if _, err := s.db.Pool.Exec(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE id = $1`, keyID, now); err != nil {
+			s.logger.Warn("Failed to record API key use", zap.String("api_key_id", keyID.String()), zap.Error(err))
+		}
+	}()
+}
+
+// Invalidate drops cached keys when one is revoked or deleted. Keys are
+// cached by hash, so all of them go.
+func (s *APIKeyService) Invalidate(change database.RowChange) {
+	if change.Table == "api_keys" {
+		s.keys.Clear()
+	}
+}
+
+// InvalidateAll drops every cached key
+func (s *APIKeyService) InvalidateAll() {
+	s.keys.Clear()
+}
+
+// newAPIKey returns a random key and the hash stored for it
+func newAPIKey() (key, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, hashAPIKey(key), nil
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,271 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	auditBufferSize    = 1024
+	auditBatchSize     = 100
+	auditFlushInterval = 2 * time.Second
+)
+
+// AuditService persists request audit entries asynchronously.
+// Entries are buffered in memory and written in batches so auditing never
+// adds a database round trip to the request path.
+type AuditService struct {
+	db      *database.DB
+	authz   *authz.Authorizer
+	logger  *zap.Logger
+	entries chan models.RequestAuditEntry
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewAuditService(db *database.DB, az *authz.Authorizer, logger *zap.Logger) *AuditService {
+	s := &AuditService{
+		db:      db,
+		authz:   az,
+		logger:  logger,
+		entries: make(chan models.RequestAuditEntry, auditBufferSize),
+		done:    make(chan struct{}),
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s
+}
+
+// Record queues an entry for writing. It never blocks; entries are dropped
+// (and logged) if the buffer is full.
+func (s *AuditService) Record(entry models.RequestAuditEntry) {
+	select {
+	case s.entries <- entry:
+	default:
+		s.logger.Warn("Audit buffer full, dropping entry",
+			zap.String("route", entry.Route),
+			zap.String("userId", entry.UserID.String()),
+		)
+	}
+}
+
+// Stop flushes buffered entries and stops the writer
+func (s *AuditService) Stop() {
+	close(s.done)
+	s.wg.Wait()
+}
+
+func (s *AuditService) run() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(auditFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]models.RequestAuditEntry, 0, auditBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.writeBatch(batch); err != nil {
+			s.logger.Error("Failed to write audit entries", zap.Error(err), zap.Int("count", len(batch)))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry := <-s.entries:
+			batch = append(batch, entry)
+			if len(batch) >= auditBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.done:
+			// Drain whatever is still buffered
+			for {
+				select {
+				case entry := <-s.entries:
+					batch = append(batch, entry)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (s *AuditService) writeBatch(entries []models.RequestAuditEntry) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	batch := &pgx.Batch{}
+	for _, e := range entries {
+		resourceJSON, _ := json.Marshal(e.ResourceIDs)
+		batch.Queue(`
+			INSERT INTO request_audit_log (
+				user_id, org_id, method, route, path, resource_ids,
+				status, latency_ms, request_id, ip_address, user_agent, api_key_id, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10::INET, $11, $12, $13)
+		`, e.UserID, s.resolveOrgID(ctx, e), e.Method, e.Route, e.Path, resourceJSON,
+			e.Status, e.LatencyMs, e.RequestID, e.IPAddress, e.UserAgent, e.APIKeyID, e.CreatedAt)
+	}
+
+	results := s.db.Pool.SendBatch(ctx, batch)
+	defer results.Close()
+
+	for range entries {
+		if _, err := results.Exec(); err != nil {
+			return fmt.Errorf("failed to insert audit entry: %w", err)
+		}
+	}
+	return nil
+}
+
+// resolveOrgID returns the entry's org, looking it up from the resource IDs
+// when the route did not include one
+func (s *AuditService) resolveOrgID(ctx context.Context, e models.RequestAuditEntry) *uuid.UUID {
+	if e.OrgID != nil {
+		return e.OrgID
+	}
+
+	res, ok, err := authz.ResourceFromParams(e.ResourceIDs)
+	if !ok || err != nil {
+		return nil
+	}
+	orgID, err := s.authz.OrgFor(ctx, res)
+	if err != nil {
+		return nil
+	}
+	return &orgID
+}
+
+// ListAuditLogRequest contains filters for querying the request audit log
+type ListAuditLogRequest struct {
+	UserID *string    `form:"userId"`
+	Method string     `form:"method"`
+	Since  *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// ListForOrg returns a page of request audit entries for an org, newest
+// first. Total isn't counted. Callers must have authorized authz.OrgAdmin.
+func (s *AuditService) ListForOrg(ctx context.Context, orgID uuid.UUID, req ListAuditLogRequest, page pagination.Params) (*pagination.Page[models.RequestAuditEntry], error) {
+	beforeCreated, beforeID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT id, user_id, org_id, method, route, path, resource_ids,
+		       status, latency_ms, request_id, host(ip_address), user_agent, api_key_id, created_at
+		FROM request_audit_log
+		WHERE org_id = $1
+		  AND ($2::UUID IS NULL OR user_id = $2)
+		  AND ($3 = '' OR method = $3)
+		  AND ($4::TIMESTAMPTZ IS NULL OR created_at >= $4)
+		  AND ($5::TIMESTAMPTZ IS NULL OR created_at < $5)
+		  AND ($6::TIMESTAMPTZ IS NULL OR (created_at, id) < ($6, $7::UUID))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $8
+	`, orgID, req.UserID, req.Method, req.Since, req.Until, beforeCreated, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.RequestAuditEntry
+	for rows.Next() {
+		var e models.RequestAuditEntry
+		var resourceJSON []byte
+		if err := rows.Scan(
+			&e.ID, &e.UserID, &e.OrgID, &e.Method, &e.Route, &e.Path, &resourceJSON,
+			&e.Status, &e.LatencyMs, &e.RequestID, &e.IPAddress, &e.UserAgent, &e.APIKeyID, &e.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		json.Unmarshal(resourceJSON, &e.ResourceIDs)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	return pagination.NewPage(entries, limit, func(e models.RequestAuditEntry) pagination.Cursor {
+		return pagination.TimeCursor(e.CreatedAt, e.ID)
+	}), nil
+}
+
+// ListChangesRequest filters the row changes recorded for orgs with
+// settings.rowAudit
+type ListChangesRequest struct {
+	ResourceType string     `form:"resourceType" binding:"omitempty,oneof=node file execution"`
+	ResourceID   *string    `form:"resourceId"`
+	Since        *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until        *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+}
+
+// ListChangesForOrg returns a page of the row changes recorded for an org,
+// newest first. Total isn't counted. Callers must have authorized
+// authz.OrgAdmin.
+func (s *AuditService) ListChangesForOrg(ctx context.Context, orgID uuid.UUID, req ListChangesRequest, page pagination.Params) (*pagination.Page[models.AuditLogEntry], error) {
+	beforeCreated, beforeID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT id, org_id, action, resource_type, resource_id, details, created_at
+		FROM audit_log
+		WHERE org_id = $1
+		  AND ($2 = '' OR resource_type = $2)
+		  AND ($3::UUID IS NULL OR resource_id = $3)
+		  AND ($4::TIMESTAMPTZ IS NULL OR created_at >= $4)
+		  AND ($5::TIMESTAMPTZ IS NULL OR created_at < $5)
+		  AND ($6::TIMESTAMPTZ IS NULL OR (created_at, id) < ($6, $7::UUID))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $8
+	`, orgID, req.ResourceType, req.ResourceID, req.Since, req.Until, beforeCreated, beforeID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit changes: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []models.AuditLogEntry
+	for rows.Next() {
+		var e models.AuditLogEntry
+		var detailsJSON []byte
+		if err := rows.Scan(
+			&e.ID, &e.OrgID, &e.Action, &e.ResourceType, &e.ResourceID, &detailsJSON, &e.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan audit change: %w", err)
+		}
+		json.Unmarshal(detailsJSON, &e.Details)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit changes: %w", err)
+	}
+
+	return pagination.NewPage(entries, limit, auditChangeCursor), nil
+}
+
+// auditChangeCursor is the cursor of a row change in a list sorted newest
+// first
+func auditChangeCursor(e models.AuditLogEntry) pagination.Cursor {
+	return pagination.TimeCursor(e.CreatedAt, e.ID)
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	authGuardPrefix = "auth_guard:"
+
+	// Failures older than this no longer count towards a lockout
+	authFailureWindow = 15 * time.Minute
+	// How long consecutive lockouts are remembered for backoff
+	authLockoutMemory = 24 * time.Hour
+	authLockoutMax    = 24 * time.Hour
+)
+
+// AuthGuardService protects login/token endpoints from brute force. Every
+// attempt is counted per IP and per identity (e.g. email); repeated failures
+// lock the key out with exponential backoff. State lives in Redis so limits
+// hold across instances. If Redis is unavailable the guard fails open.
+type AuthGuardService struct {
+	db     *database.DB
+	redis  *database.Redis
+	cfg    *config.Config
+	logger *zap.Logger
+}
+
+func NewAuthGuardService(db *database.DB, redis *database.Redis, cfg *config.Config, logger *zap.Logger) *AuthGuardService {
+	return &AuthGuardService{db: db, redis: redis, cfg: cfg, logger: logger}
+}
+
+// Allow counts an attempt and reports how long the caller must wait, or 0
+// if the attempt may proceed
+func (s *AuthGuardService) Allow(ctx context.Context, ip, identity string) time.Duration {
+	var wait time.Duration
+	minute := strconv.FormatInt(time.Now().Unix()/60, 10)
+
+	for _, scope := range guardScopes(ip, identity) {
+		ttl, err := s.redis.Client.TTL(ctx, authGuardPrefix+"lock:"+scope).Result()
+		if err != nil {
+			s.logger.Warn("Failed to read auth lockout", zap.Error(err))
+			continue
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+
+		key := authGuardPrefix + "attempts:" + scope + ":" + minute
+		count, err := s.redis.Client.Incr(ctx, key).Result()
+		if err != nil {
+			s.logger.Warn("Failed to count auth attempt", zap.Error(err))
+			continue
+		}
+		if count == 1 {
+			s.redis.Client.Expire(ctx, key, time.Minute)
+		}
+		if count > int64(s.cfg.AuthAttemptsPerMinute) {
+			if untilNextMinute := time.Duration(60-time.Now().Unix()%60) * time.Second; untilNextMinute > wait {
+				wait = untilNextMinute
+			}
+		}
+	}
+
+	return wait
+}
+
+// RecordFailure counts a failed attempt. Reaching AuthLockoutThreshold locks
+// the key for AuthLockoutBase * 2^(consecutive lockouts), and records a
+// security event.
+func (s *AuthGuardService) RecordFailure(ctx context.Context, ip, identity string) {
+	for _, scope := range guardScopes(ip, identity) {
+		failuresKey := authGuardPrefix + "failures:" + scope
+		failures, err := s.redis.Client.Incr(ctx, failuresKey).Result()
+		if err != nil {
+			s.logger.Warn("Failed to count auth failure", zap.Error(err))
+			continue
+		}
+		if failures == 1 {
+			s.redis.Client.Expire(ctx, failuresKey, authFailureWindow)
+		}
+		if failures < int64(s.cfg.AuthLockoutThreshold) {
+			continue
+		}
+
+		lockoutsKey := authGuardPrefix + "lockouts:" + scope
+		lockouts, err := s.redis.Client.Incr(ctx, lockoutsKey).Result()
+		if err != nil {
+			s.logger.Warn("Failed to count auth lockout", zap.Error(err))
+			continue
+		}
+		s.redis.Client.Expire(ctx, lockoutsKey, authLockoutMemory)
+
+		duration := lockoutDuration(s.cfg.AuthLockoutBase, lockouts)
+		s.redis.Client.Set(ctx, authGuardPrefix+"lock:"+scope, "1", duration)
+		s.redis.Client.Del(ctx, failuresKey)
+
+		s.logger.Warn("Auth lockout",
+			zap.String("scope", strings.SplitN(scope, ":", 2)[0]),
+			zap.String("ip", ip),
+			zap.Duration("duration", duration),
+			zap.Int64("consecutiveLockouts", lockouts),
+		)
+		s.recordLockout(ctx, ip, identity, scope, duration, lockouts)
+	}
+}
+
+// RecordSuccess clears failure counts after a successful attempt. Lockout
+// history for the IP is kept so a shared attacker IP can't reset its backoff
+// with one valid login.
+func (s *AuthGuardService) RecordSuccess(ctx context.Context, ip, identity string) {
+	if identity == "" {
+		return
+	}
+	scope := identityScope(identity)
+	if err := s.redis.Client.Del(ctx,
+		authGuardPrefix+"failures:"+scope,
+		authGuardPrefix+"lockouts:"+scope,
+	).Err(); err != nil && err != redis.Nil {
+		s.logger.Warn("Failed to reset auth failures", zap.Error(err))
+	}
+}
+
+func (s *AuthGuardService) recordLockout(ctx context.Context, ip, identity, scope string, duration time.Duration, lockouts int64) {
+	details, _ := json.Marshal(map[string]any{
+		"scope":               strings.SplitN(scope, ":", 2)[0],
+		"durationSeconds":     int(duration.Seconds()),
+		"consecutiveLockouts": lockouts,
+	})
+
+	var identityValue *string
+	if identity != "" {
+		identityValue = &identity
+	}
+
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO security_events (event_type, ip_address, identity, details)
+		VALUES ('auth.lockout', NULLIF($1, '')::INET, $2, $3)
+	`, ip, identityValue, details)
+	if err != nil {
+		s.logger.Error("Failed to record lockout event", zap.Error(err))
+	}
+}
+
+// guardScopes returns the keys an attempt is tracked under
+func guardScopes(ip, identity string) []string {
+	scopes := []string{"ip:" + ip}
+	if identity != "" {
+		scopes = append(scopes, identityScope(identity))
+	}
+	return scopes
+}
+
+// identityScope hashes the identity so emails aren't stored in Redis keys
+func identityScope(identity string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(identity))))
+	return "id:" + hex.EncodeToString(sum[:16])
+}
+
+func lockoutDuration(base time.Duration, lockouts int64) time.Duration {
+	duration := base
+	for i := int64(1); i < lockouts && duration < authLockoutMax; i++ {
+		duration *= 2
+	}
+	if duration > authLockoutMax {
+		duration = authLockoutMax
+	}
+	return duration
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrVersionConflict is returned when an update was based on a version of a
+// resource that has changed since
+var ErrVersionConflict = errors.New("resource was modified concurrently")
+
+// Precondition is the version of a resource an update was based on, taken
+// from the client's If-Match header. The zero value matches any version, so
+// clients that don't send one keep last-write-wins behaviour.
+type Precondition struct {
+	UpdatedAt *time.Time
+	// Version is set instead of UpdatedAt for nodes, whose updated_at also
+	// moves with their locks, inputs and outputs
+	Version *int
+}
+
+// Matches reports whether a resource last updated at updatedAt is the
+// version the update was based on
+func (p Precondition) Matches(updatedAt time.Time) bool {
+	return p.UpdatedAt == nil || p.UpdatedAt.Equal(updatedAt)
+}
+
+// MatchesVersion reports whether a resource at version is the version the
+// update was based on
+func (p Precondition) MatchesVersion(version int) bool {
+	return p.Version == nil || *p.Version == version
+}
+
+// versionCheck is the WHERE condition guarding an UPDATE with a
+// Precondition bound to placeholder $arg
+func versionCheck(arg int) string {
+	return fmt.Sprintf("($%d::TIMESTAMPTZ IS NULL OR updated_at = $%d)", arg, arg)
+}
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// missedUpdate explains a guarded UPDATE of table that matched no row:
+// ErrVersionConflict when the row exists but failed the guard, else
+// ErrNotFound
+func missedUpdate(ctx context.Context, q rowQuerier, table string, id uuid.UUID) error {
+	var exists bool
+	err := q.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM `+pgx.Identifier{table}.Sanitize()+` WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check %s: %w", table, err)
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
@@ -0,0 +1,127 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// Layers of agent config, most specific first
+const (
+	ConfigLayerExecution = "execution"
+	ConfigLayerNode      = "node"
+	ConfigLayerTemplate  = "template"
+	ConfigLayerProject   = "project"
+	ConfigLayerOrg       = "org"
+)
+
+// ConfigResolver works out the agent config an execution of a node runs
+// with. Each setting (model, maxTokens, temperature, systemPrompt) comes
+// from the first layer that sets it, in the order execution override, node,
+// the template version the node was created from, project, org. Tools and
+// policies are constraints instead: every layer's apply, and the strictest
+// wins, so an override can't loosen what a template or org pins.
+type ConfigResolver struct {
+	db *database.DB
+}
+
+func NewConfigResolver(db *database.DB) *ConfigResolver {
+	return &ConfigResolver{db: db}
+}
+
+// configLayer is one layer's agent config, nil when it sets nothing
+type configLayer struct {
+	name   string
+	config *models.AgentConfig
+}
+
+// Resolve returns the effective agent config of a node, with override as
+// the execution layer (nil for none). ErrNotFound if the node doesn't exist
+// or is deleted; callers check access.
+func (r *ConfigResolver) Resolve(ctx context.Context, nodeID uuid.UUID, override *models.AgentConfig) (*models.EffectiveAgentConfig, error) {
+	var nodeJSON, templateJSON, projectJSON, orgJSON []byte
+	err := r.db.Pool.QueryRow(ctx, `
+		SELECT n.agent_config, tv.agent_config, p.settings, o.settings
+		FROM nodes n
+		JOIN projects p ON p.id = n.project_id
+		JOIN organizations o ON o.id = n.org_id
+		LEFT JOIN template_versions tv ON tv.template_id = n.template_id AND tv.version = n.template_version
+		WHERE n.id = $1 AND n.deleted_at IS NULL
+	`, nodeID).Scan(&nodeJSON, &templateJSON, &projectJSON, &orgJSON)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent config layers: %w", err)
+	}
+
+	var project models.ProjectSettings
+	if projectJSON != nil {
+		json.Unmarshal(projectJSON, &project)
+	}
+	var org models.OrganizationSettings
+	if orgJSON != nil {
+		json.Unmarshal(orgJSON, &org)
+	}
+
+	return resolveAgentConfig([]configLayer{
+		{ConfigLayerExecution, override},
+		{ConfigLayerNode, decodeAgentConfig(nodeJSON)},
+		{ConfigLayerTemplate, decodeAgentConfig(templateJSON)},
+		{ConfigLayerProject, project.AgentConfig},
+		{ConfigLayerOrg, &models.AgentConfig{Model: org.DefaultModel, Policies: org.AgentPolicies}},
+	}), nil
+}
+
+// resolveAgentConfig merges layers, most specific first
+func resolveAgentConfig(layers []configLayer) *models.EffectiveAgentConfig {
+	e := &models.EffectiveAgentConfig{Sources: map[string]string{}}
+	e.Policies = []models.AgentPolicy{}
+	var toolLists [][]string
+
+	for _, layer := range layers {
+		c := layer.config
+		if c == nil {
+			continue
+		}
+		if e.Model == "" && c.Model != "" {
+			e.Model = c.Model
+			e.Sources["model"] = layer.name
+		}
+		if e.MaxTokens == 0 && c.MaxTokens != 0 {
+			e.MaxTokens = c.MaxTokens
+			e.Sources["maxTokens"] = layer.name
+		}
+		if e.Temperature == 0 && c.Temperature != 0 {
+			e.Temperature = c.Temperature
+			e.Sources["temperature"] = layer.name
+		}
+		if e.SystemPrompt == "" && c.SystemPrompt != "" {
+			e.SystemPrompt = c.SystemPrompt
+			e.Sources["systemPrompt"] = layer.name
+		}
+		toolLists = append(toolLists, c.Tools)
+		e.Policies = append(e.Policies, c.Policies...)
+	}
+
+	policy := resolveToolPolicy(e.Policies, toolLists)
+	e.AllowedTools = policy.Allowed
+	e.ApprovalTools = policy.Approval
+	return e
+}
+
+// decodeAgentConfig decodes an agent_config column, nil when it's NULL
+func decodeAgentConfig(data []byte) *models.AgentConfig {
+	if data == nil {
+		return nil
+	}
+	var c *models.AgentConfig
+	json.Unmarshal(data, &c)
+	return c
+}
@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// NotificationDigest is the type of the in-app digest notification
+const NotificationDigest = "digest"
+
+const (
+	digestLeaseKey = "glassbox:digest:leader"
+	// Titles listed in a digest's body; the rest are only counted
+	digestListedItems = 5
+)
+
+// digestTypes are the low-priority notification types. Users with a digest
+// schedule aren't pushed these; they are summarized instead.
+var digestTypes = []string{NotificationNodeUpdated, NotificationMembershipChanged}
+
+// digestNouns name the digest types in a digest's counts
+var digestNouns = map[string]string{
+	NotificationNodeUpdated:       "node update",
+	NotificationMembershipChanged: "membership change",
+}
+
+// isDigestType reports whether notifications of kind go into digests
+func isDigestType(kind string) bool {
+	return slices.Contains(digestTypes, kind)
+}
+
+// Mailer sends an email. The API sends through mail.SMTP when SMTP_HOST is
+// set; without a Mailer, notifications and digests are only delivered in-app
+// and invitations aren't emailed.
+type Mailer func(ctx context.Context, to, subject, body string) error
+
+// DigestService sends daily and weekly summaries of low-priority
+// notifications: one in-app notification per org, and one email when the
+// user has email notifications on. Users choose the schedule in
+// settings.notifications.
+type DigestService struct {
+	db            *database.DB
+	redis         *database.Redis
+	notifications *NotificationService
+	mail          Mailer
+	cfg           *config.Config
+	logger        *zap.Logger
+
+	// Identifies this instance as the holder of the digest lease
+	holder string
+}
+
+func NewDigestService(db *database.DB, redis *database.Redis, notifications *NotificationService, cfg *config.Config, logger *zap.Logger) *DigestService {
+	return &DigestService{db: db, redis: redis, notifications: notifications, cfg: cfg, logger: logger, holder: uuid.NewString()}
+}
+
+// SetMailer enables digest emails
+func (s *DigestService) SetMailer(mail Mailer) {
+	s.mail = mail
+}
+
+// DigestItem is one notification summarized in a digest
+type DigestItem struct {
+	Type         string     `json:"type"`
+	Title        string     `json:"title"`
+	Count        int        `json:"count"`
+	ResourceType *string    `json:"resourceType,omitempty"`
+	ResourceID   *uuid.UUID `json:"resourceId,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// OrgDigest is the part of a digest about one org
+type OrgDigest struct {
+	OrgID   uuid.UUID    `json:"orgId"`
+	OrgName string       `json:"orgName"`
+	Total   int          `json:"total"`
+	Items   []DigestItem `json:"items"`
+}
+
+// Digest is a summary of a user's unread low-priority notifications
+type Digest struct {
+	Schedule string      `json:"schedule"`
+	Since    time.Time   `json:"since"`
+	Until    time.Time   `json:"until"`
+	NextAt   *time.Time  `json:"nextAt,omitempty"`
+	Total    int         `json:"total"`
+	Orgs     []OrgDigest `json:"orgs"`
+}
+
+// Run sends the digests that are due every DigestInterval until ctx is
+// cancelled. Only the instance holding the digest lease in Redis sends them.
+func (s *DigestService) Run(ctx context.Context) {
+	if !s.cfg.DigestEnabled {
+		return
+	}
+	defer s.redis.ReleaseLock(context.WithoutCancel(ctx), digestLeaseKey, s.holder)
+
+	ticker := time.NewTicker(s.cfg.DigestInterval)
+	defer ticker.Stop()
+	for {
+		s.runIfLeader(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *DigestService) runIfLeader(ctx context.Context) {
+	held, err := s.redis.HoldLease(ctx, digestLeaseKey, s.holder, 2*s.cfg.DigestInterval)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("Failed to hold digest lease", zap.Error(err))
+		}
+		return
+	}
+	if !held {
+		return
+	}
+
+	sent, err := s.SendDue(ctx, time.Now().UTC())
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Error("Notification digests failed", zap.Error(err))
+		}
+		return
+	}
+	if sent > 0 {
+		s.logger.Info("Sent notification digests", zap.Int("users", sent))
+	}
+}
+
+// digestUser is a user with a digest schedule
+type digestUser struct {
+	id           uuid.UUID
+	email        string
+	prefs        models.NotificationPreferences
+	lastDigestAt *time.Time
+}
+
+// SendDue sends the digest of every user whose scheduled time has passed
+// since their last one, and returns how many users were sent one. Users
+// with nothing to summarize are skipped until their next scheduled time.
+func (s *DigestService) SendDue(ctx context.Context, now time.Time) (int, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, email, settings->'notifications', last_digest_at
+		FROM users
+		WHERE deactivated_at IS NULL AND deleted_at IS NULL
+		  AND settings->'notifications'->>'digest' IN ('daily', 'weekly')
+	`)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list digest users: %w", err)
+	}
+	var users []digestUser
+	for rows.Next() {
+		var u digestUser
+		var prefsJSON []byte
+		if err := rows.Scan(&u.id, &u.email, &prefsJSON, &u.lastDigestAt); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan digest user: %w", err)
+		}
+		prefs, err := notificationPreferences(prefsJSON)
+		if err != nil {
+			s.logger.Warn("Skipping digest for invalid notification preferences",
+				zap.String("user_id", u.id.String()), zap.Error(err))
+			continue
+		}
+		u.prefs = prefs
+		users = append(users, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to list digest users: %w", err)
+	}
+
+	sent := 0
+	for _, u := range users {
+		scheduled := lastDigestTime(u.prefs, now)
+		if u.lastDigestAt != nil && !u.lastDigestAt.Before(scheduled) {
+			continue
+		}
+		ok, err := s.send(ctx, u, now)
+		if err != nil {
+			if ctx.Err() != nil {
+				return sent, err
+			}
+			s.logger.Warn("Failed to send notification digest", zap.String("userId", u.id.String()), zap.Error(err))
+			continue
+		}
+		if ok {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// send sends one user's digest and records it as sent. It reports whether
+// there was anything to summarize.
+func (s *DigestService) send(ctx context.Context, u digestUser, now time.Time) (bool, error) {
+	digest, err := s.build(ctx, u.id, u.prefs, u.lastDigestAt, now)
+	if err != nil {
+		return false, err
+	}
+
+	// Recorded first, so a failed delivery isn't repeated every interval
+	_, err = s.db.Pool.Exec(ctx, `UPDATE users SET last_digest_at = $2 WHERE id = $1`, u.id, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to record digest: %w", err)
+	}
+	if digest.Total == 0 {
+		return false, nil
+	}
+
+	for _, org := range digest.Orgs {
+		n := &models.Notification{
+			UserID: u.id,
+			OrgID:  org.OrgID,
+			Type:   NotificationDigest,
+			Title:  fmt.Sprintf("Your %s digest: %s in %s", digest.Schedule, plural(org.Total, "update"), org.OrgName),
+		}
+		body := digestBody(org)
+		n.Body = &body
+		if err := s.notifications.Create(ctx, n); err != nil {
+			return true, err
+		}
+	}
+
+	// The email follows the global switch unless digests have their own
+	// channels
+	wantsEmail := u.prefs.Email
+	if chosen, ok := u.prefs.Types[NotificationDigest]; ok {
+		wantsEmail = slices.Contains(chosen, ChannelEmail)
+	}
+	if s.mail != nil && wantsEmail {
+		var body strings.Builder
+		for _, org := range digest.Orgs {
+			fmt.Fprintf(&body, "%s\n%s\n\n", org.OrgName, digestBody(org))
+		}
+		subject := fmt.Sprintf("Your %s GlassBox digest: %s", digest.Schedule, plural(digest.Total, "update"))
+		if err := s.mail(ctx, u.email, subject, body.String()); err != nil {
+			return true, fmt.Errorf("failed to email digest: %w", err)
+		}
+	}
+	return true, nil
+}
+
+// Preview returns what the user's next digest would contain if it were sent
+// now. Users without a schedule get a daily preview.
+func (s *DigestService) Preview(ctx context.Context, userID uuid.UUID) (*Digest, error) {
+	var prefsJSON []byte
+	var lastDigestAt *time.Time
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT settings->'notifications', last_digest_at FROM users WHERE id = $1
+	`, userID).Scan(&prefsJSON, &lastDigestAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	prefs, err := notificationPreferences(prefsJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	digest, err := s.build(ctx, userID, prefs, lastDigestAt, now)
+	if err != nil {
+		return nil, err
+	}
+	if digest.Schedule != "off" {
+		// A digest already due goes out on the next run
+		scheduled := lastDigestTime(prefs, now)
+		next := scheduled.Add(digestPeriod(prefs))
+		if lastDigestAt == nil || lastDigestAt.Before(scheduled) {
+			next = now
+		}
+		digest.NextAt = &next
+	}
+	return digest, nil
+}
+
+// build collects the user's unread low-priority notifications since their
+// last digest, or one period before now without one, grouped by org
+func (s *DigestService) build(ctx context.Context, userID uuid.UUID, prefs models.NotificationPreferences, lastDigestAt *time.Time, now time.Time) (*Digest, error) {
+	digest := &Digest{Schedule: prefs.Digest, Until: now, Orgs: []OrgDigest{}}
+	if digest.Schedule == "" {
+		digest.Schedule = "off"
+	}
+	digest.Since = now.Add(-digestPeriod(prefs))
+	if lastDigestAt != nil {
+		digest.Since = *lastDigestAt
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT n.org_id, o.name, n.type, n.title, n.count, n.resource_type, n.resource_id, n.created_at
+		FROM notifications n
+		JOIN organizations o ON o.id = n.org_id
+		WHERE n.user_id = $1 AND n.read_at IS NULL AND n.type = ANY($2)
+		  AND n.created_at > $3 AND n.created_at <= $4
+		ORDER BY o.name, o.id, n.created_at DESC
+	`, userID, digestTypes, digest.Since, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list digest notifications: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var orgID uuid.UUID
+		var orgName string
+		var item DigestItem
+		if err := rows.Scan(&orgID, &orgName, &item.Type, &item.Title, &item.Count,
+			&item.ResourceType, &item.ResourceID, &item.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan digest notification: %w", err)
+		}
+		if len(digest.Orgs) == 0 || digest.Orgs[len(digest.Orgs)-1].OrgID != orgID {
+			digest.Orgs = append(digest.Orgs, OrgDigest{OrgID: orgID, OrgName: orgName})
+		}
+		org := &digest.Orgs[len(digest.Orgs)-1]
+		org.Items = append(org.Items, item)
+		org.Total += item.Count
+		digest.Total += item.Count
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list digest notifications: %w", err)
+	}
+	return digest, nil
+}
+
+// digestPeriod is how long the user's digests cover
+func digestPeriod(prefs models.NotificationPreferences) time.Duration {
+	if prefs.Digest == "weekly" {
+		return 7 * 24 * time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// lastDigestTime is the latest time at or before now the user's digest was
+// scheduled: DigestHour UTC each day, or on DigestDay for weekly digests
+func lastDigestTime(prefs models.NotificationPreferences, now time.Time) time.Time {
+	now = now.UTC()
+	t := time.Date(now.Year(), now.Month(), now.Day(), prefs.DigestHour, 0, 0, 0, time.UTC)
+	if t.After(now) {
+		t = t.AddDate(0, 0, -1)
+	}
+	if prefs.Digest == "weekly" {
+		for int(t.Weekday()) != prefs.DigestDay {
+			t = t.AddDate(0, 0, -1)
+		}
+	}
+	return t
+}
+
+// digestBody counts an org's digest by type and lists its latest titles
+func digestBody(org OrgDigest) string {
+	counts := map[string]int{}
+	for _, item := range org.Items {
+		counts[item.Type] += item.Count
+	}
+	var parts []string
+	for _, kind := range digestTypes {
+		if counts[kind] > 0 {
+			parts = append(parts, plural(counts[kind], digestNouns[kind]))
+		}
+	}
+
+	lines := []string{strings.Join(parts, ", ")}
+	for i, item := range org.Items {
+		if i == digestListedItems {
+			lines = append(lines, fmt.Sprintf("and %d more", len(org.Items)-i))
+			break
+		}
+		lines = append(lines, "- "+item.Title)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// plural is "1 update" or "3 updates"
+func plural(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ErrInvalidSnapshot means a snapshot claims to cover updates that don't exist yet
+var ErrInvalidSnapshot = errors.New("snapshot covers unknown updates")
+
+// Sequence numbers are assigned before commit, so an update can become
+// visible after a higher-numbered one. Compaction keeps recent updates even
+// when the snapshot claims them; replaying one twice is harmless.
+const documentCompactionGrace = 10 * time.Second
+
+// DocumentService stores the CRDT update log behind collaboratively edited
+// node fields. Updates are opaque bytes produced by the client library
+// (Yjs/Automerge); applying them in any order yields the same document.
+// The server can't read them, so the field's column is only updated from
+// the text clients render when they compact.
+type DocumentService struct {
+	db     *database.DB
+	nodes  *NodeService
+	logger *zap.Logger
+}
+
+func NewDocumentService(db *database.DB, nodes *NodeService, logger *zap.Logger) *DocumentService {
+	return &DocumentService{db: db, nodes: nodes, logger: logger}
+}
+
+// LoadDocument returns the latest snapshot (if any) followed by the updates
+// not yet compacted into it, and the highest sequence number among them
+func (s *DocumentService) LoadDocument(ctx context.Context, nodeID uuid.UUID, field string) ([][]byte, int64, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, update_data FROM node_document_updates
+		WHERE node_id = $1 AND field = $2
+		  AND (NOT is_snapshot OR id = (
+		      SELECT MAX(id) FROM node_document_updates
+		      WHERE node_id = $1 AND field = $2 AND is_snapshot))
+		ORDER BY id
+	`, nodeID, field)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to load document: %w", err)
+	}
+	defer rows.Close()
+
+	updates := [][]byte{}
+	var seq int64
+	for rows.Next() {
+		var id int64
+		var data []byte
+		if err := rows.Scan(&id, &data); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan document update: %w", err)
+		}
+		updates = append(updates, data)
+		seq = max(seq, id)
+	}
+	return updates, seq, rows.Err()
+}
+
+// AppendDocumentUpdate stores an update and returns its sequence number
+func (s *DocumentService) AppendDocumentUpdate(ctx context.Context, nodeID uuid.UUID, field string, update []byte, userID uuid.UUID) (int64, error) {
+	var seq int64
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO node_document_updates (node_id, field, update_data, user_id)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, nodeID, field, update, userID).Scan(&seq)
+	if err != nil {
+		return 0, fmt.Errorf("failed to store document update: %w", err)
+	}
+	return seq, nil
+}
+
+// CompactDocument replaces the updates up to throughSeq with snapshot, the
+// client-merged state of those updates. Snapshots that are not newer than
+// the current one are ignored. text, when set, is the snapshot as plain
+// text; it's saved to the node's field with a versioned update, so REST
+// clients, search and history see collaborative edits.
+func (s *DocumentService) CompactDocument(ctx context.Context, nodeID uuid.UUID, field string, snapshot []byte, throughSeq int64, text *string, userID uuid.UUID) error {
+	tx, err := s.db.Pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize compactions of the same document
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended($1::text || ':' || $2, 0))`, nodeID, field); err != nil {
+		return fmt.Errorf("failed to lock document: %w", err)
+	}
+
+	var latestSeq, coveredSeq int64
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(MAX(id) FILTER (WHERE NOT is_snapshot), 0),
+		       COALESCE(MAX(covers_through) FILTER (WHERE is_snapshot), 0)
+		FROM node_document_updates
+		WHERE node_id = $1 AND field = $2
+	`, nodeID, field).Scan(&latestSeq, &coveredSeq)
+	if err != nil {
+		return fmt.Errorf("failed to read document: %w", err)
+	}
+	if throughSeq > latestSeq {
+		return ErrInvalidSnapshot
+	}
+	if throughSeq <= coveredSeq {
+		return nil
+	}
+
+	var snapshotID int64
+	err = tx.QueryRow(ctx, `
+		INSERT INTO node_document_updates (node_id, field, update_data, is_snapshot, covers_through, user_id)
+		VALUES ($1, $2, $3, TRUE, $4, $5)
+		RETURNING id
+	`, nodeID, field, snapshot, throughSeq, userID).Scan(&snapshotID)
+	if err != nil {
+		return fmt.Errorf("failed to store document snapshot: %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, `
+		DELETE FROM node_document_updates
+		WHERE node_id = $1 AND field = $2 AND id < $3
+		  AND (is_snapshot OR (id <= $4 AND created_at < $5))
+	`, nodeID, field, snapshotID, throughSeq, time.Now().Add(-documentCompactionGrace))
+	if err != nil {
+		return fmt.Errorf("failed to delete compacted updates: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit compaction: %w", err)
+	}
+
+	s.logger.Debug("Compacted document",
+		zap.String("nodeId", nodeID.String()),
+		zap.String("field", field),
+		zap.Int64("throughSeq", throughSeq),
+		zap.Int64("removed", tag.RowsAffected()),
+	)
+
+	if text == nil {
+		return nil
+	}
+	return s.saveText(ctx, nodeID, field, *text, userID)
+}
+
+// saveText writes a document's text to the node field it edits, unless
+// it's unchanged
+func (s *DocumentService) saveText(ctx context.Context, nodeID uuid.UUID, field, text string, userID uuid.UUID) error {
+	if field != "description" {
+		return fmt.Errorf("document field %q has no column", field)
+	}
+
+	var current *string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT description FROM nodes WHERE id = $1 AND deleted_at IS NULL
+	`, nodeID).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read node description: %w", err)
+	}
+	if current != nil && *current == text {
+		return nil
+	}
+
+	_, err = s.nodes.Update(ctx, nodeID, userID, UpdateNodeRequest{Description: &text, IgnoreLock: true})
+	return err
+}
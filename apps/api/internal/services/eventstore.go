@@ -0,0 +1,372 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/cache"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Event sourcing levels (organizations.event_sourcing_level)
+const (
+	// Every event carries the aggregate's full state
+	EventSourcingFull = "full"
+	// Events carry the fields that changed, with a full snapshot every
+	// snapshotInterval events
+	EventSourcingSnapshot = "snapshot"
+	// No events are recorded
+	EventSourcingOff = "off"
+)
+
+// Aggregate types with event streams
+const (
+	AggregateOrganization = "organization"
+	AggregateProject      = "project"
+	AggregateNode         = "node"
+	AggregateFile         = "file"
+)
+
+const (
+	snapshotInterval = 25
+
+	// How long an org's event sourcing level is cached. Changes take effect
+	// at once; the TTL only covers a missed notification.
+	eventLevelTTL = 5 * time.Minute
+)
+
+// DomainEvent is one recorded change to an aggregate. Data is the state
+// after the event, or with Patch a merge patch of the top-level fields that
+// changed (a null field was removed); a deletion has null Data.
+type DomainEvent struct {
+	ID            int64           `json:"id"`
+	OrgID         uuid.UUID       `json:"orgId"`
+	AggregateType string          `json:"aggregateType"`
+	AggregateID   uuid.UUID       `json:"aggregateId"`
+	Sequence      int             `json:"sequence"`
+	Type          string          `json:"type"`
+	Data          json.RawMessage `json:"data"`
+	Patch         bool            `json:"patch"`
+	ActorID       *uuid.UUID      `json:"actorId,omitempty"`
+	CreatedAt     time.Time       `json:"createdAt"`
+}
+
+// AggregateState is an aggregate's state rebuilt from its events
+type AggregateState struct {
+	AggregateType string          `json:"aggregateType"`
+	AggregateID   uuid.UUID       `json:"aggregateId"`
+	Sequence      int             `json:"sequence"`
+	State         json.RawMessage `json:"state"` // null once deleted
+}
+
+// EventStore is the append-only store of domain events. Services append an
+// event in the transaction that makes the change, so the history matches
+// what was committed; how much is recorded follows the org's
+// event_sourcing_level.
+type EventStore struct {
+	db     *database.DB
+	logger *zap.Logger
+
+	levels *cache.Local[uuid.UUID, string]
+}
+
+// NewEventStore creates an event store whose cache of org levels is kept
+// fresh by listener. With a nil listener levels aren't cached.
+func NewEventStore(db *database.DB, listener *database.Listener, logger *zap.Logger) *EventStore {
+	live := func() bool { return false }
+	if listener != nil {
+		live = listener.Connected
+	}
+	s := &EventStore{db: db, logger: logger, levels: cache.NewLocal[uuid.UUID, string](eventLevelTTL, live)}
+	if listener != nil {
+		listener.Subscribe(s)
+	}
+	return s
+}
+
+// Append records an event for an aggregate whose state after the change is
+// state (nil for a deletion). It must run in the transaction that made the
+// change.
+func (s *EventStore) Append(ctx context.Context, tx pgx.Tx, orgID uuid.UUID, aggregateType string, aggregateID uuid.UUID, eventType string, state any, actorID *uuid.UUID) error {
+	level, err := s.level(ctx, tx, orgID)
+	if err != nil {
+		return err
+	}
+	if level == EventSourcingOff {
+		return nil
+	}
+
+	var stateJSON []byte
+	if state != nil {
+		if stateJSON, err = json.Marshal(state); err != nil {
+			return fmt.Errorf("failed to marshal event state: %w", err)
+		}
+	}
+
+	// Lock the stream so events get consecutive sequence numbers
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO event_streams (aggregate_type, aggregate_id, org_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+	`, aggregateType, aggregateID, orgID); err != nil {
+		return fmt.Errorf("failed to create event stream: %w", err)
+	}
+	var sequence int
+	var previous []byte
+	if err := tx.QueryRow(ctx, `
+		SELECT sequence, state FROM event_streams
+		WHERE aggregate_type = $1 AND aggregate_id = $2
+		FOR UPDATE
+	`, aggregateType, aggregateID).Scan(&sequence, &previous); err != nil {
+		return fmt.Errorf("failed to lock event stream: %w", err)
+	}
+	sequence++
+
+	// In snapshot mode record only what changed, once there's a state to
+	// compare with
+	data, patch := stateJSON, false
+	if level == EventSourcingSnapshot && previous != nil && stateJSON != nil {
+		if data, err = mergePatch(previous, stateJSON); err != nil {
+			return err
+		}
+		patch = true
+	}
+
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO domain_events (org_id, aggregate_type, aggregate_id, sequence, event_type, data, is_patch, actor_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, orgID, aggregateType, aggregateID, sequence, eventType, data, patch, actorID); err != nil {
+		return fmt.Errorf("failed to append event: %w", err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE event_streams SET sequence = $3, state = $4, updated_at = NOW()
+		WHERE aggregate_type = $1 AND aggregate_id = $2
+	`, aggregateType, aggregateID, sequence, stateJSON); err != nil {
+		return fmt.Errorf("failed to update event stream: %w", err)
+	}
+
+	if level == EventSourcingSnapshot && sequence%snapshotInterval == 0 {
+		if _, err := tx.Exec(ctx, `
+			INSERT INTO aggregate_snapshots (aggregate_type, aggregate_id, sequence, org_id, state)
+			VALUES ($1, $2, $3, $4, $5)
+		`, aggregateType, aggregateID, sequence, orgID, stateJSON); err != nil {
+			return fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	return nil
+}
+
+// level returns the org's event sourcing level, cached for eventLevelTTL
+func (s *EventStore) level(ctx context.Context, tx pgx.Tx, orgID uuid.UUID) (string, error) {
+	return s.levels.Load(orgID, func() (string, error) {
+		var level string
+		err := tx.QueryRow(ctx, `SELECT event_sourcing_level FROM organizations WHERE id = $1`, orgID).Scan(&level)
+		if err != nil {
+			return "", fmt.Errorf("failed to get event sourcing level: %w", err)
+		}
+		return level, nil
+	})
+}
+
+// forgetLevel drops the cached event sourcing level of an org whose level
+// may have changed
+func (s *EventStore) forgetLevel(orgID uuid.UUID) {
+	s.levels.Delete(orgID)
+}
+
+// Invalidate drops the cached level of an org that changed
+func (s *EventStore) Invalidate(change database.RowChange) {
+	if change.Table == "organizations" {
+		s.levels.Delete(change.OrgID)
+	}
+}
+
+// InvalidateAll drops every cached level
+func (s *EventStore) InvalidateAll() {
+	s.levels.Clear()
+}
+
+// List returns a page of an aggregate's events in order
+func (s *EventStore) List(ctx context.Context, aggregateType string, aggregateID uuid.UUID, page pagination.Params) (*pagination.Page[DomainEvent], error) {
+	afterSequence, _, err := page.AfterInt()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT id, org_id, aggregate_type, aggregate_id, sequence, event_type, data, is_patch, actor_id, created_at
+		FROM domain_events
+		WHERE aggregate_type = $1 AND aggregate_id = $2
+		  AND ($3::INT IS NULL OR sequence > $3)
+		ORDER BY sequence
+		LIMIT $4
+	`, aggregateType, aggregateID, afterSequence, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []DomainEvent
+	for rows.Next() {
+		var e DomainEvent
+		if err := rows.Scan(&e.ID, &e.OrgID, &e.AggregateType, &e.AggregateID, &e.Sequence,
+			&e.Type, &e.Data, &e.Patch, &e.ActorID, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+
+	result := pagination.NewPage(events, limit, func(e DomainEvent) pagination.Cursor {
+		return pagination.IntCursor(e.Sequence, e.AggregateID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM domain_events WHERE aggregate_type = $1 AND aggregate_id = $2
+	`, aggregateType, aggregateID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count events: %w", err)
+	}
+	return result, nil
+}
+
+// Replay rebuilds an aggregate's state as of an event sequence number, or
+// its latest state when sequence is 0. It starts from the nearest snapshot
+// or full-state event and applies the patches after it. Returns ErrNotFound
+// when the aggregate has no events up to sequence.
+func (s *EventStore) Replay(ctx context.Context, aggregateType string, aggregateID uuid.UUID, sequence int) (*AggregateState, error) {
+	// Both queries read the primary, so a replay right after a change sees it
+	upTo := sequence
+	if upTo <= 0 {
+		err := s.db.Pool.QueryRow(ctx, `
+			SELECT COALESCE(MAX(sequence), 0) FROM domain_events
+			WHERE aggregate_type = $1 AND aggregate_id = $2
+		`, aggregateType, aggregateID).Scan(&upTo)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find latest event: %w", err)
+		}
+	}
+
+	// The latest full state at or before upTo
+	var from int
+	var state []byte
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT sequence, state FROM (
+			SELECT sequence, state FROM aggregate_snapshots
+			WHERE aggregate_type = $1 AND aggregate_id = $2 AND sequence <= $3
+			UNION ALL
+			SELECT sequence, data FROM domain_events
+			WHERE aggregate_type = $1 AND aggregate_id = $2 AND sequence <= $3 AND NOT is_patch
+		) full_states
+		ORDER BY sequence DESC
+		LIMIT 1
+	`, aggregateType, aggregateID, upTo).Scan(&from, &state)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find replay start: %w", err)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT data, is_patch FROM domain_events
+		WHERE aggregate_type = $1 AND aggregate_id = $2 AND sequence > $3 AND sequence <= $4
+		ORDER BY sequence
+	`, aggregateType, aggregateID, from, upTo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var data []byte
+		var patch bool
+		if err := rows.Scan(&data, &patch); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		if !patch || data == nil || state == nil {
+			state = data
+			continue
+		}
+		if state, err = applyMergePatch(state, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read events: %w", err)
+	}
+
+	if state == nil {
+		state = []byte("null")
+	}
+	return &AggregateState{
+		AggregateType: aggregateType,
+		AggregateID:   aggregateID,
+		Sequence:      upTo,
+		State:         state,
+	}, nil
+}
+
+// mergePatch returns the top-level fields of after that differ from
+// before, with removed fields set to null
+func mergePatch(before, after []byte) ([]byte, error) {
+	var b, a map[string]json.RawMessage
+	if err := json.Unmarshal(before, &b); err != nil {
+		return nil, fmt.Errorf("failed to decode previous state: %w", err)
+	}
+	if err := json.Unmarshal(after, &a); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	patch := make(map[string]json.RawMessage)
+	for k, v := range a {
+		if old, ok := b[k]; !ok || !jsonEqual(old, v) {
+			patch[k] = v
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			patch[k] = json.RawMessage("null")
+		}
+	}
+	return json.Marshal(patch)
+}
+
+// applyMergePatch applies a patch made by mergePatch
+func applyMergePatch(state, patch []byte) ([]byte, error) {
+	var s, p map[string]json.RawMessage
+	if err := json.Unmarshal(state, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	if err := json.Unmarshal(patch, &p); err != nil {
+		return nil, fmt.Errorf("failed to decode patch: %w", err)
+	}
+	for k, v := range p {
+		if bytes.Equal(v, []byte("null")) {
+			delete(s, k)
+		} else {
+			s[k] = v
+		}
+	}
+	return json.Marshal(s)
+}
+
+// jsonEqual compares two JSON values, ignoring formatting. Postgres
+// reformats JSONB, so stored and freshly marshalled values differ in bytes.
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return bytes.Equal(a, b)
+	}
+	xb, _ := json.Marshal(x)
+	yb, _ := json.Marshal(y)
+	return bytes.Equal(xb, yb)
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/glassbox/api/internal/config"
 	"github.com/glassbox/api/internal/database"
 	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/repository"
+	"github.com/glassbox/api/internal/telemetry"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
 	"go.uber.org/zap"
@@ -17,19 +20,20 @@ import (
 
 // Execution-specific errors
 var (
-	ErrExecutionAlreadyActive = errors.New("an execution is already active for this node")
-	ErrExecutionNotPausable   = errors.New("execution cannot be paused in its current state")
-	ErrExecutionNotResumable  = errors.New("execution cannot be resumed in its current state")
-	ErrExecutionNotCancellable = errors.New("execution cannot be cancelled in its current state")
+	ErrExecutionAlreadyActive    = errors.New("an execution is already active for this node")
+	ErrExecutionNotPausable      = errors.New("execution cannot be paused in its current state")
+	ErrExecutionNotResumable     = errors.New("execution cannot be resumed in its current state")
+	ErrExecutionNotCancellable   = errors.New("execution cannot be cancelled in its current state")
 	ErrExecutionNotAwaitingInput = errors.New("execution is not awaiting input")
 )
 
 // Active execution statuses
-var activeStatuses = []string{"pending", "running", "paused", "awaiting_input"}
+var activeStatuses = repository.ActiveStatuses
 
-// AgentQueueClient interface for dispatching agent jobs
+// AgentQueueClient interface for dispatching agent jobs. Jobs are written to
+// the outbox in the caller's transaction and sent once it commits.
 type AgentQueueClient interface {
-	DispatchAgentJob(ctx context.Context, job any) error
+	EnqueueAgentJob(ctx context.Context, tx pgx.Tx, job any) error
 }
 
 // AgentJobMessage is the message sent to the agent queue
@@ -38,6 +42,15 @@ type AgentJobMessage struct {
 	NodeID      uuid.UUID      `json:"nodeId"`
 	OrgID       uuid.UUID      `json:"orgId"`
 	OrgConfig   map[string]any `json:"orgConfig,omitempty"`
+
+	// Priority is the execution's priority, which picks its agent queue
+	Priority string `json:"priority"`
+
+	// Attempt is the execution's dispatch_attempts after this dispatch
+	Attempt int `json:"attempt"`
+
+	// TraceContext carries the W3C trace context of the request that started the execution
+	TraceContext map[string]string `json:"traceContext,omitempty"`
 }
 
 // HumanInputRequest represents a request for human input from the agent
@@ -50,29 +63,47 @@ type HumanInputRequest struct {
 
 // ExecutionCheckpoint stores the state for pause/resume
 type ExecutionCheckpoint struct {
-	Messages          []map[string]any `json:"messages,omitempty"`
-	Iteration         int              `json:"iteration"`
-	PendingToolResults []map[string]any `json:"pendingToolResults,omitempty"`
+	Messages           []map[string]any   `json:"messages,omitempty"`
+	Iteration          int                `json:"iteration"`
+	PendingToolResults []map[string]any   `json:"pendingToolResults,omitempty"`
 	HumanInputRequest  *HumanInputRequest `json:"humanInputRequest,omitempty"`
-	HumanInputResponse map[string]any   `json:"humanInputResponse,omitempty"`
+	HumanInputResponse map[string]any     `json:"humanInputResponse,omitempty"`
 }
 
 // ExecutionServiceFull extends ExecutionService with SQS client
 type ExecutionServiceFull struct {
-	db     *database.DB
-	redis  *database.Redis
-	sqs    AgentQueueClient
-	cfg    *config.Config
-	logger *zap.Logger
+	db         *database.DB
+	executions repository.ExecutionRepo
+	nodes      repository.NodeRepo
+	redis      *database.Redis
+	sqs        AgentQueueClient
+	resolver   *ConfigResolver
+	cfg        *config.Config
+	logger     *zap.Logger
 }
 
 // NewExecutionServiceFull creates a new execution service with SQS support
-func NewExecutionServiceFull(db *database.DB, redis *database.Redis, sqs AgentQueueClient, cfg *config.Config, logger *zap.Logger) *ExecutionServiceFull {
-	return &ExecutionServiceFull{db: db, redis: redis, sqs: sqs, cfg: cfg, logger: logger}
+func NewExecutionServiceFull(db *database.DB, executions repository.ExecutionRepo, nodes repository.NodeRepo, redis *database.Redis, sqs AgentQueueClient, resolver *ConfigResolver, cfg *config.Config, logger *zap.Logger) *ExecutionServiceFull {
+	return &ExecutionServiceFull{db: db, executions: executions, nodes: nodes, redis: redis, sqs: sqs, resolver: resolver, cfg: cfg, logger: logger}
 }
 
-// Start creates a new execution for a node and dispatches it to the agent queue
-func (s *ExecutionServiceFull) Start(ctx context.Context, nodeID, userID uuid.UUID) (*models.AgentExecution, error) {
+// Execution priorities. Interactive executions, which a user is waiting on,
+// are queued apart from batch ones so a batch backlog can't delay them.
+const (
+	PriorityInteractive = "interactive"
+	PriorityBatch       = "batch"
+)
+
+// Start creates a new execution for a node and dispatches it to the agent
+// queue for its priority; an empty priority means interactive. override,
+// when set, is the execution layer of the agent config; the config the
+// ConfigResolver resolves is kept on the execution for its resumes. An
+// override naming unknown models or tools is a *TemplateStructureError.
+func (s *ExecutionServiceFull) Start(ctx context.Context, nodeID, userID uuid.UUID, priority string, override *models.AgentConfig) (*models.AgentExecution, error) {
+	if priority == "" {
+		priority = PriorityInteractive
+	}
+
 	// Verify node exists and user has access
 	var orgID uuid.UUID
 	var orgSettingsJSON []byte
@@ -92,19 +123,12 @@ func (s *ExecutionServiceFull) Start(ctx context.Context, nodeID, userID uuid.UU
 	}
 
 	// Check for existing active execution
-	var existingID uuid.UUID
-	err = s.db.Pool.QueryRow(ctx, `
-		SELECT id FROM agent_executions
-		WHERE node_id = $1 AND status = ANY($2)
-		ORDER BY created_at DESC
-		LIMIT 1
-	`, nodeID, activeStatuses).Scan(&existingID)
-
+	_, err = s.executions.Active(ctx, nodeID)
 	if err == nil {
 		return nil, ErrExecutionAlreadyActive
 	}
-	if !errors.Is(err, pgx.ErrNoRows) {
-		return nil, fmt.Errorf("failed to check existing executions: %w", err)
+	if !errors.Is(err, ErrNotFound) {
+		return nil, err
 	}
 
 	// Create execution record
@@ -112,53 +136,79 @@ func (s *ExecutionServiceFull) Start(ctx context.Context, nodeID, userID uuid.UU
 		ID:        uuid.New(),
 		NodeID:    nodeID,
 		Status:    "pending",
+		Priority:  priority,
 		CreatedAt: time.Now(),
 	}
 
-	err = s.db.Pool.QueryRow(ctx, `
-		INSERT INTO agent_executions (id, node_id, status)
-		VALUES ($1, $2, $3)
-		RETURNING created_at
-	`, execution.ID, execution.NodeID, execution.Status).Scan(&execution.CreatedAt)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to create execution: %w", err)
+	if override != nil {
+		agentModels, err := agentModelsFor(ctx, s.db.Pool, s.cfg.AgentModels, &orgID)
+		if err != nil {
+			return nil, err
+		}
+		check := &templateCheck{}
+		check.checkAgentConfig(agentModels, *override)
+		if err := check.err(); err != nil {
+			return nil, err
+		}
 	}
 
-	// Parse org settings for config
-	var orgSettings models.OrganizationSettings
-	if orgSettingsJSON != nil {
-		json.Unmarshal(orgSettingsJSON, &orgSettings)
-	}
+	effective, err := s.resolver.Resolve(ctx, nodeID, override)
+	if err != nil {
+		return nil, err
+	}
+	effectiveJSON, _ := json.Marshal(effective)
+	orgConfig := jobConfig(orgSettingsJSON, effective)
+
+	// Create the execution and queue its job together, so a crash can't
+	// strand a pending execution that was never dispatched. The active check
+	// is repeated in a serializable transaction: of two concurrent starts,
+	// one fails to serialize and, retried, finds the other's execution.
+	err = s.db.WithTransactionOptions(ctx, database.TxOptions{Isolation: pgx.Serializable}, func(tx pgx.Tx) error {
+		var active bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM agent_executions WHERE node_id = $1 AND status = ANY($2))
+		`, nodeID, activeStatuses).Scan(&active)
+		if err != nil {
+			return fmt.Errorf("failed to check for active execution: %w", err)
+		}
+		if active {
+			return ErrExecutionAlreadyActive
+		}
 
-	// Build org config for the worker
-	orgConfig := map[string]any{}
-	if orgSettings.DefaultModel != "" {
-		orgConfig["defaultModel"] = orgSettings.DefaultModel
-	}
-	if len(orgSettings.Models) > 0 {
-		orgConfig["models"] = orgSettings.Models
-	}
+		err = tx.QueryRow(ctx, `
+			INSERT INTO agent_executions (id, node_id, status, priority, dispatch_attempts, agent_config, started_by)
+			VALUES ($1, $2, $3, $4, 1, $5, $6)
+			RETURNING created_at
+		`, execution.ID, execution.NodeID, execution.Status, execution.Priority, effectiveJSON, userID).Scan(&execution.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create execution: %w", err)
+		}
+		if err := recordOnboarding(ctx, tx, userID, OnboardingRanAgent); err != nil {
+			return err
+		}
 
-	// Dispatch to agent queue
-	err = s.sqs.DispatchAgentJob(ctx, AgentJobMessage{
-		ExecutionID: execution.ID,
-		NodeID:      nodeID,
-		OrgID:       orgID,
-		OrgConfig:   orgConfig,
+		err = s.sqs.EnqueueAgentJob(ctx, tx, AgentJobMessage{
+			ExecutionID:  execution.ID,
+			NodeID:       nodeID,
+			OrgID:        orgID,
+			OrgConfig:    orgConfig,
+			Priority:     priority,
+			Attempt:      1,
+			TraceContext: telemetry.InjectContext(ctx),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to queue execution job: %w", err)
+		}
+		return nil
 	})
 	if err != nil {
-		// Update execution status to failed since we couldn't dispatch
-		s.db.Pool.Exec(ctx, `
-			UPDATE agent_executions SET status = 'failed', error_message = $2
-			WHERE id = $1
-		`, execution.ID, "Failed to dispatch job: "+err.Error())
-		return nil, fmt.Errorf("failed to dispatch execution job: %w", err)
+		return nil, err
 	}
 
 	s.logger.Info("Started execution",
 		zap.String("executionId", execution.ID.String()),
 		zap.String("nodeId", nodeID.String()),
+		zap.String("priority", priority),
 	)
 
 	return execution, nil
@@ -166,35 +216,11 @@ func (s *ExecutionServiceFull) Start(ctx context.Context, nodeID, userID uuid.UU
 
 // GetByID returns an execution by ID
 func (s *ExecutionServiceFull) GetByID(ctx context.Context, executionID, userID uuid.UUID) (*models.AgentExecution, error) {
-	var exec models.AgentExecution
-	var traceSummaryJSON, checkpointJSON []byte
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT e.id, e.node_id, e.status, e.langgraph_thread_id, e.trace_summary,
-		       e.langgraph_checkpoint, e.started_at, e.completed_at, e.error_message,
-		       e.total_tokens_in, e.total_tokens_out, e.estimated_cost_usd, e.model_id, e.created_at
-		FROM agent_executions e
-		JOIN nodes n ON e.node_id = n.id
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE e.id = $1 AND om.user_id = $2
-	`, executionID, userID).Scan(
-		&exec.ID, &exec.NodeID, &exec.Status, &exec.LanggraphThreadID, &traceSummaryJSON,
-		&checkpointJSON, &exec.StartedAt, &exec.CompletedAt, &exec.ErrorMessage,
-		&exec.TotalTokensIn, &exec.TotalTokensOut, &exec.EstimatedCostUSD, &exec.ModelID, &exec.CreatedAt,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	exec, err := s.executions.Get(ctx, executionID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get execution: %w", err)
+		return nil, err
 	}
-
-	if traceSummaryJSON != nil {
-		json.Unmarshal(traceSummaryJSON, &exec.TraceSummary)
-	}
-
-	return &exec, nil
+	return &exec.AgentExecution, nil
 }
 
 // ExecutionWithHumanInput extends AgentExecution with HITL fields
@@ -206,159 +232,92 @@ type ExecutionWithHumanInput struct {
 
 // GetByIDWithHumanInput returns an execution with human input fields extracted from checkpoint
 func (s *ExecutionServiceFull) GetByIDWithHumanInput(ctx context.Context, executionID, userID uuid.UUID) (*ExecutionWithHumanInput, error) {
-	var exec ExecutionWithHumanInput
-	var traceSummaryJSON, checkpointJSON []byte
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT e.id, e.node_id, e.status, e.langgraph_thread_id, e.trace_summary,
-		       e.langgraph_checkpoint, e.started_at, e.completed_at, e.error_message,
-		       e.total_tokens_in, e.total_tokens_out, e.estimated_cost_usd, e.model_id, e.created_at
-		FROM agent_executions e
-		JOIN nodes n ON e.node_id = n.id
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE e.id = $1 AND om.user_id = $2
-	`, executionID, userID).Scan(
-		&exec.ID, &exec.NodeID, &exec.Status, &exec.LanggraphThreadID, &traceSummaryJSON,
-		&checkpointJSON, &exec.StartedAt, &exec.CompletedAt, &exec.ErrorMessage,
-		&exec.TotalTokensIn, &exec.TotalTokensOut, &exec.EstimatedCostUSD, &exec.ModelID, &exec.CreatedAt,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	exec, err := s.executions.Get(ctx, executionID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get execution: %w", err)
-	}
-
-	if traceSummaryJSON != nil {
-		json.Unmarshal(traceSummaryJSON, &exec.TraceSummary)
-	}
-
-	// Extract human input fields from checkpoint
-	if checkpointJSON != nil {
-		var checkpoint ExecutionCheckpoint
-		if json.Unmarshal(checkpointJSON, &checkpoint) == nil {
-			exec.HumanInputRequest = checkpoint.HumanInputRequest
-			exec.HumanInputResponse = checkpoint.HumanInputResponse
-		}
+		return nil, err
 	}
-
-	return &exec, nil
+	return withHumanInput(exec), nil
 }
 
 // GetCurrentForNode returns the current active execution for a node
 func (s *ExecutionServiceFull) GetCurrentForNode(ctx context.Context, nodeID, userID uuid.UUID) (*ExecutionWithHumanInput, error) {
 	// Verify user has access to the node
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM nodes n
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-		)
-	`, nodeID, userID).Scan(&exists)
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
 	}
-	if !exists {
+	if !visible {
 		return nil, ErrNotFound
 	}
 
-	var exec ExecutionWithHumanInput
-	var traceSummaryJSON, checkpointJSON []byte
-
-	err = s.db.Pool.QueryRow(ctx, `
-		SELECT id, node_id, status, langgraph_thread_id, trace_summary, langgraph_checkpoint,
-		       started_at, completed_at, error_message, total_tokens_in, total_tokens_out,
-		       estimated_cost_usd, model_id, created_at
-		FROM agent_executions
-		WHERE node_id = $1 AND status = ANY($2)
-		ORDER BY created_at DESC
-		LIMIT 1
-	`, nodeID, activeStatuses).Scan(
-		&exec.ID, &exec.NodeID, &exec.Status, &exec.LanggraphThreadID, &traceSummaryJSON,
-		&checkpointJSON, &exec.StartedAt, &exec.CompletedAt, &exec.ErrorMessage,
-		&exec.TotalTokensIn, &exec.TotalTokensOut, &exec.EstimatedCostUSD, &exec.ModelID, &exec.CreatedAt,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	exec, err := s.executions.Active(ctx, nodeID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get current execution: %w", err)
-	}
-
-	if traceSummaryJSON != nil {
-		json.Unmarshal(traceSummaryJSON, &exec.TraceSummary)
+		return nil, err
 	}
+	return withHumanInput(exec), nil
+}
 
-	// Extract human input fields from checkpoint
-	if checkpointJSON != nil {
+// withHumanInput extracts an execution's human input fields from its checkpoint
+func withHumanInput(exec *repository.Execution) *ExecutionWithHumanInput {
+	result := &ExecutionWithHumanInput{AgentExecution: exec.AgentExecution}
+	if exec.Checkpoint != nil {
 		var checkpoint ExecutionCheckpoint
-		if json.Unmarshal(checkpointJSON, &checkpoint) == nil {
-			exec.HumanInputRequest = checkpoint.HumanInputRequest
-			exec.HumanInputResponse = checkpoint.HumanInputResponse
+		if json.Unmarshal(exec.Checkpoint, &checkpoint) == nil {
+			result.HumanInputRequest = checkpoint.HumanInputRequest
+			result.HumanInputResponse = checkpoint.HumanInputResponse
 		}
 	}
-
-	return &exec, nil
+	return result
 }
 
 // Pause pauses an active execution
 func (s *ExecutionServiceFull) Pause(ctx context.Context, nodeID, userID uuid.UUID) error {
 	// Get current execution and verify access
-	var execID uuid.UUID
-	var status string
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT e.id, e.status
-		FROM agent_executions e
-		JOIN nodes n ON e.node_id = n.id
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE e.node_id = $1 AND om.user_id = $2 AND e.status = ANY($3)
-		ORDER BY e.created_at DESC
-		LIMIT 1
-	`, nodeID, userID, activeStatuses).Scan(&execID, &status)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return ErrNotFound
-	}
+	exec, err := s.activeExecution(ctx, nodeID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get execution: %w", err)
+		return err
 	}
 
 	// Can only pause from 'running' status
-	if status != "running" {
+	if exec.Status != "running" {
 		return ErrExecutionNotPausable
 	}
 
 	// Update status to paused - the worker will checkpoint on next iteration
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE agent_executions SET status = 'paused'
-		WHERE id = $1 AND status = 'running'
-	`, execID)
+	paused, err := s.executions.Pause(ctx, exec.ID)
 	if err != nil {
-		return fmt.Errorf("failed to pause execution: %w", err)
+		return err
 	}
-
-	if result.RowsAffected() == 0 {
+	if !paused {
 		return ErrExecutionNotPausable
 	}
 
-	s.logger.Info("Paused execution", zap.String("executionId", execID.String()))
+	s.logger.Info("Paused execution", zap.String("executionId", exec.ID.String()))
 	return nil
 }
 
+// activeExecution returns the active execution of a node the user can access
+func (s *ExecutionServiceFull) activeExecution(ctx context.Context, nodeID, userID uuid.UUID) (*repository.Execution, error) {
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, true)
+	if err != nil {
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrNotFound
+	}
+	return s.executions.Active(ctx, nodeID)
+}
+
 // Resume resumes a paused execution
 func (s *ExecutionServiceFull) Resume(ctx context.Context, nodeID, userID uuid.UUID) error {
 	// Get current execution and verify access
 	var execID uuid.UUID
 	var orgID uuid.UUID
 	var status string
-	var orgSettingsJSON []byte
+	var orgSettingsJSON, effectiveJSON []byte
 
 	err := s.db.Pool.QueryRow(ctx, `
-		SELECT e.id, e.status, n.org_id, o.settings
+		SELECT e.id, e.status, n.org_id, o.settings, e.agent_config
 		FROM agent_executions e
 		JOIN nodes n ON e.node_id = n.id
 		JOIN organizations o ON n.org_id = o.id
@@ -366,7 +325,7 @@ func (s *ExecutionServiceFull) Resume(ctx context.Context, nodeID, userID uuid.U
 		WHERE e.node_id = $1 AND om.user_id = $2 AND e.status = ANY($3)
 		ORDER BY e.created_at DESC
 		LIMIT 1
-	`, nodeID, userID, activeStatuses).Scan(&execID, &status, &orgID, &orgSettingsJSON)
+	`, nodeID, userID, activeStatuses).Scan(&execID, &status, &orgID, &orgSettingsJSON, &effectiveJSON)
 
 	if errors.Is(err, pgx.ErrNoRows) {
 		return ErrNotFound
@@ -380,41 +339,46 @@ func (s *ExecutionServiceFull) Resume(ctx context.Context, nodeID, userID uuid.U
 		return ErrExecutionNotResumable
 	}
 
-	// Update status back to running
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE agent_executions SET status = 'running'
-		WHERE id = $1 AND status = 'paused'
-	`, execID)
+	effective, err := s.executionConfig(ctx, nodeID, effectiveJSON)
 	if err != nil {
-		return fmt.Errorf("failed to resume execution: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return ErrExecutionNotResumable
-	}
-
-	// Parse org settings for config
-	var orgSettings models.OrganizationSettings
-	if orgSettingsJSON != nil {
-		json.Unmarshal(orgSettingsJSON, &orgSettings)
-	}
-
-	orgConfig := map[string]any{}
-	if orgSettings.DefaultModel != "" {
-		orgConfig["defaultModel"] = orgSettings.DefaultModel
-	}
+		return err
+	}
+	orgConfig := jobConfig(orgSettingsJSON, effective)
+
+	// Update status back to running and re-queue the job (worker will pick
+	// up from checkpoint)
+	err = s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var attempt int
+		var priority string
+		err := tx.QueryRow(ctx, `
+			UPDATE agent_executions
+			SET status = 'running', dispatch_attempts = dispatch_attempts + 1
+			WHERE id = $1 AND status = 'paused'
+			RETURNING dispatch_attempts, priority
+		`, execID).Scan(&attempt, &priority)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrExecutionNotResumable
+		}
+		if err != nil {
+			return fmt.Errorf("failed to resume execution: %w", err)
+		}
 
-	// Re-dispatch to agent queue (worker will pick up from checkpoint)
-	err = s.sqs.DispatchAgentJob(ctx, AgentJobMessage{
-		ExecutionID: execID,
-		NodeID:      nodeID,
-		OrgID:       orgID,
-		OrgConfig:   orgConfig,
+		err = s.sqs.EnqueueAgentJob(ctx, tx, AgentJobMessage{
+			ExecutionID:  execID,
+			NodeID:       nodeID,
+			OrgID:        orgID,
+			OrgConfig:    orgConfig,
+			Priority:     priority,
+			Attempt:      attempt,
+			TraceContext: telemetry.InjectContext(ctx),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to queue resume job: %w", err)
+		}
+		return nil
 	})
 	if err != nil {
-		// Revert status back to paused
-		s.db.Pool.Exec(ctx, `UPDATE agent_executions SET status = 'paused' WHERE id = $1`, execID)
-		return fmt.Errorf("failed to dispatch resume job: %w", err)
+		return err
 	}
 
 	s.logger.Info("Resumed execution", zap.String("executionId", execID.String()))
@@ -424,40 +388,21 @@ func (s *ExecutionServiceFull) Resume(ctx context.Context, nodeID, userID uuid.U
 // Cancel cancels an active execution
 func (s *ExecutionServiceFull) Cancel(ctx context.Context, nodeID, userID uuid.UUID) error {
 	// Get current execution and verify access
-	var execID uuid.UUID
-	var status string
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT e.id, e.status
-		FROM agent_executions e
-		JOIN nodes n ON e.node_id = n.id
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE e.node_id = $1 AND om.user_id = $2 AND e.status = ANY($3)
-		ORDER BY e.created_at DESC
-		LIMIT 1
-	`, nodeID, userID, activeStatuses).Scan(&execID, &status)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return ErrNotFound
-	}
+	exec, err := s.activeExecution(ctx, nodeID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to get execution: %w", err)
+		return err
 	}
 
 	// Update status to cancelled
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE agent_executions SET status = 'cancelled', completed_at = NOW()
-		WHERE id = $1 AND status = ANY($2)
-	`, execID, activeStatuses)
+	cancelled, err := s.executions.Cancel(ctx, exec.ID)
 	if err != nil {
-		return fmt.Errorf("failed to cancel execution: %w", err)
+		return err
 	}
-
-	if result.RowsAffected() == 0 {
+	if !cancelled {
 		return ErrExecutionNotCancellable
 	}
 
-	s.logger.Info("Cancelled execution", zap.String("executionId", execID.String()))
+	s.logger.Info("Cancelled execution", zap.String("executionId", exec.ID.String()))
 	return nil
 }
 
@@ -496,41 +441,55 @@ func (s *ExecutionServiceFull) ProvideInput(ctx context.Context, executionID, us
 
 	newCheckpointJSON, _ := json.Marshal(checkpoint)
 
-	// Update execution with input and change status to running
-	_, err = s.db.Pool.Exec(ctx, `
-		UPDATE agent_executions
-		SET status = 'running', langgraph_checkpoint = $2
-		WHERE id = $1
-	`, executionID, newCheckpointJSON)
+	// Get org settings and the execution's agent config for the job
+	var orgSettingsJSON, effectiveJSON []byte
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT o.settings, e.agent_config
+		FROM agent_executions e
+		JOIN nodes n ON e.node_id = n.id
+		JOIN organizations o ON n.org_id = o.id
+		WHERE e.id = $1
+	`, executionID).Scan(&orgSettingsJSON, &effectiveJSON)
 	if err != nil {
-		return fmt.Errorf("failed to update execution: %w", err)
-	}
-
-	// Get org settings for config
-	var orgSettingsJSON []byte
-	s.db.Pool.QueryRow(ctx, `SELECT settings FROM organizations WHERE id = $1`, orgID).Scan(&orgSettingsJSON)
-
-	var orgSettings models.OrganizationSettings
-	if orgSettingsJSON != nil {
-		json.Unmarshal(orgSettingsJSON, &orgSettings)
-	}
-
-	orgConfig := map[string]any{}
-	if orgSettings.DefaultModel != "" {
-		orgConfig["defaultModel"] = orgSettings.DefaultModel
+		return fmt.Errorf("failed to get execution config: %w", err)
 	}
+	effective, err := s.executionConfig(ctx, nodeID, effectiveJSON)
+	if err != nil {
+		return err
+	}
+	orgConfig := jobConfig(orgSettingsJSON, effective)
+
+	// Update execution with input, change status to running and re-queue
+	// the job
+	err = s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var attempt int
+		var priority string
+		err := tx.QueryRow(ctx, `
+			UPDATE agent_executions
+			SET status = 'running', langgraph_checkpoint = $2, dispatch_attempts = dispatch_attempts + 1
+			WHERE id = $1
+			RETURNING dispatch_attempts, priority
+		`, executionID, newCheckpointJSON).Scan(&attempt, &priority)
+		if err != nil {
+			return fmt.Errorf("failed to update execution: %w", err)
+		}
 
-	// Re-dispatch to agent queue
-	err = s.sqs.DispatchAgentJob(ctx, AgentJobMessage{
-		ExecutionID: executionID,
-		NodeID:      nodeID,
-		OrgID:       orgID,
-		OrgConfig:   orgConfig,
+		err = s.sqs.EnqueueAgentJob(ctx, tx, AgentJobMessage{
+			ExecutionID:  executionID,
+			NodeID:       nodeID,
+			OrgID:        orgID,
+			OrgConfig:    orgConfig,
+			Priority:     priority,
+			Attempt:      attempt,
+			TraceContext: telemetry.InjectContext(ctx),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to queue job after input: %w", err)
+		}
+		return nil
 	})
 	if err != nil {
-		// Revert status
-		s.db.Pool.Exec(ctx, `UPDATE agent_executions SET status = 'awaiting_input' WHERE id = $1`, executionID)
-		return fmt.Errorf("failed to dispatch job after input: %w", err)
+		return err
 	}
 
 	s.logger.Info("Provided human input",
@@ -539,55 +498,40 @@ func (s *ExecutionServiceFull) ProvideInput(ctx context.Context, executionID, us
 	return nil
 }
 
-// GetTrace returns all trace events for an execution
-func (s *ExecutionServiceFull) GetTrace(ctx context.Context, executionID, userID uuid.UUID) ([]models.TraceEvent, error) {
-	// Verify user has access to the execution
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM agent_executions e
-			JOIN nodes n ON e.node_id = n.id
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE e.id = $1 AND om.user_id = $2
-		)
-	`, executionID, userID).Scan(&exists)
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
-	}
-	if !exists {
-		return nil, ErrNotFound
-	}
-
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, execution_id, event_type, event_data, timestamp, duration_ms,
-		       model, tokens_in, tokens_out, sequence_number
-		FROM agent_trace_events
-		WHERE execution_id = $1
-		ORDER BY sequence_number ASC
-	`, executionID)
+// GetTrace returns a page of an execution's trace events, in order
+func (s *ExecutionServiceFull) GetTrace(ctx context.Context, executionID, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.TraceEvent], error) {
+	// Verify user has access to the execution. Its events come after it was
+	// created, so its creation time bounds the trace partitions to search.
+	exec, err := s.executions.Get(ctx, executionID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get trace events: %w", err)
+		return nil, err
 	}
-	defer rows.Close()
-
-	var events []models.TraceEvent
-	for rows.Next() {
-		var event models.TraceEvent
-		var eventDataJSON []byte
+	return s.executions.ListTrace(ctx, executionID, exec.CreatedAt, page)
+}
 
-		if err := rows.Scan(
-			&event.ID, &event.ExecutionID, &event.EventType, &eventDataJSON,
-			&event.Timestamp, &event.DurationMs, &event.Model, &event.TokensIn,
-			&event.TokensOut, &event.SequenceNumber,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan trace event: %w", err)
-		}
+// EffectiveConfig returns the agent config an execution of the node started
+// now would run with, without an override
+func (s *ExecutionServiceFull) EffectiveConfig(ctx context.Context, nodeID uuid.UUID) (*models.EffectiveAgentConfig, error) {
+	return s.resolver.Resolve(ctx, nodeID, nil)
+}
 
-		if eventDataJSON != nil {
-			json.Unmarshal(eventDataJSON, &event.EventData)
-		}
-		events = append(events, event)
+// executionConfig decodes an execution's agent_config, resolving the node's
+// when the execution started before it was kept
+func (s *ExecutionServiceFull) executionConfig(ctx context.Context, nodeID uuid.UUID, effectiveJSON []byte) (*models.EffectiveAgentConfig, error) {
+	if effectiveJSON == nil {
+		return s.resolver.Resolve(ctx, nodeID, nil)
 	}
+	var effective models.EffectiveAgentConfig
+	json.Unmarshal(effectiveJSON, &effective)
+	return &effective, nil
+}
 
-	return events, nil
+// jobConfig builds an agent job's orgConfig from an org's settings, as read
+// from the database, and an execution's agent config
+func jobConfig(orgSettingsJSON []byte, effective *models.EffectiveAgentConfig) map[string]any {
+	var orgSettings models.OrganizationSettings
+	if orgSettingsJSON != nil {
+		json.Unmarshal(orgSettingsJSON, &orgSettings)
+	}
+	return workerConfig(orgSettings, effective)
 }
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidFlagKey = errors.New("invalid feature flag key")
+
+const (
+	featureFlagCachePrefix = "feature_flag:"
+	featureFlagCacheTTL    = 30 * time.Second
+)
+
+var flagKeyPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_.-]{0,99}$`)
+
+// FeatureFlagService stores feature flags and answers whether a feature is on
+// for an org. Flags are toggled by platform admins.
+type FeatureFlagService struct {
+	db     *database.DB
+	redis  *database.Redis
+	logger *zap.Logger
+}
+
+func NewFeatureFlagService(db *database.DB, redis *database.Redis, logger *zap.Logger) *FeatureFlagService {
+	return &FeatureFlagService{db: db, redis: redis, logger: logger}
+}
+
+// List returns all feature flags
+func (s *FeatureFlagService) List(ctx context.Context) ([]models.FeatureFlag, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT key, enabled, description, enabled_org_ids, updated_by, updated_at
+		FROM feature_flags
+		ORDER BY key
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list feature flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := []models.FeatureFlag{}
+	for rows.Next() {
+		var f models.FeatureFlag
+		if err := rows.Scan(&f.Key, &f.Enabled, &f.Description, &f.EnabledOrgIDs, &f.UpdatedBy, &f.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan feature flag: %w", err)
+		}
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// SetFeatureFlagRequest contains changes to a feature flag. Omitted fields
+// keep their current value (or the default for a new flag).
+type SetFeatureFlagRequest struct {
+	Enabled       *bool        `json:"enabled,omitempty"`
+	Description   *string      `json:"description,omitempty"`
+	EnabledOrgIDs *[]uuid.UUID `json:"enabledOrgIds,omitempty"`
+}
+
+// Set creates or updates a feature flag
+func (s *FeatureFlagService) Set(ctx context.Context, key string, req SetFeatureFlagRequest, userID uuid.UUID) (*models.FeatureFlag, error) {
+	if !flagKeyPattern.MatchString(key) {
+		return nil, ErrInvalidFlagKey
+	}
+
+	var orgIDs []uuid.UUID
+	if req.EnabledOrgIDs != nil {
+		orgIDs = *req.EnabledOrgIDs
+		if orgIDs == nil {
+			orgIDs = []uuid.UUID{}
+		}
+	}
+
+	var f models.FeatureFlag
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO feature_flags (key, enabled, description, enabled_org_ids, updated_by, updated_at)
+		VALUES ($1, COALESCE($2, FALSE), $3, COALESCE($4, '{}'::UUID[]), $5, NOW())
+		ON CONFLICT (key) DO UPDATE SET
+			enabled = COALESCE($2, feature_flags.enabled),
+			description = COALESCE($3, feature_flags.description),
+			enabled_org_ids = COALESCE($4, feature_flags.enabled_org_ids),
+			updated_by = $5,
+			updated_at = NOW()
+		RETURNING key, enabled, description, enabled_org_ids, updated_by, updated_at
+	`, key, req.Enabled, req.Description, orgIDs, userID).Scan(
+		&f.Key, &f.Enabled, &f.Description, &f.EnabledOrgIDs, &f.UpdatedBy, &f.UpdatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set feature flag: %w", err)
+	}
+
+	if err := s.redis.Client.Del(ctx, featureFlagCachePrefix+key).Err(); err != nil {
+		s.logger.Warn("Failed to invalidate feature flag cache", zap.Error(err))
+	}
+	return &f, nil
+}
+
+// IsEnabled reports whether a feature is on, globally or for orgID (which may
+// be nil). Unknown flags are off. Lookups are cached briefly in Redis.
+func (s *FeatureFlagService) IsEnabled(ctx context.Context, key string, orgID *uuid.UUID) bool {
+	flag, err := s.get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, ErrNotFound) {
+			s.logger.Warn("Failed to read feature flag", zap.String("key", key), zap.Error(err))
+		}
+		return false
+	}
+	if flag.Enabled {
+		return true
+	}
+	if orgID != nil {
+		for _, id := range flag.EnabledOrgIDs {
+			if id == *orgID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s *FeatureFlagService) get(ctx context.Context, key string) (*models.FeatureFlag, error) {
+	cacheKey := featureFlagCachePrefix + key
+
+	cached, err := s.redis.Client.Get(ctx, cacheKey).Bytes()
+	if err == nil {
+		var f models.FeatureFlag
+		if json.Unmarshal(cached, &f) == nil {
+			if f.Key == "" {
+				return nil, ErrNotFound
+			}
+			return &f, nil
+		}
+	} else if err != redis.Nil {
+		s.logger.Warn("Failed to read feature flag cache", zap.Error(err))
+	}
+
+	var f models.FeatureFlag
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT key, enabled, description, enabled_org_ids, updated_by, updated_at
+		FROM feature_flags WHERE key = $1
+	`, key).Scan(&f.Key, &f.Enabled, &f.Description, &f.EnabledOrgIDs, &f.UpdatedBy, &f.UpdatedAt)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get feature flag: %w", err)
+	}
+
+	// Missing flags are cached as an empty flag so lookups stay cheap
+	data, _ := json.Marshal(f)
+	s.redis.Client.Set(ctx, cacheKey, data, featureFlagCacheTTL)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return &f, nil
+}
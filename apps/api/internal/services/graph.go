@@ -0,0 +1,711 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/graphql"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// graphMaxFirst caps the first argument of list fields
+	graphMaxFirst = 200
+
+	// graphMaxIDs caps how many nodes one nodes(ids:) field can ask for
+	graphMaxIDs = 200
+)
+
+// graphLimits keep one query from loading most of an org. Depth allows
+// project, node, children, children, inputs, sourceNode and a few more.
+var graphLimits = graphql.Limits{MaxDepth: 12, MaxObjects: 10000}
+
+// GraphService answers GraphQL queries over projects, their nodes, the
+// nodes' inputs and outputs, and their executions. Each field is resolved
+// once for every object it's selected on, so hydrating a canvas costs a
+// query per level of the graph rather than one per node.
+type GraphService struct {
+	projects    *ProjectService
+	nodes       repository.NodeRepo
+	executions  repository.ExecutionRepo
+	authz       *authz.Authorizer
+	ipAllowlist *IPAllowlistService
+	logger      *zap.Logger
+	schema      *graphql.Schema
+}
+
+func NewGraphService(projects *ProjectService, nodes repository.NodeRepo, executions repository.ExecutionRepo,
+	az *authz.Authorizer, ipAllowlist *IPAllowlistService, logger *zap.Logger) *GraphService {
+	s := &GraphService{
+		projects:    projects,
+		nodes:       nodes,
+		executions:  executions,
+		authz:       az,
+		ipAllowlist: ipAllowlist,
+		logger:      logger,
+	}
+	s.schema = graphql.NewSchema(graphSchema(), graphLimits)
+	return s
+}
+
+// Execute runs a query as userID. clientIP is checked against the
+// allowlist of each org the query reads from.
+func (s *GraphService) Execute(ctx context.Context, userID uuid.UUID, clientIP string, req graphql.Request) *graphql.Response {
+	return s.schema.Execute(ctx, req, s.newGraphRequest(userID, clientIP))
+}
+
+// SDL returns the schema in the GraphQL schema definition language
+func (s *GraphService) SDL() string {
+	return s.schema.SDL()
+}
+
+// =====================================================
+// SCHEMA
+// =====================================================
+
+func graphSchema() *graphql.Object {
+	nonNull := func(t graphql.Type) graphql.Type { return &graphql.NonNull{Of: t} }
+	listOf := func(t graphql.Type) graphql.Type {
+		return &graphql.NonNull{Of: &graphql.List{Of: &graphql.NonNull{Of: t}}}
+	}
+	first := func(def int) *graphql.Arg {
+		return &graphql.Arg{Type: graphql.Int, Default: def, Description: fmt.Sprintf("How many to return, at most %d", graphMaxFirst)}
+	}
+	id, str, integer, float := nonNull(graphql.ID), nonNull(graphql.String), nonNull(graphql.Int), nonNull(graphql.Float)
+	timestamp := nonNull(graphql.DateTime)
+
+	project := &graphql.Object{Name: "Project"}
+	node := &graphql.Object{Name: "Node"}
+	input := &graphql.Object{Name: "NodeInput"}
+	output := &graphql.Object{Name: "NodeOutput"}
+	execution := &graphql.Object{Name: "Execution"}
+	position := &graphql.Object{Name: "Position", Fields: graphql.Fields{
+		"x": {Type: float},
+		"y": {Type: float},
+	}}
+
+	project.Fields = graphql.Fields{
+		"id":              {Type: id},
+		"orgId":           {Type: id},
+		"name":            {Type: str},
+		"description":     {Type: graphql.String},
+		"settings":        {Type: nonNull(graphql.JSON)},
+		"workflowStates":  {Type: listOf(graphql.String)},
+		"templateId":      {Type: graphql.ID},
+		"templateVersion": {Type: graphql.Int},
+		"createdAt":       {Type: timestamp},
+		"updatedAt":       {Type: timestamp},
+		"nodes": {
+			Type:        listOf(node),
+			Description: "The project's nodes, newest first",
+			Args: graphql.Args{
+				"status":     {Type: graphql.String},
+				"authorType": {Type: graphql.String},
+				"parentId":   {Type: graphql.ID},
+				"rootsOnly":  {Type: graphql.Boolean, Default: false, Description: "Only nodes without a parent"},
+				"first":      first(50),
+			},
+			Resolve: resolver((*graphRequest).projectNodes),
+		},
+	}
+
+	node.Fields = graphql.Fields{
+		"id":               {Type: id},
+		"orgId":            {Type: id},
+		"projectId":        {Type: id},
+		"parentId":         {Type: graphql.ID},
+		"title":            {Type: str},
+		"description":      {Type: graphql.String},
+		"status":           {Type: str},
+		"authorType":       {Type: str},
+		"authorUserId":     {Type: graphql.ID},
+		"supervisorUserId": {Type: graphql.ID},
+		"version":          {Type: integer},
+		"metadata":         {Type: nonNull(graphql.JSON)},
+		"position":         {Type: nonNull(position)},
+		"lockedBy":         {Type: graphql.ID},
+		"lockedAt":         {Type: graphql.DateTime},
+		"lockExpiresAt":    {Type: graphql.DateTime},
+		"templateId":       {Type: graphql.ID},
+		"templateVersion":  {Type: graphql.Int},
+		"agentConfig":      {Type: graphql.JSON},
+		"createdAt":        {Type: timestamp},
+		"updatedAt":        {Type: timestamp},
+		"project":          {Type: nonNull(project), Resolve: resolver((*graphRequest).nodeProject)},
+		"parent":           {Type: node, Resolve: resolver((*graphRequest).nodeParent)},
+		"children": {
+			Type:        listOf(node),
+			Description: "The node's children, oldest first",
+			Args:        graphql.Args{"first": first(50)},
+			Resolve:     resolver((*graphRequest).nodeChildren),
+		},
+		"inputs":  {Type: listOf(input), Description: "In sort order", Resolve: resolver((*graphRequest).nodeInputs)},
+		"outputs": {Type: listOf(output), Description: "In sort order", Resolve: resolver((*graphRequest).nodeOutputs)},
+		"executions": {
+			Type:        listOf(execution),
+			Description: "The node's executions, newest first",
+			Args:        graphql.Args{"first": first(10)},
+			Resolve:     resolver((*graphRequest).nodeExecutions),
+		},
+		"latestExecution": {Type: execution, Resolve: resolver((*graphRequest).nodeLatestExecution)},
+	}
+
+	input.Fields = graphql.Fields{
+		"id":                {Type: id},
+		"nodeId":            {Type: id},
+		"inputType":         {Type: str},
+		"fileId":            {Type: graphql.ID},
+		"sourceNodeId":      {Type: graphql.ID},
+		"sourceNodeVersion": {Type: graphql.Int},
+		"externalUrl":       {Type: graphql.String},
+		"textContent":       {Type: graphql.String},
+		"label":             {Type: graphql.String},
+		"metadata":          {Type: graphql.JSON},
+		"sortOrder":         {Type: integer},
+		"createdAt":         {Type: timestamp},
+		"sourceNode": {
+			Type:        node,
+			Description: "The node the input comes from, if it's one the caller can read",
+			Resolve:     resolver((*graphRequest).inputSourceNode),
+		},
+	}
+
+	output.Fields = graphql.Fields{
+		"id":             {Type: id},
+		"nodeId":         {Type: id},
+		"outputType":     {Type: str},
+		"fileId":         {Type: graphql.ID},
+		"structuredData": {Type: graphql.JSON},
+		"textContent":    {Type: graphql.String},
+		"externalUrl":    {Type: graphql.String},
+		"label":          {Type: graphql.String},
+		"metadata":       {Type: graphql.JSON},
+		"sortOrder":      {Type: integer},
+		"createdAt":      {Type: timestamp},
+	}
+
+	execution.Fields = graphql.Fields{
+		"id":                {Type: id},
+		"nodeId":            {Type: id},
+		"status":            {Type: str},
+		"priority":          {Type: graphql.String},
+		"langgraphThreadId": {Type: graphql.String},
+		"traceSummary":      {Type: graphql.JSON},
+		"startedAt":         {Type: graphql.DateTime},
+		"completedAt":       {Type: graphql.DateTime},
+		"errorMessage":      {Type: graphql.String},
+		"totalTokensIn":     {Type: integer},
+		"totalTokensOut":    {Type: integer},
+		"estimatedCostUsd":  {Type: float},
+		"modelId":           {Type: graphql.String},
+		"createdAt":         {Type: timestamp},
+		"node":              {Type: nonNull(node), Resolve: resolver((*graphRequest).executionNode)},
+	}
+
+	return &graphql.Object{Name: "Query", Fields: graphql.Fields{
+		"project": {
+			Type:    project,
+			Args:    graphql.Args{"id": {Type: id}},
+			Resolve: resolver((*graphRequest).rootProject),
+		},
+		"projects": {
+			Type:        listOf(project),
+			Description: "An organization's projects, by name",
+			Args:        graphql.Args{"orgId": {Type: id}, "first": first(50)},
+			Resolve:     resolver((*graphRequest).rootProjects),
+		},
+		"node": {
+			Type:    node,
+			Args:    graphql.Args{"id": {Type: id}},
+			Resolve: resolver((*graphRequest).rootNode),
+		},
+		"nodes": {
+			Type:        &graphql.NonNull{Of: &graphql.List{Of: node}},
+			Description: fmt.Sprintf("Nodes by ID, in the order asked for, null where not found; at most %d", graphMaxIDs),
+			Args:        graphql.Args{"ids": {Type: listOf(graphql.ID)}},
+			Resolve:     resolver((*graphRequest).rootNodes),
+		},
+	}}
+}
+
+// resolver adapts a resolver method to the request it runs in
+func resolver(fn func(r *graphRequest, p graphql.ResolveParams) ([]any, error)) graphql.ResolveFunc {
+	return func(p graphql.ResolveParams) ([]any, error) {
+		return fn(p.Root.(*graphRequest), p)
+	}
+}
+
+// =====================================================
+// REQUESTS
+// =====================================================
+
+// graphRequest is one query's state: the caller, their access to each org
+// seen so far, and loaders for objects that several fields point at
+type graphRequest struct {
+	s        *GraphService
+	userID   uuid.UUID
+	clientIP string
+
+	// The caller's role in each org, "" where they aren't a member, and the
+	// orgs whose allowlists exclude them
+	roles    map[uuid.UUID]authz.Role
+	blocked  map[uuid.UUID]bool
+	nodes    *graphql.Loader[uuid.UUID, *models.Node]
+	projects *graphql.Loader[uuid.UUID, *models.Project]
+	inputs   *graphql.Loader[uuid.UUID, []*models.NodeInput]
+	outputs  *graphql.Loader[uuid.UUID, []*models.NodeOutput]
+}
+
+func (s *GraphService) newGraphRequest(userID uuid.UUID, clientIP string) *graphRequest {
+	r := &graphRequest{
+		s:        s,
+		userID:   userID,
+		clientIP: clientIP,
+		roles:    map[uuid.UUID]authz.Role{},
+		blocked:  map[uuid.UUID]bool{},
+	}
+	r.nodes = graphql.NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Node, error) {
+		nodes, err := s.nodes.GetMany(ctx, ids)
+		if err != nil {
+			return nil, r.internal(err, "nodes")
+		}
+		return byID(nodes, func(n *models.Node) uuid.UUID { return n.ID }), nil
+	})
+	r.projects = graphql.NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.Project, error) {
+		projects, err := s.projects.ListByIDs(ctx, ids, userID)
+		if err != nil {
+			return nil, r.internal(err, "projects")
+		}
+		return byID(projects, func(p *models.Project) uuid.UUID { return p.ID }), nil
+	})
+	r.inputs = graphql.NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]*models.NodeInput, error) {
+		inputs, err := s.nodes.InputsOf(ctx, ids)
+		if err != nil {
+			return nil, r.internal(err, "inputs")
+		}
+		return groupBy(inputs, func(i *models.NodeInput) uuid.UUID { return i.NodeID }), nil
+	})
+	r.outputs = graphql.NewLoader(func(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID][]*models.NodeOutput, error) {
+		outputs, err := s.nodes.OutputsOf(ctx, ids)
+		if err != nil {
+			return nil, r.internal(err, "outputs")
+		}
+		return groupBy(outputs, func(o *models.NodeOutput) uuid.UUID { return o.NodeID }), nil
+	})
+	return r
+}
+
+// can reports whether the caller may perform action in an org, returning
+// ErrIPNotAllowed when its allowlist excludes them. Answers are kept for
+// the rest of the query.
+func (r *graphRequest) can(ctx context.Context, orgID uuid.UUID, action authz.Action) (bool, error) {
+	role, ok := r.roles[orgID]
+	if !ok {
+		var err error
+		role, err = r.s.authz.RoleIn(ctx, orgID, r.userID)
+		if errors.Is(err, authz.ErrNotFound) {
+			role, err = "", nil
+		}
+		if err != nil {
+			return false, r.internal(err, "permissions")
+		}
+		if role != "" {
+			allowed, err := r.s.ipAllowlist.IsIPAllowed(ctx, orgID, r.clientIP)
+			if err != nil {
+				return false, r.internal(err, "permissions")
+			}
+			r.blocked[orgID] = !allowed
+		}
+		r.roles[orgID] = role
+	}
+	if r.blocked[orgID] {
+		return false, ErrIPNotAllowed
+	}
+	return role != "" && role.Can(action), nil
+}
+
+// readable drops the nodes the caller can't read. Nodes of orgs that
+// exclude their IP are dropped too, as nested fields can't fail alone.
+func (r *graphRequest) readable(ctx context.Context, nodes []*models.Node) ([]*models.Node, error) {
+	out := make([]*models.Node, len(nodes))
+	for i, n := range nodes {
+		if n == nil {
+			continue
+		}
+		ok, err := r.can(ctx, n.OrgID, authz.NodeRead)
+		if err != nil && !errors.Is(err, ErrIPNotAllowed) {
+			return nil, err
+		}
+		if ok {
+			out[i] = n
+		}
+	}
+	return out, nil
+}
+
+// internal logs a failed read and returns the error the client sees
+func (r *graphRequest) internal(err error, what string) error {
+	r.s.logger.Error("GraphQL query failed", zap.String("loading", what), zap.Error(err))
+	return fmt.Errorf("failed to load %s", what)
+}
+
+// =====================================================
+// RESOLVERS
+// =====================================================
+
+func (r *graphRequest) rootProject(p graphql.ResolveParams) ([]any, error) {
+	projectID, err := argID(p.Args, "id")
+	if err != nil {
+		return nil, err
+	}
+	projects, err := r.projects.LoadMany(p.Context, []uuid.UUID{projectID})
+	if err != nil || projects[0] == nil {
+		return []any{nil}, err
+	}
+	ok, err := r.can(p.Context, projects[0].OrgID, authz.ProjectRead)
+	if err != nil || !ok {
+		return []any{nil}, err
+	}
+	return []any{projects[0]}, nil
+}
+
+func (r *graphRequest) rootProjects(p graphql.ResolveParams) ([]any, error) {
+	orgID, err := argID(p.Args, "orgId")
+	if err != nil {
+		return nil, err
+	}
+	limit, err := argFirst(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	ok, err := r.can(p.Context, orgID, authz.ProjectRead)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("organization not found")
+	}
+
+	page, err := r.s.projects.ListByOrg(p.Context, orgID, r.userID, pagination.Params{Limit: limit})
+	if errors.Is(err, ErrForbidden) {
+		return nil, errors.New("organization not found")
+	}
+	if err != nil {
+		return nil, r.internal(err, "projects")
+	}
+	projects := make([]*models.Project, len(page.Items))
+	for i := range page.Items {
+		projects[i] = &page.Items[i]
+		r.projects.Prime(projects[i].ID, projects[i])
+	}
+	return []any{projects}, nil
+}
+
+func (r *graphRequest) rootNode(p graphql.ResolveParams) ([]any, error) {
+	nodeID, err := argID(p.Args, "id")
+	if err != nil {
+		return nil, err
+	}
+	nodes, err := r.nodes.LoadMany(p.Context, []uuid.UUID{nodeID})
+	if err != nil || nodes[0] == nil {
+		return []any{nil}, err
+	}
+	ok, err := r.can(p.Context, nodes[0].OrgID, authz.NodeRead)
+	if err != nil || !ok {
+		return []any{nil}, err
+	}
+	return []any{nodes[0]}, nil
+}
+
+func (r *graphRequest) rootNodes(p graphql.ResolveParams) ([]any, error) {
+	raw, _ := p.Args["ids"].([]any)
+	if len(raw) > graphMaxIDs {
+		return nil, fmt.Errorf("argument \"ids\" can list at most %d nodes", graphMaxIDs)
+	}
+	ids := make([]uuid.UUID, len(raw))
+	for i, v := range raw {
+		id, err := uuid.Parse(v.(string))
+		if err != nil {
+			return nil, fmt.Errorf("argument \"ids\" has an invalid ID %q", v)
+		}
+		ids[i] = id
+	}
+	nodes, err := r.nodes.LoadMany(p.Context, ids)
+	if err != nil {
+		return nil, err
+	}
+	nodes, err = r.readable(p.Context, nodes)
+	if err != nil {
+		return nil, err
+	}
+	return []any{nodes}, nil
+}
+
+func (r *graphRequest) projectNodes(p graphql.ResolveParams) ([]any, error) {
+	projects := sources[*models.Project](p)
+	limit, err := argFirst(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	filter := repository.NodeFilter{RootsOnly: p.Args["rootsOnly"] == true}
+	if status, ok := p.Args["status"].(string); ok {
+		filter.Status = &status
+	}
+	if authorType, ok := p.Args["authorType"].(string); ok {
+		filter.AuthorType = &authorType
+	}
+	if p.Args["parentId"] != nil {
+		parentID, err := argID(p.Args, "parentId")
+		if err != nil {
+			return nil, err
+		}
+		filter.ParentID = &parentID
+	}
+
+	ids := uniqueIDs(projects, func(p *models.Project) uuid.UUID { return p.ID })
+	nodes, err := r.s.nodes.ListByProjects(p.Context, ids, filter, limit)
+	if err != nil {
+		return nil, r.internal(err, "nodes")
+	}
+	byProject := groupBy(nodes, func(n *models.Node) uuid.UUID { return n.ProjectID })
+	for _, group := range byProject {
+		for _, n := range group {
+			r.nodes.Prime(n.ID, n)
+		}
+	}
+	return each(projects, func(p *models.Project) any { return byProject[p.ID] }), nil
+}
+
+func (r *graphRequest) nodeProject(p graphql.ResolveParams) ([]any, error) {
+	nodes := sources[*models.Node](p)
+	projects, err := r.projects.LoadMany(p.Context, mapIDs(nodes, func(n *models.Node) uuid.UUID { return n.ProjectID }))
+	if err != nil {
+		return nil, err
+	}
+	return each(projects, func(p *models.Project) any { return p }), nil
+}
+
+func (r *graphRequest) nodeParent(p graphql.ResolveParams) ([]any, error) {
+	nodes := sources[*models.Node](p)
+	var parentIDs []uuid.UUID
+	for _, n := range nodes {
+		if n.ParentID != nil {
+			parentIDs = append(parentIDs, *n.ParentID)
+		}
+	}
+	parents, err := r.nodes.LoadMany(p.Context, parentIDs)
+	if err != nil {
+		return nil, err
+	}
+	return alongside(nodes, parents, func(n *models.Node) bool { return n.ParentID != nil }), nil
+}
+
+func (r *graphRequest) nodeChildren(p graphql.ResolveParams) ([]any, error) {
+	nodes := sources[*models.Node](p)
+	limit, err := argFirst(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	children, err := r.s.nodes.ListChildrenOf(p.Context, uniqueIDs(nodes, func(n *models.Node) uuid.UUID { return n.ID }), limit)
+	if err != nil {
+		return nil, r.internal(err, "children")
+	}
+	byParent := groupBy(children, func(n *models.Node) uuid.UUID { return *n.ParentID })
+	for _, group := range byParent {
+		for _, n := range group {
+			r.nodes.Prime(n.ID, n)
+		}
+	}
+	return each(nodes, func(n *models.Node) any { return byParent[n.ID] }), nil
+}
+
+func (r *graphRequest) nodeInputs(p graphql.ResolveParams) ([]any, error) {
+	nodes := sources[*models.Node](p)
+	inputs, err := r.inputs.LoadMany(p.Context, mapIDs(nodes, func(n *models.Node) uuid.UUID { return n.ID }))
+	if err != nil {
+		return nil, err
+	}
+	return each(inputs, func(i []*models.NodeInput) any { return i }), nil
+}
+
+func (r *graphRequest) nodeOutputs(p graphql.ResolveParams) ([]any, error) {
+	nodes := sources[*models.Node](p)
+	outputs, err := r.outputs.LoadMany(p.Context, mapIDs(nodes, func(n *models.Node) uuid.UUID { return n.ID }))
+	if err != nil {
+		return nil, err
+	}
+	return each(outputs, func(o []*models.NodeOutput) any { return o }), nil
+}
+
+func (r *graphRequest) nodeExecutions(p graphql.ResolveParams) ([]any, error) {
+	limit, err := argFirst(p.Args)
+	if err != nil {
+		return nil, err
+	}
+	return r.executionsOf(p, limit, func(execs []*repository.Execution) any { return execs })
+}
+
+func (r *graphRequest) nodeLatestExecution(p graphql.ResolveParams) ([]any, error) {
+	return r.executionsOf(p, 1, func(execs []*repository.Execution) any {
+		if len(execs) == 0 {
+			return nil
+		}
+		return execs[0]
+	})
+}
+
+// executionsOf loads up to limit of each source node's executions, newest
+// first, and returns pick of each node's. Nodes in orgs where the caller
+// can't read executions have none.
+func (r *graphRequest) executionsOf(p graphql.ResolveParams, limit int, pick func([]*repository.Execution) any) ([]any, error) {
+	nodes := sources[*models.Node](p)
+	var ids []uuid.UUID
+	for _, n := range nodes {
+		ok, err := r.can(p.Context, n.OrgID, authz.ExecutionRead)
+		if err != nil && !errors.Is(err, ErrIPNotAllowed) {
+			return nil, err
+		}
+		if ok {
+			ids = append(ids, n.ID)
+		}
+	}
+	ids = uniqueIDs(ids, func(id uuid.UUID) uuid.UUID { return id })
+
+	var byNode map[uuid.UUID][]*repository.Execution
+	if len(ids) > 0 {
+		execs, err := r.s.executions.ListByNodes(p.Context, ids, limit)
+		if err != nil {
+			return nil, r.internal(err, "executions")
+		}
+		byNode = groupBy(execs, func(e *repository.Execution) uuid.UUID { return e.NodeID })
+	}
+	return each(nodes, func(n *models.Node) any { return pick(byNode[n.ID]) }), nil
+}
+
+func (r *graphRequest) inputSourceNode(p graphql.ResolveParams) ([]any, error) {
+	inputs := sources[*models.NodeInput](p)
+	var ids []uuid.UUID
+	for _, input := range inputs {
+		if input.SourceNodeID != nil {
+			ids = append(ids, *input.SourceNodeID)
+		}
+	}
+	nodes, err := r.nodes.LoadMany(p.Context, ids)
+	if err != nil {
+		return nil, err
+	}
+	// Inputs can point at nodes in projects of other orgs
+	nodes, err = r.readable(p.Context, nodes)
+	if err != nil {
+		return nil, err
+	}
+
+	return alongside(inputs, nodes, func(i *models.NodeInput) bool { return i.SourceNodeID != nil }), nil
+}
+
+func (r *graphRequest) executionNode(p graphql.ResolveParams) ([]any, error) {
+	execs := sources[*repository.Execution](p)
+	nodes, err := r.nodes.LoadMany(p.Context, mapIDs(execs, func(e *repository.Execution) uuid.UUID { return e.NodeID }))
+	if err != nil {
+		return nil, err
+	}
+	return each(nodes, func(n *models.Node) any { return n }), nil
+}
+
+// =====================================================
+// HELPERS
+// =====================================================
+
+// sources returns the objects a field is resolved on as T
+func sources[T any](p graphql.ResolveParams) []T {
+	out := make([]T, len(p.Sources))
+	for i, src := range p.Sources {
+		out[i] = src.(T)
+	}
+	return out
+}
+
+// each maps items to resolved values
+func each[T any](items []T, fn func(T) any) []any {
+	out := make([]any, len(items))
+	for i, item := range items {
+		out[i] = fn(item)
+	}
+	return out
+}
+
+func mapIDs[T any](items []T, id func(T) uuid.UUID) []uuid.UUID {
+	ids := make([]uuid.UUID, len(items))
+	for i, item := range items {
+		ids[i] = id(item)
+	}
+	return ids
+}
+
+func uniqueIDs[T any](items []T, id func(T) uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{}
+	var ids []uuid.UUID
+	for _, item := range items {
+		if key := id(item); !seen[key] {
+			seen[key] = true
+			ids = append(ids, key)
+		}
+	}
+	return ids
+}
+
+// alongside matches loaded values to the items they were loaded for: the
+// items has holds, in order. The others get nil.
+func alongside[T, V any](items []T, loaded []V, has func(T) bool) []any {
+	out := make([]any, len(items))
+	j := 0
+	for i, item := range items {
+		if has(item) {
+			out[i] = loaded[j]
+			j++
+		}
+	}
+	return out
+}
+
+// byID indexes rows by ID, as pointers
+func byID[T any](rows []T, id func(*T) uuid.UUID) map[uuid.UUID]*T {
+	out := make(map[uuid.UUID]*T, len(rows))
+	for i := range rows {
+		out[id(&rows[i])] = &rows[i]
+	}
+	return out
+}
+
+// groupBy groups rows by key, as pointers, keeping their order
+func groupBy[T any](rows []T, key func(*T) uuid.UUID) map[uuid.UUID][]*T {
+	out := map[uuid.UUID][]*T{}
+	for i := range rows {
+		k := key(&rows[i])
+		out[k] = append(out[k], &rows[i])
+	}
+	return out
+}
+
+func argID(args map[string]any, name string) (uuid.UUID, error) {
+	s, _ := args[name].(string)
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("argument %q is not a valid ID", name)
+	}
+	return id, nil
+}
+
+func argFirst(args map[string]any) (int, error) {
+	first, _ := args["first"].(int)
+	if first < 1 || first > graphMaxFirst {
+		return 0, fmt.Errorf("argument \"first\" must be between 1 and %d", graphMaxFirst)
+	}
+	return first, nil
+}
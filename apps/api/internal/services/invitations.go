@@ -0,0 +1,335 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ErrInvitationExpired is returned for accepting an invitation past its
+// expiry
+var ErrInvitationExpired = errors.New("invitation expired")
+
+// OrgInvitation is a pending invitation to join an org
+type OrgInvitation struct {
+	ID            uuid.UUID  `json:"id"`
+	OrgID         uuid.UUID  `json:"orgId"`
+	Email         string     `json:"email"`
+	Role          string     `json:"role"`
+	InvitedBy     *uuid.UUID `json:"invitedBy,omitempty"`
+	InvitedByName *string    `json:"invitedByName,omitempty"`
+	ExpiresAt     time.Time  `json:"expiresAt"`
+	Expired       bool       `json:"expired,omitempty"`
+	CreatedAt     time.Time  `json:"createdAt"`
+}
+
+// CreatedInvitation is an invitation as returned once, on creation: the
+// token can't be read back later
+type CreatedInvitation struct {
+	OrgInvitation
+	Token     string `json:"token"`
+	AcceptURL string `json:"acceptUrl"`
+	// Whether the link is being emailed to the invitee. Without a mailer
+	// (SMTP_HOST unset) the inviter shares AcceptURL themselves.
+	Emailed bool `json:"emailed"`
+}
+
+// CreateInvitationRequest invites an email address to an org
+type CreateInvitationRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+	Role  string `json:"role" binding:"omitempty,oneof=owner admin member guest"` // default member
+}
+
+// AcceptInvitationRequest accepts an invitation with the token it was sent
+type AcceptInvitationRequest struct {
+	Token string `json:"token" binding:"required,max=100"`
+}
+
+// AcceptedInvitation is the membership an accepted invitation gave
+type AcceptedInvitation struct {
+	OrgID uuid.UUID `json:"orgId"`
+	Role  string    `json:"role"`
+	// False when the user was already a member; their role is unchanged
+	Joined bool `json:"joined"`
+}
+
+// InvitationService invites people to orgs by email, whether or not they
+// have an account yet. The invitee gets a link with a single-use token;
+// accepting it signed in makes them a member. Callers must have authorized
+// authz.OrgMembers for everything but Accept; the member service's role
+// rules apply to the role invited with.
+type InvitationService struct {
+	db      *database.DB
+	members *OrgMembersService
+	mail    Mailer
+	cfg     *config.Config
+	logger  *zap.Logger
+}
+
+func NewInvitationService(db *database.DB, members *OrgMembersService, cfg *config.Config, logger *zap.Logger) *InvitationService {
+	return &InvitationService{db: db, members: members, cfg: cfg, logger: logger}
+}
+
+// SetMailer enables invitation emails. Without one, admins share the
+// acceptUrl returned on creation themselves.
+func (s *InvitationService) SetMailer(mail Mailer) {
+	s.mail = mail
+}
+
+// Create invites the email to the org and emails the invitee a link to
+// accept. Inviting an email with a pending invitation replaces its token,
+// role and expiry. Returns ErrAlreadyExists when an active member has the
+// email, and ErrForbidden when the role is above the caller's.
+func (s *InvitationService) Create(ctx context.Context, orgID, actorID uuid.UUID, req CreateInvitationRequest) (*CreatedInvitation, error) {
+	role := authz.Role(req.Role)
+	if role == "" {
+		role = authz.RoleMember
+	}
+	if err := s.members.checkGrant(ctx, orgID, actorID, role); err != nil {
+		return nil, err
+	}
+	email := strings.TrimSpace(req.Email)
+
+	var isMember bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM org_members m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.org_id = $1 AND lower(u.email) = lower($2) AND u.deleted_at IS NULL
+		)
+	`, orgID, email).Scan(&isMember)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check membership: %w", err)
+	}
+	if isMember {
+		return nil, ErrAlreadyExists
+	}
+
+	token, tokenHash, err := newInvitationToken()
+	if err != nil {
+		return nil, err
+	}
+
+	inv := CreatedInvitation{Token: token, AcceptURL: s.acceptURL(token)}
+	err = s.db.Pool.QueryRow(ctx, `
+		INSERT INTO org_invitations (org_id, email, role, token_hash, invited_by, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (org_id, lower(email)) WHERE accepted_at IS NULL AND revoked_at IS NULL
+		DO UPDATE SET role = EXCLUDED.role, token_hash = EXCLUDED.token_hash,
+			invited_by = EXCLUDED.invited_by, expires_at = EXCLUDED.expires_at
+		RETURNING id, org_id, email, role, invited_by, expires_at, created_at
+	`, orgID, email, string(role), tokenHash, actorID, time.Now().Add(s.cfg.InvitationTTL)).Scan(
+		&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.ExpiresAt, &inv.CreatedAt,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	if s.mail != nil {
+		inv.Emailed = s.email(ctx, &inv)
+	}
+	return &inv, nil
+}
+
+// email sends the invitation in the background, returning false when it
+// can't be composed
+func (s *InvitationService) email(ctx context.Context, inv *CreatedInvitation) bool {
+	var orgName, inviter string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT o.name, COALESCE(u.name, u.email, 'Someone')
+		FROM organizations o LEFT JOIN users u ON u.id = $2
+		WHERE o.id = $1
+	`, inv.OrgID, inv.InvitedBy).Scan(&orgName, &inviter)
+	if err != nil {
+		s.logger.Warn("Failed to email invitation", zap.Error(err))
+		return false
+	}
+
+	subject := inviter + " invited you to " + orgName + " on Glassbox"
+	body := fmt.Sprintf("%s invited you to join %s as %s %s.\n\nAccept the invitation: %s\n\nIt expires on %s.",
+		inviter, orgName, article(inv.Role), inv.Role, inv.AcceptURL, inv.ExpiresAt.UTC().Format("January 2, 2006"))
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.mail(ctx, inv.Email, subject, body); err != nil {
+			s.logger.Warn("Failed to email invitation", zap.String("invitation_id", inv.ID.String()), zap.Error(err))
+		}
+	}()
+	return true
+}
+
+func article(word string) string {
+	if strings.ContainsRune("aeiou", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// acceptURL is the web app link that accepts an invitation
+func (s *InvitationService) acceptURL(token string) string {
+	sep := "?"
+	if strings.Contains(s.cfg.InvitationURL, "?") {
+		sep = "&"
+	}
+	return s.cfg.InvitationURL + sep + "token=" + url.QueryEscape(token)
+}
+
+// List returns a page of the org's pending invitations, newest first.
+// Expired ones are included, flagged, so they can be sent again or revoked.
+func (s *InvitationService) List(ctx context.Context, orgID uuid.UUID, page pagination.Params) (*pagination.Page[OrgInvitation], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT i.id, i.org_id, i.email, i.role, i.invited_by, COALESCE(u.name, u.email),
+		       i.expires_at, i.expires_at <= NOW(), i.created_at
+		FROM org_invitations i
+		LEFT JOIN users u ON u.id = i.invited_by
+		WHERE i.org_id = $1 AND i.accepted_at IS NULL AND i.revoked_at IS NULL
+		  AND ($2::TIMESTAMPTZ IS NULL OR (i.created_at, i.id) < ($2, $3::UUID))
+		ORDER BY i.created_at DESC, i.id DESC
+		LIMIT $4
+	`, orgID, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	defer rows.Close()
+
+	var invitations []OrgInvitation
+	for rows.Next() {
+		var inv OrgInvitation
+		if err := rows.Scan(&inv.ID, &inv.OrgID, &inv.Email, &inv.Role, &inv.InvitedBy, &inv.InvitedByName,
+			&inv.ExpiresAt, &inv.Expired, &inv.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan invitation: %w", err)
+		}
+		invitations = append(invitations, inv)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+
+	result := pagination.NewPage(invitations, limit, func(inv OrgInvitation) pagination.Cursor {
+		return pagination.TimeCursor(inv.CreatedAt, inv.ID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM org_invitations
+		WHERE org_id = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, orgID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count invitations: %w", err)
+	}
+	return result, nil
+}
+
+// Revoke cancels a pending invitation, so its token stops working
+func (s *InvitationService) Revoke(ctx context.Context, orgID, invitationID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE org_invitations SET revoked_at = NOW()
+		WHERE id = $1 AND org_id = $2 AND accepted_at IS NULL AND revoked_at IS NULL
+	`, invitationID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Accept makes the user a member of the org the token invites them to,
+// with the invitation's role. The token works once, for whoever holds it;
+// the user's email doesn't have to match the one invited. Returns
+// ErrNotFound for unknown, revoked or used tokens, and ErrInvitationExpired
+// for expired ones.
+func (s *InvitationService) Accept(ctx context.Context, userID uuid.UUID, req AcceptInvitationRequest) (*AcceptedInvitation, error) {
+	var accepted AcceptedInvitation
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		accepted = AcceptedInvitation{}
+
+		var invitationID uuid.UUID
+		var expiresAt time.Time
+		err := tx.QueryRow(ctx, `
+			SELECT id, org_id, role, expires_at FROM org_invitations
+			WHERE token_hash = $1 AND accepted_at IS NULL AND revoked_at IS NULL
+			FOR UPDATE
+		`, hashInvitationToken(req.Token)).Scan(&invitationID, &accepted.OrgID, &accepted.Role, &expiresAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get invitation: %w", err)
+		}
+		if !time.Now().Before(expiresAt) {
+			return ErrInvitationExpired
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO org_members (org_id, user_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (org_id, user_id) DO NOTHING
+			RETURNING role
+		`, accepted.OrgID, userID, accepted.Role).Scan(&accepted.Role)
+		switch {
+		case err == nil:
+			accepted.Joined = true
+		case errors.Is(err, pgx.ErrNoRows):
+			err = tx.QueryRow(ctx, `
+				SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2
+			`, accepted.OrgID, userID).Scan(&accepted.Role)
+			if err != nil {
+				return fmt.Errorf("failed to get membership: %w", err)
+			}
+		default:
+			return fmt.Errorf("failed to add member: %w", err)
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE org_invitations SET accepted_at = NOW(), accepted_by = $2 WHERE id = $1
+		`, invitationID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to accept invitation: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if accepted.Joined {
+		s.members.changed(ctx, accepted.OrgID, userID, userID, MembershipAdded)
+	}
+	return &accepted, nil
+}
+
+// newInvitationToken returns a random token and the hash stored for it
+func newInvitationToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashInvitationToken(token), nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/cache"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidCIDR      = errors.New("invalid CIDR range")
+	ErrAllowlistLockout = errors.New("change would block the caller's own IP address")
+)
+
+// How long an org's allowlist is cached. Changes are seen at once; the TTL
+// only covers a missed notification.
+const ipAllowlistCacheTTL = 5 * time.Minute
+
+// IPAllowlistService manages per-org CIDR allowlists and answers whether a
+// client IP may access an org's resources
+type IPAllowlistService struct {
+	db     *database.DB
+	authz  *authz.Authorizer
+	logger *zap.Logger
+
+	// CIDR ranges by org
+	ranges *cache.Local[uuid.UUID, []string]
+}
+
+// NewIPAllowlistService creates the service and subscribes its cache to
+// listener
+func NewIPAllowlistService(db *database.DB, listener *database.Listener, az *authz.Authorizer, logger *zap.Logger) *IPAllowlistService {
+	s := &IPAllowlistService{
+		db:     db,
+		authz:  az,
+		logger: logger,
+		ranges: cache.NewLocal[uuid.UUID, []string](ipAllowlistCacheTTL, listener.Connected),
+	}
+	listener.Subscribe(s)
+	return s
+}
+
+// AddIPAllowlistEntryRequest contains data for adding an allowlist entry
+type AddIPAllowlistEntryRequest struct {
+	CIDR        string  `json:"cidr" binding:"required"`
+	Description *string `json:"description,omitempty"`
+}
+
+// List returns the org's allowlist. Callers must have authorized authz.OrgAdmin.
+func (s *IPAllowlistService) List(ctx context.Context, orgID uuid.UUID) ([]models.OrgIPAllowlistEntry, error) {
+	return s.listEntries(ctx, orgID)
+}
+
+// Add adds a CIDR range to the org's allowlist. Callers must have authorized authz.OrgAdmin.
+// A bare IP is treated as a single-address range. clientIP is the caller's
+// address; the change is refused if it would lock the caller out.
+func (s *IPAllowlistService) Add(ctx context.Context, orgID, userID uuid.UUID, clientIP string, req AddIPAllowlistEntryRequest) (*models.OrgIPAllowlistEntry, error) {
+	cidr, err := normalizeCIDR(req.CIDR)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.listEntries(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	ranges := make([]string, 0, len(existing)+1)
+	for _, e := range existing {
+		ranges = append(ranges, e.CIDR)
+	}
+	if !ipInRanges(clientIP, append(ranges, cidr)) {
+		return nil, ErrAllowlistLockout
+	}
+
+	var entry models.OrgIPAllowlistEntry
+	err = s.db.Pool.QueryRow(ctx, `
+		INSERT INTO org_ip_allowlists (org_id, cidr, description, created_by)
+		VALUES ($1, $2::CIDR, $3, $4)
+		RETURNING id, org_id, cidr::TEXT, description, created_by, created_at
+	`, orgID, cidr, req.Description, userID).Scan(
+		&entry.ID, &entry.OrgID, &entry.CIDR, &entry.Description, &entry.CreatedBy, &entry.CreatedAt,
+	)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return nil, ErrAlreadyExists
+		}
+		return nil, fmt.Errorf("failed to add allowlist entry: %w", err)
+	}
+
+	s.ranges.Delete(orgID)
+	return &entry, nil
+}
+
+// Remove deletes an allowlist entry. Callers must have authorized authz.OrgAdmin.
+// Refused if the remaining entries would not include the caller's IP.
+func (s *IPAllowlistService) Remove(ctx context.Context, orgID, entryID uuid.UUID, clientIP string) error {
+	existing, err := s.listEntries(ctx, orgID)
+	if err != nil {
+		return err
+	}
+	found := false
+	remaining := make([]string, 0, len(existing))
+	for _, e := range existing {
+		if e.ID == entryID {
+			found = true
+			continue
+		}
+		remaining = append(remaining, e.CIDR)
+	}
+	if !found {
+		return ErrNotFound
+	}
+	if len(remaining) > 0 && !ipInRanges(clientIP, remaining) {
+		return ErrAllowlistLockout
+	}
+
+	_, err = s.db.Pool.Exec(ctx, `DELETE FROM org_ip_allowlists WHERE id = $1 AND org_id = $2`, entryID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to remove allowlist entry: %w", err)
+	}
+
+	s.ranges.Delete(orgID)
+	return nil
+}
+
+// ResolveOrgID finds the org a request touches from its route params
+func (s *IPAllowlistService) ResolveOrgID(ctx context.Context, params map[string]string) (*uuid.UUID, error) {
+	res, ok, err := authz.ResourceFromParams(params)
+	if !ok || err != nil {
+		return nil, nil
+	}
+
+	orgID, err := s.authz.OrgFor(ctx, res)
+	if errors.Is(err, authz.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &orgID, nil
+}
+
+// IsIPAllowed reports whether ip may access the org's resources.
+// Ranges are cached in memory so the check does not hit Postgres on every request.
+func (s *IPAllowlistService) IsIPAllowed(ctx context.Context, orgID uuid.UUID, ip string) (bool, error) {
+	ranges, err := s.cachedRanges(ctx, orgID)
+	if err != nil {
+		return false, err
+	}
+	if len(ranges) == 0 {
+		return true, nil
+	}
+	return ipInRanges(ip, ranges), nil
+}
+
+func (s *IPAllowlistService) cachedRanges(ctx context.Context, orgID uuid.UUID) ([]string, error) {
+	return s.ranges.Load(orgID, func() ([]string, error) {
+		entries, err := s.listEntries(ctx, orgID)
+		if err != nil {
+			return nil, err
+		}
+		ranges := make([]string, 0, len(entries))
+		for _, e := range entries {
+			ranges = append(ranges, e.CIDR)
+		}
+		return ranges, nil
+	})
+}
+
+// Invalidate drops the cached allowlist of an org whose entries changed
+func (s *IPAllowlistService) Invalidate(change database.RowChange) {
+	if change.Table == "org_ip_allowlists" {
+		s.ranges.Delete(change.OrgID)
+	}
+}
+
+// InvalidateAll drops every cached allowlist
+func (s *IPAllowlistService) InvalidateAll() {
+	s.ranges.Clear()
+}
+
+func (s *IPAllowlistService) listEntries(ctx context.Context, orgID uuid.UUID) ([]models.OrgIPAllowlistEntry, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, org_id, cidr::TEXT, description, created_by, created_at
+		FROM org_ip_allowlists
+		WHERE org_id = $1
+		ORDER BY created_at
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list allowlist: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.OrgIPAllowlistEntry{}
+	for rows.Next() {
+		var e models.OrgIPAllowlistEntry
+		if err := rows.Scan(&e.ID, &e.OrgID, &e.CIDR, &e.Description, &e.CreatedBy, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan allowlist entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// normalizeCIDR validates a CIDR or bare IP and returns it in canonical CIDR form
+func normalizeCIDR(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return "", ErrInvalidCIDR
+		}
+		if ip.To4() != nil {
+			return ip.String() + "/32", nil
+		}
+		return ip.String() + "/128", nil
+	}
+
+	_, network, err := net.ParseCIDR(value)
+	if err != nil {
+		return "", ErrInvalidCIDR
+	}
+	return network.String(), nil
+}
+
+// ipInRanges reports whether ip falls inside any of the CIDR ranges
+func ipInRanges(ip string, ranges []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, r := range ranges {
+		_, network, err := net.ParseCIDR(r)
+		if err == nil && network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/glassbox/api/internal/cache"
+	"github.com/google/uuid"
+)
+
+func TestIPInRanges(t *testing.T) {
+	ranges := []string{"10.0.0.0/8", "203.0.113.7/32", "2001:db8:abcd::/48"}
+	for _, tc := range []struct {
+		ip   string
+		want bool
+	}{
+		{"10.1.2.3", true},
+		{"11.0.0.1", false},
+		{"203.0.113.7", true},
+		{"203.0.113.8", false},
+		{"2001:db8:abcd:12::1", true},
+		{"2001:db8:abce::1", false},
+		// IPv4-mapped IPv6 is the IPv4 address
+		{"::ffff:10.9.9.9", true},
+		{"", false},
+		{"not-an-ip", false},
+	} {
+		if got := ipInRanges(tc.ip, ranges); got != tc.want {
+			t.Errorf("ipInRanges(%q) = %v, want %v", tc.ip, got, tc.want)
+		}
+	}
+	if ipInRanges("10.1.2.3", []string{"garbage", "10.1.2.0/33"}) {
+		t.Error("invalid ranges matched")
+	}
+}
+
+func TestNormalizeCIDR(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"203.0.113.7", "203.0.113.7/32"},
+		{" 2001:db8::1 ", "2001:db8::1/128"},
+		{"10.1.2.3/8", "10.0.0.0/8"},
+		{"2001:db8:abcd:12::/48", "2001:db8:abcd::/48"},
+	} {
+		got, err := normalizeCIDR(tc.in)
+		if err != nil || got != tc.want {
+			t.Errorf("normalizeCIDR(%q) = %q, %v; want %q", tc.in, got, err, tc.want)
+		}
+	}
+
+	// A single IP is a range holding only itself
+	single, _ := normalizeCIDR("203.0.113.7")
+	if !ipInRanges("203.0.113.7", []string{single}) || ipInRanges("203.0.113.8", []string{single}) {
+		t.Errorf("range %s of a single IP holds other addresses or not its own", single)
+	}
+
+	for _, in := range []string{"", "10.0.0.256", "10.0.0.0/40", "example.com"} {
+		if _, err := normalizeCIDR(in); err != ErrInvalidCIDR {
+			t.Errorf("normalizeCIDR(%q) err = %v, want ErrInvalidCIDR", in, err)
+		}
+	}
+}
+
+func TestIsIPAllowed(t *testing.T) {
+	s := &IPAllowlistService{ranges: cache.NewLocal[uuid.UUID, []string](time.Minute, func() bool { return true })}
+	open, restricted := uuid.New(), uuid.New()
+	// Seed the cache so no query runs
+	for orgID, ranges := range map[uuid.UUID][]string{open: {}, restricted: {"192.0.2.0/24"}} {
+		s.ranges.Load(orgID, func() ([]string, error) { return ranges, nil })
+	}
+	ctx := context.Background()
+
+	for _, tc := range []struct {
+		orgID uuid.UUID
+		ip    string
+		want  bool
+	}{
+		// An org without entries allows everyone
+		{open, "198.51.100.1", true},
+		{open, "2001:db8::1", true},
+		{restricted, "192.0.2.44", true},
+		{restricted, "198.51.100.1", false},
+		{restricted, "", false},
+	} {
+		got, err := s.IsIPAllowed(ctx, tc.orgID, tc.ip)
+		if err != nil || got != tc.want {
+			t.Errorf("IsIPAllowed(%s) = %v, %v; want %v", tc.ip, got, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+const (
+	// MaintenanceKey holds the maintenance state shared by all API instances.
+	// Operators can toggle it directly, e.g.
+	//   SET glassbox:maintenance '{"enabled":true,"message":"Upgrading database"}'
+	MaintenanceKey = "glassbox:maintenance"
+
+	defaultMaintenanceMessage = "The API is in read-only mode for scheduled maintenance. Please try again shortly."
+
+	// How long an instance trusts its last read of the Redis flag
+	maintenanceCacheTTL = 5 * time.Second
+)
+
+// MaintenanceState describes whether the API is in read-only mode
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// MaintenanceService reads and toggles the read-only maintenance flag.
+// The flag lives in Redis so it can be flipped at runtime across all instances;
+// MAINTENANCE_MODE=true in config forces it on regardless.
+type MaintenanceService struct {
+	redis  *database.Redis
+	cfg    *config.Config
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	cached    MaintenanceState
+	fetchedAt time.Time
+}
+
+func NewMaintenanceService(redis *database.Redis, cfg *config.Config, logger *zap.Logger) *MaintenanceService {
+	return &MaintenanceService{redis: redis, cfg: cfg, logger: logger}
+}
+
+// Status returns the current maintenance state, cached briefly per instance
+func (s *MaintenanceService) Status(ctx context.Context) MaintenanceState {
+	if s.cfg.MaintenanceMode {
+		return MaintenanceState{Enabled: true, Message: defaultMaintenanceMessage}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.fetchedAt) < maintenanceCacheTTL {
+		return s.cached
+	}
+
+	state := MaintenanceState{}
+	data, err := s.redis.Client.Get(ctx, MaintenanceKey).Bytes()
+	switch {
+	case err == redis.Nil:
+		// Not in maintenance
+	case err != nil:
+		// Keep serving with the last known state rather than failing requests
+		s.logger.Warn("Failed to read maintenance flag", zap.Error(err))
+		return s.cached
+	default:
+		if err := json.Unmarshal(data, &state); err != nil {
+			s.logger.Warn("Invalid maintenance flag value", zap.Error(err))
+		}
+	}
+
+	if state.Enabled && state.Message == "" {
+		state.Message = defaultMaintenanceMessage
+	}
+
+	s.cached = state
+	s.fetchedAt = time.Now()
+	return state
+}
+
+// ReadOnly implements middleware.MaintenanceChecker
+func (s *MaintenanceService) ReadOnly(ctx context.Context) (bool, string) {
+	state := s.Status(ctx)
+	return state.Enabled, state.Message
+}
+
+// Enable switches all instances into read-only mode
+func (s *MaintenanceService) Enable(ctx context.Context, message string) error {
+	now := time.Now()
+	data, err := json.Marshal(MaintenanceState{Enabled: true, Message: message, Since: &now})
+	if err != nil {
+		return fmt.Errorf("failed to marshal maintenance state: %w", err)
+	}
+	if err := s.redis.Client.Set(ctx, MaintenanceKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to enable maintenance mode: %w", err)
+	}
+	s.resetCache()
+	return nil
+}
+
+// Disable returns all instances to normal operation
+func (s *MaintenanceService) Disable(ctx context.Context) error {
+	if err := s.redis.Client.Del(ctx, MaintenanceKey).Err(); err != nil {
+		return fmt.Errorf("failed to disable maintenance mode: %w", err)
+	}
+	s.resetCache()
+	return nil
+}
+
+func (s *MaintenanceService) resetCache() {
+	s.mu.Lock()
+	s.fetchedAt = time.Time{}
+	s.mu.Unlock()
+}
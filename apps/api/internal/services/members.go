@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	memberSearchDefaultLimit = 10
+	memberSearchMaxLimit     = 25
+)
+
+// SearchMembersRequest is a member lookup for pickers and autocomplete
+type SearchMembersRequest struct {
+	Query string `form:"q" binding:"required,max=100"`
+	Limit int    `form:"limit" binding:"omitempty,min=1,max=25"`
+}
+
+// MemberMatch is an org member found by SearchMembers. It carries only what
+// a picker shows.
+type MemberMatch struct {
+	UserID    uuid.UUID `json:"userId"`
+	Name      *string   `json:"name,omitempty"`
+	Email     string    `json:"email"`
+	AvatarURL *string   `json:"avatarUrl,omitempty"`
+	Role      string    `json:"role"`
+}
+
+// SearchMembers finds active members of the org whose name or email starts
+// with the query, case-insensitively. Name matches come first. Only
+// members are searched, so callers never see users outside the org.
+func (s *OrganizationService) SearchMembers(ctx context.Context, orgID uuid.UUID, req SearchMembersRequest) ([]MemberMatch, error) {
+	limit := req.Limit
+	if limit <= 0 || limit > memberSearchMaxLimit {
+		limit = memberSearchDefaultLimit
+	}
+	prefix := likePrefix(strings.ToLower(strings.TrimSpace(req.Query)))
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT u.id, u.name, u.email, u.avatar_url, m.role
+		FROM org_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1
+		  AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
+		  AND (lower(u.name) LIKE $2 OR lower(u.email) LIKE $2)
+		ORDER BY COALESCE(lower(u.name) LIKE $2, FALSE) DESC, lower(COALESCE(u.name, u.email)), u.id
+		LIMIT $3
+	`, orgID, prefix, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search members: %w", err)
+	}
+	defer rows.Close()
+
+	matches := []MemberMatch{}
+	for rows.Next() {
+		var m MemberMatch
+		if err := rows.Scan(&m.UserID, &m.Name, &m.Email, &m.AvatarURL, &m.Role); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+// likePrefix returns a LIKE pattern matching strings that start with s,
+// with LIKE's wildcards in s escaped
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxMentions caps the users one text can mention
+const maxMentions = 20
+
+// mentionExcerptLength is how much of the text a mention keeps, in bytes
+const mentionExcerptLength = 200
+
+// mentionPattern matches a mention as the editor writes it: the user's name
+// in brackets followed by their ID, as in @[Jane Doe](user-uuid)
+var mentionPattern = regexp.MustCompile(`@\[([^\]\n]{1,100})\]\(([0-9a-fA-F-]{36})\)`)
+
+// Mention is a place the user was mentioned
+type Mention struct {
+	ID              uuid.UUID  `json:"id"`
+	OrgID           uuid.UUID  `json:"orgId"`
+	ResourceType    string     `json:"resourceType"`
+	ResourceID      uuid.UUID  `json:"resourceId"`
+	ProjectID       *uuid.UUID `json:"projectId,omitempty"`
+	Title           string     `json:"title"`
+	Excerpt         *string    `json:"excerpt,omitempty"`
+	MentionedBy     *uuid.UUID `json:"mentionedBy,omitempty"`
+	MentionedByName *string    `json:"mentionedByName,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// ListMentionsRequest pages through a user's mentions
+type ListMentionsRequest struct {
+	OrgID *string `form:"orgId" binding:"omitempty,uuid"`
+	pagination.Params
+}
+
+// parseMentions returns the distinct users text mentions, in order, up to
+// maxMentions
+func parseMentions(text string) []uuid.UUID {
+	var users []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, m := range mentionPattern.FindAllStringSubmatch(text, -1) {
+		id, err := uuid.Parse(m[2])
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		users = append(users, id)
+		if len(users) == maxMentions {
+			break
+		}
+	}
+	return users
+}
+
+// mentionExcerpt is the start of text with mentions shown as @name
+func mentionExcerpt(text string) string {
+	text = strings.TrimSpace(mentionPattern.ReplaceAllString(text, "@$1"))
+	return truncateUTF8(text, mentionExcerptLength)
+}
+
+// recordMentions stores the mentions in a node's description, in the
+// transaction that saved it, and returns the users mentioned for the first
+// time. Only members of the node's org can be mentioned, and users
+// mentioning themselves are left out.
+func recordMentions(ctx context.Context, tx pgx.Tx, node *models.Node, actorID uuid.UUID) ([]uuid.UUID, error) {
+	if node.Description == nil {
+		return nil, nil
+	}
+	users := parseMentions(*node.Description)
+	if len(users) == 0 {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		INSERT INTO mentions (org_id, user_id, mentioned_by, resource_type, resource_id, excerpt)
+		SELECT $1, om.user_id, $2, $3, $4, $5
+		FROM org_members om
+		WHERE om.org_id = $1 AND om.user_id = ANY($6::UUID[]) AND om.user_id <> $2
+		ON CONFLICT (resource_type, resource_id, user_id) DO NOTHING
+		RETURNING user_id
+	`, node.OrgID, actorID, string(authz.ResourceNode), node.ID, mentionExcerpt(*node.Description), users)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record mentions: %w", err)
+	}
+	mentioned, err := pgx.CollectRows(rows, pgx.RowTo[uuid.UUID])
+	if err != nil {
+		return nil, fmt.Errorf("failed to record mentions: %w", err)
+	}
+	return mentioned, nil
+}
+
+// ListMentions returns a page of the places the user was mentioned, newest
+// first, in the orgs they are still a member of. Mentions in deleted nodes
+// are left out.
+func (s *UserService) ListMentions(ctx context.Context, userID uuid.UUID, req ListMentionsRequest) (*pagination.Page[Mention], error) {
+	afterCreated, afterID, err := req.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := req.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT m.id, m.org_id, m.resource_type, m.resource_id, n.project_id, n.title, m.excerpt,
+		       m.mentioned_by, COALESCE(u.name, u.email), m.created_at
+		FROM mentions m
+		JOIN nodes n ON m.resource_type = 'node' AND n.id = m.resource_id
+		LEFT JOIN users u ON u.id = m.mentioned_by
+		WHERE m.user_id = $1 AND n.deleted_at IS NULL
+		  AND m.org_id IN (SELECT org_id FROM org_members WHERE user_id = $1)
+		  AND ($2::UUID IS NULL OR m.org_id = $2)
+		  AND ($3::TIMESTAMPTZ IS NULL OR (m.created_at, m.id) < ($3, $4::UUID))
+		ORDER BY m.created_at DESC, m.id DESC
+		LIMIT $5
+	`, userID, req.OrgID, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var items []Mention
+	for rows.Next() {
+		var m Mention
+		if err := rows.Scan(&m.ID, &m.OrgID, &m.ResourceType, &m.ResourceID, &m.ProjectID, &m.Title, &m.Excerpt,
+			&m.MentionedBy, &m.MentionedByName, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mention: %w", err)
+		}
+		items = append(items, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list mentions: %w", err)
+	}
+
+	return pagination.NewPage(items, limit, func(m Mention) pagination.Cursor {
+		return pagination.TimeCursor(m.CreatedAt, m.ID)
+	}), nil
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestParseMentions(t *testing.T) {
+	ada, bob := uuid.New(), uuid.New()
+	upper := strings.ToUpper(ada.String())
+
+	for _, tc := range []struct {
+		name string
+		text string
+		want []uuid.UUID
+	}{
+		{"none", "No one to tell", nil},
+		{"one", "Ask @[Ada Lovelace](" + ada.String() + ") first", []uuid.UUID{ada}},
+		{"in order", "@[Bob](" + bob.String() + ") then @[Ada](" + ada.String() + ")", []uuid.UUID{bob, ada}},
+		// Punctuation around a mention, or inside the name, doesn't matter
+		{"punctuation", "(cc @[Ada](" + ada.String() + "), @[O'Brien, Bob-Jr.](" + bob.String() + ")!)", []uuid.UUID{ada, bob}},
+		{"no space before", "thanks@[Ada](" + ada.String() + ")", []uuid.UUID{ada}},
+		// Email addresses and bare handles aren't mentions
+		{"email", "Mail ada@example.com or @ada", nil},
+		{"email-like name", "@[ada@example.com](" + ada.String() + ")", []uuid.UUID{ada}},
+		{"duplicates", "@[Ada](" + ada.String() + ") and @[Ada L.](" + ada.String() + ") and @[ada](" + upper + ")", []uuid.UUID{ada}},
+		{"malformed ID", "@[Ada](" + ada.String()[:35] + ")", nil},
+		{"not a UUID", "@[Ada](" + strings.Repeat("-", 36) + ")", nil},
+		{"empty name", "@[](" + ada.String() + ")", nil},
+		{"name across lines", "@[Ada\nLovelace](" + ada.String() + ")", nil},
+		{"name too long", "@[" + strings.Repeat("a", 101) + "](" + ada.String() + ")", nil},
+	} {
+		if got := parseMentions(tc.text); !slices.Equal(got, tc.want) {
+			t.Errorf("%s: parseMentions = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseMentionsCap(t *testing.T) {
+	var text strings.Builder
+	var want []uuid.UUID
+	for i := range maxMentions + 5 {
+		id := uuid.New()
+		if i < maxMentions {
+			want = append(want, id)
+		}
+		fmt.Fprintf(&text, "@[User %d](%s) ", i, id)
+	}
+	if got := parseMentions(text.String()); !slices.Equal(got, want) {
+		t.Fatalf("got %d mentions, want the first %d", len(got), maxMentions)
+	}
+}
+
+func TestMentionExcerpt(t *testing.T) {
+	ada := uuid.New()
+	text := "  Ask @[Ada Lovelace](" + ada.String() + "), she knows.  "
+	if got, want := mentionExcerpt(text), "Ask @Ada Lovelace, she knows."; got != want {
+		t.Fatalf("mentionExcerpt = %q, want %q", got, want)
+	}
+	long := strings.Repeat("é", mentionExcerptLength)
+	if got := mentionExcerpt(long); len(got) > mentionExcerptLength || !strings.HasPrefix(long, got) {
+		t.Fatalf("excerpt of %d bytes isn't a prefix within %d bytes", len(got), mentionExcerptLength)
+	}
+}
@@ -0,0 +1,514 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Notification types
+const (
+	NotificationNodeUpdated       = "node_updated"
+	NotificationNodeAssigned      = "node_assigned"
+	NotificationExecutionComplete = "execution_complete"
+	NotificationExecutionFailed   = "execution_failed"
+	NotificationHumanInputNeeded  = "human_input_needed"
+	NotificationApprovalRequest   = "approval_request"
+	NotificationMention           = "mention"
+	NotificationMembershipChanged = "membership_changed"
+)
+
+// An unread notification of the same type about the same resource created
+// within this window is updated by the next one, rather than joined by it,
+// so a burst of edits or retries doesn't flood the user
+const notificationCoalesceWindow = 10 * time.Minute
+
+// Unread counts are cached in Redis and deleted whenever a notification is
+// created or read. The TTL only bounds how long a missed deletion lasts.
+const (
+	unreadCountCachePrefix = "notifications:unread:"
+	unreadCountCacheTTL    = 5 * time.Minute
+)
+
+// NotificationPusher delivers a new notification to the user's connected
+// clients along with their unread count
+type NotificationPusher func(notification *models.Notification, unreadCount int)
+
+// NotificationService records in-app notifications and pushes them to the
+// recipient as they are created. Services and handlers report what happened
+// (a node changed, an execution finished) and it works out who to tell.
+// Failing to notify never fails the change itself: callers log the error.
+type NotificationService struct {
+	db    *database.DB
+	redis *database.Redis
+	// Webhooks receive execution notifications, and browser push
+	// subscriptions high-priority ones; nil disables either
+	webhooks *WebhookService
+	webPush  *WebPushService
+	mail     Mailer
+	push     NotificationPusher
+	logger   *zap.Logger
+}
+
+func NewNotificationService(db *database.DB, redis *database.Redis, webhooks *WebhookService, webPush *WebPushService, logger *zap.Logger) *NotificationService {
+	return &NotificationService{db: db, redis: redis, webhooks: webhooks, webPush: webPush, logger: logger}
+}
+
+// SetMailer enables email for the types users chose to get by email
+func (s *NotificationService) SetMailer(mail Mailer) {
+	s.mail = mail
+}
+
+// SetPusher enables real-time delivery. Without it notifications are only
+// stored.
+func (s *NotificationService) SetPusher(push NotificationPusher) {
+	s.push = push
+}
+
+// Create delivers a notification over the channels the user chose for its
+// type (see notificationChannels). In-app, it is stored, filling in its ID,
+// count and creation time, and pushed to the user's connected clients; a
+// repeat of an unread notification about the same resource within
+// notificationCoalesceWindow updates that one instead. Low-priority
+// notifications for users with a digest schedule are stored but not pushed.
+// During the user's quiet hours, email and push wait until they end, except
+// for urgentTypes. n.ID stays nil when it isn't stored. Deactivated and
+// deleted users get nothing.
+func (s *NotificationService) Create(ctx context.Context, n *models.Notification) error {
+	var active, inApp bool
+	var email string
+	var prefsJSON []byte
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT deactivated_at IS NULL AND deleted_at IS NULL, email,
+		       COALESCE((settings->'notifications'->>'inApp')::BOOLEAN, TRUE),
+		       settings->'notifications'
+		FROM users WHERE id = $1
+	`, n.UserID).Scan(&active, &email, &inApp, &prefsJSON)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && !active) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	prefs, err := notificationPreferences(prefsJSON)
+	if err != nil {
+		s.logger.Warn("Invalid notification preferences, using defaults",
+			zap.String("user_id", n.UserID.String()), zap.Error(err))
+	}
+	prefs.InApp = inApp
+	channels := notificationChannels(prefs, n.Type)
+
+	if channels.InApp {
+		if err := s.store(ctx, n); err != nil {
+			return err
+		}
+	}
+	channels.Push = channels.Push && s.webPush != nil
+	channels.Email = channels.Email && s.mail != nil
+	if until, quiet := quietUntil(prefs, time.Now()); quiet && !urgentTypes[n.Type] && (channels.Push || channels.Email) {
+		if err := s.deferDelivery(ctx, n, channels, until); err != nil {
+			return err
+		}
+	} else {
+		if channels.Push {
+			s.webPush.Send(n)
+		}
+		if channels.Email {
+			s.email(email, n)
+		}
+	}
+
+	// Low-priority notifications wait for the user's digest
+	digested := prefs.Digest == "daily" || prefs.Digest == "weekly"
+	if !channels.InApp || s.push == nil || (digested && isDigestType(n.Type)) {
+		return nil
+	}
+	// The notification is stored either way; clients that miss the push see
+	// it when they next list notifications
+	unread, err := s.UnreadCount(ctx, n.UserID)
+	if err != nil {
+		s.logger.Warn("Failed to count unread notifications", zap.Error(err))
+		return nil
+	}
+	s.push(n, unread)
+	return nil
+}
+
+// store inserts or coalesces an in-app notification and invalidates the
+// user's cached unread count
+func (s *NotificationService) store(ctx context.Context, n *models.Notification) error {
+	err := pgx.ErrNoRows
+	if n.ResourceID != nil {
+		err = s.db.Pool.QueryRow(ctx, `
+			UPDATE notifications SET title = $4, body = $5, count = count + 1, created_at = NOW()
+			WHERE id = (
+				SELECT id FROM notifications
+				WHERE user_id = $1 AND type = $2 AND resource_id = $3 AND read_at IS NULL
+				  AND created_at > NOW() - make_interval(secs => $6)
+				ORDER BY created_at DESC
+				LIMIT 1
+			)
+			RETURNING id, count, created_at
+		`, n.UserID, n.Type, *n.ResourceID, n.Title, n.Body, notificationCoalesceWindow.Seconds()).Scan(&n.ID, &n.Count, &n.CreatedAt)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to coalesce notification: %w", err)
+		}
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = s.db.Pool.QueryRow(ctx, `
+			INSERT INTO notifications (user_id, org_id, type, title, body, resource_type, resource_id)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING id, count, created_at
+		`, n.UserID, n.OrgID, n.Type, n.Title, n.Body, n.ResourceType, n.ResourceID).Scan(&n.ID, &n.Count, &n.CreatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create notification: %w", err)
+		}
+	}
+	s.invalidateUnread(ctx, n.UserID)
+	return nil
+}
+
+// NotificationChannels are where one notification is delivered
+type NotificationChannels struct {
+	InApp bool
+	Email bool
+	Push  bool
+}
+
+// Channel names used in settings.notifications.types
+const (
+	ChannelInApp = "inApp"
+	ChannelEmail = "email"
+	ChannelPush  = "push"
+)
+
+// notificationPreferences parses a user's settings->'notifications'. When
+// it fails, e.g. for settings written by hand, it returns the defaults
+// rather than whatever parsed before the error.
+func notificationPreferences(data []byte) (models.NotificationPreferences, error) {
+	var prefs models.NotificationPreferences
+	if data == nil {
+		return prefs, nil
+	}
+	if err := json.Unmarshal(data, &prefs); err != nil {
+		return models.NotificationPreferences{}, fmt.Errorf("failed to parse notification preferences: %w", err)
+	}
+	return prefs, nil
+}
+
+// notificationChannels returns the channels the user chose for a type in
+// prefs.Types. Types they didn't list fall back to the global switches:
+// in-app per prefs.InApp, browser push for the high-priority pushTypes,
+// and no email (prefs.Email only covers digests). An empty list turns a
+// type off.
+func notificationChannels(prefs models.NotificationPreferences, kind string) NotificationChannels {
+	chosen, ok := prefs.Types[kind]
+	if !ok {
+		return NotificationChannels{InApp: prefs.InApp, Push: pushTypes[kind]}
+	}
+	return NotificationChannels{
+		InApp: slices.Contains(chosen, ChannelInApp),
+		// DigestService emails digests itself, once for all orgs
+		Email: slices.Contains(chosen, ChannelEmail) && kind != NotificationDigest,
+		Push:  slices.Contains(chosen, ChannelPush),
+	}
+}
+
+// email sends a notification by email in the background
+func (s *NotificationService) email(to string, n *models.Notification) {
+	body := deref(n.Body)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+		if err := s.mail(ctx, to, n.Title, body); err != nil {
+			s.logger.Warn("Failed to email notification", zap.String("type", n.Type), zap.Error(err))
+		}
+	}()
+}
+
+// UnreadCount returns how many of the user's notifications are unread.
+// Counts are cached in Redis.
+func (s *NotificationService) UnreadCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	cacheKey := unreadCountCachePrefix + userID.String()
+
+	count, err := s.redis.Client.Get(ctx, cacheKey).Int()
+	if err == nil {
+		return count, nil
+	}
+	if err != redis.Nil {
+		s.logger.Warn("Failed to read unread count cache", zap.Error(err))
+	}
+
+	err = s.db.Pool.QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+
+	s.redis.Client.Set(ctx, cacheKey, count, unreadCountCacheTTL)
+	return count, nil
+}
+
+// MarkRead marks one of the user's notifications as read. Notifications
+// that are missing, the user's, or already read are ErrNotFound.
+func (s *NotificationService) MarkRead(ctx context.Context, userID, notificationID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND read_at IS NULL
+	`, notificationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification read: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	s.invalidateUnread(ctx, userID)
+	return nil
+}
+
+// MarkAllRead marks all of the user's notifications as read and returns how
+// many were unread
+func (s *NotificationService) MarkAllRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := s.db.Pool.Exec(ctx, `
+		UPDATE notifications SET read_at = NOW()
+		WHERE user_id = $1 AND read_at IS NULL
+	`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications read: %w", err)
+	}
+
+	s.invalidateUnread(ctx, userID)
+	return result.RowsAffected(), nil
+}
+
+// invalidateUnread drops the user's cached unread count after their
+// notifications changed
+func (s *NotificationService) invalidateUnread(ctx context.Context, userID uuid.UUID) {
+	if err := s.redis.Client.Del(ctx, unreadCountCachePrefix+userID.String()).Err(); err != nil {
+		s.logger.Warn("Failed to invalidate unread count cache", zap.Error(err))
+	}
+}
+
+// NodeUpdated tells the node's author and supervisor that someone else
+// changed it. When the change assigned a new supervisor, they are told they
+// were assigned instead.
+func (s *NotificationService) NodeUpdated(ctx context.Context, node *models.Node, actorID uuid.UUID, assigned bool) error {
+	actor, err := s.userName(ctx, actorID)
+	if err != nil {
+		return err
+	}
+	body := "Updated by " + actor
+
+	for _, userID := range recipients(actorID, node.AuthorUserID, node.SupervisorUserID) {
+		n := nodeNotification(node, userID, NotificationNodeUpdated, node.Title+" was updated", body)
+		if assigned && node.SupervisorUserID != nil && userID == *node.SupervisorUserID {
+			n = nodeNotification(node, userID, NotificationNodeAssigned, "You were assigned "+node.Title, "Assigned by "+actor)
+		}
+		if err := s.Create(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExecutionStatusChanged tells the user who started an execution that it
+// finished, failed or is waiting for their input or approval. Executions
+// started before started_by was recorded notify the node's supervisor, or
+// its author. Other statuses notify no one. The notification also goes to
+// the recipient's and the org's webhooks, even if in-app notifications are
+// off.
+func (s *NotificationService) ExecutionStatusChanged(ctx context.Context, executionID uuid.UUID, status string) error {
+	if status != "complete" && status != "failed" && status != "awaiting_input" {
+		return nil
+	}
+
+	var node models.Node
+	var recipient *uuid.UUID
+	var requestType, prompt, errorMessage *string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT n.id, n.org_id, n.project_id, n.title,
+		       COALESCE(e.started_by, n.supervisor_user_id, n.author_user_id),
+		       e.langgraph_checkpoint->'humanInputRequest'->>'requestType',
+		       e.langgraph_checkpoint->'humanInputRequest'->>'prompt',
+		       e.error_message
+		FROM agent_executions e
+		JOIN nodes n ON n.id = e.node_id
+		WHERE e.id = $1
+	`, executionID).Scan(&node.ID, &node.OrgID, &node.ProjectID, &node.Title, &recipient, &requestType, &prompt, &errorMessage)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get execution: %w", err)
+	}
+	if recipient == nil {
+		return nil
+	}
+
+	var n *models.Notification
+	switch {
+	case status == "complete":
+		n = nodeNotification(&node, *recipient, NotificationExecutionComplete, "Agent finished "+node.Title, "")
+	case status == "failed":
+		n = nodeNotification(&node, *recipient, NotificationExecutionFailed, "Agent failed on "+node.Title, deref(errorMessage))
+	case requestType != nil && *requestType == "approval":
+		n = nodeNotification(&node, *recipient, NotificationApprovalRequest, node.Title+" needs your approval", deref(prompt))
+	default:
+		n = nodeNotification(&node, *recipient, NotificationHumanInputNeeded, node.Title+" needs your input", deref(prompt))
+	}
+	if s.webhooks != nil {
+		s.webhooks.Dispatch(n, &executionID)
+	}
+	return s.Create(ctx, n)
+}
+
+// Message stores a worker's message for a user, such as a mention, as a
+// notification in the org
+func (s *NotificationService) Message(ctx context.Context, userID, orgID uuid.UUID, kind, title, body string) error {
+	n := &models.Notification{UserID: userID, OrgID: orgID, Type: kind, Title: title}
+	if body != "" {
+		n.Body = &body
+	}
+	return s.Create(ctx, n)
+}
+
+// Mentioned tells users they were mentioned in a node's description
+func (s *NotificationService) Mentioned(ctx context.Context, node *models.Node, actorID uuid.UUID, users []uuid.UUID) error {
+	if len(users) == 0 {
+		return nil
+	}
+	actor, err := s.userName(ctx, actorID)
+	if err != nil {
+		return err
+	}
+
+	body := mentionExcerpt(deref(node.Description))
+	for _, userID := range users {
+		n := nodeNotification(node, userID, NotificationMention, actor+" mentioned you in "+node.Title, body)
+		if err := s.Create(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MembershipChanged tells the org's owners and admins, and the member
+// unless they made the change, that a member was added, removed or changed
+// role. change is MembershipAdded, MembershipRemoved or
+// MembershipRoleChanged.
+func (s *NotificationService) MembershipChanged(ctx context.Context, orgID, userID, actorID uuid.UUID, change string) error {
+	var orgName string
+	err := s.db.Pool.QueryRow(ctx, `SELECT name FROM organizations WHERE id = $1`, orgID).Scan(&orgName)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get org: %w", err)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT user_id FROM org_members
+		WHERE org_id = $1 AND role IN ($2, $3) AND user_id <> $4
+	`, orgID, string(authz.RoleOwner), string(authz.RoleAdmin), actorID)
+	if err != nil {
+		return fmt.Errorf("failed to list org admins: %w", err)
+	}
+	users, err := pgx.CollectRows(rows, pgx.RowToAddrOf[uuid.UUID])
+	if err != nil {
+		return fmt.Errorf("failed to list org admins: %w", err)
+	}
+
+	titles := map[string]string{
+		MembershipAdded:       "A member joined " + orgName,
+		MembershipRemoved:     "A member left " + orgName,
+		MembershipRoleChanged: "A member's role changed in " + orgName,
+	}
+	memberTitles := map[string]string{
+		MembershipAdded:       "You were added to " + orgName,
+		MembershipRemoved:     "You were removed from " + orgName,
+		MembershipRoleChanged: "Your role in " + orgName + " changed",
+	}
+	resourceType := string(authz.ResourceOrg)
+	for _, recipient := range recipients(actorID, append(users, &userID)...) {
+		n := &models.Notification{
+			UserID:       recipient,
+			OrgID:        orgID,
+			Type:         NotificationMembershipChanged,
+			Title:        titles[change],
+			ResourceType: &resourceType,
+			ResourceID:   &orgID,
+		}
+		if recipient == userID {
+			n.Title = memberTitles[change]
+		}
+		if err := s.Create(ctx, n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// userName is how notifications name a user
+func (s *NotificationService) userName(ctx context.Context, userID uuid.UUID) (string, error) {
+	var name string
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT COALESCE(name, email) FROM users WHERE id = $1
+	`, userID).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "someone", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+	return name, nil
+}
+
+// nodeNotification is a notification about a node
+func nodeNotification(node *models.Node, userID uuid.UUID, kind, title, body string) *models.Notification {
+	resourceType := string(authz.ResourceNode)
+	n := &models.Notification{
+		UserID:       userID,
+		OrgID:        node.OrgID,
+		Type:         kind,
+		Title:        title,
+		ResourceType: &resourceType,
+		ResourceID:   &node.ID,
+	}
+	if body != "" {
+		n.Body = &body
+	}
+	return n
+}
+
+// recipients returns the distinct users, leaving out nils and actorID
+func recipients(actorID uuid.UUID, users ...*uuid.UUID) []uuid.UUID {
+	seen := map[uuid.UUID]bool{actorID: true}
+	var result []uuid.UUID
+	for _, u := range users {
+		if u != nil && !seen[*u] {
+			seen[*u] = true
+			result = append(result, *u)
+		}
+	}
+	return result
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
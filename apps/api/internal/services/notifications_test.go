@@ -0,0 +1,31 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/glassbox/api/internal/models"
+)
+
+func TestNotificationPreferences(t *testing.T) {
+	prefs, err := notificationPreferences([]byte(`{"digest": "daily", "digestHour": 8, "types": {"mention": ["email"]}}`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if prefs.Digest != "daily" || prefs.DigestHour != 8 || !reflect.DeepEqual(prefs.Types["mention"], []string{"email"}) {
+		t.Fatalf("prefs = %+v", prefs)
+	}
+
+	if prefs, err := notificationPreferences(nil); err != nil || !reflect.DeepEqual(prefs, models.NotificationPreferences{}) {
+		t.Fatalf("no settings = %+v, %v; want defaults", prefs, err)
+	}
+
+	// Fields before the bad one parse, but mustn't be used
+	prefs, err = notificationPreferences([]byte(`{"digest": "weekly", "digestHour": "eight"}`))
+	if err == nil {
+		t.Fatal("parsed a string hour")
+	}
+	if !reflect.DeepEqual(prefs, models.NotificationPreferences{}) {
+		t.Fatalf("invalid settings = %+v, want defaults", prefs)
+	}
+}
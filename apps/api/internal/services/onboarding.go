@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// Onboarding checklist steps
+const (
+	OnboardingCreatedOrg     = "created_org"
+	OnboardingCreatedProject = "created_project"
+	OnboardingCreatedNode    = "created_node"
+	OnboardingUploadedFile   = "uploaded_file"
+	OnboardingRanAgent       = "ran_agent"
+	OnboardingInvitedMember  = "invited_member"
+)
+
+// onboardingSteps is the checklist, in the order it is shown
+var onboardingSteps = []struct{ id, title string }{
+	{OnboardingCreatedOrg, "Create an organization"},
+	{OnboardingCreatedProject, "Create your first project"},
+	{OnboardingCreatedNode, "Add a node"},
+	{OnboardingUploadedFile, "Upload a file"},
+	{OnboardingRanAgent, "Run an agent"},
+	{OnboardingInvitedMember, "Invite a teammate"},
+}
+
+// OnboardingStep is one checklist item
+type OnboardingStep struct {
+	ID          string     `json:"id"`
+	Title       string     `json:"title"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+}
+
+// Onboarding is a user's checklist
+type Onboarding struct {
+	Steps       []OnboardingStep `json:"steps"`
+	Completed   int              `json:"completed"`
+	Total       int              `json:"total"`
+	DismissedAt *time.Time       `json:"dismissedAt,omitempty"`
+}
+
+// UpdateOnboardingRequest marks steps complete, and hides or shows the
+// checklist
+type UpdateOnboardingRequest struct {
+	Complete  []string `json:"complete" binding:"omitempty,max=10,dive,oneof=created_org created_project created_node uploaded_file ran_agent invited_member"`
+	Dismissed *bool    `json:"dismissed"`
+}
+
+// OnboardingService serves the onboarding checklist. Services record steps
+// with recordOnboarding in the transaction that completes them, so the
+// checklist fills in as users go.
+type OnboardingService struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+func NewOnboardingService(db *database.DB, logger *zap.Logger) *OnboardingService {
+	return &OnboardingService{db: db, logger: logger}
+}
+
+// Get returns the user's checklist
+func (s *OnboardingService) Get(ctx context.Context, userID uuid.UUID) (*Onboarding, error) {
+	var dismissedAt *time.Time
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT onboarding_dismissed_at FROM users WHERE id = $1
+	`, userID).Scan(&dismissedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onboarding: %w", err)
+	}
+
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT step, completed_at FROM user_onboarding_steps WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get onboarding steps: %w", err)
+	}
+	defer rows.Close()
+	completed := map[string]time.Time{}
+	for rows.Next() {
+		var step string
+		var at time.Time
+		if err := rows.Scan(&step, &at); err != nil {
+			return nil, fmt.Errorf("failed to scan onboarding step: %w", err)
+		}
+		completed[step] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get onboarding steps: %w", err)
+	}
+
+	o := &Onboarding{Steps: make([]OnboardingStep, len(onboardingSteps)), Total: len(onboardingSteps), DismissedAt: dismissedAt}
+	for i, step := range onboardingSteps {
+		o.Steps[i] = OnboardingStep{ID: step.id, Title: step.title}
+		if at, ok := completed[step.id]; ok {
+			o.Steps[i].CompletedAt = &at
+			o.Completed++
+		}
+	}
+	return o, nil
+}
+
+// Update marks steps complete and dismisses or restores the checklist, then
+// returns it. Steps stay complete once recorded.
+func (s *OnboardingService) Update(ctx context.Context, userID uuid.UUID, req UpdateOnboardingRequest) (*Onboarding, error) {
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		for _, step := range req.Complete {
+			if err := recordOnboarding(ctx, tx, userID, step); err != nil {
+				return err
+			}
+		}
+		if req.Dismissed != nil {
+			_, err := tx.Exec(ctx, `
+				UPDATE users SET onboarding_dismissed_at = CASE WHEN $2 THEN COALESCE(onboarding_dismissed_at, NOW()) END
+				WHERE id = $1
+			`, userID, *req.Dismissed)
+			if err != nil {
+				return fmt.Errorf("failed to dismiss onboarding: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.Get(ctx, userID)
+}
+
+// recordOnboarding marks a step complete for the user, keeping the first
+// completion time. It runs in the transaction that completed the step.
+func recordOnboarding(ctx context.Context, tx pgx.Tx, userID uuid.UUID, step string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO user_onboarding_steps (user_id, step) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to record onboarding step: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,343 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// ErrLastOwner is returned for a change that would leave an org without an
+// active owner
+var ErrLastOwner = errors.New("org must keep an owner")
+
+// Membership changes, as notified and broadcast
+const (
+	MembershipAdded       = "added"
+	MembershipRemoved     = "removed"
+	MembershipRoleChanged = "role_changed"
+)
+
+// roleRanks orders roles for member management: callers can't grant a role
+// above their own, or change or remove members who outrank them
+var roleRanks = map[authz.Role]int{
+	authz.RoleGuest:  1,
+	authz.RoleMember: 2,
+	authz.RoleAdmin:  3,
+	authz.RoleOwner:  4,
+}
+
+// OrgMember is a member of an org as admins manage them
+type OrgMember struct {
+	UserID      uuid.UUID `json:"userId"`
+	Email       string    `json:"email"`
+	Name        *string   `json:"name,omitempty"`
+	AvatarURL   *string   `json:"avatarUrl,omitempty"`
+	Role        string    `json:"role"`
+	Deactivated bool      `json:"deactivated,omitempty"`
+	JoinedAt    time.Time `json:"joinedAt"`
+}
+
+// InviteMemberRequest adds a user to an org by email
+type InviteMemberRequest struct {
+	Email string `json:"email" binding:"required,email,max=255"`
+	Role  string `json:"role" binding:"omitempty,oneof=owner admin member guest"` // default member
+}
+
+// UpdateMemberRoleRequest changes a member's role
+type UpdateMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=owner admin member guest"`
+}
+
+// OrgMembersService manages who belongs to an org. Callers must have
+// authorized authz.OrgMembers for changes and authz.OrgRead for listing;
+// the service checks the role rules on top: owners manage everyone, admins
+// manage admins, members and guests, and an org always keeps an active
+// owner.
+type OrgMembersService struct {
+	db            *database.DB
+	authz         *authz.Authorizer
+	notifications *NotificationService
+	logger        *zap.Logger
+}
+
+func NewOrgMembersService(db *database.DB, az *authz.Authorizer, notifications *NotificationService, logger *zap.Logger) *OrgMembersService {
+	return &OrgMembersService{db: db, authz: az, notifications: notifications, logger: logger}
+}
+
+// List returns a page of the org's members by name, deactivated ones
+// included so admins can remove them
+func (s *OrgMembersService) List(ctx context.Context, orgID uuid.UUID, page pagination.Params) (*pagination.Page[OrgMember], error) {
+	afterName, afterID, err := page.AfterString()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT u.id, u.email, u.name, u.avatar_url, m.role, u.deactivated_at IS NOT NULL, m.created_at
+		FROM org_members m
+		JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND u.deleted_at IS NULL
+		  AND ($2::TEXT IS NULL OR (lower(COALESCE(u.name, u.email)), u.id) > ($2, $3::UUID))
+		ORDER BY lower(COALESCE(u.name, u.email)), u.id
+		LIMIT $4
+	`, orgID, afterName, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+	defer rows.Close()
+
+	var members []OrgMember
+	for rows.Next() {
+		var m OrgMember
+		if err := rows.Scan(&m.UserID, &m.Email, &m.Name, &m.AvatarURL, &m.Role, &m.Deactivated, &m.JoinedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan member: %w", err)
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list members: %w", err)
+	}
+
+	result := pagination.NewPage(members, limit, memberCursor)
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM org_members m JOIN users u ON u.id = m.user_id
+		WHERE m.org_id = $1 AND u.deleted_at IS NULL
+	`, orgID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count members: %w", err)
+	}
+	return result, nil
+}
+
+// memberCursor is the cursor of a member in a list sorted by name
+func memberCursor(m OrgMember) pagination.Cursor {
+	return pagination.StringCursor(strings.ToLower(memberName(m)), m.UserID)
+}
+
+func memberName(m OrgMember) string {
+	if m.Name != nil {
+		return *m.Name
+	}
+	return m.Email
+}
+
+// Invite adds the active user with the email to the org and notifies them.
+// Returns ErrNotFound when no account has the email, ErrAlreadyExists when
+// they're already a member, and ErrForbidden when the role is above the
+// caller's.
+func (s *OrgMembersService) Invite(ctx context.Context, orgID, actorID uuid.UUID, req InviteMemberRequest) (*OrgMember, error) {
+	role := authz.Role(req.Role)
+	if role == "" {
+		role = authz.RoleMember
+	}
+	if err := s.checkGrant(ctx, orgID, actorID, role); err != nil {
+		return nil, err
+	}
+
+	var member OrgMember
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			SELECT id, email, name, avatar_url FROM users
+			WHERE lower(email) = lower($1) AND deactivated_at IS NULL AND deleted_at IS NULL
+			ORDER BY created_at
+			LIMIT 1
+		`, strings.TrimSpace(req.Email)).Scan(&member.UserID, &member.Email, &member.Name, &member.AvatarURL)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find user: %w", err)
+		}
+
+		err = tx.QueryRow(ctx, `
+			INSERT INTO org_members (org_id, user_id, role)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (org_id, user_id) DO NOTHING
+			RETURNING role, created_at
+		`, orgID, member.UserID, string(role)).Scan(&member.Role, &member.JoinedAt)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrAlreadyExists
+		}
+		if err != nil {
+			return fmt.Errorf("failed to add member: %w", err)
+		}
+		return recordOnboarding(ctx, tx, actorID, OnboardingInvitedMember)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.changed(ctx, orgID, member.UserID, actorID, MembershipAdded)
+	return &member, nil
+}
+
+// UpdateRole changes a member's role. Returns ErrNotFound for non-members,
+// ErrForbidden when the member or the new role outranks the caller, and
+// ErrLastOwner when it would demote the org's last active owner.
+func (s *OrgMembersService) UpdateRole(ctx context.Context, orgID, userID, actorID uuid.UUID, req UpdateMemberRoleRequest) (*OrgMember, error) {
+	role := authz.Role(req.Role)
+	if err := s.checkGrant(ctx, orgID, actorID, role); err != nil {
+		return nil, err
+	}
+
+	var member OrgMember
+	var changed bool
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		current, err := s.lockMember(ctx, tx, orgID, userID, actorID)
+		if err != nil {
+			return err
+		}
+		if current == authz.RoleOwner && role != authz.RoleOwner {
+			if err := requireOtherOwner(ctx, tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+		changed = current != role
+
+		return tx.QueryRow(ctx, `
+			UPDATE org_members m SET role = $3
+			FROM users u
+			WHERE m.org_id = $1 AND m.user_id = $2 AND u.id = m.user_id
+			RETURNING u.id, u.email, u.name, u.avatar_url, m.role, u.deactivated_at IS NOT NULL, m.created_at
+		`, orgID, userID, string(role)).Scan(
+			&member.UserID, &member.Email, &member.Name, &member.AvatarURL, &member.Role, &member.Deactivated, &member.JoinedAt,
+		)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if changed {
+		s.changed(ctx, orgID, userID, actorID, MembershipRoleChanged)
+	}
+	return &member, nil
+}
+
+// Remove takes a member out of the org, with their project memberships and
+// node locks in it, and returns the role they had. Returns ErrNotFound for
+// non-members, ErrForbidden when the member outranks the caller, and
+// ErrLastOwner for the org's last active owner.
+func (s *OrgMembersService) Remove(ctx context.Context, orgID, userID, actorID uuid.UUID) (string, error) {
+	var role authz.Role
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var err error
+		role, err = s.lockMember(ctx, tx, orgID, userID, actorID)
+		if err != nil {
+			return err
+		}
+		if role == authz.RoleOwner {
+			if err := requireOtherOwner(ctx, tx, orgID, userID); err != nil {
+				return err
+			}
+		}
+
+		for _, stmt := range []string{
+			`DELETE FROM org_members WHERE org_id = $1 AND user_id = $2`,
+			`DELETE FROM project_members WHERE user_id = $2 AND project_id IN (SELECT id FROM projects WHERE org_id = $1)`,
+			`UPDATE nodes SET locked_by = NULL, locked_at = NULL, lock_expires_at = NULL WHERE org_id = $1 AND locked_by = $2`,
+		} {
+			if _, err := tx.Exec(ctx, stmt, orgID, userID); err != nil {
+				return fmt.Errorf("failed to remove member: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	s.changed(ctx, orgID, userID, actorID, MembershipRemoved)
+	return string(role), nil
+}
+
+// checkGrant returns ErrForbidden when role is above the caller's own
+func (s *OrgMembersService) checkGrant(ctx context.Context, orgID, actorID uuid.UUID, role authz.Role) error {
+	actorRole, err := s.actorRole(ctx, orgID, actorID)
+	if err != nil {
+		return err
+	}
+	if roleRanks[role] > roleRanks[actorRole] {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// lockMember locks the member's row and returns their role, or
+// ErrForbidden when they outrank the caller
+func (s *OrgMembersService) lockMember(ctx context.Context, tx pgx.Tx, orgID, userID, actorID uuid.UUID) (authz.Role, error) {
+	var role string
+	err := tx.QueryRow(ctx, `
+		SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2 FOR UPDATE
+	`, orgID, userID).Scan(&role)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get member: %w", err)
+	}
+	actorRole, err := s.actorRole(ctx, orgID, actorID)
+	if err != nil {
+		return "", err
+	}
+	if roleRanks[authz.Role(role)] > roleRanks[actorRole] {
+		return "", ErrForbidden
+	}
+	return authz.Role(role), nil
+}
+
+// actorRole returns the caller's role, or ErrForbidden if they stopped
+// being a member since the route authorized them
+func (s *OrgMembersService) actorRole(ctx context.Context, orgID, actorID uuid.UUID) (authz.Role, error) {
+	role, err := s.authz.RoleIn(ctx, orgID, actorID)
+	if errors.Is(err, authz.ErrNotFound) {
+		return "", ErrForbidden
+	}
+	return role, err
+}
+
+// requireOtherOwner returns ErrLastOwner unless the org has an active owner
+// besides userID. The owners' rows are locked, so two owners can't both
+// step down at once.
+func requireOtherOwner(ctx context.Context, tx pgx.Tx, orgID, userID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		SELECT 1 FROM org_members WHERE org_id = $1 AND role = $2 FOR UPDATE
+	`, orgID, string(authz.RoleOwner))
+	if err != nil {
+		return fmt.Errorf("failed to lock owners: %w", err)
+	}
+
+	var others bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM org_members m
+			JOIN users u ON u.id = m.user_id
+			WHERE m.org_id = $1 AND m.role = $2 AND m.user_id <> $3
+			  AND u.deactivated_at IS NULL AND u.deleted_at IS NULL
+		)
+	`, orgID, string(authz.RoleOwner), userID).Scan(&others)
+	if err != nil {
+		return fmt.Errorf("failed to check org owners: %w", err)
+	}
+	if !others {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// changed drops the member's cached role and notifies the change
+func (s *OrgMembersService) changed(ctx context.Context, orgID, userID, actorID uuid.UUID, change string) {
+	s.authz.InvalidateRole(orgID, userID)
+	if err := s.notifications.MembershipChanged(ctx, orgID, userID, actorID, change); err != nil {
+		s.logger.Warn("Failed to notify membership change", zap.Error(err), zap.String("org_id", orgID.String()))
+	}
+}
@@ -0,0 +1,228 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/telemetry"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	purgeLeaseKey  = "glassbox:purge:leader"
+	purgeBatchSize = 500
+)
+
+// PurgeService permanently deletes soft-deleted nodes once their org's
+// retention has passed. Deleting a node cascades to its versions, inputs,
+// outputs, dependencies, documents and executions with their traces, and
+// its domain events go with it; its children are kept and lose their parent. Nodes with an active execution
+// are skipped until it finishes.
+type PurgeService struct {
+	db     *database.DB
+	redis  *database.Redis
+	cfg    *config.Config
+	logger *zap.Logger
+
+	// Identifies this instance as the holder of the purge lease
+	holder string
+
+	leader      atomic.Bool
+	runs        atomic.Uint64
+	failures    atomic.Uint64
+	purged      atomic.Uint64
+	due         atomic.Int64 // nodes the last dry run would have purged
+	lastSuccess atomic.Int64 // Unix seconds
+}
+
+func NewPurgeService(db *database.DB, redis *database.Redis, cfg *config.Config, logger *zap.Logger) *PurgeService {
+	return &PurgeService{db: db, redis: redis, cfg: cfg, logger: logger, holder: uuid.NewString()}
+}
+
+// Run purges every PurgeInterval until ctx is cancelled. Only the instance
+// holding the purge lease in Redis purges; the others stand by to take over.
+func (s *PurgeService) Run(ctx context.Context) {
+	if !s.cfg.PurgeEnabled {
+		return
+	}
+	defer s.redis.ReleaseLock(context.WithoutCancel(ctx), purgeLeaseKey, s.holder)
+
+	ticker := time.NewTicker(s.cfg.PurgeInterval)
+	defer ticker.Stop()
+	for {
+		s.runIfLeader(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *PurgeService) runIfLeader(ctx context.Context) {
+	// The lease outlives one interval, so the leader keeps it between runs
+	held, err := s.redis.HoldLease(ctx, purgeLeaseKey, s.holder, 2*s.cfg.PurgeInterval)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("Failed to hold purge lease", zap.Error(err))
+		}
+		return
+	}
+	if was := s.leader.Swap(held); was != held && held {
+		s.logger.Info("Running the soft-delete purge on this instance", zap.Bool("dryRun", s.cfg.PurgeDryRun))
+	}
+	if !held {
+		return
+	}
+
+	s.runs.Add(1)
+	start := time.Now()
+	counts, err := s.Purge(ctx, s.cfg.PurgeDryRun)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.failures.Add(1)
+			s.logger.Error("Soft-delete purge failed", zap.Error(err))
+		}
+		return
+	}
+	s.lastSuccess.Store(time.Now().Unix())
+
+	msg := "Purged soft-deleted nodes"
+	if s.cfg.PurgeDryRun {
+		msg = "Soft-deleted nodes due for purge (dry run)"
+	}
+	total := 0
+	for orgID, n := range counts {
+		total += n
+		s.logger.Info(msg, zap.String("orgId", orgID.String()), zap.Int("nodes", n))
+	}
+	if s.cfg.PurgeDryRun {
+		s.due.Store(int64(total))
+	} else {
+		s.purged.Add(uint64(total))
+	}
+	s.logger.Debug("Soft-delete purge finished",
+		zap.Int("nodes", total), zap.Duration("duration", time.Since(start)), zap.Bool("dryRun", s.cfg.PurgeDryRun))
+}
+
+// purgeDueFilter selects soft-deleted nodes past their org's retention
+// ($1, in seconds, unless the org sets deletedRetentionDays) that have no
+// active execution ($2)
+const purgeDueFilter = `
+	FROM nodes n
+	JOIN organizations o ON o.id = n.org_id
+	WHERE n.deleted_at IS NOT NULL
+	  AND n.deleted_at < NOW() - COALESCE((o.settings->>'deletedRetentionDays')::bigint * 86400, $1::bigint) * INTERVAL '1 second'
+	  AND NOT EXISTS (
+		SELECT 1 FROM agent_executions e WHERE e.node_id = n.id AND e.status = ANY($2)
+	  )
+`
+
+// Purge deletes the nodes that are due, in batches, and returns how many
+// were deleted per org. With dryRun it deletes nothing and returns how
+// many would be.
+func (s *PurgeService) Purge(ctx context.Context, dryRun bool) (map[uuid.UUID]int, error) {
+	retention := int64(s.cfg.PurgeRetention / time.Second)
+	counts := make(map[uuid.UUID]int)
+
+	if dryRun {
+		rows, err := s.db.Pool.Query(ctx, `SELECT n.org_id, COUNT(*) `+purgeDueFilter+` GROUP BY n.org_id`,
+			retention, activeStatuses)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count nodes to purge: %w", err)
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var orgID uuid.UUID
+			var n int
+			if err := rows.Scan(&orgID, &n); err != nil {
+				return nil, fmt.Errorf("failed to scan purge count: %w", err)
+			}
+			counts[orgID] = n
+		}
+		return counts, rows.Err()
+	}
+
+	for {
+		rows, err := s.db.Pool.Query(ctx, `
+			WITH due AS (
+				SELECT n.id `+purgeDueFilter+`
+				ORDER BY n.deleted_at
+				LIMIT $3
+				FOR UPDATE OF n SKIP LOCKED
+			),
+			purged AS (
+				DELETE FROM nodes WHERE id IN (SELECT id FROM due)
+				RETURNING id, org_id
+			),
+			purged_events AS (
+				DELETE FROM domain_events
+				WHERE aggregate_type = $4 AND aggregate_id IN (SELECT id FROM purged)
+			),
+			purged_streams AS (
+				DELETE FROM event_streams
+				WHERE aggregate_type = $4 AND aggregate_id IN (SELECT id FROM purged)
+			),
+			purged_snapshots AS (
+				DELETE FROM aggregate_snapshots
+				WHERE aggregate_type = $4 AND aggregate_id IN (SELECT id FROM purged)
+			)
+			SELECT org_id FROM purged
+		`, retention, activeStatuses, purgeBatchSize, AggregateNode)
+		if err != nil {
+			return counts, fmt.Errorf("failed to purge nodes: %w", err)
+		}
+		deleted := 0
+		for rows.Next() {
+			var orgID uuid.UUID
+			if err := rows.Scan(&orgID); err != nil {
+				rows.Close()
+				return counts, fmt.Errorf("failed to scan purged node: %w", err)
+			}
+			counts[orgID]++
+			deleted++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return counts, fmt.Errorf("failed to purge nodes: %w", err)
+		}
+		if deleted < purgeBatchSize {
+			return counts, nil
+		}
+	}
+}
+
+// WriteMetrics reports the purge's progress on this instance
+func (s *PurgeService) WriteMetrics(w *telemetry.MetricsWriter) {
+	if !s.cfg.PurgeEnabled {
+		return
+	}
+	w.Gauge("glassbox_purge_leader", "Whether this instance runs the soft-delete purge.",
+		telemetry.Sample{Value: boolMetric(s.leader.Load())})
+	w.Counter("glassbox_purge_runs_total", "Soft-delete purge runs on this instance.",
+		telemetry.Sample{Value: float64(s.runs.Load())})
+	w.Counter("glassbox_purge_failures_total", "Soft-delete purge runs that failed.",
+		telemetry.Sample{Value: float64(s.failures.Load())})
+	w.Counter("glassbox_purge_nodes_total", "Soft-deleted nodes purged.",
+		telemetry.Sample{Value: float64(s.purged.Load())})
+	if s.cfg.PurgeDryRun {
+		w.Gauge("glassbox_purge_dry_run_nodes", "Nodes the last dry run would have purged.",
+			telemetry.Sample{Value: float64(s.due.Load())})
+	}
+	if last := s.lastSuccess.Load(); last > 0 {
+		w.Gauge("glassbox_purge_last_success_timestamp_seconds", "When the last successful purge finished.",
+			telemetry.Sample{Value: float64(last)})
+	}
+}
+
+func boolMetric(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
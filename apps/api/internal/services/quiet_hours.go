@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// How often held deliveries are checked for being due
+	deferredDeliveryInterval = time.Minute
+	// Held deliveries sent per query
+	deferredDeliveryBatch = 100
+)
+
+// urgentTypes are sent during quiet hours anyway: an agent is paused until
+// the user answers
+var urgentTypes = map[string]bool{
+	NotificationHumanInputNeeded: true,
+	NotificationApprovalRequest:  true,
+}
+
+// quietUntil returns when the quiet hours now falls in end, following on
+// into any window that starts as one ends. ok is false outside quiet hours.
+func quietUntil(prefs models.NotificationPreferences, now time.Time) (until time.Time, ok bool) {
+	if len(prefs.QuietHours) == 0 {
+		return time.Time{}, false
+	}
+	loc := time.UTC
+	if prefs.TimeZone != "" {
+		if l, err := time.LoadLocation(prefs.TimeZone); err == nil {
+			loc = l
+		}
+	}
+
+	until = now.In(loc)
+	for range len(prefs.QuietHours) + 1 {
+		end, in := quietWindowEnd(prefs.QuietHours, until)
+		if !in || !end.After(until) {
+			break
+		}
+		until, ok = end, true
+	}
+	return until, ok
+}
+
+// quietWindowEnd returns the latest end of the windows t falls in. Windows
+// that started the day before are checked too, for ones past midnight.
+func quietWindowEnd(windows []models.QuietHours, t time.Time) (end time.Time, in bool) {
+	for _, w := range windows {
+		start, err := time.Parse("15:04", w.Start)
+		if err != nil {
+			continue
+		}
+		stop, err := time.Parse("15:04", w.End)
+		if err != nil {
+			continue
+		}
+		for _, offset := range []int{-1, 0} {
+			day := time.Date(t.Year(), t.Month(), t.Day()+offset, 0, 0, 0, 0, t.Location())
+			if len(w.Days) > 0 && !slices.Contains(w.Days, int(day.Weekday())) {
+				continue
+			}
+			from := time.Date(day.Year(), day.Month(), day.Day(), start.Hour(), start.Minute(), 0, 0, t.Location())
+			to := time.Date(day.Year(), day.Month(), day.Day(), stop.Hour(), stop.Minute(), 0, 0, t.Location())
+			if !to.After(from) {
+				to = to.AddDate(0, 0, 1)
+			}
+			if !t.Before(from) && t.Before(to) && to.After(end) {
+				end, in = to, true
+			}
+		}
+	}
+	return end, in
+}
+
+// deferDelivery holds a notification's email and push until deliverAt. A
+// held delivery about the same resource is replaced, keeping the channels
+// of both.
+func (s *NotificationService) deferDelivery(ctx context.Context, n *models.Notification, channels NotificationChannels, deliverAt time.Time) error {
+	var notificationID *uuid.UUID
+	if n.ID != uuid.Nil {
+		notificationID = &n.ID
+	}
+	_, err := s.db.Pool.Exec(ctx, `
+		INSERT INTO deferred_notifications (user_id, notification_id, org_id, type, title, body,
+		                                    resource_type, resource_id, email, push, deliver_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		ON CONFLICT (user_id, type, resource_id) WHERE resource_id IS NOT NULL DO UPDATE SET
+			notification_id = EXCLUDED.notification_id,
+			title = EXCLUDED.title,
+			body = EXCLUDED.body,
+			email = deferred_notifications.email OR EXCLUDED.email,
+			push = deferred_notifications.push OR EXCLUDED.push,
+			deliver_at = EXCLUDED.deliver_at
+	`, n.UserID, notificationID, n.OrgID, n.Type, n.Title, n.Body, n.ResourceType, n.ResourceID,
+		channels.Email, channels.Push, deliverAt)
+	if err != nil {
+		return fmt.Errorf("failed to defer notification: %w", err)
+	}
+	return nil
+}
+
+// RunDeferred sends held deliveries as they fall due, every
+// deferredDeliveryInterval until ctx is cancelled. Instances claim due rows
+// with SKIP LOCKED, so each is sent once however many run.
+func (s *NotificationService) RunDeferred(ctx context.Context) {
+	ticker := time.NewTicker(deferredDeliveryInterval)
+	defer ticker.Stop()
+	for {
+		sent, err := s.SendDeferred(ctx, time.Now())
+		if err != nil && ctx.Err() == nil {
+			s.logger.Error("Deferred notification delivery failed", zap.Error(err))
+		}
+		if sent > 0 {
+			s.logger.Info("Sent deferred notifications", zap.Int("count", sent))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SendDeferred sends the deliveries due by now and returns how many were
+// sent. Ones whose in-app notification has been read, or whose user is no
+// longer active, are dropped.
+func (s *NotificationService) SendDeferred(ctx context.Context, now time.Time) (int, error) {
+	sent := 0
+	for {
+		rows, err := s.db.Pool.Query(ctx, `
+			WITH due AS (
+				DELETE FROM deferred_notifications
+				WHERE id IN (
+					SELECT id FROM deferred_notifications
+					WHERE deliver_at <= $1
+					ORDER BY deliver_at
+					LIMIT $2
+					FOR UPDATE SKIP LOCKED
+				)
+				RETURNING *
+			)
+			SELECT d.notification_id, d.user_id, d.org_id, d.type, d.title, d.body, d.resource_type,
+			       d.resource_id, d.email, d.push, d.created_at, u.email,
+			       d.notification_id IS NOT NULL AND EXISTS (
+			           SELECT 1 FROM notifications x WHERE x.id = d.notification_id AND x.read_at IS NOT NULL
+			       )
+			FROM due d
+			JOIN users u ON u.id = d.user_id
+			WHERE u.deactivated_at IS NULL AND u.deleted_at IS NULL
+		`, now, deferredDeliveryBatch)
+		if err != nil {
+			return sent, fmt.Errorf("failed to claim deferred notifications: %w", err)
+		}
+
+		claimed := 0
+		for rows.Next() {
+			var n models.Notification
+			var notificationID *uuid.UUID
+			var email, push, read bool
+			var address string
+			if err := rows.Scan(&notificationID, &n.UserID, &n.OrgID, &n.Type, &n.Title, &n.Body, &n.ResourceType,
+				&n.ResourceID, &email, &push, &n.CreatedAt, &address, &read); err != nil {
+				rows.Close()
+				return sent, fmt.Errorf("failed to scan deferred notification: %w", err)
+			}
+			claimed++
+			if read {
+				continue
+			}
+			if notificationID != nil {
+				n.ID = *notificationID
+			}
+			if push && s.webPush != nil {
+				s.webPush.Send(&n)
+			}
+			if email && s.mail != nil {
+				s.email(address, &n)
+			}
+			sent++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return sent, fmt.Errorf("failed to claim deferred notifications: %w", err)
+		}
+		if claimed < deferredDeliveryBatch {
+			return sent, nil
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/glassbox/api/internal/models"
+)
+
+func TestQuietUntil(t *testing.T) {
+	utc := func(day, hour, minute int) time.Time {
+		return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+	}
+	nightly := []models.QuietHours{{Start: "22:00", End: "07:00"}}
+	friday := 5 // October 16, 2026
+
+	for _, tc := range []struct {
+		name  string
+		prefs models.NotificationPreferences
+		now   time.Time
+		until time.Time // zero when not quiet
+	}{
+		{"no quiet hours", models.NotificationPreferences{}, utc(16, 23, 0), time.Time{}},
+		{"before midnight", models.NotificationPreferences{QuietHours: nightly}, utc(16, 23, 30), utc(17, 7, 0)},
+		{"after midnight", models.NotificationPreferences{QuietHours: nightly}, utc(17, 3, 0), utc(17, 7, 0)},
+		{"at the start", models.NotificationPreferences{QuietHours: nightly}, utc(16, 22, 0), utc(17, 7, 0)},
+		{"at the end", models.NotificationPreferences{QuietHours: nightly}, utc(17, 7, 0), time.Time{}},
+		{"daytime", models.NotificationPreferences{QuietHours: nightly}, utc(16, 12, 0), time.Time{}},
+
+		// Days are the days a window starts on, so Friday's runs into Saturday
+		{"friday night, on saturday", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "22:00", End: "07:00", Days: []int{friday}}}},
+			utc(17, 3, 0), utc(17, 7, 0)},
+		{"thursday night, on friday", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "22:00", End: "07:00", Days: []int{friday}}}},
+			utc(16, 3, 0), time.Time{}},
+		{"saturday night", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "22:00", End: "07:00", Days: []int{friday}}}},
+			utc(17, 23, 0), time.Time{}},
+
+		// Windows that meet run together
+		{"chained windows", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "00:00", End: "07:00"}, {Start: "22:00", End: "00:00"}}},
+			utc(16, 23, 0), utc(17, 7, 0)},
+		{"overlapping windows", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "21:00", End: "23:00"}, {Start: "22:30", End: "06:00"}}},
+			utc(16, 21, 30), utc(17, 6, 0)},
+		{"whole day", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "09:00", End: "09:00", Days: []int{friday}}}},
+			utc(16, 15, 0), utc(17, 9, 0)},
+
+		// 23:00 on Friday in New York is 03:00 on Saturday in UTC
+		{"time zone", models.NotificationPreferences{QuietHours: nightly, TimeZone: "America/New_York"},
+			utc(17, 3, 0), utc(17, 11, 0)},
+		{"time zone daytime", models.NotificationPreferences{QuietHours: nightly, TimeZone: "America/New_York"},
+			utc(16, 23, 0), time.Time{}},
+		{"time zone, window starting the local day before", models.NotificationPreferences{QuietHours: []models.QuietHours{{Start: "22:00", End: "07:00", Days: []int{friday}}}, TimeZone: "Asia/Tokyo"},
+			utc(16, 16, 0), utc(16, 22, 0)},
+		// New York falls back an hour in the night of October 31: 07:00 EST
+		// is 12:00 UTC
+		{"daylight saving ends", models.NotificationPreferences{QuietHours: nightly, TimeZone: "America/New_York"},
+			time.Date(2026, time.November, 1, 3, 0, 0, 0, time.UTC), time.Date(2026, time.November, 1, 12, 0, 0, 0, time.UTC)},
+		{"unknown time zone is UTC", models.NotificationPreferences{QuietHours: nightly, TimeZone: "Mars/Olympus_Mons"},
+			utc(16, 23, 0), utc(17, 7, 0)},
+	} {
+		until, quiet := quietUntil(tc.prefs, tc.now)
+		if quiet != !tc.until.IsZero() {
+			t.Errorf("%s: quiet = %v, want %v", tc.name, quiet, !quiet)
+			continue
+		}
+		if quiet && !until.Equal(tc.until) {
+			t.Errorf("%s: until %v, want %v", tc.name, until.UTC(), tc.until)
+		}
+	}
+}
@@ -3,9 +3,11 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 
+	"github.com/glassbox/api/internal/database"
 	"github.com/glassbox/api/internal/models"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -56,9 +58,17 @@ type SearchResponse struct {
 
 // TextSearch performs full-text search on nodes and files
 func (s *SearchService) TextSearch(ctx context.Context, orgID, userID uuid.UUID, req SearchRequest) (*SearchResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	resp, err := s.textSearch(ctx, orgID, userID, req)
+	return resp, searchError(ctx, err)
+}
+
+func (s *SearchService) textSearch(ctx context.Context, orgID, userID uuid.UUID, req SearchRequest) (*SearchResponse, error) {
 	// Verify user has access to org
 	var hasAccess bool
-	err := s.db.Pool.QueryRow(ctx, `
+	err := s.db.Reader().QueryRow(ctx, `
 		SELECT EXISTS(SELECT 1 FROM org_members WHERE org_id = $1 AND user_id = $2)
 	`, orgID, userID).Scan(&hasAccess)
 	if err != nil {
@@ -112,7 +122,7 @@ func (s *SearchService) TextSearch(ctx context.Context, orgID, userID uuid.UUID,
 	nodeQuery += fmt.Sprintf(" LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
 	nodeArgs = append(nodeArgs, limit, offset)
 
-	rows, err := s.db.Pool.Query(ctx, nodeQuery, nodeArgs...)
+	rows, err := s.db.Reader().Query(ctx, nodeQuery, nodeArgs...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to search nodes: %w", err)
 	}
@@ -141,6 +151,9 @@ func (s *SearchService) TextSearch(ctx context.Context, orgID, userID uuid.UUID,
 
 		results = append(results, r)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to search nodes: %w", err)
+	}
 
 	// Search files with extracted text
 	fileQuery := `
@@ -151,7 +164,10 @@ func (s *SearchService) TextSearch(ctx context.Context, orgID, userID uuid.UUID,
 		ORDER BY f.created_at DESC
 		LIMIT $3 OFFSET $4
 	`
-	fileRows, err := s.db.Pool.Query(ctx, fileQuery, orgID, searchPattern, limit, offset)
+	fileRows, err := s.db.Reader().Query(ctx, fileQuery, orgID, searchPattern, limit, offset)
+	if database.IsQueryCanceled(err) {
+		return nil, fmt.Errorf("failed to search files: %w", err)
+	}
 	if err != nil {
 		s.logger.Warn("Failed to search files", zap.Error(err))
 	} else {
@@ -177,6 +193,9 @@ func (s *SearchService) TextSearch(ctx context.Context, orgID, userID uuid.UUID,
 			}
 			results = append(results, r)
 		}
+		if err := fileRows.Err(); database.IsQueryCanceled(err) {
+			return nil, fmt.Errorf("failed to search files: %w", err)
+		}
 	}
 
 	// Count total results (simplified - just return results count)
@@ -193,9 +212,17 @@ func (s *SearchService) TextSearch(ctx context.Context, orgID, userID uuid.UUID,
 
 // SemanticSearch performs vector similarity search using pgvector
 func (s *SearchService) SemanticSearch(ctx context.Context, orgID, userID uuid.UUID, embedding []float64, req SemanticSearchRequest) (*SearchResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	resp, err := s.semanticSearch(ctx, orgID, userID, embedding, req)
+	return resp, searchError(ctx, err)
+}
+
+func (s *SearchService) semanticSearch(ctx context.Context, orgID, userID uuid.UUID, embedding []float64, req SemanticSearchRequest) (*SearchResponse, error) {
 	// Verify user has access to org
 	var hasAccess bool
-	err := s.db.Pool.QueryRow(ctx, `
+	err := s.db.Reader().QueryRow(ctx, `
 		SELECT EXISTS(SELECT 1 FROM org_members WHERE org_id = $1 AND user_id = $2)
 	`, orgID, userID).Scan(&hasAccess)
 	if err != nil {
@@ -235,7 +262,7 @@ func (s *SearchService) SemanticSearch(ctx context.Context, orgID, userID uuid.U
 		LIMIT $4
 	`
 
-	rows, err := s.db.Pool.Query(ctx, query, embeddingStr, orgID, threshold, limit)
+	rows, err := s.db.Reader().Query(ctx, query, embeddingStr, orgID, threshold, limit)
 	if err != nil {
 		return nil, fmt.Errorf("failed to perform semantic search: %w", err)
 	}
@@ -269,6 +296,9 @@ func (s *SearchService) SemanticSearch(ctx context.Context, orgID, userID uuid.U
 
 		results = append(results, r)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to perform semantic search: %w", err)
+	}
 
 	return &SearchResponse{
 		Results: results,
@@ -285,7 +315,7 @@ func (s *SearchService) GetNodeContext(ctx context.Context, nodeID, userID uuid.
 	var node models.Node
 	var metadataJSON []byte
 
-	err := s.db.Pool.QueryRow(ctx, `
+	err := s.db.Reader().QueryRow(ctx, `
 		SELECT n.id, n.org_id, n.project_id, n.parent_id, n.title, n.description,
 		       n.status, n.author_type, n.metadata
 		FROM nodes n
@@ -309,7 +339,7 @@ func (s *SearchService) GetNodeContext(ctx context.Context, nodeID, userID uuid.
 		WHERE ni.node_id = $1
 		ORDER BY ni.sort_order
 	`
-	inputRows, _ := s.db.Pool.Query(ctx, inputsQuery, nodeID)
+	inputRows, _ := s.db.Reader().Query(ctx, inputsQuery, nodeID)
 	defer inputRows.Close()
 
 	var inputs []models.ContextInput
@@ -335,7 +365,7 @@ func (s *SearchService) GetNodeContext(ctx context.Context, nodeID, userID uuid.
 		WHERE no.node_id = $1
 		ORDER BY no.sort_order
 	`
-	outputRows, _ := s.db.Pool.Query(ctx, outputsQuery, nodeID)
+	outputRows, _ := s.db.Reader().Query(ctx, outputsQuery, nodeID)
 	defer outputRows.Close()
 
 	var outputs []models.ContextOutput
@@ -392,7 +422,7 @@ func (s *SearchService) getParentChain(ctx context.Context, parentID uuid.UUID)
 	for i := 0; i < 10; i++ { // Limit depth to prevent infinite loops
 		var node models.NodeSummary
 		var nextParentID *uuid.UUID
-		err := s.db.Pool.QueryRow(ctx, `
+		err := s.db.Reader().QueryRow(ctx, `
 			SELECT id, parent_id, title, description, status, author_type
 			FROM nodes WHERE id = $1 AND deleted_at IS NULL
 		`, currentID).Scan(&node.ID, &nextParentID, &node.Title, &node.Description, &node.Status, &node.AuthorType)
@@ -413,7 +443,7 @@ func (s *SearchService) getParentChain(ctx context.Context, parentID uuid.UUID)
 
 // getSiblings retrieves sibling nodes
 func (s *SearchService) getSiblings(ctx context.Context, parentID, excludeID uuid.UUID) []models.NodeSummary {
-	rows, err := s.db.Pool.Query(ctx, `
+	rows, err := s.db.Reader().Query(ctx, `
 		SELECT id, title, description, status, author_type
 		FROM nodes
 		WHERE parent_id = $1 AND id != $2 AND deleted_at IS NULL
@@ -434,6 +464,16 @@ func (s *SearchService) getSiblings(ctx context.Context, parentID, excludeID uui
 	return siblings
 }
 
+// searchError reports a search stopped by its deadline or by
+// statement_timeout as ErrQueryTimeout. A search cancelled because the
+// request was abandoned keeps its context error.
+func searchError(ctx context.Context, err error) error {
+	if err == nil || !database.IsQueryCanceled(err) || errors.Is(ctx.Err(), context.Canceled) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrQueryTimeout, err)
+}
+
 // Helper function to convert float64 slice to string slice
 func float64SliceToStringSlice(floats []float64) []string {
 	result := make([]string, len(floats))
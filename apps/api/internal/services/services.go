@@ -5,11 +5,18 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"net/url"
+	"strings"
 	"time"
 
+	"github.com/glassbox/api/internal/authz"
 	"github.com/glassbox/api/internal/config"
 	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/events"
 	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/repository"
+	"github.com/glassbox/api/internal/telemetry"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -18,106 +25,127 @@ import (
 
 // Common errors
 var (
-	ErrNotFound      = errors.New("resource not found")
+	ErrNotFound      = repository.ErrNotFound
 	ErrForbidden     = errors.New("access forbidden")
 	ErrAlreadyExists = errors.New("resource already exists")
+	ErrInvalidOrigin = errors.New("invalid origin")
+	ErrQueryTimeout  = errors.New("query timed out")
+
+	// ErrIPNotAllowed is returned when the org's IP allowlist excludes the
+	// caller, for resources the IPAllowlist middleware can't see in the route
+	ErrIPNotAllowed = errors.New("access from this IP address is not allowed for this organization")
 )
 
 // Services contains all service dependencies
 type Services struct {
-	Orgs       *OrganizationService
-	Projects   *ProjectService
-	Nodes      *NodeService
-	Files      *FileService
-	Executions *ExecutionServiceFull
-	Templates  *TemplateService
-	Users      *UserService
-	Search     *SearchService
-	Auth       *AuthService
+	Orgs            *OrganizationService
+	Members         *OrgMembersService
+	Invitations     *InvitationService
+	APIKeys         *APIKeyService
+	Projects        *ProjectService
+	Nodes           *NodeService
+	Files           *FileService
+	Executions      *ExecutionServiceFull
+	Templates       *TemplateService
+	Users           *UserService
+	Search          *SearchService
+	Authz           *authz.Authorizer
+	Auth            *AuthService
+	Audit           *AuditService
+	IPAllowlist     *IPAllowlistService
+	Maintenance     *MaintenanceService
+	Admin           *AdminService
+	Flags           *FeatureFlagService
+	AuthGuard       *AuthGuardService
+	Documents       *DocumentService
+	Notifications   *NotificationService
+	Digests         *DigestService
+	Webhooks        *WebhookService
+	Onboarding      *OnboardingService
+	WebPush         *WebPushService
+	Purge           *PurgeService
+	TracePartitions *TracePartitionService
+	Events          *EventStore
+	Graph           *GraphService
+	WorkerState     *WorkerStateService
+
+	// Keeps the caches above fresh; run it with Listener.Run
+	Listener *database.Listener
 }
 
 // NewServices creates all services with their dependencies
 func NewServices(db *database.DB, redis *database.Redis, s3 S3Client, sqs SQSClient, cfg *config.Config, logger *zap.Logger) *Services {
+	listener := database.NewListener(db, logger)
+	az := authz.New(db, redis, listener, logger)
+	eventStore := NewEventStore(db, listener, logger)
+	orgRepo := repository.NewOrgRepo(db)
+	nodeRepo := repository.NewNodeRepo(db)
+	executionRepo := repository.NewExecutionRepo(db)
+	ipAllowlist := NewIPAllowlistService(db, listener, az, logger)
+	templates := NewTemplateService(db, az, ipAllowlist, eventStore, cfg.AgentModels, logger)
+	webhooks := NewWebhookService(db, cfg, logger)
+	webPush := NewWebPushService(db, cfg, logger)
+	notifications := NewNotificationService(db, redis, webhooks, webPush, logger)
+	projects := NewProjectService(db, orgRepo, repository.NewProjectRepo(db), templates, eventStore, logger)
+	members := NewOrgMembersService(db, az, notifications, logger)
+	nodes := NewNodeService(db, nodeRepo, redis, eventStore, notifications, logger)
+
 	return &Services{
-		Orgs:       NewOrganizationService(db, logger),
-		Projects:   NewProjectService(db, logger),
-		Nodes:      NewNodeService(db, redis, logger),
-		Files:      NewFileService(db, s3, sqs, cfg, logger),
-		Executions: NewExecutionServiceFull(db, redis, sqs, cfg, logger),
-		Templates:  NewTemplateService(db, logger),
-		Users:      NewUserService(db, logger),
-		Search:     NewSearchService(db, logger),
-		Auth:       NewAuthService(db, redis, cfg, logger),
+		Orgs:            NewOrganizationService(db, orgRepo, eventStore, logger),
+		Members:         members,
+		Invitations:     NewInvitationService(db, members, cfg, logger),
+		APIKeys:         NewAPIKeyService(db, listener, az, logger),
+		Projects:        projects,
+		Nodes:           nodes,
+		Files:           NewFileService(db, s3, sqs, eventStore, cfg, logger),
+		Executions:      NewExecutionServiceFull(db, executionRepo, nodeRepo, redis, sqs, NewConfigResolver(db), cfg, logger),
+		Templates:       templates,
+		Users:           NewUserService(db, az, notifications, logger),
+		Search:          NewSearchService(db, cfg.SearchTimeout, logger),
+		Authz:           az,
+		Auth:            NewAuthService(db, redis, cfg, logger),
+		Audit:           NewAuditService(db, az, logger),
+		IPAllowlist:     ipAllowlist,
+		Maintenance:     NewMaintenanceService(redis, cfg, logger),
+		Admin:           NewAdminService(db, az, logger),
+		Flags:           NewFeatureFlagService(db, redis, logger),
+		AuthGuard:       NewAuthGuardService(db, redis, cfg, logger),
+		Documents:       NewDocumentService(db, nodes, logger),
+		Notifications:   notifications,
+		Digests:         NewDigestService(db, redis, notifications, cfg, logger),
+		Webhooks:        webhooks,
+		Onboarding:      NewOnboardingService(db, logger),
+		WebPush:         webPush,
+		Purge:           NewPurgeService(db, redis, cfg, logger),
+		TracePartitions: NewTracePartitionService(db, redis, cfg, logger),
+		Events:          eventStore,
+		Graph:           NewGraphService(projects, nodeRepo, executionRepo, az, ipAllowlist, logger),
+		WorkerState:     NewWorkerStateService(db, logger),
+		Listener:        listener,
 	}
 }
 
 // OrganizationService handles organization operations
 type OrganizationService struct {
-	db     *database.DB
-	logger *zap.Logger
+	db         *database.DB
+	orgs       repository.OrgRepo
+	eventStore *EventStore
+	logger     *zap.Logger
 }
 
-func NewOrganizationService(db *database.DB, logger *zap.Logger) *OrganizationService {
-	return &OrganizationService{db: db, logger: logger}
+func NewOrganizationService(db *database.DB, orgs repository.OrgRepo, eventStore *EventStore, logger *zap.Logger) *OrganizationService {
+	return &OrganizationService{db: db, orgs: orgs, eventStore: eventStore, logger: logger}
 }
 
-// ListByUser returns all organizations the user is a member of
-func (s *OrganizationService) ListByUser(ctx context.Context, userID uuid.UUID) ([]models.Organization, error) {
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT o.id, o.name, o.slug, o.settings, o.event_sourcing_level, o.created_at, o.updated_at
-		FROM organizations o
-		JOIN org_members om ON o.id = om.org_id
-		WHERE om.user_id = $1
-		ORDER BY o.name
-	`, userID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list organizations: %w", err)
-	}
-	defer rows.Close()
-
-	var orgs []models.Organization
-	for rows.Next() {
-		var org models.Organization
-		var settingsJSON []byte
-
-		if err := rows.Scan(
-			&org.ID, &org.Name, &org.Slug, &settingsJSON,
-			&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan organization: %w", err)
-		}
-
-		json.Unmarshal(settingsJSON, &org.Settings)
-		orgs = append(orgs, org)
-	}
-
-	return orgs, nil
+// ListByUser returns a page of the organizations the user is a member of,
+// by name
+func (s *OrganizationService) ListByUser(ctx context.Context, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Organization], error) {
+	return s.orgs.ListForMember(ctx, userID, page)
 }
 
 // GetByID returns an organization by ID if the user has access
 func (s *OrganizationService) GetByID(ctx context.Context, orgID, userID uuid.UUID) (*models.Organization, error) {
-	var org models.Organization
-	var settingsJSON []byte
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT o.id, o.name, o.slug, o.settings, o.event_sourcing_level, o.created_at, o.updated_at
-		FROM organizations o
-		JOIN org_members om ON o.id = om.org_id
-		WHERE o.id = $1 AND om.user_id = $2
-	`, orgID, userID).Scan(
-		&org.ID, &org.Name, &org.Slug, &settingsJSON,
-		&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get organization: %w", err)
-	}
-
-	json.Unmarshal(settingsJSON, &org.Settings)
-	return &org, nil
+	return s.orgs.GetForMember(ctx, orgID, userID)
 }
 
 // CreateOrgRequest contains data for creating an organization
@@ -160,8 +188,11 @@ func (s *OrganizationService) Create(ctx context.Context, req CreateOrgRequest,
 		if err != nil {
 			return fmt.Errorf("failed to add owner: %w", err)
 		}
+		if err := recordOnboarding(ctx, tx, creatorID, OnboardingCreatedOrg); err != nil {
+			return err
+		}
 
-		return nil
+		return s.eventStore.Append(ctx, tx, org.ID, AggregateOrganization, org.ID, "organization.created", orgEventState(org), &creatorID)
 	})
 
 	if err != nil {
@@ -175,215 +206,166 @@ func (s *OrganizationService) Create(ctx context.Context, req CreateOrgRequest,
 type UpdateOrgRequest struct {
 	Name               *string                      `json:"name,omitempty"`
 	Settings           *models.OrganizationSettings `json:"settings,omitempty"`
-	EventSourcingLevel *string                      `json:"eventSourcingLevel,omitempty"`
+	EventSourcingLevel *string                      `json:"eventSourcingLevel,omitempty" binding:"omitempty,oneof=full snapshot off"`
+
+	IfMatch Precondition `json:"-"`
 }
 
-// Update updates an organization (requires admin/owner role)
+// Update updates an organization. Callers must have authorized authz.OrgUpdate.
 func (s *OrganizationService) Update(ctx context.Context, orgID, userID uuid.UUID, req UpdateOrgRequest) (*models.Organization, error) {
-	// Check user has admin or owner role
-	var role string
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2
-	`, orgID, userID).Scan(&role)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to check membership: %w", err)
-	}
-	if role != "owner" && role != "admin" {
-		return nil, ErrForbidden
-	}
-
 	// Build dynamic update query
 	var org models.Organization
 	var settingsJSON []byte
 
 	if req.Settings != nil {
+		for i, origin := range req.Settings.AllowedOrigins {
+			normalized, err := normalizeOrigin(origin)
+			if err != nil {
+				return nil, err
+			}
+			req.Settings.AllowedOrigins[i] = normalized
+		}
 		settingsJSON, _ = json.Marshal(req.Settings)
 	}
 
-	err = s.db.Pool.QueryRow(ctx, `
-		UPDATE organizations SET
-			name = COALESCE($2, name),
-			settings = COALESCE($3, settings),
-			event_sourcing_level = COALESCE($4, event_sourcing_level),
-			updated_at = NOW()
-		WHERE id = $1
-		RETURNING id, name, slug, settings, event_sourcing_level, created_at, updated_at
-	`, orgID, req.Name, settingsJSON, req.EventSourcingLevel).Scan(
-		&org.ID, &org.Name, &org.Slug, &settingsJSON,
-		&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
-	)
+	// The event is recorded at the org's new level; the cached level is
+	// dropped whatever the outcome, as the transaction may have read its
+	// uncommitted change
+	defer s.eventStore.forgetLevel(orgID)
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE organizations SET
+				name = COALESCE($2, name),
+				settings = COALESCE($3, settings),
+				event_sourcing_level = COALESCE($4, event_sourcing_level),
+				updated_at = NOW()
+			WHERE id = $1 AND `+versionCheck(5)+`
+			RETURNING id, name, slug, settings, event_sourcing_level, created_at, updated_at
+		`, orgID, req.Name, settingsJSON, req.EventSourcingLevel, req.IfMatch.UpdatedAt).Scan(
+			&org.ID, &org.Name, &org.Slug, &settingsJSON,
+			&org.EventSourcingLevel, &org.CreatedAt, &org.UpdatedAt,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return missedUpdate(ctx, tx, "organizations", orgID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update organization: %w", err)
+		}
 
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+		json.Unmarshal(settingsJSON, &org.Settings)
+		s.eventStore.forgetLevel(orgID)
+		return s.eventStore.Append(ctx, tx, org.ID, AggregateOrganization, org.ID, "organization.updated", orgEventState(&org), &userID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update organization: %w", err)
+		return nil, err
 	}
 
-	json.Unmarshal(settingsJSON, &org.Settings)
 	return &org, nil
 }
 
-// Delete deletes an organization (requires owner role)
-func (s *OrganizationService) Delete(ctx context.Context, orgID, userID uuid.UUID) error {
-	// Check user is owner
-	var role string
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2
-	`, orgID, userID).Scan(&role)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return ErrNotFound
-	}
-	if err != nil {
-		return fmt.Errorf("failed to check membership: %w", err)
-	}
-	if role != "owner" {
-		return ErrForbidden
+// orgEventState is an org as recorded in its events, without model API keys
+func orgEventState(org *models.Organization) models.Organization {
+	state := *org
+	state.Settings.Models = make([]models.ModelConfig, len(org.Settings.Models))
+	for i, m := range org.Settings.Models {
+		m.APIKey = ""
+		state.Settings.Models[i] = m
 	}
+	return state
+}
 
-	// Delete organization (cascades to all related data)
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM organizations WHERE id = $1`, orgID)
-	if err != nil {
-		return fmt.Errorf("failed to delete organization: %w", err)
-	}
+// Delete deletes an organization. Callers must have authorized authz.OrgDelete.
+func (s *OrganizationService) Delete(ctx context.Context, orgID uuid.UUID) error {
+	// Cascades to all related data
+	return s.orgs.Delete(ctx, orgID)
+}
 
-	if result.RowsAffected() == 0 {
-		return ErrNotFound
-	}
+// AllowsOriginForUser reports whether any org the user belongs to lists
+// origin in its settings.allowedOrigins
+func (s *OrganizationService) AllowsOriginForUser(ctx context.Context, userID uuid.UUID, origin string) (bool, error) {
+	return s.orgs.AllowsOrigin(ctx, userID, origin)
+}
 
-	return nil
+// normalizeOrigin validates a browser origin (scheme://host[:port]) and
+// returns it lowercased without a trailing slash
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(origin))
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" ||
+		strings.TrimSuffix(u.Path, "/") != "" || u.RawQuery != "" || u.Fragment != "" {
+		return "", ErrInvalidOrigin
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
 }
 
 // GetUserRole returns the user's role in the organization
 func (s *OrganizationService) GetUserRole(ctx context.Context, orgID, userID uuid.UUID) (string, error) {
-	var role string
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT role FROM org_members WHERE org_id = $1 AND user_id = $2
-	`, orgID, userID).Scan(&role)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return "", ErrNotFound
-	}
-	if err != nil {
-		return "", fmt.Errorf("failed to get role: %w", err)
-	}
-
-	return role, nil
+	return s.orgs.MemberRole(ctx, orgID, userID)
 }
 
 // ProjectService handles project operations
 type ProjectService struct {
-	db     *database.DB
-	logger *zap.Logger
+	db         *database.DB
+	orgs       repository.OrgRepo
+	projects   repository.ProjectRepo
+	templates  *TemplateService
+	eventStore *EventStore
+	logger     *zap.Logger
 }
 
-func NewProjectService(db *database.DB, logger *zap.Logger) *ProjectService {
-	return &ProjectService{db: db, logger: logger}
+func NewProjectService(db *database.DB, orgs repository.OrgRepo, projects repository.ProjectRepo, templates *TemplateService, eventStore *EventStore, logger *zap.Logger) *ProjectService {
+	return &ProjectService{db: db, orgs: orgs, projects: projects, templates: templates, eventStore: eventStore, logger: logger}
 }
 
-// ListByOrg returns all projects in an organization
-func (s *ProjectService) ListByOrg(ctx context.Context, orgID, userID uuid.UUID) ([]models.Project, error) {
-	// First verify user has access to the org
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(SELECT 1 FROM org_members WHERE org_id = $1 AND user_id = $2)
-	`, orgID, userID).Scan(&exists)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check org membership: %w", err)
-	}
-	if !exists {
-		return nil, ErrForbidden
+// checkMember returns ErrForbidden unless userID belongs to the org
+func (s *ProjectService) checkMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	_, err := s.orgs.MemberRole(ctx, orgID, userID)
+	if errors.Is(err, ErrNotFound) {
+		return ErrForbidden
 	}
-
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, org_id, name, description, settings, workflow_states, created_at, updated_at
-		FROM projects
-		WHERE org_id = $1
-		ORDER BY name
-	`, orgID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list projects: %w", err)
+		return fmt.Errorf("failed to check org membership: %w", err)
 	}
-	defer rows.Close()
-
-	var projects []models.Project
-	for rows.Next() {
-		var p models.Project
-		var settingsJSON, workflowStatesJSON []byte
-
-		if err := rows.Scan(
-			&p.ID, &p.OrgID, &p.Name, &p.Description, &settingsJSON,
-			&workflowStatesJSON, &p.CreatedAt, &p.UpdatedAt,
-		); err != nil {
-			return nil, fmt.Errorf("failed to scan project: %w", err)
-		}
+	return nil
+}
 
-		json.Unmarshal(settingsJSON, &p.Settings)
-		json.Unmarshal(workflowStatesJSON, &p.WorkflowStates)
-		projects = append(projects, p)
+// ListByOrg returns a page of an organization's projects, by name
+func (s *ProjectService) ListByOrg(ctx context.Context, orgID, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Project], error) {
+	if err := s.checkMember(ctx, orgID, userID); err != nil {
+		return nil, err
 	}
-
-	return projects, nil
+	return s.projects.ListByOrg(ctx, orgID, page)
 }
 
 // GetByID returns a project by ID if user has access
 func (s *ProjectService) GetByID(ctx context.Context, projectID, userID uuid.UUID) (*models.Project, error) {
-	var p models.Project
-	var settingsJSON, workflowStatesJSON []byte
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT p.id, p.org_id, p.name, p.description, p.settings, p.workflow_states, p.created_at, p.updated_at
-		FROM projects p
-		JOIN org_members om ON p.org_id = om.org_id
-		WHERE p.id = $1 AND om.user_id = $2
-	`, projectID, userID).Scan(
-		&p.ID, &p.OrgID, &p.Name, &p.Description, &settingsJSON,
-		&workflowStatesJSON, &p.CreatedAt, &p.UpdatedAt,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get project: %w", err)
-	}
+	return s.projects.GetForMember(ctx, projectID, userID)
+}
 
-	json.Unmarshal(settingsJSON, &p.Settings)
-	json.Unmarshal(workflowStatesJSON, &p.WorkflowStates)
-	return &p, nil
+// ListByIDs returns the projects among projectIDs in orgs the user belongs
+// to, in no particular order
+func (s *ProjectService) ListByIDs(ctx context.Context, projectIDs []uuid.UUID, userID uuid.UUID) ([]models.Project, error) {
+	return s.projects.ListForMember(ctx, projectIDs, userID)
 }
 
 // CreateProjectRequest contains data for creating a project
 type CreateProjectRequest struct {
-	Name           string                 `json:"name" binding:"required"`
-	Description    *string                `json:"description,omitempty"`
+	Name           string                  `json:"name" binding:"required"`
+	Description    *string                 `json:"description,omitempty"`
 	Settings       *models.ProjectSettings `json:"settings,omitempty"`
-	WorkflowStates []string               `json:"workflowStates,omitempty"`
+	WorkflowStates []string                `json:"workflowStates,omitempty"`
+
+	// Template to start the project from: its node is created at the root,
+	// and its suggested workflow states are used unless WorkflowStates is set
+	TemplateID *uuid.UUID `json:"templateId,omitempty"`
+
+	// Values of the template's variables, as for applying it
+	TemplateValues map[string]string `json:"templateValues,omitempty"`
 }
 
 // Create creates a new project in an organization
 func (s *ProjectService) Create(ctx context.Context, orgID, userID uuid.UUID, req CreateProjectRequest) (*models.Project, error) {
-	// Check user has access to org
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(SELECT 1 FROM org_members WHERE org_id = $1 AND user_id = $2)
-	`, orgID, userID).Scan(&exists)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check org membership: %w", err)
-	}
-	if !exists {
-		return nil, ErrForbidden
-	}
-
-	// Set defaults
-	workflowStates := req.WorkflowStates
-	if len(workflowStates) == 0 {
-		workflowStates = []string{"draft", "in_progress", "complete"}
+	if err := s.checkMember(ctx, orgID, userID); err != nil {
+		return nil, err
 	}
 
 	settings := models.ProjectSettings{}
@@ -392,27 +374,67 @@ func (s *ProjectService) Create(ctx context.Context, orgID, userID uuid.UUID, re
 	}
 
 	p := &models.Project{
-		ID:             uuid.New(),
-		OrgID:          orgID,
-		Name:           req.Name,
-		Description:    req.Description,
-		Settings:       settings,
-		WorkflowStates: workflowStates,
+		ID:          uuid.New(),
+		OrgID:       orgID,
+		Name:        req.Name,
+		Description: req.Description,
+		Settings:    settings,
 	}
 
 	settingsJSON, _ := json.Marshal(p.Settings)
-	workflowStatesJSON, _ := json.Marshal(p.WorkflowStates)
-
-	err = s.db.Pool.QueryRow(ctx, `
-		INSERT INTO projects (id, org_id, name, description, settings, workflow_states)
-		VALUES ($1, $2, $3, $4, $5, $6)
-		RETURNING created_at, updated_at
-	`, p.ID, p.OrgID, p.Name, p.Description, settingsJSON, workflowStatesJSON).Scan(
-		&p.CreatedAt, &p.UpdatedAt,
-	)
 
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var template *models.Template
+		if req.TemplateID != nil {
+			t, err := s.templates.availableTemplate(ctx, tx, *req.TemplateID, orgID)
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUnresolvedTemplate
+			}
+			if err != nil {
+				return err
+			}
+			template = t
+			version := t.Version
+			p.TemplateID = &t.ID
+			p.TemplateVersion = &version
+		}
+
+		// Set defaults
+		p.WorkflowStates = req.WorkflowStates
+		if len(p.WorkflowStates) == 0 && template != nil {
+			p.WorkflowStates = template.Structure.SuggestedWorkflowStates
+		}
+		if len(p.WorkflowStates) == 0 {
+			p.WorkflowStates = []string{"draft", "in_progress", "complete"}
+		}
+		workflowStatesJSON, _ := json.Marshal(p.WorkflowStates)
+
+		err := tx.QueryRow(ctx, `
+			INSERT INTO projects (id, org_id, name, description, settings, workflow_states, template_id, template_version)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING created_at, updated_at
+		`, p.ID, p.OrgID, p.Name, p.Description, settingsJSON, workflowStatesJSON, p.TemplateID, p.TemplateVersion).Scan(
+			&p.CreatedAt, &p.UpdatedAt,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to create project: %w", err)
+		}
+
+		if err := s.eventStore.Append(ctx, tx, p.OrgID, AggregateProject, p.ID, "project.created", p, &userID); err != nil {
+			return err
+		}
+		if err := recordOnboarding(ctx, tx, userID, OnboardingCreatedProject); err != nil {
+			return err
+		}
+
+		if template == nil {
+			return nil
+		}
+		a := newTemplateApplication(orgID, p.ID, userID, req.TemplateValues)
+		return s.templates.applyTemplate(ctx, tx, a, template, nil, nil)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create project: %w", err)
+		return nil, err
 	}
 
 	return p, nil
@@ -424,23 +446,14 @@ type UpdateProjectRequest struct {
 	Description    *string                 `json:"description,omitempty"`
 	Settings       *models.ProjectSettings `json:"settings,omitempty"`
 	WorkflowStates []string                `json:"workflowStates,omitempty"`
+
+	IfMatch Precondition `json:"-"`
 }
 
 // Update updates a project
 func (s *ProjectService) Update(ctx context.Context, projectID, userID uuid.UUID, req UpdateProjectRequest) (*models.Project, error) {
-	// Verify user has access
-	var orgID uuid.UUID
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT p.org_id FROM projects p
-		JOIN org_members om ON p.org_id = om.org_id
-		WHERE p.id = $1 AND om.user_id = $2
-	`, projectID, userID).Scan(&orgID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to check access: %w", err)
+	if _, err := s.projects.GetForMember(ctx, projectID, userID); err != nil {
+		return nil, err
 	}
 
 	var p models.Project
@@ -453,73 +466,103 @@ func (s *ProjectService) Update(ctx context.Context, projectID, userID uuid.UUID
 		workflowStatesJSON, _ = json.Marshal(req.WorkflowStates)
 	}
 
-	err = s.db.Pool.QueryRow(ctx, `
-		UPDATE projects SET
-			name = COALESCE($2, name),
-			description = COALESCE($3, description),
-			settings = COALESCE($4, settings),
-			workflow_states = COALESCE($5, workflow_states),
-			updated_at = NOW()
-		WHERE id = $1
-		RETURNING id, org_id, name, description, settings, workflow_states, created_at, updated_at
-	`, projectID, req.Name, req.Description, settingsJSON, workflowStatesJSON).Scan(
-		&p.ID, &p.OrgID, &p.Name, &p.Description, &settingsJSON,
-		&workflowStatesJSON, &p.CreatedAt, &p.UpdatedAt,
-	)
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE projects SET
+				name = COALESCE($2, name),
+				description = COALESCE($3, description),
+				settings = COALESCE($4, settings),
+				workflow_states = COALESCE($5, workflow_states),
+				updated_at = NOW()
+			WHERE id = $1 AND `+versionCheck(6)+`
+			RETURNING id, org_id, name, description, settings, workflow_states, template_id, template_version,
+			          created_at, updated_at
+		`, projectID, req.Name, req.Description, settingsJSON, workflowStatesJSON, req.IfMatch.UpdatedAt).Scan(
+			&p.ID, &p.OrgID, &p.Name, &p.Description, &settingsJSON,
+			&workflowStatesJSON, &p.TemplateID, &p.TemplateVersion, &p.CreatedAt, &p.UpdatedAt,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return missedUpdate(ctx, tx, "projects", projectID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update project: %w", err)
+		}
 
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+		json.Unmarshal(settingsJSON, &p.Settings)
+		json.Unmarshal(workflowStatesJSON, &p.WorkflowStates)
+		return s.eventStore.Append(ctx, tx, p.OrgID, AggregateProject, p.ID, "project.updated", &p, &userID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to update project: %w", err)
+		return nil, err
 	}
 
-	json.Unmarshal(settingsJSON, &p.Settings)
-	json.Unmarshal(workflowStatesJSON, &p.WorkflowStates)
 	return &p, nil
 }
 
-// Delete deletes a project (cascades to nodes)
+// Delete deletes a project (cascades to nodes). Callers must have authorized authz.ProjectDelete.
 func (s *ProjectService) Delete(ctx context.Context, projectID, userID uuid.UUID) error {
-	// Verify user has access (must be org admin/owner)
-	var role string
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT om.role FROM projects p
-		JOIN org_members om ON p.org_id = om.org_id
-		WHERE p.id = $1 AND om.user_id = $2
-	`, projectID, userID).Scan(&role)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return ErrNotFound
-	}
-	if err != nil {
-		return fmt.Errorf("failed to check access: %w", err)
-	}
-	if role != "owner" && role != "admin" {
-		return ErrForbidden
-	}
-
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM projects WHERE id = $1`, projectID)
-	if err != nil {
-		return fmt.Errorf("failed to delete project: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return ErrNotFound
-	}
+	return s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var orgID uuid.UUID
+		err := tx.QueryRow(ctx, `DELETE FROM projects WHERE id = $1 RETURNING org_id`, projectID).Scan(&orgID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete project: %w", err)
+		}
 
-	return nil
+		return s.eventStore.Append(ctx, tx, orgID, AggregateProject, projectID, "project.deleted", nil, &userID)
+	})
 }
 
 // NodeService handles node operations
 type NodeService struct {
 	db     *database.DB
+	nodes  repository.NodeRepo
 	redis  *database.Redis
+	events *events.Publisher
 	logger *zap.Logger
+
+	eventStore    *EventStore
+	notifications *NotificationService
+}
+
+func NewNodeService(db *database.DB, nodes repository.NodeRepo, redis *database.Redis, eventStore *EventStore, notifications *NotificationService, logger *zap.Logger) *NodeService {
+	return &NodeService{db: db, nodes: nodes, redis: redis, eventStore: eventStore, notifications: notifications, logger: logger}
+}
+
+// SetEventPublisher enables node.updated events for updates and rollbacks
+func (s *NodeService) SetEventPublisher(publisher *events.Publisher) {
+	s.events = publisher
 }
 
-func NewNodeService(db *database.DB, redis *database.Redis, logger *zap.Logger) *NodeService {
-	return &NodeService{db: db, redis: redis, logger: logger}
+// publishUpdated reports a committed change to a node, and notifies its
+// author and supervisor. assigned is whether the change gave the node a new
+// supervisor.
+func (s *NodeService) publishUpdated(ctx context.Context, node *models.Node, userID uuid.UUID, assigned bool) {
+	s.events.Publish(events.NodeUpdated, node.OrgID, events.NodeUpdatedData{
+		NodeID:    node.ID,
+		ProjectID: node.ProjectID,
+		Title:     node.Title,
+		Status:    node.Status,
+		Version:   node.Version,
+		UpdatedBy: userID,
+	})
+	if err := s.notifications.NodeUpdated(ctx, node, userID, assigned); err != nil {
+		s.logger.Warn("Failed to notify node update", zap.Error(err), zap.String("node_id", node.ID.String()))
+	}
+}
+
+// notifyMentioned tells users newly mentioned in a node's description
+func (s *NodeService) notifyMentioned(ctx context.Context, node *models.Node, userID uuid.UUID, mentioned []uuid.UUID) {
+	if err := s.notifications.Mentioned(ctx, node, userID, mentioned); err != nil {
+		s.logger.Warn("Failed to notify mentions", zap.Error(err), zap.String("node_id", node.ID.String()))
+	}
+}
+
+// supervisorChanged reports whether after has a supervisor before didn't
+func supervisorChanged(before, after *uuid.UUID) bool {
+	return after != nil && (before == nil || *before != *after)
 }
 
 // ErrLockConflict indicates the node is locked by another user
@@ -530,121 +573,55 @@ type ListNodesRequest struct {
 	Status     *string `form:"status"`
 	AuthorType *string `form:"authorType"`
 	ParentID   *string `form:"parentId"`
+	pagination.Params
 }
 
-// ListByProject returns all nodes in a project
-func (s *NodeService) ListByProject(ctx context.Context, projectID, userID uuid.UUID, filters ListNodesRequest) ([]models.Node, error) {
+// ListByProject returns a page of a project's nodes, newest first
+func (s *NodeService) ListByProject(ctx context.Context, projectID, userID uuid.UUID, filters ListNodesRequest) (*pagination.Page[models.Node], error) {
 	// Verify user has access to the project
-	var orgID uuid.UUID
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT p.org_id FROM projects p
-		JOIN org_members om ON p.org_id = om.org_id
-		WHERE p.id = $1 AND om.user_id = $2
-	`, projectID, userID).Scan(&orgID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
+	if _, err := s.nodes.ProjectOrg(ctx, projectID, userID); errors.Is(err, ErrNotFound) {
 		return nil, ErrForbidden
+	} else if err != nil {
+		return nil, err
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
-	}
-
-	// Build query with filters
-	query := `
-		SELECT id, org_id, project_id, parent_id, title, description, status, author_type,
-		       author_user_id, supervisor_user_id, version, metadata, position,
-		       locked_by, locked_at, lock_expires_at, created_at, updated_at, deleted_at
-		FROM nodes
-		WHERE project_id = $1 AND deleted_at IS NULL
-	`
-	args := []any{projectID}
-	argIdx := 2
-
-	if filters.Status != nil {
-		query += fmt.Sprintf(" AND status = $%d", argIdx)
-		args = append(args, *filters.Status)
-		argIdx++
-	}
-	if filters.AuthorType != nil {
-		query += fmt.Sprintf(" AND author_type = $%d", argIdx)
-		args = append(args, *filters.AuthorType)
-		argIdx++
-	}
+
+	filter := repository.NodeFilter{Status: filters.Status, AuthorType: filters.AuthorType}
 	if filters.ParentID != nil {
 		if *filters.ParentID == "null" {
-			query += " AND parent_id IS NULL"
+			filter.RootsOnly = true
+		} else if parentID, err := uuid.Parse(*filters.ParentID); err == nil {
+			filter.ParentID = &parentID
 		} else {
-			query += fmt.Sprintf(" AND parent_id = $%d", argIdx)
-			args = append(args, *filters.ParentID)
-			argIdx++
-		}
-	}
-
-	query += " ORDER BY created_at DESC"
-
-	rows, err := s.db.Pool.Query(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list nodes: %w", err)
-	}
-	defer rows.Close()
-
-	var nodes []models.Node
-	for rows.Next() {
-		node, err := s.scanNode(rows)
-		if err != nil {
-			return nil, err
+			// No node has a parent that isn't a node
+			return &pagination.Page[models.Node]{Items: []models.Node{}}, nil
 		}
-		nodes = append(nodes, *node)
 	}
-
-	return nodes, nil
+	return s.nodes.ListByProject(ctx, projectID, filter, filters.Params)
 }
 
 // GetByID returns a node by ID with its inputs and outputs
 func (s *NodeService) GetByID(ctx context.Context, nodeID, userID uuid.UUID) (*models.Node, error) {
 	// Verify user has access via org membership
-	var node models.Node
-	var metadataJSON, positionJSON []byte
-
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT n.id, n.org_id, n.project_id, n.parent_id, n.title, n.description, n.status, n.author_type,
-		       n.author_user_id, n.supervisor_user_id, n.version, n.metadata, n.position,
-		       n.locked_by, n.locked_at, n.lock_expires_at, n.created_at, n.updated_at, n.deleted_at
-		FROM nodes n
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-	`, nodeID, userID).Scan(
-		&node.ID, &node.OrgID, &node.ProjectID, &node.ParentID, &node.Title, &node.Description,
-		&node.Status, &node.AuthorType, &node.AuthorUserID, &node.SupervisorUserID, &node.Version,
-		&metadataJSON, &positionJSON, &node.LockedBy, &node.LockedAt, &node.LockExpiresAt,
-		&node.CreatedAt, &node.UpdatedAt, &node.DeletedAt,
-	)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	node, err := s.nodes.Get(ctx, nodeID, userID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get node: %w", err)
+		return nil, err
 	}
 
-	json.Unmarshal(metadataJSON, &node.Metadata)
-	json.Unmarshal(positionJSON, &node.Position)
-
 	// Fetch inputs
-	inputs, err := s.getNodeInputs(ctx, nodeID)
+	inputs, err := s.nodes.Inputs(ctx, nodeID)
 	if err != nil {
 		return nil, err
 	}
 	node.Inputs = inputs
 
 	// Fetch outputs
-	outputs, err := s.getNodeOutputs(ctx, nodeID)
+	outputs, err := s.nodes.Outputs(ctx, nodeID)
 	if err != nil {
 		return nil, err
 	}
 	node.Outputs = outputs
 
-	return &node, nil
+	return node, nil
 }
 
 // CreateNodeRequest contains data for creating a node
@@ -662,18 +639,12 @@ type CreateNodeRequest struct {
 // Create creates a new node
 func (s *NodeService) Create(ctx context.Context, projectID, userID uuid.UUID, req CreateNodeRequest) (*models.Node, error) {
 	// Verify user has access and get org_id
-	var orgID uuid.UUID
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT p.org_id FROM projects p
-		JOIN org_members om ON p.org_id = om.org_id
-		WHERE p.id = $1 AND om.user_id = $2
-	`, projectID, userID).Scan(&orgID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
+	orgID, err := s.nodes.ProjectOrg(ctx, projectID, userID)
+	if errors.Is(err, ErrNotFound) {
 		return nil, ErrForbidden
 	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
 	}
 
 	// Set defaults
@@ -713,19 +684,33 @@ func (s *NodeService) Create(ctx context.Context, projectID, userID uuid.UUID, r
 	metadataJSON, _ := json.Marshal(node.Metadata)
 	positionJSON, _ := json.Marshal(node.Position)
 
-	err = s.db.Pool.QueryRow(ctx, `
-		INSERT INTO nodes (id, org_id, project_id, parent_id, title, description, status, author_type,
-		                   author_user_id, supervisor_user_id, version, metadata, position)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
-		RETURNING created_at, updated_at
-	`, node.ID, node.OrgID, node.ProjectID, node.ParentID, node.Title, node.Description,
-		node.Status, node.AuthorType, node.AuthorUserID, node.SupervisorUserID, node.Version,
-		metadataJSON, positionJSON).Scan(&node.CreatedAt, &node.UpdatedAt)
+	var mentioned []uuid.UUID
+	err = s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			INSERT INTO nodes (id, org_id, project_id, parent_id, title, description, status, author_type,
+			                   author_user_id, supervisor_user_id, version, metadata, position)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING created_at, updated_at
+		`, node.ID, node.OrgID, node.ProjectID, node.ParentID, node.Title, node.Description,
+			node.Status, node.AuthorType, node.AuthorUserID, node.SupervisorUserID, node.Version,
+			metadataJSON, positionJSON).Scan(&node.CreatedAt, &node.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to create node: %w", err)
+		}
+		if err := recordOnboarding(ctx, tx, userID, OnboardingCreatedNode); err != nil {
+			return err
+		}
+		if mentioned, err = recordMentions(ctx, tx, node, userID); err != nil {
+			return err
+		}
 
+		return s.eventStore.Append(ctx, tx, node.OrgID, AggregateNode, node.ID, "node.created", node, &userID)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create node: %w", err)
+		return nil, err
 	}
 
+	s.notifyMentioned(ctx, node, userID, mentioned)
 	return node, nil
 }
 
@@ -738,22 +723,30 @@ type UpdateNodeRequest struct {
 	SupervisorUserID *uuid.UUID           `json:"supervisorUserId,omitempty"`
 	Metadata         *models.NodeMetadata `json:"metadata,omitempty"`
 	Position         *models.NodePosition `json:"position,omitempty"`
+
+	IfMatch Precondition `json:"-"`
+	// Set for collaborative edits, which merge with each other and so
+	// don't take the edit lock
+	IgnoreLock bool `json:"-"`
 }
 
 // Update updates a node and creates a version snapshot
 func (s *NodeService) Update(ctx context.Context, nodeID, userID uuid.UUID, req UpdateNodeRequest) (*models.Node, error) {
 	// Use transaction to update node and create version atomically
 	var node *models.Node
+	var assigned bool
+	var mentioned []uuid.UUID
 
 	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
 		// Get current node state (and verify access)
 		var current models.Node
-		var metadataJSON, positionJSON []byte
+		var metadataJSON, positionJSON, agentConfigJSON []byte
 
 		err := tx.QueryRow(ctx, `
 			SELECT n.id, n.org_id, n.project_id, n.parent_id, n.title, n.description, n.status, n.author_type,
 			       n.author_user_id, n.supervisor_user_id, n.version, n.metadata, n.position,
-			       n.locked_by, n.locked_at, n.lock_expires_at, n.created_at, n.updated_at
+			       n.locked_by, n.locked_at, n.lock_expires_at, n.template_id, n.template_version,
+			       n.agent_config, n.created_at, n.updated_at
 			FROM nodes n
 			JOIN org_members om ON n.org_id = om.org_id
 			WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
@@ -762,7 +755,8 @@ func (s *NodeService) Update(ctx context.Context, nodeID, userID uuid.UUID, req
 			&current.ID, &current.OrgID, &current.ProjectID, &current.ParentID, &current.Title,
 			&current.Description, &current.Status, &current.AuthorType, &current.AuthorUserID,
 			&current.SupervisorUserID, &current.Version, &metadataJSON, &positionJSON,
-			&current.LockedBy, &current.LockedAt, &current.LockExpiresAt, &current.CreatedAt, &current.UpdatedAt,
+			&current.LockedBy, &current.LockedAt, &current.LockExpiresAt, &current.TemplateID, &current.TemplateVersion,
+			&agentConfigJSON, &current.CreatedAt, &current.UpdatedAt,
 		)
 
 		if errors.Is(err, pgx.ErrNoRows) {
@@ -774,12 +768,12 @@ func (s *NodeService) Update(ctx context.Context, nodeID, userID uuid.UUID, req
 
 		json.Unmarshal(metadataJSON, &current.Metadata)
 		json.Unmarshal(positionJSON, &current.Position)
+		if agentConfigJSON != nil {
+			json.Unmarshal(agentConfigJSON, &current.AgentConfig)
+		}
 
-		// Check lock - if locked by another user, reject
-		if current.LockedBy != nil && *current.LockedBy != userID {
-			if current.LockExpiresAt != nil && current.LockExpiresAt.After(time.Now()) {
-				return ErrLockConflict
-			}
+		if err := checkNodeUpdate(&current, userID, req); err != nil {
+			return err
 		}
 
 		// Create version snapshot of current state
@@ -807,7 +801,7 @@ func (s *NodeService) Update(ctx context.Context, nodeID, userID uuid.UUID, req
 
 		// Update node
 		var updated models.Node
-		var updatedMetaJSON, updatedPosJSON []byte
+		var updatedMetaJSON, updatedPosJSON, updatedAgentConfigJSON []byte
 		err = tx.QueryRow(ctx, `
 			UPDATE nodes SET
 				title = COALESCE($2, title),
@@ -822,13 +816,15 @@ func (s *NodeService) Update(ctx context.Context, nodeID, userID uuid.UUID, req
 			WHERE id = $1
 			RETURNING id, org_id, project_id, parent_id, title, description, status, author_type,
 			          author_user_id, supervisor_user_id, version, metadata, position,
-			          locked_by, locked_at, lock_expires_at, created_at, updated_at
+			          locked_by, locked_at, lock_expires_at, template_id, template_version, agent_config,
+			          created_at, updated_at
 		`, nodeID, req.Title, req.Description, req.Status, req.ParentID, req.SupervisorUserID,
 			metadataJSON, positionJSON, newVersion).Scan(
 			&updated.ID, &updated.OrgID, &updated.ProjectID, &updated.ParentID, &updated.Title,
 			&updated.Description, &updated.Status, &updated.AuthorType, &updated.AuthorUserID,
 			&updated.SupervisorUserID, &updated.Version, &updatedMetaJSON, &updatedPosJSON,
-			&updated.LockedBy, &updated.LockedAt, &updated.LockExpiresAt, &updated.CreatedAt, &updated.UpdatedAt,
+			&updated.LockedBy, &updated.LockedAt, &updated.LockExpiresAt, &updated.TemplateID, &updated.TemplateVersion,
+			&updatedAgentConfigJSON, &updated.CreatedAt, &updated.UpdatedAt,
 		)
 
 		if err != nil {
@@ -837,48 +833,70 @@ func (s *NodeService) Update(ctx context.Context, nodeID, userID uuid.UUID, req
 
 		json.Unmarshal(updatedMetaJSON, &updated.Metadata)
 		json.Unmarshal(updatedPosJSON, &updated.Position)
+		if updatedAgentConfigJSON != nil {
+			json.Unmarshal(updatedAgentConfigJSON, &updated.AgentConfig)
+		}
 		node = &updated
-		return nil
+		assigned = supervisorChanged(current.SupervisorUserID, updated.SupervisorUserID)
+		if req.Description != nil {
+			if mentioned, err = recordMentions(ctx, tx, node, userID); err != nil {
+				return err
+			}
+		}
+		return s.eventStore.Append(ctx, tx, node.OrgID, AggregateNode, node.ID, "node.updated", node, &userID)
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	s.publishUpdated(ctx, node, userID, assigned)
+	s.notifyMentioned(ctx, node, userID, mentioned)
 	return node, nil
 }
 
-// Delete soft-deletes a node
-func (s *NodeService) Delete(ctx context.Context, nodeID, userID uuid.UUID) error {
-	// Verify access
-	var role string
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT om.role FROM nodes n
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-	`, nodeID, userID).Scan(&role)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return ErrNotFound
+// checkNodeUpdate rejects an update of current when another user holds its
+// edit lock, or when it was based on an earlier version than current's
+func checkNodeUpdate(current *models.Node, userID uuid.UUID, req UpdateNodeRequest) error {
+	if !req.IgnoreLock && current.LockedBy != nil && *current.LockedBy != userID {
+		if current.LockExpiresAt != nil && current.LockExpiresAt.After(time.Now()) {
+			return ErrLockConflict
+		}
 	}
-	if err != nil {
-		return fmt.Errorf("failed to verify access: %w", err)
+	if !req.IfMatch.MatchesVersion(current.Version) {
+		return ErrVersionConflict
 	}
+	return nil
+}
 
-	// Soft delete
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE nodes SET deleted_at = NOW(), updated_at = NOW()
-		WHERE id = $1 AND deleted_at IS NULL
-	`, nodeID)
+// Delete soft-deletes a node
+func (s *NodeService) Delete(ctx context.Context, nodeID, userID uuid.UUID) error {
+	// Verify access
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, false)
 	if err != nil {
-		return fmt.Errorf("failed to delete node: %w", err)
+		return err
 	}
-
-	if result.RowsAffected() == 0 {
+	if !visible {
 		return ErrNotFound
 	}
 
-	return nil
+	// Soft delete
+	return s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var orgID uuid.UUID
+		err := tx.QueryRow(ctx, `
+			UPDATE nodes SET deleted_at = NOW(), updated_at = NOW()
+			WHERE id = $1 AND deleted_at IS NULL
+			RETURNING org_id
+		`, nodeID).Scan(&orgID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete node: %w", err)
+		}
+
+		return s.eventStore.Append(ctx, tx, orgID, AggregateNode, nodeID, "node.deleted", nil, &userID)
+	})
 }
 
 // =====================================================
@@ -900,23 +918,13 @@ type AddInputRequest struct {
 // AddInput adds an input to a node
 func (s *NodeService) AddInput(ctx context.Context, nodeID, userID uuid.UUID, req AddInputRequest) (*models.NodeInput, error) {
 	// Verify access
-	var orgID uuid.UUID
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT n.org_id FROM nodes n
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-	`, nodeID, userID).Scan(&orgID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrNotFound
 	}
-
-	// Get next sort order
-	var maxOrder int
-	s.db.Pool.QueryRow(ctx, `SELECT COALESCE(MAX(sort_order), -1) FROM node_inputs WHERE node_id = $1`, nodeID).Scan(&maxOrder)
 
 	input := &models.NodeInput{
 		ID:                uuid.New(),
@@ -929,25 +937,14 @@ func (s *NodeService) AddInput(ctx context.Context, nodeID, userID uuid.UUID, re
 		TextContent:       req.TextContent,
 		Label:             req.Label,
 		Metadata:          req.Metadata,
-		SortOrder:         maxOrder + 1,
 	}
 
 	if input.Metadata == nil {
 		input.Metadata = map[string]any{}
 	}
-	metadataJSON, _ := json.Marshal(input.Metadata)
 
-	err = s.db.Pool.QueryRow(ctx, `
-		INSERT INTO node_inputs (id, node_id, input_type, file_id, source_node_id, source_node_version,
-		                         external_url, text_content, label, metadata, sort_order)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
-		RETURNING created_at
-	`, input.ID, input.NodeID, input.InputType, input.FileID, input.SourceNodeID,
-		input.SourceNodeVersion, input.ExternalURL, input.TextContent, input.Label,
-		metadataJSON, input.SortOrder).Scan(&input.CreatedAt)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to add input: %w", err)
+	if err := s.nodes.AddInput(ctx, input); err != nil {
+		return nil, err
 	}
 
 	return input, nil
@@ -955,34 +952,7 @@ func (s *NodeService) AddInput(ctx context.Context, nodeID, userID uuid.UUID, re
 
 // RemoveInput removes an input from a node
 func (s *NodeService) RemoveInput(ctx context.Context, nodeID, inputID, userID uuid.UUID) error {
-	// Verify access
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM node_inputs ni
-			JOIN nodes n ON ni.node_id = n.id
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE ni.id = $1 AND ni.node_id = $2 AND om.user_id = $3 AND n.deleted_at IS NULL
-		)
-	`, inputID, nodeID, userID).Scan(&exists)
-
-	if err != nil {
-		return fmt.Errorf("failed to verify access: %w", err)
-	}
-	if !exists {
-		return ErrNotFound
-	}
-
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM node_inputs WHERE id = $1`, inputID)
-	if err != nil {
-		return fmt.Errorf("failed to remove input: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return ErrNotFound
-	}
-
-	return nil
+	return s.nodes.RemoveInput(ctx, nodeID, inputID, userID)
 }
 
 // AddOutputRequest contains data for adding an output
@@ -999,23 +969,13 @@ type AddOutputRequest struct {
 // AddOutput adds an output to a node
 func (s *NodeService) AddOutput(ctx context.Context, nodeID, userID uuid.UUID, req AddOutputRequest) (*models.NodeOutput, error) {
 	// Verify access
-	var orgID uuid.UUID
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT n.org_id FROM nodes n
-		JOIN org_members om ON n.org_id = om.org_id
-		WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-	`, nodeID, userID).Scan(&orgID)
-
-	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
-	}
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
+	}
+	if !visible {
+		return nil, ErrNotFound
 	}
-
-	// Get next sort order
-	var maxOrder int
-	s.db.Pool.QueryRow(ctx, `SELECT COALESCE(MAX(sort_order), -1) FROM node_outputs WHERE node_id = $1`, nodeID).Scan(&maxOrder)
 
 	output := &models.NodeOutput{
 		ID:             uuid.New(),
@@ -1027,25 +987,14 @@ func (s *NodeService) AddOutput(ctx context.Context, nodeID, userID uuid.UUID, r
 		ExternalURL:    req.ExternalURL,
 		Label:          req.Label,
 		Metadata:       req.Metadata,
-		SortOrder:      maxOrder + 1,
 	}
 
 	if output.Metadata == nil {
 		output.Metadata = map[string]any{}
 	}
-	metadataJSON, _ := json.Marshal(output.Metadata)
-	structuredDataJSON, _ := json.Marshal(output.StructuredData)
 
-	err = s.db.Pool.QueryRow(ctx, `
-		INSERT INTO node_outputs (id, node_id, output_type, file_id, structured_data, text_content,
-		                          external_url, label, metadata, sort_order)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
-		RETURNING created_at
-	`, output.ID, output.NodeID, output.OutputType, output.FileID, structuredDataJSON,
-		output.TextContent, output.ExternalURL, output.Label, metadataJSON, output.SortOrder).Scan(&output.CreatedAt)
-
-	if err != nil {
-		return nil, fmt.Errorf("failed to add output: %w", err)
+	if err := s.nodes.AddOutput(ctx, output); err != nil {
+		return nil, err
 	}
 
 	return output, nil
@@ -1053,127 +1002,45 @@ func (s *NodeService) AddOutput(ctx context.Context, nodeID, userID uuid.UUID, r
 
 // RemoveOutput removes an output from a node
 func (s *NodeService) RemoveOutput(ctx context.Context, nodeID, outputID, userID uuid.UUID) error {
-	// Verify access
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM node_outputs no
-			JOIN nodes n ON no.node_id = n.id
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE no.id = $1 AND no.node_id = $2 AND om.user_id = $3 AND n.deleted_at IS NULL
-		)
-	`, outputID, nodeID, userID).Scan(&exists)
-
-	if err != nil {
-		return fmt.Errorf("failed to verify access: %w", err)
-	}
-	if !exists {
-		return ErrNotFound
-	}
-
-	result, err := s.db.Pool.Exec(ctx, `DELETE FROM node_outputs WHERE id = $1`, outputID)
-	if err != nil {
-		return fmt.Errorf("failed to remove output: %w", err)
-	}
-
-	if result.RowsAffected() == 0 {
-		return ErrNotFound
-	}
-
-	return nil
+	return s.nodes.RemoveOutput(ctx, nodeID, outputID, userID)
 }
 
 // =====================================================
 // NODE VERSIONING
 // =====================================================
 
-// ListVersions returns version history for a node
-func (s *NodeService) ListVersions(ctx context.Context, nodeID, userID uuid.UUID) ([]models.NodeVersion, error) {
+// ListVersions returns a page of a node's version history, newest first
+func (s *NodeService) ListVersions(ctx context.Context, nodeID, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.NodeVersion], error) {
 	// Verify access
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM nodes n
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE n.id = $1 AND om.user_id = $2
-		)
-	`, nodeID, userID).Scan(&exists)
-
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
 	}
-	if !exists {
+	if !visible {
 		return nil, ErrNotFound
 	}
 
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, node_id, version, snapshot, change_type, change_summary, changed_by, created_at
-		FROM node_versions
-		WHERE node_id = $1
-		ORDER BY version DESC
-	`, nodeID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list versions: %w", err)
-	}
-	defer rows.Close()
-
-	var versions []models.NodeVersion
-	for rows.Next() {
-		var v models.NodeVersion
-		var snapshotJSON []byte
-		if err := rows.Scan(&v.ID, &v.NodeID, &v.Version, &snapshotJSON, &v.ChangeType,
-			&v.ChangeSummary, &v.ChangedBy, &v.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan version: %w", err)
-		}
-		json.Unmarshal(snapshotJSON, &v.Snapshot)
-		versions = append(versions, v)
-	}
-
-	return versions, nil
+	return s.nodes.ListVersions(ctx, nodeID, page)
 }
 
 // GetVersion returns a specific version of a node
 func (s *NodeService) GetVersion(ctx context.Context, nodeID, userID uuid.UUID, version int) (*models.NodeVersion, error) {
 	// Verify access
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM nodes n
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE n.id = $1 AND om.user_id = $2
-		)
-	`, nodeID, userID).Scan(&exists)
-
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, true)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
-	}
-	if !exists {
-		return nil, ErrNotFound
+		return nil, err
 	}
-
-	var v models.NodeVersion
-	var snapshotJSON []byte
-	err = s.db.Pool.QueryRow(ctx, `
-		SELECT id, node_id, version, snapshot, change_type, change_summary, changed_by, created_at
-		FROM node_versions
-		WHERE node_id = $1 AND version = $2
-	`, nodeID, version).Scan(&v.ID, &v.NodeID, &v.Version, &snapshotJSON, &v.ChangeType,
-		&v.ChangeSummary, &v.ChangedBy, &v.CreatedAt)
-
-	if errors.Is(err, pgx.ErrNoRows) {
+	if !visible {
 		return nil, ErrNotFound
 	}
-	if err != nil {
-		return nil, fmt.Errorf("failed to get version: %w", err)
-	}
 
-	json.Unmarshal(snapshotJSON, &v.Snapshot)
-	return &v, nil
+	return s.nodes.GetVersion(ctx, nodeID, version)
 }
 
 // Rollback restores a node to a previous version
 func (s *NodeService) Rollback(ctx context.Context, nodeID, userID uuid.UUID, targetVersion int) (*models.Node, error) {
 	var node *models.Node
+	var assigned bool
 
 	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
 		// Get target version
@@ -1258,13 +1125,15 @@ func (s *NodeService) Rollback(ctx context.Context, nodeID, userID uuid.UUID, ta
 		json.Unmarshal(restoredMetaJSON, &restored.Metadata)
 		json.Unmarshal(restoredPosJSON, &restored.Position)
 		node = &restored
-		return nil
+		assigned = supervisorChanged(currentSnapshot.SupervisorUserID, restored.SupervisorUserID)
+		return s.eventStore.Append(ctx, tx, node.OrgID, AggregateNode, node.ID, "node.rolled_back", node, &userID)
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
+	s.publishUpdated(ctx, node, userID, assigned)
 	return node, nil
 }
 
@@ -1272,93 +1141,33 @@ func (s *NodeService) Rollback(ctx context.Context, nodeID, userID uuid.UUID, ta
 // NODE RELATIONSHIPS
 // =====================================================
 
-// ListChildren returns child nodes
-func (s *NodeService) ListChildren(ctx context.Context, nodeID, userID uuid.UUID) ([]models.Node, error) {
+// ListChildren returns a page of a node's children, oldest first
+func (s *NodeService) ListChildren(ctx context.Context, nodeID, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error) {
 	// Verify access
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM nodes n
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-		)
-	`, nodeID, userID).Scan(&exists)
-
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
 	}
-	if !exists {
+	if !visible {
 		return nil, ErrNotFound
 	}
 
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, org_id, project_id, parent_id, title, description, status, author_type,
-		       author_user_id, supervisor_user_id, version, metadata, position,
-		       locked_by, locked_at, lock_expires_at, created_at, updated_at, deleted_at
-		FROM nodes
-		WHERE parent_id = $1 AND deleted_at IS NULL
-		ORDER BY created_at
-	`, nodeID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list children: %w", err)
-	}
-	defer rows.Close()
-
-	var children []models.Node
-	for rows.Next() {
-		node, err := s.scanNode(rows)
-		if err != nil {
-			return nil, err
-		}
-		children = append(children, *node)
-	}
-
-	return children, nil
+	return s.nodes.ListChildren(ctx, nodeID, page)
 }
 
-// ListDependencies returns nodes this node depends on (via inputs)
-func (s *NodeService) ListDependencies(ctx context.Context, nodeID, userID uuid.UUID) ([]models.Node, error) {
+// ListDependencies returns a page of the nodes this node depends on (via
+// inputs), oldest first
+func (s *NodeService) ListDependencies(ctx context.Context, nodeID, userID uuid.UUID, page pagination.Params) (*pagination.Page[models.Node], error) {
 	// Verify access
-	var exists bool
-	err := s.db.Pool.QueryRow(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM nodes n
-			JOIN org_members om ON n.org_id = om.org_id
-			WHERE n.id = $1 AND om.user_id = $2 AND n.deleted_at IS NULL
-		)
-	`, nodeID, userID).Scan(&exists)
-
+	visible, err := s.nodes.Visible(ctx, nodeID, userID, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify access: %w", err)
+		return nil, err
 	}
-	if !exists {
+	if !visible {
 		return nil, ErrNotFound
 	}
 
-	// Get nodes that this node depends on via node_inputs.source_node_id
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT DISTINCT n.id, n.org_id, n.project_id, n.parent_id, n.title, n.description, n.status, n.author_type,
-		       n.author_user_id, n.supervisor_user_id, n.version, n.metadata, n.position,
-		       n.locked_by, n.locked_at, n.lock_expires_at, n.created_at, n.updated_at, n.deleted_at
-		FROM nodes n
-		JOIN node_inputs ni ON n.id = ni.source_node_id
-		WHERE ni.node_id = $1 AND n.deleted_at IS NULL
-	`, nodeID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list dependencies: %w", err)
-	}
-	defer rows.Close()
-
-	var deps []models.Node
-	for rows.Next() {
-		node, err := s.scanNode(rows)
-		if err != nil {
-			return nil, err
-		}
-		deps = append(deps, *node)
-	}
-
-	return deps, nil
+	return s.nodes.ListDependencies(ctx, nodeID, page)
 }
 
 // =====================================================
@@ -1388,24 +1197,14 @@ func (s *NodeService) AcquireLock(ctx context.Context, nodeID, userID uuid.UUID)
 	}
 
 	// Update DB lock status
-	expiresAt := time.Now().Add(lockDuration)
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE nodes SET
-			locked_by = $2,
-			locked_at = NOW(),
-			lock_expires_at = $3,
-			updated_at = NOW()
-		WHERE id = $1 AND deleted_at IS NULL
-		  AND (locked_by IS NULL OR locked_by = $2 OR lock_expires_at < NOW())
-	`, nodeID, userID, expiresAt)
-
+	locked, err := s.nodes.Lock(ctx, nodeID, userID, time.Now().Add(lockDuration))
 	if err != nil {
 		// Clean up Redis lock on failure
 		s.redis.Client.Del(ctx, lockKey)
-		return fmt.Errorf("failed to acquire lock: %w", err)
+		return err
 	}
 
-	if result.RowsAffected() == 0 {
+	if !locked {
 		// Clean up Redis lock
 		s.redis.Client.Del(ctx, lockKey)
 		return ErrLockConflict
@@ -1424,119 +1223,33 @@ func (s *NodeService) ReleaseLock(ctx context.Context, nodeID, userID uuid.UUID)
 	}
 
 	// Release DB lock
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE nodes SET
-			locked_by = NULL,
-			locked_at = NULL,
-			lock_expires_at = NULL,
-			updated_at = NOW()
-		WHERE id = $1 AND locked_by = $2
-	`, nodeID, userID)
-
+	released, err := s.nodes.Unlock(ctx, nodeID, userID)
 	if err != nil {
-		return fmt.Errorf("failed to release lock: %w", err)
+		return err
 	}
 
-	if result.RowsAffected() == 0 {
+	if !released {
 		return ErrNotFound
 	}
 
 	return nil
 }
 
-// =====================================================
-// HELPER FUNCTIONS
-// =====================================================
-
-// scanNode scans a node row into a Node struct
-func (s *NodeService) scanNode(rows pgx.Rows) (*models.Node, error) {
-	var node models.Node
-	var metadataJSON, positionJSON []byte
-
-	if err := rows.Scan(
-		&node.ID, &node.OrgID, &node.ProjectID, &node.ParentID, &node.Title, &node.Description,
-		&node.Status, &node.AuthorType, &node.AuthorUserID, &node.SupervisorUserID, &node.Version,
-		&metadataJSON, &positionJSON, &node.LockedBy, &node.LockedAt, &node.LockExpiresAt,
-		&node.CreatedAt, &node.UpdatedAt, &node.DeletedAt,
-	); err != nil {
-		return nil, fmt.Errorf("failed to scan node: %w", err)
-	}
-
-	json.Unmarshal(metadataJSON, &node.Metadata)
-	json.Unmarshal(positionJSON, &node.Position)
-	return &node, nil
-}
-
-// getNodeInputs fetches all inputs for a node
-func (s *NodeService) getNodeInputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeInput, error) {
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, node_id, input_type, file_id, source_node_id, source_node_version,
-		       external_url, text_content, label, metadata, sort_order, created_at
-		FROM node_inputs
-		WHERE node_id = $1
-		ORDER BY sort_order
-	`, nodeID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get inputs: %w", err)
-	}
-	defer rows.Close()
-
-	var inputs []models.NodeInput
-	for rows.Next() {
-		var input models.NodeInput
-		var metadataJSON []byte
-		if err := rows.Scan(&input.ID, &input.NodeID, &input.InputType, &input.FileID,
-			&input.SourceNodeID, &input.SourceNodeVersion, &input.ExternalURL, &input.TextContent,
-			&input.Label, &metadataJSON, &input.SortOrder, &input.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan input: %w", err)
-		}
-		json.Unmarshal(metadataJSON, &input.Metadata)
-		inputs = append(inputs, input)
-	}
-
-	return inputs, nil
-}
-
-// getNodeOutputs fetches all outputs for a node
-func (s *NodeService) getNodeOutputs(ctx context.Context, nodeID uuid.UUID) ([]models.NodeOutput, error) {
-	rows, err := s.db.Pool.Query(ctx, `
-		SELECT id, node_id, output_type, file_id, structured_data, text_content,
-		       external_url, label, metadata, sort_order, created_at
-		FROM node_outputs
-		WHERE node_id = $1
-		ORDER BY sort_order
-	`, nodeID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get outputs: %w", err)
-	}
-	defer rows.Close()
-
-	var outputs []models.NodeOutput
-	for rows.Next() {
-		var output models.NodeOutput
-		var metadataJSON, structuredDataJSON []byte
-		if err := rows.Scan(&output.ID, &output.NodeID, &output.OutputType, &output.FileID,
-			&structuredDataJSON, &output.TextContent, &output.ExternalURL, &output.Label,
-			&metadataJSON, &output.SortOrder, &output.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan output: %w", err)
-		}
-		json.Unmarshal(metadataJSON, &output.Metadata)
-		json.Unmarshal(structuredDataJSON, &output.StructuredData)
-		outputs = append(outputs, output)
-	}
-
-	return outputs, nil
-}
-
 // FileService handles file operations
 type FileService struct {
 	db     *database.DB
 	s3     S3Client
 	sqs    SQSClient
 	cfg    *config.Config
+	notify FileStatusNotifier
 	logger *zap.Logger
+
+	eventStore *EventStore
 }
 
+// FileStatusNotifier reports a file whose processing status changed
+type FileStatusNotifier func(file *models.File)
+
 // S3Client interface for S3 operations (allows mocking in tests)
 type S3Client interface {
 	PresignedUploadURL(ctx context.Context, key, contentType string, expiration time.Duration) (string, error)
@@ -1546,10 +1259,12 @@ type S3Client interface {
 	Bucket() string
 }
 
-// SQSClient interface for SQS operations (allows mocking in tests)
+// SQSClient dispatches worker jobs over the configured queue backend, SQS by
+// default (allows mocking in tests). Jobs are written to the outbox in the
+// caller's transaction and sent once it commits.
 type SQSClient interface {
-	DispatchFileProcessingJob(ctx context.Context, job any) error
-	DispatchAgentJob(ctx context.Context, job any) error
+	EnqueueFileProcessingJob(ctx context.Context, tx pgx.Tx, job any) error
+	EnqueueAgentJob(ctx context.Context, tx pgx.Tx, job any) error
 }
 
 // FileProcessingJobMessage is the message sent to the file processing queue
@@ -1560,10 +1275,19 @@ type FileProcessingJobMessage struct {
 	Filename    string     `json:"filename"`
 	ContentType string     `json:"contentType"`
 	UploadedBy  *uuid.UUID `json:"uploadedBy,omitempty"`
+
+	// TraceContext carries the W3C trace context of the upload confirmation request
+	TraceContext map[string]string `json:"traceContext,omitempty"`
+}
+
+func NewFileService(db *database.DB, s3 S3Client, sqs SQSClient, eventStore *EventStore, cfg *config.Config, logger *zap.Logger) *FileService {
+	return &FileService{db: db, s3: s3, sqs: sqs, eventStore: eventStore, cfg: cfg, logger: logger}
 }
 
-func NewFileService(db *database.DB, s3 S3Client, sqs SQSClient, cfg *config.Config, logger *zap.Logger) *FileService {
-	return &FileService{db: db, s3: s3, sqs: sqs, cfg: cfg, logger: logger}
+// SetStatusNotifier enables live processing updates. Uploads report the
+// "uploaded" status; workers report the later ones through the internal API.
+func (s *FileService) SetStatusNotifier(notify FileStatusNotifier) {
+	s.notify = notify
 }
 
 // UploadURLRequest contains data for requesting an upload URL
@@ -1629,7 +1353,7 @@ func (s *FileService) ConfirmUpload(ctx context.Context, fileID, userID uuid.UUI
 
 	// Verify file is in pending status
 	if file.ProcessingStatus != "pending" {
-		return nil, fmt.Errorf("file is not in pending status")
+		return nil, ErrVersionConflict
 	}
 
 	// Verify file exists in S3 and get size
@@ -1638,39 +1362,56 @@ func (s *FileService) ConfirmUpload(ctx context.Context, fileID, userID uuid.UUI
 		return nil, fmt.Errorf("file not found in storage: %w", err)
 	}
 
-	// Update file status to uploaded and set size
-	err = s.db.Pool.QueryRow(ctx, `
-		UPDATE files SET
-			processing_status = 'uploaded',
-			size_bytes = $2
-		WHERE id = $1
-		RETURNING id, org_id, storage_key, storage_bucket, filename, content_type, size_bytes,
-		          processing_status, extracted_text, processing_error, metadata, created_at, uploaded_by
-	`, fileID, sizeBytes).Scan(
-		&file.ID, &file.OrgID, &file.StorageKey, &file.StorageBucket, &file.Filename,
-		&file.ContentType, &file.SizeBytes, &file.ProcessingStatus, &file.ExtractedText,
-		&file.ProcessingError, &file.Metadata, &file.CreatedAt, &file.UploadedBy,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update file status: %w", err)
-	}
-
-	// Dispatch file processing job
+	// Update file status to uploaded and set size, and queue processing in
+	// the same transaction. Files have no updated_at, so the pending status
+	// is the version: of two concurrent confirms only one queues a job.
 	contentType := ""
 	if file.ContentType != nil {
 		contentType = *file.ContentType
 	}
-	err = s.sqs.DispatchFileProcessingJob(ctx, FileProcessingJobMessage{
-		FileID:      file.ID,
-		OrgID:       file.OrgID,
-		StorageKey:  file.StorageKey,
-		Filename:    file.Filename,
-		ContentType: contentType,
-		UploadedBy:  file.UploadedBy,
+	err = s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, `
+			UPDATE files SET
+				processing_status = 'uploaded',
+				size_bytes = $2
+			WHERE id = $1 AND processing_status = 'pending'
+			RETURNING id, org_id, storage_key, storage_bucket, filename, content_type, size_bytes,
+			          processing_status, extracted_text, processing_error, metadata, created_at, uploaded_by
+		`, fileID, sizeBytes).Scan(
+			&file.ID, &file.OrgID, &file.StorageKey, &file.StorageBucket, &file.Filename,
+			&file.ContentType, &file.SizeBytes, &file.ProcessingStatus, &file.ExtractedText,
+			&file.ProcessingError, &file.Metadata, &file.CreatedAt, &file.UploadedBy,
+		)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return missedUpdate(ctx, tx, "files", fileID)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update file status: %w", err)
+		}
+
+		err = s.sqs.EnqueueFileProcessingJob(ctx, tx, FileProcessingJobMessage{
+			FileID:       file.ID,
+			OrgID:        file.OrgID,
+			StorageKey:   file.StorageKey,
+			Filename:     file.Filename,
+			ContentType:  contentType,
+			UploadedBy:   file.UploadedBy,
+			TraceContext: telemetry.InjectContext(ctx),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to queue file processing job: %w", err)
+		}
+		if err := recordOnboarding(ctx, tx, userID, OnboardingUploadedFile); err != nil {
+			return err
+		}
+		return s.eventStore.Append(ctx, tx, file.OrgID, AggregateFile, file.ID, "file.uploaded", file, &userID)
 	})
 	if err != nil {
-		s.logger.Error("Failed to dispatch file processing job", zap.Error(err), zap.String("fileId", fileID.String()))
-		// Don't fail the request - file is uploaded, processing can be retried
+		return nil, err
+	}
+
+	if s.notify != nil {
+		s.notify(file)
 	}
 
 	return file, nil
@@ -1737,12 +1478,12 @@ func (s *FileService) Delete(ctx context.Context, fileID, userID uuid.UUID) erro
 	}
 
 	// Delete from database
-	_, err = s.db.Pool.Exec(ctx, `DELETE FROM files WHERE id = $1`, fileID)
-	if err != nil {
-		return fmt.Errorf("failed to delete file record: %w", err)
-	}
-
-	return nil
+	return s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, `DELETE FROM files WHERE id = $1`, fileID); err != nil {
+			return fmt.Errorf("failed to delete file record: %w", err)
+		}
+		return s.eventStore.Append(ctx, tx, file.OrgID, AggregateFile, file.ID, "file.deleted", nil, &userID)
+	})
 }
 
 // getFileByID is a helper to get file by ID
@@ -1785,24 +1526,16 @@ func (s *FileService) userHasOrgAccess(ctx context.Context, userID, orgID uuid.U
 	return exists, nil
 }
 
-// TemplateService handles template operations
-type TemplateService struct {
-	db     *database.DB
-	logger *zap.Logger
-}
-
-func NewTemplateService(db *database.DB, logger *zap.Logger) *TemplateService {
-	return &TemplateService{db: db, logger: logger}
-}
-
 // UserService handles user operations
 type UserService struct {
-	db     *database.DB
-	logger *zap.Logger
+	db            *database.DB
+	az            *authz.Authorizer
+	notifications *NotificationService
+	logger        *zap.Logger
 }
 
-func NewUserService(db *database.DB, logger *zap.Logger) *UserService {
-	return &UserService{db: db, logger: logger}
+func NewUserService(db *database.DB, az *authz.Authorizer, notifications *NotificationService, logger *zap.Logger) *UserService {
+	return &UserService{db: db, az: az, notifications: notifications, logger: logger}
 }
 
 // GetByID returns a user by ID
@@ -1833,6 +1566,8 @@ func (s *UserService) GetByID(ctx context.Context, userID uuid.UUID) (*models.Us
 type UpdateUserRequest struct {
 	Name     *string              `json:"name,omitempty"`
 	Settings *models.UserSettings `json:"settings,omitempty"`
+
+	IfMatch Precondition `json:"-"`
 }
 
 // Update updates the current user's profile
@@ -1849,15 +1584,15 @@ func (s *UserService) Update(ctx context.Context, userID uuid.UUID, req UpdateUs
 			name = COALESCE($2, name),
 			settings = COALESCE($3, settings),
 			updated_at = NOW()
-		WHERE id = $1
+		WHERE id = $1 AND `+versionCheck(4)+`
 		RETURNING id, cognito_sub, email, name, avatar_url, settings, created_at, updated_at
-	`, userID, req.Name, settingsJSON).Scan(
+	`, userID, req.Name, settingsJSON, req.IfMatch.UpdatedAt).Scan(
 		&user.ID, &user.CognitoSub, &user.Email, &user.Name, &user.AvatarURL,
 		&settingsJSON, &user.CreatedAt, &user.UpdatedAt,
 	)
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		return nil, ErrNotFound
+		return nil, missedUpdate(ctx, s.db.Pool, "users", userID)
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to update user: %w", err)
@@ -1868,18 +1603,21 @@ func (s *UserService) Update(ctx context.Context, userID uuid.UUID, req UpdateUs
 }
 
 // ListNotifications returns notifications for a user
-func (s *UserService) ListNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool) ([]models.Notification, error) {
-	query := `
-		SELECT id, user_id, org_id, type, title, body, resource_type, resource_id, read_at, created_at
-		FROM notifications
-		WHERE user_id = $1
-	`
-	if unreadOnly {
-		query += " AND read_at IS NULL"
+func (s *UserService) ListNotifications(ctx context.Context, userID uuid.UUID, unreadOnly bool, page pagination.Params) (*pagination.Page[models.Notification], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
 	}
-	query += " ORDER BY created_at DESC LIMIT 50"
+	limit := page.PageLimit()
 
-	rows, err := s.db.Pool.Query(ctx, query, userID)
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT id, user_id, org_id, type, title, body, resource_type, resource_id, count, read_at, created_at
+		FROM notifications
+		WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+		  AND ($3::TIMESTAMPTZ IS NULL OR (created_at, id) < ($3, $4::UUID))
+		ORDER BY created_at DESC, id DESC
+		LIMIT $5
+	`, userID, unreadOnly, afterCreated, afterID, limit+1)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list notifications: %w", err)
 	}
@@ -1890,42 +1628,56 @@ func (s *UserService) ListNotifications(ctx context.Context, userID uuid.UUID, u
 		var n models.Notification
 		if err := rows.Scan(
 			&n.ID, &n.UserID, &n.OrgID, &n.Type, &n.Title, &n.Body,
-			&n.ResourceType, &n.ResourceID, &n.ReadAt, &n.CreatedAt,
+			&n.ResourceType, &n.ResourceID, &n.Count, &n.ReadAt, &n.CreatedAt,
 		); err != nil {
 			return nil, fmt.Errorf("failed to scan notification: %w", err)
 		}
 		notifications = append(notifications, n)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list notifications: %w", err)
+	}
 
-	return notifications, nil
+	result := pagination.NewPage(notifications, limit, func(n models.Notification) pagination.Cursor {
+		return pagination.TimeCursor(n.CreatedAt, n.ID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND (NOT $2 OR read_at IS NULL)
+	`, userID, unreadOnly).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count notifications: %w", err)
+	}
+	return result, nil
 }
 
 // MarkNotificationRead marks a notification as read
 func (s *UserService) MarkNotificationRead(ctx context.Context, userID, notificationID uuid.UUID) error {
-	result, err := s.db.Pool.Exec(ctx, `
-		UPDATE notifications SET read_at = NOW()
-		WHERE id = $1 AND user_id = $2 AND read_at IS NULL
-	`, notificationID, userID)
-
-	if err != nil {
-		return fmt.Errorf("failed to mark notification read: %w", err)
-	}
+	return s.notifications.MarkRead(ctx, userID, notificationID)
+}
 
-	if result.RowsAffected() == 0 {
-		return ErrNotFound
-	}
+// MarkAllNotificationsRead marks all of the user's notifications as read and
+// returns how many were unread
+func (s *UserService) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	return s.notifications.MarkAllRead(ctx, userID)
+}
 
-	return nil
+// UnreadNotificationCount returns how many of the user's notifications are
+// unread
+func (s *UserService) UnreadNotificationCount(ctx context.Context, userID uuid.UUID) (int, error) {
+	return s.notifications.UnreadCount(ctx, userID)
 }
 
-// SearchService handles search operations
+// SearchService handles search operations. Searches scan text with LIKE,
+// so each is given a deadline and its queries are cancelled when it passes
+// or the request is abandoned.
 type SearchService struct {
-	db     *database.DB
-	logger *zap.Logger
+	db      *database.DB
+	timeout time.Duration
+	logger  *zap.Logger
 }
 
-func NewSearchService(db *database.DB, logger *zap.Logger) *SearchService {
-	return &SearchService{db: db, logger: logger}
+func NewSearchService(db *database.DB, timeout time.Duration, logger *zap.Logger) *SearchService {
+	return &SearchService{db: db, timeout: timeout, logger: logger}
 }
 
 // AuthService handles authentication operations
@@ -1950,7 +1702,13 @@ type DevTokenClaims struct {
 
 // GenerateDevToken creates a JWT token for development/testing
 func (s *AuthService) GenerateDevToken(ctx context.Context, userID, email string) (string, time.Time, error) {
-	expiresAt := time.Now().Add(24 * time.Hour)
+	method, key, err := s.cfg.JWTSigningKey()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(s.cfg.JWTTokenLifetime)
 
 	claims := DevTokenClaims{
 		UserID:     userID,
@@ -1958,13 +1716,13 @@ func (s *AuthService) GenerateDevToken(ctx context.Context, userID, email string
 		CognitoSub: "dev-" + userID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "glassbox-dev",
+			IssuedAt:  jwt.NewNumericDate(now),
+			Issuer:    s.cfg.JWTIssuer,
+			Audience:  jwt.ClaimStrings{s.cfg.JWTAudience},
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(s.cfg.JWTSecret))
+	tokenString, err := jwt.NewWithClaims(method, claims).SignedString(key)
 	if err != nil {
 		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
 	}
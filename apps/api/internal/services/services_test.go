@@ -0,0 +1,391 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/glassbox/api/internal/repository"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// fixture is an org with one member and one project, in a Memory the
+// services under test read through
+type fixture struct {
+	mem       *repository.Memory
+	orgID     uuid.UUID
+	projectID uuid.UUID
+	member    uuid.UUID
+	outsider  uuid.UUID
+}
+
+func newFixture() *fixture {
+	f := &fixture{
+		mem:       repository.NewMemory(),
+		orgID:     uuid.New(),
+		projectID: uuid.New(),
+		member:    uuid.New(),
+		outsider:  uuid.New(),
+	}
+	f.mem.Orgs[f.orgID] = models.Organization{ID: f.orgID, Name: "Acme", Slug: "acme"}
+	f.mem.Members[f.orgID] = map[uuid.UUID]string{f.member: "owner"}
+	f.mem.Projects[f.projectID] = models.Project{ID: f.projectID, OrgID: f.orgID}
+	return f
+}
+
+// addNode adds a live node to the fixture's project, created at
+func (f *fixture) addNode(created time.Time, parentID *uuid.UUID) models.Node {
+	node := models.Node{
+		ID:         uuid.New(),
+		OrgID:      f.orgID,
+		ProjectID:  f.projectID,
+		ParentID:   parentID,
+		Title:      "node",
+		Status:     "draft",
+		AuthorType: "human",
+		CreatedAt:  created,
+		UpdatedAt:  created,
+	}
+	f.mem.Nodes[node.ID] = node
+	return node
+}
+
+func (f *fixture) nodeService() *NodeService {
+	return NewNodeService(nil, f.mem.NodeRepo(), nil, nil, nil, zap.NewNop())
+}
+
+func (f *fixture) executionService() *ExecutionServiceFull {
+	return NewExecutionServiceFull(nil, f.mem.ExecutionRepo(), f.mem.NodeRepo(), nil, nil, nil, nil, zap.NewNop())
+}
+
+func nodeIDs(nodes []models.Node) []uuid.UUID {
+	ids := make([]uuid.UUID, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+func TestNodeListByProjectPagesNewestFirst(t *testing.T) {
+	f := newFixture()
+	base := time.Now().Add(-time.Hour)
+	var want []uuid.UUID
+	for i := range 5 {
+		want = append([]uuid.UUID{f.addNode(base.Add(time.Duration(i)*time.Minute), nil).ID}, want...)
+	}
+	deleted := f.addNode(base.Add(time.Hour), nil)
+	deletedAt := time.Now()
+	deleted.DeletedAt = &deletedAt
+	f.mem.Nodes[deleted.ID] = deleted
+
+	svc := f.nodeService()
+	req := ListNodesRequest{Params: pagination.Params{Limit: 2}}
+	var got []uuid.UUID
+	for pages := 0; ; pages++ {
+		if pages == 5 {
+			t.Fatal("pagination did not end")
+		}
+		page, err := svc.ListByProject(context.Background(), f.projectID, f.member, req)
+		if err != nil {
+			t.Fatalf("ListByProject: %v", err)
+		}
+		if page.Total != 5 {
+			t.Fatalf("Total = %d, want 5", page.Total)
+		}
+		got = append(got, nodeIDs(page.Items)...)
+		if !page.HasMore {
+			break
+		}
+		req.Cursor = page.NextCursor
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d nodes, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("node %d = %s, want %s", i, got[i], want[i])
+		}
+	}
+}
+
+func TestNodeListByProjectFilters(t *testing.T) {
+	f := newFixture()
+	now := time.Now()
+	root := f.addNode(now, nil)
+	child := f.addNode(now.Add(time.Second), &root.ID)
+	svc := f.nodeService()
+
+	for _, tc := range []struct {
+		parentID string
+		want     []uuid.UUID
+	}{
+		{"null", []uuid.UUID{root.ID}},
+		{root.ID.String(), []uuid.UUID{child.ID}},
+		{"not-a-node", nil},
+	} {
+		page, err := svc.ListByProject(context.Background(), f.projectID, f.member, ListNodesRequest{ParentID: &tc.parentID})
+		if err != nil {
+			t.Fatalf("parentId=%s: %v", tc.parentID, err)
+		}
+		got := nodeIDs(page.Items)
+		if len(got) != len(tc.want) || (len(got) == 1 && got[0] != tc.want[0]) {
+			t.Fatalf("parentId=%s: got %v, want %v", tc.parentID, got, tc.want)
+		}
+	}
+}
+
+func TestNodeListByProjectForbidsOutsiders(t *testing.T) {
+	f := newFixture()
+	f.addNode(time.Now(), nil)
+
+	_, err := f.nodeService().ListByProject(context.Background(), f.projectID, f.outsider, ListNodesRequest{})
+	if !errors.Is(err, ErrForbidden) {
+		t.Fatalf("err = %v, want ErrForbidden", err)
+	}
+}
+
+func TestNodeInputsKeepOrderAndCheckAccess(t *testing.T) {
+	f := newFixture()
+	node := f.addNode(time.Now().Add(-time.Minute), nil)
+	svc := f.nodeService()
+	ctx := context.Background()
+
+	if _, err := svc.AddInput(ctx, node.ID, f.outsider, AddInputRequest{InputType: "text"}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outsider AddInput err = %v, want ErrNotFound", err)
+	}
+
+	var added []*models.NodeInput
+	for range 3 {
+		input, err := svc.AddInput(ctx, node.ID, f.member, AddInputRequest{InputType: "text"})
+		if err != nil {
+			t.Fatalf("AddInput: %v", err)
+		}
+		added = append(added, input)
+	}
+	for i, input := range added {
+		if input.SortOrder != i {
+			t.Fatalf("input %d SortOrder = %d", i, input.SortOrder)
+		}
+		if input.Metadata == nil {
+			t.Fatalf("input %d has nil metadata", i)
+		}
+	}
+	if !f.mem.Nodes[node.ID].UpdatedAt.After(node.UpdatedAt) {
+		t.Fatal("adding an input didn't touch the node")
+	}
+
+	if err := svc.RemoveInput(ctx, node.ID, added[1].ID, f.outsider); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outsider RemoveInput err = %v, want ErrNotFound", err)
+	}
+	if err := svc.RemoveInput(ctx, node.ID, added[1].ID, f.member); err != nil {
+		t.Fatalf("RemoveInput: %v", err)
+	}
+	if err := svc.RemoveInput(ctx, node.ID, added[1].ID, f.member); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second RemoveInput err = %v, want ErrNotFound", err)
+	}
+
+	// A new input goes after the others, not into the removed one's place
+	last, err := svc.AddInput(ctx, node.ID, f.member, AddInputRequest{InputType: "text"})
+	if err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	if last.SortOrder != 3 {
+		t.Fatalf("SortOrder = %d, want 3", last.SortOrder)
+	}
+
+	got, err := svc.GetByID(ctx, node.ID, f.member)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	want := []uuid.UUID{added[0].ID, added[2].ID, last.ID}
+	if len(got.Inputs) != len(want) {
+		t.Fatalf("got %d inputs, want %d", len(got.Inputs), len(want))
+	}
+	for i, input := range got.Inputs {
+		if input.ID != want[i] {
+			t.Fatalf("input %d = %s, want %s", i, input.ID, want[i])
+		}
+	}
+}
+
+func TestNodeOutputsCheckAccess(t *testing.T) {
+	f := newFixture()
+	node := f.addNode(time.Now(), nil)
+	svc := f.nodeService()
+	ctx := context.Background()
+
+	output, err := svc.AddOutput(ctx, node.ID, f.member, AddOutputRequest{OutputType: "text"})
+	if err != nil {
+		t.Fatalf("AddOutput: %v", err)
+	}
+	if err := svc.RemoveOutput(ctx, node.ID, output.ID, f.outsider); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outsider RemoveOutput err = %v, want ErrNotFound", err)
+	}
+	// The output belongs to node, not to another node the member can see
+	other := f.addNode(time.Now(), nil)
+	if err := svc.RemoveOutput(ctx, other.ID, output.ID, f.member); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("RemoveOutput via another node err = %v, want ErrNotFound", err)
+	}
+	if err := svc.RemoveOutput(ctx, node.ID, output.ID, f.member); err != nil {
+		t.Fatalf("RemoveOutput: %v", err)
+	}
+}
+
+func TestNodeGetByIDHidesDeletedNodes(t *testing.T) {
+	f := newFixture()
+	node := f.addNode(time.Now(), nil)
+	deletedAt := time.Now()
+	node.DeletedAt = &deletedAt
+	f.mem.Nodes[node.ID] = node
+
+	if _, err := f.nodeService().GetByID(context.Background(), node.ID, f.member); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestNodeIfMatchSurvivesLocksAndInputs(t *testing.T) {
+	f := newFixture()
+	node := f.addNode(time.Now().Add(-time.Minute), nil)
+	node.Version = 3
+	f.mem.Nodes[node.ID] = node
+	svc := f.nodeService()
+	ctx := context.Background()
+
+	read, err := svc.GetByID(ctx, node.ID, f.member)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	ifMatch := UpdateNodeRequest{IfMatch: Precondition{Version: &read.Version}}
+
+	// Locking the node and adding an input move its updated_at, not its
+	// version
+	if locked, err := f.mem.NodeRepo().Lock(ctx, node.ID, f.member, time.Now().Add(lockDuration)); err != nil || !locked {
+		t.Fatalf("Lock = %v, %v", locked, err)
+	}
+	if _, err := svc.AddInput(ctx, node.ID, f.member, AddInputRequest{InputType: "text"}); err != nil {
+		t.Fatalf("AddInput: %v", err)
+	}
+	current, err := svc.GetByID(ctx, node.ID, f.member)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if current.UpdatedAt.Equal(read.UpdatedAt) {
+		t.Fatal("locking didn't touch the node")
+	}
+	if err := checkNodeUpdate(current, f.member, ifMatch); err != nil {
+		t.Fatalf("update by the lock holder with the pre-lock ETag: %v", err)
+	}
+
+	if err := checkNodeUpdate(current, f.outsider, ifMatch); !errors.Is(err, ErrLockConflict) {
+		t.Fatalf("update by another user err = %v, want ErrLockConflict", err)
+	}
+	stale := read.Version - 1
+	if err := checkNodeUpdate(current, f.member, UpdateNodeRequest{IfMatch: Precondition{Version: &stale}}); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("update from an older version err = %v, want ErrVersionConflict", err)
+	}
+}
+
+func TestOrganizationAccessNeedsMembership(t *testing.T) {
+	f := newFixture()
+	svc := NewOrganizationService(nil, f.mem.OrgRepo(), nil, zap.NewNop())
+	ctx := context.Background()
+
+	page, err := svc.ListByUser(ctx, f.outsider, pagination.Params{})
+	if err != nil {
+		t.Fatalf("ListByUser: %v", err)
+	}
+	if len(page.Items) != 0 {
+		t.Fatalf("outsider sees %d orgs", len(page.Items))
+	}
+	if _, err := svc.GetByID(ctx, f.orgID, f.outsider); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outsider GetByID err = %v, want ErrNotFound", err)
+	}
+
+	org, err := svc.GetByID(ctx, f.orgID, f.member)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if org.Slug != "acme" {
+		t.Fatalf("Slug = %q", org.Slug)
+	}
+}
+
+func TestProjectAccessNeedsMembership(t *testing.T) {
+	f := newFixture()
+	svc := NewProjectService(nil, f.mem.OrgRepo(), f.mem.ProjectRepo(), nil, nil, zap.NewNop())
+	ctx := context.Background()
+
+	if _, err := svc.ListByOrg(ctx, f.orgID, f.outsider, pagination.Params{}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("outsider ListByOrg err = %v, want ErrForbidden", err)
+	}
+	if _, err := svc.GetByID(ctx, f.projectID, f.outsider); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outsider GetByID err = %v, want ErrNotFound", err)
+	}
+	if projects, err := svc.ListByIDs(ctx, []uuid.UUID{f.projectID}, f.outsider); err != nil || len(projects) != 0 {
+		t.Fatalf("outsider ListByIDs = %v, %v", projects, err)
+	}
+
+	page, err := svc.ListByOrg(ctx, f.orgID, f.member, pagination.Params{})
+	if err != nil {
+		t.Fatalf("ListByOrg: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].ID != f.projectID || page.Total != 1 {
+		t.Fatalf("ListByOrg = %+v", page)
+	}
+	if _, err := svc.GetByID(ctx, f.projectID, f.member); err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+}
+
+func TestExecutionPauseAndCancel(t *testing.T) {
+	f := newFixture()
+	node := f.addNode(time.Now(), nil)
+	exec := repository.Execution{
+		AgentExecution: models.AgentExecution{ID: uuid.New(), NodeID: node.ID, Status: "pending", CreatedAt: time.Now()},
+		OrgID:          f.orgID,
+	}
+	f.mem.Executions[exec.ID] = exec
+	svc := f.executionService()
+	ctx := context.Background()
+
+	if err := svc.Pause(ctx, node.ID, f.outsider); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("outsider Pause err = %v, want ErrNotFound", err)
+	}
+	if err := svc.Pause(ctx, node.ID, f.member); !errors.Is(err, ErrExecutionNotPausable) {
+		t.Fatalf("Pause of pending err = %v, want ErrExecutionNotPausable", err)
+	}
+
+	exec.Status = "running"
+	f.mem.Executions[exec.ID] = exec
+	if err := svc.Pause(ctx, node.ID, f.member); err != nil {
+		t.Fatalf("Pause: %v", err)
+	}
+	current, err := svc.GetCurrentForNode(ctx, node.ID, f.member)
+	if err != nil {
+		t.Fatalf("GetCurrentForNode: %v", err)
+	}
+	if current.Status != "paused" {
+		t.Fatalf("Status = %q, want paused", current.Status)
+	}
+
+	if err := svc.Cancel(ctx, node.ID, f.member); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	got, err := svc.GetByID(ctx, exec.ID, f.member)
+	if err != nil {
+		t.Fatalf("GetByID: %v", err)
+	}
+	if got.Status != "cancelled" || got.CompletedAt == nil {
+		t.Fatalf("got status %q, completed %v; want cancelled with a completion time", got.Status, got.CompletedAt)
+	}
+
+	// Nothing is active any more
+	if err := svc.Cancel(ctx, node.ID, f.member); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Cancel err = %v, want ErrNotFound", err)
+	}
+}
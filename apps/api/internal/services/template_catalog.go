@@ -0,0 +1,262 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrTemplateNotPublic = errors.New("only public templates can be featured")
+
+// ListTemplatesRequest filters and sorts a template list
+type ListTemplatesRequest struct {
+	Category *string `form:"category"`
+	Featured *bool   `form:"featured"`
+	Sort     string  `form:"sort" binding:"omitempty,oneof=name popular rating newest"`
+}
+
+// templateSort is an order templates can be listed in
+type templateSort struct {
+	key     string // column sorted on
+	keyType string // its SQL type, for the cursor param
+	desc    bool
+	after   func(page pagination.Params) (any, *uuid.UUID, error)
+	cursor  func(t models.Template) pagination.Cursor
+}
+
+// templateNameSort is the default order
+var templateNameSort = templateSort{
+	key: "t.name", keyType: "TEXT",
+	after: func(p pagination.Params) (any, *uuid.UUID, error) {
+		name, id, err := p.AfterString()
+		return name, id, err
+	},
+	cursor: func(t models.Template) pagination.Cursor { return pagination.StringCursor(t.Name, t.ID) },
+}
+
+// templateSorts are the orders of ListTemplatesRequest.Sort, by name when
+// it's empty
+var templateSorts = map[string]templateSort{
+	"":     templateNameSort,
+	"name": templateNameSort,
+	"popular": {
+		key: "t.usage_count", keyType: "INT", desc: true,
+		after: func(p pagination.Params) (any, *uuid.UUID, error) {
+			n, id, err := p.AfterInt()
+			return n, id, err
+		},
+		cursor: func(t models.Template) pagination.Cursor { return pagination.IntCursor(t.UsageCount, t.ID) },
+	},
+	"rating": {
+		key: "t.rating_score", keyType: "INT", desc: true,
+		after: func(p pagination.Params) (any, *uuid.UUID, error) {
+			n, id, err := p.AfterInt()
+			return n, id, err
+		},
+		cursor: func(t models.Template) pagination.Cursor { return pagination.IntCursor(ratingScore(t), t.ID) },
+	},
+	"newest": {
+		key: "t.created_at", keyType: "TIMESTAMPTZ", desc: true,
+		after: func(p pagination.Params) (any, *uuid.UUID, error) {
+			at, id, err := p.AfterTime()
+			return at, id, err
+		},
+		cursor: func(t models.Template) pagination.Cursor { return pagination.TimeCursor(t.CreatedAt, t.ID) },
+	},
+}
+
+// ratingScore is templates.rating_score: the average rating in hundredths
+func ratingScore(t models.Template) int {
+	if t.Rating == nil {
+		return 0
+	}
+	return int(math.Round(*t.Rating * 100))
+}
+
+// normalizeCategories lowercases and trims categories and drops duplicates
+func normalizeCategories(categories []string) []string {
+	normalized := make([]string, 0, len(categories))
+	for _, c := range categories {
+		c = strings.ToLower(strings.TrimSpace(c))
+		if c != "" && !slices.Contains(normalized, c) {
+			normalized = append(normalized, c)
+		}
+	}
+	return normalized
+}
+
+// ListCategories returns the categories of the public catalog, largest
+// first
+func (s *TemplateService) ListCategories(ctx context.Context) ([]models.TemplateCategory, error) {
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT category, COUNT(*)
+		FROM templates, unnest(categories) AS category
+		WHERE is_public
+		GROUP BY category
+		ORDER BY COUNT(*) DESC, category
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []models.TemplateCategory{}
+	for rows.Next() {
+		var c models.TemplateCategory
+		if err := rows.Scan(&c.Name, &c.Count); err != nil {
+			return nil, fmt.Errorf("failed to scan template category: %w", err)
+		}
+		categories = append(categories, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list template categories: %w", err)
+	}
+	return categories, nil
+}
+
+// RateTemplateRequest contains a user's rating of a template
+type RateTemplateRequest struct {
+	Rating int `json:"rating" binding:"required,min=1,max=5"`
+}
+
+// Rate sets the user's rating of a public template, replacing any earlier
+// one, and returns the template with its new average
+func (s *TemplateService) Rate(ctx context.Context, templateID, userID uuid.UUID, rating int) (*models.Template, error) {
+	var t *models.Template
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		if err := lockPublicTemplate(ctx, tx, templateID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			INSERT INTO template_ratings (template_id, user_id, rating)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (template_id, user_id) DO UPDATE SET rating = EXCLUDED.rating, updated_at = NOW()
+		`, templateID, userID, rating)
+		if err != nil {
+			return fmt.Errorf("failed to rate template: %w", err)
+		}
+
+		t, err = updateTemplateRating(ctx, tx, templateID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RemoveRating deletes the user's rating of a public template, if any, and
+// returns the template with its new average
+func (s *TemplateService) RemoveRating(ctx context.Context, templateID, userID uuid.UUID) (*models.Template, error) {
+	var t *models.Template
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		if err := lockPublicTemplate(ctx, tx, templateID); err != nil {
+			return err
+		}
+
+		_, err := tx.Exec(ctx, `
+			DELETE FROM template_ratings WHERE template_id = $1 AND user_id = $2
+		`, templateID, userID)
+		if err != nil {
+			return fmt.Errorf("failed to remove template rating: %w", err)
+		}
+
+		t, err = updateTemplateRating(ctx, tx, templateID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// lockPublicTemplate locks a public template's row, so concurrent ratings
+// recount one after the other. ErrNotFound if it isn't public.
+func lockPublicTemplate(ctx context.Context, tx pgx.Tx, templateID uuid.UUID) error {
+	var id uuid.UUID
+	err := tx.QueryRow(ctx, `
+		SELECT id FROM templates WHERE id = $1 AND is_public FOR UPDATE
+	`, templateID).Scan(&id)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get template: %w", err)
+	}
+	return nil
+}
+
+// updateTemplateRating recounts a template's ratings. The caller must hold
+// its row lock.
+func updateTemplateRating(ctx context.Context, tx pgx.Tx, templateID uuid.UUID) (*models.Template, error) {
+	t, err := scanTemplate(tx.QueryRow(ctx, `
+		UPDATE templates t SET
+			rating_count = r.count,
+			rating_total = r.total
+		FROM (
+			SELECT COUNT(*) AS count, COALESCE(SUM(rating), 0) AS total
+			FROM template_ratings WHERE template_id = $1
+		) r
+		WHERE t.id = $1
+		RETURNING `+templateColumns+`
+	`, templateID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update template rating: %w", err)
+	}
+	return t, nil
+}
+
+// SetFeatured features a public template in the catalog, or stops
+// featuring it. Platform admins only.
+func (s *TemplateService) SetFeatured(ctx context.Context, templateID uuid.UUID, featured bool) (*models.Template, error) {
+	var t *models.Template
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var isPublic bool
+		err := tx.QueryRow(ctx, `
+			SELECT is_public FROM templates WHERE id = $1 FOR UPDATE
+		`, templateID).Scan(&isPublic)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get template: %w", err)
+		}
+		if featured && !isPublic {
+			return ErrTemplateNotPublic
+		}
+
+		t, err = scanTemplate(tx.QueryRow(ctx, `
+			UPDATE templates t SET is_featured = $2
+			WHERE t.id = $1
+			RETURNING `+templateColumns+`
+		`, templateID, featured))
+		if err != nil {
+			return fmt.Errorf("failed to update template: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// recordTemplateUse counts a use of a template towards its popularity
+func recordTemplateUse(ctx context.Context, tx pgx.Tx, templateID uuid.UUID) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE templates SET usage_count = usage_count + 1 WHERE id = $1
+	`, templateID)
+	if err != nil {
+		return fmt.Errorf("failed to record template use: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"gopkg.in/yaml.v3"
+)
+
+// TemplateFileFormat identifies template files and their schema version
+const TemplateFileFormat = "glassbox.template/v1"
+
+// Most templates a file may hold
+const maxTemplateFileTemplates = 100
+
+var (
+	ErrInvalidTemplateFile  = errors.New("invalid template file")
+	ErrTemplateFileTooLarge = errors.New("template file holds too many templates")
+)
+
+// TemplateFile is a template, and the templates its sub-nodes are created
+// from, as exported to and imported from a YAML or JSON file
+type TemplateFile struct {
+	Format string `json:"format" binding:"required,eq=glassbox.template/v1"`
+
+	// The exported template first, then the templates its sub-nodes use.
+	// A sub-node's templateId is the id of one of these, or of a template
+	// expected to exist where the file is imported.
+	Templates []TemplateFileEntry `json:"templates" binding:"required,min=1,max=100,dive"`
+}
+
+// TemplateFileEntry is one template in a TemplateFile. ID only identifies
+// it within the file; imported templates get new IDs.
+type TemplateFileEntry struct {
+	ID          uuid.UUID                `json:"id" binding:"required"`
+	Name        string                   `json:"name" binding:"required,max=255"`
+	Description *string                  `json:"description,omitempty"`
+	Structure   models.TemplateStructure `json:"structure"`
+	AgentConfig models.AgentConfig       `json:"agentConfig"`
+	Categories  []string                 `json:"categories,omitempty" binding:"max=10,dive,min=1,max=50"`
+}
+
+func newTemplateFileEntry(t *models.Template) TemplateFileEntry {
+	return TemplateFileEntry{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Structure:   t.Structure,
+		AgentConfig: t.AgentConfig,
+		Categories:  t.Categories,
+	}
+}
+
+// EncodeTemplateFile writes f as JSON, or as YAML when yamlFormat is set.
+// YAML keeps the field order of the JSON.
+func EncodeTemplateFile(f *TemplateFile, yamlFormat bool) ([]byte, error) {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil || !yamlFormat {
+		return data, err
+	}
+
+	// JSON is YAML, so decoding it as a node tree keeps the order, and
+	// clearing the flow style writes it out in block style
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	clearYAMLStyle(&doc)
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// clearYAMLStyle resets the style of n and its descendants. The encoder
+// still quotes strings that would otherwise read as another type.
+func clearYAMLStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		clearYAMLStyle(child)
+	}
+}
+
+// DecodeTemplateFile reads a template file in YAML or JSON. The result
+// still needs validating.
+func DecodeTemplateFile(data []byte) (*TemplateFile, error) {
+	var doc any
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplateFile, err)
+	}
+
+	// Decode through JSON, so files follow the API's field names and types
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplateFile, err)
+	}
+	var f TemplateFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTemplateFile, err)
+	}
+	return &f, nil
+}
+
+// Export returns a template the user can see as a file, along with the
+// templates its sub-nodes use, down to the depth Apply follows. Sub-node
+// templates are bundled when they're public or in the template's own org;
+// others are left as references.
+func (s *TemplateService) Export(ctx context.Context, templateID, userID uuid.UUID, clientIP string) (*TemplateFile, error) {
+	root, err := s.Get(ctx, templateID, userID, clientIP)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &TemplateFile{Format: TemplateFileFormat, Templates: []TemplateFileEntry{newTemplateFileEntry(root)}}
+	seen := map[uuid.UUID]bool{root.ID: true}
+	level := []*models.Template{root}
+	for depth := 0; depth < maxTemplateDepth && len(level) > 0; depth++ {
+		var next []*models.Template
+		for _, t := range level {
+			for _, sub := range t.Structure.SubNodes {
+				if sub.TemplateID == nil || seen[*sub.TemplateID] {
+					continue
+				}
+				seen[*sub.TemplateID] = true
+
+				subTemplate, err := scanTemplate(s.db.Reader().QueryRow(ctx, `
+					SELECT `+templateColumns+`
+					FROM templates t
+					WHERE t.id = $1 AND (t.is_public OR t.org_id IS NOT DISTINCT FROM $2)
+				`, *sub.TemplateID, root.OrgID))
+				if errors.Is(err, pgx.ErrNoRows) {
+					continue
+				}
+				if err != nil {
+					return nil, fmt.Errorf("failed to get template: %w", err)
+				}
+				if len(f.Templates) == maxTemplateFileTemplates {
+					return nil, ErrTemplateFileTooLarge
+				}
+				f.Templates = append(f.Templates, newTemplateFileEntry(subTemplate))
+				next = append(next, subTemplate)
+			}
+		}
+		level = next
+	}
+
+	return f, nil
+}
+
+// exportedNode is a node of the subtree ExportNode reads
+type exportedNode struct {
+	id          uuid.UUID
+	parentID    *uuid.UUID
+	title       string
+	description *string
+	authorType  string
+	agentConfig *models.AgentConfig
+	depth       int
+	children    []*exportedNode
+}
+
+// ExportNode turns a node and its descendants into a template file. The
+// node and each descendant with children become templates, with a slot for
+// each of their inputs and outputs; childless descendants become plain
+// sub-nodes. Input and output contents aren't exported. Levels deeper than
+// Apply follows are left out. Callers must have checked the user can read
+// the node.
+func (s *TemplateService) ExportNode(ctx context.Context, nodeID uuid.UUID) (*TemplateFile, error) {
+	rows, err := s.db.Reader().Query(ctx, `
+		WITH RECURSIVE subtree AS (
+			SELECT id, parent_id, title, description, author_type, agent_config, created_at, 0 AS depth
+			FROM nodes
+			WHERE id = $1 AND deleted_at IS NULL
+			UNION ALL
+			SELECT n.id, n.parent_id, n.title, n.description, n.author_type, n.agent_config, n.created_at, s.depth + 1
+			FROM nodes n
+			JOIN subtree s ON n.parent_id = s.id
+			WHERE n.deleted_at IS NULL AND s.depth <= $2
+		)
+		SELECT id, parent_id, title, description, author_type, agent_config, depth
+		FROM subtree
+		ORDER BY depth, created_at, id
+	`, nodeID, maxTemplateDepth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read node subtree: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []*exportedNode
+	byID := map[uuid.UUID]*exportedNode{}
+	for rows.Next() {
+		var n exportedNode
+		var agentConfigJSON []byte
+		if err := rows.Scan(&n.id, &n.parentID, &n.title, &n.description, &n.authorType, &agentConfigJSON, &n.depth); err != nil {
+			return nil, fmt.Errorf("failed to scan node: %w", err)
+		}
+		if agentConfigJSON != nil {
+			json.Unmarshal(agentConfigJSON, &n.agentConfig)
+		}
+		// Rows come parents first
+		if n.depth > 0 {
+			byID[*n.parentID].children = append(byID[*n.parentID].children, &n)
+		}
+		byID[n.id] = &n
+		nodes = append(nodes, &n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read node subtree: %w", err)
+	}
+	if len(nodes) == 0 {
+		return nil, ErrNotFound
+	}
+
+	// The node, then each descendant with children, become templates
+	var templates []*exportedNode
+	var templateIDs []uuid.UUID
+	for _, n := range nodes {
+		if n.depth == 0 || len(n.children) > 0 {
+			templates = append(templates, n)
+			templateIDs = append(templateIDs, n.id)
+		}
+	}
+	if len(templates) > maxTemplateFileTemplates {
+		return nil, ErrTemplateFileTooLarge
+	}
+
+	structures := make(map[uuid.UUID]*models.TemplateStructure, len(templates))
+	for _, n := range templates {
+		structure := &models.TemplateStructure{
+			Inputs:  []models.TemplateInput{},
+			Outputs: []models.TemplateOutput{},
+		}
+		for _, child := range n.children {
+			sub := models.TemplateSubNode{Title: child.title, AuthorType: child.authorType}
+			if len(child.children) > 0 {
+				sub.TemplateID = &child.id
+			}
+			structure.SubNodes = append(structure.SubNodes, sub)
+		}
+		structures[n.id] = structure
+	}
+
+	if err := s.exportSlots(ctx, templateIDs, structures); err != nil {
+		return nil, err
+	}
+
+	f := &TemplateFile{Format: TemplateFileFormat}
+	for _, n := range templates {
+		entry := TemplateFileEntry{
+			ID:          n.id,
+			Name:        n.title,
+			Description: n.description,
+			Structure:   *structures[n.id],
+		}
+		if n.agentConfig != nil {
+			entry.AgentConfig = *n.agentConfig
+		}
+		f.Templates = append(f.Templates, entry)
+	}
+	return f, nil
+}
+
+// exportSlots adds the inputs and outputs of the given nodes to their
+// structures as slots
+func (s *TemplateService) exportSlots(ctx context.Context, nodeIDs []uuid.UUID, structures map[uuid.UUID]*models.TemplateStructure) error {
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT node_id, input_type, label, metadata
+		FROM node_inputs
+		WHERE node_id = ANY($1)
+		ORDER BY node_id, sort_order, created_at
+	`, nodeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get node inputs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nodeID uuid.UUID
+		var inputType string
+		var label *string
+		var metadataJSON []byte
+		if err := rows.Scan(&nodeID, &inputType, &label, &metadataJSON); err != nil {
+			return fmt.Errorf("failed to scan node input: %w", err)
+		}
+		var metadata struct {
+			Required    bool   `json:"required"`
+			Description string `json:"description"`
+		}
+		json.Unmarshal(metadataJSON, &metadata)
+
+		structure := structures[nodeID]
+		structure.Inputs = append(structure.Inputs, models.TemplateInput{
+			Label:       slotLabel(label, inputType),
+			Type:        inputType,
+			Required:    metadata.Required,
+			Description: metadata.Description,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get node inputs: %w", err)
+	}
+
+	rows, err = s.db.Reader().Query(ctx, `
+		SELECT node_id, output_type, label, metadata
+		FROM node_outputs
+		WHERE node_id = ANY($1)
+		ORDER BY node_id, sort_order, created_at
+	`, nodeIDs)
+	if err != nil {
+		return fmt.Errorf("failed to get node outputs: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var nodeID uuid.UUID
+		var outputType string
+		var label *string
+		var metadataJSON []byte
+		if err := rows.Scan(&nodeID, &outputType, &label, &metadataJSON); err != nil {
+			return fmt.Errorf("failed to scan node output: %w", err)
+		}
+		var metadata struct {
+			Description string `json:"description"`
+		}
+		json.Unmarshal(metadataJSON, &metadata)
+
+		structure := structures[nodeID]
+		structure.Outputs = append(structure.Outputs, models.TemplateOutput{
+			Label:       slotLabel(label, outputType),
+			Type:        outputType,
+			Description: metadata.Description,
+		})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get node outputs: %w", err)
+	}
+	return nil
+}
+
+// slotLabel is an input or output's label, or its type when it has none
+func slotLabel(label *string, slotType string) string {
+	if label == nil || *label == "" {
+		return slotType
+	}
+	return *label
+}
+
+// Import creates the templates of a file in an org, private to it, and
+// returns them in file order. Sub-nodes naming a template in the file are
+// pointed at its new copy; other templates they name must be public or
+// belong to the org. Entries that don't pass Create's checks fail the whole
+// import with a TemplateStructureError, its fields prefixed templates[i].
+// Callers must validate f and check the user can write the org's templates.
+func (s *TemplateService) Import(ctx context.Context, orgID, userID uuid.UUID, f *TemplateFile) ([]models.Template, error) {
+	newIDs := make(map[uuid.UUID]uuid.UUID, len(f.Templates))
+	for _, entry := range f.Templates {
+		if _, ok := newIDs[entry.ID]; ok {
+			return nil, fmt.Errorf("%w: template id %s appears twice", ErrInvalidTemplateFile, entry.ID)
+		}
+		newIDs[entry.ID] = uuid.New()
+	}
+
+	var templates []models.Template
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		templates = nil
+
+		for _, entry := range f.Templates {
+			structure := entry.Structure
+			structure.SubNodes = make([]models.TemplateSubNode, len(entry.Structure.SubNodes))
+			for i, sub := range entry.Structure.SubNodes {
+				if sub.TemplateID != nil {
+					if newID, ok := newIDs[*sub.TemplateID]; ok {
+						sub.TemplateID = &newID
+					}
+				}
+				structure.SubNodes[i] = sub
+			}
+
+			t := models.Template{
+				ID:          newIDs[entry.ID],
+				OrgID:       &orgID,
+				Name:        entry.Name,
+				Description: entry.Description,
+				Structure:   structure,
+				AgentConfig: entry.AgentConfig,
+				Version:     1,
+				Categories:  normalizeCategories(entry.Categories),
+				CreatedBy:   &userID,
+			}
+			if err := insertTemplate(ctx, tx, &t, userID); err != nil {
+				return err
+			}
+			templates = append(templates, t)
+		}
+
+		// Sub-nodes are checked once every entry is in, so they can name
+		// each other
+		agentModels, err := agentModelsFor(ctx, tx, s.agentModels, &orgID)
+		if err != nil {
+			return err
+		}
+		check := &templateCheck{}
+		for i, t := range templates {
+			check.prefix = fmt.Sprintf("templates[%d].", i)
+			check.checkStructure(t.Structure)
+			check.checkAgentConfig(agentModels, t.AgentConfig)
+			if err := check.checkSubNodes(ctx, tx, &orgID, &t.ID, false, t.Structure.SubNodes); err != nil {
+				return err
+			}
+		}
+		return check.err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	templateInputTypes  = []string{"file", "node_reference", "external_link", "text"}
+	templateOutputTypes = []string{"file", "structured_data", "text", "external_link"}
+)
+
+// TemplateProblem is one thing wrong with a template
+type TemplateProblem struct {
+	Field   string // path in the request body, e.g. structure.subNodes[2].templateId
+	Rule    string
+	Message string
+}
+
+// TemplateStructureError is returned by Create, Update and Import instead of
+// storing a template that Apply couldn't instantiate, and by
+// ExecutionServiceFull.Start for an agent config override it couldn't run
+type TemplateStructureError struct {
+	Problems []TemplateProblem
+}
+
+func (e *TemplateStructureError) Error() string {
+	messages := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		messages[i] = p.Field + ": " + p.Message
+	}
+	return "invalid template: " + strings.Join(messages, "; ")
+}
+
+// templateCheck collects the problems found in one template. Field paths
+// start with prefix, which locates the template in the request.
+type templateCheck struct {
+	prefix   string
+	problems []TemplateProblem
+}
+
+func (c *templateCheck) add(field, rule, format string, args ...any) {
+	c.problems = append(c.problems, TemplateProblem{
+		Field:   c.prefix + field,
+		Rule:    rule,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// err is a TemplateStructureError with the problems found, or nil
+func (c *templateCheck) err() error {
+	if len(c.problems) == 0 {
+		return nil
+	}
+	return &TemplateStructureError{Problems: c.problems}
+}
+
+// checkStructure checks slot types and that variables have identifier
+// names, each declared once. Sub-node templates are checked by
+// checkSubNodes, which needs the database.
+func (c *templateCheck) checkStructure(structure models.TemplateStructure) {
+	for i, input := range structure.Inputs {
+		if !slices.Contains(templateInputTypes, input.Type) {
+			c.add(fmt.Sprintf("structure.inputs[%d].type", i), "oneof",
+				"must be one of %s", strings.Join(templateInputTypes, ", "))
+		}
+	}
+	for i, output := range structure.Outputs {
+		if !slices.Contains(templateOutputTypes, output.Type) {
+			c.add(fmt.Sprintf("structure.outputs[%d].type", i), "oneof",
+				"must be one of %s", strings.Join(templateOutputTypes, ", "))
+		}
+	}
+
+	seen := make(map[string]bool, len(structure.Variables))
+	for i, v := range structure.Variables {
+		field := fmt.Sprintf("structure.variables[%d].name", i)
+		switch {
+		case !templateVariableName.MatchString(v.Name):
+			c.add(field, "identifier", "must be letters, digits and underscores, not starting with a digit")
+		case seen[v.Name]:
+			c.add(field, "unique", "variable %s is declared more than once", v.Name)
+		}
+		seen[v.Name] = true
+	}
+}
+
+// checkAgentConfig checks the config names one of agentModels, as
+// returned by agentModelsFor, and that its tools and policies name agent
+// tools. An empty model inherits the org's default.
+func (c *templateCheck) checkAgentConfig(agentModels []string, config models.AgentConfig) {
+	if config.Model != "" && agentModels != nil && !slices.Contains(agentModels, config.Model) {
+		c.add("agentConfig.model", "model", "unknown model %s", config.Model)
+	}
+	for i, tool := range config.Tools {
+		if !slices.Contains(agentTools, tool) {
+			c.add(fmt.Sprintf("agentConfig.tools[%d]", i), "oneof",
+				"must be one of %s", strings.Join(agentTools, ", "))
+		}
+	}
+	for i, p := range config.Policies {
+		if !slices.Contains(agentTools, p.Action) {
+			c.add(fmt.Sprintf("agentConfig.policies[%d].action", i), "oneof",
+				"must be one of %s", strings.Join(agentTools, ", "))
+		}
+	}
+}
+
+// agentModelsFor returns the models an org's agent configs may name: the
+// platform's, and the name and litellm name of each model in the org's
+// settings. System templates get the platform's. Nil means any model, when
+// the platform list is empty.
+func agentModelsFor(ctx context.Context, q rowQuerier, platform []string, orgID *uuid.UUID) ([]string, error) {
+	if len(platform) == 0 {
+		return nil, nil
+	}
+	if orgID == nil {
+		return platform, nil
+	}
+
+	var settingsJSON []byte
+	err := q.QueryRow(ctx, `SELECT settings FROM organizations WHERE id = $1`, *orgID).Scan(&settingsJSON)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get org settings: %w", err)
+	}
+	var settings models.OrganizationSettings
+	if settingsJSON != nil {
+		json.Unmarshal(settingsJSON, &settings)
+	}
+
+	agentModels := slices.Clone(platform)
+	for _, m := range settings.Models {
+		agentModels = append(agentModels, m.Name, m.LiteLLMModel)
+	}
+	return agentModels, nil
+}
+
+// checkSubNodes checks each sub-node template exists and can be applied
+// wherever the template can: it must be public or, for a private template,
+// belong to orgID. templateID is the template being updated, nil on create;
+// sub-nodes that lead back to it would form a cycle.
+func (c *templateCheck) checkSubNodes(ctx context.Context, tx pgx.Tx, orgID *uuid.UUID, templateID *uuid.UUID, public bool, subNodes []models.TemplateSubNode) error {
+	for i, sub := range subNodes {
+		if sub.TemplateID == nil {
+			continue
+		}
+		field := fmt.Sprintf("structure.subNodes[%d].templateId", i)
+		if templateID != nil && *sub.TemplateID == *templateID {
+			c.add(field, "cycle", "a template can't be its own sub-node")
+			continue
+		}
+
+		var subPublic bool
+		var subOrgID *uuid.UUID
+		err := tx.QueryRow(ctx, `
+			SELECT is_public, org_id FROM templates WHERE id = $1
+		`, *sub.TemplateID).Scan(&subPublic, &subOrgID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("failed to get template: %w", err)
+		}
+		inScope := subPublic || (orgID != nil && subOrgID != nil && *subOrgID == *orgID)
+		if errors.Is(err, pgx.ErrNoRows) || !inScope {
+			c.add(field, "exists", "template %s is missing or not available to this organization", *sub.TemplateID)
+			continue
+		}
+		if public && !subPublic {
+			c.add(field, "public", "a public template can't use private template %s", *sub.TemplateID)
+			continue
+		}
+
+		if templateID != nil {
+			cycle, err := reachesTemplate(ctx, tx, *sub.TemplateID, *templateID)
+			if err != nil {
+				return err
+			}
+			if cycle {
+				c.add(field, "cycle", "template %s uses this template as a sub-node", *sub.TemplateID)
+			}
+		}
+	}
+	return nil
+}
+
+// reachesTemplate reports whether target is among the sub-node templates
+// of from, following them as deep as Apply would
+func reachesTemplate(ctx context.Context, tx pgx.Tx, from, target uuid.UUID) (bool, error) {
+	var reaches bool
+	err := tx.QueryRow(ctx, `
+		WITH RECURSIVE reach(id, depth) AS (
+			SELECT $1::UUID, 0
+			UNION
+			SELECT (sub->>'templateId')::UUID, r.depth + 1
+			FROM reach r
+			JOIN templates t ON t.id = r.id
+			CROSS JOIN jsonb_array_elements(COALESCE(t.structure->'subNodes', '[]'::JSONB)) AS sub
+			WHERE sub->>'templateId' IS NOT NULL AND r.depth < $3
+		)
+		SELECT EXISTS (SELECT 1 FROM reach WHERE id = $2)
+	`, from, target, maxTemplateDepth).Scan(&reaches)
+	if err != nil {
+		return false, fmt.Errorf("failed to check template sub-nodes: %w", err)
+	}
+	return reaches, nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/glassbox/api/internal/models"
+)
+
+var (
+	// A {{name}} placeholder, allowing spaces inside the braces
+	templatePlaceholder = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+	templateVariableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// TemplateValuesError is returned by Apply when the values given don't fit
+// the variables of the templates applied
+type TemplateValuesError struct {
+	// Required variables with no value and no default
+	Missing []string
+
+	// Values for variables none of the templates declare
+	Unknown []string
+}
+
+func (e *TemplateValuesError) Error() string {
+	var parts []string
+	if len(e.Missing) > 0 {
+		parts = append(parts, "missing values for "+strings.Join(e.Missing, ", "))
+	}
+	if len(e.Unknown) > 0 {
+		parts = append(parts, "unknown variables "+strings.Join(e.Unknown, ", "))
+	}
+	return fmt.Sprintf("invalid template values: %s", strings.Join(parts, "; "))
+}
+
+// templateValues maps variable names to the text their placeholders are
+// replaced with
+type templateValues map[string]string
+
+// resolveValues picks the value of each of t's variables: the one given to
+// Apply, else its default. Required variables left without either are noted
+// in a.missing, and their placeholders are kept.
+func (a *templateApplication) resolveValues(t *models.Template) templateValues {
+	values := make(templateValues, len(t.Structure.Variables))
+	for _, v := range t.Structure.Variables {
+		a.declared[v.Name] = true
+		if value, ok := a.values[v.Name]; ok {
+			values[v.Name] = value
+		} else if v.Default != nil {
+			values[v.Name] = *v.Default
+		} else if v.Required && !slices.Contains(a.missing, v.Name) {
+			a.missing = append(a.missing, v.Name)
+		}
+	}
+	return values
+}
+
+// valuesError reports missing and unknown values once every template has
+// been instantiated, or nil if there are none
+func (a *templateApplication) valuesError() error {
+	var unknown []string
+	for name := range a.values {
+		if !a.declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(a.missing) == 0 && len(unknown) == 0 {
+		return nil
+	}
+
+	slices.Sort(unknown)
+	missing := slices.Clone(a.missing)
+	slices.Sort(missing)
+	return &TemplateValuesError{Missing: missing, Unknown: unknown}
+}
+
+// substitute replaces the placeholders of variables in v. Other
+// placeholders are left as they are.
+func (v templateValues) substitute(s string) string {
+	if len(v) == 0 {
+		return s
+	}
+	return templatePlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		name := templatePlaceholder.FindStringSubmatch(placeholder)[1]
+		if value, ok := v[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+func (v templateValues) substitutePtr(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	substituted := v.substitute(*s)
+	return &substituted
+}
+
+// agentConfig returns a template's agent config with its system prompt
+// substituted, or nil when the template doesn't set one
+func (v templateValues) agentConfig(c models.AgentConfig) *models.AgentConfig {
+	if c.Model == "" && c.MaxTokens == 0 && c.Temperature == 0 && c.SystemPrompt == "" && len(c.Tools) == 0 &&
+		len(c.Policies) == 0 {
+		return nil
+	}
+	c.SystemPrompt = v.substitute(c.SystemPrompt)
+	return &c
+}
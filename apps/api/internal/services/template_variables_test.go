@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+func TestSubstitute(t *testing.T) {
+	values := templateValues{"customer": "Acme", "region": "EMEA", "price": "$1 & ${2}"}
+	for _, tc := range []struct {
+		in, want string
+	}{
+		{"Brief for {{customer}}", "Brief for Acme"},
+		{"{{ customer }} in {{region}}, {{customer}} again", "Acme in EMEA, Acme again"},
+		// Values are literal text, not regexp replacements
+		{"Costs {{price}}", "Costs $1 & ${2}"},
+		// Placeholders of variables without a value stay for the user to see
+		{"{{customer}} by {{owner}}", "Acme by {{owner}}"},
+		// Only well-formed names are placeholders
+		{"{{1st}} {{ }} {customer} {{cust omer}}", "{{1st}} {{ }} {customer} {{cust omer}}"},
+		// Extra braces around a placeholder are kept
+		{"{{{customer}}}", "{Acme}"},
+		{"", ""},
+	} {
+		if got := values.substitute(tc.in); got != tc.want {
+			t.Errorf("substitute(%q) = %q, want %q", tc.in, got, tc.want)
+		}
+	}
+
+	// A value that looks like a placeholder isn't substituted in turn
+	chained := templateValues{"a": "{{b}}", "b": "secret"}
+	if got := chained.substitute("{{a}}"); got != "{{b}}" {
+		t.Errorf("substituted a value's placeholder: %q", got)
+	}
+	if got := (templateValues{}).substitutePtr(nil); got != nil {
+		t.Errorf("substitutePtr(nil) = %q", *got)
+	}
+}
+
+func TestResolveValues(t *testing.T) {
+	fallback := "Unnamed"
+	tmpl := &models.Template{Structure: models.TemplateStructure{Variables: []models.TemplateVariable{
+		{Name: "customer", Required: true},
+		{Name: "owner", Required: true, Default: &fallback},
+		{Name: "region"},
+		{Name: "deadline", Required: true},
+	}}}
+
+	a := newTemplateApplication(uuid.Nil, uuid.Nil, uuid.Nil, map[string]string{"customer": "Acme", "colour": "blue"})
+	values := a.resolveValues(tmpl)
+	if want := (templateValues{"customer": "Acme", "owner": "Unnamed"}); !reflect.DeepEqual(values, want) {
+		t.Fatalf("values = %v, want %v", values, want)
+	}
+
+	var valuesErr *TemplateValuesError
+	if err := a.valuesError(); !errors.As(err, &valuesErr) {
+		t.Fatalf("valuesError = %v, want a TemplateValuesError", err)
+	}
+	if !slices.Equal(valuesErr.Missing, []string{"deadline"}) || !slices.Equal(valuesErr.Unknown, []string{"colour"}) {
+		t.Fatalf("missing %v, unknown %v; want [deadline], [colour]", valuesErr.Missing, valuesErr.Unknown)
+	}
+}
+
+// templateTx serves availableTemplate's query from templates; nothing else
+// is expected of it in a dry run
+type templateTx struct {
+	pgx.Tx
+	templates map[uuid.UUID]*models.Template
+}
+
+func (tx templateTx) QueryRow(_ context.Context, _ string, args ...any) pgx.Row {
+	return templateRow{tx.templates[args[0].(uuid.UUID)]}
+}
+
+type templateRow struct{ t *models.Template }
+
+// Scan fills templateColumns
+func (r templateRow) Scan(dest ...any) error {
+	if r.t == nil {
+		return pgx.ErrNoRows
+	}
+	t := r.t
+	structureJSON, _ := json.Marshal(t.Structure)
+	agentConfigJSON, _ := json.Marshal(t.AgentConfig)
+	for i, v := range []any{
+		t.ID, t.OrgID, t.Name, t.Description, structureJSON, agentConfigJSON,
+		t.IsPublic, t.Version, t.Categories, t.IsFeatured, t.UsageCount, t.RatingCount, 0,
+		t.CreatedAt, t.UpdatedAt, t.CreatedBy,
+	} {
+		reflect.ValueOf(dest[i]).Elem().Set(reflect.ValueOf(v))
+	}
+	return nil
+}
+
+func TestNestedTemplateVariables(t *testing.T) {
+	orgID := uuid.New()
+	child := &models.Template{
+		ID:    uuid.New(),
+		OrgID: &orgID,
+		Name:  "Review for {{customer}}",
+		Structure: models.TemplateStructure{
+			Inputs:    []models.TemplateInput{{Label: "Notes on {{customer}} by {{reviewer}}", Type: "text", Value: "Region {{region}}"}},
+			Variables: []models.TemplateVariable{{Name: "customer", Required: true}, {Name: "reviewer", Required: true}},
+		},
+	}
+	parent := &models.Template{
+		ID:   uuid.New(),
+		Name: "Onboard {{customer}}",
+		Structure: models.TemplateStructure{
+			SubNodes:  []models.TemplateSubNode{{Title: "{{customer}} review in {{region}}", AuthorType: "human", TemplateID: &child.ID}},
+			Variables: []models.TemplateVariable{{Name: "customer", Required: true}, {Name: "region"}},
+		},
+	}
+	tx := templateTx{templates: map[uuid.UUID]*models.Template{child.ID: child}}
+	s := &TemplateService{}
+	apply := func(values map[string]string) (*templateApplication, error) {
+		a := newTemplateApplication(orgID, uuid.New(), uuid.New(), values)
+		a.dryRun = true
+		return a, s.applyTemplate(context.Background(), tx, a, parent, nil, nil)
+	}
+
+	a, err := apply(map[string]string{"customer": "Acme", "region": "EMEA", "reviewer": "Ada"})
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if len(a.nodes) != 2 || len(a.inputs) != 1 {
+		t.Fatalf("got %d nodes and %d inputs, want 2 and 1", len(a.nodes), len(a.inputs))
+	}
+	// The sub-node's title is the parent's, substituted with the parent's
+	// variables. Its slots only know the child's: region is the parent's.
+	if got := a.nodes[0].Title; got != "Onboard Acme" {
+		t.Errorf("parent title = %q", got)
+	}
+	if got := a.nodes[1].Title; got != "Acme review in EMEA" {
+		t.Errorf("sub-node title = %q", got)
+	}
+	input := a.inputs[0]
+	if *input.Label != "Notes on Acme by Ada" || *input.TextContent != "Region {{region}}" {
+		t.Errorf("child input = %q, %q", *input.Label, *input.TextContent)
+	}
+
+	// A variable only the child requires is still required
+	var valuesErr *TemplateValuesError
+	if _, err := apply(map[string]string{"customer": "Acme"}); !errors.As(err, &valuesErr) || !slices.Equal(valuesErr.Missing, []string{"reviewer"}) {
+		t.Fatalf("apply without reviewer err = %v, want reviewer missing", err)
+	}
+
+	// A template reached from itself is rejected
+	child.Structure.SubNodes = []models.TemplateSubNode{{Title: "again", AuthorType: "human", TemplateID: &parent.ID}}
+	tx.templates[parent.ID] = parent
+	if _, err := apply(map[string]string{"customer": "Acme", "reviewer": "Ada"}); !errors.Is(err, ErrTemplateNesting) {
+		t.Fatalf("cyclic apply err = %v, want ErrTemplateNesting", err)
+	}
+}
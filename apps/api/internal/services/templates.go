@@ -0,0 +1,1004 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/glassbox/api/internal/authz"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/glassbox/api/internal/pagination"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+// How many levels of sub-node templates Apply follows
+const maxTemplateDepth = 5
+
+var (
+	ErrInvalidParent      = errors.New("parent node is not in the project")
+	ErrTemplateNesting    = errors.New("template sub-nodes nest too deeply or form a cycle")
+	ErrUnresolvedTemplate = errors.New("template is missing or not available to the project's org")
+)
+
+// TemplateService manages node templates. System templates (no org) make up
+// the public catalog along with org templates marked public; other org
+// templates are only visible to the org's members.
+type TemplateService struct {
+	db          *database.DB
+	authz       *authz.Authorizer
+	ipAllowlist *IPAllowlistService
+	eventStore  *EventStore
+	agentModels []string
+	logger      *zap.Logger
+}
+
+// NewTemplateService creates a TemplateService. Agent configs may only name
+// one of agentModels, or any model when it's empty.
+func NewTemplateService(db *database.DB, az *authz.Authorizer, ipAllowlist *IPAllowlistService, eventStore *EventStore, agentModels []string, logger *zap.Logger) *TemplateService {
+	return &TemplateService{db: db, authz: az, ipAllowlist: ipAllowlist, eventStore: eventStore, agentModels: agentModels, logger: logger}
+}
+
+// checkIP returns ErrIPNotAllowed unless clientIP is inside the org's
+// allowlist. Template routes name no org, so the IPAllowlist middleware
+// can't check them.
+func (s *TemplateService) checkIP(ctx context.Context, orgID uuid.UUID, clientIP string) error {
+	allowed, err := s.ipAllowlist.IsIPAllowed(ctx, orgID, clientIP)
+	if err != nil {
+		return fmt.Errorf("failed to check IP allowlist: %w", err)
+	}
+	if !allowed {
+		return ErrIPNotAllowed
+	}
+	return nil
+}
+
+const templateColumns = `t.id, t.org_id, t.name, t.description, t.structure, t.agent_config,
+	t.is_public, t.version, t.categories, t.is_featured, t.usage_count, t.rating_count, t.rating_score,
+	t.created_at, t.updated_at, t.created_by`
+
+// ListPublic returns a page of the public catalog, filtered and sorted as
+// the request asks
+func (s *TemplateService) ListPublic(ctx context.Context, filters ListTemplatesRequest, page pagination.Params) (*pagination.Page[models.Template], error) {
+	return s.list(ctx, nil, filters, page)
+}
+
+// ListForOrg returns a page of an org's own templates, public or not.
+// Callers must have checked the user belongs to the org.
+func (s *TemplateService) ListForOrg(ctx context.Context, orgID uuid.UUID, filters ListTemplatesRequest, page pagination.Params) (*pagination.Page[models.Template], error) {
+	return s.list(ctx, &orgID, filters, page)
+}
+
+// list pages through an org's templates, or the public catalog when orgID is nil
+func (s *TemplateService) list(ctx context.Context, orgID *uuid.UUID, filters ListTemplatesRequest, page pagination.Params) (*pagination.Page[models.Template], error) {
+	if filters.Category != nil {
+		category := strings.ToLower(strings.TrimSpace(*filters.Category))
+		filters.Category = &category
+	}
+	sort := templateSorts[filters.Sort]
+	after, afterID, err := sort.after(page)
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	cmp, dir := ">", "ASC"
+	if sort.desc {
+		cmp, dir = "<", "DESC"
+	}
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT `+templateColumns+`
+		FROM templates t
+		WHERE (($4::UUID IS NULL AND t.is_public) OR t.org_id = $4)
+		  AND ($5::TEXT IS NULL OR $5 = ANY(t.categories))
+		  AND ($6::BOOLEAN IS NULL OR t.is_featured = $6)
+		  AND ($1::`+sort.keyType+` IS NULL OR (`+sort.key+`, t.id) `+cmp+` ($1, $2::UUID))
+		ORDER BY `+sort.key+` `+dir+`, t.id `+dir+`
+		LIMIT $3
+	`, after, afterID, limit+1, orgID, filters.Category, filters.Featured)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	defer rows.Close()
+
+	var templates []models.Template
+	for rows.Next() {
+		t, err := scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template: %w", err)
+		}
+		templates = append(templates, *t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+
+	result := pagination.NewPage(templates, limit, sort.cursor)
+	err = s.db.Reader().QueryRow(ctx, `
+		SELECT COUNT(*) FROM templates
+		WHERE (($1::UUID IS NULL AND is_public) OR org_id = $1)
+		  AND ($2::TEXT IS NULL OR $2 = ANY(categories))
+		  AND ($3::BOOLEAN IS NULL OR is_featured = $3)
+	`, orgID, filters.Category, filters.Featured).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count templates: %w", err)
+	}
+	return result, nil
+}
+
+// Get returns a template that is public or that the user may read in its
+// org, from an IP the org's allowlist admits
+func (s *TemplateService) Get(ctx context.Context, templateID, userID uuid.UUID, clientIP string) (*models.Template, error) {
+	t, err := scanTemplate(s.db.Pool.QueryRow(ctx, `
+		SELECT `+templateColumns+`
+		FROM templates t
+		WHERE t.id = $1
+	`, templateID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	if err := s.authorizeRead(ctx, t.OrgID, t.IsPublic, userID, clientIP); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// authorizeRead checks the user may read a template of orgID, or of the
+// platform when nil. Public templates are readable by everyone. Private
+// ones need authz.TemplateRead in their org and an IP its allowlist admits;
+// ErrNotFound hides them otherwise, and private system templates are only
+// read under /admin.
+func (s *TemplateService) authorizeRead(ctx context.Context, orgID *uuid.UUID, public bool, userID uuid.UUID, clientIP string) error {
+	if public {
+		return nil
+	}
+	if orgID == nil {
+		return ErrNotFound
+	}
+
+	decision, err := s.authz.Check(ctx, userID, authz.TemplateRead, authz.Resource{Type: authz.ResourceOrg, ID: *orgID})
+	if errors.Is(err, authz.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.checkIP(ctx, *orgID, clientIP); err != nil {
+		return err
+	}
+	if !decision.Allowed {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// CreateTemplateRequest contains data for creating a template
+type CreateTemplateRequest struct {
+	Name        string                   `json:"name" binding:"required,max=255"`
+	Description *string                  `json:"description,omitempty"`
+	Structure   models.TemplateStructure `json:"structure"`
+	AgentConfig *models.AgentConfig      `json:"agentConfig,omitempty"`
+	IsPublic    *bool                    `json:"isPublic,omitempty"`
+	Categories  []string                 `json:"categories,omitempty" binding:"max=10,dive,min=1,max=50"`
+}
+
+// Create creates a template in an org, or a system template when orgID is
+// nil. System templates are public unless the request says otherwise; org
+// templates are private, and publishing one needs authz.TemplatePublish.
+// Templates Apply couldn't instantiate are a TemplateStructureError.
+func (s *TemplateService) Create(ctx context.Context, orgID *uuid.UUID, userID uuid.UUID, req CreateTemplateRequest) (*models.Template, error) {
+	if req.IsPublic != nil && *req.IsPublic {
+		if err := s.checkPublish(ctx, orgID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	t := &models.Template{
+		ID:          uuid.New(),
+		OrgID:       orgID,
+		Name:        req.Name,
+		Description: req.Description,
+		Structure:   req.Structure,
+		IsPublic:    orgID == nil,
+		Version:     1,
+		Categories:  normalizeCategories(req.Categories),
+		CreatedBy:   &userID,
+	}
+	if req.AgentConfig != nil {
+		t.AgentConfig = *req.AgentConfig
+	}
+	if req.IsPublic != nil {
+		t.IsPublic = *req.IsPublic
+	}
+
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		agentModels, err := agentModelsFor(ctx, tx, s.agentModels, orgID)
+		if err != nil {
+			return err
+		}
+		check := &templateCheck{}
+		check.checkStructure(t.Structure)
+		check.checkAgentConfig(agentModels, t.AgentConfig)
+		if err := check.checkSubNodes(ctx, tx, orgID, nil, t.IsPublic, t.Structure.SubNodes); err != nil {
+			return err
+		}
+		if err := check.err(); err != nil {
+			return err
+		}
+		return insertTemplate(ctx, tx, t, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// insertTemplate inserts t as its first version
+func insertTemplate(ctx context.Context, tx pgx.Tx, t *models.Template, userID uuid.UUID) error {
+	structureJSON, _ := json.Marshal(t.Structure)
+	agentConfigJSON, _ := json.Marshal(t.AgentConfig)
+	if t.Categories == nil {
+		t.Categories = []string{}
+	}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO templates (id, org_id, name, description, structure, agent_config, is_public, version,
+		                       categories, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		RETURNING created_at, updated_at
+	`, t.ID, t.OrgID, t.Name, t.Description, structureJSON, agentConfigJSON, t.IsPublic, t.Version,
+		t.Categories, t.CreatedBy).Scan(
+		&t.CreatedAt, &t.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create template: %w", err)
+	}
+
+	return recordTemplateVersion(ctx, tx, t, userID)
+}
+
+// UpdateTemplateRequest contains data for updating a template. Structure,
+// AgentConfig and Categories replace the stored values when set.
+type UpdateTemplateRequest struct {
+	Name        *string                   `json:"name,omitempty" binding:"omitempty,min=1,max=255"`
+	Description *string                   `json:"description,omitempty"`
+	Structure   *models.TemplateStructure `json:"structure,omitempty"`
+	AgentConfig *models.AgentConfig       `json:"agentConfig,omitempty"`
+	IsPublic    *bool                     `json:"isPublic,omitempty"`
+	Categories  []string                  `json:"categories,omitempty" binding:"omitempty,max=10,dive,min=1,max=50"`
+
+	IfMatch Precondition `json:"-"`
+}
+
+// Update updates a template in an org, or a system template when orgID is
+// nil. Templates outside that scope are ErrNotFound. Changing the name,
+// description, structure or agent config makes a new version. Changing
+// whether an org template is public needs authz.TemplatePublish. A new
+// structure or agent config, or making the template public, is checked as
+// on Create.
+func (s *TemplateService) Update(ctx context.Context, orgID *uuid.UUID, templateID, userID uuid.UUID, req UpdateTemplateRequest) (*models.Template, error) {
+	if req.IsPublic != nil {
+		if err := s.checkPublish(ctx, orgID, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	var structureJSON, agentConfigJSON []byte
+	if req.Structure != nil {
+		structureJSON, _ = json.Marshal(req.Structure)
+	}
+	if req.AgentConfig != nil {
+		agentConfigJSON, _ = json.Marshal(req.AgentConfig)
+	}
+	newVersion := req.Name != nil || req.Description != nil || req.Structure != nil || req.AgentConfig != nil
+	var categories []string
+	if req.Categories != nil {
+		categories = normalizeCategories(req.Categories)
+	}
+
+	var t *models.Template
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		var updatedAt time.Time
+		var isPublic bool
+		var storedStructureJSON []byte
+		err := tx.QueryRow(ctx, `
+			SELECT updated_at, is_public, structure FROM templates
+			WHERE id = $1 AND org_id IS NOT DISTINCT FROM $2
+			FOR UPDATE
+		`, templateID, orgID).Scan(&updatedAt, &isPublic, &storedStructureJSON)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get template: %w", err)
+		}
+		if !req.IfMatch.Matches(updatedAt) {
+			return ErrVersionConflict
+		}
+
+		check := &templateCheck{}
+		if req.AgentConfig != nil {
+			agentModels, err := agentModelsFor(ctx, tx, s.agentModels, orgID)
+			if err != nil {
+				return err
+			}
+			check.checkAgentConfig(agentModels, *req.AgentConfig)
+		}
+		publishing := req.IsPublic != nil && *req.IsPublic && !isPublic
+		if req.Structure != nil || publishing {
+			var structure models.TemplateStructure
+			if req.Structure != nil {
+				structure = *req.Structure
+				check.checkStructure(structure)
+			} else {
+				json.Unmarshal(storedStructureJSON, &structure)
+			}
+			public := isPublic
+			if req.IsPublic != nil {
+				public = *req.IsPublic
+			}
+			if err := check.checkSubNodes(ctx, tx, orgID, &templateID, public, structure.SubNodes); err != nil {
+				return err
+			}
+		}
+		if err := check.err(); err != nil {
+			return err
+		}
+
+		t, err = scanTemplate(tx.QueryRow(ctx, `
+			UPDATE templates t SET
+				name = COALESCE($2, name),
+				description = COALESCE($3, description),
+				structure = COALESCE($4, structure),
+				agent_config = COALESCE($5, agent_config),
+				is_public = COALESCE($6, is_public),
+				is_featured = is_featured AND COALESCE($6, is_public),
+				version = CASE WHEN $7 THEN version + 1 ELSE version END,
+				categories = COALESCE($8, categories)
+			WHERE t.id = $1
+			RETURNING `+templateColumns+`
+		`, templateID, req.Name, req.Description, structureJSON, agentConfigJSON, req.IsPublic, newVersion,
+			categories))
+		if err != nil {
+			return fmt.Errorf("failed to update template: %w", err)
+		}
+
+		if !newVersion {
+			return nil
+		}
+		return recordTemplateVersion(ctx, tx, t, userID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// recordTemplateVersion keeps a copy of t as its current version
+func recordTemplateVersion(ctx context.Context, tx pgx.Tx, t *models.Template, userID uuid.UUID) error {
+	structureJSON, _ := json.Marshal(t.Structure)
+	agentConfigJSON, _ := json.Marshal(t.AgentConfig)
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO template_versions (template_id, version, name, description, structure, agent_config, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.ID, t.Version, t.Name, t.Description, structureJSON, agentConfigJSON, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record template version: %w", err)
+	}
+	return nil
+}
+
+// ListVersions returns a page of a template's versions, newest first. The
+// template must be one Get would return.
+func (s *TemplateService) ListVersions(ctx context.Context, templateID, userID uuid.UUID, clientIP string, page pagination.Params) (*pagination.Page[models.TemplateVersion], error) {
+	afterVersion, _, err := page.AfterInt()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	if err := s.checkVisible(ctx, templateID, userID, clientIP); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT `+templateVersionColumns+`
+		FROM template_versions
+		WHERE template_id = $1 AND ($2::INT IS NULL OR version < $2)
+		ORDER BY version DESC
+		LIMIT $3
+	`, templateID, afterVersion, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.TemplateVersion
+	for rows.Next() {
+		v, err := scanTemplateVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan template version: %w", err)
+		}
+		versions = append(versions, *v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list template versions: %w", err)
+	}
+
+	result := pagination.NewPage(versions, limit, func(v models.TemplateVersion) pagination.Cursor {
+		return pagination.IntCursor(v.Version, v.ID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `SELECT COUNT(*) FROM template_versions WHERE template_id = $1`, templateID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count template versions: %w", err)
+	}
+	return result, nil
+}
+
+// GetVersion returns one version of a template Get would return
+func (s *TemplateService) GetVersion(ctx context.Context, templateID, userID uuid.UUID, clientIP string, version int) (*models.TemplateVersion, error) {
+	if err := s.checkVisible(ctx, templateID, userID, clientIP); err != nil {
+		return nil, err
+	}
+
+	v, err := scanTemplateVersion(s.db.Pool.QueryRow(ctx, `
+		SELECT `+templateVersionColumns+`
+		FROM template_versions
+		WHERE template_id = $1 AND version = $2
+	`, templateID, version))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template version: %w", err)
+	}
+	return v, nil
+}
+
+// checkVisible returns an error unless Get would return the template
+func (s *TemplateService) checkVisible(ctx context.Context, templateID, userID uuid.UUID, clientIP string) error {
+	var orgID *uuid.UUID
+	var public bool
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT org_id, is_public FROM templates WHERE id = $1
+	`, templateID).Scan(&orgID, &public)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to check template access: %w", err)
+	}
+	return s.authorizeRead(ctx, orgID, public, userID, clientIP)
+}
+
+// ListOutdatedInstancesRequest filters the outdated instances report
+type ListOutdatedInstancesRequest struct {
+	TemplateID *string `form:"templateId"`
+}
+
+// ListOutdatedInstances returns a page of an org's nodes that were created
+// from an older version of their template than the current one, oldest
+// first. Callers must have checked the user belongs to the org.
+func (s *TemplateService) ListOutdatedInstances(ctx context.Context, orgID uuid.UUID, filters ListOutdatedInstancesRequest, page pagination.Params) (*pagination.Page[models.OutdatedTemplateInstance], error) {
+	afterCreated, afterID, err := page.AfterTime()
+	if err != nil {
+		return nil, err
+	}
+	limit := page.PageLimit()
+
+	const outdated = `
+		FROM nodes n
+		JOIN templates t ON t.id = n.template_id
+		WHERE n.org_id = $1 AND n.deleted_at IS NULL
+		  AND n.template_version < t.version
+		  AND ($2::UUID IS NULL OR n.template_id = $2)`
+
+	rows, err := s.db.Reader().Query(ctx, `
+		SELECT n.id, n.project_id, n.title, t.id, t.name, n.template_version, t.version, n.created_at
+		`+outdated+`
+		  AND ($3::TIMESTAMPTZ IS NULL OR (n.created_at, n.id) > ($3, $4::UUID))
+		ORDER BY n.created_at, n.id
+		LIMIT $5
+	`, orgID, filters.TemplateID, afterCreated, afterID, limit+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list outdated template instances: %w", err)
+	}
+	defer rows.Close()
+
+	var instances []models.OutdatedTemplateInstance
+	for rows.Next() {
+		var i models.OutdatedTemplateInstance
+		if err := rows.Scan(
+			&i.NodeID, &i.ProjectID, &i.Title, &i.TemplateID, &i.TemplateName,
+			&i.TemplateVersion, &i.LatestVersion, &i.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan outdated template instance: %w", err)
+		}
+		instances = append(instances, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list outdated template instances: %w", err)
+	}
+
+	result := pagination.NewPage(instances, limit, func(i models.OutdatedTemplateInstance) pagination.Cursor {
+		return pagination.TimeCursor(i.CreatedAt, i.NodeID)
+	})
+	err = s.db.Reader().QueryRow(ctx, `SELECT COUNT(*)`+outdated, orgID, filters.TemplateID).Scan(&result.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count outdated template instances: %w", err)
+	}
+	return result, nil
+}
+
+// checkPublish returns ErrForbidden unless the user may change what orgID
+// contributes to the public catalog. Routes for system templates are already
+// restricted to platform admins.
+func (s *TemplateService) checkPublish(ctx context.Context, orgID *uuid.UUID, userID uuid.UUID) error {
+	if orgID == nil {
+		return nil
+	}
+	allowed, err := s.authz.Can(ctx, userID, authz.TemplatePublish, authz.Resource{Type: authz.ResourceOrg, ID: *orgID})
+	if errors.Is(err, authz.ErrNotFound) {
+		return ErrForbidden
+	}
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Delete deletes a template in an org, or a system template when orgID is
+// nil. Nodes already created from it are kept.
+func (s *TemplateService) Delete(ctx context.Context, orgID *uuid.UUID, templateID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM templates WHERE id = $1 AND org_id IS NOT DISTINCT FROM $2
+	`, templateID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ApplyTemplateRequest contains data for applying a template to a project
+type ApplyTemplateRequest struct {
+	ProjectID uuid.UUID  `json:"projectId" binding:"required"`
+	ParentID  *uuid.UUID `json:"parentId,omitempty"`
+	Title     *string    `json:"title,omitempty" binding:"omitempty,min=1,max=500"`
+
+	// Values of the templates' variables, by name
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// Apply creates the template's node in a project, titled req.Title or the
+// template's name, along with its input and output slots and sub-nodes.
+// Sub-nodes that name a template are created from it in turn. The user needs
+// authz.NodeCreate on the project, and the templates used must be public or
+// belong to the project's org, whose IP allowlist must admit clientIP.
+// Variable placeholders are replaced with req.Values; a *TemplateValuesError
+// is returned if a required one has no value or a value matches no variable.
+// Returns every node created, root first.
+func (s *TemplateService) Apply(ctx context.Context, templateID, userID uuid.UUID, clientIP string, req ApplyTemplateRequest) ([]models.Node, error) {
+	a, err := s.runApply(ctx, templateID, userID, clientIP, req, false)
+	if err != nil {
+		return nil, err
+	}
+	return a.nodes, nil
+}
+
+// Preview returns the nodes, input and output slots and parent-child edges
+// Apply would create with the same request, without creating them. It
+// fails as Apply would, but only needs authz.ProjectRead. IDs and
+// timestamps are made up and change between calls.
+func (s *TemplateService) Preview(ctx context.Context, templateID, userID uuid.UUID, clientIP string, req ApplyTemplateRequest) (*models.TemplatePreview, error) {
+	a, err := s.runApply(ctx, templateID, userID, clientIP, req, true)
+	if err != nil {
+		return nil, err
+	}
+	return &models.TemplatePreview{Nodes: a.nodes, Inputs: a.inputs, Outputs: a.outputs, Edges: a.edges}, nil
+}
+
+// runApply applies a template for Apply, or for Preview when dryRun is set,
+// in a read-only transaction that writes nothing
+func (s *TemplateService) runApply(ctx context.Context, templateID, userID uuid.UUID, clientIP string, req ApplyTemplateRequest, dryRun bool) (*templateApplication, error) {
+	action, txOpts := authz.NodeCreate, database.TxOptions{}
+	if dryRun {
+		action, txOpts = authz.ProjectRead, database.TxOptions{ReadOnly: true}
+	}
+	decision, err := s.authz.Check(ctx, userID, action, authz.Resource{Type: authz.ResourceProject, ID: req.ProjectID})
+	if errors.Is(err, authz.ErrNotFound) {
+		return nil, ErrForbidden
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkIP(ctx, decision.OrgID, clientIP); err != nil {
+		return nil, err
+	}
+	if !decision.Allowed {
+		return nil, ErrForbidden
+	}
+
+	a := newTemplateApplication(decision.OrgID, req.ProjectID, userID, req.Values)
+	a.dryRun = dryRun
+
+	err = s.db.WithTransactionOptions(ctx, txOpts, func(tx pgx.Tx) error {
+		a.reset()
+
+		if req.ParentID != nil {
+			var inProject bool
+			err := tx.QueryRow(ctx, `
+				SELECT EXISTS (SELECT 1 FROM nodes WHERE id = $1 AND project_id = $2 AND deleted_at IS NULL)
+			`, *req.ParentID, req.ProjectID).Scan(&inProject)
+			if err != nil {
+				return fmt.Errorf("failed to check parent node: %w", err)
+			}
+			if !inProject {
+				return ErrInvalidParent
+			}
+		}
+
+		t, err := s.availableTemplate(ctx, tx, templateID, a.orgID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		return s.applyTemplate(ctx, tx, a, t, req.ParentID, req.Title)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+// templateApplication is the state of an Apply call
+type templateApplication struct {
+	orgID     uuid.UUID
+	projectID uuid.UUID
+	userID    uuid.UUID
+
+	// Variable values given to Apply
+	values map[string]string
+
+	// Preview: collect what would be created without writing it
+	dryRun bool
+
+	// Templates being instantiated further up the tree, to catch cycles
+	applying map[uuid.UUID]bool
+
+	// Variables declared by the templates instantiated so far, and the
+	// required ones left without a value
+	declared map[string]bool
+	missing  []string
+
+	nodes   []models.Node
+	inputs  []models.NodeInput
+	outputs []models.NodeOutput
+	edges   []models.TemplatePreviewEdge
+}
+
+func newTemplateApplication(orgID, projectID, userID uuid.UUID, values map[string]string) *templateApplication {
+	a := &templateApplication{
+		orgID:     orgID,
+		projectID: projectID,
+		userID:    userID,
+		values:    values,
+	}
+	a.reset()
+	return a
+}
+
+// reset clears what a previous attempt of the transaction collected
+func (a *templateApplication) reset() {
+	a.applying = map[uuid.UUID]bool{}
+	a.declared = map[string]bool{}
+	a.missing = nil
+	a.nodes = []models.Node{}
+	a.inputs = []models.NodeInput{}
+	a.outputs = []models.NodeOutput{}
+	a.edges = []models.TemplatePreviewEdge{}
+}
+
+// applyTemplate instantiates t under parentID, titled title or else the
+// template's name, then checks the values given fit the variables of every
+// template used. Counts as a use of t, but not of its sub-node templates.
+func (s *TemplateService) applyTemplate(ctx context.Context, tx pgx.Tx, a *templateApplication, t *models.Template, parentID *uuid.UUID, title *string) error {
+	if err := s.instantiate(ctx, tx, a, t, parentID, title, "human", 0); err != nil {
+		return err
+	}
+	if err := a.valuesError(); err != nil {
+		return err
+	}
+	if a.dryRun {
+		return nil
+	}
+	return recordTemplateUse(ctx, tx, t.ID)
+}
+
+// instantiate creates a node from t under parentID, then its sub-nodes. The
+// node is titled title, or else t's name with its placeholders replaced.
+func (s *TemplateService) instantiate(ctx context.Context, tx pgx.Tx, a *templateApplication, t *models.Template, parentID *uuid.UUID, title *string, authorType string, depth int) error {
+	if depth > maxTemplateDepth || a.applying[t.ID] {
+		return ErrTemplateNesting
+	}
+	a.applying[t.ID] = true
+	defer delete(a.applying, t.ID)
+
+	values := a.resolveValues(t)
+	nodeTitle := values.substitute(t.Name)
+	if title != nil {
+		nodeTitle = *title
+	}
+	agentConfig := values.agentConfig(t.AgentConfig)
+
+	node, err := s.createNode(ctx, tx, a, t, parentID, nodeTitle, values.substitutePtr(t.Description), authorType, agentConfig)
+	if err != nil {
+		return err
+	}
+
+	for i, slot := range t.Structure.Inputs {
+		label := values.substitute(slot.Label)
+		input := models.NodeInput{
+			ID:        uuid.New(),
+			NodeID:    node.ID,
+			InputType: slot.Type,
+			Label:     &label,
+			Metadata: map[string]any{
+				"required":    slot.Required,
+				"description": values.substitute(slot.Description),
+				"templateId":  t.ID,
+			},
+			SortOrder: i,
+		}
+		if slot.Value != "" {
+			value := values.substitute(slot.Value)
+			switch slot.Type {
+			case "text":
+				input.TextContent = &value
+			case "external_link":
+				input.ExternalURL = &value
+			}
+		}
+		if err := addInput(ctx, tx, a, input); err != nil {
+			return err
+		}
+	}
+
+	for i, slot := range t.Structure.Outputs {
+		label := values.substitute(slot.Label)
+		output := models.NodeOutput{
+			ID:         uuid.New(),
+			NodeID:     node.ID,
+			OutputType: slot.Type,
+			Label:      &label,
+			Metadata: map[string]any{
+				"description": values.substitute(slot.Description),
+				"templateId":  t.ID,
+			},
+			SortOrder: i,
+		}
+		if err := addOutput(ctx, tx, a, output); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range t.Structure.SubNodes {
+		subTitle := values.substitute(sub.Title)
+		if sub.TemplateID == nil {
+			// Agent sub-nodes do the template's agent work, so get its config
+			var subAgentConfig *models.AgentConfig
+			if sub.AuthorType == "agent" {
+				subAgentConfig = agentConfig
+			}
+			if _, err := s.createNode(ctx, tx, a, t, &node.ID, subTitle, nil, sub.AuthorType, subAgentConfig); err != nil {
+				return err
+			}
+			continue
+		}
+
+		subTemplate, err := s.availableTemplate(ctx, tx, *sub.TemplateID, a.orgID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrUnresolvedTemplate
+		}
+		if err != nil {
+			return err
+		}
+		if err := s.instantiate(ctx, tx, a, subTemplate, &node.ID, &subTitle, sub.AuthorType, depth+1); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createNode creates a draft node for Apply, recording that it came from the
+// current version of t. Agent nodes are supervised by the user applying the
+// template.
+func (s *TemplateService) createNode(ctx context.Context, tx pgx.Tx, a *templateApplication, t *models.Template, parentID *uuid.UUID, title string, description *string, authorType string, agentConfig *models.AgentConfig) (*models.Node, error) {
+	node := models.Node{
+		ID:           uuid.New(),
+		OrgID:        a.orgID,
+		ProjectID:    a.projectID,
+		ParentID:     parentID,
+		Title:        title,
+		Description:  description,
+		Status:       "draft",
+		AuthorType:   authorType,
+		AuthorUserID: &a.userID,
+		Version:      1,
+		Metadata:     models.NodeMetadata{},
+		Position:     models.NodePosition{X: 0, Y: 0},
+		TemplateID:   &t.ID,
+		AgentConfig:  agentConfig,
+	}
+	version := t.Version
+	node.TemplateVersion = &version
+	if authorType == "agent" {
+		node.SupervisorUserID = &a.userID
+	}
+
+	if parentID != nil {
+		a.edges = append(a.edges, models.TemplatePreviewEdge{From: *parentID, To: node.ID, Type: "parent"})
+	}
+	if a.dryRun {
+		node.CreatedAt = time.Now()
+		node.UpdatedAt = node.CreatedAt
+		a.nodes = append(a.nodes, node)
+		return &node, nil
+	}
+
+	metadataJSON, _ := json.Marshal(node.Metadata)
+	positionJSON, _ := json.Marshal(node.Position)
+	var agentConfigJSON []byte
+	if node.AgentConfig != nil {
+		agentConfigJSON, _ = json.Marshal(node.AgentConfig)
+	}
+
+	err := tx.QueryRow(ctx, `
+		INSERT INTO nodes (id, org_id, project_id, parent_id, title, description, status, author_type,
+		                   author_user_id, supervisor_user_id, version, metadata, position,
+		                   template_id, template_version, agent_config)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		RETURNING created_at, updated_at
+	`, node.ID, node.OrgID, node.ProjectID, node.ParentID, node.Title, node.Description,
+		node.Status, node.AuthorType, node.AuthorUserID, node.SupervisorUserID, node.Version,
+		metadataJSON, positionJSON, node.TemplateID, node.TemplateVersion, agentConfigJSON).Scan(&node.CreatedAt, &node.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create node: %w", err)
+	}
+
+	if err := s.eventStore.Append(ctx, tx, node.OrgID, AggregateNode, node.ID, "node.created", &node, &a.userID); err != nil {
+		return nil, err
+	}
+
+	a.nodes = append(a.nodes, node)
+	return &node, nil
+}
+
+// addInput adds an input slot to a node created by Apply
+func addInput(ctx context.Context, tx pgx.Tx, a *templateApplication, input models.NodeInput) error {
+	if a.dryRun {
+		input.CreatedAt = time.Now()
+		a.inputs = append(a.inputs, input)
+		return nil
+	}
+
+	metadataJSON, _ := json.Marshal(input.Metadata)
+	err := tx.QueryRow(ctx, `
+		INSERT INTO node_inputs (id, node_id, input_type, label, text_content, external_url, metadata, sort_order)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at
+	`, input.ID, input.NodeID, input.InputType, input.Label, input.TextContent, input.ExternalURL, metadataJSON,
+		input.SortOrder).Scan(&input.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add input: %w", err)
+	}
+	a.inputs = append(a.inputs, input)
+	return nil
+}
+
+// addOutput adds an output slot to a node created by Apply
+func addOutput(ctx context.Context, tx pgx.Tx, a *templateApplication, output models.NodeOutput) error {
+	if a.dryRun {
+		output.CreatedAt = time.Now()
+		a.outputs = append(a.outputs, output)
+		return nil
+	}
+
+	metadataJSON, _ := json.Marshal(output.Metadata)
+	err := tx.QueryRow(ctx, `
+		INSERT INTO node_outputs (id, node_id, output_type, label, metadata, sort_order)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING created_at
+	`, output.ID, output.NodeID, output.OutputType, output.Label, metadataJSON, output.SortOrder).Scan(&output.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to add output: %w", err)
+	}
+	a.outputs = append(a.outputs, output)
+	return nil
+}
+
+// availableTemplate reads a template that can be applied in orgID: a public
+// one or one of the org's own. Returns pgx.ErrNoRows otherwise.
+func (s *TemplateService) availableTemplate(ctx context.Context, tx pgx.Tx, templateID, orgID uuid.UUID) (*models.Template, error) {
+	t, err := scanTemplate(tx.QueryRow(ctx, `
+		SELECT `+templateColumns+`
+		FROM templates t
+		WHERE t.id = $1 AND (t.is_public OR t.org_id = $2)
+	`, templateID, orgID))
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, fmt.Errorf("failed to get template: %w", err)
+	}
+	return t, err
+}
+
+// scanTemplate scans templateColumns
+func scanTemplate(row pgx.Row) (*models.Template, error) {
+	var t models.Template
+	var structureJSON, agentConfigJSON []byte
+	var ratingScore int
+
+	err := row.Scan(
+		&t.ID, &t.OrgID, &t.Name, &t.Description, &structureJSON, &agentConfigJSON,
+		&t.IsPublic, &t.Version, &t.Categories, &t.IsFeatured, &t.UsageCount, &t.RatingCount, &ratingScore,
+		&t.CreatedAt, &t.UpdatedAt, &t.CreatedBy,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(structureJSON, &t.Structure)
+	if agentConfigJSON != nil {
+		json.Unmarshal(agentConfigJSON, &t.AgentConfig)
+	}
+	if t.RatingCount > 0 {
+		rating := float64(ratingScore) / 100
+		t.Rating = &rating
+	}
+	return &t, nil
+}
+
+const templateVersionColumns = `id, template_id, version, name, description, structure, agent_config,
+	created_by, created_at`
+
+// scanTemplateVersion scans templateVersionColumns
+func scanTemplateVersion(row pgx.Row) (*models.TemplateVersion, error) {
+	var v models.TemplateVersion
+	var structureJSON, agentConfigJSON []byte
+
+	err := row.Scan(
+		&v.ID, &v.TemplateID, &v.Version, &v.Name, &v.Description, &structureJSON, &agentConfigJSON,
+		&v.CreatedBy, &v.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	json.Unmarshal(structureJSON, &v.Structure)
+	if agentConfigJSON != nil {
+		json.Unmarshal(agentConfigJSON, &v.AgentConfig)
+	}
+	return &v, nil
+}
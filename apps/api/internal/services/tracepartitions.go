@@ -0,0 +1,220 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/telemetry"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	tracePartitionLeaseKey    = "glassbox:trace-partitions:leader"
+	tracePartitionInterval    = time.Hour
+	tracePartitionPrefix      = "agent_trace_events_p"
+	tracePartitionMonthsAhead = 3
+)
+
+// TracePartitionService maintains the monthly partitions of
+// agent_trace_events: it creates each month's partition ahead of time and
+// drops partitions past TraceRetention. Inserts fail for a month with no
+// partition, so it runs whatever the retention.
+type TracePartitionService struct {
+	db     *database.DB
+	redis  *database.Redis
+	cfg    *config.Config
+	logger *zap.Logger
+
+	// Identifies this instance as the holder of the maintenance lease
+	holder string
+
+	leader      atomic.Bool
+	failures    atomic.Uint64
+	created     atomic.Uint64
+	dropped     atomic.Uint64
+	partitions  atomic.Int64
+	lastSuccess atomic.Int64 // Unix seconds
+}
+
+func NewTracePartitionService(db *database.DB, redis *database.Redis, cfg *config.Config, logger *zap.Logger) *TracePartitionService {
+	return &TracePartitionService{db: db, redis: redis, cfg: cfg, logger: logger, holder: uuid.NewString()}
+}
+
+// Run maintains the partitions every hour until ctx is cancelled. Only the
+// instance holding the lease in Redis does the work.
+func (s *TracePartitionService) Run(ctx context.Context) {
+	defer s.redis.ReleaseLock(context.WithoutCancel(ctx), tracePartitionLeaseKey, s.holder)
+
+	ticker := time.NewTicker(tracePartitionInterval)
+	defer ticker.Stop()
+	for {
+		s.runIfLeader(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *TracePartitionService) runIfLeader(ctx context.Context) {
+	held, err := s.redis.HoldLease(ctx, tracePartitionLeaseKey, s.holder, 2*tracePartitionInterval)
+	if err != nil {
+		if ctx.Err() == nil {
+			s.logger.Warn("Failed to hold trace partition lease", zap.Error(err))
+		}
+		return
+	}
+	s.leader.Store(held)
+	if !held {
+		return
+	}
+
+	if err := s.Maintain(ctx, time.Now()); err != nil {
+		if ctx.Err() == nil {
+			s.failures.Add(1)
+			s.logger.Error("Trace partition maintenance failed", zap.Error(err))
+		}
+		return
+	}
+	s.lastSuccess.Store(time.Now().Unix())
+}
+
+// Maintain creates the partitions for now's month and the next
+// tracePartitionMonthsAhead, then drops those whose month ended more than
+// TraceRetention before now
+func (s *TracePartitionService) Maintain(ctx context.Context, now time.Time) error {
+	month := monthStart(now)
+	for i := 0; i <= tracePartitionMonthsAhead; i++ {
+		var created bool
+		err := s.db.Pool.QueryRow(ctx, `SELECT create_trace_event_partition($1)`,
+			month.AddDate(0, i, 0)).Scan(&created)
+		if err != nil {
+			return fmt.Errorf("failed to create trace partition: %w", err)
+		}
+		if created {
+			s.created.Add(1)
+			s.logger.Info("Created trace event partition", zap.String("month", month.AddDate(0, i, 0).Format("2006-01")))
+		}
+	}
+
+	partitions, err := s.list(ctx)
+	if err != nil {
+		return err
+	}
+	remaining := len(partitions)
+	if s.cfg.TraceRetention > 0 {
+		cutoff := now.Add(-s.cfg.TraceRetention)
+		for _, p := range partitions {
+			if p.month.AddDate(0, 1, 0).After(cutoff) {
+				continue
+			}
+			if err := s.drop(ctx, p); err != nil {
+				return err
+			}
+			s.dropped.Add(1)
+			remaining--
+			s.logger.Info("Dropped trace event partition", zap.String("partition", p.name))
+		}
+	}
+	s.partitions.Store(int64(remaining))
+	return nil
+}
+
+type tracePartition struct {
+	name          string
+	month         time.Time
+	detachPending bool
+}
+
+// list returns the trace event partitions, oldest first
+func (s *TracePartitionService) list(ctx context.Context) ([]tracePartition, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT c.relname, i.inhdetachpending
+		FROM pg_inherits i
+		JOIN pg_class c ON c.oid = i.inhrelid
+		WHERE i.inhparent = 'agent_trace_events'::regclass
+		ORDER BY c.relname
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list trace partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []tracePartition
+	for rows.Next() {
+		var p tracePartition
+		if err := rows.Scan(&p.name, &p.detachPending); err != nil {
+			return nil, fmt.Errorf("failed to scan trace partition: %w", err)
+		}
+		// Skip anything not made by create_trace_event_partition
+		month, err := time.Parse("2006_01", strings.TrimPrefix(p.name, tracePartitionPrefix))
+		if err != nil || !strings.HasPrefix(p.name, tracePartitionPrefix) {
+			continue
+		}
+		p.month = month
+		partitions = append(partitions, p)
+	}
+	return partitions, rows.Err()
+}
+
+// drop detaches a partition without blocking trace reads and writes, then
+// drops it. A detach interrupted on an earlier run is finished first.
+func (s *TracePartitionService) drop(ctx context.Context, p tracePartition) error {
+	conn, err := s.db.Pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Detaching waits for queries on the table to finish, so it isn't
+	// subject to the statement timeout
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return fmt.Errorf("failed to disable statement timeout: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), `RESET statement_timeout`)
+
+	name := pgx.Identifier{p.name}.Sanitize()
+	detach := `ALTER TABLE agent_trace_events DETACH PARTITION ` + name + ` CONCURRENTLY`
+	if p.detachPending {
+		detach = `ALTER TABLE agent_trace_events DETACH PARTITION ` + name + ` FINALIZE`
+	}
+	if _, err := conn.Exec(ctx, detach); err != nil {
+		return fmt.Errorf("failed to detach trace partition %s: %w", p.name, err)
+	}
+	if _, err := conn.Exec(ctx, `DROP TABLE `+name); err != nil {
+		return fmt.Errorf("failed to drop trace partition %s: %w", p.name, err)
+	}
+	return nil
+}
+
+// WriteMetrics reports partition maintenance on this instance
+func (s *TracePartitionService) WriteMetrics(w *telemetry.MetricsWriter) {
+	w.Gauge("glassbox_trace_partitions_leader", "Whether this instance maintains the trace event partitions.",
+		telemetry.Sample{Value: boolMetric(s.leader.Load())})
+	w.Counter("glassbox_trace_partitions_created_total", "Trace event partitions created.",
+		telemetry.Sample{Value: float64(s.created.Load())})
+	w.Counter("glassbox_trace_partitions_dropped_total", "Trace event partitions dropped for retention.",
+		telemetry.Sample{Value: float64(s.dropped.Load())})
+	w.Counter("glassbox_trace_partitions_failures_total", "Trace partition maintenance runs that failed.",
+		telemetry.Sample{Value: float64(s.failures.Load())})
+	if last := s.lastSuccess.Load(); last > 0 {
+		w.Gauge("glassbox_trace_partitions", "Trace event partitions after the last run.",
+			telemetry.Sample{Value: float64(s.partitions.Load())})
+		w.Gauge("glassbox_trace_partitions_last_success_timestamp_seconds", "When partition maintenance last succeeded.",
+			telemetry.Sample{Value: float64(last)})
+	}
+}
+
+// monthStart returns the first instant of t's month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
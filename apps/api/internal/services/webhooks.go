@@ -0,0 +1,441 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidWebhookURL = errors.New("invalid webhook URL")
+	ErrTooManyWebhooks   = errors.New("too many webhooks")
+)
+
+const (
+	// Webhooks per user, and per org
+	maxWebhooks = 10
+	// A webhook is disabled after this many failed deliveries in a row
+	webhookMaxFailures = 10
+	webhookTimeout     = 5 * time.Second
+	// Stored error messages are cut to this length
+	webhookErrorLength = 500
+)
+
+// Delivery attempts wait this long before each retry
+var webhookRetryDelays = []time.Duration{time.Second, 5 * time.Second}
+
+// WebhookEvents are the notification types webhooks can receive
+var WebhookEvents = []string{
+	NotificationExecutionComplete, NotificationExecutionFailed,
+	NotificationHumanInputNeeded, NotificationApprovalRequest,
+}
+
+// Events a webhook receives when it is created without a list
+var defaultWebhookEvents = []string{NotificationExecutionFailed, NotificationApprovalRequest}
+
+// Headers sent with each delivery. The signature is the hex HMAC-SHA256 of
+// the timestamp, a ".", and the body, keyed with the webhook's secret.
+const (
+	HeaderWebhookEvent     = "X-Glassbox-Event"
+	HeaderWebhookDelivery  = "X-Glassbox-Delivery"
+	HeaderWebhookTimestamp = "X-Glassbox-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Glassbox-Webhook-Signature"
+)
+
+// WebhookOwner is who a webhook belongs to: a user, for their own
+// notifications, or an org, for every execution notification in it
+type WebhookOwner struct {
+	UserID *uuid.UUID
+	OrgID  *uuid.UUID
+}
+
+// CreateWebhookRequest contains data for registering a webhook
+type CreateWebhookRequest struct {
+	URL         string   `json:"url" binding:"required,max=2000"`
+	Events      []string `json:"events" binding:"omitempty,dive,oneof=execution_complete execution_failed human_input_needed approval_request"`
+	Description *string  `json:"description,omitempty" binding:"omitempty,max=500"`
+}
+
+// WebhookPayload is the JSON body of a delivery
+type WebhookPayload struct {
+	ID          uuid.UUID  `json:"id"`
+	Event       string     `json:"event"`
+	OccurredAt  time.Time  `json:"occurredAt"`
+	OrgID       uuid.UUID  `json:"orgId"`
+	UserID      *uuid.UUID `json:"userId,omitempty"`
+	Title       string     `json:"title"`
+	Body        string     `json:"body,omitempty"`
+	NodeID      *uuid.UUID `json:"nodeId,omitempty"`
+	ExecutionID *uuid.UUID `json:"executionId,omitempty"`
+}
+
+// WebhookResult is the outcome of a delivery attempt
+type WebhookResult struct {
+	Delivered bool   `json:"delivered"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// WebhookService manages notification webhooks and delivers to them.
+// Deliveries are signed, retried twice, and sent only to public addresses
+// outside development. Webhooks that keep failing are disabled.
+type WebhookService struct {
+	db     *database.DB
+	cfg    *config.Config
+	http   *http.Client
+	logger *zap.Logger
+}
+
+func NewWebhookService(db *database.DB, cfg *config.Config, logger *zap.Logger) *WebhookService {
+	return &WebhookService{db: db, cfg: cfg, http: outboundClient(cfg, webhookTimeout), logger: logger}
+}
+
+// outboundClient returns a client for requests to user-supplied URLs. Outside
+// development it only connects to public addresses. Redirects are not
+// followed, since they could lead anywhere.
+func outboundClient(cfg *config.Config, timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !cfg.IsDevelopment() {
+		dialer.Control = publicAddressOnly
+	}
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     &http.Transport{DialContext: dialer.DialContext, Proxy: nil},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+const webhookColumns = `
+	id, org_id, user_id, url, events, description, created_by, created_at,
+	last_delivery_at, last_status, last_error, consecutive_failures, disabled_at
+`
+
+func scanWebhook(row pgx.Row, w *models.NotificationWebhook) error {
+	return row.Scan(&w.ID, &w.OrgID, &w.UserID, &w.URL, &w.Events, &w.Description, &w.CreatedBy, &w.CreatedAt,
+		&w.LastDeliveryAt, &w.LastStatus, &w.LastError, &w.ConsecutiveFailures, &w.DisabledAt)
+}
+
+// List returns the owner's webhooks, oldest first, without their secrets
+func (s *WebhookService) List(ctx context.Context, owner WebhookOwner) ([]models.NotificationWebhook, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT `+webhookColumns+` FROM notification_webhooks
+		WHERE user_id IS NOT DISTINCT FROM $1 AND org_id IS NOT DISTINCT FROM $2
+		ORDER BY created_at, id
+	`, owner.UserID, owner.OrgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	webhooks := []models.NotificationWebhook{}
+	for rows.Next() {
+		var w models.NotificationWebhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// Create registers a webhook and returns it with its secret, which is not
+// shown again. Returns ErrInvalidWebhookURL for URLs deliveries couldn't be
+// sent to, and ErrTooManyWebhooks once the owner has maxWebhooks.
+func (s *WebhookService) Create(ctx context.Context, owner WebhookOwner, createdBy uuid.UUID, req CreateWebhookRequest) (*models.NotificationWebhook, error) {
+	if err := s.checkURL(req.URL); err != nil {
+		return nil, err
+	}
+	events := req.Events
+	if len(events) == 0 {
+		events = defaultWebhookEvents
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	var w models.NotificationWebhook
+	err := s.db.WithTransaction(ctx, func(tx pgx.Tx) error {
+		// Serialize creates for the owner, so the limit holds. Locking the
+		// owner's webhooks wouldn't: concurrent creates see none of each
+		// other's, and an owner with none has nothing to lock.
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtextextended('webhooks:' || COALESCE($1::uuid, $2::uuid)::text, 0))`, owner.UserID, owner.OrgID); err != nil {
+			return fmt.Errorf("failed to lock webhooks: %w", err)
+		}
+		var count int
+		err := tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM notification_webhooks
+			WHERE user_id IS NOT DISTINCT FROM $1 AND org_id IS NOT DISTINCT FROM $2
+		`, owner.UserID, owner.OrgID).Scan(&count)
+		if err != nil {
+			return fmt.Errorf("failed to count webhooks: %w", err)
+		}
+		if count >= maxWebhooks {
+			return ErrTooManyWebhooks
+		}
+
+		err = scanWebhook(tx.QueryRow(ctx, `
+			INSERT INTO notification_webhooks (org_id, user_id, url, secret, events, description, created_by)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			RETURNING `+webhookColumns,
+			owner.OrgID, owner.UserID, req.URL, hex.EncodeToString(secret), events, req.Description, createdBy), &w)
+		if err != nil {
+			return fmt.Errorf("failed to create webhook: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	w.Secret = hex.EncodeToString(secret)
+	return &w, nil
+}
+
+// Delete removes one of the owner's webhooks
+func (s *WebhookService) Delete(ctx context.Context, owner WebhookOwner, webhookID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM notification_webhooks
+		WHERE id = $1 AND user_id IS NOT DISTINCT FROM $2 AND org_id IS NOT DISTINCT FROM $3
+	`, webhookID, owner.UserID, owner.OrgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Test sends a "test" delivery to one of the owner's webhooks, once and
+// without retrying, and returns the outcome. Success re-enables a webhook
+// disabled after failures.
+func (s *WebhookService) Test(ctx context.Context, owner WebhookOwner, webhookID uuid.UUID) (*WebhookResult, error) {
+	var target webhookTarget
+	var orgID *uuid.UUID
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT w.id, w.url, w.secret, COALESCE(w.org_id, (
+			SELECT om.org_id FROM org_members om WHERE om.user_id = w.user_id ORDER BY om.created_at LIMIT 1
+		))
+		FROM notification_webhooks w
+		WHERE w.id = $1 AND w.user_id IS NOT DISTINCT FROM $2 AND w.org_id IS NOT DISTINCT FROM $3
+	`, webhookID, owner.UserID, owner.OrgID).Scan(&target.id, &target.url, &target.secret, &orgID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+
+	payload := WebhookPayload{
+		ID:         uuid.New(),
+		Event:      "test",
+		OccurredAt: time.Now().UTC(),
+		UserID:     owner.UserID,
+		Title:      "Test delivery from GlassBox",
+	}
+	if orgID != nil {
+		payload.OrgID = *orgID
+	}
+	result := s.deliver(ctx, target, payload)
+	s.record(ctx, target.id, result, true)
+	return &result, nil
+}
+
+// webhookTarget is where a delivery goes
+type webhookTarget struct {
+	id     uuid.UUID
+	url    string
+	secret string
+}
+
+// Dispatch delivers an execution notification, in the background, to the
+// recipient's webhooks and the org's that subscribe to its type. It is sent
+// whether or not the recipient receives in-app notifications.
+func (s *WebhookService) Dispatch(n *models.Notification, executionID *uuid.UUID) {
+	payload := WebhookPayload{
+		ID:          uuid.New(),
+		Event:       n.Type,
+		OccurredAt:  time.Now().UTC(),
+		OrgID:       n.OrgID,
+		UserID:      &n.UserID,
+		Title:       n.Title,
+		NodeID:      n.ResourceID,
+		ExecutionID: executionID,
+	}
+	if n.Body != nil {
+		payload.Body = *n.Body
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		rows, err := s.db.Pool.Query(ctx, `
+			SELECT w.id, w.url, w.secret
+			FROM notification_webhooks w
+			LEFT JOIN users u ON u.id = w.user_id
+			WHERE (w.user_id = $1 OR w.org_id = $2) AND $3 = ANY(w.events) AND w.disabled_at IS NULL
+			  AND (w.user_id IS NULL OR (u.deactivated_at IS NULL AND u.deleted_at IS NULL))
+		`, n.UserID, n.OrgID, n.Type)
+		if err != nil {
+			s.logger.Warn("Failed to find webhooks", zap.Error(err))
+			return
+		}
+		targets, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (webhookTarget, error) {
+			var t webhookTarget
+			return t, row.Scan(&t.id, &t.url, &t.secret)
+		})
+		if err != nil {
+			s.logger.Warn("Failed to find webhooks", zap.Error(err))
+			return
+		}
+
+		for _, target := range targets {
+			result := s.deliver(ctx, target, payload)
+			for _, delay := range webhookRetryDelays {
+				if result.Delivered || (result.Status >= 400 && result.Status < 500) {
+					break
+				}
+				select {
+				case <-ctx.Done():
+				case <-time.After(delay):
+					result = s.deliver(ctx, target, payload)
+				}
+			}
+			s.record(ctx, target.id, result, false)
+		}
+	}()
+}
+
+// deliver makes one signed delivery attempt
+func (s *WebhookService) deliver(ctx context.Context, target webhookTarget, payload WebhookPayload) WebhookResult {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return WebhookResult{Error: err.Error()}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.url, bytes.NewReader(body))
+	if err != nil {
+		return WebhookResult{Error: err.Error()}
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GlassBox-Webhooks")
+	req.Header.Set(HeaderWebhookEvent, payload.Event)
+	req.Header.Set(HeaderWebhookDelivery, payload.ID.String())
+	req.Header.Set(HeaderWebhookTimestamp, timestamp)
+	req.Header.Set(HeaderWebhookSignature, "sha256="+SignWebhook(target.secret, timestamp, body))
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return WebhookResult{Error: err.Error()}
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	result := WebhookResult{Status: resp.StatusCode, Delivered: resp.StatusCode >= 200 && resp.StatusCode < 300}
+	if !result.Delivered {
+		result.Error = "receiver returned " + resp.Status
+	}
+	return result
+}
+
+// record stores a delivery's outcome, disabling the webhook after
+// webhookMaxFailures failures in a row. A successful test re-enables it.
+func (s *WebhookService) record(ctx context.Context, webhookID uuid.UUID, result WebhookResult, test bool) {
+	var status *int
+	if result.Status != 0 {
+		status = &result.Status
+	}
+	var lastError *string
+	if result.Error != "" {
+		msg := result.Error
+		if len(msg) > webhookErrorLength {
+			msg = msg[:webhookErrorLength]
+		}
+		lastError = &msg
+	}
+
+	_, err := s.db.Pool.Exec(ctx, `
+		UPDATE notification_webhooks SET
+			last_delivery_at = NOW(),
+			last_status = $2,
+			last_error = $3,
+			consecutive_failures = CASE WHEN $4 THEN 0 ELSE consecutive_failures + 1 END,
+			disabled_at = CASE
+				WHEN $4 AND $5 THEN NULL
+				WHEN NOT $4 AND consecutive_failures + 1 >= $6 THEN COALESCE(disabled_at, NOW())
+				ELSE disabled_at
+			END
+		WHERE id = $1
+	`, webhookID, status, lastError, result.Delivered, test, webhookMaxFailures)
+	if err != nil {
+		s.logger.Warn("Failed to record webhook delivery", zap.String("webhookId", webhookID.String()), zap.Error(err))
+	}
+}
+
+// SignWebhook returns the hex signature of a delivery, for receivers to
+// compare with the X-Glassbox-Webhook-Signature header
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkURL accepts absolute https URLs, and http in development. Whether
+// the host resolves to a public address is checked on each delivery.
+func (s *WebhookService) checkURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInvalidWebhookURL
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && s.cfg.IsDevelopment()) {
+		return ErrInvalidWebhookURL
+	}
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !s.cfg.IsDevelopment() && !isPublicIP(ip) {
+		return ErrInvalidWebhookURL
+	}
+	return nil
+}
+
+// publicAddressOnly refuses connections to loopback, private, link-local
+// and other internal addresses, so webhooks and push endpoints can't reach
+// into the network the API runs in. It runs after DNS resolution, for every
+// connection.
+func publicAddressOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("webhook address %s is not public", host)
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
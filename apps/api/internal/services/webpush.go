@@ -0,0 +1,428 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/hkdf"
+)
+
+var (
+	ErrPushNotConfigured       = errors.New("web push is not configured")
+	ErrInvalidPushSubscription = errors.New("invalid push subscription")
+)
+
+const (
+	pushTimeout = 10 * time.Second
+	// Push services keep undelivered messages this long
+	pushTTL = 24 * time.Hour
+	// VAPID tokens are valid this long; push services accept up to 24 hours
+	vapidTokenLifetime = 12 * time.Hour
+	// Notification bodies are cut to this many bytes so the encrypted
+	// message fits in one 4 KB record
+	pushBodyLength = 1000
+)
+
+// pushTypes are the high-priority notification types sent as Web Push
+// notifications, unless the user chose otherwise: the ones someone has to
+// act on
+var pushTypes = map[string]bool{
+	NotificationHumanInputNeeded: true,
+	NotificationApprovalRequest:  true,
+	NotificationExecutionFailed:  true,
+}
+
+// SubscribePushRequest is a browser's PushSubscription, as returned by its
+// toJSON method
+type SubscribePushRequest struct {
+	Endpoint string `json:"endpoint" binding:"required,url,max=2000"`
+	Keys     struct {
+		P256dh string `json:"p256dh" binding:"required"`
+		Auth   string `json:"auth" binding:"required"`
+	} `json:"keys" binding:"required"`
+}
+
+// PushMessage is the JSON a service worker receives in its push event
+type PushMessage struct {
+	ID           *uuid.UUID `json:"id,omitempty"`
+	Type         string     `json:"type"`
+	Title        string     `json:"title"`
+	Body         string     `json:"body,omitempty"`
+	OrgID        uuid.UUID  `json:"orgId"`
+	ResourceType *string    `json:"resourceType,omitempty"`
+	ResourceID   *uuid.UUID `json:"resourceId,omitempty"`
+	CreatedAt    time.Time  `json:"createdAt"`
+}
+
+// WebPushService manages browser push subscriptions and sends high-priority
+// notifications to them, so users hear about them with the app closed.
+// Messages are encrypted for each subscription (RFC 8291) and signed with
+// the server's VAPID key (RFC 8292). Without VAPID_PRIVATE_KEY it is
+// disabled.
+type WebPushService struct {
+	db        *database.DB
+	cfg       *config.Config
+	http      *http.Client
+	key       *ecdsa.PrivateKey
+	publicKey string
+	logger    *zap.Logger
+}
+
+func NewWebPushService(db *database.DB, cfg *config.Config, logger *zap.Logger) *WebPushService {
+	s := &WebPushService{db: db, cfg: cfg, http: outboundClient(cfg, pushTimeout), logger: logger}
+	if cfg.VAPIDPrivateKey == "" {
+		return s
+	}
+
+	key, err := vapidKey(cfg.VAPIDPrivateKey)
+	if err != nil {
+		logger.Error("Invalid VAPID key; web push is disabled", zap.Error(err))
+		return s
+	}
+	s.key = key
+	s.publicKey = base64.RawURLEncoding.EncodeToString(elliptic.Marshal(key.Curve, key.X, key.Y))
+	return s
+}
+
+// vapidKey parses a base64url P-256 private key scalar
+func vapidKey(encoded string) (*ecdsa.PrivateKey, error) {
+	d, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	if err != nil {
+		return nil, err
+	}
+	ecdhKey, err := ecdh.P256().NewPrivateKey(d)
+	if err != nil {
+		return nil, err
+	}
+	x, y := elliptic.Unmarshal(elliptic.P256(), ecdhKey.PublicKey().Bytes())
+	key := &ecdsa.PrivateKey{D: new(big.Int).SetBytes(d)}
+	key.Curve, key.X, key.Y = elliptic.P256(), x, y
+	return key, nil
+}
+
+// PublicKey returns the VAPID public key browsers pass to
+// pushManager.subscribe as applicationServerKey
+func (s *WebPushService) PublicKey() (string, error) {
+	if s.key == nil {
+		return "", ErrPushNotConfigured
+	}
+	return s.publicKey, nil
+}
+
+// Subscribe stores a browser's subscription for the user. A browser that
+// subscribes again, or is now signed in as someone else, replaces its
+// previous subscription.
+func (s *WebPushService) Subscribe(ctx context.Context, userID uuid.UUID, userAgent string, req SubscribePushRequest) (*models.PushSubscription, error) {
+	if s.key == nil {
+		return nil, ErrPushNotConfigured
+	}
+	if err := s.checkSubscription(req); err != nil {
+		return nil, err
+	}
+
+	var ua *string
+	if userAgent != "" {
+		ua = &userAgent
+	}
+	var sub models.PushSubscription
+	err := s.db.Pool.QueryRow(ctx, `
+		INSERT INTO push_subscriptions (user_id, endpoint, p256dh, auth, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (endpoint) DO UPDATE SET
+			user_id = EXCLUDED.user_id,
+			p256dh = EXCLUDED.p256dh,
+			auth = EXCLUDED.auth,
+			user_agent = EXCLUDED.user_agent,
+			created_at = NOW(),
+			last_used_at = NULL
+		RETURNING id, user_id, endpoint, user_agent, created_at, last_used_at
+	`, userID, req.Endpoint, req.Keys.P256dh, req.Keys.Auth, ua).Scan(
+		&sub.ID, &sub.UserID, &sub.Endpoint, &sub.UserAgent, &sub.CreatedAt, &sub.LastUsedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save push subscription: %w", err)
+	}
+	return &sub, nil
+}
+
+// checkSubscription rejects endpoints that aren't https and keys that
+// couldn't encrypt a message
+func (s *WebPushService) checkSubscription(req SubscribePushRequest) error {
+	u, err := url.Parse(req.Endpoint)
+	if err != nil || u.Host == "" || u.User != nil {
+		return ErrInvalidPushSubscription
+	}
+	if u.Scheme != "https" && !(u.Scheme == "http" && s.cfg.IsDevelopment()) {
+		return ErrInvalidPushSubscription
+	}
+	p256dh, err := decodeBase64URL(req.Keys.P256dh)
+	if err != nil {
+		return ErrInvalidPushSubscription
+	}
+	if _, err := ecdh.P256().NewPublicKey(p256dh); err != nil {
+		return ErrInvalidPushSubscription
+	}
+	if auth, err := decodeBase64URL(req.Keys.Auth); err != nil || len(auth) != 16 {
+		return ErrInvalidPushSubscription
+	}
+	return nil
+}
+
+// List returns the user's subscriptions, newest first
+func (s *WebPushService) List(ctx context.Context, userID uuid.UUID) ([]models.PushSubscription, error) {
+	rows, err := s.db.Pool.Query(ctx, `
+		SELECT id, user_id, endpoint, user_agent, created_at, last_used_at
+		FROM push_subscriptions
+		WHERE user_id = $1
+		ORDER BY created_at DESC, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list push subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	subs := []models.PushSubscription{}
+	for rows.Next() {
+		var sub models.PushSubscription
+		if err := rows.Scan(&sub.ID, &sub.UserID, &sub.Endpoint, &sub.UserAgent, &sub.CreatedAt, &sub.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan push subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+// Unsubscribe removes one of the user's subscriptions
+func (s *WebPushService) Unsubscribe(ctx context.Context, userID, subscriptionID uuid.UUID) error {
+	result, err := s.db.Pool.Exec(ctx, `
+		DELETE FROM push_subscriptions WHERE id = $1 AND user_id = $2
+	`, subscriptionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete push subscription: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Send pushes a notification, in the background, to each of the
+// recipient's subscriptions. The message has no ID when the notification
+// wasn't stored in-app. Nothing is sent when push is not configured.
+// Subscriptions the push service reports as gone are deleted.
+func (s *WebPushService) Send(n *models.Notification) {
+	if s.key == nil {
+		return
+	}
+
+	msg := PushMessage{
+		Type:         n.Type,
+		Title:        n.Title,
+		OrgID:        n.OrgID,
+		ResourceType: n.ResourceType,
+		ResourceID:   n.ResourceID,
+		CreatedAt:    n.CreatedAt,
+	}
+	if n.ID != uuid.Nil {
+		msg.ID = &n.ID
+	}
+	if n.Body != nil {
+		msg.Body = truncateUTF8(*n.Body, pushBodyLength)
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		s.logger.Warn("Failed to encode push message", zap.Error(err))
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		rows, err := s.db.Pool.Query(ctx, `
+			SELECT id, endpoint, p256dh, auth FROM push_subscriptions WHERE user_id = $1
+		`, n.UserID)
+		if err != nil {
+			s.logger.Warn("Failed to find push subscriptions", zap.Error(err))
+			return
+		}
+		subs, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.PushSubscription, error) {
+			var sub models.PushSubscription
+			return sub, row.Scan(&sub.ID, &sub.Endpoint, &sub.P256dh, &sub.Auth)
+		})
+		if err != nil {
+			s.logger.Warn("Failed to find push subscriptions", zap.Error(err))
+			return
+		}
+
+		for _, sub := range subs {
+			s.deliver(ctx, sub, payload)
+		}
+	}()
+}
+
+// deliver sends one encrypted message and records the outcome
+func (s *WebPushService) deliver(ctx context.Context, sub models.PushSubscription, payload []byte) {
+	status, err := s.post(ctx, sub, payload)
+	switch {
+	case err != nil:
+		s.logger.Warn("Failed to send push notification", zap.String("subscriptionId", sub.ID.String()), zap.Error(err))
+	case status == http.StatusNotFound || status == http.StatusGone:
+		// The browser unsubscribed or the subscription expired
+		if _, err := s.db.Pool.Exec(ctx, `DELETE FROM push_subscriptions WHERE id = $1`, sub.ID); err != nil {
+			s.logger.Warn("Failed to delete expired push subscription", zap.Error(err))
+		}
+	case status >= 200 && status < 300:
+		if _, err := s.db.Pool.Exec(ctx, `UPDATE push_subscriptions SET last_used_at = NOW() WHERE id = $1`, sub.ID); err != nil {
+			s.logger.Warn("Failed to record push delivery", zap.Error(err))
+		}
+	default:
+		s.logger.Warn("Push service rejected notification",
+			zap.String("subscriptionId", sub.ID.String()), zap.Int("status", status))
+	}
+}
+
+// post encrypts the payload for the subscription and sends it to its push
+// service, returning the response status
+func (s *WebPushService) post(ctx context.Context, sub models.PushSubscription, payload []byte) (int, error) {
+	body, err := encryptPush(sub, payload)
+	if err != nil {
+		return 0, err
+	}
+	endpoint, err := url.Parse(sub.Endpoint)
+	if err != nil {
+		return 0, err
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{
+		"aud": endpoint.Scheme + "://" + endpoint.Host,
+		"exp": time.Now().Add(vapidTokenLifetime).Unix(),
+		"sub": s.cfg.VAPIDSubject,
+	}).SignedString(s.key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Content-Encoding", "aes128gcm")
+	req.Header.Set("TTL", strconv.Itoa(int(pushTTL.Seconds())))
+	req.Header.Set("Urgency", "high")
+	req.Header.Set("Authorization", "vapid t="+token+", k="+s.publicKey)
+
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// encryptPush encrypts a payload for a subscription as a single aes128gcm
+// record (RFC 8291, RFC 8188), with a new key pair and salt each time
+func encryptPush(sub models.PushSubscription, payload []byte) ([]byte, error) {
+	uaPublic, err := decodeBase64URL(sub.P256dh)
+	if err != nil {
+		return nil, err
+	}
+	authSecret, err := decodeBase64URL(sub.Auth)
+	if err != nil {
+		return nil, err
+	}
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	if err != nil {
+		return nil, err
+	}
+	asKey, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	shared, err := asKey.ECDH(uaKey)
+	if err != nil {
+		return nil, err
+	}
+	asPublic := asKey.PublicKey().Bytes()
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	keyInfo := append(append([]byte("WebPush: info\x00"), uaPublic...), asPublic...)
+	ikm := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, authSecret, keyInfo), ikm); err != nil {
+		return nil, err
+	}
+	cek := make([]byte, 16)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: aes128gcm\x00")), cek); err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, 12)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, []byte("Content-Encoding: nonce\x00")), nonce); err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	// Header: salt, record size, key ID length, and the key ID, which is
+	// our public key. 0x02 marks the last (and only) record.
+	header := make([]byte, 0, 16+4+1+len(asPublic))
+	header = append(header, salt...)
+	header = binary.BigEndian.AppendUint32(header, 4096)
+	header = append(header, byte(len(asPublic)))
+	header = append(header, asPublic...)
+	return gcm.Seal(header, nonce, append(payload, 0x02), nil), nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, which
+// browsers and libraries both produce
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+// truncateUTF8 cuts s to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,278 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/glassbox/api/internal/database"
+	"github.com/glassbox/api/internal/models"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+)
+
+const (
+	// Extracted text is truncated like the file processors do
+	maxExtractedTextChars = 50000
+
+	// files.embedding is a vector(1536)
+	embeddingDimensions = 1536
+
+	// Trace events can be timestamped this far either side of server time.
+	// Further out there may be no partition to store them in.
+	maxTraceEventSkew = time.Hour
+)
+
+// ErrInvalidWorkerReport is returned for worker reports the API can't store
+var ErrInvalidWorkerReport = errors.New("invalid worker report")
+
+// WorkerStateService stores what workers report over the gRPC worker API:
+// execution status, trace events, checkpoints and file processing results.
+// Workers write these to the database themselves when they report over
+// HTTP instead. Callers are trusted workers, so nothing here checks access.
+type WorkerStateService struct {
+	db     *database.DB
+	logger *zap.Logger
+}
+
+func NewWorkerStateService(db *database.DB, logger *zap.Logger) *WorkerStateService {
+	return &WorkerStateService{db: db, logger: logger}
+}
+
+// ExecutionStatusUpdate is a worker's report of an execution's status
+type ExecutionStatusUpdate struct {
+	ExecutionID  uuid.UUID
+	Status       string
+	TokensIn     int
+	TokensOut    int
+	ErrorMessage string
+}
+
+// UpdateExecutionStatus stores an execution's status, token totals and
+// error, and returns its node. Running executions get their start time and
+// finished ones their completion time, as the agent worker sets them.
+func (s *WorkerStateService) UpdateExecutionStatus(ctx context.Context, u ExecutionStatusUpdate) (uuid.UUID, error) {
+	if u.TokensIn < 0 || u.TokensOut < 0 {
+		return uuid.Nil, fmt.Errorf("%w: token counts can't be negative", ErrInvalidWorkerReport)
+	}
+
+	var nodeID uuid.UUID
+	err := s.db.Pool.QueryRow(ctx, `
+		UPDATE agent_executions
+		SET status = $2,
+			error_message = NULLIF($3, ''),
+			total_tokens_in = $4,
+			total_tokens_out = $5,
+			started_at = CASE WHEN $2 = 'running' THEN COALESCE(started_at, NOW()) ELSE started_at END,
+			completed_at = CASE WHEN $2 IN ('complete', 'failed', 'cancelled') THEN NOW() ELSE completed_at END
+		WHERE id = $1
+		RETURNING node_id
+	`, u.ExecutionID, u.Status, u.ErrorMessage, u.TokensIn, u.TokensOut).Scan(&nodeID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return uuid.Nil, ErrNotFound
+	}
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("failed to update execution status: %w", err)
+	}
+	return nodeID, nil
+}
+
+// TraceEventInput is a trace event reported by a worker
+type TraceEventInput struct {
+	ExecutionID uuid.UUID
+	EventType   string
+	EventData   json.RawMessage
+	Timestamp   time.Time // zero for now
+	DurationMs  *int
+	Model       string
+	TokensIn    *int
+	TokensOut   *int
+}
+
+// Validate checks an event before it's stored, so one bad event doesn't
+// fail the batch it's written in
+func (e *TraceEventInput) Validate() error {
+	switch {
+	case e.EventType == "" || len(e.EventType) > 50:
+		return fmt.Errorf("%w: event type must be 1-50 characters", ErrInvalidWorkerReport)
+	case len(e.Model) > 100:
+		return fmt.Errorf("%w: model must be at most 100 characters", ErrInvalidWorkerReport)
+	case !isJSONObject(e.EventData):
+		return fmt.Errorf("%w: event data must be a JSON object", ErrInvalidWorkerReport)
+	case e.DurationMs != nil && *e.DurationMs < 0,
+		e.TokensIn != nil && *e.TokensIn < 0,
+		e.TokensOut != nil && *e.TokensOut < 0:
+		return fmt.Errorf("%w: durations and token counts can't be negative", ErrInvalidWorkerReport)
+	}
+	if !e.Timestamp.IsZero() {
+		if skew := time.Since(e.Timestamp).Abs(); skew > maxTraceEventSkew {
+			return fmt.Errorf("%w: timestamp must be within %s of server time", ErrInvalidWorkerReport, maxTraceEventSkew)
+		}
+	}
+	return nil
+}
+
+// InsertTraceEvents stores a batch of validated trace events, all or none.
+// Events of unknown executions fail the batch with ErrNotFound.
+func (s *WorkerStateService) InsertTraceEvents(ctx context.Context, events []TraceEventInput) error {
+	if len(events) == 0 {
+		return nil
+	}
+	batch := &pgx.Batch{}
+	for _, e := range events {
+		var timestamp *time.Time
+		if !e.Timestamp.IsZero() {
+			timestamp = &e.Timestamp
+		}
+		batch.Queue(`
+			INSERT INTO agent_trace_events
+				(execution_id, event_type, event_data, timestamp, duration_ms, model, tokens_in, tokens_out)
+			VALUES ($1, $2, $3, COALESCE($4, NOW()), $5, NULLIF($6, ''), $7, $8)
+		`, e.ExecutionID, e.EventType, e.EventData, timestamp, e.DurationMs, e.Model, e.TokensIn, e.TokensOut)
+	}
+
+	// A batch runs in one implicit transaction
+	if err := s.db.Pool.SendBatch(ctx, batch).Close(); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrNotFound
+		}
+		return fmt.Errorf("failed to insert trace events: %w", err)
+	}
+	return nil
+}
+
+// SaveCheckpoint stores an execution's checkpoint and token totals
+func (s *WorkerStateService) SaveCheckpoint(ctx context.Context, executionID uuid.UUID, checkpoint json.RawMessage, tokensIn, tokensOut int) error {
+	if !isJSONObject(checkpoint) {
+		return fmt.Errorf("%w: checkpoint must be a JSON object", ErrInvalidWorkerReport)
+	}
+	if tokensIn < 0 || tokensOut < 0 {
+		return fmt.Errorf("%w: token counts can't be negative", ErrInvalidWorkerReport)
+	}
+
+	tag, err := s.db.Pool.Exec(ctx, `
+		UPDATE agent_executions
+		SET langgraph_checkpoint = $2, total_tokens_in = $3, total_tokens_out = $4
+		WHERE id = $1
+	`, executionID, checkpoint, tokensIn, tokensOut)
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// WorkerCheckpoint is the state a worker resumes an execution from
+type WorkerCheckpoint struct {
+	Checkpoint json.RawMessage // nil without one
+	Status     string
+	TokensIn   int
+	TokensOut  int
+}
+
+// GetCheckpoint returns an execution's checkpoint, status and token totals
+func (s *WorkerStateService) GetCheckpoint(ctx context.Context, executionID uuid.UUID) (*WorkerCheckpoint, error) {
+	var cp WorkerCheckpoint
+	err := s.db.Pool.QueryRow(ctx, `
+		SELECT langgraph_checkpoint, status, COALESCE(total_tokens_in, 0), COALESCE(total_tokens_out, 0)
+		FROM agent_executions
+		WHERE id = $1
+	`, executionID).Scan(&cp.Checkpoint, &cp.Status, &cp.TokensIn, &cp.TokensOut)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get checkpoint: %w", err)
+	}
+	return &cp, nil
+}
+
+// FileResult is a file processor's report of a file's status. Status is
+// fileprocessor's processing, processed or failed.
+type FileResult struct {
+	FileID        uuid.UUID
+	Status        string
+	ExtractedText string
+	Embedding     []float32
+	Error         string
+}
+
+// RecordFileResult stores a file's processing status, with its text and
+// embedding once processed, and returns the file's org and name
+func (s *WorkerStateService) RecordFileResult(ctx context.Context, r FileResult) (*models.File, error) {
+	if len(r.Embedding) > 0 && len(r.Embedding) != embeddingDimensions {
+		return nil, fmt.Errorf("%w: embeddings must have %d dimensions", ErrInvalidWorkerReport, embeddingDimensions)
+	}
+
+	file := &models.File{ID: r.FileID}
+	var err error
+	switch r.Status {
+	case "processing":
+		err = s.db.Pool.QueryRow(ctx, `
+			UPDATE files SET processing_status = 'processing', processing_error = NULL
+			WHERE id = $1
+			RETURNING org_id, filename
+		`, r.FileID).Scan(&file.OrgID, &file.Filename)
+	case "processed":
+		var embedding *string
+		if len(r.Embedding) > 0 {
+			formatted := formatEmbedding(r.Embedding)
+			embedding = &formatted
+		}
+		err = s.db.Pool.QueryRow(ctx, `
+			UPDATE files
+			SET processing_status = 'complete', processing_error = NULL, extracted_text = $2,
+				embedding = COALESCE($3::vector, embedding)
+			WHERE id = $1
+			RETURNING org_id, filename
+		`, r.FileID, truncateChars(r.ExtractedText, maxExtractedTextChars), embedding).Scan(&file.OrgID, &file.Filename)
+	case "failed":
+		err = s.db.Pool.QueryRow(ctx, `
+			UPDATE files SET processing_status = 'failed', processing_error = $2
+			WHERE id = $1
+			RETURNING org_id, filename
+		`, r.FileID, r.Error).Scan(&file.OrgID, &file.Filename)
+	default:
+		return nil, fmt.Errorf("%w: unknown file status %q", ErrInvalidWorkerReport, r.Status)
+	}
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record file result: %w", err)
+	}
+	return file, nil
+}
+
+// isJSONObject reports whether data is a JSON object
+func isJSONObject(data []byte) bool {
+	var obj map[string]json.RawMessage
+	return json.Unmarshal(data, &obj) == nil && obj != nil
+}
+
+// formatEmbedding writes a vector in pgvector's text format
+func formatEmbedding(vector []float32) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(float64(v), 'f', -1, 32)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+// truncateChars cuts s to at most n characters, not bytes
+func truncateChars(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
@@ -3,21 +3,23 @@ package storage
 import (
 	"context"
 	"fmt"
+	"io"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/glassbox/api/internal/config"
+	"github.com/glassbox/api/internal/telemetry"
 	"go.uber.org/zap"
 )
 
 // S3Client wraps the AWS S3 client with helper methods
 type S3Client struct {
-	client       *s3.Client
+	client        *s3.Client
 	presignClient *s3.PresignClient
-	bucket       string
-	logger       *zap.Logger
+	bucket        string
+	logger        *zap.Logger
 }
 
 // NewS3Client creates a new S3 client configured for the environment
@@ -31,6 +33,7 @@ func NewS3Client(cfg *config.Config, logger *zap.Logger) (*S3Client, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to load AWS config: %w", err)
 	}
+	telemetry.InstrumentAWS(&awsCfg)
 
 	// Create S3 client with LocalStack endpoint for development
 	var client *s3.Client
@@ -47,10 +50,10 @@ func NewS3Client(cfg *config.Config, logger *zap.Logger) (*S3Client, error) {
 	presignClient := s3.NewPresignClient(client)
 
 	return &S3Client{
-		client:       client,
+		client:        client,
 		presignClient: presignClient,
-		bucket:       cfg.S3Bucket,
-		logger:       logger,
+		bucket:        cfg.S3Bucket,
+		logger:        logger,
 	}, nil
 }
 
@@ -98,6 +101,24 @@ func (s *S3Client) HeadObject(ctx context.Context, key string) (int64, error) {
 	return size, nil
 }
 
+// GetObject reads up to maxBytes of an object's content
+func (s *S3Client) GetObject(ctx context.Context, key string, maxBytes int64) ([]byte, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get object: %w", err)
+	}
+	defer output.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(output.Body, maxBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+	return data, nil
+}
+
 // DeleteObject deletes an object from S3
 func (s *S3Client) DeleteObject(ctx context.Context, key string) error {
 	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
@@ -110,6 +131,17 @@ func (s *S3Client) DeleteObject(ctx context.Context, key string) error {
 	return nil
 }
 
+// HeadBucket checks that the bucket exists and is accessible
+func (s *S3Client) HeadBucket(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to head bucket: %w", err)
+	}
+	return nil
+}
+
 // Bucket returns the configured bucket name
 func (s *S3Client) Bucket() string {
 	return s.bucket
@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentAWS adds a client span around every AWS SDK operation (S3, SQS, ...)
+func InstrumentAWS(cfg *aws.Config) {
+	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
+		return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("OTelSpan",
+			func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+				service := awsmiddleware.GetServiceID(ctx)
+				operation := awsmiddleware.GetOperationName(ctx)
+
+				ctx, span := Tracer().Start(ctx, service+"."+operation,
+					trace.WithSpanKind(trace.SpanKindClient),
+					trace.WithAttributes(
+						attribute.String("rpc.system", "aws-api"),
+						attribute.String("rpc.service", service),
+						attribute.String("rpc.method", operation),
+					),
+				)
+				defer span.End()
+
+				out, metadata, err := next.HandleInitialize(ctx, in)
+				if err != nil {
+					span.RecordError(err)
+					span.SetStatus(codes.Error, err.Error())
+				}
+				return out, metadata, err
+			}), middleware.Before)
+	})
+}
@@ -0,0 +1,87 @@
+package telemetry
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetricsSource is anything that reports metrics on the metrics endpoint
+type MetricsSource interface {
+	WriteMetrics(w *MetricsWriter)
+}
+
+// MetricsWriter writes metrics in the Prometheus text exposition format.
+// Each call writes one metric family; write errors are kept and returned by
+// Err so sources don't need to check them.
+type MetricsWriter struct {
+	w   io.Writer
+	err error
+}
+
+func NewMetricsWriter(w io.Writer) *MetricsWriter {
+	return &MetricsWriter{w: w}
+}
+
+// Sample is one value of a metric family
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// Gauge writes a metric whose value can go up and down
+func (m *MetricsWriter) Gauge(name, help string, samples ...Sample) {
+	m.family(name, help, "gauge", samples)
+}
+
+// Counter writes a metric that only increases
+func (m *MetricsWriter) Counter(name, help string, samples ...Sample) {
+	m.family(name, help, "counter", samples)
+}
+
+// Err returns the first write error
+func (m *MetricsWriter) Err() error {
+	return m.err
+}
+
+func (m *MetricsWriter) family(name, help, kind string, samples []Sample) {
+	if len(samples) == 0 {
+		return
+	}
+	m.printf("# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, s := range samples {
+		m.printf("%s%s %s\n", name, formatLabels(s.Labels), strconv.FormatFloat(s.Value, 'g', -1, 64))
+	}
+}
+
+func (m *MetricsWriter) printf(format string, args ...any) {
+	if m.err == nil {
+		_, m.err = fmt.Fprintf(m.w, format, args...)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, name, labelEscaper.Replace(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Clients that connect with ?acks=1 acknowledge critical events by echoing
+// their messageId. Unacknowledged events are redelivered with backoff, so a
+// full send buffer delays them instead of losing them. A client that stays
+// too far behind is disconnected; on reconnect it catches up via replay.
+const (
+	ackRedeliveryBase = 3 * time.Second
+	ackCheckInterval  = 1 * time.Second
+	maxAckAttempts    = 5
+	maxPendingAcks    = 128
+)
+
+// criticalMessageTypes are tracked until acknowledged. Losing one leaves the
+// UI wrong until the next refetch (a node shown locked forever, an execution
+// stuck on "running", an approval request never seen).
+var criticalMessageTypes = map[MessageType]bool{
+	MsgTypeLockAcquired:        true,
+	MsgTypeLockReleased:        true,
+	MsgTypeExecutionUpdate:     true,
+	MsgTypeSubscriptionRevoked: true,
+	MsgTypeUserMessage:         true,
+}
+
+// AckPayload acknowledges a critical event
+type AckPayload struct {
+	MessageID string `json:"messageId"`
+}
+
+type pendingAck struct {
+	data     []byte
+	attempts int
+	nextAt   time.Time
+}
+
+// ackTracker holds a client's unacknowledged critical events
+type ackTracker struct {
+	mu      sync.Mutex
+	pending map[string]*pendingAck
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{pending: make(map[string]*pendingAck)}
+}
+
+// track records an event as awaiting acknowledgement. Returns false when the
+// client already has too many outstanding.
+func (t *ackTracker) track(messageID string, data []byte) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) >= maxPendingAcks {
+		return false
+	}
+	t.pending[messageID] = &pendingAck{data: data, attempts: 1, nextAt: time.Now().Add(ackRedeliveryBase)}
+	return true
+}
+
+func (t *ackTracker) ack(messageID string) {
+	t.mu.Lock()
+	delete(t.pending, messageID)
+	t.mu.Unlock()
+}
+
+// due returns the events to redeliver now, and false if any has used up its
+// attempts, in which case the client is being dropped and nothing stays pending
+func (t *ackTracker) due(now time.Time) ([][]byte, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var resend [][]byte
+	for _, p := range t.pending {
+		if now.Before(p.nextAt) {
+			continue
+		}
+		if p.attempts >= maxAckAttempts {
+			clear(t.pending)
+			return nil, false
+		}
+		p.attempts++
+		p.nextAt = now.Add(ackRedeliveryBase * time.Duration(p.attempts))
+		resend = append(resend, p.data)
+	}
+	return resend, true
+}
+
+// withMessageID returns msg stamped with a delivery ID if it is a critical
+// event that doesn't have one yet
+func withMessageID(msg *Message) *Message {
+	if !criticalMessageTypes[msg.Type] || msg.MessageID != "" {
+		return msg
+	}
+	stamped := *msg
+	stamped.MessageID = uuid.NewString()
+	return &stamped
+}
+
+// deliver queues data for the client, tracking critical events for clients
+// that acknowledge them. The caller must ensure client.send is still open.
+func (h *Hub) deliver(client *Client, msg *Message, data []byte) {
+	if client.acks != nil && msg.MessageID != "" {
+		if !client.acks.track(msg.MessageID, data) {
+			h.logger.Warn("Too many unacknowledged messages, disconnecting client",
+				zap.String("userId", client.UserID),
+			)
+			h.metrics.disconnects.Add(1)
+			client.close()
+			return
+		}
+	}
+
+	select {
+	case client.send <- data:
+	default:
+		// Client buffer is full; tracked events are redelivered later
+		h.metrics.messagesDropped.Add(1)
+		h.logger.Warn("Client send buffer full, skipping",
+			zap.String("userId", client.UserID),
+			zap.String("type", string(msg.Type)),
+		)
+	}
+}
+
+// redeliverUnacked periodically resends critical events clients haven't
+// acknowledged, and disconnects clients that never do
+func (h *Hub) redeliverUnacked() {
+	ticker := time.NewTicker(ackCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case now := <-ticker.C:
+			// Held for reading so unregisterClient can't close a send
+			// channel mid-redelivery
+			h.mu.RLock()
+			for client := range h.clients {
+				if client.acks == nil {
+					continue
+				}
+				resend, ok := client.acks.due(now)
+				if !ok {
+					h.logger.Warn("Client did not acknowledge messages, disconnecting",
+						zap.String("userId", client.UserID),
+					)
+					h.metrics.disconnects.Add(1)
+					client.conn.Close()
+					continue
+				}
+				h.metrics.redeliveries.Add(uint64(len(resend)))
+				for _, data := range resend {
+					select {
+					case client.send <- data:
+					default:
+						h.metrics.messagesDropped.Add(1)
+					}
+				}
+			}
+			h.mu.RUnlock()
+		}
+	}
+}
@@ -20,11 +20,40 @@ type Broadcaster interface {
 
 	// Execution events
 	BroadcastExecutionUpdate(nodeID, executionID uuid.UUID, status string, tokensIn, tokensOut int, traceSummary string)
+	BroadcastExecutionProgress(progress ExecutionProgressPayload)
+
+	// Org events
+	BroadcastMembershipChanged(orgID, userID uuid.UUID, change, role, changedBy string)
+	BroadcastNotification(orgID uuid.UUID, notification NotificationPayload)
+	PushNotification(userID uuid.UUID, notification NotificationPayload, unreadCount int)
+	BroadcastQuotaWarning(orgID uuid.UUID, quota string, used, limit int64)
+
+	// File events
+	BroadcastFileProcessing(update FileProcessingPayload)
+
+	// Direct messages to a user, such as approval requests and mentions
+	SendUserMessage(userID uuid.UUID, message UserMessagePayload)
+
+	// Access changes
+	RevokeMembership(orgID, userID uuid.UUID)
+	RevalidateAccess(userID uuid.UUID)
 }
 
 // Ensure Hub implements Broadcaster
 var _ Broadcaster = (*Hub)(nil)
 
+// Realtime is the hub as the rest of the API uses it. Handlers and services
+// depend on it, or on the narrower interfaces it combines, rather than on
+// *Hub, so tests can substitute wstest.Recorder or an in-memory wstest.Hub.
+type Realtime interface {
+	Broadcaster
+	PresenceReader
+	StatsReader
+}
+
+// Ensure Hub implements Realtime
+var _ Realtime = (*Hub)(nil)
+
 // BroadcastNodeCreated broadcasts a node creation event
 func (h *Hub) BroadcastNodeCreated(projectID, nodeID uuid.UUID, title, status, updatedBy string) {
 	msg := NewMessage(MsgTypeNodeCreated, NodeEventPayload{
@@ -92,6 +121,79 @@ func (h *Hub) BroadcastExecutionUpdate(nodeID, executionID uuid.UUID, status str
 		TraceSummary:   traceSummary,
 	})
 	h.BroadcastToNode(nodeID, msg)
+	h.BroadcastToExecution(executionID, msg)
+}
+
+// BroadcastExecutionProgress broadcasts a step starting or finishing to the
+// execution's channel. Node subscribers only get status changes.
+func (h *Hub) BroadcastExecutionProgress(progress ExecutionProgressPayload) {
+	h.BroadcastToExecution(progress.ExecutionID, NewMessage(MsgTypeExecutionProgress, progress))
+}
+
+// BroadcastMembershipChanged broadcasts a member being added, removed or
+// changing role. Pair removals with RevokeMembership.
+func (h *Hub) BroadcastMembershipChanged(orgID, userID uuid.UUID, change, role, changedBy string) {
+	msg := NewMessage(MsgTypeMembershipChanged, MembershipEventPayload{
+		OrgID:     orgID,
+		UserID:    userID,
+		Change:    change,
+		Role:      role,
+		ChangedBy: changedBy,
+	})
+	h.BroadcastToOrg(orgID, msg)
+}
+
+// BroadcastNotification broadcasts a notification to an org's members
+func (h *Hub) BroadcastNotification(orgID uuid.UUID, notification NotificationPayload) {
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	h.BroadcastToOrg(orgID, NewMessage(MsgTypeNotification, notification))
+}
+
+// PushNotification delivers a notification to one user's connected clients
+// with their new unread count
+func (h *Hub) PushNotification(userID uuid.UUID, notification NotificationPayload, unreadCount int) {
+	if notification.CreatedAt.IsZero() {
+		notification.CreatedAt = time.Now()
+	}
+	notification.UserID = &userID
+	notification.UnreadCount = &unreadCount
+	h.SendToUser(userID, NewMessage(MsgTypeNotification, notification))
+}
+
+// BroadcastQuotaWarning broadcasts that an org is nearing or over a quota
+func (h *Hub) BroadcastQuotaWarning(orgID uuid.UUID, quota string, used, limit int64) {
+	percent := 100
+	if limit > 0 {
+		percent = int(used * 100 / limit)
+	}
+	msg := NewMessage(MsgTypeQuotaWarning, QuotaWarningPayload{
+		OrgID:   orgID,
+		Quota:   quota,
+		Used:    used,
+		Limit:   limit,
+		Percent: percent,
+	})
+	h.BroadcastToOrg(orgID, msg)
+}
+
+// BroadcastFileProcessing broadcasts a file's processing status to the
+// org's files channel
+func (h *Hub) BroadcastFileProcessing(update FileProcessingPayload) {
+	channel := (&Channel{Type: ChannelOrg, ID: update.OrgID, Scope: ChannelScopeFiles}).String()
+	msg := h.recordEvent(channel, NewMessage(MsgTypeFileProcessing, update))
+	h.Broadcast(channel, msg)
+	h.publishToRedis(channel, msg)
+}
+
+// SendUserMessage sends a message to every connection of a user, on any
+// instance, without them subscribing to anything
+func (h *Hub) SendUserMessage(userID uuid.UUID, message UserMessagePayload) {
+	if message.SentAt.IsZero() {
+		message.SentAt = time.Now()
+	}
+	h.SendToUser(userID, NewMessage(MsgTypeUserMessage, message))
 }
 
 // NopBroadcaster is a no-op implementation of Broadcaster for testing or when WS is disabled
@@ -107,3 +209,14 @@ func (n *NopBroadcaster) BroadcastLockAcquired(nodeID uuid.UUID, lockedBy, userE
 func (n *NopBroadcaster) BroadcastLockReleased(nodeID uuid.UUID, releasedBy string) {}
 func (n *NopBroadcaster) BroadcastExecutionUpdate(nodeID, executionID uuid.UUID, status string, tokensIn, tokensOut int, traceSummary string) {
 }
+func (n *NopBroadcaster) RevokeMembership(orgID, userID uuid.UUID)                     {}
+func (n *NopBroadcaster) RevalidateAccess(userID uuid.UUID)                            {}
+func (n *NopBroadcaster) BroadcastExecutionProgress(progress ExecutionProgressPayload) {}
+func (n *NopBroadcaster) BroadcastMembershipChanged(orgID, userID uuid.UUID, change, role, changedBy string) {
+}
+func (n *NopBroadcaster) BroadcastNotification(orgID uuid.UUID, notification NotificationPayload) {}
+func (n *NopBroadcaster) PushNotification(userID uuid.UUID, notification NotificationPayload, unreadCount int) {
+}
+func (n *NopBroadcaster) BroadcastQuotaWarning(orgID uuid.UUID, quota string, used, limit int64) {}
+func (n *NopBroadcaster) BroadcastFileProcessing(update FileProcessingPayload)                   {}
+func (n *NopBroadcaster) SendUserMessage(userID uuid.UUID, message UserMessagePayload)           {}
@@ -2,8 +2,11 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
@@ -18,11 +21,15 @@ const (
 	// Send pings to peer with this period (must be less than pongWait)
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer
-	maxMessageSize = 8192
+	// Maximum message size allowed from peer; large enough for a base64
+	// document snapshot
+	maxMessageSize = 384 << 10
 
 	// Send buffer size
 	sendBufferSize = 256
+
+	// Maximum length of the field name in a presence update
+	maxPresenceFieldLength = 128
 )
 
 // Client represents a WebSocket connection
@@ -35,28 +42,88 @@ type Client struct {
 	// Buffered channel of outbound messages
 	send chan []byte
 
-	// User information
+	// Connection and user information. OrgID is the org the connection
+	// token was issued for, if any. IP is the client's address, empty for
+	// in-process connections.
+	ID        string
 	UserID    string
 	UserEmail string
+	OrgID     string
+	IP        string
+
+	// Subscribed channels and the org that owns each
+	subscriptions map[string]uuid.UUID
+
+	// Coalesces outgoing presence updates
+	presence *presenceThrottle
+
+	// Nodes this connection has announced presence on; guarded by Hub.mu
+	presenceNodes map[string]bool
+
+	// Node edit authorizations and when they expire. Only touched by ReadPump.
+	docEditGrants map[uuid.UUID]time.Time
+
+	// Unacknowledged critical events; nil unless the client opted into acks
+	acks *ackTracker
+
+	// Inbound rate limit. Only touched by ReadPump.
+	limiter *inboundLimiter
+
+	// Token identifying the session this connection saves its
+	// subscriptions under; guarded by Hub.mu
+	session string
+
+	// Sends MessagePack binary frames instead of JSON
+	msgpack bool
+
+	// Outbound frames at least this large are compressed; 0 when
+	// compression is off. See compression.go.
+	compressMin int
+
+	// Unix nanoseconds of the last message from the client other than a
+	// ping or ack; the connection is closed once idle for too long
+	activity atomic.Int64
 
-	// Subscribed channels
-	subscriptions map[string]bool
+	// Unix nanoseconds when the session expires unless refreshed; 0 if
+	// never. See tokens.go.
+	sessionExpiry atomic.Int64
+	validateToken TokenValidator
 
 	// Logger
 	logger *zap.Logger
 }
 
 // NewClient creates a new WebSocket client
-func NewClient(hub *Hub, conn *websocket.Conn, userID, userEmail string, logger *zap.Logger) *Client {
-	return &Client{
+func NewClient(hub *Hub, conn *websocket.Conn, userID, userEmail, orgID string, logger *zap.Logger) *Client {
+	c := &Client{
 		hub:           hub,
 		conn:          conn,
 		send:          make(chan []byte, sendBufferSize),
+		ID:            uuid.NewString(),
 		UserID:        userID,
 		UserEmail:     userEmail,
-		subscriptions: make(map[string]bool),
+		OrgID:         orgID,
+		subscriptions: make(map[string]uuid.UUID),
+		presence:      newPresenceThrottle(),
+		presenceNodes: make(map[string]bool),
+		docEditGrants: make(map[uuid.UUID]time.Time),
+		limiter:       newInboundLimiter(),
 		logger:        logger,
 	}
+	c.activity.Store(time.Now().UnixNano())
+	return c
+}
+
+// EnableAcks makes the client acknowledge critical events, which are
+// redelivered until it does. Call before registering the client.
+func (c *Client) EnableAcks() {
+	c.acks = newAckTracker()
+}
+
+// EnableMsgpack switches the client's outbound messages to MessagePack.
+// Call before registering the client.
+func (c *Client) EnableMsgpack() {
+	c.msgpack = true
 }
 
 // ReadPump pumps messages from the WebSocket connection to the hub
@@ -74,7 +141,7 @@ func (c *Client) ReadPump() {
 	})
 
 	for {
-		_, message, err := c.conn.ReadMessage()
+		frameType, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				c.logger.Warn("WebSocket read error",
@@ -85,6 +152,12 @@ func (c *Client) ReadPump() {
 			break
 		}
 
+		// Either encoding is accepted regardless of what the client receives
+		if frameType == websocket.BinaryMessage {
+			if message, err = decodeMsgpack(message); err != nil {
+				message = nil
+			}
+		}
 		c.handleMessage(message)
 	}
 }
@@ -107,17 +180,34 @@ func (c *Client) WritePump() {
 				return
 			}
 
-			w, err := c.conn.NextWriter(websocket.TextMessage)
-			if err != nil {
-				return
+			if c.msgpack {
+				if !c.writeBinary(message) {
+					return
+				}
+				continue
 			}
-			w.Write(message)
 
-			// Write any queued messages
+			// Queued messages go out in the same frame, which is
+			// compressed or not depending on its total size
+			batch := [][]byte{message}
+			size := len(message)
 			n := len(c.send)
 			for i := 0; i < n; i++ {
-				w.Write([]byte{'\n'})
-				w.Write(<-c.send)
+				queued := <-c.send
+				batch = append(batch, queued)
+				size += 1 + len(queued)
+			}
+			c.compressNext(size)
+
+			w, err := c.conn.NextWriter(websocket.TextMessage)
+			if err != nil {
+				return
+			}
+			for i, m := range batch {
+				if i > 0 {
+					w.Write([]byte{'\n'})
+				}
+				w.Write(m)
 			}
 
 			if err := w.Close(); err != nil {
@@ -133,19 +223,54 @@ func (c *Client) WritePump() {
 	}
 }
 
+// writeBinary writes a MessagePack message and any queued after it, one per
+// frame since MessagePack has no delimiter to batch on
+func (c *Client) writeBinary(message []byte) bool {
+	if !c.writeFrame(message) {
+		return false
+	}
+	n := len(c.send)
+	for i := 0; i < n; i++ {
+		if !c.writeFrame(<-c.send) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Client) writeFrame(message []byte) bool {
+	c.compressNext(len(message))
+	return c.conn.WriteMessage(websocket.BinaryMessage, message) == nil
+}
+
 // handleMessage processes incoming messages from the client
 func (c *Client) handleMessage(data []byte) {
 	msg, err := ParseMessage(data)
 	if err != nil {
-		c.sendError("parse_error", "Invalid message format")
+		// Unparseable messages count against the rate limit too
+		if c.admit(&Message{}) {
+			c.sendError("parse_error", "Invalid message format")
+		}
 		return
 	}
+	if !c.admit(msg) {
+		return
+	}
+	// Keepalives and acks are sent automatically, so they don't count as
+	// activity
+	if msg.Type != MsgTypePing && msg.Type != MsgTypeAck {
+		c.activity.Store(time.Now().UnixNano())
+	}
 
 	switch msg.Type {
 	case MsgTypeSubscribe:
 		c.handleSubscribe(msg)
 	case MsgTypeUnsubscribe:
 		c.handleUnsubscribe(msg)
+	case MsgTypeResume:
+		c.handleResume(msg)
+	case MsgTypeRefreshToken:
+		c.handleRefreshToken(msg)
 	case MsgTypePresence:
 		c.handlePresence(msg)
 	case MsgTypeLockAcquire:
@@ -154,6 +279,16 @@ func (c *Client) handleMessage(data []byte) {
 		c.handleLockRelease(msg)
 	case MsgTypePing:
 		c.handlePing(msg)
+	case MsgTypeAck:
+		c.handleAck(msg)
+	case MsgTypeDocSync:
+		c.handleDocSync(msg)
+	case MsgTypeDocUpdate:
+		c.handleDocUpdate(msg)
+	case MsgTypeDocCompact:
+		c.handleDocCompact(msg)
+	case MsgTypeDocAwareness:
+		c.handleDocAwareness(msg)
 	default:
 		c.sendError("unknown_type", "Unknown message type: "+string(msg.Type))
 	}
@@ -179,30 +314,72 @@ func (c *Client) handleSubscribe(msg *Message) {
 		return
 	}
 
-	// Subscribe to channel
-	if err := c.hub.Subscribe(c, payload.Channel); err != nil {
-		c.sendError("subscribe_failed", err.Error())
+	confirmation, replayed, err := c.subscribe(payload.Channel, payload.LastEventID)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrUnauthorized):
+			c.sendErrorFor(msg, "unauthorized", "Not authorized to subscribe to this channel")
+		case errors.Is(err, ErrInvalidChannel):
+			c.sendErrorFor(msg, "invalid_channel", err.Error())
+		default:
+			c.logger.Error("Failed to authorize subscription",
+				zap.String("userId", c.UserID),
+				zap.String("channel", payload.Channel),
+				zap.Error(err),
+			)
+			c.sendErrorFor(msg, "subscribe_failed", "Failed to subscribe")
+		}
 		return
 	}
-
-	// Get current users in channel
-	users := c.hub.GetChannelUsers(payload.Channel)
+	c.hub.saveSession(c)
 
 	// Send confirmation
-	response := NewMessage(MsgTypeSubscribed, SubscribedPayload{
-		Channel: payload.Channel,
-		Users:   users,
-	})
+	response := NewMessage(MsgTypeSubscribed, confirmation)
 	response.RequestID = msg.RequestID
 
 	c.sendMessage(response)
 
+	for _, event := range replayed {
+		c.sendMessage(event)
+	}
+
 	c.logger.Debug("Client subscribed",
 		zap.String("userId", c.UserID),
 		zap.String("channel", payload.Channel),
 	)
 }
 
+// subscribe adds the client to a channel and catches up on the events it
+// missed after lastEventID, if set. It returns the subscribed confirmation
+// and the events to send after it.
+func (c *Client) subscribe(channel, lastEventID string) (*SubscribedPayload, []*Message, error) {
+	if err := c.hub.Subscribe(c, channel); err != nil {
+		return nil, nil, err
+	}
+
+	confirmation := &SubscribedPayload{
+		Channel: channel,
+		Users:   c.hub.GetChannelUsers(channel),
+	}
+	if lastEventID == "" {
+		return confirmation, nil, nil
+	}
+
+	// The client is already subscribed, so an event may arrive both live
+	// and in the replay; clients dedupe by ID
+	replay, err := c.hub.Replay(channel, lastEventID)
+	if err != nil {
+		c.logger.Warn("Failed to replay channel events",
+			zap.String("channel", channel),
+			zap.Error(err),
+		)
+		replay = &ReplayResult{ResyncRequired: true}
+	}
+	confirmation.Replayed = len(replay.Messages)
+	confirmation.ResyncRequired = replay.ResyncRequired
+	return confirmation, replay.Messages, nil
+}
+
 // handleUnsubscribe processes unsubscription requests
 func (c *Client) handleUnsubscribe(msg *Message) {
 	payloadBytes, err := json.Marshal(msg.Payload)
@@ -224,6 +401,7 @@ func (c *Client) handleUnsubscribe(msg *Message) {
 
 	// Unsubscribe from channel
 	c.hub.Unsubscribe(c, payload.Channel)
+	c.hub.saveSession(c)
 
 	// Send confirmation
 	response := NewMessage(MsgTypeUnsubscribed, SubscribedPayload{
@@ -252,9 +430,30 @@ func (c *Client) handlePresence(msg *Message) {
 		c.sendError("invalid_node_id", "Node ID is required")
 		return
 	}
+	if len(payload.Field) > maxPresenceFieldLength {
+		c.sendError("invalid_payload", "Presence field is too long")
+		return
+	}
 
 	// Update presence
-	c.hub.UpdatePresence(c, payload.NodeID, payload.Action, payload.Position)
+	c.hub.UpdatePresence(c, payload)
+}
+
+// handleAck clears an acknowledged critical event
+func (c *Client) handleAck(msg *Message) {
+	if c.acks == nil {
+		return
+	}
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return
+	}
+	var payload AckPayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil || payload.MessageID == "" {
+		c.sendError("invalid_payload", "Invalid ack payload")
+		return
+	}
+	c.acks.ack(payload.MessageID)
 }
 
 // handleLockAcquire processes lock acquire requests
@@ -283,16 +482,31 @@ func (c *Client) handleLockRelease(msg *Message) {
 	c.sendError("use_rest_api", "Use REST API for lock operations. WebSocket will broadcast lock events.")
 }
 
-// handlePing processes ping requests
+// handlePing processes ping requests. Pings double as presence heartbeats.
 func (c *Client) handlePing(msg *Message) {
+	c.hub.touchPresence(c)
+
 	response := NewMessage(MsgTypePong, nil)
 	response.RequestID = msg.RequestID
 	c.sendMessage(response)
 }
 
+// lastActive returns when the client last sent a message other than a ping
+// or ack
+func (c *Client) lastActive() time.Time {
+	return time.Unix(0, c.activity.Load())
+}
+
 // sendMessage sends a message to the client
 func (c *Client) sendMessage(msg *Message) {
-	data, err := msg.ToJSON()
+	if c.acks != nil {
+		msg = withMessageID(msg)
+	}
+	encoded, err := newEncodedMessage(msg)
+	var data []byte
+	if err == nil {
+		data, err = encoded.forClient(c)
+	}
 	if err != nil {
 		c.logger.Error("Failed to marshal message",
 			zap.String("userId", c.UserID),
@@ -301,13 +515,7 @@ func (c *Client) sendMessage(msg *Message) {
 		return
 	}
 
-	select {
-	case c.send <- data:
-	default:
-		c.logger.Warn("Send buffer full, message dropped",
-			zap.String("userId", c.UserID),
-		)
-	}
+	c.hub.deliver(c, msg, data)
 }
 
 // sendError sends an error message to the client
@@ -318,3 +526,13 @@ func (c *Client) sendError(code, message string) {
 	})
 	c.sendMessage(msg)
 }
+
+// sendErrorFor sends an error in reply to a request, echoing its requestId
+func (c *Client) sendErrorFor(req *Message, code, message string) {
+	msg := NewMessage(MsgTypeError, ErrorPayload{
+		Code:    code,
+		Message: message,
+	})
+	msg.RequestID = req.RequestID
+	c.sendMessage(msg)
+}
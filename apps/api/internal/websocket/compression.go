@@ -0,0 +1,52 @@
+package websocket
+
+import (
+	"compress/flate"
+
+	"go.uber.org/zap"
+)
+
+// Trace and node payloads are repetitive JSON that deflates well, which
+// matters to clients on mobile connections. permessage-deflate is negotiated
+// with clients that offer it. Frames smaller than the threshold are sent
+// uncompressed since deflating them costs more CPU than it saves.
+const defaultCompressionMinBytes = 512
+
+// CompressionOptions configures permessage-deflate
+type CompressionOptions struct {
+	// flate level, from 1 (fastest) to 9 (smallest); 0 disables compression
+	Level int
+
+	// Outbound frames smaller than this are not compressed
+	MinBytes int
+}
+
+// SetCompression enables permessage-deflate for new connections. Call before
+// serving requests.
+func (h *Handler) SetCompression(opts CompressionOptions) {
+	if opts.Level != 0 && (opts.Level < flate.BestSpeed || opts.Level > flate.BestCompression) {
+		h.logger.Warn("Invalid WebSocket compression level, compression disabled", zap.Int("level", opts.Level))
+		opts.Level = 0
+	}
+	if opts.MinBytes <= 0 {
+		opts.MinBytes = defaultCompressionMinBytes
+	}
+	h.compression = opts
+	h.upgrader.EnableCompression = opts.Level != 0
+}
+
+// enableCompression compresses the client's outbound frames from the
+// threshold up. Has no effect unless the client negotiated permessage-deflate.
+// Call before registering the client.
+func (c *Client) enableCompression(opts CompressionOptions) {
+	c.conn.SetCompressionLevel(opts.Level)
+	c.compressMin = opts.MinBytes
+}
+
+// compressNext sets whether the next frame, of the given size, is
+// compressed. Only called from WritePump.
+func (c *Client) compressNext(size int) {
+	if c.compressMin > 0 {
+		c.conn.EnableWriteCompression(size >= c.compressMin)
+	}
+}
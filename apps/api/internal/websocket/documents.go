@@ -0,0 +1,255 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Collaborative editing relays CRDT updates between the editors of a node
+// field over the node channel, and keeps them in a DocumentStore so late
+// joiners can load the document. Clients must be subscribed to the node
+// channel; sending updates additionally requires edit access.
+const (
+	maxDocUpdateBytes    = 64 << 10
+	maxDocSnapshotBytes  = 256 << 10
+	maxDocAwarenessBytes = 8 << 10
+
+	// doc_state suggests compaction once the log holds this many updates
+	docCompactThreshold = 200
+
+	documentTimeout = 5 * time.Second
+
+	// How long an edit authorization is reused for a connection
+	docEditGrantTTL = 30 * time.Second
+)
+
+// documentFields are the node fields that can be edited collaboratively.
+// Each must be a node column that doc_compact's text can be saved to.
+var documentFields = map[string]bool{
+	"description": true,
+}
+
+// DocumentStore persists the update log of collaboratively edited fields
+type DocumentStore interface {
+	LoadDocument(ctx context.Context, nodeID uuid.UUID, field string) (updates [][]byte, seq int64, err error)
+	AppendDocumentUpdate(ctx context.Context, nodeID uuid.UUID, field string, update []byte, userID uuid.UUID) (seq int64, err error)
+	CompactDocument(ctx context.Context, nodeID uuid.UUID, field string, snapshot []byte, throughSeq int64, text *string, userID uuid.UUID) error
+}
+
+// DocumentAuthorizer decides whether a user, connected from clientIP, may
+// edit a node's documents. It returns ErrUnauthorized when access is denied.
+type DocumentAuthorizer func(ctx context.Context, userID, clientIP string, nodeID uuid.UUID) error
+
+// SetDocumentStore enables collaborative editing. Without it doc_* messages
+// are rejected.
+func (h *Hub) SetDocumentStore(store DocumentStore, authorizeEdit DocumentAuthorizer) {
+	h.documents = store
+	h.authorizeEdit = authorizeEdit
+}
+
+// isSubscribed reports whether the client is subscribed to channel
+func (h *Hub) isSubscribed(client *Client, channel string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := client.subscriptions[channel]
+	return ok
+}
+
+// relay sends an unrecorded message to a channel's subscribers on every
+// instance, except the sending client
+func (h *Hub) relay(channel string, msg *Message, exclude *Client) {
+	select {
+	case h.broadcast <- &BroadcastMessage{Channel: channel, Message: msg, Exclude: exclude}:
+	case <-h.ctx.Done():
+		return
+	}
+	h.publishToRedis(channel, msg)
+}
+
+// parseDocPayload decodes and checks a doc_* message. On failure the client
+// has been sent an error.
+func (c *Client) parseDocPayload(msg *Message) (*DocPayload, uuid.UUID, bool) {
+	if c.hub.documents == nil {
+		c.sendErrorFor(msg, "not_supported", "Collaborative editing is not enabled")
+		return nil, uuid.Nil, false
+	}
+
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil {
+		c.sendErrorFor(msg, "invalid_payload", "Invalid document payload")
+		return nil, uuid.Nil, false
+	}
+	var payload DocPayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil {
+		c.sendErrorFor(msg, "invalid_payload", "Invalid document payload")
+		return nil, uuid.Nil, false
+	}
+
+	nodeID, err := uuid.Parse(payload.NodeID)
+	if err != nil {
+		c.sendErrorFor(msg, "invalid_node_id", "Invalid node ID")
+		return nil, uuid.Nil, false
+	}
+	payload.NodeID = nodeID.String()
+	if !documentFields[payload.Field] {
+		c.sendErrorFor(msg, "invalid_field", "Field cannot be edited collaboratively")
+		return nil, uuid.Nil, false
+	}
+	if !c.hub.isSubscribed(c, "node:"+payload.NodeID) {
+		c.sendErrorFor(msg, "not_subscribed", "Subscribe to the node before editing its documents")
+		return nil, uuid.Nil, false
+	}
+
+	return &payload, nodeID, true
+}
+
+// canEdit checks edit access to a node, reusing a recent grant
+func (c *Client) canEdit(msg *Message, nodeID uuid.UUID) bool {
+	if expiry, ok := c.docEditGrants[nodeID]; ok && time.Now().Before(expiry) {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, authorizeTimeout)
+	err := c.hub.authorizeEdit(ctx, c.UserID, c.IP, nodeID)
+	cancel()
+	if errors.Is(err, ErrUnauthorized) {
+		c.sendErrorFor(msg, "unauthorized", "Not authorized to edit this node")
+		return false
+	}
+	if err != nil {
+		c.logger.Error("Failed to authorize document edit", zap.String("nodeId", nodeID.String()), zap.Error(err))
+		c.sendErrorFor(msg, "doc_failed", "Failed to authorize edit")
+		return false
+	}
+
+	c.docEditGrants[nodeID] = time.Now().Add(docEditGrantTTL)
+	return true
+}
+
+// handleDocSync sends the stored state of a document
+func (c *Client) handleDocSync(msg *Message) {
+	payload, nodeID, ok := c.parseDocPayload(msg)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, documentTimeout)
+	updates, seq, err := c.hub.documents.LoadDocument(ctx, nodeID, payload.Field)
+	cancel()
+	if err != nil {
+		c.logger.Error("Failed to load document", zap.String("nodeId", payload.NodeID), zap.Error(err))
+		c.sendErrorFor(msg, "doc_failed", "Failed to load document")
+		return
+	}
+
+	response := NewMessage(MsgTypeDocState, DocStatePayload{
+		NodeID:           payload.NodeID,
+		Field:            payload.Field,
+		Updates:          updates,
+		Seq:              seq,
+		CompactSuggested: len(updates) > docCompactThreshold,
+	})
+	response.RequestID = msg.RequestID
+	c.sendMessage(response)
+}
+
+// handleDocUpdate stores an update and relays it to the node's other editors
+func (c *Client) handleDocUpdate(msg *Message) {
+	payload, nodeID, ok := c.parseDocPayload(msg)
+	if !ok {
+		return
+	}
+	if len(payload.Update) == 0 || len(payload.Update) > maxDocUpdateBytes {
+		c.sendErrorFor(msg, "invalid_payload", "Document update is empty or too large")
+		return
+	}
+	if !c.canEdit(msg, nodeID) {
+		return
+	}
+	userID, err := uuid.Parse(c.UserID)
+	if err != nil {
+		c.sendErrorFor(msg, "unauthorized", "Invalid user")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, documentTimeout)
+	seq, err := c.hub.documents.AppendDocumentUpdate(ctx, nodeID, payload.Field, payload.Update, userID)
+	cancel()
+	if err != nil {
+		c.logger.Error("Failed to store document update", zap.String("nodeId", payload.NodeID), zap.Error(err))
+		c.sendErrorFor(msg, "doc_failed", "Failed to store document update")
+		return
+	}
+
+	c.hub.relay("node:"+payload.NodeID, NewMessage(MsgTypeDocUpdate, DocEventPayload{
+		NodeID: payload.NodeID,
+		Field:  payload.Field,
+		Update: payload.Update,
+		Seq:    seq,
+		UserID: c.UserID,
+	}), c)
+
+	ack := NewMessage(MsgTypeDocAck, DocAckPayload{NodeID: payload.NodeID, Field: payload.Field, Seq: seq})
+	ack.RequestID = msg.RequestID
+	c.sendMessage(ack)
+}
+
+// handleDocCompact replaces the update log up to a sequence number with a
+// client-merged snapshot
+func (c *Client) handleDocCompact(msg *Message) {
+	payload, nodeID, ok := c.parseDocPayload(msg)
+	if !ok {
+		return
+	}
+	if len(payload.Update) == 0 || len(payload.Update) > maxDocSnapshotBytes || payload.ThroughSeq <= 0 ||
+		(payload.Text != nil && len(*payload.Text) > maxDocSnapshotBytes) {
+		c.sendErrorFor(msg, "invalid_payload", "Invalid document snapshot")
+		return
+	}
+	if !c.canEdit(msg, nodeID) {
+		return
+	}
+	userID, err := uuid.Parse(c.UserID)
+	if err != nil {
+		c.sendErrorFor(msg, "unauthorized", "Invalid user")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, documentTimeout)
+	err = c.hub.documents.CompactDocument(ctx, nodeID, payload.Field, payload.Update, payload.ThroughSeq, payload.Text, userID)
+	cancel()
+	if err != nil {
+		c.logger.Warn("Failed to compact document", zap.String("nodeId", payload.NodeID), zap.Error(err))
+		c.sendErrorFor(msg, "doc_failed", "Failed to compact document")
+		return
+	}
+
+	ack := NewMessage(MsgTypeDocAck, DocAckPayload{NodeID: payload.NodeID, Field: payload.Field, Seq: payload.ThroughSeq})
+	ack.RequestID = msg.RequestID
+	c.sendMessage(ack)
+}
+
+// handleDocAwareness relays ephemeral editor state (cursors, selections in
+// the CRDT's own coordinates) without storing it
+func (c *Client) handleDocAwareness(msg *Message) {
+	payload, _, ok := c.parseDocPayload(msg)
+	if !ok {
+		return
+	}
+	if len(payload.Update) == 0 || len(payload.Update) > maxDocAwarenessBytes {
+		c.sendErrorFor(msg, "invalid_payload", "Awareness update is empty or too large")
+		return
+	}
+
+	c.hub.relay("node:"+payload.NodeID, NewMessage(MsgTypeDocAwareness, DocEventPayload{
+		NodeID: payload.NodeID,
+		Field:  payload.Field,
+		Update: payload.Update,
+		UserID: c.UserID,
+	}), c)
+}
@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// On shutdown the hub drains: new upgrades are refused, every client is sent
+// server_shutdown with a hint of when to reconnect, and the hub waits for
+// them to leave before the process exits. Clients reconnect to another
+// instance and resume their sessions there. Hints are spread over a window
+// so they don't all reconnect at once.
+const (
+	drainReconnectAfter  = 1 * time.Second
+	drainReconnectSpread = 4 * time.Second
+	drainPollInterval    = 100 * time.Millisecond
+
+	CloseReasonServerShutdown = "server_shutdown"
+)
+
+// Draining reports whether the hub is shutting down and refusing connections
+func (h *Hub) Draining() bool {
+	return h.draining.Load()
+}
+
+// Drain tells every client the server is shutting down and waits until they
+// have disconnected or ctx is done, then closes any that remain. Call before
+// Stop; the hub must still be running.
+func (h *Hub) Drain(ctx context.Context) {
+	h.draining.Store(true)
+
+	// Held while sending so no client unregisters, closing its send
+	// channel, in the meantime
+	h.mu.RLock()
+	h.logger.Info("Draining WebSocket connections", zap.Int("clients", len(h.clients)))
+	for client := range h.clients {
+		after := drainReconnectAfter + rand.N(drainReconnectSpread)
+		client.sendMessage(NewMessage(MsgTypeServerShutdown, ServerShutdownPayload{
+			ReconnectAfterMs: after.Milliseconds(),
+		}))
+	}
+	h.mu.RUnlock()
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		remaining := h.clientList()
+		if len(remaining) == 0 {
+			h.logger.Info("WebSocket connections drained")
+			return
+		}
+
+		select {
+		case <-ticker.C:
+			continue
+		case <-ctx.Done():
+		}
+
+		h.logger.Warn("WebSocket drain timed out, closing remaining connections",
+			zap.Int("clients", len(remaining)),
+		)
+		for _, client := range remaining {
+			client.closeWith(websocket.CloseGoingAway, CloseReasonServerShutdown)
+		}
+		return
+	}
+}
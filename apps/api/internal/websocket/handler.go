@@ -3,23 +3,16 @@ package websocket
 import (
 	"context"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/glassbox/api/internal/apierror"
 	"github.com/glassbox/api/internal/database"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		// TODO: In production, validate origin against allowed origins
-		return true
-	},
-}
-
 // WSTokenData contains validated WS token information
 type WSTokenData struct {
 	UserID    string
@@ -31,30 +24,56 @@ type WSTokenData struct {
 // TokenValidator is a function type for validating WS tokens
 type TokenValidator func(ctx context.Context, token string) (*WSTokenData, error)
 
+// OriginChecker reports whether a browser Origin may open a connection for a user
+type OriginChecker func(ctx context.Context, userID, origin string) bool
+
 // Handler handles WebSocket upgrade requests
 type Handler struct {
 	hub           *Hub
 	redis         *database.Redis
 	logger        *zap.Logger
 	validateToken TokenValidator
+	checkOrigin   OriginChecker
+	upgrader      websocket.Upgrader
+	compression   CompressionOptions
 }
 
 // NewHandler creates a new WebSocket handler
-func NewHandler(hub *Hub, redis *database.Redis, validateToken TokenValidator, logger *zap.Logger) *Handler {
+func NewHandler(hub *Hub, redis *database.Redis, validateToken TokenValidator, checkOrigin OriginChecker, logger *zap.Logger) *Handler {
 	return &Handler{
 		hub:           hub,
 		redis:         redis,
 		logger:        logger,
 		validateToken: validateToken,
+		checkOrigin:   checkOrigin,
+		upgrader: websocket.Upgrader{
+			ReadBufferSize:  1024,
+			WriteBufferSize: 1024,
+			// Origin is validated in ServeWS before upgrading, once the token
+			// has identified the user (org-specific origins depend on it)
+			CheckOrigin: func(r *http.Request) bool { return true },
+		},
 	}
 }
 
 // ServeWS handles WebSocket upgrade requests
-// Expected: GET /ws?token=<ws_token>
+// Expected: GET /ws?token=<ws_token>[&acks=1][&encoding=msgpack]
 func (h *Handler) ServeWS(c *gin.Context) {
+	// Clients retry and reach another instance
+	if h.hub.Draining() {
+		c.Header("Retry-After", strconv.Itoa(int(drainReconnectAfter/time.Second)))
+		apierror.Respond(c, http.StatusServiceUnavailable, apierror.CodeUnavailable, "Server is shutting down")
+		return
+	}
+
 	token := c.Query("token")
 	if token == "" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token required"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeUnauthorized, "Token required")
+		return
+	}
+	encoding := c.DefaultQuery("encoding", EncodingJSON)
+	if encoding != EncodingJSON && encoding != EncodingMsgpack {
+		apierror.Respond(c, http.StatusBadRequest, apierror.CodeBadRequest, "Unsupported encoding")
 		return
 	}
 
@@ -62,21 +81,57 @@ func (h *Handler) ServeWS(c *gin.Context) {
 	tokenData, err := h.validateToken(c.Request.Context(), token)
 	if err != nil {
 		h.logger.Warn("Invalid WS token", zap.Error(err))
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		apierror.Respond(c, http.StatusUnauthorized, apierror.CodeInvalidToken, "Invalid or expired token")
+		return
+	}
+
+	// Reject cross-site upgrades. Browsers always send Origin; non-browser
+	// clients may omit it and are authenticated by the token alone.
+	if origin := c.GetHeader("Origin"); origin != "" && !h.checkOrigin(c.Request.Context(), tokenData.UserID, origin) {
+		h.logger.Warn("Rejected WebSocket origin",
+			zap.String("origin", origin),
+			zap.String("userId", tokenData.UserID),
+		)
+		apierror.Respond(c, http.StatusForbidden, apierror.CodeOriginNotAllowed, "Origin not allowed")
 		return
 	}
 
 	// Upgrade HTTP connection to WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		h.logger.Error("Failed to upgrade WebSocket connection", zap.Error(err))
 		return
 	}
 
 	// Create client
-	client := NewClient(h.hub, conn, tokenData.UserID, tokenData.UserEmail, h.logger)
+	client := NewClient(h.hub, conn, tokenData.UserID, tokenData.UserEmail, tokenData.OrgID, h.logger)
+	client.IP = c.ClientIP()
+
+	// Over-limit connections are refused with a close code rather than an
+	// HTTP error, since browsers don't expose the upgrade response
+	if reason := h.hub.admitConnection(client); reason != "" {
+		h.hub.metrics.connectionsLimited.Add(1)
+		h.logger.Info("Refused WebSocket connection over limit",
+			zap.String("userId", tokenData.UserID),
+			zap.String("orgId", tokenData.OrgID),
+			zap.String("reason", reason),
+		)
+		client.closeWith(CloseConnectionLimit, reason)
+		return
+	}
+	if c.Query("acks") == "1" {
+		client.EnableAcks()
+	}
+	if encoding == EncodingMsgpack {
+		client.EnableMsgpack()
+	}
+	if h.compression.Level != 0 {
+		client.enableCompression(h.compression)
+	}
+	client.EnableTokenRefresh(h.validateToken)
 
 	// Register with hub
+	client.startSession()
 	h.hub.register <- client
 
 	h.logger.Info("WebSocket connection established",
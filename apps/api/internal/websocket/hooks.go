@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Hooks let features such as analytics, audit logging and integrations
+// observe real-time activity without changes to the hub. Any field may be
+// nil.
+//
+// Hooks run on the goroutine that produced the event, outside the hub lock,
+// so they must return quickly and hand slow work off. A hook that panics is
+// recovered and logged. Events are reported by the instance they happen on:
+// a broadcast is observed where it was sent, not on each instance Redis
+// delivers it to.
+type Hooks struct {
+	OnSubscribe      func(SubscribeEvent)
+	OnPresenceChange func(PresenceEvent)
+	OnBroadcast      func(BroadcastEvent)
+}
+
+// SubscribeEvent is a client's successful subscription to a channel,
+// including those restored by resume
+type SubscribeEvent struct {
+	ClientID string
+	UserID   string
+	Channel  string
+	OrgID    uuid.UUID // org that owns the channel
+}
+
+// PresenceEvent is a user's presence change on a node. Action is "left" when
+// they disconnect or their presence expires.
+type PresenceEvent struct {
+	NodeID    string
+	UserID    string
+	UserEmail string
+	Action    string
+	Field     string
+}
+
+// BroadcastEvent is an event sent to a channel, or to every connection of a
+// user when UserID is set. Message is shared with the recipients and must not
+// be modified.
+type BroadcastEvent struct {
+	Channel string
+	UserID  string
+	Message *Message
+}
+
+// AddHooks registers hooks alongside any added before. Call before Run.
+func (h *Hub) AddHooks(hooks Hooks) {
+	h.hooks = append(h.hooks, hooks)
+}
+
+func (h *Hub) onSubscribe(e SubscribeEvent) {
+	for _, hooks := range h.hooks {
+		if hooks.OnSubscribe != nil {
+			h.runHook("subscribe", func() { hooks.OnSubscribe(e) })
+		}
+	}
+}
+
+func (h *Hub) onPresenceChange(e PresenceEvent) {
+	for _, hooks := range h.hooks {
+		if hooks.OnPresenceChange != nil {
+			h.runHook("presence", func() { hooks.OnPresenceChange(e) })
+		}
+	}
+}
+
+func (h *Hub) onBroadcast(e BroadcastEvent) {
+	for _, hooks := range h.hooks {
+		if hooks.OnBroadcast != nil {
+			h.runHook("broadcast", func() { hooks.OnBroadcast(e) })
+		}
+	}
+}
+
+func (h *Hub) runHook(event string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			h.logger.Error("WebSocket hook panicked",
+				zap.String("event", event),
+				zap.Any("panic", r),
+			)
+		}
+	}()
+	fn()
+}
+
+// presenceLeft reports that a user left a node
+func (h *Hub) presenceLeft(nodeID, userID, userEmail string) {
+	h.onPresenceChange(PresenceEvent{NodeID: nodeID, UserID: userID, UserEmail: userEmail, Action: "left"})
+}
@@ -5,9 +5,12 @@ import (
 	"encoding/json"
 	"errors"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/glassbox/api/internal/database"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
@@ -16,6 +19,24 @@ var (
 	ErrUnauthorized   = errors.New("unauthorized")
 )
 
+const (
+	// Redis pub/sub channel for control messages, which every instance
+	// receives. Events use shard channels; see routing.go.
+	redisControlChannel = "glassbox:ws:control"
+
+	// Upper bound on the authorization lookup when subscribing
+	authorizeTimeout = 5 * time.Second
+)
+
+// ChannelAuthorizer decides whether a user, connected from clientIP, may
+// subscribe to a channel and returns the org that owns it. It returns
+// ErrUnauthorized when access is denied (including when the resource does
+// not exist).
+type ChannelAuthorizer func(ctx context.Context, userID, clientIP string, ch *Channel) (orgID uuid.UUID, err error)
+
+// ProjectOrgResolver returns the org that owns a project
+type ProjectOrgResolver func(ctx context.Context, projectID uuid.UUID) (uuid.UUID, error)
+
 // Hub maintains active WebSocket connections and handles message routing
 type Hub struct {
 	// Registered clients
@@ -43,7 +64,38 @@ type Hub struct {
 	mu sync.RWMutex
 
 	// Redis for pub/sub across instances
-	redis *database.Redis
+	redis  *database.Redis
+	pubsub *redis.PubSub
+	shards *shardRouter
+
+	// Checks channel access on subscribe
+	authorize ChannelAuthorizer
+
+	// Routes project events to org:<id>:projects; nil disables it
+	projectOrg ProjectOrgResolver
+
+	// Connection caps and idle eviction; see limits.go
+	limits      ConnectionLimits
+	connections *connectionCounter
+
+	// Saved subscriptions for resuming; see session.go
+	sessions *sessionStore
+
+	// Set once shutdown begins; see drain.go
+	draining atomic.Bool
+
+	// Observers of real-time activity; see hooks.go
+	hooks []Hooks
+
+	// Collaborative editing; nil when disabled
+	documents     DocumentStore
+	authorizeEdit DocumentAuthorizer
+
+	// Tags messages this instance publishes to Redis so it can skip its own
+	instanceID string
+
+	// Counters reported by Stats
+	metrics hubMetrics
 
 	// Logger
 	logger *zap.Logger
@@ -55,13 +107,15 @@ type Hub struct {
 
 // PresenceInfo tracks user presence on a node
 type PresenceInfo struct {
-	UserID    string `json:"userId"`
-	UserEmail string `json:"userEmail"`
-	Action    string `json:"action"` // "viewing", "editing"
-	Position  *struct {
-		Line   int `json:"line,omitempty"`
-		Column int `json:"column,omitempty"`
-	} `json:"position,omitempty"`
+	UserID    string          `json:"userId"`
+	UserEmail string          `json:"userEmail"`
+	Action    string          `json:"action"` // "viewing", "editing"
+	Field     string          `json:"field,omitempty"`
+	Position  *CursorPosition `json:"position,omitempty"`
+	Selection *SelectionRange `json:"selection,omitempty"`
+	Typing    bool            `json:"typing,omitempty"`
+	// Last presence update or heartbeat; the entry expires presenceTTL later
+	LastSeen time.Time `json:"lastSeen"`
 }
 
 // BroadcastMessage is used to send messages to a channel
@@ -69,12 +123,14 @@ type BroadcastMessage struct {
 	Channel string
 	Message *Message
 	Exclude *Client // Optional: exclude this client from broadcast
+	// Set instead of Channel to send to every client of one user
+	UserID string
 }
 
 // NewHub creates a new Hub instance
-func NewHub(redis *database.Redis, logger *zap.Logger) *Hub {
+func NewHub(rdb *database.Redis, authorize ChannelAuthorizer, logger *zap.Logger) *Hub {
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Hub{
+	h := &Hub{
 		clients:       make(map[*Client]bool),
 		channels:      make(map[string]map[*Client]bool),
 		presence:      make(map[string]map[string]*PresenceInfo),
@@ -82,17 +138,37 @@ func NewHub(redis *database.Redis, logger *zap.Logger) *Hub {
 		register:      make(chan *Client),
 		unregister:    make(chan *Client),
 		broadcast:     make(chan *BroadcastMessage, 256),
-		redis:         redis,
+		redis:         rdb,
+		shards:        newShardRouter(),
+		authorize:     authorize,
+		connections:   newConnectionCounter(),
+		sessions:      newSessionStore(),
+		instanceID:    uuid.NewString(),
 		logger:        logger,
 		ctx:           ctx,
 		cancel:        cancel,
 	}
+	if rdb != nil {
+		// Starts with only the control channel; shards are added as clients
+		// subscribe
+		h.pubsub = rdb.Subscribe(ctx, redisControlChannel)
+	}
+	return h
 }
 
 // Run starts the hub's main loop
 func (h *Hub) Run() {
 	// Start Redis subscriber in a goroutine
 	go h.subscribeToRedis()
+	go h.pruneShards()
+	go h.refreshPresence()
+	go h.sweepPresence()
+	go h.redeliverUnacked()
+	go h.publishStats()
+	go h.refreshConnections()
+	go h.evictIdle()
+	go h.expireSessions()
+	go h.revalidateSubscriptions()
 
 	for {
 		select {
@@ -123,9 +199,14 @@ func (h *Hub) registerClient(client *Client) {
 
 	h.clients[client] = true
 
-	// Track by user ID
+	// Track by user ID, and listen for events addressed to the user once
+	// their first client connects here
 	if h.clientsByUser[client.UserID] == nil {
 		h.clientsByUser[client.UserID] = make(map[*Client]bool)
+		if h.shards.acquire(userRoute(client.UserID)) {
+			// Not inline: this runs on the hub loop
+			go h.syncShards(false)
+		}
 	}
 	h.clientsByUser[client.UserID][client] = true
 
@@ -144,18 +225,20 @@ func (h *Hub) unregisterClient(client *Client) {
 		return
 	}
 
+	// Keep the session so a reconnect can resume it
+	go h.storeSession(client.session, sessionSnapshot(client))
+
 	// Remove from all subscribed channels
 	for channel := range client.subscriptions {
-		if h.channels[channel] != nil {
-			delete(h.channels[channel], client)
-			if len(h.channels[channel]) == 0 {
-				delete(h.channels, channel)
-			}
-		}
+		h.removeFromChannel(client, channel)
 	}
 
 	// Remove presence from all nodes
+	var leftNodes []string
 	for nodeID := range h.presence {
+		if _, ok := h.presence[nodeID][client.UserID]; ok {
+			leftNodes = append(leftNodes, nodeID)
+		}
 		delete(h.presence[nodeID], client.UserID)
 		if len(h.presence[nodeID]) == 0 {
 			delete(h.presence, nodeID)
@@ -164,17 +247,21 @@ func (h *Hub) unregisterClient(client *Client) {
 			h.broadcastPresenceLeft(nodeID, client.UserID, client.UserEmail)
 		}
 	}
+	go h.departPresence(client.UserID, client.UserEmail, leftNodes)
 
 	// Remove from user tracking
 	if h.clientsByUser[client.UserID] != nil {
 		delete(h.clientsByUser[client.UserID], client)
 		if len(h.clientsByUser[client.UserID]) == 0 {
 			delete(h.clientsByUser, client.UserID)
+			h.shards.release(userRoute(client.UserID))
 		}
 	}
 
 	delete(h.clients, client)
 	close(client.send)
+	client.presence.stop()
+	go h.releaseConnection(client)
 
 	h.logger.Info("Client unregistered",
 		zap.String("userId", client.UserID),
@@ -182,31 +269,56 @@ func (h *Hub) unregisterClient(client *Client) {
 	)
 }
 
-// Subscribe adds a client to a channel
-func (h *Hub) Subscribe(client *Client, channel string) error {
-	h.mu.Lock()
-	defer h.mu.Unlock()
+// clientList returns the registered clients
+func (h *Hub) clientList() []*Client {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
 
+// Subscribe adds a client to a channel once the client's user is authorized
+// for it. Returns ErrUnauthorized when access is denied.
+func (h *Hub) Subscribe(client *Client, channel string) error {
 	// Validate channel format
 	ch, err := ParseChannel(channel)
 	if err != nil {
 		return err
 	}
 
-	// TODO: Verify client has access to this channel (project/node membership)
+	// Checked before taking the lock: authorization may hit Redis or Postgres
+	ctx, cancel := context.WithTimeout(h.ctx, authorizeTimeout)
+	orgID, err := h.authorize(ctx, client.UserID, client.IP, ch)
+	cancel()
+	if err != nil {
+		return err
+	}
 
-	// Add to channel
-	if h.channels[channel] == nil {
-		h.channels[channel] = make(map[*Client]bool)
+	h.mu.Lock()
+	newShard := h.addToChannel(client, channel)
+	client.subscriptions[channel] = orgID
+	h.mu.Unlock()
+
+	// Listen on the channel's Redis shard before confirming, so events
+	// published on other instances from now on reach the client
+	if newShard {
+		h.syncShards(false)
 	}
-	h.channels[channel][client] = true
-	client.subscriptions[channel] = true
 
 	h.logger.Debug("Client subscribed to channel",
 		zap.String("userId", client.UserID),
 		zap.String("channel", channel),
-		zap.String("channelType", ch.Type),
+		zap.String("channelType", ch.Kind()),
 	)
+	h.onSubscribe(SubscribeEvent{
+		ClientID: client.ID,
+		UserID:   client.UserID,
+		Channel:  channel,
+		OrgID:    orgID,
+	})
 
 	return nil
 }
@@ -217,12 +329,7 @@ func (h *Hub) Unsubscribe(client *Client, channel string) {
 	defer h.mu.Unlock()
 
 	delete(client.subscriptions, channel)
-	if h.channels[channel] != nil {
-		delete(h.channels[channel], client)
-		if len(h.channels[channel]) == 0 {
-			delete(h.channels, channel)
-		}
-	}
+	h.removeFromChannel(client, channel)
 
 	h.logger.Debug("Client unsubscribed from channel",
 		zap.String("userId", client.UserID),
@@ -230,6 +337,40 @@ func (h *Hub) Unsubscribe(client *Client, channel string) {
 	)
 }
 
+// RevokeMembership drops a user's subscriptions to channels owned by an org,
+// on every instance. Call it after removing the user from the org (and
+// invalidating their cached role) so they stop receiving its events.
+func (h *Hub) RevokeMembership(orgID, userID uuid.UUID) {
+	h.revokeLocal(orgID, userID.String())
+	h.publishControl(ControlMessage{Type: ControlRevokeMembership, OrgID: orgID, UserID: userID})
+}
+
+// revokeLocal unsubscribes this instance's clients for the user from the
+// org's channels and tells them why
+func (h *Hub) revokeLocal(orgID uuid.UUID, userID string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clientsByUser[userID] {
+		for channel, channelOrg := range client.subscriptions {
+			if channelOrg != orgID {
+				continue
+			}
+			delete(client.subscriptions, channel)
+			h.removeFromChannel(client, channel)
+			client.sendMessage(NewMessage(MsgTypeSubscriptionRevoked, SubscriptionRevokedPayload{
+				Channel: channel,
+				Reason:  "membership_revoked",
+			}))
+		}
+	}
+
+	h.logger.Info("Revoked WebSocket subscriptions",
+		zap.String("userId", userID),
+		zap.String("orgId", orgID.String()),
+	)
+}
+
 // GetChannelUsers returns the user IDs/emails of users subscribed to a channel
 func (h *Hub) GetChannelUsers(channel string) []string {
 	h.mu.RLock()
@@ -250,53 +391,84 @@ func (h *Hub) GetChannelUsers(channel string) []string {
 	return users
 }
 
-// UpdatePresence updates a user's presence on a node
-func (h *Hub) UpdatePresence(client *Client, nodeID string, action string, position *struct {
-	Line   int `json:"line,omitempty"`
-	Column int `json:"column,omitempty"`
-}) {
+// UpdatePresence updates a user's presence on a node. Local state is updated
+// on every call; broadcasts and the Redis mirror are throttled per connection.
+func (h *Hub) UpdatePresence(client *Client, p PresencePayload) {
 	h.mu.Lock()
-	defer h.mu.Unlock()
-
-	if action == "left" {
+	if p.Action == "left" {
 		// Remove presence
-		if h.presence[nodeID] != nil {
-			delete(h.presence[nodeID], client.UserID)
-			if len(h.presence[nodeID]) == 0 {
-				delete(h.presence, nodeID)
+		delete(client.presenceNodes, p.NodeID)
+		if h.presence[p.NodeID] != nil {
+			delete(h.presence[p.NodeID], client.UserID)
+			if len(h.presence[p.NodeID]) == 0 {
+				delete(h.presence, p.NodeID)
 			}
 		}
 	} else {
 		// Add/update presence
-		if h.presence[nodeID] == nil {
-			h.presence[nodeID] = make(map[string]*PresenceInfo)
-		}
-		h.presence[nodeID][client.UserID] = &PresenceInfo{
-			UserID:    client.UserID,
-			UserEmail: client.UserEmail,
-			Action:    action,
-			Position:  position,
+		if h.presence[p.NodeID] == nil {
+			h.presence[p.NodeID] = make(map[string]*PresenceInfo)
 		}
+		h.presence[p.NodeID][client.UserID] = newPresenceInfo(client, p)
+		client.presenceNodes[p.NodeID] = true
+	}
+	h.mu.Unlock()
+
+	if client.presence.admit(p, func(latest PresencePayload) { h.emitPresence(client, latest) }) {
+		h.emitPresence(client, p)
+	}
+}
+
+// emitPresence mirrors a presence update to Redis and broadcasts it to the
+// node channel
+func (h *Hub) emitPresence(client *Client, p PresencePayload) {
+	if p.Action == "left" {
+		h.removePresence(h.ctx, client.UserID, p.NodeID)
+	} else {
+		h.storePresence(h.ctx, p.NodeID, newPresenceInfo(client, p))
 	}
 
-	// Broadcast presence update to node channel
-	nodeChannel := "node:" + nodeID
 	msg := NewMessage(MsgTypePresenceUpdate, PresenceEventPayload{
-		NodeID:    nodeID,
+		NodeID:    p.NodeID,
 		UserID:    client.UserID,
 		UserEmail: client.UserEmail,
-		Action:    action,
-		Position:  position,
+		Action:    p.Action,
+		Field:     p.Field,
+		Position:  p.Position,
+		Selection: p.Selection,
+		Typing:    p.Typing,
+	})
+	h.onPresenceChange(PresenceEvent{
+		NodeID:    p.NodeID,
+		UserID:    client.UserID,
+		UserEmail: client.UserEmail,
+		Action:    p.Action,
+		Field:     p.Field,
 	})
 
-	// Unlock before broadcasting
-	h.mu.Unlock()
-	h.broadcast <- &BroadcastMessage{
-		Channel: nodeChannel,
+	select {
+	case h.broadcast <- &BroadcastMessage{
+		Channel: "node:" + p.NodeID,
 		Message: msg,
 		Exclude: client, // Don't send back to the sender
+	}:
+	case <-h.ctx.Done():
+		return
+	}
+	h.publishToRedis("node:"+p.NodeID, msg)
+}
+
+func newPresenceInfo(client *Client, p PresencePayload) *PresenceInfo {
+	return &PresenceInfo{
+		UserID:    client.UserID,
+		UserEmail: client.UserEmail,
+		Action:    p.Action,
+		Field:     p.Field,
+		Position:  p.Position,
+		Selection: p.Selection,
+		Typing:    p.Typing,
+		LastSeen:  time.Now(),
 	}
-	h.mu.Lock() // Re-lock for deferred unlock
 }
 
 // GetNodePresence returns all users present on a node
@@ -316,96 +488,168 @@ func (h *Hub) GetNodePresence(nodeID string) []*PresenceInfo {
 
 // broadcastToChannel sends a message to all clients in a channel
 func (h *Hub) broadcastToChannel(msg *BroadcastMessage) {
-	h.mu.RLock()
-	clients := h.channels[msg.Channel]
-	h.mu.RUnlock()
-
-	if clients == nil {
-		return
-	}
-
-	data, err := msg.Message.ToJSON()
+	message := withMessageID(msg.Message)
+	encoded, err := newEncodedMessage(message)
 	if err != nil {
 		h.logger.Error("Failed to marshal broadcast message", zap.Error(err))
 		return
 	}
 
-	for client := range clients {
+	// Sends don't block, so the lock is held while iterating the channel
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	recipients := h.channels[msg.Channel]
+	if msg.UserID != "" {
+		recipients = h.clientsByUser[msg.UserID]
+	}
+	for client := range recipients {
 		if msg.Exclude != nil && client == msg.Exclude {
 			continue
 		}
-		select {
-		case client.send <- data:
-		default:
-			// Client buffer is full, skip
-			h.logger.Warn("Client send buffer full, skipping",
-				zap.String("userId", client.UserID),
-			)
+		data, err := encoded.forClient(client)
+		if err != nil {
+			h.logger.Error("Failed to encode broadcast message", zap.Error(err))
+			return
 		}
+		h.deliver(client, message, data)
 	}
 }
 
 // broadcastPresenceLeft broadcasts that a user left
 func (h *Hub) broadcastPresenceLeft(nodeID, userID, userEmail string) {
-	nodeChannel := "node:" + nodeID
-	msg := NewMessage(MsgTypePresenceUpdate, PresenceEventPayload{
-		NodeID:    nodeID,
-		UserID:    userID,
-		UserEmail: userEmail,
-		Action:    "left",
-	})
+	h.broadcastPresence(nodeID, presenceLeftMessage(nodeID, userID, userEmail))
+}
 
+// broadcastPresence sends a presence event to a node's local subscribers
+func (h *Hub) broadcastPresence(nodeID string, msg *Message) {
 	// Use non-blocking send to broadcast channel
 	select {
-	case h.broadcast <- &BroadcastMessage{Channel: nodeChannel, Message: msg}:
+	case h.broadcast <- &BroadcastMessage{Channel: "node:" + nodeID, Message: msg}:
 	default:
 	}
 }
 
+func presenceLeftMessage(nodeID, userID, userEmail string) *Message {
+	return NewMessage(MsgTypePresenceUpdate, PresenceEventPayload{
+		NodeID:    nodeID,
+		UserID:    userID,
+		UserEmail: userEmail,
+		Action:    "left",
+	})
+}
+
 // Broadcast sends a message to a specific channel
 func (h *Hub) Broadcast(channel string, msg *Message) {
 	h.broadcast <- &BroadcastMessage{
 		Channel: channel,
 		Message: msg,
 	}
+	h.onBroadcast(BroadcastEvent{Channel: channel, Message: msg})
 }
 
-// BroadcastToProject sends a message to all users subscribed to a project
-func (h *Hub) BroadcastToProject(projectID uuid.UUID, msg *Message) {
-	channel := "project:" + projectID.String()
+// BroadcastToOrg sends a message to all users subscribed to an org
+func (h *Hub) BroadcastToOrg(orgID uuid.UUID, msg *Message) {
+	channel := "org:" + orgID.String()
+	msg = h.recordEvent(channel, msg)
 	h.Broadcast(channel, msg)
 
 	// Also publish to Redis for other instances
 	h.publishToRedis(channel, msg)
 }
 
+// SetProjectOrgResolver enables org:<id>:projects channels, which receive
+// the events of every project in an org
+func (h *Hub) SetProjectOrgResolver(resolve ProjectOrgResolver) {
+	h.projectOrg = resolve
+}
+
+// BroadcastToProject sends a message to all users subscribed to a project,
+// and to those following all projects in its org
+func (h *Hub) BroadcastToProject(projectID uuid.UUID, msg *Message) {
+	channel := "project:" + projectID.String()
+	event := h.recordEvent(channel, msg)
+	h.Broadcast(channel, event)
+
+	// Also publish to Redis for other instances
+	h.publishToRedis(channel, event)
+
+	if h.projectOrg == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(h.ctx, authorizeTimeout)
+	orgID, err := h.projectOrg(ctx, projectID)
+	cancel()
+	if err != nil {
+		h.logger.Warn("Failed to resolve project org for broadcast",
+			zap.String("projectId", projectID.String()),
+			zap.Error(err),
+		)
+		return
+	}
+	channel = (&Channel{Type: ChannelOrg, ID: orgID, Scope: ChannelScopeProjects}).String()
+	event = h.recordEvent(channel, msg)
+	h.Broadcast(channel, event)
+	h.publishToRedis(channel, event)
+}
+
 // BroadcastToNode sends a message to all users subscribed to a node
 func (h *Hub) BroadcastToNode(nodeID uuid.UUID, msg *Message) {
 	channel := "node:" + nodeID.String()
+	msg = h.recordEvent(channel, msg)
 	h.Broadcast(channel, msg)
 
 	// Also publish to Redis for other instances
 	h.publishToRedis(channel, msg)
 }
 
+// BroadcastToExecution sends a message to all users following an execution
+func (h *Hub) BroadcastToExecution(executionID uuid.UUID, msg *Message) {
+	channel := "execution:" + executionID.String()
+	msg = h.recordEvent(channel, msg)
+	h.Broadcast(channel, msg)
+
+	// Also publish to Redis for other instances
+	h.publishToRedis(channel, msg)
+}
+
+// SendToUser sends a message to every connected client of a user, on any
+// instance
+func (h *Hub) SendToUser(userID uuid.UUID, msg *Message) {
+	select {
+	case h.broadcast <- &BroadcastMessage{UserID: userID.String(), Message: msg}:
+	case <-h.ctx.Done():
+		return
+	}
+	h.onBroadcast(BroadcastEvent{UserID: userID.String(), Message: msg})
+	h.publishRedisMessage(userRoute(userID.String()), RedisMessage{UserID: userID.String(), Message: msg})
+}
+
 // Redis pub/sub for multi-instance support
 
 // RedisMessage is used for pub/sub across instances
 type RedisMessage struct {
-	Channel string   `json:"channel"`
-	Message *Message `json:"message"`
+	Channel string    `json:"channel,omitempty"`
+	UserID  string    `json:"userId,omitempty"` // set instead of Channel for user-addressed events
+	Message *Message  `json:"message"`
+	Origin  string    `json:"origin,omitempty"` // publishing instance
+	SentAt  time.Time `json:"sentAt,omitempty"`
 }
 
-// publishToRedis publishes a message to Redis for other instances
+// publishToRedis publishes a message to Redis for the other instances
+// subscribed to the channel's shard
 func (h *Hub) publishToRedis(channel string, msg *Message) {
+	h.publishRedisMessage(channel, RedisMessage{Channel: channel, Message: msg})
+}
+
+// publishRedisMessage publishes to the shard of a routing key
+func (h *Hub) publishRedisMessage(route string, redisMsg RedisMessage) {
 	if h.redis == nil {
 		return
 	}
 
-	redisMsg := RedisMessage{
-		Channel: channel,
-		Message: msg,
-	}
+	redisMsg.Origin = h.instanceID
+	redisMsg.SentAt = time.Now()
 
 	data, err := json.Marshal(redisMsg)
 	if err != nil {
@@ -413,21 +657,74 @@ func (h *Hub) publishToRedis(channel string, msg *Message) {
 		return
 	}
 
-	if err := h.redis.Publish(h.ctx, "glassbox:ws", string(data)); err != nil {
+	if err := h.redis.Publish(h.ctx, redisShard(route), string(data)); err != nil {
+		h.metrics.publishErrors.Add(1)
 		h.logger.Error("Failed to publish to Redis", zap.Error(err))
+		return
 	}
+	h.metrics.published.Add(1)
 }
 
-// subscribeToRedis subscribes to Redis pub/sub for messages from other instances
-func (h *Hub) subscribeToRedis() {
+// ControlType identifies a hub-to-hub control message
+type ControlType string
+
+const (
+	ControlRevokeMembership ControlType = "revoke_membership"
+	ControlRevalidateAccess ControlType = "revalidate_access"
+)
+
+// ControlMessage is sent between instances to act on clients rather than
+// deliver events to them
+type ControlMessage struct {
+	Type   ControlType `json:"type"`
+	OrgID  uuid.UUID   `json:"orgId"`
+	UserID uuid.UUID   `json:"userId"`
+}
+
+// publishControl publishes a control message for other instances
+func (h *Hub) publishControl(msg ControlMessage) {
 	if h.redis == nil {
 		return
 	}
 
-	pubsub := h.redis.Subscribe(h.ctx, "glassbox:ws")
-	defer pubsub.Close()
+	data, err := json.Marshal(msg)
+	if err != nil {
+		h.logger.Error("Failed to marshal control message", zap.Error(err))
+		return
+	}
 
-	ch := pubsub.Channel()
+	if err := h.redis.Publish(h.ctx, redisControlChannel, string(data)); err != nil {
+		h.logger.Error("Failed to publish control message", zap.Error(err))
+	}
+}
+
+// handleControl applies a control message from another instance
+func (h *Hub) handleControl(payload string) {
+	var msg ControlMessage
+	if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+		h.logger.Error("Failed to unmarshal control message", zap.Error(err))
+		return
+	}
+
+	switch msg.Type {
+	case ControlRevokeMembership:
+		h.revokeLocal(msg.OrgID, msg.UserID.String())
+	case ControlRevalidateAccess:
+		// Authorization lookups shouldn't hold up the subscriber
+		go h.revalidate(msg.UserID.String())
+	default:
+		h.logger.Warn("Unknown control message", zap.String("type", string(msg.Type)))
+	}
+}
+
+// subscribeToRedis subscribes to Redis pub/sub for messages from other instances
+func (h *Hub) subscribeToRedis() {
+	if h.pubsub == nil {
+		return
+	}
+	defer h.pubsub.Close()
+
+	ch := h.pubsub.Channel()
 
 	for {
 		select {
@@ -438,15 +735,39 @@ func (h *Hub) subscribeToRedis() {
 				return
 			}
 
+			if redisMsg.Channel == redisControlChannel {
+				h.handleControl(redisMsg.Payload)
+				continue
+			}
+
 			var msg RedisMessage
 			if err := json.Unmarshal([]byte(redisMsg.Payload), &msg); err != nil {
 				h.logger.Error("Failed to unmarshal Redis message", zap.Error(err))
 				continue
 			}
+			// Already delivered to local clients when it was published
+			if msg.Origin == h.instanceID {
+				continue
+			}
+			h.metrics.received.Add(1)
+			if !msg.SentAt.IsZero() {
+				h.metrics.observeLag(time.Since(msg.SentAt))
+			}
+			// Shards are shared, so skip channels and users nobody here follows
+			h.mu.RLock()
+			_, subscribed := h.channels[msg.Channel]
+			if msg.UserID != "" {
+				_, subscribed = h.clientsByUser[msg.UserID]
+			}
+			h.mu.RUnlock()
+			if !subscribed {
+				continue
+			}
 
 			// Broadcast to local clients
 			h.broadcast <- &BroadcastMessage{
 				Channel: msg.Channel,
+				UserID:  msg.UserID,
 				Message: msg.Message,
 			}
 		}
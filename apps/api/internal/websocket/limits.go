@@ -0,0 +1,280 @@
+package websocket
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Connections are capped per user and per org, and closed once idle. Both
+// end the connection with a close code in the application range so clients
+// can tell them apart from network failures: an idle client should wait for
+// user activity before reconnecting, and one over its limit should back off.
+//
+// With Redis the caps apply across instances. Each connection holds a lease
+// in a sorted set per user and per org, scored by its last refresh; leases
+// left by instances that died stop counting after connLeaseTTL.
+const (
+	CloseIdleTimeout     = 4000
+	CloseConnectionLimit = 4029
+
+	CloseReasonIdleTimeout     = "idle_timeout"
+	CloseReasonUserConnections = "user_connection_limit"
+	CloseReasonOrgConnections  = "org_connection_limit"
+
+	connUserKeyPrefix  = "ws:conns:user:"
+	connOrgKeyPrefix   = "ws:conns:org:"
+	connLeaseRefresh   = 30 * time.Second
+	connLeaseTTL       = 3 * connLeaseRefresh
+	idleCheckPeriod    = 30 * time.Second
+	connAdmitTimeout   = 2 * time.Second
+	connReleaseTimeout = 2 * time.Second
+)
+
+// ConnectionLimits bound how many connections a user or org may hold, how
+// long a connection may go without client activity, and how long it stays
+// authenticated without a token refresh. Zero disables a limit.
+type ConnectionLimits struct {
+	PerUser         int
+	PerOrg          int
+	IdleTimeout     time.Duration
+	SessionLifetime time.Duration
+}
+
+// admitConnectionScript drops stale leases, then adds the connection to
+// each set unless that set is at its limit. Returns 0 when admitted, or the
+// 1-based index of the key that was full.
+// KEYS: user set, [org set]; ARGV: connID, now, staleBefore, key TTL ms,
+// user limit, [org limit]
+var admitConnectionScript = redis.NewScript(`
+for i, key in ipairs(KEYS) do
+	redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[3])
+	local limit = tonumber(ARGV[4 + i])
+	if limit > 0 and redis.call('ZSCORE', key, ARGV[1]) == false and redis.call('ZCARD', key) >= limit then
+		return i
+	end
+end
+for _, key in ipairs(KEYS) do
+	redis.call('ZADD', key, ARGV[2], ARGV[1])
+	redis.call('PEXPIRE', key, ARGV[4])
+end
+return 0
+`)
+
+// connectionCounter counts connections on this instance when there is no
+// Redis to count them across instances
+type connectionCounter struct {
+	mu     sync.Mutex
+	byUser map[string]int
+	byOrg  map[string]int
+}
+
+func newConnectionCounter() *connectionCounter {
+	return &connectionCounter{
+		byUser: make(map[string]int),
+		byOrg:  make(map[string]int),
+	}
+}
+
+// SetConnectionLimits configures connection caps and idle eviction. Call
+// before Run.
+func (h *Hub) SetConnectionLimits(limits ConnectionLimits) {
+	h.limits = limits
+}
+
+// admitConnection claims a connection slot for the client. It returns the
+// close reason when the user or org is at its limit, or "" when admitted.
+// A client that is admitted must be registered, which releases the slot
+// when it unregisters.
+func (h *Hub) admitConnection(client *Client) string {
+	if h.redis == nil {
+		return h.admitLocal(client)
+	}
+
+	keys := []string{connUserKeyPrefix + client.UserID}
+	now := time.Now()
+	args := []any{
+		client.ID,
+		now.UnixMilli(),
+		now.Add(-connLeaseTTL).UnixMilli(),
+		(2 * connLeaseTTL).Milliseconds(),
+		h.limits.PerUser,
+	}
+	if client.OrgID != "" {
+		keys = append(keys, connOrgKeyPrefix+client.OrgID)
+		args = append(args, h.limits.PerOrg)
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, connAdmitTimeout)
+	defer cancel()
+	full, err := admitConnectionScript.Run(ctx, h.redis.Client, keys, args...).Int()
+	if err != nil {
+		// Fail open; the cap protects capacity, not security
+		h.logger.Warn("Failed to check WebSocket connection limits",
+			zap.String("userId", client.UserID),
+			zap.Error(err),
+		)
+		return ""
+	}
+	switch full {
+	case 1:
+		return CloseReasonUserConnections
+	case 2:
+		return CloseReasonOrgConnections
+	}
+	return ""
+}
+
+func (h *Hub) admitLocal(client *Client) string {
+	c := h.connections
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if h.limits.PerUser > 0 && c.byUser[client.UserID] >= h.limits.PerUser {
+		return CloseReasonUserConnections
+	}
+	if client.OrgID != "" && h.limits.PerOrg > 0 && c.byOrg[client.OrgID] >= h.limits.PerOrg {
+		return CloseReasonOrgConnections
+	}
+	c.byUser[client.UserID]++
+	if client.OrgID != "" {
+		c.byOrg[client.OrgID]++
+	}
+	return ""
+}
+
+// releaseConnection frees the client's connection slot
+func (h *Hub) releaseConnection(client *Client) {
+	if h.redis == nil {
+		c := h.connections
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		decrement(c.byUser, client.UserID)
+		if client.OrgID != "" {
+			decrement(c.byOrg, client.OrgID)
+		}
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), connReleaseTimeout)
+	defer cancel()
+	pipe := h.redis.Client.Pipeline()
+	pipe.ZRem(ctx, connUserKeyPrefix+client.UserID, client.ID)
+	if client.OrgID != "" {
+		pipe.ZRem(ctx, connOrgKeyPrefix+client.OrgID, client.ID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		// The lease goes stale on its own
+		h.logger.Debug("Failed to release WebSocket connection lease", zap.Error(err))
+	}
+}
+
+func decrement(counts map[string]int, key string) {
+	if counts[key] <= 1 {
+		delete(counts, key)
+		return
+	}
+	counts[key]--
+}
+
+// refreshConnections periodically renews the leases of this instance's
+// connections so other instances keep counting them
+func (h *Hub) refreshConnections() {
+	if h.redis == nil {
+		return
+	}
+
+	ticker := time.NewTicker(connLeaseRefresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		clients := h.clientList()
+		if len(clients) == 0 {
+			continue
+		}
+
+		now := float64(time.Now().UnixMilli())
+		pipe := h.redis.Client.Pipeline()
+		for _, client := range clients {
+			member := redis.Z{Score: now, Member: client.ID}
+			pipe.ZAddXX(h.ctx, connUserKeyPrefix+client.UserID, member)
+			pipe.PExpire(h.ctx, connUserKeyPrefix+client.UserID, 2*connLeaseTTL)
+			if client.OrgID != "" {
+				pipe.ZAddXX(h.ctx, connOrgKeyPrefix+client.OrgID, member)
+				pipe.PExpire(h.ctx, connOrgKeyPrefix+client.OrgID, 2*connLeaseTTL)
+			}
+		}
+		if _, err := pipe.Exec(h.ctx); err != nil {
+			h.logger.Warn("Failed to refresh WebSocket connection leases", zap.Error(err))
+		}
+	}
+}
+
+// evictIdle periodically closes connections with no client activity within
+// the idle timeout
+func (h *Hub) evictIdle() {
+	if h.limits.IdleTimeout <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(min(idleCheckPeriod, h.limits.IdleTimeout/2))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		cutoff := time.Now().Add(-h.limits.IdleTimeout)
+		var idle []*Client
+		h.mu.RLock()
+		for client := range h.clients {
+			if client.lastActive().Before(cutoff) {
+				idle = append(idle, client)
+			}
+		}
+		h.mu.RUnlock()
+
+		for _, client := range idle {
+			h.metrics.idleDisconnects.Add(1)
+			client.logger.Info("Closing idle WebSocket connection",
+				zap.String("userId", client.UserID),
+			)
+			// ReadPump unregisters the client once the connection closes
+			client.closeWith(CloseIdleTimeout, CloseReasonIdleTimeout)
+		}
+	}
+}
+
+// closeWith sends a close frame with the given code and reason, then closes
+// the connection. WriteControl is safe alongside WritePump.
+func (c *Client) closeWith(code int, reason string) {
+	if c.conn != nil {
+		c.conn.WriteControl(websocket.CloseMessage,
+			websocket.FormatCloseMessage(code, reason),
+			time.Now().Add(writeWait))
+	}
+	c.close()
+}
+
+// close drops the connection, after which ReadPump unregisters the client.
+// Local connections have no ReadPump and are unregistered directly.
+func (c *Client) close() {
+	if c.conn == nil {
+		go c.hub.leave(c)
+		return
+	}
+	c.conn.Close()
+}
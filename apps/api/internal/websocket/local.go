@@ -0,0 +1,84 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// A LocalConn is a connection to the hub without a socket: messages it sends
+// are handled as if they arrived on a WebSocket, and messages for it are
+// queued for Receive instead of being written out. It lets tests and
+// in-process tools act as a client. See the wstest package.
+
+// ErrConnClosed is returned by Receive once the connection is closed
+var ErrConnClosed = errors.New("connection closed")
+
+// LocalConn is an in-process client connection
+type LocalConn struct {
+	client *Client
+}
+
+// ConnectLocal registers an in-process connection for a user. Like a
+// WebSocket connection, it first receives a session message.
+func (h *Hub) ConnectLocal(userID, userEmail, orgID string) *LocalConn {
+	client := NewClient(h, nil, userID, userEmail, orgID, h.logger)
+	client.startSession()
+	select {
+	case h.register <- client:
+	case <-h.ctx.Done():
+	}
+	return &LocalConn{client: client}
+}
+
+// ClientID returns the connection's client ID
+func (lc *LocalConn) ClientID() string {
+	return lc.client.ID
+}
+
+// Send handles msg as if the client had sent it. It returns once the message
+// has been processed; any replies are queued for Receive.
+func (lc *LocalConn) Send(msg *Message) error {
+	data, err := msg.ToJSON()
+	if err != nil {
+		return err
+	}
+	lc.client.handleMessage(data)
+	return nil
+}
+
+// Receive returns the next message for the connection, waiting until one
+// arrives, the connection closes or ctx is done
+func (lc *LocalConn) Receive(ctx context.Context) (*Message, error) {
+	select {
+	case data, ok := <-lc.client.send:
+		if !ok {
+			return nil, ErrConnClosed
+		}
+		return ParseMessage(data)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close disconnects the connection as if its socket had closed
+func (lc *LocalConn) Close() {
+	lc.client.hub.leave(lc.client)
+}
+
+// leave unregisters a client unless the hub has stopped
+func (h *Hub) leave(client *Client) {
+	select {
+	case h.unregister <- client:
+	case <-h.ctx.Done():
+	}
+}
+
+// DecodePayload decodes a received message's payload into v
+func DecodePayload(msg *Message, v any) error {
+	data, err := json.Marshal(msg.Payload)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -2,6 +2,7 @@ package websocket
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -18,6 +19,17 @@ const (
 	MsgTypeLockAcquire  MessageType = "lock_acquire"
 	MsgTypeLockRelease  MessageType = "lock_release"
 	MsgTypePing         MessageType = "ping"
+	MsgTypeAck          MessageType = "ack"
+	MsgTypeDocSync      MessageType = "doc_sync"
+	MsgTypeDocCompact   MessageType = "doc_compact"
+	MsgTypeResume       MessageType = "resume"
+	MsgTypeRefreshToken MessageType = "refresh_token"
+)
+
+// Collaborative document message types, sent in both directions
+const (
+	MsgTypeDocUpdate    MessageType = "doc_update"
+	MsgTypeDocAwareness MessageType = "doc_awareness"
 )
 
 // Server message types (from server to client)
@@ -31,6 +43,19 @@ const (
 	MsgTypeLockReleased    MessageType = "lock_released"
 	MsgTypePresenceUpdate  MessageType = "presence_update"
 	MsgTypeExecutionUpdate MessageType = "execution_update"
+	MsgTypeSubscriptionRevoked MessageType = "subscription_revoked"
+	MsgTypeMembershipChanged   MessageType = "membership_changed"
+	MsgTypeNotification        MessageType = "notification"
+	MsgTypeQuotaWarning        MessageType = "quota_warning"
+	MsgTypeExecutionProgress   MessageType = "execution_progress"
+	MsgTypeDocState            MessageType = "doc_state"
+	MsgTypeDocAck              MessageType = "doc_ack"
+	MsgTypeFileProcessing      MessageType = "file_processing_update"
+	MsgTypeSession             MessageType = "session"
+	MsgTypeResumed             MessageType = "resumed"
+	MsgTypeServerShutdown      MessageType = "server_shutdown"
+	MsgTypeTokenRefreshed      MessageType = "token_refreshed"
+	MsgTypeUserMessage         MessageType = "user_message"
 	MsgTypeError           MessageType = "error"
 	MsgTypePong            MessageType = "pong"
 )
@@ -41,6 +66,12 @@ type Message struct {
 	Payload   any            `json:"payload,omitempty"`
 	RequestID string         `json:"requestId,omitempty"`
 	Timestamp time.Time      `json:"timestamp,omitempty"`
+	// Set on replayable channel events: the event ID to resume after, and
+	// the channel it was sent on
+	ID      string `json:"id,omitempty"`
+	Channel string `json:"channel,omitempty"`
+	// Set on critical events; clients that opted into acks echo it back
+	MessageID string `json:"messageId,omitempty"`
 }
 
 // NewMessage creates a new message with timestamp
@@ -55,16 +86,31 @@ func NewMessage(msgType MessageType, payload any) *Message {
 // SubscribePayload for subscribe/unsubscribe messages
 type SubscribePayload struct {
 	Channel string `json:"channel"` // e.g., "project:uuid" or "node:uuid"
+	// LastEventID resumes a channel after reconnecting: events after it are
+	// replayed following the subscribed confirmation
+	LastEventID string `json:"lastEventId,omitempty"`
+}
+
+// CursorPosition is a caret location within a field
+type CursorPosition struct {
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// SelectionRange is a selected span within a field
+type SelectionRange struct {
+	Start CursorPosition `json:"start"`
+	End   CursorPosition `json:"end"`
 }
 
 // PresencePayload for presence updates
 type PresencePayload struct {
-	NodeID   string `json:"nodeId"`
-	Action   string `json:"action"` // "viewing", "editing", "left"
-	Position *struct {
-		Line   int `json:"line,omitempty"`
-		Column int `json:"column,omitempty"`
-	} `json:"position,omitempty"`
+	NodeID    string          `json:"nodeId"`
+	Action    string          `json:"action"`          // "viewing", "editing", "left"
+	Field     string          `json:"field,omitempty"` // node field being edited, e.g. "description"
+	Position  *CursorPosition `json:"position,omitempty"`
+	Selection *SelectionRange `json:"selection,omitempty"`
+	Typing    bool            `json:"typing,omitempty"`
 }
 
 // LockPayload for lock acquire/release
@@ -76,6 +122,54 @@ type LockPayload struct {
 type SubscribedPayload struct {
 	Channel string   `json:"channel"`
 	Users   []string `json:"users,omitempty"` // Current users in the channel
+	// Replay outcome when the subscribe carried lastEventId
+	Replayed       int  `json:"replayed,omitempty"`
+	ResyncRequired bool `json:"resyncRequired,omitempty"` // events were lost; refetch the channel's state
+}
+
+// SessionPayload gives a new connection the token to resume its session
+// with, and when the connection must refresh its WS token by
+type SessionPayload struct {
+	SessionToken string     `json:"sessionToken"`
+	ExpiresAt    *time.Time `json:"expiresAt,omitempty"`
+}
+
+// RefreshTokenPayload carries a new WS token for the connection's user
+type RefreshTokenPayload struct {
+	Token string `json:"token"`
+}
+
+// TokenRefreshedPayload confirms a refresh with the session's new expiry
+type TokenRefreshedPayload struct {
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ResumePayload restores a previous connection's subscriptions. LastEventIDs
+// maps channels to the last event seen on each, as in SubscribePayload.
+type ResumePayload struct {
+	SessionToken string            `json:"sessionToken"`
+	LastEventIDs map[string]string `json:"lastEventIds,omitempty"`
+}
+
+// ResumedPayload lists the restored subscriptions, each as its subscribe
+// would have been confirmed, and the channels that could not be restored
+type ResumedPayload struct {
+	SessionToken string              `json:"sessionToken"`
+	Channels     []SubscribedPayload `json:"channels"`
+	Failed       []string            `json:"failed,omitempty"` // access was lost or the channel is invalid
+}
+
+// ServerShutdownPayload tells a client the instance is shutting down and
+// when to reconnect; it should close the connection and resume its session
+// on the new one
+type ServerShutdownPayload struct {
+	ReconnectAfterMs int64 `json:"reconnectAfterMs"`
+}
+
+// SubscriptionRevokedPayload tells a client it was removed from a channel
+type SubscriptionRevokedPayload struct {
+	Channel string `json:"channel"`
+	Reason  string `json:"reason"` // "membership_revoked" or "access_revoked"
 }
 
 // NodeEventPayload for node create/update/delete events
@@ -98,14 +192,14 @@ type LockEventPayload struct {
 
 // PresenceEventPayload for presence updates
 type PresenceEventPayload struct {
-	NodeID    string `json:"nodeId"`
-	UserID    string `json:"userId"`
-	UserEmail string `json:"userEmail"`
-	Action    string `json:"action"` // "joined", "left", "editing", "viewing"
-	Position  *struct {
-		Line   int `json:"line,omitempty"`
-		Column int `json:"column,omitempty"`
-	} `json:"position,omitempty"`
+	NodeID    string          `json:"nodeId"`
+	UserID    string          `json:"userId"`
+	UserEmail string          `json:"userEmail"`
+	Action    string          `json:"action"` // "joined", "left", "editing", "viewing"
+	Field     string          `json:"field,omitempty"`
+	Position  *CursorPosition `json:"position,omitempty"`
+	Selection *SelectionRange `json:"selection,omitempty"`
+	Typing    bool            `json:"typing,omitempty"`
 }
 
 // ExecutionEventPayload for execution status updates
@@ -119,6 +213,127 @@ type ExecutionEventPayload struct {
 	TotalTokensOut int      `json:"totalTokensOut,omitempty"`
 }
 
+// ExecutionProgressPayload for step-level progress within an execution
+type ExecutionProgressPayload struct {
+	ExecutionID uuid.UUID `json:"executionId"`
+	NodeID      uuid.UUID `json:"nodeId"`
+	Step        string    `json:"step"`  // "llm_call", "tool_call"
+	Phase       string    `json:"phase"` // "started", "finished"
+	Tool        string    `json:"tool,omitempty"`
+	Iteration   int       `json:"iteration,omitempty"`
+	DurationMs  *int      `json:"durationMs,omitempty"` // set when finished
+	// Running totals for the execution so far
+	TotalTokensIn  int `json:"totalTokensIn"`
+	TotalTokensOut int `json:"totalTokensOut"`
+}
+
+// DocPayload addresses a collaboratively edited node field. Update carries an
+// encoded Yjs/Automerge update (base64 in JSON) that the server stores and
+// relays without interpreting.
+type DocPayload struct {
+	NodeID string `json:"nodeId"`
+	Field  string `json:"field"` // "description"
+	Update []byte `json:"update,omitempty"`
+	// doc_compact: Update is a snapshot merging every update up to ThroughSeq
+	ThroughSeq int64 `json:"throughSeq,omitempty"`
+	// doc_compact: the snapshot rendered as plain text, saved to the field
+	Text *string `json:"text,omitempty"`
+}
+
+// DocStatePayload answers doc_sync with the stored document: the latest
+// snapshot and the updates not yet compacted into it
+type DocStatePayload struct {
+	NodeID  string   `json:"nodeId"`
+	Field   string   `json:"field"`
+	Updates [][]byte `json:"updates"`
+	Seq     int64    `json:"seq"`
+	// Set when the update log is long enough that the client should compact it
+	CompactSuggested bool `json:"compactSuggested,omitempty"`
+}
+
+// DocEventPayload relays a document or awareness update to other editors
+type DocEventPayload struct {
+	NodeID string `json:"nodeId"`
+	Field  string `json:"field"`
+	Update []byte `json:"update"`
+	Seq    int64  `json:"seq,omitempty"` // doc_update only
+	UserID string `json:"userId"`
+}
+
+// DocAckPayload confirms a stored doc_update or doc_compact
+type DocAckPayload struct {
+	NodeID string `json:"nodeId"`
+	Field  string `json:"field"`
+	Seq    int64  `json:"seq"`
+}
+
+// MembershipEventPayload for org membership changes
+type MembershipEventPayload struct {
+	OrgID     uuid.UUID `json:"orgId"`
+	UserID    uuid.UUID `json:"userId"`
+	Change    string    `json:"change"` // "added", "removed", "role_changed"
+	Role      string    `json:"role,omitempty"`
+	ChangedBy string    `json:"changedBy,omitempty"`
+}
+
+// NotificationPayload for notifications, either broadcast org-wide or pushed
+// to one user. UserID, when set, is the member the notification is for;
+// clients of other members ignore it.
+type NotificationPayload struct {
+	ID               uuid.UUID  `json:"id"`
+	NotificationType string     `json:"notificationType"`
+	Title            string     `json:"title"`
+	Message          string     `json:"message"`
+	ProjectID        *uuid.UUID `json:"projectId,omitempty"`
+	NodeID           *uuid.UUID `json:"nodeId,omitempty"`
+	UserID           *uuid.UUID `json:"userId,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	Read             bool       `json:"read"`
+	// How many times it happened, when repeats were coalesced into it
+	Count int `json:"count,omitempty"`
+	// Set on pushes to a user: their unread notifications including this one
+	UnreadCount *int `json:"unreadCount,omitempty"`
+}
+
+// QuotaWarningPayload for an org approaching or exceeding a usage limit
+type QuotaWarningPayload struct {
+	OrgID   uuid.UUID `json:"orgId"`
+	Quota   string    `json:"quota"` // e.g. "tokens", "storage_bytes", "executions"
+	Used    int64     `json:"used"`
+	Limit   int64     `json:"limit"`
+	Percent int       `json:"percent"`
+}
+
+// FileProcessingPayload reports a file moving through processing:
+// "uploaded", "processing", then "processed" or "failed"
+type FileProcessingPayload struct {
+	FileID   uuid.UUID `json:"fileId"`
+	OrgID    uuid.UUID `json:"orgId"`
+	Filename string    `json:"filename,omitempty"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"` // set when failed
+}
+
+// Kinds of user_message
+const (
+	UserMessageApprovalRequest = "approval_request"
+	UserMessageMention         = "mention"
+	UserMessageAdmin           = "admin"
+)
+
+// UserMessagePayload is sent straight to a user's connections, whatever
+// channels they are subscribed to
+type UserMessagePayload struct {
+	Kind   string         `json:"kind"`
+	Title  string         `json:"title"`
+	Body   string         `json:"body,omitempty"`
+	OrgID  *uuid.UUID     `json:"orgId,omitempty"`
+	Link   string         `json:"link,omitempty"`   // in-app path to open, e.g. the node awaiting approval
+	Data   map[string]any `json:"data,omitempty"`   // kind-specific details
+	SentBy string         `json:"sentBy,omitempty"` // user ID; empty for system messages
+	SentAt time.Time      `json:"sentAt"`
+}
+
 // ErrorPayload for error messages
 type ErrorPayload struct {
 	Code    string `json:"code"`
@@ -139,13 +354,37 @@ func (m *Message) ToJSON() ([]byte, error) {
 	return json.Marshal(m)
 }
 
+// Channel types
+const (
+	ChannelOrg       = "org"
+	ChannelProject   = "project"
+	ChannelNode      = "node"
+	ChannelExecution = "execution"
+)
+
+// Channel scopes, which widen a channel to a class of events under it
+const (
+	// "org:uuid:projects" receives the events of every project in the org
+	ChannelScopeProjects = "projects"
+	// "org:uuid:files" receives file processing updates for the org
+	ChannelScopeFiles = "files"
+)
+
+// Kinds of the scoped org channels
+const (
+	ChannelOrgProjects = ChannelOrg + ":" + ChannelScopeProjects
+	ChannelOrgFiles    = ChannelOrg + ":" + ChannelScopeFiles
+)
+
 // Channel represents a subscription channel
 type Channel struct {
-	Type string    // "project" or "node"
-	ID   uuid.UUID
+	Type  string    // "org", "project", "node" or "execution"
+	ID    uuid.UUID
+	Scope string    // optional, e.g. "projects" on an org channel
 }
 
-// ParseChannel parses a channel string like "project:uuid" or "node:uuid"
+// ParseChannel parses a channel string like "org:uuid", "project:uuid",
+// "node:uuid", "execution:uuid" or "org:uuid:projects"
 func ParseChannel(channel string) (*Channel, error) {
 	// Expected format: "type:uuid"
 	var channelType string
@@ -168,19 +407,43 @@ func ParseChannel(channel string) (*Channel, error) {
 		return nil, ErrInvalidChannel
 	}
 
+	var scope string
+	if channelType == ChannelOrg {
+		for _, s := range []string{ChannelScopeProjects, ChannelScopeFiles} {
+			if trimmed, ok := strings.CutSuffix(idStr, ":"+s); ok {
+				idStr, scope = trimmed, s
+				break
+			}
+		}
+	}
+
 	id, err := uuid.Parse(idStr)
 	if err != nil {
 		return nil, ErrInvalidChannel
 	}
 
-	if channelType != "project" && channelType != "node" {
+	switch channelType {
+	case ChannelOrg, ChannelProject, ChannelNode, ChannelExecution:
+	default:
 		return nil, ErrInvalidChannel
 	}
 
-	return &Channel{Type: channelType, ID: id}, nil
+	return &Channel{Type: channelType, ID: id, Scope: scope}, nil
 }
 
 // String returns the channel string representation
 func (c *Channel) String() string {
+	if c.Scope != "" {
+		return c.Type + ":" + c.ID.String() + ":" + c.Scope
+	}
 	return c.Type + ":" + c.ID.String()
 }
+
+// Kind is the channel type qualified by its scope, e.g. "project" or
+// "org:projects"
+func (c *Channel) Kind() string {
+	if c.Scope != "" {
+		return c.Type + ":" + c.Scope
+	}
+	return c.Type
+}
@@ -0,0 +1,299 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Presence is kept in memory by the instance holding the connection and
+// mirrored to Redis so any instance can answer "who is on this node".
+// Each node has a sorted set of user IDs scored by last-seen time and a hash
+// of their PresenceInfo, and ws:presence_nodes indexes the nodes that have any.
+//
+// An entry expires presenceTTL after its last presence update or heartbeat
+// (a ping from the connection). Instances mirror their entries periodically,
+// and every instance sweeps Redis for expired entries, including those left
+// by instances that died, broadcasting "left" for each.
+const (
+	presenceKeyPrefix     = "ws:presence:"
+	presenceInfoKeyPrefix = "ws:presence_info:"
+	presenceNodesKey      = "ws:presence_nodes"
+	presenceTTL           = 2 * time.Minute
+	presenceRefreshPeriod = 30 * time.Second
+	presenceSweepPeriod   = 15 * time.Second
+
+	// Keys outlive their entries so the sweeper still finds expired ones
+	presenceKeyTTL = 2 * presenceTTL
+)
+
+// PresenceReader answers presence queries across all instances
+type PresenceReader interface {
+	ClusterPresence(ctx context.Context, nodeID string) ([]*PresenceInfo, error)
+}
+
+// Ensure Hub implements PresenceReader
+var _ PresenceReader = (*Hub)(nil)
+
+// ClusterPresence returns everyone present on a node on any instance
+func (h *Hub) ClusterPresence(ctx context.Context, nodeID string) ([]*PresenceInfo, error) {
+	presence := h.GetNodePresence(nodeID)
+	if h.redis == nil {
+		return presence, nil
+	}
+
+	seen := make(map[string]bool, len(presence))
+	for _, p := range presence {
+		seen[p.UserID] = true
+	}
+
+	cutoff := strconv.FormatInt(time.Now().Add(-presenceTTL).Unix(), 10)
+	userIDs, err := h.redis.Client.ZRangeByScore(ctx, presenceKeyPrefix+nodeID, &redis.ZRangeBy{
+		Min: cutoff,
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(userIDs) == 0 {
+		return presence, nil
+	}
+
+	values, err := h.redis.Client.HMGet(ctx, presenceInfoKeyPrefix+nodeID, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var info PresenceInfo
+		if json.Unmarshal([]byte(raw), &info) != nil || seen[info.UserID] {
+			continue
+		}
+		seen[info.UserID] = true
+		presence = append(presence, &info)
+	}
+
+	return presence, nil
+}
+
+// storePresence mirrors a local presence entry to Redis
+func (h *Hub) storePresence(ctx context.Context, nodeID string, info *PresenceInfo) {
+	if h.redis == nil {
+		return
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return
+	}
+
+	pipe := h.redis.Client.Pipeline()
+	pipe.ZAdd(ctx, presenceKeyPrefix+nodeID, redis.Z{Score: float64(info.LastSeen.Unix()), Member: info.UserID})
+	pipe.HSet(ctx, presenceInfoKeyPrefix+nodeID, info.UserID, data)
+	pipe.Expire(ctx, presenceKeyPrefix+nodeID, presenceKeyTTL)
+	pipe.Expire(ctx, presenceInfoKeyPrefix+nodeID, presenceKeyTTL)
+	pipe.ZAdd(ctx, presenceNodesKey, redis.Z{Score: float64(time.Now().Unix()), Member: nodeID})
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.logger.Warn("Failed to store presence", zap.String("nodeId", nodeID), zap.Error(err))
+	}
+}
+
+// removePresence drops a user's presence on nodes from Redis
+func (h *Hub) removePresence(ctx context.Context, userID string, nodeIDs ...string) {
+	if h.redis == nil || len(nodeIDs) == 0 {
+		return
+	}
+
+	pipe := h.redis.Client.Pipeline()
+	for _, nodeID := range nodeIDs {
+		pipe.ZRem(ctx, presenceKeyPrefix+nodeID, userID)
+		pipe.HDel(ctx, presenceInfoKeyPrefix+nodeID, userID)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		h.logger.Warn("Failed to remove presence", zap.String("userId", userID), zap.Error(err))
+	}
+}
+
+// departPresence removes a disconnected user's presence from Redis and tells
+// other instances' subscribers they left
+func (h *Hub) departPresence(userID, userEmail string, nodeIDs []string) {
+	h.removePresence(h.ctx, userID, nodeIDs...)
+	for _, nodeID := range nodeIDs {
+		h.publishToRedis("node:"+nodeID, presenceLeftMessage(nodeID, userID, userEmail))
+		h.presenceLeft(nodeID, userID, userEmail)
+	}
+}
+
+// touchPresence records a heartbeat for the connection's presence entries
+func (h *Hub) touchPresence(client *Client) {
+	now := time.Now()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for nodeID := range client.presenceNodes {
+		info := h.presence[nodeID][client.UserID]
+		if info == nil {
+			continue
+		}
+		// Replaced rather than modified: GetNodePresence hands out pointers
+		touched := *info
+		touched.LastSeen = now
+		h.presence[nodeID][client.UserID] = &touched
+	}
+}
+
+// refreshPresence periodically mirrors this instance's presence entries to
+// Redis, carrying their latest heartbeats
+func (h *Hub) refreshPresence() {
+	if h.redis == nil {
+		return
+	}
+
+	ticker := time.NewTicker(presenceRefreshPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		h.mu.RLock()
+		snapshot := make(map[string][]PresenceInfo, len(h.presence))
+		for nodeID, users := range h.presence {
+			for _, info := range users {
+				snapshot[nodeID] = append(snapshot[nodeID], *info)
+			}
+		}
+		h.mu.RUnlock()
+
+		for nodeID, users := range snapshot {
+			for i := range users {
+				h.storePresence(h.ctx, nodeID, &users[i])
+			}
+		}
+	}
+}
+
+// sweepPresence periodically expires presence entries that stopped
+// heartbeating
+func (h *Hub) sweepPresence() {
+	ticker := time.NewTicker(presenceSweepPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		expired := h.expireLocalPresence(time.Now().Add(-presenceTTL))
+		if h.redis == nil {
+			for _, info := range expired {
+				h.broadcastPresenceLeft(info.nodeID, info.UserID, info.UserEmail)
+				h.presenceLeft(info.nodeID, info.UserID, info.UserEmail)
+			}
+			continue
+		}
+		// With Redis, "left" is broadcast by whichever instance removes the
+		// entry there, so it goes out once however many instances sweep
+		h.sweepClusterPresence()
+	}
+}
+
+type expiredPresence struct {
+	nodeID string
+	*PresenceInfo
+}
+
+// expireLocalPresence drops this instance's entries not seen since cutoff
+func (h *Hub) expireLocalPresence(cutoff time.Time) []expiredPresence {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var expired []expiredPresence
+	for nodeID, users := range h.presence {
+		for userID, info := range users {
+			if !info.LastSeen.Before(cutoff) {
+				continue
+			}
+			expired = append(expired, expiredPresence{nodeID: nodeID, PresenceInfo: info})
+			delete(users, userID)
+			for client := range h.clientsByUser[userID] {
+				delete(client.presenceNodes, nodeID)
+			}
+		}
+		if len(users) == 0 {
+			delete(h.presence, nodeID)
+		}
+	}
+	return expired
+}
+
+// expirePresenceScript removes a presence entry if it is still older than
+// the cutoff, returning its stored info. Checking and removing atomically
+// means a heartbeat that lands meanwhile wins, and only one sweeper
+// broadcasts the departure.
+var expirePresenceScript = redis.NewScript(`
+local score = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not score or tonumber(score) >= tonumber(ARGV[2]) then
+	return false
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+local info = redis.call("HGET", KEYS[2], ARGV[1])
+redis.call("HDEL", KEYS[2], ARGV[1])
+return info or ""
+`)
+
+// sweepClusterPresence removes expired entries from Redis and tells every
+// instance's subscribers that those users left
+func (h *Hub) sweepClusterPresence() {
+	ctx := h.ctx
+	cutoff := time.Now().Add(-presenceTTL).Unix()
+
+	nodeIDs, err := h.redis.Client.ZRange(ctx, presenceNodesKey, 0, -1).Result()
+	if err != nil {
+		h.logger.Warn("Failed to list presence nodes", zap.Error(err))
+		return
+	}
+
+	for _, nodeID := range nodeIDs {
+		zkey, hkey := presenceKeyPrefix+nodeID, presenceInfoKeyPrefix+nodeID
+		userIDs, err := h.redis.Client.ZRangeByScore(ctx, zkey, &redis.ZRangeBy{
+			Min: "-inf",
+			Max: "(" + strconv.FormatInt(cutoff, 10),
+		}).Result()
+		if err != nil {
+			h.logger.Warn("Failed to read presence", zap.String("nodeId", nodeID), zap.Error(err))
+			continue
+		}
+
+		for _, userID := range userIDs {
+			info, err := expirePresenceScript.Run(ctx, h.redis.Client, []string{zkey, hkey}, userID, cutoff).Text()
+			if err != nil {
+				// redis.Nil: refreshed, or another instance got there first
+				continue
+			}
+
+			var stored PresenceInfo
+			json.Unmarshal([]byte(info), &stored)
+			msg := presenceLeftMessage(nodeID, userID, stored.UserEmail)
+			h.broadcastPresence(nodeID, msg)
+			h.publishToRedis("node:"+nodeID, msg)
+			h.presenceLeft(nodeID, userID, stored.UserEmail)
+		}
+
+		if n, err := h.redis.Client.ZCard(ctx, zkey).Result(); err == nil && n == 0 {
+			h.redis.Client.ZRem(ctx, presenceNodesKey, nodeID)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// presenceBroadcastInterval is the most often one connection's presence on a
+// node is broadcast. Cursor moves and keystrokes arrive far faster than this.
+const presenceBroadcastInterval = 100 * time.Millisecond
+
+// presenceThrottle coalesces a connection's presence updates per node.
+// Changes of action, field or typing state go out immediately; cursor and
+// selection moves within the interval are collapsed into one trailing update
+// carrying the latest position.
+type presenceThrottle struct {
+	mu    sync.Mutex
+	nodes map[string]*throttledPresence
+}
+
+type throttledPresence struct {
+	sent    time.Time
+	last    PresencePayload
+	pending *PresencePayload
+	timer   *time.Timer
+}
+
+func newPresenceThrottle() *presenceThrottle {
+	return &presenceThrottle{nodes: make(map[string]*throttledPresence)}
+}
+
+// admit reports whether p should be broadcast now. When it returns false the
+// update is held and passed to flush once the interval ends, unless a newer
+// update supersedes it first.
+func (t *presenceThrottle) admit(p PresencePayload, flush func(PresencePayload)) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	st := t.nodes[p.NodeID]
+	if p.Action == "left" {
+		if st != nil {
+			st.stopTimer()
+			delete(t.nodes, p.NodeID)
+		}
+		return true
+	}
+	if st == nil {
+		st = &throttledPresence{}
+		t.nodes[p.NodeID] = st
+	}
+
+	now := time.Now()
+	elapsed := now.Sub(st.sent)
+	if st.sent.IsZero() || elapsed >= presenceBroadcastInterval ||
+		p.Action != st.last.Action || p.Field != st.last.Field || p.Typing != st.last.Typing {
+		st.stopTimer()
+		st.sent = now
+		st.last = p
+		return true
+	}
+
+	st.pending = &p
+	if st.timer == nil {
+		st.timer = time.AfterFunc(presenceBroadcastInterval-elapsed, func() {
+			t.mu.Lock()
+			// The node may have been left (and maybe rejoined) since
+			if t.nodes[p.NodeID] != st || st.pending == nil {
+				t.mu.Unlock()
+				return
+			}
+			latest := *st.pending
+			st.pending = nil
+			st.timer = nil
+			st.sent = time.Now()
+			st.last = latest
+			t.mu.Unlock()
+
+			flush(latest)
+		})
+	}
+	return false
+}
+
+// stop drops all held updates
+func (t *presenceThrottle) stop() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for nodeID, st := range t.nodes {
+		st.stopTimer()
+		delete(t.nodes, nodeID)
+	}
+}
+
+func (st *throttledPresence) stopTimer() {
+	if st.timer != nil {
+		st.timer.Stop()
+		st.timer = nil
+	}
+	st.pending = nil
+}
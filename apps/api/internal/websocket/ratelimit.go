@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// Inbound messages are rate limited per connection so one misbehaving client
+// can't flood the hub. Subscribes get a tighter limit of their own since each
+// one runs an authorization lookup. Messages over the limit are dropped with
+// a rate_limited error; a client that keeps exceeding it is disconnected.
+const (
+	inboundRate      = 30 // messages per second
+	inboundBurst     = 60
+	subscribeRate    = 5
+	subscribeBurst   = 30
+	rateWarnInterval = 1 * time.Second
+
+	// Dropped messages tolerated within violationWindow before disconnecting
+	maxRateViolations = 50
+	violationWindow   = 10 * time.Second
+)
+
+// inboundLimiter tracks one connection's inbound rate. Only used by ReadPump.
+type inboundLimiter struct {
+	all        *rate.Limiter
+	subscribes *rate.Limiter
+
+	violations  int
+	windowStart time.Time
+	lastWarning time.Time
+}
+
+func newInboundLimiter() *inboundLimiter {
+	return &inboundLimiter{
+		all:        rate.NewLimiter(inboundRate, inboundBurst),
+		subscribes: rate.NewLimiter(subscribeRate, subscribeBurst),
+	}
+}
+
+func (l *inboundLimiter) allow(msgType MessageType) bool {
+	if !l.all.Allow() {
+		return false
+	}
+	// A resume authorizes every channel it restores, like a subscribe
+	if (msgType == MsgTypeSubscribe || msgType == MsgTypeResume) && !l.subscribes.Allow() {
+		return false
+	}
+	return true
+}
+
+// violate records a dropped message and reports whether the client has
+// exceeded its tolerance
+func (l *inboundLimiter) violate(now time.Time) bool {
+	if now.Sub(l.windowStart) > violationWindow {
+		l.windowStart = now
+		l.violations = 0
+	}
+	l.violations++
+	return l.violations > maxRateViolations
+}
+
+// admit applies the rate limit to an inbound message. It returns false when
+// the message must be dropped; the client is warned, or disconnected if it
+// keeps going.
+func (c *Client) admit(msg *Message) bool {
+	if c.limiter.allow(msg.Type) {
+		return true
+	}
+
+	c.hub.metrics.inboundRateLimited.Add(1)
+	now := time.Now()
+	if c.limiter.violate(now) {
+		c.hub.metrics.disconnects.Add(1)
+		c.logger.Warn("Disconnecting client for exceeding WebSocket rate limit",
+			zap.String("userId", c.UserID),
+			zap.String("type", string(msg.Type)),
+		)
+		c.closeWith(websocket.ClosePolicyViolation, "rate limit exceeded")
+		return false
+	}
+
+	if now.Sub(c.limiter.lastWarning) >= rateWarnInterval {
+		c.limiter.lastWarning = now
+		c.sendErrorFor(msg, "rate_limited", "Too many messages; slow down")
+	}
+	return false
+}
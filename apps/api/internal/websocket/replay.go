@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Channel events are appended to a Redis stream per channel so clients that
+// reconnect can pass the last event ID they saw and receive what they missed.
+// Ephemeral events (presence) are not recorded.
+const (
+	eventStreamPrefix = "ws:events:"
+	eventStreamMaxLen = 1000
+	eventStreamTTL    = 1 * time.Hour
+
+	// More missed events than this and the client is told to refetch
+	// instead. Kept below sendBufferSize so a replay can't overflow it.
+	maxReplayEvents = 200
+)
+
+// ReplayResult is the outcome of a replay request
+type ReplayResult struct {
+	Messages []*Message
+	// ResyncRequired means events may have been lost (trimmed, expired or too
+	// many to replay) and the client should refetch the channel's state
+	ResyncRequired bool
+}
+
+// recordEvent appends msg to the channel's stream and returns a copy stamped
+// with the channel and stream entry ID so clients can resume from it. The
+// original is left untouched since the same message may go to several channels.
+func (h *Hub) recordEvent(channel string, msg *Message) *Message {
+	event := *msg
+	event.Channel = channel
+	if h.redis == nil {
+		return &event
+	}
+
+	data, err := json.Marshal(&event)
+	if err != nil {
+		h.logger.Error("Failed to marshal event for replay", zap.Error(err))
+		return &event
+	}
+
+	key := eventStreamPrefix + channel
+	pipe := h.redis.Client.Pipeline()
+	add := pipe.XAdd(h.ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: eventStreamMaxLen,
+		Approx: true,
+		Values: map[string]any{"msg": data},
+	})
+	pipe.Expire(h.ctx, key, eventStreamTTL)
+	if _, err := pipe.Exec(h.ctx); err != nil {
+		h.logger.Warn("Failed to record event for replay", zap.String("channel", channel), zap.Error(err))
+		return &event
+	}
+	event.ID = add.Val()
+	return &event
+}
+
+// Replay returns the channel's events after lastEventID, oldest first
+func (h *Hub) Replay(channel, lastEventID string) (*ReplayResult, error) {
+	last, ok := parseStreamID(lastEventID)
+	if !ok {
+		return &ReplayResult{ResyncRequired: true}, nil
+	}
+	if h.redis == nil {
+		return &ReplayResult{}, nil
+	}
+
+	key := eventStreamPrefix + channel
+	entries, err := h.redis.Client.XRangeN(h.ctx, key, "("+lastEventID, "+", maxReplayEvents+1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > maxReplayEvents {
+		return &ReplayResult{ResyncRequired: true}, nil
+	}
+
+	// If the oldest retained entry is newer than the client's last event,
+	// anything in between has been trimmed
+	oldest, err := h.redis.Client.XRangeN(h.ctx, key, "-", "+", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := &ReplayResult{}
+	if len(oldest) == 0 {
+		// The stream expired; events may have come and gone since lastEventID
+		result.ResyncRequired = time.Since(time.UnixMilli(last[0])) > eventStreamTTL
+		return result, nil
+	}
+	if first, ok := parseStreamID(oldest[0].ID); ok && streamIDLess(last, first) {
+		result.ResyncRequired = true
+	}
+
+	for _, entry := range entries {
+		raw, _ := entry.Values["msg"].(string)
+		var msg Message
+		if err := json.Unmarshal([]byte(raw), &msg); err != nil {
+			h.logger.Warn("Skipping unreadable replay event", zap.String("id", entry.ID), zap.Error(err))
+			continue
+		}
+		msg.ID = entry.ID
+		result.Messages = append(result.Messages, &msg)
+	}
+	return result, nil
+}
+
+// parseStreamID parses a Redis stream ID ("<ms>-<seq>")
+func parseStreamID(id string) ([2]int64, bool) {
+	msPart, seqPart, ok := strings.Cut(id, "-")
+	if !ok {
+		return [2]int64{}, false
+	}
+	ms, err := strconv.ParseInt(msPart, 10, 64)
+	if err != nil {
+		return [2]int64{}, false
+	}
+	seq, err := strconv.ParseInt(seqPart, 10, 64)
+	if err != nil {
+		return [2]int64{}, false
+	}
+	return [2]int64{ms, seq}, true
+}
+
+func streamIDLess(a, b [2]int64) bool {
+	return a[0] < b[0] || (a[0] == b[0] && a[1] < b[1])
+}
@@ -0,0 +1,134 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Subscriptions are authorized once, on subscribe. Access can be lost
+// afterwards in ways RevokeMembership doesn't cover: a role change, a
+// project or node being deleted, an org policy change such as its IP
+// allowlist. Every instance periodically re-checks its clients'
+// subscriptions and drops those that no longer pass, so removed users stop
+// receiving live data. RevalidateAccess
+// re-checks one user's subscriptions right away on every instance.
+const (
+	revalidatePeriod = 2 * time.Minute
+
+	// Reason sent in subscription_revoked when a re-check fails
+	revokeReasonAccess = "access_revoked"
+)
+
+// subscriptionRef is one client's subscription to a channel
+type subscriptionRef struct {
+	client  *Client
+	channel string
+}
+
+// RevalidateAccess re-checks the user's subscriptions on every instance,
+// e.g. after their role changed
+func (h *Hub) RevalidateAccess(userID uuid.UUID) {
+	go h.revalidate(userID.String())
+	h.publishControl(ControlMessage{Type: ControlRevalidateAccess, UserID: userID})
+}
+
+// revalidateSubscriptions periodically re-checks every local subscription
+func (h *Hub) revalidateSubscriptions() {
+	ticker := time.NewTicker(revalidatePeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		h.revalidate("")
+	}
+}
+
+// revalidate re-authorizes the subscriptions of one user, or of everyone
+// when userID is empty, and revokes those that are now denied
+func (h *Hub) revalidate(userID string) {
+	var refs []subscriptionRef
+	h.mu.RLock()
+	for client := range h.clients {
+		if userID != "" && client.UserID != userID {
+			continue
+		}
+		for channel := range client.subscriptions {
+			refs = append(refs, subscriptionRef{client: client, channel: channel})
+		}
+	}
+	h.mu.RUnlock()
+
+	// Authorization depends only on the user, client IP and channel, so
+	// each is checked once however many connections share it
+	denied := make(map[[3]string]bool)
+	checked := make(map[[3]string]bool)
+	for _, ref := range refs {
+		key := [3]string{ref.client.UserID, ref.client.IP, ref.channel}
+		if checked[key] {
+			continue
+		}
+		checked[key] = true
+		if h.accessDenied(ref.client.UserID, ref.client.IP, ref.channel) {
+			denied[key] = true
+		}
+	}
+	if len(denied) == 0 {
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, ref := range refs {
+		if !denied[[3]string{ref.client.UserID, ref.client.IP, ref.channel}] {
+			continue
+		}
+		// The client may have left or unsubscribed during the checks
+		if !h.clients[ref.client] {
+			continue
+		}
+		if _, ok := ref.client.subscriptions[ref.channel]; !ok {
+			continue
+		}
+		delete(ref.client.subscriptions, ref.channel)
+		h.removeFromChannel(ref.client, ref.channel)
+		ref.client.sendMessage(NewMessage(MsgTypeSubscriptionRevoked, SubscriptionRevokedPayload{
+			Channel: ref.channel,
+			Reason:  revokeReasonAccess,
+		}))
+		h.logger.Info("Revoked WebSocket subscription after access check",
+			zap.String("userId", ref.client.UserID),
+			zap.String("channel", ref.channel),
+		)
+	}
+}
+
+// accessDenied reports whether the user, connected from clientIP, is no
+// longer authorized for the channel. Lookup failures keep the subscription;
+// the next pass retries.
+func (h *Hub) accessDenied(userID, clientIP, channel string) bool {
+	ch, err := ParseChannel(channel)
+	if err != nil {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, authorizeTimeout)
+	defer cancel()
+	_, err = h.authorize(ctx, userID, clientIP, ch)
+	if err != nil && !errors.Is(err, ErrUnauthorized) {
+		h.logger.Warn("Failed to revalidate subscription",
+			zap.String("userId", userID),
+			zap.String("channel", channel),
+			zap.Error(err),
+		)
+		return false
+	}
+	return errors.Is(err, ErrUnauthorized)
+}
@@ -0,0 +1,185 @@
+package websocket
+
+import (
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Events are published to one of a fixed set of Redis shard channels chosen
+// by hashing the WebSocket channel. Each instance subscribes only to the
+// shards covering channels its clients are subscribed to, so it no longer
+// receives (and decodes) every event in the cluster.
+const (
+	redisShardPrefix = "glassbox:ws:shard:"
+	redisShardCount  = 256
+
+	// Unused shards are unsubscribed lazily, and failed subscribes retried,
+	// at this interval
+	shardSyncInterval = 30 * time.Second
+)
+
+// redisShard returns the Redis pub/sub channel carrying a WebSocket channel
+func redisShard(channel string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(channel))
+	return redisShardPrefix + strconv.FormatUint(uint64(hash.Sum32()%redisShardCount), 10)
+}
+
+// userRoute is the routing key for events addressed to a user rather than a
+// channel
+func userRoute(userID string) string {
+	return "user:" + userID
+}
+
+// shardRouter tracks which shards this instance needs and keeps the Redis
+// subscription in line with them
+type shardRouter struct {
+	// Local routing keys (channels, and users with connected clients) per
+	// shard; guarded by Hub.mu
+	refs map[string]int
+
+	// Serializes SUBSCRIBE/UNSUBSCRIBE and guards subscribed
+	mu         sync.Mutex
+	subscribed map[string]bool
+
+	// Signals the sync loop that shards may have become unused
+	released chan struct{}
+}
+
+func newShardRouter() *shardRouter {
+	return &shardRouter{
+		refs:       make(map[string]int),
+		subscribed: make(map[string]bool),
+		released:   make(chan struct{}, 1),
+	}
+}
+
+// acquire records a routing key as needed locally. It returns true when its
+// shard was not needed before, in which case the caller must call syncShards
+// after releasing the lock. Callers must hold h.mu.
+func (r *shardRouter) acquire(key string) bool {
+	shard := redisShard(key)
+	r.refs[shard]++
+	return r.refs[shard] == 1
+}
+
+// release undoes acquire. Callers must hold h.mu.
+func (r *shardRouter) release(key string) {
+	shard := redisShard(key)
+	r.refs[shard]--
+	if r.refs[shard] <= 0 {
+		delete(r.refs, shard)
+		select {
+		case r.released <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// addToChannel subscribes a client to a channel locally. It returns true when
+// the channel's shard was not needed before (see shardRouter.acquire).
+// Callers must hold h.mu.
+func (h *Hub) addToChannel(client *Client, channel string) bool {
+	newShard := false
+	if h.channels[channel] == nil {
+		h.channels[channel] = make(map[*Client]bool)
+		newShard = h.shards.acquire(channel)
+	}
+	h.channels[channel][client] = true
+	return newShard
+}
+
+// removeFromChannel unsubscribes a client from a channel locally. Callers
+// must hold h.mu.
+func (h *Hub) removeFromChannel(client *Client, channel string) {
+	if h.channels[channel] == nil {
+		return
+	}
+	delete(h.channels[channel], client)
+	if len(h.channels[channel]) > 0 {
+		return
+	}
+	delete(h.channels, channel)
+	h.shards.release(channel)
+}
+
+// syncShards subscribes to shards that local channels need and, when prune
+// is set, unsubscribes from shards they no longer use
+func (h *Hub) syncShards(prune bool) {
+	if h.pubsub == nil {
+		return
+	}
+
+	h.shards.mu.Lock()
+	defer h.shards.mu.Unlock()
+
+	var add, remove []string
+	h.mu.RLock()
+	for shard := range h.shards.refs {
+		if !h.shards.subscribed[shard] {
+			add = append(add, shard)
+		}
+	}
+	if prune {
+		for shard := range h.shards.subscribed {
+			if h.shards.refs[shard] == 0 {
+				remove = append(remove, shard)
+			}
+		}
+	}
+	h.mu.RUnlock()
+
+	if len(add) > 0 {
+		if err := h.pubsub.Subscribe(h.ctx, add...); err != nil {
+			h.logger.Error("Failed to subscribe to Redis shards", zap.Error(err))
+		} else {
+			for _, shard := range add {
+				h.shards.subscribed[shard] = true
+			}
+		}
+	}
+	if len(remove) > 0 {
+		if err := h.pubsub.Unsubscribe(h.ctx, remove...); err != nil {
+			h.logger.Error("Failed to unsubscribe from Redis shards", zap.Error(err))
+		} else {
+			for _, shard := range remove {
+				delete(h.shards.subscribed, shard)
+			}
+		}
+	}
+}
+
+// pruneShards drops shard subscriptions that are no longer needed. Pruning is
+// batched so a channel that is briefly empty doesn't churn its subscription.
+func (h *Hub) pruneShards() {
+	if h.pubsub == nil {
+		return
+	}
+
+	ticker := time.NewTicker(shardSyncInterval)
+	defer ticker.Stop()
+
+	pending := false
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-h.shards.released:
+			pending = true
+		case <-ticker.C:
+			h.syncShards(pending)
+			pending = false
+		}
+	}
+}
+
+// subscribedShards reports how many shards this instance listens to
+func (h *Hub) subscribedShards() int {
+	h.shards.mu.Lock()
+	defer h.shards.mu.Unlock()
+	return len(h.shards.subscribed)
+}
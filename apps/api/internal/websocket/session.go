@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Every connection is given a session token in a session message when it
+// opens. The server keeps the session's channel list, saved whenever it
+// changes and when the connection closes, so a reconnecting client can send
+// one resume message with the token instead of subscribing to each channel
+// again. Channels are re-authorized on resume, and missed events are
+// replayed from the lastEventIds the client sends.
+//
+// Sessions live in Redis so a client can resume on any instance; without
+// Redis they are kept in memory.
+const (
+	sessionKeyPrefix   = "ws:session:"
+	sessionTTL         = 10 * time.Minute
+	sessionSaveTimeout = 2 * time.Second
+
+	// Channels restored by one resume; the rest are left to the client
+	maxSessionChannels = 200
+)
+
+// storedSession is a session's saved state
+type storedSession struct {
+	UserID   string   `json:"userId"`
+	Channels []string `json:"channels"`
+}
+
+// sessionStore keeps sessions in memory when there is no Redis
+type sessionStore struct {
+	mu    sync.Mutex
+	local map[string]localSession
+}
+
+type localSession struct {
+	storedSession
+	expiresAt time.Time
+}
+
+func newSessionStore() *sessionStore {
+	return &sessionStore{local: make(map[string]localSession)}
+}
+
+func newSessionToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// sessionSnapshot returns the client's session state. Caller must hold h.mu.
+func sessionSnapshot(client *Client) storedSession {
+	channels := make([]string, 0, len(client.subscriptions))
+	for channel := range client.subscriptions {
+		channels = append(channels, channel)
+	}
+	sort.Strings(channels)
+	return storedSession{UserID: client.UserID, Channels: channels}
+}
+
+// saveSession stores the client's current subscriptions under its session
+func (h *Hub) saveSession(client *Client) {
+	h.mu.RLock()
+	token := client.session
+	snapshot := sessionSnapshot(client)
+	h.mu.RUnlock()
+
+	h.storeSession(token, snapshot)
+}
+
+func (h *Hub) storeSession(token string, session storedSession) {
+	if token == "" {
+		return
+	}
+
+	if h.redis == nil {
+		s := h.sessions
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		now := time.Now()
+		for t, existing := range s.local {
+			if now.After(existing.expiresAt) {
+				delete(s.local, t)
+			}
+		}
+		s.local[token] = localSession{storedSession: session, expiresAt: now.Add(sessionTTL)}
+		return
+	}
+
+	data, err := json.Marshal(session)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), sessionSaveTimeout)
+	defer cancel()
+	if err := h.redis.Client.Set(ctx, sessionKeyPrefix+token, data, sessionTTL).Err(); err != nil {
+		// The client falls back to subscribing channel by channel
+		h.logger.Warn("Failed to save WebSocket session", zap.Error(err))
+	}
+}
+
+// loadSession returns a stored session, or nil if it doesn't exist or has
+// expired
+func (h *Hub) loadSession(ctx context.Context, token string) (*storedSession, error) {
+	if h.redis == nil {
+		s := h.sessions
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		session, ok := s.local[token]
+		if !ok || time.Now().After(session.expiresAt) {
+			return nil, nil
+		}
+		return &session.storedSession, nil
+	}
+
+	data, err := h.redis.Client.Get(ctx, sessionKeyPrefix+token).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session storedSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// startSession gives a new connection its session token. Call before
+// registering the client.
+func (c *Client) startSession() {
+	c.session = newSessionToken()
+	c.sendMessage(NewMessage(MsgTypeSession, SessionPayload{
+		SessionToken: c.session,
+		ExpiresAt:    optionalTime(c.extendSession()),
+	}))
+}
+
+// handleResume restores the subscriptions of a previous connection's session
+func (c *Client) handleResume(msg *Message) {
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil {
+		c.sendError("invalid_payload", "Invalid resume payload")
+		return
+	}
+
+	var payload ResumePayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil || payload.SessionToken == "" {
+		c.sendErrorFor(msg, "invalid_payload", "Invalid resume payload")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, sessionSaveTimeout)
+	session, err := c.hub.loadSession(ctx, payload.SessionToken)
+	cancel()
+	if err != nil {
+		c.logger.Warn("Failed to load WebSocket session",
+			zap.String("userId", c.UserID),
+			zap.Error(err),
+		)
+	}
+	// Another user's token is treated as unknown
+	if session == nil || session.UserID != c.UserID {
+		c.sendErrorFor(msg, "session_not_found", "Session expired or not found; subscribe to channels again")
+		return
+	}
+
+	channels := session.Channels
+	if len(channels) > maxSessionChannels {
+		channels = channels[:maxSessionChannels]
+	}
+
+	resumed := ResumedPayload{
+		SessionToken: payload.SessionToken,
+		Channels:     []SubscribedPayload{},
+	}
+	var replayed []*Message
+	for _, channel := range channels {
+		confirmation, events, err := c.subscribe(channel, payload.LastEventIDs[channel])
+		if err != nil {
+			if !errors.Is(err, ErrUnauthorized) && !errors.Is(err, ErrInvalidChannel) {
+				c.logger.Warn("Failed to restore subscription",
+					zap.String("userId", c.UserID),
+					zap.String("channel", channel),
+					zap.Error(err),
+				)
+			}
+			resumed.Failed = append(resumed.Failed, channel)
+			continue
+		}
+		resumed.Channels = append(resumed.Channels, *confirmation)
+		replayed = append(replayed, events...)
+	}
+
+	// This connection carries on the session
+	c.hub.mu.Lock()
+	c.session = payload.SessionToken
+	c.hub.mu.Unlock()
+	c.hub.saveSession(c)
+
+	response := NewMessage(MsgTypeResumed, resumed)
+	response.RequestID = msg.RequestID
+	c.sendMessage(response)
+	for _, event := range replayed {
+		c.sendMessage(event)
+	}
+
+	c.logger.Debug("Client resumed session",
+		zap.String("userId", c.UserID),
+		zap.Int("channels", len(resumed.Channels)),
+		zap.Int("failed", len(resumed.Failed)),
+	)
+}
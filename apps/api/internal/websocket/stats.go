@@ -0,0 +1,227 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Each instance counts what its hub does and periodically writes a snapshot
+// to Redis, so the admin endpoint can show every instance from any of them.
+const (
+	statsKeyPrefix      = "ws:stats:"
+	statsPublishPeriod  = 15 * time.Second
+	statsTTL            = 3 * statsPublishPeriod
+	maxReportedChannels = 100
+
+	// Weight of the newest sample in the pub/sub lag moving average
+	lagSmoothing = 0.1
+)
+
+// StatsReader reports WebSocket hub statistics
+type StatsReader interface {
+	Stats() *HubStats
+	ClusterStats(ctx context.Context) ([]*HubStats, error)
+}
+
+// Ensure Hub implements StatsReader
+var _ StatsReader = (*Hub)(nil)
+
+// HubStats is a snapshot of one instance's hub
+type HubStats struct {
+	InstanceID string    `json:"instanceId"`
+	CapturedAt time.Time `json:"capturedAt"`
+
+	Clients  int `json:"clients"`
+	Users    int `json:"users"`
+	Channels int `json:"channels"`
+	// Busiest channels first, at most maxReportedChannels
+	TopChannels []ChannelStats `json:"topChannels"`
+
+	MessagesDropped    uint64 `json:"messagesDropped"`    // send buffer full
+	Redeliveries       uint64 `json:"redeliveries"`       // unacknowledged events resent
+	InboundRateLimited uint64 `json:"inboundRateLimited"` // client messages dropped by the rate limit
+	Disconnects        uint64 `json:"disconnects"`        // clients dropped for rate or ack violations
+	IdleDisconnects    uint64 `json:"idleDisconnects"`    // clients closed after the idle timeout
+	ConnectionsLimited uint64 `json:"connectionsLimited"` // connections refused by the user or org cap
+
+	PubSub PubSubStats `json:"pubsub"`
+}
+
+// ChannelStats counts a channel's local subscribers
+type ChannelStats struct {
+	Channel     string `json:"channel"`
+	Subscribers int    `json:"subscribers"`
+}
+
+// PubSubStats describes cross-instance delivery through Redis. Lag is the
+// time from publish on one instance to receipt on this one, so it includes
+// clock skew between hosts.
+type PubSubStats struct {
+	Published     uint64  `json:"published"`
+	PublishErrors uint64  `json:"publishErrors"`
+	Received      uint64  `json:"received"`
+	LastLagMs     float64 `json:"lastLagMs"`
+	AvgLagMs      float64 `json:"avgLagMs"`
+	MaxLagMs      float64 `json:"maxLagMs"`
+	// Redis shard channels this instance listens on
+	SubscribedShards int `json:"subscribedShards"`
+}
+
+// hubMetrics are the hub's running counters
+type hubMetrics struct {
+	messagesDropped    atomic.Uint64
+	redeliveries       atomic.Uint64
+	inboundRateLimited atomic.Uint64
+	disconnects        atomic.Uint64
+	idleDisconnects    atomic.Uint64
+	connectionsLimited atomic.Uint64
+	published          atomic.Uint64
+	publishErrors      atomic.Uint64
+	received           atomic.Uint64
+
+	lagMu   sync.Mutex
+	lastLag time.Duration
+	avgLag  float64 // ms
+	maxLag  time.Duration
+}
+
+func (m *hubMetrics) observeLag(lag time.Duration) {
+	if lag < 0 {
+		lag = 0
+	}
+	m.lagMu.Lock()
+	defer m.lagMu.Unlock()
+
+	ms := float64(lag) / float64(time.Millisecond)
+	if m.received.Load() <= 1 {
+		m.avgLag = ms
+	} else {
+		m.avgLag += lagSmoothing * (ms - m.avgLag)
+	}
+	m.lastLag = lag
+	m.maxLag = max(m.maxLag, lag)
+}
+
+// Stats returns a snapshot of this instance's hub
+func (h *Hub) Stats() *HubStats {
+	stats := &HubStats{
+		InstanceID:         h.instanceID,
+		CapturedAt:         time.Now(),
+		MessagesDropped:    h.metrics.messagesDropped.Load(),
+		Redeliveries:       h.metrics.redeliveries.Load(),
+		InboundRateLimited: h.metrics.inboundRateLimited.Load(),
+		Disconnects:        h.metrics.disconnects.Load(),
+		IdleDisconnects:    h.metrics.idleDisconnects.Load(),
+		ConnectionsLimited: h.metrics.connectionsLimited.Load(),
+		PubSub: PubSubStats{
+			Published:     h.metrics.published.Load(),
+			PublishErrors: h.metrics.publishErrors.Load(),
+			Received:      h.metrics.received.Load(),
+		},
+	}
+
+	h.metrics.lagMu.Lock()
+	stats.PubSub.LastLagMs = float64(h.metrics.lastLag) / float64(time.Millisecond)
+	stats.PubSub.AvgLagMs = h.metrics.avgLag
+	stats.PubSub.MaxLagMs = float64(h.metrics.maxLag) / float64(time.Millisecond)
+	h.metrics.lagMu.Unlock()
+	stats.PubSub.SubscribedShards = h.subscribedShards()
+
+	h.mu.RLock()
+	stats.Clients = len(h.clients)
+	stats.Users = len(h.clientsByUser)
+	stats.Channels = len(h.channels)
+	channels := make([]ChannelStats, 0, len(h.channels))
+	for channel, clients := range h.channels {
+		channels = append(channels, ChannelStats{Channel: channel, Subscribers: len(clients)})
+	}
+	h.mu.RUnlock()
+
+	sort.Slice(channels, func(i, j int) bool {
+		if channels[i].Subscribers != channels[j].Subscribers {
+			return channels[i].Subscribers > channels[j].Subscribers
+		}
+		return channels[i].Channel < channels[j].Channel
+	})
+	if len(channels) > maxReportedChannels {
+		channels = channels[:maxReportedChannels]
+	}
+	stats.TopChannels = channels
+
+	return stats
+}
+
+// ClusterStats returns the latest snapshot from every live instance,
+// including this one
+func (h *Hub) ClusterStats(ctx context.Context) ([]*HubStats, error) {
+	local := h.Stats()
+	all := []*HubStats{local}
+	if h.redis == nil {
+		return all, nil
+	}
+
+	var keys []string
+	iter := h.redis.Client.Scan(ctx, 0, statsKeyPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		if iter.Val() != statsKeyPrefix+h.instanceID {
+			keys = append(keys, iter.Val())
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return all, nil
+	}
+
+	values, err := h.redis.Client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range values {
+		raw, ok := v.(string)
+		if !ok {
+			continue
+		}
+		var stats HubStats
+		if json.Unmarshal([]byte(raw), &stats) == nil {
+			all = append(all, &stats)
+		}
+	}
+
+	sort.Slice(all[1:], func(i, j int) bool { return all[i+1].InstanceID < all[j+1].InstanceID })
+	return all, nil
+}
+
+// publishStats periodically writes this instance's snapshot to Redis
+func (h *Hub) publishStats() {
+	if h.redis == nil {
+		return
+	}
+
+	ticker := time.NewTicker(statsPublishPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			h.redis.Client.Del(context.Background(), statsKeyPrefix+h.instanceID)
+			return
+		case <-ticker.C:
+		}
+
+		data, err := json.Marshal(h.Stats())
+		if err != nil {
+			continue
+		}
+		if err := h.redis.Client.Set(h.ctx, statsKeyPrefix+h.instanceID, data, statsTTL).Err(); err != nil {
+			h.logger.Warn("Failed to publish WebSocket stats", zap.Error(err))
+		}
+	}
+}
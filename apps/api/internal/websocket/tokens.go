@@ -0,0 +1,128 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// A connection stays authenticated for the session lifetime after its WS
+// token was validated. Before that runs out the client fetches a new WS
+// token and sends it in a refresh_token message, which extends the
+// connection without dropping it and its subscriptions. Connections that
+// don't refresh are closed with CloseSessionExpired.
+const (
+	CloseSessionExpired       = 4001
+	CloseReasonSessionExpired = "session_expired"
+
+	sessionExpiryCheckPeriod = 15 * time.Second
+	refreshTokenTimeout      = 5 * time.Second
+)
+
+// EnableTokenRefresh lets the client extend its session with new WS tokens,
+// checked by validate. Call before registering the client.
+func (c *Client) EnableTokenRefresh(validate TokenValidator) {
+	c.validateToken = validate
+}
+
+// extendSession restarts the client's session lifetime and returns when it
+// now expires; zero when sessions don't expire
+func (c *Client) extendSession() time.Time {
+	lifetime := c.hub.limits.SessionLifetime
+	if lifetime <= 0 {
+		return time.Time{}
+	}
+	expires := time.Now().Add(lifetime)
+	c.sessionExpiry.Store(expires.UnixNano())
+	return expires
+}
+
+// sessionExpires returns when the client's session expires; zero if never
+func (c *Client) sessionExpires() time.Time {
+	if n := c.sessionExpiry.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// handleRefreshToken validates a new WS token for the connection's user and
+// extends the session
+func (c *Client) handleRefreshToken(msg *Message) {
+	if c.validateToken == nil {
+		c.sendErrorFor(msg, "unsupported", "Token refresh is not available")
+		return
+	}
+
+	payloadBytes, err := json.Marshal(msg.Payload)
+	if err != nil {
+		c.sendError("invalid_payload", "Invalid refresh_token payload")
+		return
+	}
+	var payload RefreshTokenPayload
+	if err := json.Unmarshal(payloadBytes, &payload); err != nil || payload.Token == "" {
+		c.sendErrorFor(msg, "invalid_payload", "Invalid refresh_token payload")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.hub.ctx, refreshTokenTimeout)
+	data, err := c.validateToken(ctx, payload.Token)
+	cancel()
+	if err != nil {
+		c.logger.Warn("Invalid WS token on refresh",
+			zap.String("userId", c.UserID),
+			zap.Error(err),
+		)
+		c.sendErrorFor(msg, "invalid_token", "Invalid or expired token")
+		return
+	}
+	// A token for someone else can't take over the connection
+	if data.UserID != c.UserID {
+		c.sendErrorFor(msg, "invalid_token", "Token belongs to a different user")
+		return
+	}
+
+	response := NewMessage(MsgTypeTokenRefreshed, TokenRefreshedPayload{
+		ExpiresAt: optionalTime(c.extendSession()),
+	})
+	response.RequestID = msg.RequestID
+	c.sendMessage(response)
+}
+
+// expireSessions periodically closes connections whose session lifetime ran
+// out without a token refresh
+func (h *Hub) expireSessions() {
+	if h.limits.SessionLifetime <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(sessionExpiryCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		for _, client := range h.clientList() {
+			if expires := client.sessionExpires(); !expires.IsZero() && now.After(expires) {
+				client.logger.Info("Closing WebSocket connection with expired session",
+					zap.String("userId", client.UserID),
+				)
+				// ReadPump unregisters the client once the connection closes
+				client.closeWith(CloseSessionExpired, CloseReasonSessionExpired)
+			}
+		}
+	}
+}
+
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,132 @@
+// Package wstest provides in-memory stand-ins for the WebSocket hub, so
+// handlers and services that broadcast can be tested without Redis or real
+// sockets.
+//
+// Hub runs the real hub in memory and connects clients to it in-process,
+// for tests of what clients receive. Recorder only records Broadcaster
+// calls, for tests of what was broadcast.
+package wstest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Hub is a running, single-instance hub without Redis
+type Hub struct {
+	*websocket.Hub
+}
+
+// NewHub starts an in-memory hub. authorize decides subscriptions; nil
+// allows every channel. Call Close when done.
+func NewHub(authorize websocket.ChannelAuthorizer) *Hub {
+	if authorize == nil {
+		authorize = func(ctx context.Context, userID, clientIP string, ch *websocket.Channel) (uuid.UUID, error) {
+			return uuid.Nil, nil
+		}
+	}
+	hub := websocket.NewHub(nil, authorize, zap.NewNop())
+	go hub.Run()
+	return &Hub{Hub: hub}
+}
+
+// Close stops the hub
+func (h *Hub) Close() {
+	h.Stop()
+}
+
+// Connect opens an in-process connection for a user and consumes its
+// session message
+func (h *Hub) Connect(ctx context.Context, userID string) (*Client, error) {
+	conn := h.ConnectLocal(userID, userID+"@example.com", "")
+	c := &Client{LocalConn: conn}
+	msg, err := c.Expect(ctx, websocket.MsgTypeSession)
+	if err != nil {
+		return nil, err
+	}
+	var session websocket.SessionPayload
+	if err := websocket.DecodePayload(msg, &session); err != nil {
+		return nil, err
+	}
+	c.SessionToken = session.SessionToken
+	return c, nil
+}
+
+// Client is a test client connected to a Hub. It is not safe for concurrent
+// use.
+type Client struct {
+	*websocket.LocalConn
+
+	// Token for resuming the connection's session
+	SessionToken string
+
+	requests int
+}
+
+// Request sends a message with a new request ID and returns the reply to it.
+// Other messages received meanwhile are discarded. A reply of type error is
+// returned as an *ErrorReply.
+func (c *Client) Request(ctx context.Context, msgType websocket.MessageType, payload any) (*websocket.Message, error) {
+	c.requests++
+	msg := websocket.NewMessage(msgType, payload)
+	msg.RequestID = fmt.Sprintf("wstest-%d", c.requests)
+	if err := c.Send(msg); err != nil {
+		return nil, err
+	}
+
+	for {
+		reply, err := c.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if reply.RequestID != msg.RequestID {
+			continue
+		}
+		if reply.Type == websocket.MsgTypeError {
+			var e ErrorReply
+			websocket.DecodePayload(reply, &e.ErrorPayload)
+			return reply, &e
+		}
+		return reply, nil
+	}
+}
+
+// Subscribe subscribes to a channel and waits for the confirmation
+func (c *Client) Subscribe(ctx context.Context, channel string) error {
+	_, err := c.Request(ctx, websocket.MsgTypeSubscribe, websocket.SubscribePayload{Channel: channel})
+	return err
+}
+
+// Expect returns the next message of the given type, discarding any others
+// received first
+func (c *Client) Expect(ctx context.Context, msgType websocket.MessageType) (*websocket.Message, error) {
+	for {
+		msg, err := c.Receive(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if msg.Type == msgType {
+			return msg, nil
+		}
+	}
+}
+
+// ErrorReply is an error message sent in reply to a request
+type ErrorReply struct {
+	websocket.ErrorPayload
+}
+
+func (e *ErrorReply) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// IsErrorCode reports whether err is an error reply with the given code
+func IsErrorCode(err error, code string) bool {
+	var e *ErrorReply
+	return errors.As(err, &e) && e.Code == code
+}
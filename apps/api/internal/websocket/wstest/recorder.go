@@ -0,0 +1,140 @@
+package wstest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/glassbox/api/internal/websocket"
+	"github.com/google/uuid"
+)
+
+// Call is one recorded Broadcaster call: the method name and its arguments
+// in order
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Recorder implements websocket.Realtime by recording every Broadcaster
+// call. Presence answers from the Presence map; stats are empty.
+type Recorder struct {
+	// Node ID -> users present, returned by ClusterPresence
+	Presence map[string][]*websocket.PresenceInfo
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// Ensure Recorder implements Realtime
+var _ websocket.Realtime = (*Recorder)(nil)
+
+// NewRecorder creates an empty Recorder
+func NewRecorder() *Recorder {
+	return &Recorder{Presence: make(map[string][]*websocket.PresenceInfo)}
+}
+
+// Calls returns every recorded call, oldest first
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call(nil), r.calls...)
+}
+
+// CallsTo returns the recorded calls of one method, oldest first
+func (r *Recorder) CallsTo(method string) []Call {
+	var calls []Call
+	for _, call := range r.Calls() {
+		if call.Method == method {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// Reset forgets the recorded calls
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = nil
+}
+
+func (r *Recorder) record(method string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, Call{Method: method, Args: args})
+}
+
+func (r *Recorder) BroadcastNodeCreated(projectID, nodeID uuid.UUID, title, status, updatedBy string) {
+	r.record("BroadcastNodeCreated", projectID, nodeID, title, status, updatedBy)
+}
+
+func (r *Recorder) BroadcastNodeUpdated(projectID, nodeID uuid.UUID, title, status, updatedBy string, changes map[string]any) {
+	r.record("BroadcastNodeUpdated", projectID, nodeID, title, status, updatedBy, changes)
+}
+
+func (r *Recorder) BroadcastNodeDeleted(projectID, nodeID uuid.UUID, updatedBy string) {
+	r.record("BroadcastNodeDeleted", projectID, nodeID, updatedBy)
+}
+
+func (r *Recorder) BroadcastLockAcquired(nodeID uuid.UUID, lockedBy, userEmail string, expiresAt time.Time) {
+	r.record("BroadcastLockAcquired", nodeID, lockedBy, userEmail, expiresAt)
+}
+
+func (r *Recorder) BroadcastLockReleased(nodeID uuid.UUID, releasedBy string) {
+	r.record("BroadcastLockReleased", nodeID, releasedBy)
+}
+
+func (r *Recorder) BroadcastExecutionUpdate(nodeID, executionID uuid.UUID, status string, tokensIn, tokensOut int, traceSummary string) {
+	r.record("BroadcastExecutionUpdate", nodeID, executionID, status, tokensIn, tokensOut, traceSummary)
+}
+
+func (r *Recorder) BroadcastExecutionProgress(progress websocket.ExecutionProgressPayload) {
+	r.record("BroadcastExecutionProgress", progress)
+}
+
+func (r *Recorder) BroadcastMembershipChanged(orgID, userID uuid.UUID, change, role, changedBy string) {
+	r.record("BroadcastMembershipChanged", orgID, userID, change, role, changedBy)
+}
+
+func (r *Recorder) BroadcastNotification(orgID uuid.UUID, notification websocket.NotificationPayload) {
+	r.record("BroadcastNotification", orgID, notification)
+}
+
+func (r *Recorder) PushNotification(userID uuid.UUID, notification websocket.NotificationPayload, unreadCount int) {
+	r.record("PushNotification", userID, notification, unreadCount)
+}
+
+func (r *Recorder) BroadcastQuotaWarning(orgID uuid.UUID, quota string, used, limit int64) {
+	r.record("BroadcastQuotaWarning", orgID, quota, used, limit)
+}
+
+func (r *Recorder) BroadcastFileProcessing(update websocket.FileProcessingPayload) {
+	r.record("BroadcastFileProcessing", update)
+}
+
+func (r *Recorder) SendUserMessage(userID uuid.UUID, message websocket.UserMessagePayload) {
+	r.record("SendUserMessage", userID, message)
+}
+
+func (r *Recorder) RevokeMembership(orgID, userID uuid.UUID) {
+	r.record("RevokeMembership", orgID, userID)
+}
+
+func (r *Recorder) RevalidateAccess(userID uuid.UUID) {
+	r.record("RevalidateAccess", userID)
+}
+
+func (r *Recorder) ClusterPresence(ctx context.Context, nodeID string) ([]*websocket.PresenceInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Presence[nodeID], nil
+}
+
+func (r *Recorder) Stats() *websocket.HubStats {
+	return &websocket.HubStats{InstanceID: "wstest", CapturedAt: time.Now()}
+}
+
+func (r *Recorder) ClusterStats(ctx context.Context) ([]*websocket.HubStats, error) {
+	return []*websocket.HubStats{r.Stats()}, nil
+}
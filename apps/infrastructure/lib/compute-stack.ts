@@ -168,8 +168,9 @@ export class ComputeStack extends cdk.Stack {
       },
       portMappings: [{ containerPort: 8080 }],
       healthCheck: {
+        // Liveness only: a dependency outage shouldn't get the task replaced.
         // Use GET request (-O /dev/null) instead of HEAD (--spider) for more reliable health checks
-        command: ['CMD-SHELL', 'wget --no-verbose --tries=1 -O /dev/null http://localhost:8080/health || exit 1'],
+        command: ['CMD-SHELL', 'wget --no-verbose --tries=1 -O /dev/null http://localhost:8080/health/live || exit 1'],
         interval: cdk.Duration.seconds(30),
         timeout: cdk.Duration.seconds(10),
         retries: 5,
@@ -210,7 +211,9 @@ export class ComputeStack extends cdk.Stack {
       protocol: elbv2.ApplicationProtocol.HTTP,
       targetType: elbv2.TargetType.IP,
       healthCheck: {
-        path: '/health',
+        // Readiness: stop routing to a task that can't reach its dependencies
+        // or is shutting down
+        path: '/health/ready',
         interval: cdk.Duration.seconds(30),
         timeout: cdk.Duration.seconds(10),
         healthyThresholdCount: 2,
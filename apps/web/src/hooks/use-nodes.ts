@@ -5,7 +5,7 @@ import type { CreateNodeRequest, UpdateNodeRequest } from '@glassbox/shared-type
 export function useNodes(projectId: string, parentId?: string) {
   return useQuery({
     queryKey: ['nodes', projectId, parentId],
-    queryFn: () => nodesAPI.list(projectId, { parentId }),
+    queryFn: () => nodesAPI.listAll(projectId, { parentId }),
     enabled: !!projectId,
   });
 }
@@ -5,7 +5,7 @@ import type { Organization } from '@glassbox/shared-types';
 export function useOrganizations() {
   return useQuery({
     queryKey: ['organizations'],
-    queryFn: () => orgsAPI.list(),
+    queryFn: () => orgsAPI.listAll(),
   });
 }
 
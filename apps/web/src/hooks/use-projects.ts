@@ -5,7 +5,7 @@ import type { Project } from '@glassbox/shared-types';
 export function useProjects(orgId: string) {
   return useQuery({
     queryKey: ['projects', orgId],
-    queryFn: () => projectsAPI.list(orgId),
+    queryFn: () => projectsAPI.listAll(orgId),
     enabled: !!orgId,
   });
 }
@@ -11,11 +11,18 @@ import type {
   FileUploadRequest,
   FileUploadResponse,
 } from '@glassbox/shared-types';
+import type { NodePresenceEntry } from './websocket/types';
 
 const API_BASE = process.env.NEXT_PUBLIC_API_URL || '';
 
 class APIError extends Error {
-  constructor(public status: number, message: string) {
+  constructor(
+    public status: number,
+    message: string,
+    public code?: string,
+    public details?: Record<string, unknown>,
+    public requestId?: string
+  ) {
     super(message);
     this.name = 'APIError';
   }
@@ -38,7 +45,13 @@ async function fetchAPI<T>(
 
   if (!response.ok) {
     const error = await response.json().catch(() => ({ message: 'Unknown error' }));
-    throw new APIError(response.status, error.message || 'Request failed');
+    throw new APIError(
+      response.status,
+      error.message || 'Request failed',
+      error.code,
+      error.details,
+      error.requestId
+    );
   }
 
   if (response.status === 204) {
@@ -48,9 +61,43 @@ async function fetchAPI<T>(
   return response.json();
 }
 
+// Largest page size list endpoints accept
+const MAX_PAGE_SIZE = 200;
+
+export interface PageParams {
+  cursor?: string;
+  limit?: number;
+}
+
+// withPage adds cursor and limit to an endpoint's query string
+function withPage(endpoint: string, page?: PageParams): string {
+  const [path, query = ''] = endpoint.split('?');
+  const searchParams = new URLSearchParams(query);
+  if (page?.cursor) searchParams.set('cursor', page.cursor);
+  if (page?.limit) searchParams.set('limit', String(page.limit));
+  const search = searchParams.toString();
+  return search ? `${path}?${search}` : path;
+}
+
+// fetchAllPages follows nextCursor until the last page of a list
+async function fetchAllPages<T>(endpoint: string): Promise<{ data: T[] }> {
+  const data: T[] = [];
+  let cursor: string | undefined;
+  do {
+    const page = await fetchAPI<PaginatedResponse<T>>(
+      withPage(endpoint, { cursor, limit: MAX_PAGE_SIZE })
+    );
+    data.push(...page.data);
+    cursor = page.pagination?.hasMore ? page.pagination.nextCursor : undefined;
+  } while (cursor);
+  return { data };
+}
+
 // Organizations
 export const orgsAPI = {
-  list: () => fetchAPI<{ data: Organization[] }>('/api/v1/orgs'),
+  list: (page?: PageParams) =>
+    fetchAPI<PaginatedResponse<Organization>>(withPage('/api/v1/orgs', page)),
+  listAll: () => fetchAllPages<Organization>('/api/v1/orgs'),
   get: (id: string) => fetchAPI<Organization>(`/api/v1/orgs/${id}`),
   create: (data: Partial<Organization>) =>
     fetchAPI<Organization>('/api/v1/orgs', {
@@ -68,8 +115,9 @@ export const orgsAPI = {
 
 // Projects
 export const projectsAPI = {
-  list: (orgId: string) =>
-    fetchAPI<{ data: Project[] }>(`/api/v1/orgs/${orgId}/projects`),
+  list: (orgId: string, page?: PageParams) =>
+    fetchAPI<PaginatedResponse<Project>>(withPage(`/api/v1/orgs/${orgId}/projects`, page)),
+  listAll: (orgId: string) => fetchAllPages<Project>(`/api/v1/orgs/${orgId}/projects`),
   get: (id: string) => fetchAPI<Project>(`/api/v1/projects/${id}`),
   create: (orgId: string, data: Partial<Project>) =>
     fetchAPI<Project>(`/api/v1/orgs/${orgId}/projects`, {
@@ -86,15 +134,18 @@ export const projectsAPI = {
 };
 
 // Nodes
+function nodesEndpoint(projectId: string, parentId?: string): string {
+  const searchParams = new URLSearchParams();
+  if (parentId) searchParams.set('parentId', parentId);
+  const query = searchParams.toString();
+  return `/api/v1/projects/${projectId}/nodes${query ? `?${query}` : ''}`;
+}
+
 export const nodesAPI = {
-  list: (projectId: string, params?: { parentId?: string }) => {
-    const searchParams = new URLSearchParams();
-    if (params?.parentId) searchParams.set('parentId', params.parentId);
-    const query = searchParams.toString();
-    return fetchAPI<PaginatedResponse<Node>>(
-      `/api/v1/projects/${projectId}/nodes${query ? `?${query}` : ''}`
-    );
-  },
+  list: (projectId: string, params?: { parentId?: string } & PageParams) =>
+    fetchAPI<PaginatedResponse<Node>>(withPage(nodesEndpoint(projectId, params?.parentId), params)),
+  listAll: (projectId: string, params?: { parentId?: string }) =>
+    fetchAllPages<Node>(nodesEndpoint(projectId, params?.parentId)),
   get: (id: string) => fetchAPI<Node>(`/api/v1/nodes/${id}`),
   create: (projectId: string, data: CreateNodeRequest) =>
     fetchAPI<Node>(`/api/v1/projects/${projectId}/nodes`, {
@@ -116,6 +167,8 @@ export const nodesAPI = {
     fetchAPI<void>(`/api/v1/nodes/${id}/lock`, { method: 'POST' }),
   releaseLock: (id: string) =>
     fetchAPI<void>(`/api/v1/nodes/${id}/lock`, { method: 'DELETE' }),
+  getPresence: (id: string) =>
+    fetchAPI<{ data: NodePresenceEntry[] }>(`/api/v1/nodes/${id}/presence`),
 };
 
 // Agent Executions
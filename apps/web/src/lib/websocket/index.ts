@@ -11,5 +11,10 @@ export {
   useNodePresence,
   useNodeLock,
   useExecutionUpdates,
+  useExecutionProgress,
+  useNotificationPush,
+  useUserMessages,
+  useFileProcessing,
+  useNodeDocument,
   useConnectionStatus,
 } from './ws-hooks';
@@ -14,10 +14,21 @@ export type ConnectionState =
   | 'reconnecting'
   | 'error';
 
+// Close codes the server uses to end a connection deliberately
+export const WS_CLOSE_IDLE_TIMEOUT = 4000;
+export const WS_CLOSE_SESSION_EXPIRED = 4001;
+export const WS_CLOSE_CONNECTION_LIMIT = 4029;
+
+export type WSCloseReason =
+  | 'idle_timeout'
+  | 'session_expired'
+  | 'user_connection_limit'
+  | 'org_connection_limit';
+
 // Client to server messages
 export interface SubscribeMessage {
   type: 'subscribe';
-  payload: { channel: string };
+  payload: { channel: string; lastEventId?: string };
 }
 
 export interface UnsubscribeMessage {
@@ -25,12 +36,31 @@ export interface UnsubscribeMessage {
   payload: { channel: string };
 }
 
+// Caret location within a field
+export interface CursorPosition {
+  line?: number;
+  column?: number;
+}
+
+export interface SelectionRange {
+  start: CursorPosition;
+  end: CursorPosition;
+}
+
+// Where a user is within a node and whether they are typing
+export interface PresenceDetails {
+  field?: string;
+  position?: CursorPosition;
+  selection?: SelectionRange;
+  typing?: boolean;
+}
+
 export interface PresenceMessage {
   type: 'presence';
   payload: {
     nodeId: UUID;
     action: PresenceAction;
-  };
+  } & PresenceDetails;
 }
 
 export interface LockAcquireMessage {
@@ -44,17 +74,74 @@ export interface LockReleaseMessage {
   payload: { nodeId: UUID };
 }
 
+// Restores a previous connection's subscriptions in one message
+export interface ResumeMessage {
+  type: 'resume';
+  payload: { sessionToken: string; lastEventIds?: Record<string, string> };
+  requestId?: string;
+}
+
+// Extends the connection's session with a new WS token
+export interface RefreshTokenMessage {
+  type: 'refresh_token';
+  payload: { token: string };
+  requestId?: string;
+}
+
 export interface PingMessage {
   type: 'ping';
 }
 
+export interface AckMessage {
+  type: 'ack';
+  payload: { messageId: string };
+}
+
+// Collaborative editing. Updates are base64-encoded Yjs/Automerge updates.
+export type DocumentField = 'description';
+
+export interface DocRef {
+  nodeId: UUID;
+  field: DocumentField;
+}
+
+export interface DocSyncMessage {
+  type: 'doc_sync';
+  payload: DocRef;
+  requestId?: string;
+}
+
+export interface DocUpdateMessage {
+  type: 'doc_update';
+  payload: DocRef & { update: string };
+  requestId?: string;
+}
+
+export interface DocAwarenessMessage {
+  type: 'doc_awareness';
+  payload: DocRef & { update: string };
+}
+
+export interface DocCompactMessage {
+  type: 'doc_compact';
+  payload: DocRef & { update: string; throughSeq: number; text?: string };
+  requestId?: string;
+}
+
 export type WSClientMessage =
   | SubscribeMessage
   | UnsubscribeMessage
+  | ResumeMessage
+  | RefreshTokenMessage
   | PresenceMessage
   | LockAcquireMessage
   | LockReleaseMessage
-  | PingMessage;
+  | PingMessage
+  | AckMessage
+  | DocSyncMessage
+  | DocUpdateMessage
+  | DocAwarenessMessage
+  | DocCompactMessage;
 
 // Server to client messages
 export interface SubscribedMessage {
@@ -62,14 +149,56 @@ export interface SubscribedMessage {
   payload: {
     channel: string;
     users?: PresenceUser[];
+    replayed?: number;
+    // Missed events could not be replayed; refetch the channel's data
+    resyncRequired?: boolean;
   };
 }
 
+// Sent when a connection opens; the token resumes its subscriptions later
+// expiresAt is when the connection must have refreshed its WS token by
+export interface SessionMessage {
+  type: 'session';
+  payload: { sessionToken: string; expiresAt?: string };
+}
+
+export interface TokenRefreshedMessage {
+  type: 'token_refreshed';
+  payload: { expiresAt?: string };
+  requestId?: string;
+}
+
+export interface ResumedMessage {
+  type: 'resumed';
+  payload: {
+    sessionToken: string;
+    // Each restored channel, as its subscribe would have been confirmed
+    channels: SubscribedMessage['payload'][];
+    // Channels that could not be restored
+    failed?: string[];
+  };
+  requestId?: string;
+}
+
+// The server instance is shutting down; reconnect after the hint
+export interface ServerShutdownMessage {
+  type: 'server_shutdown';
+  payload: { reconnectAfterMs: number };
+}
+
 export interface UnsubscribedMessage {
   type: 'unsubscribed';
   payload: { channel: string };
 }
 
+export interface SubscriptionRevokedMessage {
+  type: 'subscription_revoked';
+  payload: {
+    channel: string;
+    reason: 'membership_revoked' | 'access_revoked';
+  };
+}
+
 export interface NodeCreatedMessage {
   type: 'node_created';
   payload: { node: Node };
@@ -122,6 +251,21 @@ export interface ExecutionUpdateMessage {
   };
 }
 
+export interface ExecutionProgressMessage {
+  type: 'execution_progress';
+  payload: {
+    executionId: UUID;
+    nodeId: UUID;
+    step: 'llm_call' | 'tool_call';
+    phase: 'started' | 'finished';
+    tool?: string;
+    iteration?: number;
+    durationMs?: number;
+    totalTokensIn: number;
+    totalTokensOut: number;
+  };
+}
+
 export interface ErrorMessage {
   type: 'error';
   payload: {
@@ -135,6 +279,62 @@ export interface PongMessage {
   type: 'pong';
 }
 
+// Org channel messages
+export interface MembershipChangedMessage {
+  type: 'membership_changed';
+  payload: {
+    orgId: UUID;
+    userId: UUID;
+    change: 'added' | 'removed' | 'role_changed';
+    role?: string;
+    changedBy?: string;
+  };
+}
+
+export interface QuotaWarningMessage {
+  type: 'quota_warning';
+  payload: {
+    orgId: UUID;
+    quota: string;
+    used: number;
+    limit: number;
+    percent: number;
+  };
+}
+
+// File processing messages (org:<id>:files)
+export type FileProcessingStatus = 'uploaded' | 'processing' | 'processed' | 'failed';
+
+export interface FileProcessingUpdateMessage {
+  type: 'file_processing_update';
+  payload: {
+    fileId: UUID;
+    orgId: UUID;
+    filename?: string;
+    status: FileProcessingStatus;
+    error?: string;
+  };
+}
+
+// Messages sent straight to the current user, whatever they are subscribed to
+export type UserMessageKind = 'approval_request' | 'mention' | 'admin';
+
+export interface UserMessage {
+  type: 'user_message';
+  payload: {
+    kind: UserMessageKind;
+    title: string;
+    body?: string;
+    orgId?: UUID;
+    // In-app path to open, e.g. the node awaiting approval
+    link?: string;
+    data?: Record<string, unknown>;
+    // Sender's user ID; absent for system messages
+    sentBy?: UUID;
+    sentAt: string;
+  };
+}
+
 // Notification types
 export type NotificationType =
   | 'node_created'
@@ -159,12 +359,54 @@ export interface NotificationMessage {
     userId?: string;
     createdAt: string;
     read: boolean;
+    // Set when pushed to the current user: their unread count including this one
+    unreadCount?: number;
+  };
+}
+
+// Collaborative editing messages
+export interface DocStateMessage {
+  type: 'doc_state';
+  payload: DocRef & {
+    updates: string[];
+    seq: number;
+    compactSuggested?: boolean;
   };
+  requestId?: string;
 }
 
-export type WSServerMessage =
+export interface DocAckMessage {
+  type: 'doc_ack';
+  payload: DocRef & { seq: number };
+  requestId?: string;
+}
+
+export interface DocUpdateEventMessage {
+  type: 'doc_update';
+  payload: DocRef & { update: string; seq: number; userId: UUID };
+}
+
+export interface DocAwarenessEventMessage {
+  type: 'doc_awareness';
+  payload: DocRef & { update: string; userId: UUID };
+}
+
+// Fields carried by replayable channel events, and the delivery ID of
+// critical events that must be acknowledged
+export interface ChannelEventMeta {
+  id?: string;
+  channel?: string;
+  messageId?: string;
+}
+
+export type WSServerMessage = (
   | SubscribedMessage
   | UnsubscribedMessage
+  | SessionMessage
+  | ResumedMessage
+  | ServerShutdownMessage
+  | TokenRefreshedMessage
+  | SubscriptionRevokedMessage
   | NodeCreatedMessage
   | NodeUpdatedMessage
   | NodeDeletedMessage
@@ -172,9 +414,19 @@ export type WSServerMessage =
   | LockAcquiredMessage
   | LockReleasedMessage
   | ExecutionUpdateMessage
+  | ExecutionProgressMessage
   | NotificationMessage
+  | MembershipChangedMessage
+  | QuotaWarningMessage
+  | FileProcessingUpdateMessage
+  | UserMessage
+  | DocStateMessage
+  | DocAckMessage
+  | DocUpdateEventMessage
+  | DocAwarenessEventMessage
   | ErrorMessage
-  | PongMessage;
+  | PongMessage
+) & ChannelEventMeta;
 
 // Presence types
 export interface PresenceUser {
@@ -186,6 +438,13 @@ export interface PresenceUser {
   lastSeen: string;
 }
 
+// A presence entry as returned by GET /nodes/:nodeId/presence
+export interface NodePresenceEntry extends PresenceDetails {
+  userId: UUID;
+  userEmail: string;
+  action: PresenceAction;
+}
+
 // Event handlers
 export type MessageHandler<T extends WSServerMessage = WSServerMessage> = (
   message: T
@@ -197,23 +456,38 @@ export type ConnectionStateHandler = (state: ConnectionState) => void;
 export interface WebSocketClientOptions {
   url: string;
   token: string;
+  // Fetches a new WS token, used to extend the session before it expires
+  // and to reconnect after it has
+  getToken?: () => Promise<string>;
   reconnect?: boolean;
   reconnectInterval?: number;
   maxReconnectAttempts?: number;
   pingInterval?: number;
+  // Acknowledge critical events so the server redelivers any that are lost
+  acks?: boolean;
   debug?: boolean;
 }
 
 // Channel helpers
-export type ChannelType = 'project' | 'node';
+export type ChannelType = 'org' | 'project' | 'node' | 'execution';
 
 export function createChannel(type: ChannelType, id: UUID): string {
   return `${type}:${id}`;
 }
 
+// Receives the events of every project in the org
+export function createOrgProjectsChannel(orgId: UUID): string {
+  return `org:${orgId}:projects`;
+}
+
+// Receives processing updates for the org's files
+export function createOrgFilesChannel(orgId: UUID): string {
+  return `org:${orgId}:files`;
+}
+
 export function parseChannel(channel: string): { type: ChannelType; id: UUID } | null {
   const [type, id] = channel.split(':');
-  if ((type === 'project' || type === 'node') && id) {
+  if ((type === 'org' || type === 'project' || type === 'node' || type === 'execution') && id) {
     return { type: type as ChannelType, id };
   }
   return null;
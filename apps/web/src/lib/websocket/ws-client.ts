@@ -5,6 +5,17 @@ import type {
   WebSocketClientOptions,
   MessageHandler,
   ConnectionStateHandler,
+  PresenceDetails,
+  DocRef,
+  DocStateMessage,
+  DocAckMessage,
+  ResumedMessage,
+  WSCloseReason,
+} from './types';
+import {
+  WS_CLOSE_IDLE_TIMEOUT,
+  WS_CLOSE_SESSION_EXPIRED,
+  WS_CLOSE_CONNECTION_LIMIT,
 } from './types';
 
 const DEFAULT_OPTIONS: Partial<WebSocketClientOptions> = {
@@ -12,9 +23,22 @@ const DEFAULT_OPTIONS: Partial<WebSocketClientOptions> = {
   reconnectInterval: 1000,
   maxReconnectAttempts: 10,
   pingInterval: 30000,
+  acks: true,
   debug: false,
 };
 
+// How many acknowledged message IDs to remember for spotting redeliveries
+const SEEN_MESSAGE_IDS_LIMIT = 500;
+
+// Wait before retrying after the server refused a connection over its limit
+const CONNECTION_LIMIT_RETRY_MS = 60000;
+
+// Refresh the WS token this long before the session expires
+const TOKEN_REFRESH_MARGIN_MS = 60000;
+
+// User activity that reconnects a connection closed for being idle
+const ACTIVITY_EVENTS = ['pointerdown', 'keydown', 'focus'] as const;
+
 /**
  * WebSocket client for GlassBox real-time communication.
  *
@@ -31,8 +55,20 @@ export class WebSocketClient {
   private reconnectAttempts = 0;
   private reconnectTimeout: ReturnType<typeof setTimeout> | null = null;
   private pingInterval: ReturnType<typeof setInterval> | null = null;
+  // Why the server last closed the connection, if it said
+  private closeReason: WSCloseReason | null = null;
+  private stopWaitingForActivity: (() => void) | null = null;
+  private tokenRefreshTimeout: ReturnType<typeof setTimeout> | null = null;
   private messageQueue: WSClientMessage[] = [];
   private subscriptions: Set<string> = new Set();
+  // Last event ID seen per channel, sent on resubscribe to replay missed events
+  private lastEventIds: Map<string, string> = new Map();
+  // Server-side session holding our subscriptions, resumed on reconnect
+  private sessionToken: string | null = null;
+
+  // Recently received critical message IDs; redeliveries are acked again but
+  // not handled twice
+  private seenMessageIds: Set<string> = new Set();
 
   // Event handlers
   private messageHandlers: Map<string, Set<MessageHandler>> = new Map();
@@ -63,6 +99,14 @@ export class WebSocketClient {
     return this.state === 'connected';
   }
 
+  /**
+   * Why the server last closed the connection deliberately (idle timeout or
+   * connection limit), or null
+   */
+  getCloseReason(): WSCloseReason | null {
+    return this.closeReason;
+  }
+
   /**
    * Get current subscriptions
    */
@@ -81,9 +125,11 @@ export class WebSocketClient {
 
     this.setState('connecting');
     this.clearReconnectTimeout();
+    this.clearActivityListeners();
 
     try {
-      const url = `${this.options.url}?token=${this.options.token}`;
+      const url =
+        `${this.options.url}?token=${this.options.token}` + (this.options.acks ? '&acks=1' : '');
       this.ws = new WebSocket(url);
 
       this.ws.onopen = this.handleOpen.bind(this);
@@ -103,6 +149,8 @@ export class WebSocketClient {
   disconnect(): void {
     this.log('Disconnecting...');
     this.clearReconnectTimeout();
+    this.clearTokenRefresh();
+    this.clearActivityListeners();
     this.clearPingInterval();
     this.subscriptions.clear();
     this.messageQueue = [];
@@ -124,7 +172,7 @@ export class WebSocketClient {
   }
 
   /**
-   * Subscribe to a channel (project or node)
+   * Subscribe to a channel (org, project, node or execution)
    */
   subscribe(channel: string): void {
     this.subscriptions.add(channel);
@@ -136,30 +184,116 @@ export class WebSocketClient {
    */
   unsubscribe(channel: string): void {
     this.subscriptions.delete(channel);
+    this.lastEventIds.delete(channel);
     this.send({ type: 'unsubscribe', payload: { channel } });
   }
 
   /**
-   * Update presence on a node
+   * Update presence on a node, optionally with the field, cursor and typing
+   * state. The server coalesces rapid cursor updates, so this can be called
+   * on every selection change.
    */
-  updatePresence(nodeId: string, action: 'viewing' | 'editing' | 'idle'): void {
-    this.send({ type: 'presence', payload: { nodeId, action } });
+  updatePresence(
+    nodeId: string,
+    action: 'viewing' | 'editing' | 'idle',
+    details?: PresenceDetails
+  ): void {
+    this.send({ type: 'presence', payload: { nodeId, action, ...details } });
   }
 
   /**
    * Request a lock on a node (returns a promise)
    */
   async requestLock(nodeId: string, timeoutMs = 5000): Promise<WSServerMessage> {
+    return this.request(
+      (requestId) => ({ type: 'lock_acquire', payload: { nodeId }, requestId }),
+      'Lock request timed out',
+      timeoutMs
+    );
+  }
+
+  /**
+   * Load a collaboratively edited document: the stored updates to apply and
+   * the sequence number of the latest. Subscribe to the node channel first
+   * so no update is missed between loading and listening.
+   */
+  async syncDocument(
+    doc: DocRef,
+    timeoutMs = 10000
+  ): Promise<{ updates: Uint8Array[]; seq: number; compactSuggested: boolean }> {
+    const message = (await this.request(
+      (requestId) => ({ type: 'doc_sync', payload: doc, requestId }),
+      'Document sync timed out',
+      timeoutMs
+    )) as DocStateMessage;
+    return {
+      updates: message.payload.updates.map(fromBase64),
+      seq: message.payload.seq,
+      compactSuggested: message.payload.compactSuggested ?? false,
+    };
+  }
+
+  /**
+   * Send a local CRDT update. Resolves with the update's sequence number once
+   * the server has stored it.
+   */
+  async sendDocumentUpdate(doc: DocRef, update: Uint8Array, timeoutMs = 10000): Promise<number> {
+    const message = (await this.request(
+      (requestId) => ({ type: 'doc_update', payload: { ...doc, update: toBase64(update) }, requestId }),
+      'Document update timed out',
+      timeoutMs
+    )) as DocAckMessage;
+    return message.payload.seq;
+  }
+
+  /**
+   * Replace the stored updates up to throughSeq with a snapshot of the
+   * merged document (e.g. Y.encodeStateAsUpdate). text, the document as
+   * plain text, is saved to the node field so REST readers see the edits.
+   */
+  async compactDocument(
+    doc: DocRef,
+    snapshot: Uint8Array,
+    throughSeq: number,
+    text?: string,
+    timeoutMs = 10000
+  ): Promise<void> {
+    await this.request(
+      (requestId) => ({
+        type: 'doc_compact',
+        payload: { ...doc, update: toBase64(snapshot), throughSeq, text },
+        requestId,
+      }),
+      'Document compaction timed out',
+      timeoutMs
+    );
+  }
+
+  /**
+   * Broadcast ephemeral awareness state (not stored)
+   */
+  sendDocumentAwareness(doc: DocRef, update: Uint8Array): void {
+    this.send({ type: 'doc_awareness', payload: { ...doc, update: toBase64(update) } });
+  }
+
+  /**
+   * Send a message carrying a request ID and wait for the reply to it
+   */
+  private request(
+    build: (requestId: string) => WSClientMessage,
+    timeoutMessage: string,
+    timeoutMs: number
+  ): Promise<WSServerMessage> {
     const requestId = crypto.randomUUID();
 
     return new Promise((resolve, reject) => {
       const timeout = setTimeout(() => {
         this.pendingRequests.delete(requestId);
-        reject(new Error('Lock request timed out'));
+        reject(new Error(timeoutMessage));
       }, timeoutMs);
 
       this.pendingRequests.set(requestId, { resolve, reject, timeout });
-      this.send({ type: 'lock_acquire', payload: { nodeId }, requestId });
+      this.send(build(requestId));
     });
   }
 
@@ -236,19 +370,42 @@ export class WebSocketClient {
     this.log('Connected');
     this.setState('connected');
     this.reconnectAttempts = 0;
+    this.closeReason = null;
     this.startPingInterval();
     this.flushMessageQueue();
-    this.resubscribe();
+    this.restoreSubscriptions();
   }
 
   private handleClose(event: CloseEvent): void {
     this.log('Connection closed:', event.code, event.reason);
     this.clearPingInterval();
+    this.clearTokenRefresh();
     this.ws = null;
 
     if (event.code === 1000) {
       // Normal closure
       this.setState('disconnected');
+    } else if (event.code === WS_CLOSE_IDLE_TIMEOUT) {
+      // Reconnecting right away would just idle again; wait for the user
+      this.closeReason = event.reason as WSCloseReason;
+      this.setState('disconnected');
+      if (this.options.reconnect) {
+        this.reconnectOnActivity();
+      }
+    } else if (event.code === WS_CLOSE_SESSION_EXPIRED && this.options.reconnect) {
+      // The token can't be reused; fetch a new one before reconnecting
+      this.closeReason = event.reason as WSCloseReason;
+      this.setState('reconnecting');
+      this.renewToken()
+        .catch((error) => this.log('Token renewal failed:', error))
+        .finally(() => this.scheduleReconnect());
+    } else if (event.code === WS_CLOSE_CONNECTION_LIMIT) {
+      // Too many connections (e.g. open tabs); retry slowly in case some close
+      this.closeReason = event.reason as WSCloseReason;
+      this.setState('error');
+      if (this.options.reconnect) {
+        this.reconnectTimeout = setTimeout(() => this.connect(), CONNECTION_LIMIT_RETRY_MS);
+      }
     } else if (this.options.reconnect) {
       this.setState('reconnecting');
       this.scheduleReconnect();
@@ -263,16 +420,64 @@ export class WebSocketClient {
   }
 
   private handleMessage(event: MessageEvent): void {
+    // The server batches queued messages into one frame, newline-separated
+    String(event.data)
+      .split('\n')
+      .filter((line) => line.trim() !== '')
+      .forEach((line) => this.handleFrameMessage(line));
+  }
+
+  private handleFrameMessage(data: string): void {
     try {
-      const message = JSON.parse(event.data) as WSServerMessage;
+      const message = JSON.parse(data) as WSServerMessage;
       this.log('Received:', message);
 
-      // Handle pending lock requests
-      if (
-        (message.type === 'lock_acquired' || message.type === 'error') &&
-        'requestId' in message &&
-        message.requestId
-      ) {
+      // Critical events are redelivered until acknowledged
+      if (message.messageId) {
+        this.send({ type: 'ack', payload: { messageId: message.messageId } });
+        if (this.seenMessageIds.has(message.messageId)) {
+          return;
+        }
+        this.seenMessageIds.add(message.messageId);
+        if (this.seenMessageIds.size > SEEN_MESSAGE_IDS_LIMIT) {
+          const oldest = this.seenMessageIds.values().next().value;
+          if (oldest !== undefined) {
+            this.seenMessageIds.delete(oldest);
+          }
+        }
+      }
+
+      // A resume replaces the token with the resumed session's
+      if (message.type === 'session' || message.type === 'resumed') {
+        this.sessionToken = message.payload.sessionToken;
+      }
+      if (message.type === 'session' || message.type === 'token_refreshed') {
+        this.scheduleTokenRefresh(message.payload.expiresAt);
+      }
+
+      // Reconnect to another instance; subscriptions are resumed there
+      if (message.type === 'server_shutdown') {
+        this.reconnectAfterShutdown(message.payload.reconnectAfterMs);
+      }
+
+      // Access was revoked server-side; don't resubscribe on reconnect
+      if (message.type === 'subscription_revoked') {
+        this.subscriptions.delete(message.payload.channel);
+        this.lastEventIds.delete(message.payload.channel);
+      }
+
+      // Replayable events carry an ID. Events can arrive both live and in a
+      // replay after reconnecting, so anything already seen is skipped.
+      if (message.id && message.channel) {
+        const lastId = this.lastEventIds.get(message.channel);
+        if (lastId && !isNewerEventId(message.id, lastId)) {
+          return;
+        }
+        this.lastEventIds.set(message.channel, message.id);
+      }
+
+      // Resolve pending requests (lock acquire, document sync/update/compact)
+      if ('requestId' in message && message.requestId) {
         const pending = this.pendingRequests.get(message.requestId);
         if (pending) {
           clearTimeout(pending.timeout);
@@ -285,34 +490,38 @@ export class WebSocketClient {
         }
       }
 
-      // Notify type-specific handlers
-      const handlers = this.messageHandlers.get(message.type);
-      if (handlers) {
-        Array.from(handlers).forEach((handler) => {
-          try {
-            handler(message);
-          } catch (error) {
-            console.error('Message handler error:', error);
-          }
-        });
-      }
-
-      // Notify wildcard handlers
-      const wildcardHandlers = this.messageHandlers.get('*' as WSServerMessage['type']);
-      if (wildcardHandlers) {
-        Array.from(wildcardHandlers).forEach((handler) => {
-          try {
-            handler(message);
-          } catch (error) {
-            console.error('Message handler error:', error);
-          }
-        });
-      }
+      this.notify(message);
     } catch (error) {
       this.log('Failed to parse message:', error);
     }
   }
 
+  private notify(message: WSServerMessage): void {
+    // Notify type-specific handlers
+    const handlers = this.messageHandlers.get(message.type);
+    if (handlers) {
+      Array.from(handlers).forEach((handler) => {
+        try {
+          handler(message);
+        } catch (error) {
+          console.error('Message handler error:', error);
+        }
+      });
+    }
+
+    // Notify wildcard handlers
+    const wildcardHandlers = this.messageHandlers.get('*' as WSServerMessage['type']);
+    if (wildcardHandlers) {
+      Array.from(wildcardHandlers).forEach((handler) => {
+        try {
+          handler(message);
+        } catch (error) {
+          console.error('Message handler error:', error);
+        }
+      });
+    }
+  }
+
   private setState(state: ConnectionState): void {
     if (this.state !== state) {
       this.log('State change:', this.state, '->', state);
@@ -351,6 +560,89 @@ export class WebSocketClient {
     }, delay);
   }
 
+  /**
+   * Refresh the WS token shortly before the session expires, extending the
+   * connection in place
+   */
+  private scheduleTokenRefresh(expiresAt: string | undefined): void {
+    this.clearTokenRefresh();
+    if (!expiresAt || !this.options.getToken) {
+      return;
+    }
+    const delay = Math.max(new Date(expiresAt).getTime() - Date.now() - TOKEN_REFRESH_MARGIN_MS, 0);
+    this.tokenRefreshTimeout = setTimeout(() => {
+      this.renewToken()
+        .then((token) =>
+          this.request(
+            (requestId) => ({ type: 'refresh_token', payload: { token }, requestId }),
+            'Token refresh timed out',
+            10000
+          )
+        )
+        .catch((error) => this.log('Token refresh failed:', error));
+    }, delay);
+  }
+
+  /**
+   * Fetch a new WS token, also used for later reconnects
+   */
+  private async renewToken(): Promise<string> {
+    if (!this.options.getToken) {
+      return this.options.token;
+    }
+    const token = await this.options.getToken();
+    this.options.token = token;
+    return token;
+  }
+
+  private clearTokenRefresh(): void {
+    if (this.tokenRefreshTimeout) {
+      clearTimeout(this.tokenRefreshTimeout);
+      this.tokenRefreshTimeout = null;
+    }
+  }
+
+  private reconnectAfterShutdown(delayMs: number): void {
+    this.clearPingInterval();
+    this.clearTokenRefresh();
+    if (this.ws) {
+      this.ws.onclose = null; // Reconnect on our own schedule, without backoff
+      this.ws.close(1000, 'Server shutdown');
+      this.ws = null;
+    }
+    if (!this.options.reconnect) {
+      this.setState('disconnected');
+      return;
+    }
+    this.setState('reconnecting');
+    this.clearReconnectTimeout();
+    this.reconnectTimeout = setTimeout(() => this.connect(), delayMs);
+  }
+
+  private reconnectOnActivity(): void {
+    if (typeof window === 'undefined') {
+      return;
+    }
+    const onActivity = () => {
+      if (document.visibilityState === 'visible') {
+        this.connect();
+      }
+    };
+    ACTIVITY_EVENTS.forEach((type) => window.addEventListener(type, onActivity));
+    document.addEventListener('visibilitychange', onActivity);
+    this.stopWaitingForActivity = () => {
+      ACTIVITY_EVENTS.forEach((type) => window.removeEventListener(type, onActivity));
+      document.removeEventListener('visibilitychange', onActivity);
+    };
+  }
+
+  private clearActivityListeners(): void {
+    if (this.stopWaitingForActivity) {
+      this.stopWaitingForActivity();
+      this.stopWaitingForActivity = null;
+    }
+  }
+
   private clearReconnectTimeout(): void {
     if (this.reconnectTimeout) {
       clearTimeout(this.reconnectTimeout);
@@ -379,9 +671,55 @@ export class WebSocketClient {
     }
   }
 
-  private resubscribe(): void {
-    Array.from(this.subscriptions).forEach((channel) => {
-      this.send({ type: 'subscribe', payload: { channel } });
+  /**
+   * Restore subscriptions after reconnecting: resume the previous session in
+   * one message, then reconcile it with the channels wanted now. Falls back
+   * to subscribing channel by channel if the session is gone.
+   */
+  private restoreSubscriptions(): void {
+    const token = this.sessionToken;
+    if (!token || this.subscriptions.size === 0) {
+      this.resubscribe();
+      return;
+    }
+
+    const lastEventIds: Record<string, string> = {};
+    this.subscriptions.forEach((channel) => {
+      const lastEventId = this.lastEventIds.get(channel);
+      if (lastEventId) {
+        lastEventIds[channel] = lastEventId;
+      }
+    });
+
+    this.request(
+      (requestId) => ({ type: 'resume', payload: { sessionToken: token, lastEventIds }, requestId }),
+      'Session resume timed out',
+      10000
+    )
+      .then((message) => {
+        const restored = new Set<string>();
+        (message as ResumedMessage).payload.channels.forEach((payload) => {
+          restored.add(payload.channel);
+          if (!this.subscriptions.has(payload.channel)) {
+            // Unsubscribed while disconnected
+            this.send({ type: 'unsubscribe', payload: { channel: payload.channel } });
+            return;
+          }
+          // Handlers see restored channels as if subscribed one by one
+          this.notify({ type: 'subscribed', payload });
+        });
+        this.resubscribe((channel) => !restored.has(channel));
+      })
+      .catch((error) => {
+        this.log('Resume failed, resubscribing:', error);
+        this.resubscribe();
+      });
+  }
+
+  private resubscribe(include: (channel: string) => boolean = () => true): void {
+    Array.from(this.subscriptions).filter(include).forEach((channel) => {
+      const lastEventId = this.lastEventIds.get(channel);
+      this.send({ type: 'subscribe', payload: lastEventId ? { channel, lastEventId } : { channel } });
     });
   }
 
@@ -400,16 +738,20 @@ export async function createWebSocketClient(
   options?: Partial<Omit<WebSocketClientOptions, 'url' | 'token'>>
 ): Promise<WebSocketClient> {
   // Exchange JWT for WebSocket token
-  const response = await fetch(`${apiBaseUrl}/api/v1/auth/ws-token`, {
-    method: 'POST',
-    credentials: 'include',
-  });
+  const getToken = async (): Promise<string> => {
+    const response = await fetch(`${apiBaseUrl}/api/v1/auth/ws-token`, {
+      method: 'POST',
+      credentials: 'include',
+    });
 
-  if (!response.ok) {
-    throw new Error('Failed to get WebSocket token');
-  }
+    if (!response.ok) {
+      throw new Error('Failed to get WebSocket token');
+    }
 
-  const { token } = await response.json();
+    const { token } = await response.json();
+    return token;
+  };
+  const token = await getToken();
 
   // Construct WebSocket URL
   const wsUrl = apiBaseUrl
@@ -419,6 +761,33 @@ export async function createWebSocketClient(
   return new WebSocketClient({
     url: wsUrl,
     token,
+    getToken,
     ...options,
   });
 }
+
+/**
+ * Compare Redis stream IDs ("<ms>-<seq>")
+ */
+function isNewerEventId(id: string, than: string): boolean {
+  const [ms, seq] = id.split('-').map(Number);
+  const [thanMs, thanSeq] = than.split('-').map(Number);
+  return ms > thanMs || (ms === thanMs && seq > thanSeq);
+}
+
+export function toBase64(bytes: Uint8Array): string {
+  let binary = '';
+  for (let i = 0; i < bytes.length; i++) {
+    binary += String.fromCharCode(bytes[i]);
+  }
+  return btoa(binary);
+}
+
+export function fromBase64(encoded: string): Uint8Array {
+  const binary = atob(encoded);
+  const bytes = new Uint8Array(binary.length);
+  for (let i = 0; i < binary.length; i++) {
+    bytes[i] = binary.charCodeAt(i);
+  }
+  return bytes;
+}
@@ -6,6 +6,7 @@ import type {
   ConnectionState,
   WSServerMessage,
   PresenceUser,
+  PresenceDetails,
   PresenceUpdateMessage,
   LockAcquiredMessage,
   LockReleasedMessage,
@@ -28,7 +29,11 @@ interface WebSocketContextValue {
   unsubscribeFromNode: (nodeId: string) => void;
 
   // Presence
-  updatePresence: (nodeId: string, action: 'viewing' | 'editing' | 'idle') => void;
+  updatePresence: (
+    nodeId: string,
+    action: 'viewing' | 'editing' | 'idle',
+    details?: PresenceDetails
+  ) => void;
   getPresence: (nodeId: string) => PresenceUser[];
 
   // Locks
@@ -196,8 +201,8 @@ export function WebSocketProvider({
 
   // Presence methods
   const updatePresence = React.useCallback(
-    (nodeId: string, action: 'viewing' | 'editing' | 'idle') => {
-      client?.updatePresence(nodeId, action);
+    (nodeId: string, action: 'viewing' | 'editing' | 'idle', details?: PresenceDetails) => {
+      client?.updatePresence(nodeId, action, details);
     },
     [client]
   );
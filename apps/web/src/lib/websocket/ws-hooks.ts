@@ -2,13 +2,23 @@
 
 import * as React from 'react';
 import { useWebSocket } from './ws-context';
+import { fromBase64 } from './ws-client';
 import type {
   PresenceUser,
+  PresenceDetails,
   NodeCreatedMessage,
   NodeUpdatedMessage,
   NodeDeletedMessage,
   ExecutionUpdateMessage,
+  ExecutionProgressMessage,
+  FileProcessingUpdateMessage,
+  NotificationMessage,
+  UserMessage,
+  DocumentField,
+  DocUpdateEventMessage,
+  DocAwarenessEventMessage,
 } from './types';
+import { createChannel, createOrgFilesChannel } from './types';
 import type { Node, AgentExecutionStatus, ExecutionProgress } from '@glassbox/shared-types';
 
 /**
@@ -81,7 +91,7 @@ export function useProjectSubscription(
  */
 export function useNodePresence(nodeId: string | undefined): {
   users: PresenceUser[];
-  updatePresence: (action: 'viewing' | 'editing' | 'idle') => void;
+  updatePresence: (action: 'viewing' | 'editing' | 'idle', details?: PresenceDetails) => void;
 } {
   const {
     subscribeToNode,
@@ -116,9 +126,9 @@ export function useNodePresence(nodeId: string | undefined): {
   }, [nodeId, isConnected, subscribeToNode, unsubscribeFromNode, getPresence]);
 
   const updatePresence = React.useCallback(
-    (action: 'viewing' | 'editing' | 'idle') => {
+    (action: 'viewing' | 'editing' | 'idle', details?: PresenceDetails) => {
       if (nodeId) {
-        wsUpdatePresence(nodeId, action);
+        wsUpdatePresence(nodeId, action, details);
       }
     },
     [nodeId, wsUpdatePresence]
@@ -224,6 +234,221 @@ export function useExecutionUpdates(
   return { status, progress };
 }
 
+/**
+ * Hook for notifications pushed to the current user. Tracks the unread count
+ * the server sends with each one; seed it from the REST API on load.
+ */
+export function useNotificationPush(
+  onNotification?: (notification: NotificationMessage['payload']) => void
+): {
+  unreadCount: number | null;
+  latest: NotificationMessage['payload'] | null;
+} {
+  const { onMessage, isConnected } = useWebSocket();
+  const [unreadCount, setUnreadCount] = React.useState<number | null>(null);
+  const [latest, setLatest] = React.useState<NotificationMessage['payload'] | null>(null);
+
+  React.useEffect(() => {
+    if (!isConnected) return;
+
+    return onMessage<NotificationMessage>('notification', (msg) => {
+      // Org-wide broadcasts carry no unread count and aren't stored per user
+      if (msg.payload.unreadCount === undefined) return;
+      setUnreadCount(msg.payload.unreadCount);
+      setLatest(msg.payload);
+      onNotification?.(msg.payload);
+    });
+  }, [isConnected, onMessage, onNotification]);
+
+  return { unreadCount, latest };
+}
+
+/**
+ * Hook for messages sent straight to the current user: approval requests,
+ * mentions and messages from platform staff. No subscription is needed.
+ * Returns the most recent message.
+ */
+export function useUserMessages(
+  onUserMessage?: (message: UserMessage['payload']) => void
+): {
+  latest: UserMessage['payload'] | null;
+} {
+  const { onMessage, isConnected } = useWebSocket();
+  const [latest, setLatest] = React.useState<UserMessage['payload'] | null>(null);
+
+  React.useEffect(() => {
+    if (!isConnected) return;
+
+    return onMessage<UserMessage>('user_message', (msg) => {
+      setLatest(msg.payload);
+      onUserMessage?.(msg.payload);
+    });
+  }, [isConnected, onMessage, onUserMessage]);
+
+  return { latest };
+}
+
+/**
+ * Hook for live step-level progress of a single execution. Subscribes to the
+ * execution's channel and returns the most recent step and token totals.
+ */
+export function useExecutionProgress(executionId: string | undefined): {
+  progress: ExecutionProgressMessage['payload'] | null;
+} {
+  const { client, onMessage, isConnected } = useWebSocket();
+  const [progress, setProgress] = React.useState<ExecutionProgressMessage['payload'] | null>(null);
+
+  React.useEffect(() => {
+    if (!executionId || !client || !isConnected) return;
+
+    const channel = createChannel('execution', executionId);
+    client.subscribe(channel);
+
+    const unsubscribe = onMessage<ExecutionProgressMessage>('execution_progress', (msg) => {
+      if (msg.payload.executionId === executionId) {
+        setProgress(msg.payload);
+      }
+    });
+
+    return () => {
+      client.unsubscribe(channel);
+      unsubscribe();
+    };
+  }, [executionId, client, isConnected, onMessage]);
+
+  return { progress };
+}
+
+/**
+ * Hook for live file processing status in an org. Returns the latest update
+ * per file ID, so upload views can show extraction progress and errors.
+ */
+export function useFileProcessing(orgId: string | undefined): {
+  files: Record<string, FileProcessingUpdateMessage['payload']>;
+} {
+  const { client, onMessage, isConnected } = useWebSocket();
+  const [files, setFiles] = React.useState<Record<string, FileProcessingUpdateMessage['payload']>>({});
+
+  React.useEffect(() => {
+    if (!orgId || !client || !isConnected) return;
+
+    const channel = createOrgFilesChannel(orgId);
+    client.subscribe(channel);
+
+    const unsubscribe = onMessage<FileProcessingUpdateMessage>('file_processing_update', (msg) => {
+      if (msg.payload.orgId === orgId) {
+        setFiles((prev) => ({ ...prev, [msg.payload.fileId]: msg.payload }));
+      }
+    });
+
+    return () => {
+      client.unsubscribe(channel);
+      unsubscribe();
+    };
+  }, [orgId, client, isConnected, onMessage]);
+
+  return { files };
+}
+
+/**
+ * Hook for collaboratively editing a node field with a CRDT library. The
+ * caller applies incoming updates to its document (e.g. Y.applyUpdate) and
+ * passes local updates to sendUpdate. Updates merge, so no lock is needed.
+ */
+export function useNodeDocument(
+  nodeId: string | undefined,
+  field: DocumentField,
+  handlers: {
+    applyUpdate: (update: Uint8Array) => void;
+    applyAwareness?: (update: Uint8Array, userId: string) => void;
+  }
+): {
+  ready: boolean;
+  seq: number;
+  compactSuggested: boolean;
+  sendUpdate: (update: Uint8Array) => Promise<void>;
+  sendAwareness: (update: Uint8Array) => void;
+  compact: (encodeSnapshot: () => Uint8Array, renderText?: () => string) => Promise<void>;
+} {
+  const { client, onMessage, isConnected, subscribeToNode, unsubscribeFromNode } = useWebSocket();
+  const [ready, setReady] = React.useState(false);
+  const [seq, setSeq] = React.useState(0);
+  const [compactSuggested, setCompactSuggested] = React.useState(false);
+  const handlersRef = React.useRef(handlers);
+  handlersRef.current = handlers;
+
+  React.useEffect(() => {
+    if (!nodeId || !client || !isConnected) return;
+
+    // Listen before loading so updates made in between aren't lost;
+    // applying one twice is harmless
+    subscribeToNode(nodeId);
+    const offUpdate = onMessage<DocUpdateEventMessage>('doc_update', (msg) => {
+      if (msg.payload.nodeId !== nodeId || msg.payload.field !== field) return;
+      handlersRef.current.applyUpdate(fromBase64(msg.payload.update));
+      setSeq((prev) => Math.max(prev, msg.payload.seq));
+    });
+    const offAwareness = onMessage<DocAwarenessEventMessage>('doc_awareness', (msg) => {
+      if (msg.payload.nodeId !== nodeId || msg.payload.field !== field) return;
+      handlersRef.current.applyAwareness?.(fromBase64(msg.payload.update), msg.payload.userId);
+    });
+
+    let cancelled = false;
+    client
+      .syncDocument({ nodeId, field })
+      .then((state) => {
+        if (cancelled) return;
+        state.updates.forEach((update) => handlersRef.current.applyUpdate(update));
+        setSeq((prev) => Math.max(prev, state.seq));
+        setCompactSuggested(state.compactSuggested);
+        setReady(true);
+      })
+      .catch((error) => console.error('Failed to sync document:', error));
+
+    return () => {
+      cancelled = true;
+      setReady(false);
+      offUpdate();
+      offAwareness();
+      unsubscribeFromNode(nodeId);
+    };
+  }, [nodeId, field, client, isConnected, onMessage, subscribeToNode, unsubscribeFromNode]);
+
+  const sendUpdate = React.useCallback(
+    async (update: Uint8Array) => {
+      if (!nodeId || !client) return;
+      const stored = await client.sendDocumentUpdate({ nodeId, field }, update);
+      setSeq((prev) => Math.max(prev, stored));
+    },
+    [nodeId, field, client]
+  );
+
+  const sendAwareness = React.useCallback(
+    (update: Uint8Array) => {
+      if (nodeId && client) {
+        client.sendDocumentAwareness({ nodeId, field }, update);
+      }
+    },
+    [nodeId, field, client]
+  );
+
+  // Compaction reloads the stored log first so the snapshot covers exactly
+  // the updates up to the seq it claims, even if some arrived out of order.
+  // renderText (e.g. ytext.toString()) saves the merged text to the node.
+  const compact = React.useCallback(
+    async (encodeSnapshot: () => Uint8Array, renderText?: () => string) => {
+      if (!nodeId || !client) return;
+      const state = await client.syncDocument({ nodeId, field });
+      state.updates.forEach((update) => handlersRef.current.applyUpdate(update));
+      await client.compactDocument({ nodeId, field }, encodeSnapshot(), state.seq, renderText?.());
+      setCompactSuggested(false);
+    },
+    [nodeId, field, client]
+  );
+
+  return { ready, seq, compactSuggested, sendUpdate, sendAwareness, compact };
+}
+
 /**
  * Hook for connection status indicator
  */
@@ -10,6 +10,7 @@ import structlog
 from litellm import acompletion
 
 from shared.db import Database
+from shared.internal_api import notify_execution_event, notify_execution_progress
 from shared.s3 import S3Client, generate_output_key
 
 logger = structlog.get_logger()
@@ -31,6 +32,7 @@ class AgentState:
         human_input_needed: bool = False,
         human_input_request: Optional[dict] = None,
         human_input_response: Optional[dict] = None,
+        approved_tools: list[str] = None,
         error: Optional[str] = None,
     ):
         self.node_id = node_id
@@ -44,6 +46,7 @@ class AgentState:
         self.human_input_needed = human_input_needed
         self.human_input_request = human_input_request
         self.human_input_response = human_input_response
+        self.approved_tools = approved_tools or []  # one approved call each
         self.error = error
 
     def to_dict(self) -> dict:
@@ -59,6 +62,7 @@ class AgentState:
             "human_input_needed": self.human_input_needed,
             "human_input_request": self.human_input_request,
             "human_input_response": self.human_input_response,
+            "approved_tools": self.approved_tools,
             "error": self.error,
         }
 
@@ -76,6 +80,7 @@ class AgentState:
             human_input_needed=data.get("human_input_needed", False),
             human_input_request=data.get("human_input_request"),
             human_input_response=data.get("human_input_response"),
+            approved_tools=data.get("approved_tools", []),
             error=data.get("error"),
         )
 
@@ -96,8 +101,22 @@ class AgentExecutor:
         self.execution_id = execution_id
         self.org_config = org_config
         self.org_id = org_id  # Will be loaded from node if not provided
-        self.model = org_config.get("defaultModel") or org_config.get("model", "gpt-4-turbo-preview")
-        self.tools = self._build_tools()
+        # Effective agent config resolved by the API from the execution
+        # override, node, template, project and org layers
+        self.agent_config = org_config.get("agentConfig") or {}
+        self.model = (
+            self.agent_config.get("model")
+            or org_config.get("defaultModel")
+            or org_config.get("model", "gpt-4-turbo-preview")
+        )
+        # Tool policy resolved by the API from the org's and the node's
+        # template's policies; older jobs without one allow every tool
+        self.allowed_tools = org_config.get("allowedTools")
+        self.approval_tools = set(org_config.get("approvalTools") or [])
+        self.tools = [
+            tool for tool in self._build_tools()
+            if self.allowed_tools is None or tool["function"]["name"] in self.allowed_tools
+        ]
         self.total_tokens_in = 0
         self.total_tokens_out = 0
         self.s3 = S3Client()
@@ -234,6 +253,7 @@ class AgentExecutor:
             "currentStep": state.current_step,
             "humanInputRequest": state.human_input_request,
             "humanInputResponse": state.human_input_response,
+            "approvedTools": state.approved_tools,
         }
 
         await self.db.execute(
@@ -304,10 +324,12 @@ class AgentExecutor:
                     current_step=checkpoint.get("currentStep", "start"),
                     iteration=checkpoint.get("iteration", 0),
                     human_input_response=checkpoint.get("humanInputResponse"),
+                    approved_tools=checkpoint.get("approvedTools", []),
                 )
 
                 # If we have human input response, add it to messages
                 if state.human_input_response:
+                    self._record_approval(checkpoint.get("humanInputRequest"), state.human_input_response, state)
                     state.messages.append({
                         "role": "user",
                         "content": f"Human response: {json.dumps(state.human_input_response)}",
@@ -351,6 +373,7 @@ class AgentExecutor:
 
                 # If we received human input while awaiting, process it
                 if human_response and current_status == "running":
+                    self._record_approval(state.human_input_request, human_response, state)
                     state.messages.append({
                         "role": "user",
                         "content": f"Human response: {json.dumps(human_response)}",
@@ -419,6 +442,13 @@ class AgentExecutor:
     async def _call_llm(self, messages: list[dict]) -> Any:
         """Call the LLM."""
         start_time = datetime.utcnow()
+        await self._notify_progress("llm_call", "started")
+
+        params = {}
+        if self.agent_config.get("maxTokens"):
+            params["max_tokens"] = self.agent_config["maxTokens"]
+        if self.agent_config.get("temperature"):
+            params["temperature"] = self.agent_config["temperature"]
 
         response = await acompletion(
             model=self.model,
@@ -427,6 +457,7 @@ class AgentExecutor:
             tool_choice="auto",
             api_key=self.org_config.get("apiKey") or self.org_config.get("api_key"),
             api_base=self.org_config.get("apiBase") or self.org_config.get("api_base"),
+            **params,
         )
 
         # Track tokens
@@ -447,6 +478,7 @@ class AgentExecutor:
             tokens_in=usage.prompt_tokens,
             tokens_out=usage.completion_tokens,
         )
+        await self._notify_progress("llm_call", "finished", duration_ms=duration_ms)
 
         return response
 
@@ -458,17 +490,50 @@ class AgentExecutor:
         logger.info("Executing tool", tool=name, args=args)
         await self._log_event("tool_call", {"tool": name, "arguments": args})
 
-        if name == "create_subnode":
-            return await self._create_subnode(args, state)
-        elif name == "add_output":
-            return await self._add_output(args, state)
-        elif name == "request_human_input":
-            return await self._request_human_input(args, state)
-        elif name == "mark_complete":
-            state.current_step = "complete"
-            return f"Node marked as complete: {args.get('summary', '')}"
-        else:
-            return f"Unknown tool: {name}"
+        if self.allowed_tools is not None and name not in self.allowed_tools:
+            await self._log_event("tool_denied", {"tool": name})
+            return f"Tool {name} is not allowed for this node."
+        if name in self.approval_tools:
+            if name not in state.approved_tools:
+                return await self._request_approval(name, args, state)
+            state.approved_tools.remove(name)
+
+        start_time = datetime.utcnow()
+        await self._notify_progress("tool_call", "started", tool=name)
+        try:
+            if name == "create_subnode":
+                return await self._create_subnode(args, state)
+            elif name == "add_output":
+                return await self._add_output(args, state)
+            elif name == "request_human_input":
+                return await self._request_human_input(args, state)
+            elif name == "mark_complete":
+                state.current_step = "complete"
+                return f"Node marked as complete: {args.get('summary', '')}"
+            else:
+                return f"Unknown tool: {name}"
+        finally:
+            duration_ms = int((datetime.utcnow() - start_time).total_seconds() * 1000)
+            await self._notify_progress("tool_call", "finished", tool=name, duration_ms=duration_ms)
+
+    async def _notify_progress(
+        self,
+        step: str,
+        phase: str,
+        tool: str = None,
+        duration_ms: int = None,
+    ) -> None:
+        """Report step progress to the API for live trace views."""
+        await notify_execution_progress(
+            str(self.node_id),
+            str(self.execution_id),
+            step,
+            phase,
+            self.total_tokens_in,
+            self.total_tokens_out,
+            tool=tool,
+            duration_ms=duration_ms,
+        )
 
     async def _create_subnode(self, args: dict, state: AgentState) -> str:
         """Create a sub-node."""
@@ -618,6 +683,32 @@ class AgentExecutor:
 
         return "Human input requested. Execution will pause until input is provided."
 
+    async def _request_approval(self, name: str, args: dict, state: AgentState) -> str:
+        """Pause until a human approves a call to a tool that needs approval."""
+        state.human_input_needed = True
+        state.human_input_request = {
+            "requestType": "approval",
+            "prompt": f"The agent wants to call {name}. Approve?",
+            "options": ["approved", "denied"],
+            "metadata": {"tool": name, "arguments": args},
+        }
+        await self._log_event("tool_approval_requested", {"tool": name, "arguments": args})
+
+        return (
+            f"Calling {name} needs a human's approval. Execution will pause; "
+            "if it's approved, call the tool again."
+        )
+
+    def _record_approval(self, request: Optional[dict], response: dict, state: AgentState) -> None:
+        """Allow one more call of a tool if the human approved it."""
+        if not request or request.get("requestType") != "approval":
+            return
+        if response.get("decision") != "approved":
+            return
+        tool = (request.get("metadata") or {}).get("tool")
+        if tool:
+            state.approved_tools.append(tool)
+
     async def _load_node(self) -> dict:
         """Load the node from the database."""
         row = await self.db.fetchrow(
@@ -646,6 +737,10 @@ class AgentExecutor:
             f"- {inp.get('label', inp.get('input_type'))}: {inp.get('text_content') or inp.get('extracted_text') or inp.get('external_url', 'N/A')}"
             for inp in inputs
         )
+        tools_text = "\n".join(
+            f"{i}. {tool['function']['name']} - {tool['function']['description']}"
+            for i, tool in enumerate(self.tools, start=1)
+        )
 
         return f"""You are an AI agent working on a task in GlassBox, a collaborative workspace.
 
@@ -656,13 +751,21 @@ Available inputs:
 {inputs_text or 'No inputs provided'}
 
 You have access to the following tools:
-1. create_subnode - Break down this task into smaller sub-tasks
-2. add_output - Add outputs (text, structured data, or files)
-3. request_human_input - Ask the human supervisor for clarification
-4. mark_complete - Mark this task as complete
+{tools_text or 'No tools'}
 
 Work through the task step by step. If the task is complex, break it into sub-nodes.
-When you have completed the task, use mark_complete with a summary."""
+When you have completed the task, use mark_complete with a summary.{self._node_instructions(node)}"""
+
+    def _node_instructions(self, node: dict) -> str:
+        """Instructions from the effective agent config's system prompt, or the
+        node's for jobs queued before the API resolved one."""
+        prompt = self.agent_config.get("systemPrompt")
+        if not prompt and "agentConfig" not in self.org_config:
+            agent_config = node.get("agent_config") or {}
+            if isinstance(agent_config, str):
+                agent_config = json.loads(agent_config)
+            prompt = agent_config.get("systemPrompt")
+        return f"\n\nAdditional instructions:\n{prompt}" if prompt else ""
 
     async def _update_status(self, status: str, error: str = None) -> None:
         """Update the execution status."""
@@ -720,6 +823,15 @@ When you have completed the task, use mark_complete with a summary."""
                 self.execution_id,
             )
 
+        await notify_execution_event(
+            str(self.node_id),
+            str(self.execution_id),
+            status,
+            self.total_tokens_in,
+            self.total_tokens_out,
+            error or "",
+        )
+
     async def _log_event(
         self,
         event_type: str,
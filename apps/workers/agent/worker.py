@@ -11,7 +11,9 @@ sys.path.insert(0, str(__file__).rsplit("/", 2)[0])
 
 from shared.config import get_settings
 from shared.db import get_db
-from shared.sqs import SQSConsumer
+from shared.jobs import InvalidJob, decode_agent_job
+from shared.quarantine import quarantine_job
+from shared.redis_queue import make_consumer
 from .executor import AgentExecutor
 
 logger = structlog.get_logger()
@@ -20,29 +22,30 @@ logger = structlog.get_logger()
 async def handle_agent_job(message: dict[str, Any]) -> None:
     """Handle an agent execution job.
 
-    Message format from Go API (camelCase):
+    Message format from Go API (camelCase; see shared/jobs.py):
     {
+        "schemaVersion": 1,
         "executionId": "uuid",
         "nodeId": "uuid",
         "orgId": "uuid",
         "orgConfig": {...}
     }
     """
-    # Support both camelCase (from Go API) and snake_case (legacy)
-    node_id = message.get("nodeId") or message.get("node_id")
-    execution_id = message.get("executionId") or message.get("execution_id")
-    org_id = message.get("orgId") or message.get("org_id")
-    org_config = message.get("orgConfig") or message.get("org_config", {})
-
-    if not node_id or not execution_id:
-        logger.error("Invalid message: missing nodeId or executionId", message=message)
+    try:
+        job = decode_agent_job(message)
+    except InvalidJob as e:
+        logger.error("Invalid message", error=str(e), message=message)
+        queue = "agent-batch" if message.get("priority") == "batch" else "agent"
+        await quarantine_job(queue, message, str(e))
         return
+    node_id, execution_id, org_id, org_config = job.node_id, job.execution_id, job.org_id, job.org_config
 
     logger.info(
         "Processing agent job",
         node_id=node_id,
         execution_id=execution_id,
         org_id=org_id,
+        priority=job.priority,
     )
 
     try:
@@ -87,26 +90,42 @@ async def main() -> None:
         ]
     )
 
-    logger.info("Starting agent worker", queue_url=settings.sqs_agent_queue_url)
-
-    consumer = SQSConsumer(
-        queue_url=settings.sqs_agent_queue_url,
-        handler=handle_agent_job,
-        visibility_timeout=600,  # 10 minutes for agent jobs
-    )
+    priorities = settings.agent_priority_list
+    logger.info("Starting agent worker", queue_backend=settings.queue_backend, priorities=priorities)
+
+    consumers = []
+    if "interactive" in priorities:
+        consumers.append(make_consumer(
+            queue="agent",
+            queue_url=settings.sqs_agent_queue_url,
+            handler=handle_agent_job,
+            visibility_timeout=600,  # 10 minutes for interactive agent jobs
+        ))
+    # On SQS without a batch queue, batch jobs arrive on the agent queue
+    if "batch" in priorities and (settings.queue_backend != "sqs" or settings.sqs_agent_batch_queue_url):
+        consumers.append(make_consumer(
+            queue="agent-batch",
+            queue_url=settings.sqs_agent_batch_queue_url,
+            handler=handle_agent_job,
+            visibility_timeout=1800,  # 30 minutes for batch agent jobs
+            max_messages=1,  # leave capacity for interactive jobs
+        ))
+    if not consumers:
+        raise SystemExit("AGENT_PRIORITIES selects no queue to consume")
 
     # Handle graceful shutdown
     loop = asyncio.get_event_loop()
 
     def shutdown():
         logger.info("Received shutdown signal")
-        consumer.stop()
+        for consumer in consumers:
+            consumer.stop()
 
     for sig in (signal.SIGTERM, signal.SIGINT):
         loop.add_signal_handler(sig, shutdown)
 
     try:
-        await consumer.start()
+        await asyncio.gather(*(consumer.start() for consumer in consumers))
     except asyncio.CancelledError:
         logger.info("Worker cancelled")
     finally:
@@ -14,8 +14,11 @@ sys.path.insert(0, str(__file__).rsplit("/", 2)[0])
 
 from shared.config import get_settings
 from shared.db import get_db
+from shared.internal_api import notify_file_event
+from shared.jobs import InvalidJob, decode_file_job
+from shared.quarantine import quarantine_job
 from shared.s3 import S3Client
-from shared.sqs import SQSConsumer
+from shared.redis_queue import make_consumer
 
 logger = structlog.get_logger()
 
@@ -47,6 +50,7 @@ async def process_file(file_id: str) -> None:
             "UPDATE files SET processing_status = 'processing' WHERE id = $1",
             file_id,
         )
+        await notify_file_event(file_id, str(file["org_id"]), file["filename"], "processing")
 
         # Extract text based on content type
         content_type = file["content_type"] or ""
@@ -100,6 +104,8 @@ async def process_file(file_id: str) -> None:
                 file_id,
             )
 
+        await notify_file_event(file_id, str(file["org_id"]), file["filename"], "processed")
+
         logger.info(
             "File processed successfully",
             file_id=file_id,
@@ -119,6 +125,7 @@ async def process_file(file_id: str) -> None:
             str(e),
             file_id,
         )
+        await notify_file_event(file_id, str(file["org_id"]), file["filename"], "failed", str(e))
         raise
 
 
@@ -258,17 +265,17 @@ async def generate_embedding(text: str) -> Optional[list[float]]:
 
 async def handle_file_job(message: dict[str, Any]) -> None:
     """Handle a file processing job."""
-    file_id = message.get("file_id")
-    action = message.get("action", "process")
-
-    if not file_id:
-        logger.error("Invalid message: missing file_id")
+    try:
+        job = decode_file_job(message)
+    except InvalidJob as e:
+        logger.error("Invalid message", error=str(e))
+        await quarantine_job("file", message, str(e))
         return
 
-    if action == "process":
-        await process_file(file_id)
+    if job.action == "process":
+        await process_file(job.file_id)
     else:
-        logger.warning("Unknown action", action=action)
+        logger.warning("Unknown action", action=job.action)
 
 
 async def main() -> None:
@@ -282,9 +289,10 @@ async def main() -> None:
         ]
     )
 
-    logger.info("Starting file processor worker", queue_url=settings.sqs_file_queue_url)
+    logger.info("Starting file processor worker", queue_backend=settings.queue_backend)
 
-    consumer = SQSConsumer(
+    consumer = make_consumer(
+        queue="file",
         queue_url=settings.sqs_file_queue_url,
         handler=handle_file_job,
         visibility_timeout=300,  # 5 minutes for file processing
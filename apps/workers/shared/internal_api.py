@@ -0,0 +1,188 @@
+"""Client for the API's worker-facing internal endpoints."""
+
+import asyncio
+import hashlib
+import hmac
+import json
+import secrets
+import time
+import urllib.request
+from typing import Any, Optional
+from urllib.parse import urlsplit
+
+import structlog
+
+from .config import get_settings
+
+logger = structlog.get_logger()
+
+
+def sign_request(secret: str, method: str, path: str, body: bytes) -> dict[str, str]:
+    """Build the X-Glassbox-* signature headers for a request.
+
+    The signature is HMAC-SHA256 over
+    METHOD \\n PATH \\n TIMESTAMP \\n NONCE \\n hex(sha256(BODY)),
+    where PATH includes any query string.
+    """
+    timestamp = str(int(time.time()))
+    nonce = secrets.token_hex(16)
+    canonical = "\n".join([
+        method.upper(),
+        path,
+        timestamp,
+        nonce,
+        hashlib.sha256(body).hexdigest(),
+    ])
+    signature = hmac.new(secret.encode(), canonical.encode(), hashlib.sha256).hexdigest()
+    return {
+        "X-Glassbox-Timestamp": timestamp,
+        "X-Glassbox-Nonce": nonce,
+        "X-Glassbox-Signature": signature,
+    }
+
+
+class InternalAPIClient:
+    """Sends signed requests to the API's /internal routes."""
+
+    def __init__(self):
+        self._settings = get_settings()
+
+    @property
+    def enabled(self) -> bool:
+        return bool(self._settings.internal_hmac_secret or self._settings.internal_service_token)
+
+    async def post(self, path: str, payload: dict[str, Any]) -> None:
+        """POST a JSON payload to an internal route (path is relative to internal_api_url)."""
+        if not self.enabled:
+            return
+        url = self._settings.internal_api_url.rstrip("/") + path
+        body = json.dumps(payload).encode()
+        await asyncio.to_thread(self._send, url, body)
+
+    def _send(self, url: str, body: bytes) -> None:
+        headers = {"Content-Type": "application/json"}
+        if self._settings.internal_hmac_secret:
+            parts = urlsplit(url)
+            signed_path = parts.path + (f"?{parts.query}" if parts.query else "")
+            headers.update(sign_request(self._settings.internal_hmac_secret, "POST", signed_path, body))
+        else:
+            headers["Authorization"] = f"Bearer {self._settings.internal_service_token}"
+
+        request = urllib.request.Request(url, data=body, headers=headers, method="POST")
+        with urllib.request.urlopen(request, timeout=5) as response:
+            response.read()
+
+
+async def notify_execution_event(
+    node_id: str,
+    execution_id: str,
+    status: str,
+    tokens_in: int,
+    tokens_out: int,
+    trace_summary: str = "",
+) -> None:
+    """Tell the API about an execution update so it reaches WebSocket clients.
+
+    Failures are logged and swallowed: the database is the source of truth and
+    clients catch up on their next fetch.
+    """
+    try:
+        await InternalAPIClient().post(
+            f"/executions/{execution_id}/events",
+            {
+                "nodeId": node_id,
+                "status": status,
+                "tokensIn": tokens_in,
+                "tokensOut": tokens_out,
+                "traceSummary": trace_summary,
+            },
+        )
+    except Exception as e:
+        logger.warning("Failed to notify API of execution event", execution_id=execution_id, error=str(e))
+
+
+async def notify_execution_progress(
+    node_id: str,
+    execution_id: str,
+    step: str,
+    phase: str,
+    tokens_in: int,
+    tokens_out: int,
+    tool: Optional[str] = None,
+    duration_ms: Optional[int] = None,
+) -> None:
+    """Report a step (llm_call or tool_call) starting or finishing.
+
+    Progress is relayed to the execution's WebSocket channel so trace views
+    update live. Failures are logged and swallowed like execution events.
+    """
+    payload: dict[str, Any] = {
+        "nodeId": node_id,
+        "step": step,
+        "phase": phase,
+        "totalTokensIn": tokens_in,
+        "totalTokensOut": tokens_out,
+    }
+    if tool:
+        payload["tool"] = tool
+    if duration_ms is not None:
+        payload["durationMs"] = duration_ms
+
+    try:
+        await InternalAPIClient().post(f"/executions/{execution_id}/progress", payload)
+    except Exception as e:
+        logger.warning("Failed to notify API of execution progress", execution_id=execution_id, error=str(e))
+
+
+async def notify_file_event(
+    file_id: str,
+    org_id: str,
+    filename: str,
+    status: str,
+    error: Optional[str] = None,
+) -> None:
+    """Report a file's processing status (processing, processed or failed).
+
+    Updates are relayed to the org's files channel so upload views show
+    extraction progress live. Failures are logged and swallowed like
+    execution events.
+    """
+    payload: dict[str, Any] = {"orgId": org_id, "filename": filename, "status": status}
+    if error:
+        payload["error"] = error[:2000]
+
+    try:
+        await InternalAPIClient().post(f"/files/{file_id}/events", payload)
+    except Exception as e:
+        logger.warning("Failed to notify API of file event", file_id=file_id, error=str(e))
+
+
+async def send_user_message(
+    user_id: str,
+    kind: str,
+    title: str,
+    body: str = "",
+    org_id: Optional[str] = None,
+    link: Optional[str] = None,
+    data: Optional[dict[str, Any]] = None,
+) -> None:
+    """Send a message straight to a user's open connections.
+
+    kind is "approval_request" or "mention". The user sees it whatever they
+    are subscribed to, but only while connected. Mentions sent with an org_id
+    are also stored as notifications; approval requests are stored when the
+    execution pauses for them. Failures are logged and swallowed like
+    execution events.
+    """
+    payload: dict[str, Any] = {"kind": kind, "title": title[:200], "body": body[:2000]}
+    if org_id:
+        payload["orgId"] = org_id
+    if link:
+        payload["link"] = link
+    if data:
+        payload["data"] = data
+
+    try:
+        await InternalAPIClient().post(f"/users/{user_id}/messages", payload)
+    except Exception as e:
+        logger.warning("Failed to send user message", user_id=user_id, kind=kind, error=str(e))
@@ -0,0 +1,154 @@
+"""Job message decoding.
+
+Mirrors apps/api/internal/queue/jobs.go. Jobs carry a schemaVersion so the
+API and the workers can be upgraded independently: a worker reports fields
+it doesn't know instead of dropping them silently, and leaves jobs from a
+newer schema on the queue for an upgraded worker (or the dead-letter queue).
+"""
+
+import random
+from dataclasses import dataclass, field
+from typing import Any, Optional
+
+import structlog
+
+logger = structlog.get_logger()
+
+AGENT_JOB_SCHEMA_VERSION = 1
+FILE_JOB_SCHEMA_VERSION = 1
+
+
+class InvalidJob(ValueError):
+    """A job is missing required fields."""
+
+
+class UnsupportedSchemaVersion(Exception):
+    """A job is newer than this worker understands."""
+
+
+@dataclass
+class AgentJob:
+    execution_id: str
+    node_id: str
+    org_id: str
+    org_config: dict[str, Any] = field(default_factory=dict)
+    priority: str = "interactive"
+    attempt: int = 1
+    retry: dict[str, int] = field(default_factory=dict)
+    trace_context: dict[str, str] = field(default_factory=dict)
+    schema_version: int = 1
+
+
+@dataclass
+class FileJob:
+    file_id: str
+    org_id: str
+    storage_key: str
+    filename: str = ""
+    content_type: str = ""
+    uploaded_by: Optional[str] = None
+    action: str = "process"
+    attempt: int = 1
+    retry: dict[str, int] = field(default_factory=dict)
+    trace_context: dict[str, str] = field(default_factory=dict)
+    schema_version: int = 1
+
+
+def _get(message: dict[str, Any], camel: str, snake: str) -> Any:
+    # camelCase from the Go API, snake_case from older producers
+    value = message.get(camel)
+    return value if value is not None else message.get(snake)
+
+
+def _check(kind: str, message: dict[str, Any], fields: dict[str, str], supported: int) -> int:
+    version = _get(message, "schemaVersion", "schema_version") or 1
+    known = set(fields) | set(fields.values()) | {"schemaVersion", "schema_version"}
+    unknown = sorted(key for key in message if key not in known)
+    if unknown:
+        logger.warning("Job has unknown fields", job=kind, fields=unknown)
+    if version > supported:
+        raise UnsupportedSchemaVersion(f"{kind} job schema version {version} (supported: {supported})")
+    return version
+
+
+def _require(kind: str, values: dict[str, Optional[str]]) -> None:
+    missing = [name for name, value in values.items() if not value]
+    if missing:
+        raise InvalidJob(f"{kind} job is missing {', '.join(missing)}")
+
+
+def decode_agent_job(message: dict[str, Any]) -> AgentJob:
+    """Decode and validate an agent job."""
+    fields = {
+        "executionId": "execution_id",
+        "nodeId": "node_id",
+        "orgId": "org_id",
+        "orgConfig": "org_config",
+        "priority": "priority",
+        "attempt": "attempt",
+        "retry": "retry",
+        "traceContext": "trace_context",
+    }
+    version = _check("agent", message, fields, AGENT_JOB_SCHEMA_VERSION)
+    job = AgentJob(
+        execution_id=_get(message, "executionId", "execution_id"),
+        node_id=_get(message, "nodeId", "node_id"),
+        org_id=_get(message, "orgId", "org_id"),
+        org_config=_get(message, "orgConfig", "org_config") or {},
+        priority=message.get("priority") or "interactive",
+        attempt=message.get("attempt") or 1,
+        retry=message.get("retry") or {},
+        trace_context=_get(message, "traceContext", "trace_context") or {},
+        schema_version=version,
+    )
+    _require("agent", {"executionId": job.execution_id, "nodeId": job.node_id, "orgId": job.org_id})
+    return job
+
+
+def decode_file_job(message: dict[str, Any]) -> FileJob:
+    """Decode and validate a file processing job."""
+    fields = {
+        "fileId": "file_id",
+        "orgId": "org_id",
+        "storageKey": "storage_key",
+        "filename": "filename",
+        "contentType": "content_type",
+        "uploadedBy": "uploaded_by",
+        "action": "action",
+        "attempt": "attempt",
+        "retry": "retry",
+        "traceContext": "trace_context",
+    }
+    version = _check("file", message, fields, FILE_JOB_SCHEMA_VERSION)
+    job = FileJob(
+        file_id=_get(message, "fileId", "file_id"),
+        org_id=_get(message, "orgId", "org_id"),
+        storage_key=_get(message, "storageKey", "storage_key"),
+        filename=message.get("filename") or "",
+        content_type=_get(message, "contentType", "content_type") or "",
+        uploaded_by=_get(message, "uploadedBy", "uploaded_by"),
+        action=message.get("action") or "process",
+        attempt=message.get("attempt") or 1,
+        retry=message.get("retry") or {},
+        trace_context=_get(message, "traceContext", "trace_context") or {},
+        schema_version=version,
+    )
+    _require("file", {"fileId": job.file_id, "orgId": job.org_id, "storageKey": job.storage_key})
+    return job
+
+
+def retry_delay(message: Any, receive_count: int) -> Optional[int]:
+    """Seconds to hide a failed job before its next delivery.
+
+    Follows the job's retry policy: exponential from initialBackoffSeconds
+    up to maxBackoffSeconds, with jitter, matching queue.Backoff in the API.
+    None when the job has no policy or is out of attempts (it goes to the
+    dead-letter queue on the next receive anyway).
+    """
+    retry = message.get("retry") if isinstance(message, dict) else None
+    if not retry or receive_count >= retry.get("maxAttempts", 0):
+        return None
+    delay = retry.get("initialBackoffSeconds", 0) * 2 ** (receive_count - 1)
+    delay = min(delay, retry.get("maxBackoffSeconds", delay))
+    half = delay // 2
+    return half + random.randint(0, delay - half)
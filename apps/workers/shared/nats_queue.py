@@ -0,0 +1,169 @@
+"""NATS JetStream consumer, used when the API runs with QUEUE_BACKEND=nats."""
+
+import asyncio
+import datetime
+import json
+from typing import Any, Callable
+
+import nats
+import structlog
+from nats.errors import TimeoutError as NATSTimeoutError
+from nats.js.api import AckPolicy, ConsumerConfig, RetentionPolicy, StorageType, StreamConfig
+from nats.js.errors import NotFoundError
+
+from .config import get_settings
+from .jobs import retry_delay
+
+logger = structlog.get_logger()
+
+# Must match apps/api/internal/queue/nats.go
+STREAM = "GLASSBOX_JOBS"
+SUBJECT_PREFIX = "glassbox.jobs."
+DEAD_LETTER_STREAM = "GLASSBOX_DLQ"
+DEAD_LETTER_PREFIX = "glassbox.dlq."
+CONSUMER_PREFIX = "glassbox-workers-"
+DEAD_LETTER_MAX_AGE = 14 * 24 * 3600
+HEADER_ATTRIBUTES = "Glassbox-Attributes"
+HEADER_RECEIVE_COUNT = "Glassbox-Receive-Count"
+HEADER_SENT_AT = "Glassbox-Sent-At"
+MAX_RECEIVES = 3
+
+
+class NATSConsumer:
+    """Async consumer of a JetStream work queue.
+
+    Behaves like SQSConsumer: messages are acknowledged once handled,
+    messages whose handler failed are redelivered after the job's retry
+    backoff or the ack wait, and messages delivered more than MAX_RECEIVES
+    times move to the dead-letter stream.
+    """
+
+    def __init__(
+        self,
+        queue: str,
+        handler: Callable[[dict], Any],
+        max_messages: int = 10,
+        wait_time_seconds: int = 20,
+        visibility_timeout: int = 300,
+    ):
+        self.subject = SUBJECT_PREFIX + queue
+        self.dead_letter_subject = DEAD_LETTER_PREFIX + queue
+        self.durable = CONSUMER_PREFIX + queue
+        self.handler = handler
+        self.max_messages = max_messages
+        self.wait_time_seconds = wait_time_seconds
+        self.visibility_timeout = visibility_timeout
+        self._running = False
+        self._settings = get_settings()
+
+    async def start(self) -> None:
+        """Start consuming messages."""
+        self._running = True
+        nc = await nats.connect(self._settings.nats_url, name="glassbox-worker", max_reconnect_attempts=-1)
+        js = nc.jetstream()
+
+        try:
+            await self._ensure_streams(js)
+            # Shared with the API's consumers of the same queue; an existing
+            # consumer is used as configured
+            sub = await js.pull_subscribe(
+                self.subject,
+                durable=self.durable,
+                stream=STREAM,
+                config=ConsumerConfig(
+                    ack_policy=AckPolicy.EXPLICIT,
+                    ack_wait=self.visibility_timeout,
+                    max_deliver=-1,  # dead-lettered here after MAX_RECEIVES
+                    filter_subject=self.subject,
+                ),
+            )
+
+            logger.info("Starting NATS consumer", subject=self.subject)
+            while self._running:
+                try:
+                    messages = await sub.fetch(self.max_messages, timeout=self.wait_time_seconds)
+                except NATSTimeoutError:
+                    continue
+                except Exception as e:
+                    logger.error("Error receiving messages", error=str(e))
+                    await asyncio.sleep(5)  # Back off on error
+                    continue
+
+                for msg in messages:
+                    if not await self._dead_letter_if_exhausted(js, msg):
+                        await self._process(msg)
+        finally:
+            await nc.close()
+
+    async def _ensure_streams(self, js: Any) -> None:
+        # The API creates the streams too; whichever starts first wins
+        streams = [
+            StreamConfig(
+                name=STREAM,
+                subjects=[SUBJECT_PREFIX + ">"],
+                retention=RetentionPolicy.WORK_QUEUE,
+                storage=StorageType.FILE,
+            ),
+            StreamConfig(
+                name=DEAD_LETTER_STREAM,
+                subjects=[DEAD_LETTER_PREFIX + ">"],
+                max_age=DEAD_LETTER_MAX_AGE,
+                storage=StorageType.FILE,
+            ),
+        ]
+        for config in streams:
+            try:
+                await js.stream_info(config.name)
+            except NotFoundError:
+                await js.add_stream(config)
+
+    async def _dead_letter_if_exhausted(self, js: Any, msg: Any) -> bool:
+        deliveries = msg.metadata.num_delivered
+        if deliveries <= MAX_RECEIVES:
+            return False
+
+        headers = {
+            HEADER_RECEIVE_COUNT: str(deliveries - 1),
+            HEADER_SENT_AT: _sent_at(msg.metadata.timestamp),
+        }
+        if msg.headers and HEADER_ATTRIBUTES in msg.headers:
+            headers[HEADER_ATTRIBUTES] = msg.headers[HEADER_ATTRIBUTES]
+        try:
+            await js.publish(self.dead_letter_subject, msg.data, headers=headers)
+            await msg.ack_sync()
+            logger.warning("Moved message to dead-letter stream", sequence=msg.metadata.sequence.stream)
+        except Exception as e:
+            logger.error("Failed to dead-letter message", sequence=msg.metadata.sequence.stream, error=str(e))
+        return True
+
+    async def _process(self, msg: Any) -> None:
+        sequence = msg.metadata.sequence.stream
+        body = None
+        try:
+            body = json.loads(msg.data)
+            await self.handler(body)
+
+            # Acknowledge message after successful processing
+            await msg.ack_sync()
+            logger.info("Message processed successfully", sequence=sequence)
+        except Exception as e:
+            logger.error("Failed to process message", sequence=sequence, error=str(e))
+            # Redelivered after the job's retry backoff, or the ack wait
+            # without one
+            delay = retry_delay(body, msg.metadata.num_delivered)
+            if delay is not None:
+                try:
+                    await msg.nak(delay=delay)
+                except Exception as e:
+                    logger.warning("Failed to set retry backoff", sequence=sequence, error=str(e))
+
+    def stop(self) -> None:
+        """Stop consuming messages."""
+        self._running = False
+        logger.info("Stopping NATS consumer")
+
+
+def _sent_at(timestamp: datetime.datetime) -> str:
+    if timestamp.tzinfo is None:
+        timestamp = timestamp.replace(tzinfo=datetime.timezone.utc)
+    return timestamp.isoformat()
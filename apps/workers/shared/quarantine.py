@@ -0,0 +1,40 @@
+"""Job quarantine.
+
+Mirrors apps/api/internal/queue/quarantine.go. Jobs a worker can't decode
+are stored in the job_quarantine table for admins to review, release or
+discard, instead of being dropped or retried until they dead-letter.
+"""
+
+import json
+from typing import Any
+
+import structlog
+
+from .db import get_db
+
+logger = structlog.get_logger()
+
+SOURCE_CONSUMER = "consumer"
+
+
+async def quarantine_job(queue: str, message: dict[str, Any], error: str) -> None:
+    """Quarantine a job this worker can't decode.
+
+    Failures are logged rather than raised: the job is invalid either way,
+    and retrying it would only fail again.
+    """
+    try:
+        db = await get_db()
+        await db.execute(
+            """
+            INSERT INTO job_quarantine (queue, body, source, attempts, last_error)
+            VALUES ($1, $2, $3, 1, $4)
+            """,
+            queue,
+            json.dumps(message).encode(),
+            SOURCE_CONSUMER,
+            error,
+        )
+        logger.warning("Quarantined job", queue=queue, error=error)
+    except Exception as e:
+        logger.error("Failed to quarantine invalid job", queue=queue, error=str(e), job_error=error)
@@ -0,0 +1,112 @@
+"""RabbitMQ consumer, used when the API runs with QUEUE_BACKEND=rabbitmq."""
+
+import asyncio
+import json
+from typing import Any, Callable
+
+import aio_pika
+import structlog
+
+from .config import get_settings
+from .jobs import retry_delay
+
+logger = structlog.get_logger()
+
+# Must match apps/api/internal/queue/rabbitmq.go; RabbitMQ refuses to
+# redeclare a queue with different arguments
+QUEUE_PREFIX = "glassbox."
+DEAD_LETTER_SUFFIX = ".dlq"
+MAX_RECEIVES = 3
+
+
+def queue_arguments(dead_letter_queue: str) -> dict:
+    return {
+        "x-queue-type": "quorum",
+        "x-delivery-limit": MAX_RECEIVES - 1,
+        "x-dead-letter-exchange": "",
+        "x-dead-letter-routing-key": dead_letter_queue,
+        "x-dead-letter-strategy": "at-least-once",
+        "x-overflow": "reject-publish",
+    }
+
+
+class RabbitMQConsumer:
+    """Async consumer of a RabbitMQ quorum queue.
+
+    Behaves like SQSConsumer: messages are acknowledged once handled,
+    messages whose handler failed are returned to the queue after the job's
+    retry backoff, and the queue dead-letters messages delivered
+    MAX_RECEIVES times. A delivery stays with this consumer until it is
+    handled, so the broker's consumer_timeout must exceed the visibility
+    timeout.
+    """
+
+    def __init__(
+        self,
+        queue: str,
+        handler: Callable[[dict], Any],
+        max_messages: int = 10,
+        visibility_timeout: int = 300,
+    ):
+        self.queue = QUEUE_PREFIX + queue
+        self.dead_letter_queue = self.queue + DEAD_LETTER_SUFFIX
+        self.handler = handler
+        self.max_messages = max_messages
+        self.visibility_timeout = visibility_timeout
+        self._running = False
+        self._settings = get_settings()
+
+    async def start(self) -> None:
+        """Start consuming messages."""
+        self._running = True
+        connection = await aio_pika.connect_robust(self._settings.rabbitmq_url)
+
+        try:
+            channel = await connection.channel()
+            await channel.set_qos(prefetch_count=self.max_messages)
+            await channel.declare_queue(
+                self.dead_letter_queue, durable=True, arguments={"x-queue-type": "classic"}
+            )
+            queue = await channel.declare_queue(
+                self.queue, durable=True, arguments=queue_arguments(self.dead_letter_queue)
+            )
+
+            logger.info("Starting RabbitMQ consumer", queue=self.queue)
+            async with queue.iterator() as messages:
+                async for message in messages:
+                    await self._process(message)
+                    if not self._running:
+                        break
+        finally:
+            await connection.close()
+
+    async def _process(self, message: Any) -> None:
+        body = None
+        try:
+            body = json.loads(message.body)
+            await self.handler(body)
+
+            # Acknowledge message after successful processing
+            await message.ack()
+            logger.info("Message processed successfully", message_id=message.message_id)
+        except Exception as e:
+            logger.error("Failed to process message", message_id=message.message_id, error=str(e))
+            # Returning it counts towards the delivery limit
+            receive_count = int((message.headers or {}).get("x-delivery-count", 0)) + 1
+            delay = retry_delay(body, receive_count)
+            if delay is not None:
+                asyncio.create_task(self._return_later(message, delay))
+            else:
+                await message.nack(requeue=True)
+
+    async def _return_later(self, message: Any, delay: int) -> None:
+        await asyncio.sleep(delay)
+        try:
+            await message.nack(requeue=True)
+        except Exception as e:
+            logger.warning("Failed to return message after retry backoff", message_id=message.message_id, error=str(e))
+
+    def stop(self) -> None:
+        """Stop consuming messages."""
+        self._running = False
+        logger.info("Stopping RabbitMQ consumer")
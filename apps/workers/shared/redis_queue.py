@@ -0,0 +1,173 @@
+"""Redis Streams consumer, used when the API runs with QUEUE_BACKEND=redis."""
+
+import asyncio
+import json
+import uuid
+from typing import Any, Callable
+
+import redis.asyncio as redis
+import structlog
+
+from .config import get_settings
+
+logger = structlog.get_logger()
+
+# Must match apps/api/internal/queue/redis.go
+STREAM_PREFIX = "glassbox:queue:"
+DEAD_LETTER_SUFFIX = ":dlq"
+CONSUMER_GROUP = "glassbox-workers"
+STREAM_MAX_LEN = 100000
+MAX_RECEIVES = 3
+
+
+class RedisStreamConsumer:
+    """Async consumer of a job stream.
+
+    Behaves like SQSConsumer: messages are deleted once handled, messages
+    whose handler failed are redelivered after the visibility timeout, and
+    messages delivered more than MAX_RECEIVES times move to the dead-letter
+    stream.
+    """
+
+    def __init__(
+        self,
+        queue: str,
+        handler: Callable[[dict], Any],
+        max_messages: int = 10,
+        wait_time_seconds: int = 20,
+        visibility_timeout: int = 300,
+    ):
+        self.stream = STREAM_PREFIX + queue
+        self.dead_letter_stream = self.stream + DEAD_LETTER_SUFFIX
+        self.handler = handler
+        self.max_messages = max_messages
+        self.wait_time_seconds = wait_time_seconds
+        self.visibility_timeout = visibility_timeout
+        self.consumer = f"worker-{uuid.uuid4()}"
+        self._running = False
+        self._settings = get_settings()
+
+    async def start(self) -> None:
+        """Start consuming messages."""
+        self._running = True
+        client = redis.from_url(self._settings.redis_url)
+
+        try:
+            await client.xgroup_create(self.stream, CONSUMER_GROUP, id="0", mkstream=True)
+        except redis.ResponseError as e:
+            if "BUSYGROUP" not in str(e):
+                raise
+
+        logger.info("Starting Redis stream consumer", stream=self.stream)
+        try:
+            while self._running:
+                try:
+                    for entry_id, fields in await self._receive(client):
+                        await self._process(client, entry_id, fields)
+                except Exception as e:
+                    logger.error("Error receiving messages", error=str(e))
+                    await asyncio.sleep(5)  # Back off on error
+        finally:
+            await client.aclose()
+
+    async def _receive(self, client: redis.Redis) -> list[tuple[bytes, dict]]:
+        # Entries another consumer read but never acknowledged come first
+        _, claimed, *_ = await client.xautoclaim(
+            self.stream,
+            CONSUMER_GROUP,
+            self.consumer,
+            min_idle_time=self.visibility_timeout * 1000,
+            start_id="0-0",
+            count=self.max_messages,
+        )
+        if claimed:
+            return [entry for entry in claimed if not await self._dead_letter_if_exhausted(client, *entry)]
+
+        response = await client.xreadgroup(
+            CONSUMER_GROUP,
+            self.consumer,
+            {self.stream: ">"},
+            count=self.max_messages,
+            block=self.wait_time_seconds * 1000,
+        )
+        return [entry for _, entries in response for entry in entries]
+
+    async def _dead_letter_if_exhausted(self, client: redis.Redis, entry_id: bytes, fields: dict) -> bool:
+        pending = await client.xpending_range(
+            self.stream, CONSUMER_GROUP, min=entry_id, max=entry_id, count=1
+        )
+        deliveries = pending[0]["times_delivered"] if pending else 1
+        if deliveries <= MAX_RECEIVES:
+            return False
+
+        pipe = client.pipeline(transaction=True)
+        pipe.xadd(
+            self.dead_letter_stream,
+            {
+                b"body": fields.get(b"body", b""),
+                b"attributes": fields.get(b"attributes", b"{}"),
+                b"receive_count": deliveries - 1,
+                b"source_id": entry_id,
+            },
+            maxlen=STREAM_MAX_LEN,
+            approximate=True,
+        )
+        pipe.xack(self.stream, CONSUMER_GROUP, entry_id)
+        pipe.xdel(self.stream, entry_id)
+        await pipe.execute()
+        logger.warning("Moved message to dead-letter stream", message_id=entry_id.decode())
+        return True
+
+    async def _process(self, client: redis.Redis, entry_id: bytes, fields: dict) -> None:
+        try:
+            body = json.loads(fields[b"body"])
+            await self.handler(body)
+
+            # Delete message after successful processing
+            await client.xack(self.stream, CONSUMER_GROUP, entry_id)
+            await client.xdel(self.stream, entry_id)
+            logger.info("Message processed successfully", message_id=entry_id.decode())
+        except Exception as e:
+            logger.error("Failed to process message", message_id=entry_id.decode(), error=str(e))
+            # Message will be claimed again after the visibility timeout
+
+    def stop(self) -> None:
+        """Stop consuming messages."""
+        self._running = False
+        logger.info("Stopping Redis stream consumer")
+
+
+def make_consumer(
+    queue: str,
+    queue_url: str,
+    handler: Callable[[dict], Any],
+    visibility_timeout: int,
+    max_messages: int = 10,
+):
+    """Build a consumer for the configured queue backend.
+
+    queue is the logical queue name ("agent", "agent-batch" or "file") used
+    by Redis, NATS and RabbitMQ; queue_url is the SQS queue.
+    """
+    from .sqs import SQSConsumer
+
+    backend = get_settings().queue_backend
+    if backend == "redis":
+        return RedisStreamConsumer(
+            queue, handler, max_messages=max_messages, visibility_timeout=visibility_timeout
+        )
+    if backend == "nats":
+        from .nats_queue import NATSConsumer
+
+        return NATSConsumer(
+            queue, handler, max_messages=max_messages, visibility_timeout=visibility_timeout
+        )
+    if backend == "rabbitmq":
+        from .rabbitmq_queue import RabbitMQConsumer
+
+        return RabbitMQConsumer(
+            queue, handler, max_messages=max_messages, visibility_timeout=visibility_timeout
+        )
+    return SQSConsumer(
+        queue_url=queue_url, handler=handler, max_messages=max_messages, visibility_timeout=visibility_timeout
+    )
@@ -8,6 +8,7 @@ import aioboto3
 import structlog
 
 from .config import get_settings
+from .jobs import retry_delay
 
 logger = structlog.get_logger()
 
@@ -58,12 +59,15 @@ class SQSConsumer:
                         WaitTimeSeconds=self.wait_time_seconds,
                         VisibilityTimeout=self.visibility_timeout,
                         MessageAttributeNames=["All"],
+                        AttributeNames=["ApproximateReceiveCount"],
                     )
 
                     messages = response.get("Messages", [])
 
                     for message in messages:
+                        body = None
                         try:
+                            await self._extend_visibility(sqs, message)
                             body = json.loads(message["Body"])
                             await self.handler(body)
 
@@ -82,12 +86,47 @@ class SQSConsumer:
                                 message_id=message["MessageId"],
                                 error=str(e),
                             )
-                            # Message will become visible again after visibility timeout
+                            # Message will become visible again after the job's
+                            # retry backoff, or the visibility timeout without one
+                            await self._back_off(sqs, message, body)
 
                 except Exception as e:
                     logger.error("Error receiving messages", error=str(e))
                     await asyncio.sleep(5)  # Back off on error
 
+    async def _extend_visibility(self, sqs: Any, message: dict) -> None:
+        # Producers may ask for a longer visibility timeout than this consumer
+        # uses, e.g. batch agent jobs on a queue shared with interactive ones
+        attribute = message.get("MessageAttributes", {}).get("VisibilityTimeoutSeconds", {})
+        try:
+            wanted = int(attribute.get("StringValue", 0))
+        except ValueError:
+            return
+        if wanted <= self.visibility_timeout:
+            return
+        try:
+            await sqs.change_message_visibility(
+                QueueUrl=self.queue_url,
+                ReceiptHandle=message["ReceiptHandle"],
+                VisibilityTimeout=min(wanted, 43200),  # SQS maximum
+            )
+        except Exception as e:
+            logger.warning("Failed to extend visibility timeout", message_id=message["MessageId"], error=str(e))
+
+    async def _back_off(self, sqs: Any, message: dict, body: Any) -> None:
+        receive_count = int(message.get("Attributes", {}).get("ApproximateReceiveCount", 1))
+        delay = retry_delay(body, receive_count)
+        if delay is None:
+            return
+        try:
+            await sqs.change_message_visibility(
+                QueueUrl=self.queue_url,
+                ReceiptHandle=message["ReceiptHandle"],
+                VisibilityTimeout=min(delay, 43200),  # SQS maximum
+            )
+        except Exception as e:
+            logger.warning("Failed to set retry backoff", message_id=message["MessageId"], error=str(e))
+
     def stop(self) -> None:
         """Stop consuming messages."""
         self._running = False
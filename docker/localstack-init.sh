@@ -7,11 +7,27 @@ awslocal s3 mb s3://glassbox-files-dev
 
 # Create SQS queues
 awslocal sqs create-queue --queue-name glassbox-agent-jobs-dev
+awslocal sqs create-queue --queue-name glassbox-agent-batch-jobs-dev
 awslocal sqs create-queue --queue-name glassbox-file-processing-dev
 awslocal sqs create-queue --queue-name glassbox-notifications-dev
 
+# SNS topic for domain events (EVENTS_SNS_TOPIC_ARN)
+awslocal sns create-topic --name glassbox-events-dev
+
 # Create dead letter queues
 awslocal sqs create-queue --queue-name glassbox-agent-jobs-dlq-dev
+awslocal sqs create-queue --queue-name glassbox-agent-batch-jobs-dlq-dev
 awslocal sqs create-queue --queue-name glassbox-file-processing-dlq-dev
 
+# FIFO variants: point SQS_AGENT_QUEUE_URL/SQS_FILE_QUEUE_URL (and the DLQ
+# URLs) at these to process each node's executions in order
+awslocal sqs create-queue --queue-name glassbox-agent-jobs-dlq-dev.fifo \
+  --attributes FifoQueue=true,ContentBasedDeduplication=true
+awslocal sqs create-queue --queue-name glassbox-file-processing-dlq-dev.fifo \
+  --attributes FifoQueue=true,ContentBasedDeduplication=true
+awslocal sqs create-queue --queue-name glassbox-agent-jobs-dev.fifo \
+  --attributes '{"FifoQueue":"true","ContentBasedDeduplication":"true","RedrivePolicy":"{\"deadLetterTargetArn\":\"arn:aws:sqs:us-east-1:000000000000:glassbox-agent-jobs-dlq-dev.fifo\",\"maxReceiveCount\":\"3\"}"}'
+awslocal sqs create-queue --queue-name glassbox-file-processing-dev.fifo \
+  --attributes '{"FifoQueue":"true","ContentBasedDeduplication":"true","RedrivePolicy":"{\"deadLetterTargetArn\":\"arn:aws:sqs:us-east-1:000000000000:glassbox-file-processing-dlq-dev.fifo\",\"maxReceiveCount\":\"3\"}"}'
+
 echo "LocalStack initialization complete!"
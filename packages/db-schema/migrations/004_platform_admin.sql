@@ -0,0 +1,19 @@
+-- Migration: Platform admins and feature flags
+-- Created: 2026-10-16
+
+-- =====================================================
+-- PLATFORM ADMINS & FEATURE FLAGS
+-- =====================================================
+-- Platform admins operate GlassBox itself (cross-org support and ops). This is
+-- separate from org roles and is granted directly in the database.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS is_platform_admin BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS feature_flags (
+    key VARCHAR(100) PRIMARY KEY,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    description TEXT,
+    -- Orgs the flag is on for even when it is globally off
+    enabled_org_ids UUID[] NOT NULL DEFAULT '{}',
+    updated_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    updated_at TIMESTAMPTZ DEFAULT NOW()
+);
@@ -0,0 +1,5 @@
+-- Migration: Job outbox message groups
+-- Created: 2026-10-16
+
+-- SQS FIFO message group of each outbox job (the node of an agent job)
+ALTER TABLE job_outbox ADD COLUMN IF NOT EXISTS group_id VARCHAR(128);
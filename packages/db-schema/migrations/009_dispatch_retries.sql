@@ -0,0 +1,8 @@
+-- Migration: Dispatch retries
+-- Created: 2026-10-16
+
+-- Retry backoff for outbox jobs the queue rejected
+ALTER TABLE job_outbox ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMPTZ;
+
+-- How many jobs were dispatched for each execution (start, resume, input)
+ALTER TABLE agent_executions ADD COLUMN IF NOT EXISTS dispatch_attempts INTEGER NOT NULL DEFAULT 0;
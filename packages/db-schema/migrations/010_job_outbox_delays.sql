@@ -0,0 +1,5 @@
+-- Migration: Delayed outbox jobs
+-- Created: 2026-10-16
+
+-- When a delayed outbox job is due; the relay passes on the remaining delay
+ALTER TABLE job_outbox ADD COLUMN IF NOT EXISTS deliver_at TIMESTAMPTZ;
@@ -0,0 +1,67 @@
+-- Migration: Domain event store
+-- Created: 2026-10-16
+
+-- event_sourcing_level is now 'full', 'snapshot' or 'off'; 'audit' (audit
+-- log only) recorded no events, which is what 'off' means
+UPDATE organizations SET event_sourcing_level = 'off' WHERE event_sourcing_level = 'audit';
+ALTER TABLE organizations ADD CONSTRAINT organizations_event_sourcing_level_check
+    CHECK (event_sourcing_level IN ('full', 'snapshot', 'off'));
+
+-- Append-only history of changes to orgs, projects, nodes and files.
+-- Sequence numbers each aggregate's events from 1. In 'full' mode data is
+-- the aggregate's state after the event; in 'snapshot' mode it's a merge
+-- patch of the top-level fields that changed (is_patch). A deletion has
+-- null data.
+CREATE TABLE domain_events (
+    id BIGSERIAL PRIMARY KEY,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    aggregate_type VARCHAR(50) NOT NULL, -- 'organization', 'project', 'node', 'file'
+    aggregate_id UUID NOT NULL,
+    sequence INTEGER NOT NULL,
+    event_type VARCHAR(100) NOT NULL, -- 'node.created', 'node.updated', ...
+    data JSONB,
+    is_patch BOOLEAN NOT NULL DEFAULT false,
+    actor_id UUID,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE(aggregate_type, aggregate_id, sequence)
+);
+
+CREATE INDEX idx_domain_events_org ON domain_events(org_id, id);
+
+-- Events are never changed once written
+CREATE FUNCTION reject_domain_event_update() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'domain_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER domain_events_append_only
+    BEFORE UPDATE ON domain_events
+    FOR EACH ROW EXECUTE FUNCTION reject_domain_event_update();
+
+-- The last sequence number and current state of each aggregate, locked
+-- while an event is appended so sequences have no gaps or duplicates
+CREATE TABLE event_streams (
+    aggregate_type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    sequence INTEGER NOT NULL DEFAULT 0,
+    state JSONB,
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (aggregate_type, aggregate_id)
+);
+
+-- Periodic full states in 'snapshot' mode, so replay starts from the
+-- nearest snapshot instead of the first event
+CREATE TABLE aggregate_snapshots (
+    aggregate_type VARCHAR(50) NOT NULL,
+    aggregate_id UUID NOT NULL,
+    sequence INTEGER NOT NULL,
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    state JSONB,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (aggregate_type, aggregate_id, sequence)
+);
@@ -0,0 +1,98 @@
+-- Migration: Row audit triggers
+-- Created: 2026-10-16
+
+-- Orgs that set settings.rowAudit get every insert, update and delete of
+-- their nodes, files and executions written to audit_log by the database
+-- itself, so changes made outside the API (a migration, a worker, psql) are
+-- recorded too. details holds the row before ('old') and after ('new') the
+-- change; an update records only the columns that changed, and one that
+-- changes none of the audited columns isn't recorded. The database role
+-- and transaction ID stand in for the actor, which the database doesn't
+-- know.
+--
+-- The trigger arguments are the resource type and the columns left out:
+-- large derived data and, for nodes, the edit lock, which is renewed while
+-- a node is being edited.
+CREATE FUNCTION audit_row_change() RETURNS TRIGGER AS $$
+DECLARE
+    resource_type TEXT := TG_ARGV[0];
+    row_data JSONB;
+    old_data JSONB;
+    new_data JSONB;
+    changed_old JSONB;
+    changed_new JSONB;
+    row_org_id UUID;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_data := to_jsonb(OLD);
+    ELSE
+        row_data := to_jsonb(NEW);
+    END IF;
+
+    -- Executions belong to their node's org. An execution deleted with its
+    -- node isn't recorded; the node's deletion is.
+    row_org_id := COALESCE(
+        (row_data->>'org_id')::UUID,
+        (SELECT org_id FROM nodes WHERE id = (row_data->>'node_id')::UUID)
+    );
+    -- Rows deleted with their org aren't recorded either: the org, and so
+    -- its audit log, is already gone
+    IF row_org_id IS NULL OR NOT EXISTS (
+        SELECT 1 FROM organizations
+        WHERE id = row_org_id AND COALESCE((settings->>'rowAudit')::BOOLEAN, false)
+    ) THEN
+        RETURN NULL;
+    END IF;
+
+    IF TG_OP <> 'INSERT' THEN
+        old_data := to_jsonb(OLD);
+    END IF;
+    IF TG_OP <> 'DELETE' THEN
+        new_data := to_jsonb(NEW);
+    END IF;
+    FOR i IN 1 .. TG_NARGS - 1 LOOP
+        old_data := old_data - TG_ARGV[i];
+        new_data := new_data - TG_ARGV[i];
+    END LOOP;
+
+    IF TG_OP = 'UPDATE' THEN
+        SELECT jsonb_object_agg(o.key, o.value), jsonb_object_agg(o.key, new_data->o.key)
+        INTO changed_old, changed_new
+        FROM jsonb_each(old_data) o
+        WHERE o.value IS DISTINCT FROM new_data->o.key;
+
+        IF changed_old IS NULL THEN
+            RETURN NULL;
+        END IF;
+        old_data := changed_old;
+        new_data := changed_new;
+    END IF;
+
+    INSERT INTO audit_log (org_id, action, resource_type, resource_id, details)
+    VALUES (
+        row_org_id,
+        resource_type || CASE TG_OP WHEN 'INSERT' THEN '.created' WHEN 'UPDATE' THEN '.updated' ELSE '.deleted' END,
+        resource_type,
+        (row_data->>'id')::UUID,
+        jsonb_build_object(
+            'old', old_data,
+            'new', new_data,
+            'dbUser', current_user,
+            'txid', txid_current()
+        )
+    );
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER nodes_row_audit
+    AFTER INSERT OR UPDATE OR DELETE ON nodes
+    FOR EACH ROW EXECUTE FUNCTION audit_row_change('node', 'locked_by', 'locked_at', 'lock_expires_at', 'updated_at');
+
+CREATE TRIGGER files_row_audit
+    AFTER INSERT OR UPDATE OR DELETE ON files
+    FOR EACH ROW EXECUTE FUNCTION audit_row_change('file', 'extracted_text', 'embedding');
+
+CREATE TRIGGER agent_executions_row_audit
+    AFTER INSERT OR UPDATE OR DELETE ON agent_executions
+    FOR EACH ROW EXECUTE FUNCTION audit_row_change('execution', 'langgraph_checkpoint', 'trace_summary');
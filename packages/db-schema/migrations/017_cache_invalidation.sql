@@ -0,0 +1,44 @@
+-- Migration: Cache invalidation notifications
+-- Created: 2026-10-16
+
+-- API instances cache org roles, platform admin flags, IP allowlists and
+-- org settings in memory. Changes to the rows they come from are notified
+-- on the cache_invalidation channel, whichever instance or tool makes
+-- them, so every instance drops its copy. Notifications are sent when the
+-- transaction commits, and not at all if it rolls back.
+CREATE FUNCTION notify_cache_invalidation() RETURNS TRIGGER AS $$
+DECLARE
+    row_data JSONB;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        row_data := to_jsonb(OLD);
+    ELSE
+        row_data := to_jsonb(NEW);
+    END IF;
+
+    PERFORM pg_notify('cache_invalidation', jsonb_strip_nulls(jsonb_build_object(
+        'table', TG_TABLE_NAME,
+        'orgId', CASE WHEN TG_TABLE_NAME = 'organizations' THEN row_data->'id' ELSE row_data->'org_id' END,
+        'userId', CASE WHEN TG_TABLE_NAME = 'users' THEN row_data->'id' ELSE row_data->'user_id' END
+    ))::TEXT);
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER org_members_cache_invalidation
+    AFTER INSERT OR UPDATE OR DELETE ON org_members
+    FOR EACH ROW EXECUTE FUNCTION notify_cache_invalidation();
+
+CREATE TRIGGER organizations_cache_invalidation
+    AFTER UPDATE OR DELETE ON organizations
+    FOR EACH ROW EXECUTE FUNCTION notify_cache_invalidation();
+
+CREATE TRIGGER org_ip_allowlists_cache_invalidation
+    AFTER INSERT OR UPDATE OR DELETE ON org_ip_allowlists
+    FOR EACH ROW EXECUTE FUNCTION notify_cache_invalidation();
+
+CREATE TRIGGER users_cache_invalidation
+    AFTER UPDATE OF is_platform_admin ON users
+    FOR EACH ROW
+    WHEN (OLD.is_platform_admin IS DISTINCT FROM NEW.is_platform_admin)
+    EXECUTE FUNCTION notify_cache_invalidation();
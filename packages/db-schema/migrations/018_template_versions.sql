@@ -0,0 +1,42 @@
+-- Migration: Template versions
+-- Created: 2026-10-16
+
+-- Every change to a template bumps its version and keeps a copy of what
+-- it was, so nodes and projects can record the version they came from
+ALTER TABLE templates ADD COLUMN version INTEGER NOT NULL DEFAULT 1;
+
+CREATE TABLE template_versions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    template_id UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+    version INTEGER NOT NULL,
+
+    -- The template as of this version
+    name VARCHAR(255) NOT NULL,
+    description TEXT,
+    structure JSONB NOT NULL,
+    agent_config JSONB DEFAULT '{}',
+
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+
+    UNIQUE(template_id, version)
+);
+
+-- Existing templates start at version 1
+INSERT INTO template_versions (template_id, version, name, description, structure, agent_config, created_by, created_at)
+SELECT id, 1, name, description, structure, agent_config, created_by, updated_at
+FROM templates;
+
+-- Where nodes and projects were instantiated from. The template may since
+-- have been deleted, leaving the version for reference.
+ALTER TABLE nodes
+    ADD COLUMN template_id UUID REFERENCES templates(id) ON DELETE SET NULL,
+    ADD COLUMN template_version INTEGER;
+
+ALTER TABLE projects
+    ADD COLUMN template_id UUID REFERENCES templates(id) ON DELETE SET NULL,
+    ADD COLUMN template_version INTEGER;
+
+-- For the outdated instances report
+CREATE INDEX idx_nodes_template ON nodes(template_id, template_version)
+    WHERE template_id IS NOT NULL AND deleted_at IS NULL;
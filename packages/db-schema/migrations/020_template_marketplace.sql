@@ -0,0 +1,42 @@
+-- Migration: Template marketplace
+-- Created: 2026-10-16
+
+-- Catalog metadata. Usage and rating totals are kept on the template so the
+-- catalog can sort by them; rating_score is the average rating in
+-- hundredths, 0 when unrated.
+ALTER TABLE templates
+    ADD COLUMN categories TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN is_featured BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN usage_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN rating_count INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN rating_total INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN rating_score INTEGER GENERATED ALWAYS AS (
+        CASE WHEN rating_count = 0 THEN 0 ELSE rating_total * 100 / rating_count END
+    ) STORED;
+
+-- updated_at is the template's ETag, so usage and ratings, which change
+-- often and only through their own updates, don't touch it
+DROP TRIGGER update_templates_updated_at ON templates;
+CREATE TRIGGER update_templates_updated_at
+    BEFORE UPDATE ON templates
+    FOR EACH ROW
+    WHEN ((OLD.usage_count, OLD.rating_count, OLD.rating_total)
+          IS NOT DISTINCT FROM (NEW.usage_count, NEW.rating_count, NEW.rating_total))
+    EXECUTE FUNCTION update_updated_at();
+
+-- One rating per user per template
+CREATE TABLE template_ratings (
+    template_id UUID NOT NULL REFERENCES templates(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    rating SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    updated_at TIMESTAMPTZ DEFAULT NOW(),
+
+    PRIMARY KEY (template_id, user_id)
+);
+
+-- Catalog browsing
+CREATE INDEX idx_templates_categories ON templates USING GIN (categories) WHERE is_public;
+CREATE INDEX idx_templates_popular ON templates(usage_count DESC, id DESC) WHERE is_public;
+CREATE INDEX idx_templates_rating ON templates(rating_score DESC, id DESC) WHERE is_public;
@@ -0,0 +1,21 @@
+-- Migration: User deactivation and account deletion
+-- Created: 2026-10-16
+
+-- Deactivated users can't use the API until a platform admin reactivates
+-- them. Deleted users are kept, anonymized, so the nodes, versions and audit
+-- records that name them still resolve. Tokens issued before
+-- tokens_revoked_at are rejected.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deactivated_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tokens_revoked_at TIMESTAMPTZ;
+
+-- API instances cache these with the platform admin flag
+DROP TRIGGER IF EXISTS users_cache_invalidation ON users;
+CREATE TRIGGER users_cache_invalidation
+    AFTER UPDATE OF is_platform_admin, deactivated_at, deleted_at, tokens_revoked_at ON users
+    FOR EACH ROW
+    WHEN (OLD.is_platform_admin IS DISTINCT FROM NEW.is_platform_admin
+       OR OLD.deactivated_at IS DISTINCT FROM NEW.deactivated_at
+       OR OLD.deleted_at IS DISTINCT FROM NEW.deleted_at
+       OR OLD.tokens_revoked_at IS DISTINCT FROM NEW.tokens_revoked_at)
+    EXECUTE FUNCTION notify_cache_invalidation();
@@ -0,0 +1,6 @@
+-- Migration: Notification digests
+-- Created: 2026-10-16
+
+-- When the user's last daily or weekly digest was sent. The next digest
+-- covers low-priority notifications created since.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_digest_at TIMESTAMPTZ;
@@ -0,0 +1,19 @@
+-- Migration: Web Push subscriptions
+-- Created: 2026-10-16
+
+-- Browser push subscriptions; high-priority notifications are sent to each
+-- of the user's subscriptions
+CREATE TABLE IF NOT EXISTS push_subscriptions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    -- Push service URL; unique per browser installation
+    endpoint TEXT NOT NULL UNIQUE,
+    -- Client keys for payload encryption (RFC 8291), base64url
+    p256dh TEXT NOT NULL,
+    auth TEXT NOT NULL,
+    user_agent TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_push_subscriptions_user ON push_subscriptions(user_id);
@@ -0,0 +1,14 @@
+-- Migration: User onboarding
+-- Created: 2026-10-16
+
+-- Completed onboarding checklist steps. Services record them as users
+-- reach them; the frontend can mark steps too.
+CREATE TABLE IF NOT EXISTS user_onboarding_steps (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    step VARCHAR(50) NOT NULL,
+    completed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (user_id, step)
+);
+
+-- Set when the user hides the checklist
+ALTER TABLE users ADD COLUMN IF NOT EXISTS onboarding_dismissed_at TIMESTAMPTZ;
@@ -0,0 +1,8 @@
+-- Migration: User activity indexes
+-- Created: 2026-10-16
+
+-- GET /users/me/activity lists a user's edits, executions and uploads,
+-- newest first
+CREATE INDEX IF NOT EXISTS idx_node_versions_changed_by ON node_versions(changed_by, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_agent_executions_started_by ON agent_executions(started_by, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_files_uploaded_by ON files(uploaded_by, created_at DESC);
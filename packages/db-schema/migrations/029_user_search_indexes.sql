@@ -0,0 +1,7 @@
+-- Migration: User search indexes
+-- Created: 2026-10-16
+
+-- Prefix search on names and emails for member pickers and @-mention
+-- autocomplete (GET /orgs/:orgId/users/search)
+CREATE INDEX IF NOT EXISTS idx_users_email_prefix ON users(lower(email) text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_users_name_prefix ON users(lower(name) text_pattern_ops);
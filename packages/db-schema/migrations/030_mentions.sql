@@ -0,0 +1,19 @@
+-- Migration: Mentions
+-- Created: 2026-10-16
+
+-- Users @mentioned in a node's description. One row per user and resource,
+-- so saving the same text again doesn't notify them twice.
+CREATE TABLE IF NOT EXISTS mentions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    mentioned_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    -- What the mention is in; only 'node' so far
+    resource_type VARCHAR(50) NOT NULL,
+    resource_id UUID NOT NULL,
+    excerpt TEXT,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (resource_type, resource_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_mentions_user ON mentions(user_id, created_at DESC);
@@ -0,0 +1,23 @@
+-- Migration: Org invitations
+-- Created: 2026-10-16
+
+-- Invitations to join an org, for people who may not have an account yet.
+-- The token is only ever sent to the invitee; its SHA-256 is stored. An
+-- email has at most one pending invitation per org; inviting again replaces
+-- its token and expiry.
+CREATE TABLE IF NOT EXISTS org_invitations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    org_id UUID NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+    email VARCHAR(255) NOT NULL,
+    role VARCHAR(50) NOT NULL DEFAULT 'member',
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ,
+    accepted_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_org_invitations_pending
+    ON org_invitations(org_id, lower(email)) WHERE accepted_at IS NULL AND revoked_at IS NULL;
@@ -14,7 +14,7 @@ export interface Organization {
   name: string;
   slug: string;
   settings: OrganizationSettings;
-  eventSourcingLevel: 'full' | 'snapshot' | 'audit';
+  eventSourcingLevel: 'full' | 'snapshot' | 'off';
   createdAt: ISODateTime;
   updatedAt: ISODateTime;
 }
@@ -25,6 +25,7 @@ export interface OrganizationSettings {
   selfHostedKey?: string;
   defaultModel?: string;
   agentPolicies?: AgentPolicy[];
+  deletedRetentionDays?: number; // 1–3650; server default when unset
 }
 
 export interface ModelConfig {
@@ -417,6 +418,34 @@ export type NotificationType =
   | 'mention'
   | 'comment';
 
+// =====================================================
+// DOMAIN EVENTS
+// =====================================================
+
+export type AggregateType = 'organization' | 'project' | 'node' | 'file';
+
+// data is the state after the event, or with patch the top-level fields
+// that changed (null = removed); null for a deletion
+export interface DomainEvent {
+  id: number;
+  orgId: UUID;
+  aggregateType: AggregateType;
+  aggregateId: UUID;
+  sequence: number;
+  type: string;
+  data: Record<string, unknown> | null;
+  patch: boolean;
+  actorId?: UUID;
+  createdAt: ISODateTime;
+}
+
+export interface AggregateState {
+  aggregateType: AggregateType;
+  aggregateId: UUID;
+  sequence: number;
+  state: Record<string, unknown> | null;
+}
+
 // =====================================================
 // API REQUESTS/RESPONSES
 // =====================================================
@@ -461,12 +490,15 @@ export interface SemanticSearchRequest {
   threshold?: number;
 }
 
+export interface PageInfo {
+  nextCursor?: string;
+  hasMore: boolean;
+}
+
+// Total, when counted, is in the X-Total-Count header
 export interface PaginatedResponse<T> {
   data: T[];
-  total: number;
-  limit: number;
-  offset: number;
-  hasMore: boolean;
+  pagination: PageInfo;
 }
 
 // =====================================================